@@ -0,0 +1,52 @@
+use std::env;
+
+use criterion::{black_box, criterion_group, criterion_main, Criterion, Throughput};
+use jd_benches::large::{parse_byte_size, LargeShape, DEFAULT_LARGE_BYTES};
+use jd_core::{DiffOptions, Node, RenderConfig};
+
+/// Returns the size of each generated document, from `JD_BENCH_LARGE_BYTES`
+/// (such as `100M` or `1G`) or the 10 MiB default.
+fn large_bytes() -> usize {
+    match env::var("JD_BENCH_LARGE_BYTES") {
+        Ok(value) => parse_byte_size(&value)
+            .unwrap_or_else(|| panic!("JD_BENCH_LARGE_BYTES={value:?} is not a byte size")),
+        Err(_) => DEFAULT_LARGE_BYTES,
+    }
+}
+
+/// Times parsing, diffing, and rendering separately for each shape, so a
+/// change to one phase shows up in its own measurement.
+fn bench_large(c: &mut Criterion) {
+    let target_bytes = large_bytes();
+    let options = DiffOptions::default();
+    let config = RenderConfig::default();
+    for shape in LargeShape::ALL {
+        let corpus = shape.generate(target_bytes);
+        let dataset = corpus.load().expect("generated documents parse");
+        let diff = dataset.diff(&options);
+
+        let mut group = c.benchmark_group(format!("large-{}", shape.name()));
+        group.sample_size(10);
+        group.throughput(Throughput::Bytes(corpus.fixture_bytes() as u64));
+        group.bench_function("parse", |b| {
+            b.iter(|| {
+                let before = Node::from_json_str(corpus.before()).expect("valid JSON");
+                let after = Node::from_json_str(corpus.after()).expect("valid JSON");
+                black_box((before, after));
+            });
+        });
+        group.bench_function("diff", |b| {
+            b.iter(|| black_box(dataset.diff(&options)));
+        });
+        group.bench_function("render-native", |b| {
+            b.iter(|| black_box(diff.render(&config)));
+        });
+        group.bench_function("render-json-patch", |b| {
+            b.iter(|| black_box(diff.render_patch().expect("json patch")));
+        });
+        group.finish();
+    }
+}
+
+criterion_group!(benches, bench_large);
+criterion_main!(benches);
@@ -0,0 +1,47 @@
+use criterion::{black_box, criterion_group, criterion_main, BenchmarkId, Criterion, Throughput};
+use jd_core::{DiffOptions, ListAlignment, Node};
+
+/// Lengths at which the exact alignment still runs in milliseconds, and at
+/// which it would take minutes without the alignment cost limit.
+const SIZES: [usize; 2] = [2_000, 100_000];
+
+fn array(values: impl Iterator<Item = usize>) -> Node {
+    let items: Vec<String> = values.map(|value| value.to_string()).collect();
+    Node::from_json_str(&format!("[{}]", items.join(","))).expect("valid JSON")
+}
+
+/// Worst cases of the list alignment. Reversed and alternating lists share
+/// every element but almost no order, so nothing is set aside before the
+/// alignment table; all-distinct lists share nothing and are set aside
+/// completely.
+fn pathological_lists(n: usize) -> [(&'static str, Node, Node); 3] {
+    [
+        ("reversed", array(0..n), array((0..n).rev())),
+        ("alternating", array((0..n).map(|i| i % 2)), array((1..=n).map(|i| i % 2))),
+        ("all-distinct", array(0..n), array(n..2 * n)),
+    ]
+}
+
+fn bench_pathological(c: &mut Criterion) {
+    let mut group = c.benchmark_group("pathological");
+    group.sample_size(10);
+    for (alignment, options) in [
+        ("lcs", DiffOptions::default()),
+        ("patience", DiffOptions::default().with_list_alignment(ListAlignment::Patience)),
+    ] {
+        for n in SIZES {
+            group.throughput(Throughput::Elements(n as u64));
+            for (name, lhs, rhs) in pathological_lists(n) {
+                group.bench_with_input(
+                    BenchmarkId::new(format!("{name}-{alignment}"), n),
+                    &(lhs, rhs),
+                    |b, (lhs, rhs)| b.iter(|| black_box(lhs.diff(rhs, &options))),
+                );
+            }
+        }
+    }
+    group.finish();
+}
+
+criterion_group!(benches, bench_pathological);
+criterion_main!(benches);
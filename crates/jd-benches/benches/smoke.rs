@@ -1,6 +1,6 @@
 use criterion::{black_box, criterion_group, criterion_main, BenchmarkId, Criterion, Throughput};
 use jd_benches::available_corpora;
-use jd_core::{DiffOptions, RenderConfig};
+use jd_core::{DiffOptions, Node, NodeArena, RenderConfig};
 
 fn bench_diff(c: &mut Criterion) {
     let mut group = c.benchmark_group("diff");
@@ -55,6 +55,7 @@ fn bench_render(c: &mut Criterion) {
             native.throughput(Throughput::Elements(diff.len() as u64));
             native.bench_function(corpus.name(), {
                 let diff = diff.clone();
+                let config = config.clone();
                 move |b| {
                     b.iter(|| {
                         let rendered = diff.render(&config);
@@ -86,5 +87,49 @@ fn bench_render(c: &mut Criterion) {
     }
 }
 
-criterion_group!(benches, bench_diff, bench_patch_apply, bench_render);
+/// Number of members in the generated small-node documents.
+const SMALL_NODE_MEMBERS: usize = 50_000;
+
+/// Builds an object of small records, changing every `stride`-th record's
+/// tag, so the tree is dominated by many tiny allocations.
+fn small_nodes(stride: usize) -> String {
+    let members: Vec<String> = (0..SMALL_NODE_MEMBERS)
+        .map(|i| {
+            let changed = stride > 0 && i % stride == 0;
+            let tag = (i + usize::from(changed)) % 7;
+            format!(r#""k{i}":{{"id":{i},"ok":{},"tag":"t{tag}"}}"#, i % 2 == 0)
+        })
+        .collect();
+    format!("{{{}}}", members.join(","))
+}
+
+/// Parse and diff throughput on trees of many small nodes, the workload
+/// per-node heap allocation affects most, for `Node` trees and for
+/// `NodeArena`s. See ADR 0007.
+fn bench_small_nodes(c: &mut Criterion) {
+    let mut group = c.benchmark_group("small-nodes");
+    let before = small_nodes(0);
+    let after = small_nodes(1_000);
+    group.throughput(Throughput::Bytes(before.len() as u64));
+    group.bench_function("parse", |b| {
+        b.iter(|| black_box(Node::from_json_str(&before).expect("valid JSON")));
+    });
+    let lhs = Node::from_json_str(&before).expect("valid JSON");
+    let rhs = Node::from_json_str(&after).expect("valid JSON");
+    let options = DiffOptions::default();
+    group.bench_function("diff", |b| {
+        b.iter(|| black_box(lhs.diff(&rhs, &options)));
+    });
+    group.bench_function("arena-parse", |b| {
+        b.iter(|| black_box(NodeArena::from_json_str(&before).expect("valid JSON")));
+    });
+    let lhs = NodeArena::from_json_str(&before).expect("valid JSON");
+    let rhs = NodeArena::from_json_str(&after).expect("valid JSON");
+    group.bench_function("arena-diff", |b| {
+        b.iter(|| black_box(lhs.diff(&rhs, &options)));
+    });
+    group.finish();
+}
+
+criterion_group!(benches, bench_diff, bench_patch_apply, bench_render, bench_small_nodes);
 criterion_main!(benches);
@@ -0,0 +1,342 @@
+//! Deterministically generated documents for the large-document benchmarks.
+//!
+//! Each [`LargeShape`] stresses one dimension of a document: nesting depth,
+//! object width, list length, or string length. [`LargeShape::generate`]
+//! builds a before and after document of roughly the requested size, with
+//! about one element in a thousand changed, from a fixed seed, so every run
+//! and every machine measures the same input. The benchmarks default to
+//! [`DEFAULT_LARGE_BYTES`]; set `JD_BENCH_LARGE_BYTES` to measure larger
+//! documents, up to a gigabyte.
+//!
+//! # Examples
+//!
+//! ```
+//! use jd_benches::large::LargeShape;
+//! use jd_core::DiffOptions;
+//!
+//! let corpus = LargeShape::LongArray.generate(64 * 1024);
+//! assert!(corpus.fixture_bytes() >= 2 * 64 * 1024);
+//! let diff = corpus.load().unwrap().diff(&DiffOptions::default());
+//! assert!(!diff.is_empty());
+//! ```
+
+use std::fmt::Write;
+
+use jd_core::{CanonicalizeError, Node};
+
+use crate::Dataset;
+
+/// Size of each generated document when `JD_BENCH_LARGE_BYTES` is unset.
+pub const DEFAULT_LARGE_BYTES: usize = 10 * 1024 * 1024;
+
+/// Levels of nesting in each chain of a [`LargeShape::DeepNesting`]
+/// document, kept below the parser's recursion limit of 128.
+pub const NESTING_DEPTH: usize = 100;
+
+/// One in this many values differs between the before and after documents.
+const CHANGE_RATE: u64 = 1_000;
+
+/// Words the string content is drawn from, including ones that need JSON
+/// escaping.
+const WORDS: &[&str] =
+    &["lorem", "ipsum", "dolor", "sit", "amet", "caf\\u00e9", "line\\nbreak", "\\\"quoted\\\""];
+
+/// The dimension a generated document grows along.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum LargeShape {
+    /// An object of chains of objects nested [`NESTING_DEPTH`] levels deep.
+    DeepNesting,
+    /// A single object with one string member per element.
+    WideObject,
+    /// A single array of small records.
+    LongArray,
+    /// An object of eight long strings.
+    LongString,
+}
+
+impl LargeShape {
+    /// Every shape, in benchmark order.
+    pub const ALL: [LargeShape; 4] = [
+        LargeShape::DeepNesting,
+        LargeShape::WideObject,
+        LargeShape::LongArray,
+        LargeShape::LongString,
+    ];
+
+    /// Returns the identifier used for benchmark labels.
+    #[must_use]
+    pub fn name(self) -> &'static str {
+        match self {
+            LargeShape::DeepNesting => "deep-nesting",
+            LargeShape::WideObject => "wide-object",
+            LargeShape::LongArray => "long-array",
+            LargeShape::LongString => "long-string",
+        }
+    }
+
+    /// Generates a before and after document of at least `target_bytes`
+    /// each. The same shape and size always produce the same documents.
+    #[must_use]
+    pub fn generate(self, target_bytes: usize) -> LargeCorpus {
+        let mut documents = Documents::new(self);
+        match self {
+            LargeShape::DeepNesting => documents.deep_nesting(target_bytes),
+            LargeShape::WideObject => documents.wide_object(target_bytes),
+            LargeShape::LongArray => documents.long_array(target_bytes),
+            LargeShape::LongString => documents.long_string(target_bytes),
+        }
+        LargeCorpus { shape: self, before: documents.before, after: documents.after }
+    }
+}
+
+/// A generated pair of documents.
+#[derive(Clone, Debug)]
+pub struct LargeCorpus {
+    shape: LargeShape,
+    before: String,
+    after: String,
+}
+
+impl LargeCorpus {
+    /// Returns the shape the documents were generated with.
+    #[must_use]
+    pub fn shape(&self) -> LargeShape {
+        self.shape
+    }
+
+    /// Returns the "before" document as JSON text.
+    #[must_use]
+    pub fn before(&self) -> &str {
+        &self.before
+    }
+
+    /// Returns the "after" document as JSON text.
+    #[must_use]
+    pub fn after(&self) -> &str {
+        &self.after
+    }
+
+    /// Returns the total size in bytes of both documents.
+    #[must_use]
+    pub fn fixture_bytes(&self) -> usize {
+        self.before.len() + self.after.len()
+    }
+
+    /// Parses both documents into canonical `Node` instances.
+    pub fn load(&self) -> Result<Dataset, CanonicalizeError> {
+        Ok(Dataset {
+            before: Node::from_json_str(&self.before)?,
+            after: Node::from_json_str(&self.after)?,
+        })
+    }
+}
+
+/// Parses a byte size such as `10485760`, `64K`, `100M`, or `1G`, where the
+/// suffixes are powers of 1024.
+///
+/// ```
+/// use jd_benches::large::parse_byte_size;
+///
+/// assert_eq!(parse_byte_size("100M"), Some(100 * 1024 * 1024));
+/// assert_eq!(parse_byte_size("1g"), Some(1024 * 1024 * 1024));
+/// assert_eq!(parse_byte_size("lots"), None);
+/// ```
+#[must_use]
+pub fn parse_byte_size(text: &str) -> Option<usize> {
+    let text = text.trim();
+    let (digits, shift) = match text.chars().last()?.to_ascii_uppercase() {
+        'K' => (&text[..text.len() - 1], 10),
+        'M' => (&text[..text.len() - 1], 20),
+        'G' => (&text[..text.len() - 1], 30),
+        _ => (text, 0),
+    };
+    digits.parse::<usize>().ok()?.checked_mul(1 << shift)
+}
+
+/// The two documents under construction and the generator deciding where
+/// they differ.
+struct Documents {
+    before: String,
+    after: String,
+    rng: SplitMix64,
+}
+
+impl Documents {
+    fn new(shape: LargeShape) -> Self {
+        Self { before: String::new(), after: String::new(), rng: SplitMix64(shape as u64 + 1) }
+    }
+
+    fn push(&mut self, text: &str) {
+        self.before.push_str(text);
+        self.after.push_str(text);
+    }
+
+    /// Decides whether the next element differs, one time in `rate`.
+    fn changed(&mut self, rate: u64) -> bool {
+        self.rng.next().is_multiple_of(rate)
+    }
+
+    /// Writes the members or elements `element` produces, separated by
+    /// commas, until the before document holds `target_bytes`. `element`
+    /// returns the before and after text of element `i`; either may be
+    /// empty to leave the element out of that document.
+    fn elements(
+        &mut self,
+        target_bytes: usize,
+        mut element: impl FnMut(&mut Self, usize) -> (String, String),
+    ) {
+        let (mut before_empty, mut after_empty) = (true, true);
+        let mut i = 0;
+        while self.before.len() < target_bytes {
+            let (before, after) = element(self, i);
+            for (document, empty, text) in [
+                (&mut self.before, &mut before_empty, before),
+                (&mut self.after, &mut after_empty, after),
+            ] {
+                if text.is_empty() {
+                    continue;
+                }
+                if !*empty {
+                    document.push(',');
+                }
+                document.push_str(&text);
+                *empty = false;
+            }
+            i += 1;
+        }
+    }
+
+    fn deep_nesting(&mut self, target_bytes: usize) {
+        self.push("{");
+        self.elements(target_bytes, |documents, i| {
+            // A chain holds about a hundred values, so one chain in ten
+            // changes one value in a thousand.
+            let rate = CHANGE_RATE / NESTING_DEPTH as u64;
+            let value = if documents.changed(rate) { i + 1 } else { i };
+            (chain(i, i), chain(i, value))
+        });
+        self.push("}");
+    }
+
+    fn wide_object(&mut self, target_bytes: usize) {
+        self.push("{");
+        self.elements(target_bytes, |documents, i| {
+            let member = format!(r#""k{i:08}":"value-{i}""#);
+            if !documents.changed(CHANGE_RATE) {
+                return (member.clone(), member);
+            }
+            match documents.rng.next() % 3 {
+                0 => (member, format!(r#""k{i:08}":"changed-{i}""#)),
+                1 => (member, String::new()),
+                _ => (member.clone(), format!(r#"{member},"k{i:08}+":"added-{i}""#)),
+            }
+        });
+        self.push("}");
+    }
+
+    fn long_array(&mut self, target_bytes: usize) {
+        self.push("[");
+        self.elements(target_bytes, |documents, i| {
+            let record = format!(r#"{{"id":{i},"score":{}}}"#, i % 97);
+            if !documents.changed(CHANGE_RATE) {
+                return (record.clone(), record);
+            }
+            match documents.rng.next() % 3 {
+                0 => (record, format!(r#"{{"id":{i},"score":-1}}"#)),
+                1 => (record, String::new()),
+                _ => (record.clone(), format!(r#"{record},{{"id":"inserted-{i}"}}"#)),
+            }
+        });
+        self.push("]");
+    }
+
+    fn long_string(&mut self, target_bytes: usize) {
+        const STRINGS: usize = 8;
+        let per_string = target_bytes / STRINGS;
+        self.push("{");
+        for s in 0..STRINGS {
+            if s > 0 {
+                self.push(",");
+            }
+            let _ = write!(self.before, r#""s{s}":""#);
+            let _ = write!(self.after, r#""s{s}":""#);
+            let start = self.before.len();
+            // Every other string differs in one word near its middle.
+            let mut changed = s % 2 == 1;
+            while self.before.len() - start < per_string {
+                let word = WORDS[(self.rng.next() % WORDS.len() as u64) as usize];
+                self.before.push_str(word);
+                if changed && self.before.len() - start >= per_string / 2 {
+                    self.after.push_str("CHANGED");
+                    changed = false;
+                } else {
+                    self.after.push_str(word);
+                }
+                self.push(" ");
+            }
+            self.push("\"");
+        }
+        self.push("}");
+    }
+}
+
+/// Returns a chain of objects nested [`NESTING_DEPTH`] levels deep as the
+/// member `c{i}`, holding `value` at the bottom.
+fn chain(i: usize, value: usize) -> String {
+    let mut text = format!(r#""c{i}":"#);
+    text.push_str(&r#"{"level":"#.repeat(NESTING_DEPTH));
+    let _ = write!(text, r#"{{"id":{i},"value":{value}}}"#);
+    text.push_str(&"}".repeat(NESTING_DEPTH));
+    text
+}
+
+/// The SplitMix64 generator: small, fast, and identical on every platform.
+struct SplitMix64(u64);
+
+impl SplitMix64 {
+    fn next(&mut self) -> u64 {
+        self.0 = self.0.wrapping_add(0x9e37_79b9_7f4a_7c15);
+        let mut z = self.0;
+        z = (z ^ (z >> 30)).wrapping_mul(0xbf58_476d_1ce4_e5b9);
+        z = (z ^ (z >> 27)).wrapping_mul(0x94d0_49bb_1331_11eb);
+        z ^ (z >> 31)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use jd_core::DiffOptions;
+
+    #[test]
+    fn shapes_generate_documents_that_differ_slightly() {
+        for shape in LargeShape::ALL {
+            let corpus = shape.generate(256 * 1024);
+            assert!(corpus.before().len() >= 256 * 1024, "{}", shape.name());
+            assert_ne!(corpus.before(), corpus.after(), "{}", shape.name());
+            let dataset = corpus.load().unwrap_or_else(|err| panic!("{}: {err}", shape.name()));
+            let diff = dataset.diff(&DiffOptions::default());
+            assert!(!diff.is_empty(), "{}", shape.name());
+            let patched = dataset.before().apply_patch(&diff).expect("patch applies");
+            assert_eq!(&patched, dataset.after(), "{}", shape.name());
+        }
+    }
+
+    #[test]
+    fn generation_is_deterministic() {
+        for shape in LargeShape::ALL {
+            let first = shape.generate(64 * 1024);
+            let second = shape.generate(64 * 1024);
+            assert_eq!(first.before(), second.before());
+            assert_eq!(first.after(), second.after());
+        }
+    }
+
+    #[test]
+    fn byte_sizes_accept_binary_suffixes() {
+        assert_eq!(parse_byte_size("10485760"), Some(10 * 1024 * 1024));
+        assert_eq!(parse_byte_size(" 64k "), Some(64 * 1024));
+        assert_eq!(parse_byte_size("M"), None);
+        assert_eq!(parse_byte_size("-1G"), None);
+    }
+}
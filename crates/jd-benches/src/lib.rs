@@ -26,6 +26,8 @@
 
 use jd_core::{CanonicalizeError, Diff, DiffOptions, Node, RenderConfig};
 
+pub mod large;
+
 const KUBERNETES_BEFORE: &str =
     include_str!(concat!(env!("CARGO_MANIFEST_DIR"), "/fixtures/kubernetes/before.json"));
 const KUBERNETES_AFTER: &str =
@@ -0,0 +1,124 @@
+//! Binary document formats, each compiled in by a cargo feature of the same
+//! name. Without the feature the flag still parses but reports how to get
+//! the format, so scripts fail with a clear message instead of a usage error.
+
+use std::fmt;
+
+use anyhow::Result;
+use jd_core::{Node, ParseOptions};
+
+use crate::Cli;
+
+/// A binary format selected on the command line.
+#[derive(Clone, Copy, Debug, Eq, PartialEq)]
+pub(crate) enum Binary {
+    Cbor,
+    Msgpack,
+}
+
+impl Binary {
+    /// Returns the format selected by `cli`, if any.
+    pub(crate) fn from_cli(cli: &Cli) -> Option<Self> {
+        if cli.cbor {
+            Some(Self::Cbor)
+        } else if cli.msgpack {
+            Some(Self::Msgpack)
+        } else {
+            None
+        }
+    }
+
+    /// The flag that selects the format.
+    pub(crate) fn flag(self) -> &'static str {
+        match self {
+            Self::Cbor => "--cbor",
+            Self::Msgpack => "--msgpack",
+        }
+    }
+
+    /// Decodes one document; empty input decodes to a void node.
+    pub(crate) fn decode(self, input: &[u8], options: &ParseOptions) -> Result<Node> {
+        match self {
+            Self::Cbor => cbor::decode(input, options),
+            Self::Msgpack => msgpack::decode(input, options),
+        }
+    }
+
+    /// Encodes one document; a void node encodes to no bytes at all.
+    pub(crate) fn encode(self, node: &Node) -> Result<Vec<u8>> {
+        match self {
+            Self::Cbor => cbor::encode(node),
+            Self::Msgpack => msgpack::encode(node),
+        }
+    }
+}
+
+impl fmt::Display for Binary {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            Self::Cbor => "CBOR",
+            Self::Msgpack => "MessagePack",
+        })
+    }
+}
+
+#[cfg(feature = "cbor")]
+mod cbor {
+    use anyhow::{anyhow, Result};
+    use jd_core::{Node, ParseOptions};
+
+    pub(super) fn decode(input: &[u8], options: &ParseOptions) -> Result<Node> {
+        Node::from_cbor_slice_with_options(input, options).map_err(|err| anyhow!(err))
+    }
+
+    pub(super) fn encode(node: &Node) -> Result<Vec<u8>> {
+        Ok(node.to_cbor_vec().unwrap_or_default())
+    }
+}
+
+#[cfg(not(feature = "cbor"))]
+mod cbor {
+    use anyhow::{bail, Result};
+    use jd_core::{Node, ParseOptions};
+
+    const MISSING: &str = "CBOR support is not built in; rebuild jd with `--features cbor`";
+
+    pub(super) fn decode(_: &[u8], _: &ParseOptions) -> Result<Node> {
+        bail!(MISSING)
+    }
+
+    pub(super) fn encode(_: &Node) -> Result<Vec<u8>> {
+        bail!(MISSING)
+    }
+}
+
+#[cfg(feature = "msgpack")]
+mod msgpack {
+    use anyhow::{anyhow, Result};
+    use jd_core::{Node, ParseOptions};
+
+    pub(super) fn decode(input: &[u8], options: &ParseOptions) -> Result<Node> {
+        Node::from_msgpack_slice_with_options(input, options).map_err(|err| anyhow!(err))
+    }
+
+    pub(super) fn encode(node: &Node) -> Result<Vec<u8>> {
+        Ok(node.to_msgpack_vec().unwrap_or_default())
+    }
+}
+
+#[cfg(not(feature = "msgpack"))]
+mod msgpack {
+    use anyhow::{bail, Result};
+    use jd_core::{Node, ParseOptions};
+
+    const MISSING: &str =
+        "MessagePack support is not built in; rebuild jd with `--features msgpack`";
+
+    pub(super) fn decode(_: &[u8], _: &ParseOptions) -> Result<Node> {
+        bail!(MISSING)
+    }
+
+    pub(super) fn encode(_: &Node) -> Result<Vec<u8>> {
+        bail!(MISSING)
+    }
+}
@@ -0,0 +1,197 @@
+//! Default options loaded from `~/.config/jd/config.toml`.
+//!
+//! The file is read from `$XDG_CONFIG_HOME/jd/config.toml`, falling back to
+//! `$HOME/.config/jd/config.toml`, unless `--no-config` is given. Flags on
+//! the command line always win over the file, and the file wins over the
+//! built-in defaults:
+//!
+//! ```toml
+//! color = "always"
+//! color_theme = "default"
+//! format = "jd"
+//! precision = 0.001
+//! setkeys = ["id", "name"]
+//! ignore = ["$.metadata.resourceVersion"]
+//! set = false
+//! mset = false
+//! yaml = false
+//! ```
+//!
+//! Boolean keys can only switch a mode on; use `--no-config` to ignore a
+//! file that enables one.
+
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+
+use anyhow::{anyhow, Context, Result};
+use clap::parser::ValueSource;
+use clap::{ArgMatches, ValueEnum};
+use serde::Deserialize;
+
+use crate::{Cli, ColorChoice, OutputFormat, ThemeChoice};
+
+/// Settings read from the config file. Every key is optional.
+#[derive(Debug, Default, Deserialize, PartialEq)]
+#[serde(default, deny_unknown_fields)]
+pub(crate) struct Config {
+    color: Option<String>,
+    color_theme: Option<String>,
+    format: Option<String>,
+    precision: Option<f64>,
+    setkeys: Option<Vec<String>>,
+    ignore: Option<Vec<String>>,
+    set: bool,
+    mset: bool,
+    yaml: bool,
+}
+
+impl Config {
+    /// Loads the config file from its default location, returning `None`
+    /// when there is no file.
+    pub(crate) fn load() -> Result<Option<Self>> {
+        match default_path() {
+            Some(path) => Self::load_from(&path),
+            None => Ok(None),
+        }
+    }
+
+    fn load_from(path: &Path) -> Result<Option<Self>> {
+        let text = match fs::read_to_string(path) {
+            Ok(text) => text,
+            Err(err) if err.kind() == io::ErrorKind::NotFound => return Ok(None),
+            Err(err) => {
+                return Err(err).with_context(|| format!("failed to read {}", path.display()))
+            }
+        };
+        Self::parse(&text)
+            .map(Some)
+            .map_err(|err| anyhow!("invalid config {}: {err}", path.display()))
+    }
+
+    fn parse(text: &str) -> Result<Self> {
+        Ok(toml::from_str(text)?)
+    }
+
+    /// Fills in every option the command line left unset.
+    pub(crate) fn apply(&self, cli: &mut Cli, matches: &ArgMatches) -> Result<()> {
+        let from_flags = |id: &str| matches.value_source(id) == Some(ValueSource::CommandLine);
+        if let Some(color) = self.color.as_deref().filter(|_| !from_flags("color")) {
+            cli.color = ColorChoice::from_str(color, false)
+                .map_err(|_| anyhow!("invalid color {color:?}: expected auto, always, or never"))?;
+        }
+        if let Some(theme) = self.color_theme.as_deref().filter(|_| cli.color_theme.is_none()) {
+            cli.color_theme = Some(ThemeChoice::from_str(theme, false).map_err(|_| {
+                anyhow!(
+                    "invalid color_theme {theme:?}: expected default, high-contrast, or colorblind"
+                )
+            })?);
+        }
+        if let Some(format) = self.format.as_deref().filter(|_| !from_flags("format")) {
+            cli.format = OutputFormat::from_str(format, false)
+                .map_err(|_| anyhow!("invalid format {format:?}: expected jd, patch, or merge"))?;
+        }
+        cli.precision = cli.precision.or(self.precision);
+        if cli.setkeys.is_none() {
+            cli.setkeys = self.setkeys.as_ref().map(|keys| keys.join(","));
+        }
+        if cli.ignore.is_empty() {
+            cli.ignore = self.ignore.clone().unwrap_or_default();
+        }
+        cli.set |= self.set;
+        cli.multiset |= self.mset;
+        cli.yaml |= self.yaml;
+        Ok(())
+    }
+}
+
+fn default_path() -> Option<PathBuf> {
+    let base = std::env::var_os("XDG_CONFIG_HOME")
+        .filter(|dir| !dir.is_empty())
+        .map(PathBuf::from)
+        .or_else(|| std::env::var_os("HOME").map(|home| PathBuf::from(home).join(".config")))?;
+    Some(base.join("jd").join("config.toml"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::canonicalize_args;
+    use clap::{CommandFactory, FromArgMatches};
+    use std::ffi::OsString;
+
+    fn cli_with(config: &str, args: &[&str]) -> Result<Cli> {
+        let args = canonicalize_args(args.iter().map(OsString::from));
+        let matches = Cli::command().get_matches_from(args);
+        let mut cli = Cli::from_arg_matches(&matches)?;
+        Config::parse(config)?.apply(&mut cli, &matches)?;
+        Ok(cli)
+    }
+
+    #[test]
+    fn config_fills_unset_options() {
+        let config = "color = \"always\"\nformat = \"patch\"\nprecision = 0.5\n\
+                      setkeys = [\"id\", \"name\"]\nset = true\nyaml = true\n";
+        let cli = cli_with(config, &["jd", "a.json"]).unwrap();
+        assert_eq!(cli.color, ColorChoice::Always);
+        assert_eq!(cli.format, OutputFormat::Patch);
+        assert_eq!(cli.precision, Some(0.5));
+        assert_eq!(cli.setkeys.as_deref(), Some("id,name"));
+        assert!(cli.set && cli.yaml && !cli.multiset);
+    }
+
+    #[test]
+    fn flags_override_config() {
+        let config =
+            "color = \"always\"\nformat = \"patch\"\nprecision = 0.5\nsetkeys = [\"id\"]\n";
+        let cli = cli_with(
+            config,
+            &["jd", "-color=never", "-f=jd", "-precision=0.1", "-setkeys=key", "a.json"],
+        )
+        .unwrap();
+        assert_eq!(cli.color, ColorChoice::Never);
+        assert_eq!(cli.format, OutputFormat::Native);
+        assert_eq!(cli.precision, Some(0.1));
+        assert_eq!(cli.setkeys.as_deref(), Some("key"));
+    }
+
+    #[test]
+    fn color_theme_yields_to_the_flag() {
+        let config = "color_theme = \"high-contrast\"\n";
+        let cli = cli_with(config, &["jd", "a.json"]).unwrap();
+        assert_eq!(cli.color_theme, Some(ThemeChoice::HighContrast));
+        let cli = cli_with(config, &["jd", "-color-theme=colorblind", "a.json"]).unwrap();
+        assert_eq!(cli.color_theme, Some(ThemeChoice::Colorblind));
+        let err = cli_with("color_theme = \"neon\"\n", &["jd"]).unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "invalid color_theme \"neon\": expected default, high-contrast, or colorblind"
+        );
+    }
+
+    #[test]
+    fn ignore_flags_replace_configured_paths() {
+        let config = "ignore = [\"$.a\", \"$.b\"]\n";
+        assert_eq!(cli_with(config, &["jd", "a.json"]).unwrap().ignore, ["$.a", "$.b"]);
+        let cli = cli_with(config, &["jd", "-ignore=$.c", "a.json"]).unwrap();
+        assert_eq!(cli.ignore, ["$.c"]);
+    }
+
+    #[test]
+    fn rejects_invalid_config() {
+        let err = Config::parse("colour = \"always\"\n").unwrap_err();
+        assert!(err.to_string().contains("unknown field `colour`"));
+        let err = cli_with("format = \"xml\"\n", &["jd"]).unwrap_err();
+        assert_eq!(err.to_string(), "invalid format \"xml\": expected jd, patch, or merge");
+    }
+
+    #[test]
+    fn missing_file_is_not_an_error() {
+        let dir = tempfile::tempdir().unwrap();
+        assert_eq!(Config::load_from(&dir.path().join("config.toml")).unwrap(), None);
+        let path = dir.path().join("config.toml");
+        fs::write(&path, "mset = true\n").unwrap();
+        let config = Config::load_from(&path).unwrap().unwrap();
+        assert!(config.mset);
+    }
+}
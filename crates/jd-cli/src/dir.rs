@@ -0,0 +1,143 @@
+//! Recursive directory diffing for `jd DIR1 DIR2`.
+//!
+//! Both trees are walked and files are paired by relative path. Each pair is
+//! diffed structurally and printed under a `=== PATH` header, followed by a
+//! summary of added, removed, and changed files. Files ending in `.yaml` or
+//! `.yml` are read as YAML; everything else follows the `-yaml` flag.
+
+use std::collections::BTreeSet;
+use std::fmt::Write as _;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+
+use crate::{diff_texts, read_input, write_output, Cli, InputSource, EXIT_DIFF, EXIT_SUCCESS};
+
+/// Diffs every file under `lhs` against its counterpart under `rhs`.
+pub(crate) fn run(cli: &Cli, lhs: &Path, rhs: &Path) -> Result<i32> {
+    let lhs_files = walk(lhs)?;
+    let rhs_files = walk(rhs)?;
+    let mut report = String::new();
+    let mut summary = Summary::default();
+
+    for relative in lhs_files.union(&rhs_files) {
+        match (lhs_files.contains(relative), rhs_files.contains(relative)) {
+            (true, false) => summary.removed.push(relative),
+            (false, true) => summary.added.push(relative),
+            _ => {
+                let (rendered, have_diff) = diff_pair(cli, lhs, rhs, relative)
+                    .with_context(|| format!("failed to diff {}", relative.display()))?;
+                if have_diff {
+                    let _ = writeln!(report, "=== {}", relative.display());
+                    report.push_str(&rendered);
+                    if !rendered.ends_with('\n') {
+                        report.push('\n');
+                    }
+                    summary.changed.push(relative);
+                }
+            }
+        }
+    }
+
+    let differs = !summary.is_empty();
+    if differs {
+        summary.write(&mut report);
+    }
+    write_output(cli, &report)?;
+    Ok(if differs { EXIT_DIFF } else { EXIT_SUCCESS })
+}
+
+fn diff_pair(cli: &Cli, lhs: &Path, rhs: &Path, relative: &Path) -> Result<(String, bool)> {
+    let yaml = cli.yaml
+        || relative.extension().is_some_and(|extension| extension == "yaml" || extension == "yml");
+    let lhs_text = read_input(&InputSource::File(lhs.join(relative)))?;
+    let rhs_text = read_input(&InputSource::File(rhs.join(relative)))?;
+    diff_texts(cli, yaml, &lhs_text, &rhs_text)
+}
+
+/// Returns the paths of all files below `root`, relative to it. Symlinks are
+/// followed.
+fn walk(root: &Path) -> Result<BTreeSet<PathBuf>> {
+    let mut files = BTreeSet::new();
+    let mut pending = vec![PathBuf::new()];
+    while let Some(relative) = pending.pop() {
+        let dir = root.join(&relative);
+        let entries =
+            fs::read_dir(&dir).with_context(|| format!("failed to read {}", dir.display()))?;
+        for entry in entries {
+            let entry = entry.with_context(|| format!("failed to read {}", dir.display()))?;
+            let path = relative.join(entry.file_name());
+            let metadata = fs::metadata(entry.path())
+                .with_context(|| format!("failed to read {}", entry.path().display()))?;
+            if metadata.is_dir() {
+                pending.push(path);
+            } else if metadata.is_file() {
+                files.insert(path);
+            }
+        }
+    }
+    Ok(files)
+}
+
+#[derive(Default)]
+struct Summary<'a> {
+    added: Vec<&'a Path>,
+    removed: Vec<&'a Path>,
+    changed: Vec<&'a Path>,
+}
+
+impl Summary<'_> {
+    fn is_empty(&self) -> bool {
+        self.added.is_empty() && self.removed.is_empty() && self.changed.is_empty()
+    }
+
+    fn write(&self, report: &mut String) {
+        let _ = writeln!(
+            report,
+            "=== {} added, {} removed, {} changed",
+            self.added.len(),
+            self.removed.len(),
+            self.changed.len()
+        );
+        for (marker, paths) in [('+', &self.added), ('-', &self.removed), ('~', &self.changed)] {
+            for path in paths {
+                let _ = writeln!(report, "{marker} {}", path.display());
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn walk_lists_nested_files_relative_to_the_root() {
+        let dir = tempfile::tempdir().unwrap();
+        fs::create_dir_all(dir.path().join("nested/deeper")).unwrap();
+        fs::write(dir.path().join("top.json"), "{}").unwrap();
+        fs::write(dir.path().join("nested/deeper/leaf.yaml"), "a: 1\n").unwrap();
+
+        let files = walk(dir.path()).unwrap();
+        let expected: BTreeSet<PathBuf> =
+            [PathBuf::from("nested/deeper/leaf.yaml"), PathBuf::from("top.json")].into();
+        assert_eq!(files, expected);
+    }
+
+    #[test]
+    fn summary_lists_each_kind_of_change() {
+        let summary = Summary {
+            added: vec![Path::new("new.json")],
+            removed: vec![Path::new("old.json")],
+            changed: vec![Path::new("a.json"), Path::new("b.json")],
+        };
+        let mut report = String::new();
+        summary.write(&mut report);
+        assert_eq!(
+            report,
+            "=== 1 added, 1 removed, 2 changed\n+ new.json\n- old.json\n~ a.json\n~ b.json\n"
+        );
+        assert!(Summary::default().is_empty());
+    }
+}
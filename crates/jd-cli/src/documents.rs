@@ -0,0 +1,206 @@
+//! Multi-document YAML diffs for `jd --documents FILE1 FILE2`.
+//!
+//! Both inputs are read as `---`-separated YAML streams, such as files of
+//! Kubernetes manifests, and every pair of documents is rendered into one
+//! report. By default documents are paired by position and hunk paths start
+//! with the document index. With `--documents-key=FIELD[,FIELD...]` documents
+//! are paired by the values of those fields instead, where a dotted name such
+//! as `metadata.name` reaches into nested objects. Paths then start with the
+//! same `{"kind":...,"metadata.name":...}` segments as `-setkeys`, and
+//! unmatched documents are reported under `{}`.
+
+use std::collections::{BTreeMap, HashMap, HashSet};
+
+use anyhow::{anyhow, bail, Context, Result};
+use jd_core::{Diff, DiffElement, DiffOptions, Node, ParseOptions, PathSegment};
+
+use crate::ndjson::{below, whole};
+use crate::{
+    build_options, input_sources, parse_options, read_input, render_config, write_output, Cli,
+    InputSource, OutputFormat, EXIT_DIFF, EXIT_SUCCESS,
+};
+
+/// Diffs the documents of FILE1 and FILE2 and writes the combined report.
+pub(crate) fn run(cli: &Cli) -> Result<i32> {
+    if cli.format != OutputFormat::Native {
+        bail!("document mode only supports the native jd format");
+    }
+    let (first, second) = input_sources(cli)?;
+    if matches!((&first, &second), (InputSource::Stdin, InputSource::Stdin)) {
+        bail!("cannot read two YAML streams from STDIN");
+    }
+    let parse = parse_options(cli);
+    let lhs = read_documents(&first, &parse).context("failed to parse first input")?;
+    let rhs = read_documents(&second, &parse).context("failed to parse second input")?;
+    let options = build_options(cli)?;
+    let elements = match &cli.documents_key {
+        Some(fields) => keyed(lhs, rhs, &key_fields(fields)?, &options)?,
+        None => positional(lhs, rhs, &options),
+    };
+
+    let config = render_config(cli);
+    let rendered = Diff::from_elements(elements).render(&config);
+    write_output(cli, &rendered)?;
+    Ok(if rendered.is_empty() { EXIT_SUCCESS } else { EXIT_DIFF })
+}
+
+fn read_documents(source: &InputSource, options: &ParseOptions) -> Result<Vec<Node>> {
+    Node::from_yaml_documents_str_with_options(&read_input(source)?, options)
+        .map_err(|err| anyhow!(err))
+}
+
+/// Splits the `--documents-key` value into its comma-separated fields.
+fn key_fields(value: &str) -> Result<Vec<&str>> {
+    let fields: Vec<&str> = value.split(',').map(str::trim).collect();
+    if fields.iter().any(|field| field.is_empty()) {
+        bail!("invalid --documents-key {value:?}: expected FIELD[,FIELD...]");
+    }
+    Ok(fields)
+}
+
+/// Pairs the `n`th document of each stream, reporting surplus documents as
+/// removed or added at their index.
+fn positional(lhs: Vec<Node>, rhs: Vec<Node>, options: &DiffOptions) -> Vec<DiffElement> {
+    let (mut lhs, mut rhs) = (lhs.into_iter(), rhs.into_iter());
+    let mut elements = Vec::new();
+    for index in 0_i64.. {
+        let segment = PathSegment::Index(index);
+        match (lhs.next(), rhs.next()) {
+            (None, None) => break,
+            (Some(a), Some(b)) => elements.extend(below(&segment, &a.diff(&b, options))),
+            (Some(a), None) => elements.push(whole(segment, a, true)),
+            (None, Some(b)) => elements.push(whole(segment, b, false)),
+        }
+    }
+    elements
+}
+
+/// Pairs documents by the values of `fields`. Removed documents are
+/// reported in FILE1 order, then added ones in FILE2 order.
+fn keyed(
+    lhs: Vec<Node>,
+    rhs: Vec<Node>,
+    fields: &[&str],
+    options: &DiffOptions,
+) -> Result<Vec<DiffElement>> {
+    let mut index = HashMap::new();
+    for (position, document) in rhs.iter().enumerate() {
+        let key = document_key(document, fields, position, "second")?;
+        let text = key_text(&key);
+        if index.insert(text.clone(), position).is_some() {
+            bail!("duplicate key {text} in document {} of the second input", position + 1);
+        }
+    }
+
+    let mut rhs: Vec<Option<Node>> = rhs.into_iter().map(Some).collect();
+    let mut seen = HashSet::new();
+    let mut elements = Vec::new();
+    for (position, document) in lhs.into_iter().enumerate() {
+        let key = document_key(&document, fields, position, "first")?;
+        let text = key_text(&key);
+        if !seen.insert(text.clone()) {
+            bail!("duplicate key {text} in document {} of the first input", position + 1);
+        }
+        match index.get(&text).and_then(|&other| rhs[other].take()) {
+            Some(other) => {
+                let segment = PathSegment::SetKeys(key);
+                elements.extend(below(&segment, &document.diff(&other, options)));
+            }
+            None => elements.push(whole(PathSegment::Set, document, true)),
+        }
+    }
+    elements.extend(rhs.into_iter().flatten().map(|added| whole(PathSegment::Set, added, false)));
+    Ok(elements)
+}
+
+/// Reads the value of every key field, following dots into nested objects.
+fn document_key(
+    document: &Node,
+    fields: &[&str],
+    position: usize,
+    input: &str,
+) -> Result<BTreeMap<String, Node>> {
+    fields
+        .iter()
+        .map(|field| {
+            let value = field.split('.').try_fold(document, |node, name| match node {
+                Node::Object(members) => members.get(name),
+                _ => None,
+            });
+            match value {
+                Some(value) => Ok((field.to_string(), value.clone())),
+                None => {
+                    bail!("document {} of the {input} input has no {field:?} field", position + 1)
+                }
+            }
+        })
+        .collect()
+}
+
+fn key_text(key: &BTreeMap<String, Node>) -> String {
+    Node::Object(key.clone()).to_json_value().map(|value| value.to_string()).unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use jd_core::RenderConfig;
+
+    fn documents(text: &str) -> Vec<Node> {
+        Node::from_yaml_documents_str(text).unwrap()
+    }
+
+    fn render(elements: Vec<DiffElement>) -> String {
+        Diff::from_elements(elements).render(&RenderConfig::default())
+    }
+
+    #[test]
+    fn positional_documents_are_paired_by_index() {
+        let options = DiffOptions::default();
+        let lhs = documents("a: 1\n---\na: 2\n---\na: 3\n");
+        let rhs = documents("a: 1\n---\na: 5\n");
+        assert_eq!(
+            render(positional(lhs, rhs, &options)),
+            "@ [1,\"a\"]\n- 2\n+ 5\n@ [2]\n- {\"a\":3}\n"
+        );
+        let same = documents("a: 1\n");
+        assert_eq!(render(positional(same.clone(), same, &options)), "");
+    }
+
+    #[test]
+    fn keyed_documents_are_paired_by_nested_fields() {
+        let lhs = documents(
+            "kind: Service\nmetadata:\n  name: web\nport: 80\n---\n\
+             kind: Deployment\nmetadata:\n  name: web\nreplicas: 1\n---\n\
+             kind: ConfigMap\nmetadata:\n  name: old\n",
+        );
+        let rhs = documents(
+            "kind: Deployment\nmetadata:\n  name: web\nreplicas: 3\n---\n\
+             kind: Secret\nmetadata:\n  name: new\n---\n\
+             kind: Service\nmetadata:\n  name: web\nport: 80\n",
+        );
+        let elements =
+            keyed(lhs, rhs, &["kind", "metadata.name"], &DiffOptions::default()).unwrap();
+        assert_eq!(
+            render(elements),
+            "@ [{\"kind\":\"Deployment\",\"metadata.name\":\"web\"},\"replicas\"]\n- 1\n+ 3\n\
+             @ [{}]\n- {\"kind\":\"ConfigMap\",\"metadata\":{\"name\":\"old\"}}\n\
+             @ [{}]\n+ {\"kind\":\"Secret\",\"metadata\":{\"name\":\"new\"}}\n"
+        );
+    }
+
+    #[test]
+    fn keyed_mode_reports_bad_documents() {
+        let options = DiffOptions::default();
+        let err = keyed(documents("id: 1\n"), documents("id: 1\n---\nid: 1\n"), &["id"], &options)
+            .unwrap_err();
+        assert_eq!(err.to_string(), "duplicate key {\"id\":1} in document 2 of the second input");
+        let err = keyed(documents("id: 1\n---\nid: 1\n"), vec![], &["id"], &options).unwrap_err();
+        assert_eq!(err.to_string(), "duplicate key {\"id\":1} in document 2 of the first input");
+        let err =
+            keyed(documents("metadata: 1\n"), vec![], &["metadata.name"], &options).unwrap_err();
+        assert_eq!(err.to_string(), "document 1 of the first input has no \"metadata.name\" field");
+        assert!(key_fields("kind,,name").is_err());
+        assert_eq!(key_fields("kind, metadata.name").unwrap(), ["kind", "metadata.name"]);
+    }
+}
@@ -0,0 +1,133 @@
+//! Input files, memory-mapped when they are large.
+//!
+//! Reading a multi-hundred-megabyte document into a buffer and then parsing
+//! it holds the text twice over while the parse runs. Files of at least
+//! [`MAP_THRESHOLD`] bytes are mapped instead, and the parser reads the
+//! mapping directly, so the only copy in memory is the parsed document.
+//! Smaller files, STDIN, and files that cannot be mapped are read as before.
+
+use std::fs::File;
+use std::io::{self, Read};
+use std::ops::Deref;
+use std::path::Path;
+
+use memmap2::Mmap;
+
+/// Size from which files are mapped rather than read. Below it, mapping
+/// costs more than the copy it saves.
+pub(crate) const MAP_THRESHOLD: u64 = 16 << 20;
+
+/// The bytes of an input.
+#[derive(Debug)]
+pub(crate) enum Input {
+    Mapped(Mmap),
+    Read(Vec<u8>),
+}
+
+impl Input {
+    /// Maps or reads the file at `path`.
+    pub(crate) fn open(path: &Path) -> io::Result<Self> {
+        let mut file = File::open(path)?;
+        let metadata = file.metadata()?;
+        if metadata.is_file() && metadata.len() >= MAP_THRESHOLD {
+            // SAFETY: jd reads its inputs once, start to end, and holds no
+            // reference into the mapping past the parse. As with any mapped
+            // file, another process truncating it meanwhile can fault the
+            // read; that is the trade `rg` and `git` make for large files.
+            if let Ok(map) = unsafe { Mmap::map(&file) } {
+                return Ok(Self::Mapped(map));
+            }
+        }
+        let mut buffer = Vec::new();
+        file.read_to_end(&mut buffer)?;
+        Ok(Self::Read(buffer))
+    }
+
+    /// Reads all of `reader`, such as STDIN, which cannot be mapped.
+    pub(crate) fn read_all(mut reader: impl Read) -> io::Result<Self> {
+        let mut buffer = Vec::new();
+        reader.read_to_end(&mut buffer)?;
+        Ok(Self::Read(buffer))
+    }
+}
+
+impl Deref for Input {
+    type Target = [u8];
+
+    fn deref(&self) -> &[u8] {
+        match self {
+            Self::Mapped(map) => map,
+            Self::Read(buffer) => buffer,
+        }
+    }
+}
+
+/// The text of an input, checked to be UTF-8.
+#[derive(Debug)]
+pub(crate) enum Text {
+    Read(String),
+    /// A mapping [`Text::new`] found to be UTF-8. Each access checks it
+    /// again rather than trusting it, which costs a small part of a parse.
+    Mapped(Mmap),
+}
+
+impl Text {
+    /// Checks that `input` is UTF-8, failing as [`std::fs::read_to_string`]
+    /// does when it is not.
+    pub(crate) fn new(input: Input) -> io::Result<Self> {
+        let invalid =
+            || io::Error::new(io::ErrorKind::InvalidData, "stream did not contain valid UTF-8");
+        match input {
+            Input::Read(buffer) => String::from_utf8(buffer).map(Self::Read).map_err(|_| invalid()),
+            Input::Mapped(map) => match std::str::from_utf8(&map) {
+                Ok(_) => Ok(Self::Mapped(map)),
+                Err(_) => Err(invalid()),
+            },
+        }
+    }
+}
+
+impl From<String> for Text {
+    fn from(text: String) -> Self {
+        Self::Read(text)
+    }
+}
+
+impl Deref for Text {
+    type Target = str;
+
+    fn deref(&self) -> &str {
+        match self {
+            Self::Read(text) => text,
+            Self::Mapped(map) => std::str::from_utf8(map).expect("Text::new checked the mapping"),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn large_files_are_mapped() {
+        let dir = tempfile::tempdir().unwrap();
+        let small = dir.path().join("small.json");
+        std::fs::write(&small, "[1]").unwrap();
+        let large = dir.path().join("large.json");
+        let body = vec!["0"; usize::try_from(MAP_THRESHOLD).unwrap() / 2].join(",");
+        std::fs::write(&large, format!("[{body}]")).unwrap();
+
+        let read = Text::new(Input::open(&small).unwrap()).unwrap();
+        assert!(matches!(read, Text::Read(_)));
+        assert_eq!(&*read, "[1]");
+        let mapped = Text::new(Input::open(&large).unwrap()).unwrap();
+        assert!(matches!(mapped, Text::Mapped(_)));
+        assert_eq!(mapped.len(), body.len() + 2);
+    }
+
+    #[test]
+    fn text_must_be_utf8() {
+        let err = Text::new(Input::Read(vec![b'"', 0xff, b'"'])).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::InvalidData);
+    }
+}
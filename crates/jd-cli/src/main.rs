@@ -1,20 +1,39 @@
 //! Command-line interface for the Rust port of the Go `jd` tool.
 //!
-//! This milestone wires the CLI to the renderer APIs implemented in
-//! `jd-core`, supporting diff mode with native, JSON Patch, and JSON
-//! Merge Patch outputs together with color toggling. Future milestones
-//! will extend this binary with patch/translate modes and the remaining
-//! flag surface.
+//! The CLI wires the renderer APIs implemented in `jd-core` into diff mode
+//! with native, JSON Patch, and JSON Merge Patch outputs together with
+//! `--color=auto|always|never`, patch mode (`-p`) for native, JSON Patch,
+//! and JSON Merge Patch inputs, translate mode (`-t`) between diff and
+//! document formats, the git diff driver (`-git-diff-driver`), and the local
+//! web UI (`-port`).
 
 use std::collections::{BTreeMap, BTreeSet};
 use std::ffi::OsString;
 use std::fs;
-use std::io::{self, Read, Write};
-use std::path::PathBuf;
+use std::io::{self, IsTerminal, Write};
+use std::path::{Path, PathBuf};
 
 use anyhow::{anyhow, bail, Context, Result};
-use clap::{ArgAction, Parser, ValueEnum};
-use jd_core::{DiffOptions, Node, RenderConfig};
+use binary::Binary;
+use clap::{ArgAction, CommandFactory, FromArgMatches, Parser, ValueEnum};
+use input::{Input, Text};
+use jd_core::{
+    ArrayMode, ColorTheme, ContextMismatch, Diff, DiffOption, DiffOptions, DuplicateKeys,
+    FuzzyPatch, JsonPath, JsonSchema, KeyOrder, ListAlignment, Node, NumberEquality, ParseOptions,
+    PatchError, PatchStrictness, Preset, RenderConfig, StrategicMerge, StringGranularity,
+    Translation, UnifiedConfig,
+};
+
+mod binary;
+mod config;
+mod dir;
+mod documents;
+mod input;
+mod ndjson;
+mod stream;
+mod subtree;
+mod watch;
+mod web;
 
 const VERSION_NUMBER: &str = env!("CARGO_PKG_VERSION");
 const VERSION_BANNER: &str = concat!("jd version ", env!("CARGO_PKG_VERSION"));
@@ -59,10 +78,16 @@ Version: {version}
 enum OutputFormat {
     #[value(alias = "jd")]
     Native,
+    /// The native format of jd v1, without context lines or option headers.
+    #[value(name = "jd1")]
+    NativeV1,
     #[value(alias = "patch")]
     Patch,
     #[value(alias = "merge")]
     Merge,
+    Json,
+    Unified,
+    Paths,
 }
 
 impl Default for OutputFormat {
@@ -71,6 +96,85 @@ impl Default for OutputFormat {
     }
 }
 
+/// When to emit ANSI color sequences in native diff output.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq, ValueEnum)]
+enum ColorChoice {
+    /// Color only when writing to a terminal and `NO_COLOR` is unset.
+    #[default]
+    Auto,
+    /// Always color, matching Go's `-color`.
+    Always,
+    /// Never color.
+    Never,
+}
+
+impl ColorChoice {
+    /// Resolves the choice against the `NO_COLOR` environment variable and
+    /// whether output is a terminal. Explicit choices override `NO_COLOR`,
+    /// following <https://no-color.org>.
+    fn enabled(self, no_color: Option<&std::ffi::OsStr>, terminal: bool) -> bool {
+        match self {
+            Self::Always => true,
+            Self::Never => false,
+            Self::Auto => terminal && no_color.is_none_or(|value| value.is_empty()),
+        }
+    }
+}
+
+/// The palette for colored output.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, ValueEnum)]
+enum ThemeChoice {
+    /// Red and green, as in Go jd.
+    Default,
+    /// Bold, bright red and green.
+    HighContrast,
+    /// Orange and blue, distinct under common color blindness.
+    Colorblind,
+}
+
+impl ThemeChoice {
+    fn theme(self) -> ColorTheme {
+        match self {
+            Self::Default => ColorTheme::Default,
+            Self::HighContrast => ColorTheme::HighContrast,
+            Self::Colorblind => ColorTheme::ColorblindSafe,
+        }
+    }
+}
+
+/// What to do with an object that lists a key more than once.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, ValueEnum)]
+enum DuplicateKeyPolicy {
+    /// Keep the last value, as Go jd does.
+    Last,
+    /// Keep the first value.
+    First,
+    /// Reject the document.
+    Error,
+}
+
+/// How closely FILE2 must match a jd diff for `-p` to apply it.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, ValueEnum)]
+enum StrictnessChoice {
+    /// Removed values and list context must match, as in Go jd.
+    Strict,
+    /// Apply hunks by path alone, without comparing values.
+    Lenient,
+    /// Like `lenient`, and create missing objects and lists.
+    Force,
+}
+
+/// What `-p` does when the context around a list hunk does not match FILE2.
+#[derive(Clone, Copy, Debug, Eq, PartialEq, ValueEnum)]
+enum ContextMismatchChoice {
+    /// Fail the hunk, as Go jd does.
+    Error,
+    /// Apply the hunk at its index and report the mismatch on STDERR.
+    Warn,
+    /// Apply the hunk at its index without a report.
+    Ignore,
+}
+
 #[derive(Debug, Parser)]
 #[command(
     name = "jd",
@@ -86,14 +190,49 @@ struct Cli {
     #[arg(long = "version", action = ArgAction::SetTrue, hide = true)]
     version: bool,
 
-    /// Render diff output using ANSI colors.
-    #[arg(long = "color", action = ArgAction::SetTrue)]
-    color: bool,
+    /// Render diff output using ANSI colors (`auto`, `always`, or `never`).
+    #[arg(
+        long = "color",
+        value_enum,
+        default_value = "auto",
+        num_args = 0..=1,
+        require_equals = true,
+        default_missing_value = "always"
+    )]
+    color: ColorChoice,
 
-    /// Select diff output format (`jd`, `patch`, or `merge`).
+    /// Palette for colored output (`default`, `high-contrast`, or
+    /// `colorblind`). Defaults to `$JD_COLOR_THEME`.
+    #[arg(long = "color-theme", value_enum, value_name = "THEME")]
+    color_theme: Option<ThemeChoice>,
+
+    /// Select diff output format (`jd`, `jd1`, `patch`, `merge`, `json`,
+    /// `unified`, or `paths`).
     #[arg(short = 'f', long = "format", value_enum, default_value = "jd")]
     format: OutputFormat,
 
+    /// Print how many values each changed path adds and removes, with a
+    /// totals line, instead of the diff.
+    #[arg(long = "stat", action = ArgAction::SetTrue)]
+    stat: bool,
+
+    /// Diff with the ignored fields and keyed lists of a document format:
+    /// `terraform` for `terraform show -json` plans, or `openapi` for
+    /// OpenAPI and Swagger specifications.
+    #[arg(long = "preset", value_name = "NAME")]
+    preset: Option<Preset>,
+
+    /// With `--preset`, print one line per changed record, such as a
+    /// Terraform resource or an API operation, with a totals line, instead
+    /// of the diff.
+    #[arg(long = "summary", action = ArgAction::SetTrue)]
+    summary: bool,
+
+    /// Check FILE1 and FILE2, or with `-p` FILE2 and the patched document,
+    /// against the JSON Schema in FILE, failing on the first invalid one.
+    #[arg(long = "schema", value_name = "FILE")]
+    schema: Option<PathBuf>,
+
     /// Write output to FILE instead of STDOUT.
     #[arg(short = 'o', long = "output")]
     output: Option<PathBuf>,
@@ -102,7 +241,33 @@ struct Cli {
     #[arg(short = 'p', action = ArgAction::SetTrue)]
     patch: bool,
 
-    /// Translate mode (e.g. `jd2patch`).
+    /// With `-p`, check that every hunk of FILE1 applies to FILE2 and print
+    /// one line per hunk instead of the patched document. Exits 1 when a
+    /// hunk conflicts.
+    #[arg(long = "dry-run", action = ArgAction::SetTrue)]
+    dry_run: bool,
+
+    /// With `-p`, how closely FILE2 must match the diff (`strict`,
+    /// `lenient`, or `force`).
+    #[arg(long = "strictness", value_enum, value_name = "MODE")]
+    strictness: Option<StrictnessChoice>,
+
+    /// With `-p`, let list hunks apply up to N positions away from their
+    /// index when their context has moved, reporting each offset on STDERR.
+    #[arg(long = "fuzz", value_name = "N")]
+    fuzz: Option<usize>,
+
+    /// With `-p`, what to do when the elements around a list hunk do not
+    /// match FILE2 (`error`, `warn`, or `ignore`).
+    #[arg(long = "context-mismatch", value_enum, value_name = "MODE")]
+    context_mismatch: Option<ContextMismatchChoice>,
+
+    /// With `-p`, apply the hunks of FILE1 that fit and write the ones that
+    /// do not to FILE, in the `-f` format. Exits 1 when a hunk is rejected.
+    #[arg(long = "rejects", value_name = "FILE")]
+    rejects: Option<PathBuf>,
+
+    /// Translate FILE1 between formats (e.g. `jd2patch`).
     #[arg(short = 't', long = "translate")]
     translate: Option<String>,
 
@@ -110,30 +275,142 @@ struct Cli {
     #[arg(long = "yaml", action = ArgAction::SetTrue)]
     yaml: bool,
 
+    /// Read and write CBOR instead of JSON (needs the `cbor` feature).
+    #[arg(long = "cbor", action = ArgAction::SetTrue)]
+    cbor: bool,
+
+    /// Read and write MessagePack instead of JSON (needs the `msgpack`
+    /// feature).
+    #[arg(long = "msgpack", action = ArgAction::SetTrue)]
+    msgpack: bool,
+
     /// Numeric precision tolerance.
     #[arg(long = "precision")]
     precision: Option<f64>,
 
-    /// Treat arrays as sets (not yet implemented).
+    /// Treat arrays as sets.
     #[arg(long = "set", action = ArgAction::SetTrue)]
     set: bool,
 
-    /// Treat arrays as multisets (not yet implemented).
+    /// Treat arrays as multisets.
     #[arg(long = "mset", action = ArgAction::SetTrue)]
     multiset: bool,
 
-    /// Keys to identify objects within set semantics (not yet implemented).
+    /// Keys to identify objects within set semantics.
     #[arg(long = "setkeys")]
     setkeys: Option<String>,
 
-    /// Run as a git diff driver (not yet implemented).
-    #[arg(long = "git-diff-driver", action = ArgAction::SetTrue)]
+    /// Run as a git diff driver or `git difftool --extcmd` command.
+    #[arg(long = "git-diff-driver", alias = "git-difftool", action = ArgAction::SetTrue)]
     git_diff_driver: bool,
 
-    /// Serve the web UI on the provided port (not yet implemented).
+    /// Serve the web UI on the provided port (`0` disables it, as in Go).
     #[arg(long = "port")]
     port: Option<u16>,
 
+    /// Diff FILE1 and FILE2 as NDJSON streams, one record per line.
+    #[arg(long = "ndjson", action = ArgAction::SetTrue)]
+    ndjson: bool,
+
+    /// Pair NDJSON records by this field instead of by position.
+    #[arg(long = "ndjson-key")]
+    ndjson_key: Option<String>,
+
+    /// Diff FILE1 and FILE2 as `---`-separated YAML streams, pairing
+    /// documents by position.
+    #[arg(long = "documents", action = ArgAction::SetTrue)]
+    documents: bool,
+
+    /// Pair YAML documents by these comma-separated fields instead of by
+    /// position (e.g. `kind,metadata.name`).
+    #[arg(long = "documents-key", value_name = "FIELDS")]
+    documents_key: Option<String>,
+
+    /// Only report changes at or below this path (e.g. `$.spec.containers`
+    /// or `$..image`). May be repeated.
+    #[arg(long = "path", value_name = "PATH")]
+    paths: Vec<String>,
+
+    /// Exclude this path from comparison entirely (e.g. `$.metadata.uid` or
+    /// `$.items[*].status`). May be repeated.
+    #[arg(long = "ignore", value_name = "PATH")]
+    ignore: Vec<String>,
+
+    /// Exclude object keys matching this regex (e.g. `^_` or `_at$`) from
+    /// comparison. May be repeated.
+    #[arg(long = "exclude-keys", value_name = "REGEX")]
+    exclude_keys: Vec<String>,
+
+    /// Report list elements that changed position as moves instead of a
+    /// removal and an addition.
+    #[arg(long = "moves", action = ArgAction::SetTrue)]
+    moves: bool,
+
+    /// Align lists with patience diff instead of the longest common
+    /// subsequence.
+    #[arg(long = "patience", action = ArgAction::SetTrue)]
+    patience: bool,
+
+    /// Diff objects in lists field by field only when at least this share
+    /// of their fields match (e.g. `0.6`); otherwise replace them.
+    #[arg(long = "similarity", value_name = "RATIO")]
+    similarity: Option<f64>,
+
+    /// Record N elements of context before and after each list change
+    /// (default 1). More context makes `-p` reject a patch sooner when the
+    /// list around the change has drifted; 0 records none.
+    #[arg(long = "context", value_name = "N")]
+    context: Option<usize>,
+
+    /// Break changed strings down by `char` (default), `word`, or `line`;
+    /// `line` shows only the changed lines of multi-line strings. Append
+    /// `:PATH` to apply it only at or below a path. May be repeated.
+    #[arg(long = "string-diff", value_name = "MODE[:PATH]", value_parser = parse_string_diff)]
+    string_diff: Vec<StringDiffRule>,
+
+    /// Read JSON inputs as JSONC, ignoring comments and trailing commas.
+    #[arg(long = "jsonc", action = ArgAction::SetTrue)]
+    jsonc: bool,
+
+    /// Resolve keys an input object repeats (`last`, `first`, or `error`).
+    #[arg(long = "duplicate-keys", value_enum, value_name = "POLICY")]
+    duplicate_keys: Option<DuplicateKeyPolicy>,
+
+    /// Write patched documents with object keys in the order of the input
+    /// document instead of sorted.
+    #[arg(long = "keep-order", action = ArgAction::SetTrue)]
+    keep_order: bool,
+
+    /// Treat numbers written as integers (`1`) and as floats (`1.0`) as
+    /// different values.
+    #[arg(long = "typed-numbers", action = ArgAction::SetTrue)]
+    typed_numbers: bool,
+
+    /// Pair Kubernetes list elements by their merge keys (containers by
+    /// `name`, ports by `containerPort`, ...). With `-p -f merge`, apply
+    /// FILE1 as a strategic merge patch.
+    #[arg(long = "strategic", action = ArgAction::SetTrue)]
+    strategic: bool,
+
+    /// Record the comparison options (`-set`, `-precision`, `-setkeys`,
+    /// `-ignore`, ...) as `^` headers in the diff, so `-p` applies it the
+    /// same way without repeating them.
+    #[arg(long = "option-headers", action = ArgAction::SetTrue)]
+    option_headers: bool,
+
+    /// Diff FILE1 and FILE2 as they are read, without loading either into
+    /// memory.
+    #[arg(long = "stream", action = ArgAction::SetTrue)]
+    stream: bool,
+
+    /// Re-run the diff whenever FILE1 or FILE2 changes.
+    #[arg(long = "watch", action = ArgAction::SetTrue)]
+    watch: bool,
+
+    /// Ignore `~/.config/jd/config.toml`.
+    #[arg(long = "no-config", action = ArgAction::SetTrue)]
+    no_config: bool,
+
     #[arg(long = "v2", action = ArgAction::SetTrue, hide = true)]
     v2: bool,
 
@@ -142,41 +419,192 @@ struct Cli {
     inputs: Vec<OsString>,
 }
 
+/// Exit status when the inputs are equal, or a patch or translation succeeded.
+const EXIT_SUCCESS: i32 = 0;
+/// Exit status when diff mode finds differences.
+const EXIT_DIFF: i32 = 1;
+/// Exit status for usage, IO, parse, and patch errors, matching Go jd.
+const EXIT_ERROR: i32 = 2;
+
 fn main() {
     match try_main() {
         Ok(code) => std::process::exit(code),
         Err(err) => {
-            let _ = writeln!(io::stderr(), "{err}");
-            std::process::exit(1);
+            let _ = writeln!(io::stderr(), "{err:#}");
+            std::process::exit(EXIT_ERROR);
         }
     }
 }
 
 fn try_main() -> Result<i32> {
     let args = canonicalize_args(std::env::args_os());
-    let cli = Cli::parse_from(args);
+    let matches = Cli::command().get_matches_from(args);
+    let mut cli = Cli::from_arg_matches(&matches).unwrap_or_else(|err| err.exit());
+    if cli.color_theme.is_none() {
+        cli.color_theme = theme_from_env()?;
+    }
+    if !cli.no_config {
+        if let Some(config) = config::Config::load()? {
+            config.apply(&mut cli, &matches)?;
+        }
+    }
 
     if cli.help {
         print!("{}", help_text());
-        return Ok(0);
+        return Ok(EXIT_SUCCESS);
     }
 
     if cli.version {
         println!("{VERSION_BANNER}");
-        return Ok(0);
+        return Ok(EXIT_SUCCESS);
     }
 
-    if cli.port.is_some() {
-        bail!("The web UI (-port) is not supported in this build");
-    }
-    if cli.git_diff_driver {
-        bail!("git diff driver mode is not implemented yet");
+    if let Some(port) = cli.port.filter(|port| *port != 0) {
+        web::serve(port)?;
+        return Ok(EXIT_SUCCESS);
     }
     if cli.patch && cli.translate.is_some() {
         bail!("Patch and translate modes cannot be used together.");
     }
+    if cli.watch && (cli.patch || cli.translate.is_some() || cli.git_diff_driver) {
+        bail!("watch mode only applies to diffs");
+    }
+    let ndjson = cli.ndjson || cli.ndjson_key.is_some();
+    if ndjson && (cli.patch || cli.translate.is_some() || cli.git_diff_driver || cli.watch) {
+        bail!("NDJSON mode only applies to diffs");
+    }
+    let documents = cli.documents || cli.documents_key.is_some();
+    if documents
+        && (cli.patch || cli.translate.is_some() || cli.git_diff_driver || cli.watch || ndjson)
+    {
+        bail!("document mode only applies to diffs");
+    }
+    if cli.stream
+        && (cli.patch
+            || cli.translate.is_some()
+            || cli.git_diff_driver
+            || cli.watch
+            || ndjson
+            || documents)
+    {
+        bail!("streaming mode only applies to document diffs");
+    }
+    if cli.cbor && cli.msgpack {
+        bail!("--cbor and --msgpack cannot be used together");
+    }
+    if let Some(binary) = Binary::from_cli(&cli) {
+        if cli.yaml || cli.jsonc || cli.keep_order {
+            bail!("{} cannot be combined with --yaml, --jsonc, or --keep-order", binary.flag());
+        }
+        if cli.translate.is_some()
+            || cli.git_diff_driver
+            || cli.watch
+            || ndjson
+            || cli.stream
+            || documents
+        {
+            bail!("{} only applies to document diffs and patches", binary.flag());
+        }
+    }
+    if !cli.paths.is_empty()
+        && (cli.patch || cli.translate.is_some() || ndjson || cli.stream || documents)
+    {
+        bail!("--path only applies to document diffs");
+    }
+    if cli.strategic && !cli.patch && cli.format == OutputFormat::Merge {
+        bail!("merge diffs cannot express strategic merge patches; use -f jd or -f patch");
+    }
+    if let Some(size) = cli.context {
+        if cli.patch || cli.translate.is_some() || cli.stream {
+            bail!("--context only applies to document diffs");
+        }
+        if size > 1 && cli.format == OutputFormat::Patch {
+            bail!(
+                "JSON Patch records at most one element of context; use --context=0 or --context=1"
+            );
+        }
+    }
+    if !cli.string_diff.is_empty() {
+        if cli.patch || cli.translate.is_some() {
+            bail!("--string-diff only applies to diffs");
+        }
+        if cli.stat || cli.summary || cli.format != OutputFormat::Native {
+            bail!("--string-diff only applies to jd diffs; use -f jd");
+        }
+    }
+    if cli.option_headers {
+        if cli.patch || cli.translate.is_some() || ndjson || cli.stream || documents {
+            bail!("--option-headers only applies to document diffs");
+        }
+        if !matches!(cli.format, OutputFormat::Native | OutputFormat::Json) {
+            bail!("--option-headers only applies to jd diffs; use -f jd or -f json");
+        }
+    }
+    if cli.stat {
+        if cli.patch || cli.translate.is_some() || ndjson || cli.stream || documents {
+            bail!("--stat only applies to document diffs");
+        }
+        if cli.format != OutputFormat::Native {
+            bail!("--stat cannot be combined with -f");
+        }
+    }
 
-    let mode = if cli.patch {
+    if cli.dry_run {
+        if !cli.patch {
+            bail!("--dry-run requires -p");
+        }
+        if !matches!(cli.format, OutputFormat::Native | OutputFormat::NativeV1 | OutputFormat::Json)
+        {
+            bail!("--dry-run only checks jd diffs; use -f jd, -f jd1, or -f json");
+        }
+    }
+    for (flag, set) in [
+        ("--strictness", cli.strictness.is_some()),
+        ("--fuzz", cli.fuzz.is_some()),
+        ("--context-mismatch", cli.context_mismatch.is_some()),
+        ("--rejects", cli.rejects.is_some()),
+    ] {
+        if set && !cli.patch {
+            bail!("{flag} requires -p");
+        }
+        if set
+            && !matches!(
+                cli.format,
+                OutputFormat::Native | OutputFormat::NativeV1 | OutputFormat::Json
+            )
+        {
+            bail!("{flag} only applies to jd diffs; use -f jd, -f jd1, or -f json");
+        }
+    }
+    if cli.dry_run && cli.rejects.is_some() {
+        bail!("--dry-run and --rejects cannot be used together");
+    }
+    if cli.schema.is_some() && (cli.translate.is_some() || ndjson || cli.stream || documents) {
+        bail!("--schema only applies to document diffs and patches");
+    }
+    if cli.summary {
+        if cli.preset.is_none() {
+            bail!("--summary requires --preset");
+        }
+        if cli.patch || cli.translate.is_some() || ndjson || cli.stream || documents {
+            bail!("--summary only applies to document diffs");
+        }
+        if cli.stat || cli.format != OutputFormat::Native {
+            bail!("--summary cannot be combined with --stat or -f");
+        }
+    }
+
+    let mode = if cli.git_diff_driver {
+        Mode::GitDiffDriver
+    } else if ndjson {
+        Mode::Ndjson
+    } else if documents {
+        Mode::Documents
+    } else if cli.stream {
+        Mode::Stream
+    } else if cli.watch {
+        Mode::Watch
+    } else if cli.patch {
         Mode::Patch
     } else if cli.translate.is_some() {
         Mode::Translate
@@ -186,8 +614,13 @@ fn try_main() -> Result<i32> {
 
     match mode {
         Mode::Diff => run_diff(&cli),
-        Mode::Patch => bail!("Patch mode is not implemented yet"),
-        Mode::Translate => bail!("Translate mode is not implemented yet"),
+        Mode::Patch => run_patch(&cli),
+        Mode::Translate => run_translate(&cli),
+        Mode::GitDiffDriver => run_git_diff_driver(&cli),
+        Mode::Watch => watch::run(&cli),
+        Mode::Ndjson => ndjson::run(&cli),
+        Mode::Documents => documents::run(&cli),
+        Mode::Stream => stream::run(&cli),
     }
 }
 
@@ -196,76 +629,439 @@ enum Mode {
     Diff,
     Patch,
     Translate,
+    GitDiffDriver,
+    Watch,
+    Ndjson,
+    Documents,
+    Stream,
 }
 
 fn run_diff(cli: &Cli) -> Result<i32> {
-    if cli.set {
-        bail!("-set is not implemented yet");
-    }
-    if cli.multiset {
-        bail!("-mset is not implemented yet");
-    }
-    if cli.setkeys.is_some() {
-        bail!("-setkeys is not implemented yet");
+    let binary = Binary::from_cli(cli);
+    if let ([lhs, rhs], None) = (cli.inputs.as_slice(), binary) {
+        let (lhs, rhs) = (Path::new(lhs), Path::new(rhs));
+        if lhs.is_dir() && rhs.is_dir() {
+            return dir::run(cli, lhs, rhs);
+        }
     }
-
-    let (first, second) = match cli.inputs.len() {
-        1 => (InputSource::File(path_from(&cli.inputs[0])?), InputSource::Stdin),
-        2 => (
-            InputSource::File(path_from(&cli.inputs[0])?),
-            InputSource::File(path_from(&cli.inputs[1])?),
-        ),
-        _ => {
-            return Err(anyhow!("{}", help_text()));
+    let (first, second) = input_sources(cli)?;
+    let both_stdin = matches!((&first, &second), (InputSource::Stdin, InputSource::Stdin));
+    let (rendered, have_diff) = if let Some(binary) = binary {
+        if both_stdin {
+            bail!("cannot read two {binary} documents from STDIN");
         }
+        let parse = parse_options(cli);
+        let lhs =
+            binary.decode(&read_bytes(&first)?, &parse).context("failed to parse first input")?;
+        let rhs =
+            binary.decode(&read_bytes(&second)?, &parse).context("failed to parse second input")?;
+        diff_nodes(cli, &lhs, rhs)?
+    } else {
+        let (lhs_text, rhs_text) = if both_stdin {
+            let (lhs, rhs) = split_documents(&read_input(&InputSource::Stdin)?, cli.yaml)?;
+            (Text::from(lhs), Text::from(rhs))
+        } else {
+            (read_input(&first)?, read_input(&second)?)
+        };
+        diff_texts(cli, cli.yaml, &lhs_text, &rhs_text)?
     };
+    write_output(cli, &rendered)?;
+    Ok(if have_diff { EXIT_DIFF } else { EXIT_SUCCESS })
+}
 
-    let lhs_text = read_input(&first)?;
-    let rhs_text = read_input(&second)?;
-    let lhs = parse_node(&lhs_text, cli.yaml).context("failed to parse first input")?;
-    let rhs = parse_node(&rhs_text, cli.yaml).context("failed to parse second input")?;
+/// Diffs two JSON (or YAML) documents with the CLI's options, returning the
+/// rendered diff and whether it describes any change.
+fn diff_texts(cli: &Cli, yaml: bool, lhs_text: &str, rhs_text: &str) -> Result<(String, bool)> {
+    let parse = parse_options(cli);
+    let lhs = parse_node(lhs_text, yaml, &parse).context("failed to parse first input")?;
+    let rhs = parse_node(rhs_text, yaml, &parse).context("failed to parse second input")?;
+    diff_nodes(cli, &lhs, rhs)
+}
 
+/// Diffs two parsed documents with the CLI's options, returning the rendered
+/// diff and whether it describes any change.
+fn diff_nodes(cli: &Cli, lhs: &Node, mut rhs: Node) -> Result<(String, bool)> {
+    if let Some(schema) = load_schema(cli)? {
+        check_schema(&schema, lhs, "the first input")?;
+        check_schema(&schema, &rhs, "the second input")?;
+    }
     let options = build_options(cli)?;
-    let diff = lhs.diff(&rhs, &options);
-
-    let mut render_config = RenderConfig::default();
-    if cli.color {
-        render_config = render_config.with_color(true);
+    let mut diff = lhs.diff(&rhs, &options);
+    if !cli.paths.is_empty() {
+        diff = subtree::restrict(&diff, &cli.paths)?;
+    }
+    let render_config = render_config(cli);
+    if cli.stat {
+        let stat = diff.stat();
+        return Ok((stat.render(&render_config), !stat.is_empty()));
+    }
+    if let Some(preset) = cli.preset.filter(|_| cli.summary) {
+        let summary = preset.summarize(&diff);
+        return Ok((summary.render(&render_config), !summary.is_empty()));
+    }
+    if !cli.paths.is_empty()
+        || !cli.ignore.is_empty()
+        || !cli.exclude_keys.is_empty()
+        || cli.format == OutputFormat::Unified
+    {
+        // Merge patches and unified diffs are built from the documents, so
+        // compare against FILE1 with only the reported changes applied.
+        rhs = lhs
+            .apply_patch_with_options(&diff, &options)
+            .context("failed to apply filtered diff")?;
+    }
+    if cli.option_headers {
+        diff = diff.with_option_headers(&options);
     }
 
-    let (rendered, have_diff) = match cli.format {
-        OutputFormat::Native => {
-            let rendered = diff.render(&render_config);
-            let have_diff = !rendered.is_empty();
-            (rendered, have_diff)
-        }
-        OutputFormat::Patch => {
-            let rendered = diff.render_patch().context("failed to render JSON Patch")?;
-            let have_diff = rendered != "[]";
-            (rendered, have_diff)
+    let (from, to) = unified_labels(cli);
+    let rendered = render_diff(cli.format, lhs, &rhs, &diff, &render_config, [&from, &to])?;
+    let have_diff = match cli.format {
+        OutputFormat::Native | OutputFormat::NativeV1 => !rendered.is_empty(),
+        OutputFormat::Patch => rendered != "[]",
+        OutputFormat::Merge => rendered != "{}",
+        OutputFormat::Json => rendered != "[]",
+        OutputFormat::Unified | OutputFormat::Paths => !rendered.is_empty(),
+    };
+    Ok((rendered, have_diff))
+}
+
+/// Names FILE1 and FILE2 on the `---` and `+++` lines of a unified diff. As
+/// a git diff driver both sides are the repository path, as in `git diff`.
+fn unified_labels(cli: &Cli) -> (String, String) {
+    let name = |input: &OsString| input.to_string_lossy().into_owned();
+    match cli.inputs.as_slice() {
+        [path, _, _, _, _, _, _] if cli.git_diff_driver => {
+            (format!("a/{}", name(path)), format!("b/{}", name(path)))
         }
+        [lhs, rhs, ..] => (name(lhs), name(rhs)),
+        [lhs] => (name(lhs), "-".to_string()),
+        [] => ("-".to_string(), "-".to_string()),
+    }
+}
+
+/// Runs as an external diff command for git. Accepts the seven arguments git
+/// passes to `diff.<driver>.command` and `GIT_EXTERNAL_DIFF`
+/// (`path old-file old-hex old-mode new-file new-hex new-mode`) as well as the
+/// two (`LOCAL REMOTE`) that `git difftool --extcmd` passes. Added and deleted
+/// files arrive as `/dev/null`, which reads as an empty (void) document. Exits
+/// 0 even when the files differ, since git treats other statuses as failures.
+fn run_git_diff_driver(cli: &Cli) -> Result<i32> {
+    let (lhs, rhs) = match cli.inputs.as_slice() {
+        [lhs, rhs] | [_, lhs, _, _, rhs, _, _] => (lhs, rhs),
+        _ => bail!("git diff driver expects 2 (difftool) or 7 (diff driver) arguments"),
+    };
+    let lhs_text = read_input(&InputSource::File(path_from(lhs)?))?;
+    let rhs_text = read_input(&InputSource::File(path_from(rhs)?))?;
+    let (rendered, _) = diff_texts(cli, cli.yaml, &lhs_text, &rhs_text)?;
+    write_output(cli, &rendered)?;
+    Ok(EXIT_SUCCESS)
+}
+
+/// Renders `diff` (computed from `lhs` to `rhs`) in the requested format.
+/// Unified diffs name the documents with `labels`.
+fn render_diff(
+    format: OutputFormat,
+    lhs: &Node,
+    rhs: &Node,
+    diff: &Diff,
+    config: &RenderConfig,
+    [from, to]: [&str; 2],
+) -> Result<String> {
+    match format {
+        OutputFormat::Native => Ok(diff.render(config)),
+        OutputFormat::NativeV1 => diff.render_v1().context("failed to render jd v1 diff"),
+        OutputFormat::Patch => diff.render_patch().context("failed to render JSON Patch"),
         OutputFormat::Merge => {
-            let patch = merge_patch(&lhs, &rhs).unwrap_or_else(|| Node::Object(BTreeMap::new()));
-            let rendered = patch
+            let patch = merge_patch(lhs, rhs).unwrap_or_else(|| Node::Object(BTreeMap::new()));
+            Ok(patch
                 .to_json_value()
                 .map(|value| serde_json::to_string(&value))
                 .transpose()
                 .context("failed to serialize merge patch")?
-                .unwrap_or_else(|| "{}".to_string());
-            let have_diff = rendered != "{}";
-            (rendered, have_diff)
+                .unwrap_or_else(|| "{}".to_string()))
+        }
+        OutputFormat::Json => diff.render_raw().context("failed to render JSON diff"),
+        OutputFormat::Unified => {
+            let config = UnifiedConfig::new()
+                .with_labels(from, to)
+                .with_color(config.color_enabled())
+                .with_theme(config.theme());
+            Ok(jd_core::unified_diff(lhs, rhs, &config))
+        }
+        OutputFormat::Paths => diff.render_paths().context("failed to render changed paths"),
+    }
+}
+
+fn run_patch(cli: &Cli) -> Result<i32> {
+    let (first, second) = input_sources(cli)?;
+    if matches!((&first, &second), (InputSource::Stdin, InputSource::Stdin)) {
+        bail!("cannot read both the patch and the document from STDIN");
+    }
+    let patch_text = read_input(&first)?;
+    if let Some(binary) = Binary::from_cli(cli) {
+        let target = binary
+            .decode(&read_bytes(&second)?, &parse_options(cli))
+            .context("failed to parse second input")?;
+        if cli.dry_run {
+            return check_patch_text(cli, &target, &patch_text);
+        }
+        let (patched, status) = apply_patch_text(cli, &target, &patch_text)?;
+        write_output_bytes(cli, &binary.encode(&patched)?)?;
+        return Ok(status);
+    }
+    let target_text = read_input(&second)?;
+    let target = parse_node(&target_text, cli.yaml, &parse_options(cli))
+        .context("failed to parse second input")?;
+    if cli.dry_run {
+        return check_patch_text(cli, &target, &patch_text);
+    }
+    let (patched, status) = apply_patch_text(cli, &target, &patch_text)?;
+
+    let rendered = if cli.keep_order {
+        let order = if cli.yaml {
+            KeyOrder::from_yaml_str(&target_text)
+        } else {
+            KeyOrder::from_json_str_with_options(&target_text, &parse_options(cli))
+        }
+        .context("failed to parse second input")?;
+        if cli.yaml {
+            patched.to_yaml_string_ordered(&order)
+        } else {
+            patched.to_json_string_ordered(&order)
+        }
+        .unwrap_or_default()
+    } else if cli.yaml {
+        patched.to_yaml_string().unwrap_or_default()
+    } else {
+        match patched.to_json_value() {
+            Some(value) => {
+                serde_json::to_string(&value).context("failed to serialize patched value")?
+            }
+            None => String::new(),
         }
     };
+    write_output(cli, &rendered)?;
+    Ok(status)
+}
 
+/// Applies `patch_text`, read in the `-f` format, to `target`, checking both
+/// documents against the `--schema`, if any. Returns the patched document
+/// and the exit status: `EXIT_DIFF` when `--rejects` set hunks aside.
+fn apply_patch_text(cli: &Cli, target: &Node, patch_text: &str) -> Result<(Node, i32)> {
+    let schema = load_schema(cli)?;
+    if let Some(schema) = &schema {
+        check_schema(schema, target, "the second input")?;
+    }
+    let mut status = EXIT_SUCCESS;
+    let patched = match cli.format {
+        OutputFormat::Native | OutputFormat::NativeV1 | OutputFormat::Json => {
+            let diff = read_diff(cli, patch_text)?;
+            let options = build_options(cli)?;
+            let patched = match &cli.rejects {
+                Some(file) => {
+                    let partial = target.apply_patch_partial(&diff, &options);
+                    if !partial.is_complete() {
+                        write_rejects(cli, file, &partial.rejects())?;
+                        eprintln!(
+                            "{} of {} hunks rejected; see {}",
+                            partial.rejected.len(),
+                            diff.len(),
+                            file.display()
+                        );
+                        status = EXIT_DIFF;
+                    }
+                    FuzzyPatch {
+                        node: partial.node,
+                        offsets: partial.offsets,
+                        warnings: partial.warnings,
+                    }
+                }
+                None => target.apply_patch_fuzzy(&diff, &options).map_err(hunk_error)?,
+            };
+            for offset in &patched.offsets {
+                let path = serde_json::to_string(&offset.path)?;
+                eprintln!(
+                    "applied hunk {} @ {path} at offset {:+}",
+                    offset.index + 1,
+                    offset.offset
+                );
+            }
+            for warning in &patched.warnings {
+                let hunk = warning.hunk().map_or(0, |hunk| hunk + 1);
+                eprintln!("warning: hunk {hunk}: {warning}");
+            }
+            patched.node
+        }
+        OutputFormat::Patch => target.apply_json_patch(patch_text)?,
+        OutputFormat::Merge if cli.strategic => {
+            let patch = parse_node(patch_text, cli.yaml, &parse_options(cli))?;
+            target.apply_strategic_merge_patch(&patch, &StrategicMerge::kubernetes())?
+        }
+        OutputFormat::Merge => target.apply_merge_patch(patch_text)?,
+        OutputFormat::Unified => bail!("unified diffs cannot be applied with -p"),
+        OutputFormat::Paths => bail!("path lists cannot be applied with -p"),
+    };
+    if let Some(schema) = &schema {
+        check_schema(schema, &patched, "the patched document")?;
+    }
+    Ok((patched, status))
+}
+
+/// Names the hunk a jd patch failed at, counting from one like `--rejects`
+/// and `--fuzz` reports.
+fn hunk_error(err: PatchError) -> anyhow::Error {
+    match err.hunk() {
+        Some(hunk) => anyhow::Error::new(err).context(format!("hunk {} does not apply", hunk + 1)),
+        None => err.into(),
+    }
+}
+
+/// Writes the hunks `--rejects` set aside to `file`, in the `-f` format.
+fn write_rejects(cli: &Cli, file: &Path, rejects: &Diff) -> Result<()> {
+    let rendered = match cli.format {
+        OutputFormat::Json => rejects.render_raw().context("failed to render rejected hunks")?,
+        OutputFormat::NativeV1 => rejects.render_v1().context("failed to render rejected hunks")?,
+        _ => rejects.render(&RenderConfig::default()),
+    };
+    fs::write(file, rendered)
+        .with_context(|| format!("failed to write rejected hunks to {}", file.display()))
+}
+
+/// Prints whether each hunk of `patch_text` applies to `target`, for
+/// `--dry-run`, checking `target` against the `--schema`, if any.
+fn check_patch_text(cli: &Cli, target: &Node, patch_text: &str) -> Result<i32> {
+    if let Some(schema) = load_schema(cli)? {
+        check_schema(&schema, target, "the second input")?;
+    }
+    let check = read_diff(cli, patch_text)?.check_with_options(target, &build_options(cli)?);
+    write_output(cli, &check.render(&render_config(cli)))?;
+    Ok(if check.is_clean() { EXIT_SUCCESS } else { EXIT_DIFF })
+}
+
+/// Parses a jd diff in the native, jd v1, or JSON `-f` format.
+fn read_diff(cli: &Cli, patch_text: &str) -> Result<Diff> {
+    match cli.format {
+        OutputFormat::Json => serde_json::from_str(patch_text).context("failed to parse JSON diff"),
+        OutputFormat::NativeV1 => Ok(Diff::from_native_v1_str(patch_text)?),
+        _ => Ok(Diff::from_native_str(patch_text)?),
+    }
+}
+
+/// Reads the `--schema` file, as YAML when it ends in `.yaml` or `.yml` and
+/// as JSON otherwise.
+fn load_schema(cli: &Cli) -> Result<Option<JsonSchema>> {
+    let Some(path) = &cli.schema else {
+        return Ok(None);
+    };
+    let text =
+        fs::read_to_string(path).with_context(|| format!("failed to read {}", path.display()))?;
+    let yaml = path.extension().is_some_and(|extension| extension == "yaml" || extension == "yml");
+    let context = || format!("failed to load the schema {}", path.display());
+    let schema = parse_node(&text, yaml, &ParseOptions::default()).with_context(context)?;
+    Ok(Some(JsonSchema::new(schema).with_context(context)?))
+}
+
+/// Fails with one line per violation when `document` does not match `schema`.
+fn check_schema(schema: &JsonSchema, document: &Node, name: &str) -> Result<()> {
+    let violations = schema.violations(document);
+    if violations.is_empty() {
+        return Ok(());
+    }
+    let mut message = format!("{name} does not match the schema:");
+    for violation in &violations {
+        message.push_str(&format!("\n  {violation} (at {})", violation.keyword));
+    }
+    bail!(message)
+}
+
+fn run_translate(cli: &Cli) -> Result<i32> {
+    let translation: Translation = cli.translate.as_deref().unwrap_or_default().parse()?;
+    let source = match cli.inputs.as_slice() {
+        [] => InputSource::Stdin,
+        [input] => input_source(input)?,
+        _ => bail!("{}", help_text()),
+    };
+    let rendered = translation.apply(&read_input(&source)?)?;
+    write_output(cli, &rendered)?;
+    Ok(EXIT_SUCCESS)
+}
+
+/// Reads `JD_COLOR_THEME`, which outranks the config file but not `--color-theme`.
+fn theme_from_env() -> Result<Option<ThemeChoice>> {
+    match std::env::var("JD_COLOR_THEME") {
+        Ok(name) if !name.is_empty() => ThemeChoice::from_str(&name, false).map(Some).map_err(|_| {
+            anyhow!("invalid JD_COLOR_THEME {name:?}: expected default, high-contrast, or colorblind")
+        }),
+        _ => Ok(None),
+    }
+}
+
+/// Builds the render configuration from the color and `--string-diff` flags.
+fn render_config(cli: &Cli) -> RenderConfig {
+    let theme = cli.color_theme.map_or(ColorTheme::Default, ThemeChoice::theme);
+    let config = RenderConfig::default().with_color(color_enabled(cli)).with_theme(theme);
+    cli.string_diff.iter().fold(config, |config, rule| match &rule.query {
+        Some(query) => config.with_string_granularity_at(query.clone(), rule.granularity),
+        None => config.with_string_granularity(rule.granularity),
+    })
+}
+
+/// One `--string-diff MODE[:PATH]` value.
+#[derive(Clone, Debug)]
+struct StringDiffRule {
+    granularity: StringGranularity,
+    query: Option<JsonPath>,
+}
+
+fn parse_string_diff(text: &str) -> Result<StringDiffRule, String> {
+    let (mode, query) = match text.split_once(':') {
+        Some((mode, query)) => {
+            (mode, Some(subtree::parse(query).map_err(|error| error.to_string())?))
+        }
+        None => (text, None),
+    };
+    let granularity = match mode {
+        "char" => StringGranularity::Char,
+        "word" => StringGranularity::Word,
+        "line" => StringGranularity::Line,
+        _ => return Err(format!("unknown string diff mode {mode:?}; use char, word, or line")),
+    };
+    Ok(StringDiffRule { granularity, query })
+}
+
+/// Decides whether native output is colored. `auto` only colors STDOUT when it
+/// is a terminal, so `-o` files stay plain unless color is forced.
+fn color_enabled(cli: &Cli) -> bool {
+    let terminal = cli.output.is_none() && io::stdout().is_terminal();
+    cli.color.enabled(std::env::var_os("NO_COLOR").as_deref(), terminal)
+}
+
+fn input_sources(cli: &Cli) -> Result<(InputSource, InputSource)> {
+    match cli.inputs.len() {
+        1 => Ok((input_source(&cli.inputs[0])?, InputSource::Stdin)),
+        2 => Ok((input_source(&cli.inputs[0])?, input_source(&cli.inputs[1])?)),
+        _ => Err(anyhow!("{}", help_text())),
+    }
+}
+
+/// Writes to the `-o` file when given, otherwise STDOUT. As in Go jd, `-o -`
+/// names a file literally called `-`; only input positions treat `-` as STDIN.
+fn write_output(cli: &Cli, rendered: &str) -> Result<()> {
+    write_output_bytes(cli, rendered.as_bytes())
+}
+
+/// Writes binary output, such as a patched CBOR document, like [`write_output`].
+fn write_output_bytes(cli: &Cli, rendered: &[u8]) -> Result<()> {
     if let Some(path) = &cli.output {
-        fs::write(path, rendered.as_bytes())
+        fs::write(path, rendered)
             .with_context(|| format!("failed to write output to {}", path.display()))?;
     } else {
-        print!("{rendered}");
-        io::stdout().flush().ok();
+        let mut stdout = io::stdout().lock();
+        stdout.write_all(rendered)?;
+        stdout.flush().ok();
     }
-
-    Ok(if have_diff { 1 } else { 0 })
+    Ok(())
 }
 
 #[derive(Debug)]
@@ -274,6 +1070,13 @@ enum InputSource {
     Stdin,
 }
 
+fn input_source(input: &OsString) -> Result<InputSource> {
+    if input == "-" {
+        return Ok(InputSource::Stdin);
+    }
+    Ok(InputSource::File(path_from(input)?))
+}
+
 fn path_from(input: &OsString) -> Result<PathBuf> {
     let path = PathBuf::from(input);
     if path.as_os_str().is_empty() {
@@ -282,29 +1085,147 @@ fn path_from(input: &OsString) -> Result<PathBuf> {
     Ok(path)
 }
 
-fn read_input(source: &InputSource) -> Result<String> {
+/// Reads a text input, mapping large files rather than copying them.
+fn read_input(source: &InputSource) -> Result<Text> {
+    match source {
+        InputSource::File(path) => Input::open(path)
+            .and_then(Text::new)
+            .with_context(|| format!("failed to read {}", path.display())),
+        InputSource::Stdin => Ok(Text::new(Input::read_all(io::stdin())?)?),
+    }
+}
+
+/// Reads a binary input, mapping large files rather than copying them.
+fn read_bytes(source: &InputSource) -> Result<Input> {
     match source {
         InputSource::File(path) => {
-            fs::read_to_string(path).with_context(|| format!("failed to read {}", path.display()))
+            Input::open(path).with_context(|| format!("failed to read {}", path.display()))
         }
-        InputSource::Stdin => {
-            let mut buffer = String::new();
-            io::stdin().read_to_string(&mut buffer)?;
-            Ok(buffer)
+        InputSource::Stdin => Ok(Input::read_all(io::stdin())?),
+    }
+}
+
+/// Splits one STDIN stream into the two documents of a diff, used when both
+/// inputs are `-` (for example `jd -`). JSON documents are split after the
+/// first complete value; YAML documents on a `---` separator line.
+fn split_documents(text: &str, yaml: bool) -> Result<(String, String)> {
+    if yaml {
+        let mut documents = vec![String::new()];
+        for line in text.split_inclusive('\n') {
+            if line.trim_end() == "---" {
+                if !documents.last().is_some_and(|doc| doc.trim().is_empty()) {
+                    documents.push(String::new());
+                }
+                continue;
+            }
+            documents.last_mut().expect("at least one document").push_str(line);
         }
+        return match <[String; 2]>::try_from(documents) {
+            Ok([lhs, rhs]) => Ok((lhs, rhs)),
+            Err(documents) => {
+                bail!("expected two YAML documents on STDIN, found {}", documents.len())
+            }
+        };
+    }
+    let mut stream = serde_json::Deserializer::from_str(text).into_iter::<serde_json::Value>();
+    match stream.next() {
+        Some(Ok(_)) => {}
+        Some(Err(err)) => return Err(anyhow!(err).context("failed to parse first input")),
+        None => bail!("expected two JSON documents on STDIN, found none"),
     }
+    let (lhs, rhs) = text.split_at(stream.byte_offset());
+    Ok((lhs.to_string(), rhs.to_string()))
 }
 
-fn parse_node(input: &str, yaml: bool) -> Result<Node> {
+fn parse_node(input: &str, yaml: bool, options: &ParseOptions) -> Result<Node> {
     if yaml {
-        Node::from_yaml_str(input).map_err(|err| anyhow!(err))
+        Node::from_yaml_str_with_options(input, options).map_err(|err| anyhow!(err))
     } else {
-        Node::from_json_str(input).map_err(|err| anyhow!(err))
+        Node::from_json_str_with_options(input, options).map_err(|err| anyhow!(err))
+    }
+}
+
+/// Builds the input reading options from `--duplicate-keys` and `--jsonc`.
+fn parse_options(cli: &Cli) -> ParseOptions {
+    let policy = match cli.duplicate_keys {
+        None | Some(DuplicateKeyPolicy::Last) => DuplicateKeys::LastWins,
+        Some(DuplicateKeyPolicy::First) => DuplicateKeys::FirstWins,
+        Some(DuplicateKeyPolicy::Error) => DuplicateKeys::Error,
+    };
+    ParseOptions::default().with_duplicate_keys(policy).with_jsonc(cli.jsonc)
+}
+
+fn build_options(cli: &Cli) -> Result<DiffOptions> {
+    let mut options = diff_options(cli.set, cli.multiset, cli.setkeys.as_deref(), cli.precision)?
+        .with_excluded_keys(&cli.exclude_keys)?
+        .with_move_detection(cli.moves);
+    if cli.patience {
+        options = options.with_list_alignment(ListAlignment::Patience);
     }
+    if let Some(threshold) = cli.similarity {
+        options = options.with_similarity_threshold(threshold)?;
+    }
+    if let Some(size) = cli.context {
+        options = options.with_context_size(size);
+    }
+    if cli.typed_numbers {
+        options = options.with_number_equality(NumberEquality::Typed);
+    }
+    if cli.strategic {
+        options = options.with_strategic_merge(&StrategicMerge::kubernetes());
+    }
+    if let Some(preset) = cli.preset {
+        options = options.with_preset(preset);
+    }
+    if let Some(max_offset) = cli.fuzz {
+        options = options.with_patch_fuzz(max_offset);
+    }
+    if let Some(choice) = cli.strictness {
+        options = options.with_patch_strictness(match choice {
+            StrictnessChoice::Strict => PatchStrictness::Strict,
+            StrictnessChoice::Lenient => PatchStrictness::Lenient,
+            StrictnessChoice::Force => PatchStrictness::Force,
+        });
+    }
+    if let Some(choice) = cli.context_mismatch {
+        options = options.with_context_mismatch(match choice {
+            ContextMismatchChoice::Error => ContextMismatch::Error,
+            ContextMismatchChoice::Warn => ContextMismatch::Warn,
+            ContextMismatchChoice::Ignore => ContextMismatch::Ignore,
+        });
+    }
+    for expression in &cli.ignore {
+        let query = subtree::parse(expression)?;
+        options = match query.to_path() {
+            Some(path) => options.with_ignored_paths([path]),
+            None => options
+                .with_query_option(&query, vec![DiffOption::Ignore(vec![jd_core::Path::new()])])?,
+        };
+    }
+    Ok(options)
 }
 
-fn build_options(_cli: &Cli) -> Result<DiffOptions> {
-    let options = DiffOptions::default();
+/// Builds diff options from the `-set`, `-mset`, `-setkeys`, and `-precision`
+/// flag values; shared by the CLI and the web UI.
+fn diff_options(
+    set: bool,
+    multiset: bool,
+    setkeys: Option<&str>,
+    precision: Option<f64>,
+) -> Result<DiffOptions> {
+    let mut options = DiffOptions::default();
+    if set {
+        options = options.with_array_mode(ArrayMode::Set)?;
+    }
+    if let Some(keys) = setkeys {
+        options = options.with_set_keys(keys.split(',').map(str::trim))?;
+    }
+    if multiset {
+        options = options.with_array_mode(ArrayMode::MultiSet)?;
+    }
+    if let Some(precision) = precision {
+        options = options.with_precision(precision)?;
+    }
     Ok(options)
 }
 
@@ -354,53 +1275,139 @@ fn merge_patch(lhs: &Node, rhs: &Node) -> Option<Node> {
     }
 }
 
+/// Go flags that take no value. Like Go's `flag` package, they also accept
+/// `-name=true` and `-name=false`.
+const GO_BOOL_FLAGS: &[&str] = &[
+    "help",
+    "version",
+    "yaml",
+    "cbor",
+    "msgpack",
+    "set",
+    "mset",
+    "git-diff-driver",
+    "git-difftool",
+    "no-config",
+    "watch",
+    "ndjson",
+    "documents",
+    "stat",
+    "summary",
+    "stream",
+    "moves",
+    "patience",
+    "keep-order",
+    "jsonc",
+    "typed-numbers",
+    "strategic",
+    "option-headers",
+    "dry-run",
+    "v2",
+    "p",
+];
+
+/// Go flags that take a value, either inline (`-name=value`) or as the next
+/// argument.
+const GO_VALUE_FLAGS: &[&str] = &[
+    "precision",
+    "setkeys",
+    "color-theme",
+    "ndjson-key",
+    "documents-key",
+    "path",
+    "ignore",
+    "exclude-keys",
+    "similarity",
+    "context",
+    "string-diff",
+    "preset",
+    "schema",
+    "strictness",
+    "fuzz",
+    "context-mismatch",
+    "rejects",
+    "duplicate-keys",
+    "port",
+    "o",
+    "f",
+    "t",
+];
+
+/// Rewrites Go-style flags (`-name`, `--name`, `-name=value`) into the forms
+/// clap understands. Arguments after `--` are left untouched.
 fn canonicalize_args<I>(args: I) -> Vec<OsString>
 where
     I: IntoIterator<Item = OsString>,
 {
     let mut canonicalized = Vec::new();
+    let mut flags_done = false;
     for (idx, arg) in args.into_iter().enumerate() {
-        if idx == 0 {
+        if idx == 0 || flags_done {
             canonicalized.push(arg);
             continue;
         }
-        match arg.to_str() {
-            Some("-help") => canonicalized.push(OsString::from("--help")),
-            Some("-h") => canonicalized.push(OsString::from("--help")),
-            Some("-version") => canonicalized.push(OsString::from("--version")),
-            Some("-color") => canonicalized.push(OsString::from("--color")),
-            Some("-yaml") => canonicalized.push(OsString::from("--yaml")),
-            Some("-set") => canonicalized.push(OsString::from("--set")),
-            Some("-mset") => canonicalized.push(OsString::from("--mset")),
-            Some("-precision") => canonicalized.push(OsString::from("--precision")),
-            Some("-setkeys") => canonicalized.push(OsString::from("--setkeys")),
-            Some("-v2") => canonicalized.push(OsString::from("--v2")),
-            Some(other) if other.starts_with("-f=") => {
-                canonicalized.push(OsString::from("-f"));
-                canonicalized.push(OsString::from(other.trim_start_matches("-f=")));
-            }
-            Some(other) if other.starts_with("-precision=") => {
-                canonicalized.push(OsString::from("--precision"));
-                canonicalized.push(OsString::from(other.trim_start_matches("-precision=")));
-            }
-            Some(other) if other.starts_with("-setkeys=") => {
-                canonicalized.push(OsString::from("--setkeys"));
-                canonicalized.push(OsString::from(other.trim_start_matches("-setkeys=")));
+        let Some(text) = arg.to_str() else {
+            canonicalized.push(arg);
+            continue;
+        };
+        if text == "--" {
+            flags_done = true;
+            canonicalized.push(arg);
+            continue;
+        }
+        let Some(flag) = text.strip_prefix("--").or_else(|| text.strip_prefix('-')) else {
+            canonicalized.push(arg);
+            continue;
+        };
+        let (name, value) = match flag.split_once('=') {
+            Some((name, value)) => (name, Some(value)),
+            None => (flag, None),
+        };
+        let name = if name == "h" { "help" } else { name };
+        let spelled = if name.len() == 1 { format!("-{name}") } else { format!("--{name}") };
+
+        if name == "color" {
+            // Go's boolean `-color` doubles as the tri-state `--color=WHEN`.
+            let choice = match value.map(|value| (value, parse_go_bool(value))) {
+                None | Some((_, Some(true))) => "always",
+                Some((_, Some(false))) => "never",
+                Some((value, None)) => value,
+            };
+            canonicalized.push(OsString::from(format!("--color={choice}")));
+        } else if GO_BOOL_FLAGS.contains(&name) {
+            match value.map(parse_go_bool) {
+                None | Some(Some(true)) => canonicalized.push(OsString::from(spelled)),
+                Some(Some(false)) => {}
+                Some(None) => canonicalized.push(arg),
             }
-            _ => canonicalized.push(arg),
+        } else if GO_VALUE_FLAGS.contains(&name) {
+            canonicalized.push(OsString::from(spelled));
+            canonicalized.extend(value.map(OsString::from));
+        } else {
+            canonicalized.push(arg);
         }
     }
     canonicalized
 }
 
+/// Mirrors Go's `strconv.ParseBool`.
+fn parse_go_bool(value: &str) -> Option<bool> {
+    match value {
+        "1" | "t" | "T" | "TRUE" | "true" | "True" => Some(true),
+        "0" | "f" | "F" | "FALSE" | "false" | "False" => Some(false),
+        _ => None,
+    }
+}
+
 fn help_text() -> String {
     HELP_TEMPLATE.replace("{version}", VERSION_NUMBER)
 }
 
 #[cfg(test)]
 mod tests {
-    use super::{canonicalize_args, OutputFormat};
-    use std::ffi::OsString;
+    use super::{canonicalize_args, split_documents, Cli, ColorChoice, OutputFormat};
+    use clap::Parser;
+    use std::ffi::{OsStr, OsString};
 
     #[test]
     fn canonicalizes_single_dash_variants() {
@@ -462,6 +1469,104 @@ mod tests {
         );
     }
 
+    #[test]
+    fn canonicalizes_go_boolean_values() {
+        let input = vec![
+            OsString::from("jd"),
+            OsString::from("-set=true"),
+            OsString::from("-color=false"),
+            OsString::from("--yaml=1"),
+            OsString::from("-mset=maybe"),
+        ];
+        let canonicalized = canonicalize_args(input);
+        assert_eq!(canonicalized, vec!["jd", "--set", "--color=never", "--yaml", "-mset=maybe"]);
+    }
+
+    #[test]
+    fn canonicalizes_color_choices() {
+        let input = ["jd", "-color", "--color=auto", "-color=never", "-color=T", "--color"];
+        let canonicalized = canonicalize_args(input.map(OsString::from));
+        assert_eq!(
+            canonicalized,
+            vec![
+                "jd",
+                "--color=always",
+                "--color=auto",
+                "--color=never",
+                "--color=always",
+                "--color=always"
+            ]
+        );
+        let cli =
+            Cli::parse_from(canonicalize_args(["jd", "-color", "a.json"].map(OsString::from)));
+        assert_eq!(cli.color, ColorChoice::Always);
+        assert_eq!(cli.inputs, vec![OsString::from("a.json")]);
+        assert_eq!(Cli::parse_from(["jd"]).color, ColorChoice::Auto);
+    }
+
+    #[test]
+    fn color_choice_honours_terminal_and_no_color() {
+        let set = Some(OsStr::new("1"));
+        let empty = Some(OsStr::new(""));
+        assert!(ColorChoice::Auto.enabled(None, true));
+        assert!(ColorChoice::Auto.enabled(empty, true));
+        assert!(!ColorChoice::Auto.enabled(set, true));
+        assert!(!ColorChoice::Auto.enabled(None, false));
+        assert!(ColorChoice::Always.enabled(set, false));
+        assert!(!ColorChoice::Never.enabled(None, true));
+    }
+
+    #[test]
+    fn canonicalizes_remaining_flag_surface() {
+        let input = vec![
+            OsString::from("jd"),
+            OsString::from("-o=out.json"),
+            OsString::from("-t=jd2patch"),
+            OsString::from("-port=8080"),
+            OsString::from("-git-diff-driver"),
+            OsString::from("--p"),
+            OsString::from("-"),
+            OsString::from("--"),
+            OsString::from("-set"),
+        ];
+        let canonicalized = canonicalize_args(input);
+        assert_eq!(
+            canonicalized,
+            vec![
+                "jd",
+                "-o",
+                "out.json",
+                "-t",
+                "jd2patch",
+                "--port",
+                "8080",
+                "--git-diff-driver",
+                "-p",
+                "-",
+                "--",
+                "-set",
+            ]
+        );
+    }
+
+    #[test]
+    fn splits_two_json_documents_from_one_stream() {
+        let (lhs, rhs) = split_documents("{\"a\":1}\n[1, 2]\n", false).unwrap();
+        assert_eq!(lhs, "{\"a\":1}");
+        assert_eq!(rhs, "\n[1, 2]\n");
+        let (lhs, rhs) = split_documents("1 2", false).unwrap();
+        assert_eq!((lhs.as_str(), rhs.as_str()), ("1", " 2"));
+        assert!(split_documents("", false).is_err());
+    }
+
+    #[test]
+    fn splits_two_yaml_documents_on_separators() {
+        let (lhs, rhs) = split_documents("---\na: 1\n---\na: 2\n", true).unwrap();
+        assert_eq!((lhs.as_str(), rhs.as_str()), ("a: 1\n", "a: 2\n"));
+        let err = split_documents("a: 1\n", true).unwrap_err();
+        assert_eq!(err.to_string(), "expected two YAML documents on STDIN, found 1");
+    }
+
     #[test]
     fn output_format_default_is_native() {
         assert_eq!(OutputFormat::default(), OutputFormat::Native);
@@ -0,0 +1,330 @@
+//! Streaming NDJSON (JSON Lines) diffs for `jd --ndjson FILE1 FILE2`.
+//!
+//! Each non-blank line is one JSON record. Records are diffed one at a time
+//! and their hunks are written as soon as they are known, so memory use is
+//! bounded by the largest record rather than the size of the inputs.
+//!
+//! By default records are paired by position and hunk paths start with the
+//! record index, as if both streams were arrays. With `--ndjson-key=FIELD`
+//! records are paired by the value of `FIELD` instead: FILE2 is indexed by key
+//! (keeping only byte offsets in memory) and re-read on demand, and paths use
+//! the same `{"FIELD":value}` segments as `-setkeys`, with unmatched records
+//! reported under `{}`.
+
+use std::collections::{HashMap, HashSet};
+use std::fs::File;
+use std::io::{self, BufRead, BufReader, Seek, SeekFrom, Write};
+
+use anyhow::{anyhow, bail, Context, Result};
+use jd_core::{
+    Diff, DiffElement, DiffOptions, Node, ParseOptions, Path, PathSegment, RenderConfig,
+};
+
+use crate::{
+    build_options, input_source, parse_options, path_from, render_config, Cli, InputSource,
+    OutputFormat, EXIT_DIFF, EXIT_SUCCESS,
+};
+
+/// Diffs FILE1 and FILE2 record by record, streaming hunks to the output.
+pub(crate) fn run(cli: &Cli) -> Result<i32> {
+    if cli.format != OutputFormat::Native {
+        bail!("NDJSON mode only supports the native jd format");
+    }
+    let [lhs, rhs] = cli.inputs.as_slice() else {
+        bail!("NDJSON mode needs two inputs");
+    };
+    let options = build_options(cli)?;
+    let parse = parse_options(cli);
+    let config = render_config(cli);
+    let mut out: Box<dyn Write> = match &cli.output {
+        Some(path) => Box::new(io::BufWriter::new(
+            File::create(path)
+                .with_context(|| format!("failed to write output to {}", path.display()))?,
+        )),
+        None => Box::new(io::stdout().lock()),
+    };
+    let mut stream = Stream { options: &options, parse: &parse, config: &config, out: &mut out };
+
+    let have_diff = match &cli.ndjson_key {
+        Some(key) => {
+            let lhs = open(&input_source(lhs)?)?;
+            let rhs = File::open(path_from(rhs)?)
+                .context("NDJSON keyed mode needs FILE2 to be a file")?;
+            stream.keyed(lhs, BufReader::new(rhs), key)?
+        }
+        None => stream.positional(open(&input_source(lhs)?)?, open(&input_source(rhs)?)?)?,
+    };
+    out.flush().context("failed to write output")?;
+    Ok(if have_diff { EXIT_DIFF } else { EXIT_SUCCESS })
+}
+
+pub(crate) fn open(source: &InputSource) -> Result<Box<dyn BufRead>> {
+    Ok(match source {
+        InputSource::File(path) => Box::new(BufReader::new(
+            File::open(path).with_context(|| format!("failed to read {}", path.display()))?,
+        )),
+        InputSource::Stdin => Box::new(BufReader::new(io::stdin())),
+    })
+}
+
+/// Reads one record per non-blank line, tracking line numbers and offsets.
+struct Records<R> {
+    reader: R,
+    options: ParseOptions,
+    line: usize,
+    offset: u64,
+    buffer: String,
+}
+
+/// A parsed record with its 1-based line number and starting byte offset.
+struct Record {
+    line: usize,
+    offset: u64,
+    node: Node,
+}
+
+impl<R: BufRead> Records<R> {
+    fn new(reader: R, options: &ParseOptions) -> Self {
+        Self { reader, options: options.clone(), line: 0, offset: 0, buffer: String::new() }
+    }
+
+    fn next(&mut self) -> Result<Option<Record>> {
+        loop {
+            self.buffer.clear();
+            let read = self.reader.read_line(&mut self.buffer).context("failed to read record")?;
+            if read == 0 {
+                return Ok(None);
+            }
+            let offset = self.offset;
+            self.offset += read as u64;
+            self.line += 1;
+            if self.buffer.trim().is_empty() {
+                continue;
+            }
+            let node = Node::from_json_str_with_options(&self.buffer, &self.options)
+                .map_err(|err| anyhow!("invalid record at line {}: {err}", self.line))?;
+            return Ok(Some(Record { line: self.line, offset, node }));
+        }
+    }
+}
+
+impl<R: BufRead + Seek> Records<R> {
+    /// Re-reads the record starting at `offset`.
+    fn read_at(&mut self, offset: u64) -> Result<Record> {
+        self.reader.seek(SeekFrom::Start(offset)).context("failed to read record")?;
+        self.offset = offset;
+        self.next()?.ok_or_else(|| anyhow!("record at byte {offset} is missing"))
+    }
+}
+
+struct Stream<'a> {
+    options: &'a DiffOptions,
+    parse: &'a ParseOptions,
+    config: &'a RenderConfig,
+    out: &'a mut dyn Write,
+}
+
+impl Stream<'_> {
+    /// Pairs the `n`th record of each stream. Surplus records in FILE2 are
+    /// added at their index; surplus records in FILE1 are all removed at the
+    /// first surplus index, since each removal shifts the rest down.
+    fn positional(&mut self, lhs: impl BufRead, rhs: impl BufRead) -> Result<bool> {
+        let (mut lhs, mut rhs) = (Records::new(lhs, self.parse), Records::new(rhs, self.parse));
+        let mut have_diff = false;
+        let mut surplus = None;
+        for index in 0_i64.. {
+            let segment = PathSegment::Index(index);
+            have_diff |= match (lhs.next()?, rhs.next()?) {
+                (None, None) => break,
+                (Some(a), Some(b)) => self.emit(segment, &a.node.diff(&b.node, self.options))?,
+                (Some(a), None) => {
+                    let first = *surplus.get_or_insert(index);
+                    self.emit_whole(PathSegment::Index(first), a.node, true)?
+                }
+                (None, Some(b)) => self.emit_whole(segment, b.node, false)?,
+            };
+        }
+        Ok(have_diff)
+    }
+
+    /// Pairs records by the value of `field`, re-reading FILE2 through `rhs`.
+    fn keyed<R: BufRead + Seek>(&mut self, lhs: impl BufRead, rhs: R, field: &str) -> Result<bool> {
+        let mut rhs = Records::new(rhs, self.parse);
+        let mut index = HashMap::new();
+        let mut order = Vec::new();
+        while let Some(record) = rhs.next()? {
+            let key = record_key(&record, field)?;
+            if index.insert(key.clone(), record.offset).is_some() {
+                bail!("duplicate key {key} at line {} of the second input", record.line);
+            }
+            order.push(key);
+        }
+
+        let mut lhs = Records::new(lhs, self.parse);
+        let mut seen = HashSet::new();
+        let mut have_diff = false;
+        while let Some(record) = lhs.next()? {
+            let key = record_key(&record, field)?;
+            if !seen.insert(key.clone()) {
+                bail!("duplicate key {key} at line {} of the first input", record.line);
+            }
+            have_diff |= match index.remove(&key) {
+                Some(offset) => {
+                    let other = rhs.read_at(offset)?;
+                    let segment = key_segment(&record, field)?;
+                    self.emit(segment, &record.node.diff(&other.node, self.options))?
+                }
+                None => self.emit_whole(PathSegment::Set, record.node, true)?,
+            };
+        }
+        for key in order {
+            if let Some(offset) = index.remove(&key) {
+                let record = rhs.read_at(offset)?;
+                have_diff |= self.emit_whole(PathSegment::Set, record.node, false)?;
+            }
+        }
+        Ok(have_diff)
+    }
+
+    /// Writes `diff` with every hunk path prefixed by `segment`.
+    fn emit(&mut self, segment: PathSegment, diff: &Diff) -> Result<bool> {
+        self.write(&Diff::from_elements(below(&segment, diff)))
+    }
+
+    /// Writes a hunk removing or adding an entire record.
+    fn emit_whole(&mut self, segment: PathSegment, node: Node, removed: bool) -> Result<bool> {
+        self.write(&Diff::from_elements(vec![whole(segment, node, removed)]))
+    }
+
+    fn write(&mut self, diff: &Diff) -> Result<bool> {
+        let rendered = diff.render(self.config);
+        self.out.write_all(rendered.as_bytes()).context("failed to write output")?;
+        Ok(!rendered.is_empty())
+    }
+}
+
+fn key_value<'a>(record: &'a Record, field: &str) -> Result<&'a Node> {
+    match &record.node {
+        Node::Object(members) => members.get(field),
+        _ => None,
+    }
+    .ok_or_else(|| anyhow!("record at line {} has no {field:?} field", record.line))
+}
+
+fn record_key(record: &Record, field: &str) -> Result<String> {
+    let value = key_value(record, field)?;
+    Ok(value.to_json_value().map(|value| value.to_string()).unwrap_or_default())
+}
+
+fn key_segment(record: &Record, field: &str) -> Result<PathSegment> {
+    let value = key_value(record, field)?.clone();
+    Ok(PathSegment::SetKeys([(field.to_string(), value)].into()))
+}
+
+/// Returns the hunks of `diff` with every path prefixed by `segment`.
+pub(crate) fn below(segment: &PathSegment, diff: &Diff) -> Vec<DiffElement> {
+    diff.iter()
+        .cloned()
+        .map(|mut element| {
+            element.path = prefixed(segment, element.path);
+            element.moved_from = element.moved_from.map(|from| prefixed(segment, from));
+            element
+        })
+        .collect()
+}
+
+/// Builds a hunk removing or adding all of `node` at `segment`.
+pub(crate) fn whole(segment: PathSegment, node: Node, removed: bool) -> DiffElement {
+    let element = DiffElement::new().with_path(Path::from(vec![segment]));
+    if removed {
+        element.with_remove(vec![node])
+    } else {
+        element.with_add(vec![node])
+    }
+}
+
+/// Returns `path` below the record addressed by `segment`.
+fn prefixed(segment: &PathSegment, path: Path) -> Path {
+    let mut segments = vec![segment.clone()];
+    segments.extend(path.into_segments());
+    Path::from(segments)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::io::Cursor;
+
+    fn positional(lhs: &str, rhs: &str) -> (String, bool) {
+        let (options, config) = (DiffOptions::default(), RenderConfig::default());
+        let parse = ParseOptions::default();
+        let mut out = Vec::new();
+        let have_diff = Stream { options: &options, parse: &parse, config: &config, out: &mut out }
+            .positional(lhs.as_bytes(), rhs.as_bytes())
+            .unwrap();
+        (String::from_utf8(out).unwrap(), have_diff)
+    }
+
+    fn keyed(lhs: &str, rhs: &str, field: &str) -> Result<(String, bool)> {
+        let (options, config) = (DiffOptions::default(), RenderConfig::default());
+        let parse = ParseOptions::default();
+        let mut out = Vec::new();
+        let have_diff = Stream { options: &options, parse: &parse, config: &config, out: &mut out }
+            .keyed(lhs.as_bytes(), Cursor::new(rhs.as_bytes()), field)?;
+        Ok((String::from_utf8(out).unwrap(), have_diff))
+    }
+
+    #[test]
+    fn positional_records_are_paired_by_index() {
+        let (rendered, have_diff) =
+            positional("{\"a\":1}\n{\"a\":2}\n\n{\"a\":3}\n", "{\"a\":1}\n{\"a\":5}\n");
+        assert!(have_diff);
+        assert_eq!(rendered, "@ [1,\"a\"]\n- 2\n+ 5\n@ [2]\n- {\"a\":3}\n");
+        assert_eq!(positional("1\n2\n3\n", "1\n").0, "@ [1]\n- 2\n@ [1]\n- 3\n");
+        assert_eq!(positional("1\n", "1\n"), (String::new(), false));
+        assert_eq!(positional("", "true\n").0, "@ [0]\n+ true\n");
+    }
+
+    #[test]
+    fn positional_diffs_apply_as_array_patches() {
+        let array = |records: &str| {
+            Node::from_json_str(&format!("[{}]", records.lines().collect::<Vec<_>>().join(",")))
+                .unwrap()
+        };
+        for (lhs, rhs) in [
+            ("1\n2\n3\n4\n", "1\n"),
+            ("{\"a\":1}\n2\n3\n", "{\"a\":2}\n"),
+            ("1\n", "5\n6\n7\n"),
+            ("1\n2\n", "1\n2\n"),
+        ] {
+            let diff = Diff::from_native_str(&positional(lhs, rhs).0).unwrap();
+            assert_eq!(array(lhs).apply_patch(&diff).unwrap(), array(rhs), "{lhs:?} -> {rhs:?}");
+        }
+    }
+
+    #[test]
+    fn keyed_records_are_paired_by_field() {
+        let lhs = "{\"id\":1,\"v\":\"a\"}\n{\"id\":2,\"v\":\"b\"}\n{\"id\":3,\"v\":\"c\"}\n";
+        let rhs = "{\"id\":4,\"v\":\"d\"}\n{\"id\":3,\"v\":\"c\"}\n{\"id\":1,\"v\":\"z\"}\n";
+        let (rendered, have_diff) = keyed(lhs, rhs, "id").unwrap();
+        assert!(have_diff);
+        assert_eq!(
+            rendered,
+            "@ [{\"id\":1},\"v\"]\n- \"a\"\n+ \"z\"\n\
+             @ [{}]\n- {\"id\":2,\"v\":\"b\"}\n\
+             @ [{}]\n+ {\"id\":4,\"v\":\"d\"}\n"
+        );
+    }
+
+    #[test]
+    fn keyed_mode_reports_bad_records() {
+        let err = keyed("{\"id\":1}\n", "{\"id\":1}\n{\"id\":1}\n", "id").unwrap_err();
+        assert_eq!(err.to_string(), "duplicate key 1 at line 2 of the second input");
+        let err = keyed("{\"id\":1}\n\n{\"id\":1}\n", "{\"id\":1}\n", "id").unwrap_err();
+        assert_eq!(err.to_string(), "duplicate key 1 at line 3 of the first input");
+        let err = keyed("{\"name\":1}\n", "", "id").unwrap_err();
+        assert_eq!(err.to_string(), "record at line 1 has no \"id\" field");
+        let err = keyed("{\n", "", "id").unwrap_err();
+        assert!(err.to_string().starts_with("invalid record at line 1:"));
+    }
+}
@@ -0,0 +1,56 @@
+//! Streaming document diffs for `jd --stream FILE1 FILE2`.
+//!
+//! Both documents are read token by token through [`jd_core::diff_streams`]
+//! and each hunk is written as soon as it is known, so inputs larger than
+//! memory can be compared as long as their differences are not.
+
+use std::fs::File;
+use std::io::{self, Write};
+
+use anyhow::{bail, Context, Result};
+use jd_core::{diff_streams, Diff};
+
+use crate::{
+    build_options, input_source, ndjson, render_config, Cli, OutputFormat, EXIT_DIFF, EXIT_SUCCESS,
+};
+
+/// Diffs FILE1 and FILE2 without loading either, streaming hunks to the
+/// output.
+pub(crate) fn run(cli: &Cli) -> Result<i32> {
+    if cli.format != OutputFormat::Native {
+        bail!("streaming mode only supports the native jd format");
+    }
+    if cli.yaml {
+        bail!("streaming mode only supports JSON input");
+    }
+    if cli.duplicate_keys.is_some() {
+        bail!("streaming mode does not support --duplicate-keys");
+    }
+    if cli.jsonc {
+        bail!("streaming mode does not support --jsonc");
+    }
+    let [lhs, rhs] = cli.inputs.as_slice() else {
+        bail!("streaming mode needs two inputs");
+    };
+    let options = build_options(cli)?;
+    let config = render_config(cli);
+    let mut out: Box<dyn Write> = match &cli.output {
+        Some(path) => Box::new(io::BufWriter::new(
+            File::create(path)
+                .with_context(|| format!("failed to write output to {}", path.display()))?,
+        )),
+        None => Box::new(io::stdout().lock()),
+    };
+
+    let lhs = ndjson::open(&input_source(lhs)?)?;
+    let rhs = ndjson::open(&input_source(rhs)?)?;
+    let mut have_diff = false;
+    diff_streams(lhs, rhs, &options, |element| {
+        let rendered = Diff::from_elements(vec![element]).render(&config);
+        have_diff |= !rendered.is_empty();
+        out.write_all(rendered.as_bytes())
+    })
+    .context("failed to stream the diff")?;
+    out.flush().context("failed to write output")?;
+    Ok(if have_diff { EXIT_DIFF } else { EXIT_SUCCESS })
+}
@@ -0,0 +1,86 @@
+//! Subtree filtering for `jd --path EXPR`, and the path syntax shared with
+//! `jd --ignore EXPR`.
+//!
+//! Paths are JSONPath expressions: `$` for the document root followed by
+//! `.name` or `["name"]` for object keys, `[N]` for list indices, `*` for
+//! every child, and `..` to match at any depth, as in
+//! `$.spec.containers[*]["image"]` or `$..uid`. Indices refer to positions
+//! in FILE1. Only hunks at or below a path one of the expressions selects
+//! are reported.
+
+use anyhow::Result;
+use jd_core::{Diff, JsonPath};
+
+/// Keeps the hunks of `diff` that lie at or below any path `queries` select.
+pub(crate) fn restrict(diff: &Diff, queries: &[String]) -> Result<Diff> {
+    let queries = queries.iter().map(|query| parse(query)).collect::<Result<Vec<_>>>()?;
+    Ok(diff.filter(|path| queries.iter().any(|query| query.contains(path))))
+}
+
+/// Parses a `$.a.b[0]` expression.
+pub(crate) fn parse(text: &str) -> Result<JsonPath> {
+    Ok(JsonPath::parse(text)?)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use jd_core::{DiffOptions, Node, RenderConfig};
+
+    fn parsed(text: &str) -> String {
+        serde_json::to_string(&parse(text).unwrap().to_path().unwrap()).unwrap()
+    }
+
+    #[test]
+    fn parses_keys_and_indices() {
+        assert_eq!(parsed("$"), "[]");
+        assert_eq!(parsed("$.spec.containers"), r#"["spec","containers"]"#);
+        assert_eq!(
+            parsed(r#"$.spec.containers[0]["image.tag"]"#),
+            r#"["spec","containers",0,"image.tag"]"#
+        );
+        assert_eq!(parsed(r#"$["a]b"][""]"#), r#"["a]b",""]"#);
+    }
+
+    #[test]
+    fn rejects_malformed_paths() {
+        for (text, reason) in [
+            ("spec", "expected it to start with $"),
+            ("$.", "expected a key after ."),
+            ("$[0", "unclosed ["),
+            ("$[\"a]", "unclosed ["),
+            ("$[x]", "expected an index or quoted key"),
+            ("$[-1]", "list indices cannot be negative"),
+            ("$a", "expected . or ["),
+        ] {
+            assert_eq!(
+                parse(text).unwrap_err().to_string(),
+                format!("invalid path {text:?}: {reason}")
+            );
+        }
+    }
+
+    #[test]
+    fn restrict_keeps_hunks_below_any_path() {
+        let lhs = Node::from_json_str(r#"{"a":{"x":1},"b":[1,2],"c":true}"#).unwrap();
+        let rhs = Node::from_json_str(r#"{"a":{"x":2},"b":[1,3],"c":false}"#).unwrap();
+        let diff = lhs.diff(&rhs, &DiffOptions::default());
+        let restricted = restrict(&diff, &["$.a".to_string(), "$.b".to_string()]).unwrap();
+        assert_eq!(
+            restricted.render(&RenderConfig::default()),
+            "@ [\"a\",\"x\"]\n- 1\n+ 2\n@ [\"b\",1]\n  1\n- 2\n+ 3\n]\n"
+        );
+    }
+
+    #[test]
+    fn restrict_matches_wildcards_and_descendants() {
+        let lhs = Node::from_json_str(r#"{"a":[{"id":1,"n":1}],"b":{"c":{"id":2}}}"#).unwrap();
+        let rhs = Node::from_json_str(r#"{"a":[{"id":3,"n":2}],"b":{"c":{"id":4}}}"#).unwrap();
+        let diff = lhs.diff(&rhs, &DiffOptions::default());
+        let restricted = restrict(&diff, &["$..id".to_string()]).unwrap();
+        let paths: Vec<String> = restricted.iter().map(|hunk| hunk.path.to_string()).collect();
+        assert_eq!(paths, ["[a 0 id]", "[b c id]"]);
+        let restricted = restrict(&diff, &["$.a[*].n".to_string()]).unwrap();
+        assert_eq!(restricted.len(), 1);
+    }
+}
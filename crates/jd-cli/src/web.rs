@@ -0,0 +1,325 @@
+//! Local web UI for `jd -port N`.
+//!
+//! Serves a single static page plus a `POST /diff` endpoint backed by
+//! `jd-core`, so two pasted documents can be compared in the browser with
+//! native, JSON Patch, and JSON Merge Patch renders side by side. The server
+//! is a small blocking HTTP/1.1 server on `std::net` bound to localhost that
+//! handles each connection on its own thread. A connection must send its
+//! request, and then take its response, within a fixed deadline, so a client
+//! that stalls or trickles bytes is dropped instead of piling up threads.
+
+use std::io::{self, BufRead, BufReader, Read, Write};
+use std::net::{Ipv4Addr, TcpListener, TcpStream};
+use std::time::{Duration, Instant};
+
+use anyhow::{anyhow, bail, Context, Result};
+use jd_core::{ParseOptions, RenderConfig};
+use serde_json::{json, Value};
+
+use crate::{diff_options, parse_node, render_diff, OutputFormat};
+
+const INDEX_HTML: &str = include_str!("web/index.html");
+
+/// Largest request body accepted, so a stray client cannot exhaust memory.
+const MAX_BODY_BYTES: usize = 16 * 1024 * 1024;
+
+/// How long a connection may take to send its request, and separately to
+/// take its response, before it is dropped.
+const IO_DEADLINE: Duration = Duration::from_secs(10);
+
+/// Pause after a failed `accept`, so running out of file descriptors does not
+/// spin the loop.
+const ACCEPT_BACKOFF: Duration = Duration::from_millis(100);
+
+/// Serves the web UI on `localhost:port` until the process is interrupted.
+pub(crate) fn serve(port: u16) -> Result<()> {
+    let listener = TcpListener::bind((Ipv4Addr::LOCALHOST, port))
+        .with_context(|| format!("failed to listen on port {port}"))?;
+    println!("Listening on http://localhost:{port}...");
+    serve_listener(&listener, IO_DEADLINE);
+    Ok(())
+}
+
+/// Accepts connections forever, handing each to its own thread and reporting
+/// failed connections on STDERR.
+fn serve_listener(listener: &TcpListener, deadline: Duration) {
+    for stream in listener.incoming() {
+        match stream {
+            Ok(stream) => {
+                std::thread::spawn(move || {
+                    if let Err(err) = handle(&stream, deadline) {
+                        eprintln!("{err:#}");
+                    }
+                });
+            }
+            Err(err) => {
+                eprintln!("failed to accept connection: {err}");
+                std::thread::sleep(ACCEPT_BACKOFF);
+            }
+        }
+    }
+}
+
+/// A view of a connection whose reads or writes must all finish by one
+/// instant. Each call gets only the time that is left, so trickling bytes
+/// cannot extend the connection.
+struct Deadline<'a> {
+    stream: &'a TcpStream,
+    at: Instant,
+}
+
+impl<'a> Deadline<'a> {
+    fn new(stream: &'a TcpStream, limit: Duration) -> Self {
+        Self { stream, at: Instant::now() + limit }
+    }
+
+    fn remaining(&self) -> io::Result<Duration> {
+        self.at
+            .checked_duration_since(Instant::now())
+            .filter(|left| !left.is_zero())
+            .ok_or_else(|| io::Error::new(io::ErrorKind::TimedOut, "connection deadline passed"))
+    }
+}
+
+impl Read for Deadline<'_> {
+    fn read(&mut self, buf: &mut [u8]) -> io::Result<usize> {
+        self.stream.set_read_timeout(Some(self.remaining()?))?;
+        let mut stream = self.stream;
+        stream.read(buf)
+    }
+}
+
+impl Write for Deadline<'_> {
+    fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
+        self.stream.set_write_timeout(Some(self.remaining()?))?;
+        let mut stream = self.stream;
+        stream.write(buf)
+    }
+
+    fn flush(&mut self) -> io::Result<()> {
+        let mut stream = self.stream;
+        stream.flush()
+    }
+}
+
+#[derive(Debug)]
+struct Response {
+    status: &'static str,
+    content_type: &'static str,
+    body: String,
+}
+
+impl Response {
+    fn json(status: &'static str, body: &Value) -> Self {
+        Self { status, content_type: "application/json", body: body.to_string() }
+    }
+
+    fn error(status: &'static str, message: &str) -> Self {
+        Self::json(status, &json!({ "error": message }))
+    }
+}
+
+fn handle(stream: &TcpStream, deadline: Duration) -> Result<()> {
+    let response = match read_request(Deadline::new(stream, deadline)) {
+        Ok((method, path, body)) => route(&method, &path, &body),
+        Err(err) => Response::error("400 Bad Request", &format!("{err:#}")),
+    };
+    write!(
+        Deadline::new(stream, deadline),
+        "HTTP/1.1 {}\r\nContent-Type: {}\r\nContent-Length: {}\r\nConnection: close\r\n\r\n{}",
+        response.status,
+        response.content_type,
+        response.body.len(),
+        response.body
+    )
+    .context("failed to write response")
+}
+
+/// Reads the request line, headers, and `Content-Length` body of one request.
+fn read_request(stream: impl Read) -> Result<(String, String, String)> {
+    let mut reader = BufReader::new(stream);
+    let mut line = String::new();
+    reader.read_line(&mut line).context("failed to read request")?;
+    let mut parts = line.split_whitespace();
+    let (Some(method), Some(target)) = (parts.next(), parts.next()) else {
+        bail!("malformed request line");
+    };
+
+    let mut length = 0;
+    loop {
+        let mut header = String::new();
+        if reader.read_line(&mut header)? == 0 || header.trim_end().is_empty() {
+            break;
+        }
+        if let Some((name, value)) = header.split_once(':') {
+            if name.trim().eq_ignore_ascii_case("content-length") {
+                length = value.trim().parse::<usize>().context("invalid Content-Length")?;
+            }
+        }
+    }
+    if length > MAX_BODY_BYTES {
+        bail!("request body exceeds {MAX_BODY_BYTES} bytes");
+    }
+    let mut body = vec![0; length];
+    reader.read_exact(&mut body).context("failed to read request body")?;
+    let body = String::from_utf8(body).context("request body is not UTF-8")?;
+    let path = target.split('?').next().unwrap_or_default();
+    Ok((method.to_string(), path.to_string(), body))
+}
+
+fn route(method: &str, path: &str, body: &str) -> Response {
+    match (method, path) {
+        ("GET", "/" | "/index.html") => Response {
+            status: "200 OK",
+            content_type: "text/html; charset=utf-8",
+            body: INDEX_HTML.to_string(),
+        },
+        ("POST", "/diff") => match diff(body) {
+            Ok(renders) => Response::json("200 OK", &renders),
+            Err(err) => Response::error("400 Bad Request", &format!("{err:#}")),
+        },
+        (_, "/" | "/index.html" | "/diff") => {
+            Response::error("405 Method Not Allowed", "method not allowed")
+        }
+        _ => Response::error("404 Not Found", "not found"),
+    }
+}
+
+/// Diffs the `lhs` and `rhs` documents of a `/diff` request, returning every
+/// render so the page can show all formats without another round trip.
+/// Optional `yaml`, `set`, `mset`, `setkeys`, and `precision` fields mirror
+/// the CLI flags of the same names.
+fn diff(body: &str) -> Result<Value> {
+    let request: Value = serde_json::from_str(body).context("invalid request")?;
+    let text = |field: &str| request.get(field).and_then(Value::as_str).unwrap_or_default();
+    let flag = |field: &str| request.get(field).and_then(Value::as_bool).unwrap_or(false);
+
+    let yaml = flag("yaml");
+    let parse = ParseOptions::default();
+    let lhs = parse_node(text("lhs"), yaml, &parse).context("failed to parse first input")?;
+    let rhs = parse_node(text("rhs"), yaml, &parse).context("failed to parse second input")?;
+    let precision = match request.get("precision") {
+        None | Some(Value::Null) => None,
+        Some(value) => Some(value.as_f64().ok_or_else(|| anyhow!("precision must be a number"))?),
+    };
+    let setkeys = Some(text("setkeys")).filter(|keys| !keys.is_empty());
+    let options = diff_options(flag("set"), flag("mset"), setkeys, precision)?;
+
+    let diff = lhs.diff(&rhs, &options);
+    let config = RenderConfig::default();
+    let mut renders = serde_json::Map::new();
+    for (name, format) in [
+        ("jd", OutputFormat::Native),
+        ("patch", OutputFormat::Patch),
+        ("merge", OutputFormat::Merge),
+    ] {
+        renders.insert(
+            name.to_string(),
+            render_diff(format, &lhs, &rhs, &diff, &config, ["lhs", "rhs"])?.into(),
+        );
+    }
+    Ok(Value::Object(renders))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn serves_the_index_page() {
+        let response = route("GET", "/", "");
+        assert_eq!(response.status, "200 OK");
+        assert!(response.content_type.starts_with("text/html"));
+        assert!(response.body.contains("fetch(\"/diff\""));
+        assert_eq!(route("GET", "/missing", "").status, "404 Not Found");
+        assert_eq!(route("DELETE", "/diff", "").status, "405 Method Not Allowed");
+    }
+
+    #[test]
+    fn diff_endpoint_returns_every_render() {
+        let response = route("POST", "/diff", r#"{"lhs":"{\"a\":1}","rhs":"{\"a\":2}"}"#);
+        assert_eq!(response.status, "200 OK");
+        let renders: Value = serde_json::from_str(&response.body).unwrap();
+        assert_eq!(
+            renders,
+            json!({
+                "jd": "@ [\"a\"]\n- 1\n+ 2\n",
+                "patch": r#"[{"op":"test","path":"/a","value":1},{"op":"remove","path":"/a","value":1},{"op":"add","path":"/a","value":2}]"#,
+                "merge": r#"{"a":2}"#,
+            })
+        );
+    }
+
+    #[test]
+    fn diff_endpoint_honours_options() {
+        let body = json!({"lhs": "[1,2]", "rhs": "[2,1]", "set": true}).to_string();
+        let renders: Value = serde_json::from_str(&route("POST", "/diff", &body).body).unwrap();
+        assert_eq!(renders["jd"], "");
+        let body = json!({"lhs": "a: 1\n", "rhs": "a: 1\n", "yaml": true}).to_string();
+        let renders: Value = serde_json::from_str(&route("POST", "/diff", &body).body).unwrap();
+        assert_eq!(renders["merge"], "{}");
+    }
+
+    #[test]
+    fn diff_endpoint_reports_errors() {
+        let response = route("POST", "/diff", r#"{"lhs":"{","rhs":"{}"}"#);
+        assert_eq!(response.status, "400 Bad Request");
+        let error: Value = serde_json::from_str(&response.body).unwrap();
+        assert!(error["error"].as_str().unwrap().starts_with("failed to parse first input"));
+        let response = route("POST", "/diff", r#"{"lhs":"1","rhs":"2","precision":"x"}"#);
+        assert!(response.body.contains("precision must be a number"));
+    }
+
+    #[test]
+    fn serves_http_requests() {
+        let listener = TcpListener::bind((Ipv4Addr::LOCALHOST, 0)).unwrap();
+        let address = listener.local_addr().unwrap();
+        std::thread::spawn(move || serve_listener(&listener, IO_DEADLINE));
+
+        let mut stream = TcpStream::connect(address).unwrap();
+        let body = r#"{"lhs":"1","rhs":"2"}"#;
+        write!(stream, "POST /diff HTTP/1.1\r\nContent-Length: {}\r\n\r\n{body}", body.len())
+            .unwrap();
+        let mut response = String::new();
+        stream.read_to_string(&mut response).unwrap();
+        assert!(response.starts_with("HTTP/1.1 200 OK\r\n"));
+        let (_, body) = response.split_once("\r\n\r\n").unwrap();
+        let renders: Value = serde_json::from_str(body).unwrap();
+        assert_eq!(renders["jd"], "@ []\n- 1\n+ 2\n");
+    }
+
+    #[test]
+    fn trickling_clients_hit_the_deadline() {
+        let listener = TcpListener::bind((Ipv4Addr::LOCALHOST, 0)).unwrap();
+        let address = listener.local_addr().unwrap();
+        std::thread::spawn(move || serve_listener(&listener, Duration::from_millis(300)));
+
+        // Sends one header byte at a time, each well inside a per-read timeout.
+        let trickler = TcpStream::connect(address).unwrap();
+        trickler.set_read_timeout(Some(Duration::from_secs(5))).unwrap();
+        let mut writer = trickler.try_clone().unwrap();
+        std::thread::spawn(move || {
+            for byte in b"GET / HTTP/1.1\r\nX-Slow: ".iter().chain([b'a'; 100].iter()) {
+                if writer.write_all(&[*byte]).is_err() {
+                    break;
+                }
+                std::thread::sleep(Duration::from_millis(50));
+            }
+        });
+
+        // Other clients are served while the trickler is still connected.
+        let started = Instant::now();
+        let mut stream = TcpStream::connect(address).unwrap();
+        stream.set_read_timeout(Some(Duration::from_secs(5))).unwrap();
+        write!(stream, "GET / HTTP/1.1\r\n\r\n").unwrap();
+        let mut response = String::new();
+        stream.read_to_string(&mut response).unwrap();
+        assert!(response.starts_with("HTTP/1.1 200 OK\r\n"));
+        assert!(started.elapsed() < Duration::from_millis(300));
+
+        let mut response = String::new();
+        (&trickler).read_to_string(&mut response).unwrap();
+        assert!(response.starts_with("HTTP/1.1 400 Bad Request\r\n"), "{response}");
+        assert!(started.elapsed() < Duration::from_secs(2));
+    }
+}
@@ -20,6 +20,12 @@ struct RenderOutputs {
 struct Fixture {
     lhs: String,
     rhs: String,
+    #[serde(default)]
+    options: Vec<String>,
+    #[serde(default)]
+    format: Option<String>,
+    #[serde(default)]
+    diff: Vec<serde_json::Value>,
     render: RenderOutputs,
 }
 
@@ -37,6 +43,22 @@ fn write_tempfile(contents: &str) -> NamedTempFile {
     file
 }
 
+/// Maps render fixture options onto the equivalent Go-style CLI flags.
+fn fixture_args(fixture: &Fixture) -> Vec<String> {
+    let mut args: Vec<String> = fixture
+        .options
+        .iter()
+        .map(|option| match option.as_str() {
+            "merge" => "-f=merge".to_string(),
+            other => format!("-{other}"),
+        })
+        .collect();
+    if fixture.format.as_deref() == Some("yaml") {
+        args.push("-yaml".to_string());
+    }
+    args
+}
+
 #[test]
 fn help_succeeds() {
     let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
@@ -110,6 +132,42 @@ fn diff_color_output_matches_fixture() {
         .stderr(predicate::str::is_empty());
 }
 
+#[test]
+fn color_always_overrides_no_color() {
+    let fixture = load_fixture("string_diff_color");
+    let expected = fixture.render.native_color.expect("color output available");
+    let lhs = write_tempfile(&fixture.lhs);
+    let rhs = write_tempfile(&fixture.rhs);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.env("NO_COLOR", "1")
+        .arg("--color=always")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(expected);
+}
+
+#[test]
+fn color_auto_and_never_stay_plain_when_piped() {
+    let fixture = load_fixture("string_diff_color");
+    let expected = fixture.render.native.expect("native output available");
+    let lhs = write_tempfile(&fixture.lhs);
+    let rhs = write_tempfile(&fixture.rhs);
+
+    for flag in ["--color=auto", "-color=never", "-color=false"] {
+        let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+        cmd.env_remove("NO_COLOR")
+            .arg(flag)
+            .arg(lhs.path())
+            .arg(rhs.path())
+            .assert()
+            .code(1)
+            .stdout(expected.clone());
+    }
+}
+
 #[test]
 fn diff_single_argument_reads_stdin() {
     let fixture = load_fixture("object_update");
@@ -124,3 +182,1339 @@ fn diff_single_argument_reads_stdin() {
         .stdout(expected)
         .stderr(predicate::str::is_empty());
 }
+
+#[test]
+fn single_dash_reads_both_documents_from_stdin() {
+    let fixture = load_fixture("object_update");
+    let expected = fixture.render.native.expect("native output available");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-")
+        .write_stdin(format!("{}\n{}", fixture.lhs, fixture.rhs))
+        .assert()
+        .code(1)
+        .stdout(expected)
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn dash_input_reads_stdin() {
+    let fixture = load_fixture("object_update");
+    let expected = fixture.render.native.expect("native output available");
+    let rhs = write_tempfile(&fixture.rhs);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-")
+        .arg(rhs.path())
+        .write_stdin(fixture.lhs)
+        .assert()
+        .code(1)
+        .stdout(expected)
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn output_flag_dash_writes_literal_file() {
+    let fixture = load_fixture("object_update");
+    let expected = fixture.render.native.expect("native output available");
+    let dir = tempfile::tempdir().expect("create tempdir");
+    fs::write(dir.path().join("before.json"), &fixture.lhs).expect("write lhs");
+    fs::write(dir.path().join("after.json"), &fixture.rhs).expect("write rhs");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.current_dir(dir.path())
+        .args(["-o", "-", "before.json", "after.json"])
+        .assert()
+        .code(1)
+        .stdout(predicate::str::is_empty());
+    let written = fs::read_to_string(dir.path().join("-")).expect("file named - exists");
+    assert_eq!(written, expected);
+}
+
+#[test]
+fn diff_set_flag_matches_fixture() {
+    let fixture = load_fixture("set_tags");
+    let expected = fixture.render.native.expect("native output available");
+    let lhs = write_tempfile(&fixture.lhs);
+    let rhs = write_tempfile(&fixture.rhs);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-set")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(expected)
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn diff_mset_flag_matches_fixture() {
+    let fixture = load_fixture("multiset_inventory");
+    let expected = fixture.render.native.expect("native output available");
+    let lhs = write_tempfile(&fixture.lhs);
+    let rhs = write_tempfile(&fixture.rhs);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-mset")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(expected)
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn diff_setkeys_flag_matches_fixture() {
+    let fixture = load_fixture("setkeys_users");
+    let expected = fixture.render.native.expect("native output available");
+    let lhs = write_tempfile(&fixture.lhs);
+    let rhs = write_tempfile(&fixture.rhs);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-setkeys=id")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(expected)
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn diff_yaml_flag_matches_fixture() {
+    let fixture = load_fixture("yaml_config");
+    let expected = fixture.render.native.expect("native output available");
+    let lhs = write_tempfile(&fixture.lhs);
+    let rhs = write_tempfile(&fixture.rhs);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-yaml")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(expected)
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn patch_mode_applies_native_diff() {
+    let fixture = load_fixture("object_update");
+    let diff = write_tempfile(&fixture.render.native.expect("native output available"));
+    let base = write_tempfile(&fixture.lhs);
+    let expected: serde_json::Value = serde_json::from_str(&fixture.rhs).expect("rhs parses");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p")
+        .arg(diff.path())
+        .arg(base.path())
+        .assert()
+        .success()
+        .stdout(expected.to_string())
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn patch_mode_applies_json_patch() {
+    let fixture = load_fixture("object_update");
+    let patch = write_tempfile(&fixture.render.patch.expect("patch output available"));
+    let expected: serde_json::Value = serde_json::from_str(&fixture.rhs).expect("rhs parses");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p")
+        .arg("-f=patch")
+        .arg(patch.path())
+        .write_stdin(fixture.lhs)
+        .assert()
+        .success()
+        .stdout(expected.to_string());
+}
+
+#[test]
+fn patch_mode_writes_yaml_with_yaml_flag() {
+    let fixture = load_fixture("yaml_config");
+    let diff = write_tempfile(&fixture.render.native.expect("native output available"));
+    let base = write_tempfile(&fixture.lhs);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p")
+        .arg("-yaml")
+        .arg(diff.path())
+        .arg(base.path())
+        .assert()
+        .success()
+        .stdout(
+            "config:\n  endpoint: https://api.example.com\n  retries: 2\n  timeout: 10s\nname: service\n",
+        )
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn patch_mode_reports_context_mismatch() {
+    let diff = write_tempfile("@ [\"a\"]\n- 1\n+ 2\n");
+    let base = write_tempfile("{\"a\":3}");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p")
+        .arg(diff.path())
+        .arg(base.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("hunk 1 does not apply: found 3 at [a]: expected 1"));
+}
+
+#[test]
+fn translate_mode_converts_native_diff_to_json_patch() {
+    let fixture = load_fixture("object_update");
+    let diff = write_tempfile(&fixture.render.native.expect("native output available"));
+    let expected = fixture.render.patch.expect("patch output available");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-t")
+        .arg("jd2patch")
+        .arg(diff.path())
+        .assert()
+        .success()
+        .stdout(expected)
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn translate_mode_reads_json_patch_from_stdin() {
+    let fixture = load_fixture("object_update");
+    let patch = fixture.render.patch.expect("patch output available");
+    let expected = fixture.render.native.expect("native output available");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-t")
+        .arg("patch2jd")
+        .write_stdin(patch)
+        .assert()
+        .success()
+        .stdout(expected)
+        .stderr(predicate::str::is_empty());
+}
+
+#[test]
+fn translate_mode_rejects_unknown_translations() {
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-t")
+        .arg("jd2xml")
+        .write_stdin("")
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("unsupported translation: \"jd2xml\""));
+}
+
+#[test]
+fn exit_codes_match_go_for_every_render_fixture() {
+    let dir = Path::new(env!("CARGO_MANIFEST_DIR")).join("../jd-core/tests/fixtures/render");
+    let mut entries: Vec<_> = fs::read_dir(dir)
+        .expect("fixture dir readable")
+        .map(|entry| entry.unwrap().path())
+        .collect();
+    entries.sort();
+    for path in entries {
+        let data = fs::read_to_string(&path).expect("fixture readable");
+        let fixture: Fixture = serde_json::from_str(&data).expect("fixture deserializes");
+        let lhs = write_tempfile(&fixture.lhs);
+        let rhs = write_tempfile(&fixture.rhs);
+        let expected = if fixture.diff.is_empty() { 0 } else { 1 };
+
+        let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+        cmd.args(fixture_args(&fixture)).arg(lhs.path()).arg(rhs.path()).assert().code(expected);
+
+        let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+        cmd.args(fixture_args(&fixture)).arg(lhs.path()).arg(lhs.path()).assert().code(0);
+    }
+}
+
+#[test]
+fn identical_inputs_exit_zero_with_no_output() {
+    let input = write_tempfile("{\"a\":[1,2]}");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg(input.path()).arg(input.path()).assert().code(0).stdout("").stderr("");
+}
+
+#[test]
+fn errors_exit_two() {
+    let valid = write_tempfile("{}");
+    let invalid = write_tempfile("{");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg(valid.path())
+        .arg(invalid.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("failed to parse second input"));
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("missing-file.json").arg(valid.path()).assert().code(2);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p").arg("-t=jd2patch").arg(valid.path()).assert().code(2);
+}
+
+#[test]
+fn git_diff_driver_accepts_seven_arguments() {
+    let fixture = load_fixture("object_update");
+    let expected = fixture.render.native.expect("native output available");
+    let lhs = write_tempfile(&fixture.lhs);
+    let rhs = write_tempfile(&fixture.rhs);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-git-diff-driver")
+        .arg("config.json")
+        .arg(lhs.path())
+        .args(["1111111", "100644"])
+        .arg(rhs.path())
+        .args(["2222222", "100644"])
+        .assert()
+        .success()
+        .stdout(expected);
+}
+
+#[test]
+fn git_difftool_accepts_local_and_remote() {
+    let fixture = load_fixture("object_update");
+    let expected = fixture.render.native.expect("native output available");
+    let lhs = write_tempfile(&fixture.lhs);
+    let rhs = write_tempfile(&fixture.rhs);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--git-difftool").arg(lhs.path()).arg(rhs.path()).assert().success().stdout(expected);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--git-difftool")
+        .arg(lhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("expects 2 (difftool) or 7 (diff driver) arguments"));
+}
+
+#[test]
+fn config_file_sets_defaults_until_disabled() {
+    let fixture = load_fixture("object_update");
+    let native = fixture.render.native.expect("native output available");
+    let patch = fixture.render.patch.expect("patch output available");
+    let lhs = write_tempfile(&fixture.lhs);
+    let rhs = write_tempfile(&fixture.rhs);
+    let config_home = tempfile::tempdir().expect("create config dir");
+    fs::create_dir(config_home.path().join("jd")).expect("create jd config dir");
+    fs::write(config_home.path().join("jd/config.toml"), "format = \"patch\"\n")
+        .expect("write config");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.env("XDG_CONFIG_HOME", config_home.path())
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(patch);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.env("XDG_CONFIG_HOME", config_home.path())
+        .arg("-f=jd")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(native.clone());
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.env("XDG_CONFIG_HOME", config_home.path())
+        .arg("--no-config")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(native);
+}
+
+#[test]
+fn watch_mode_requires_two_files() {
+    let input = write_tempfile("{}");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--watch")
+        .arg(input.path())
+        .arg("-")
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("watch mode needs two file arguments"));
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-watch")
+        .arg("-p")
+        .arg(input.path())
+        .arg(input.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("watch mode only applies to diffs"));
+}
+
+#[test]
+fn directory_arguments_diff_files_by_relative_path() {
+    let lhs = tempfile::tempdir().expect("create lhs dir");
+    let rhs = tempfile::tempdir().expect("create rhs dir");
+    fs::create_dir(lhs.path().join("nested")).expect("create nested dir");
+    fs::create_dir(rhs.path().join("nested")).expect("create nested dir");
+    fs::write(lhs.path().join("nested/app.json"), "{\"a\":1}").expect("write file");
+    fs::write(rhs.path().join("nested/app.json"), "{\"a\":2}").expect("write file");
+    fs::write(lhs.path().join("same.json"), "[1]").expect("write file");
+    fs::write(rhs.path().join("same.json"), "[1]").expect("write file");
+    fs::write(lhs.path().join("old.json"), "1").expect("write file");
+    fs::write(rhs.path().join("new.yaml"), "a: 1\n").expect("write file");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg(lhs.path()).arg(rhs.path()).assert().code(1).stdout(
+        "=== nested/app.json\n@ [\"a\"]\n- 1\n+ 2\n\
+         === 1 added, 1 removed, 1 changed\n+ new.yaml\n- old.json\n~ nested/app.json\n",
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg(lhs.path()).arg(lhs.path()).assert().code(0).stdout("");
+}
+
+#[test]
+fn ndjson_mode_diffs_records_by_position_or_key() {
+    let lhs = write_tempfile("{\"id\":1,\"v\":\"a\"}\n{\"id\":2,\"v\":\"b\"}\n");
+    let rhs = write_tempfile("{\"id\":2,\"v\":\"b\"}\n{\"id\":1,\"v\":\"c\"}\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--ndjson-key=id")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [{\"id\":1},\"v\"]\n- \"a\"\n+ \"c\"\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-ndjson").arg(lhs.path()).arg(lhs.path()).assert().code(0).stdout("");
+}
+
+#[test]
+fn documents_mode_pairs_yaml_documents_by_position_or_key() {
+    let lhs = write_tempfile("kind: Service\nport: 80\n---\nkind: Deployment\nreplicas: 1\n");
+    let rhs = write_tempfile("kind: Deployment\nreplicas: 2\n---\nkind: Service\nport: 80\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--documents-key=kind")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [{\"kind\":\"Deployment\"},\"replicas\"]\n- 1\n+ 2\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-documents").arg(lhs.path()).arg(lhs.path()).assert().code(0).stdout("");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--documents")
+        .arg("-p")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("document mode only applies to diffs"));
+}
+
+#[test]
+fn color_theme_comes_from_the_flag_or_environment() {
+    let lhs = write_tempfile("1");
+    let rhs = write_tempfile("2");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-color")
+        .arg("--color-theme=high-contrast")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ []\n\u{1b}[1;91m- 1\n\u{1b}[0m\u{1b}[1;92m+ 2\n\u{1b}[0m");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.env("JD_COLOR_THEME", "colorblind")
+        .arg("-color")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ []\n\u{1b}[38;5;208m- 1\n\u{1b}[0m\u{1b}[38;5;33m+ 2\n\u{1b}[0m");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.env("JD_COLOR_THEME", "neon")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("invalid JD_COLOR_THEME \"neon\""));
+}
+
+#[test]
+fn paths_format_lists_changed_pointers_without_values() {
+    let lhs = write_tempfile(r#"{"user":{"name":"jd","password":"hunter2"},"roles":["admin"]}"#);
+    let rhs =
+        write_tempfile(r#"{"user":{"name":"jd","password":"s3cret"},"roles":["admin","ops"]}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-f=paths")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("/roles/1\n/user/password\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-f=paths")
+        .arg("-set")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("/roles/{}\n/user/password\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-f=paths")
+        .arg("-p")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("path lists cannot be applied with -p"));
+}
+
+#[test]
+fn stat_prints_per_path_counts_and_totals() {
+    let lhs = write_tempfile(r#"{"a":1,"b":[1,2],"c":true}"#);
+    let rhs = write_tempfile(r#"{"a":2,"b":[1,2,3]}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--stat").arg(lhs.path()).arg(rhs.path()).assert().code(1).stdout(
+        " [\"a\"]   | 2 +-\n [\"b\",2] | 1 +\n [\"c\"]   | 1 -\n \
+         3 paths changed, 2 additions(+), 2 removals(-)\n",
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-stat").arg(lhs.path()).arg(lhs.path()).assert().code(0).stdout("");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--stat")
+        .arg("-f=patch")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("--stat cannot be combined with -f"));
+}
+
+#[test]
+fn json_format_writes_and_applies_the_diff_structure() {
+    let lhs = write_tempfile(r#"{"a":1,"b":[1,2]}"#);
+    let rhs = write_tempfile(r#"{"a":2,"b":[1,2]}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    let output = cmd.arg("-f=json").arg(lhs.path()).arg(rhs.path()).output().unwrap();
+    assert_eq!(output.status.code(), Some(1));
+    let diff = String::from_utf8(output.stdout).unwrap();
+    assert_eq!(
+        diff,
+        r#"[{"path":["a"],"remove":[{"type":"Number","value":1}],"add":[{"type":"Number","value":2}]}]"#
+    );
+
+    let patch = write_tempfile(&diff);
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "-f", "json"])
+        .arg(patch.path())
+        .arg(lhs.path())
+        .assert()
+        .code(0)
+        .stdout(r#"{"a":2,"b":[1,2]}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--format", "json"]).arg(lhs.path()).arg(lhs.path()).assert().code(0).stdout("[]");
+}
+
+#[test]
+fn unified_format_writes_a_line_diff_of_pretty_printed_documents() {
+    let lhs = write_tempfile(r#"{"a":1,"b":2}"#);
+    let rhs = write_tempfile(r#"{"b":2,"a":3}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-f", "unified"]).arg(lhs.path()).arg(rhs.path()).assert().code(1).stdout(format!(
+        "--- {}\n+++ {}\n@@ -1,4 +1,4 @@\n {{\n-  \"a\": 1,\n+  \"a\": 3,\n   \"b\": 2\n }}\n",
+        lhs.path().display(),
+        rhs.path().display()
+    ));
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-f", "unified"]).arg(lhs.path()).arg(lhs.path()).assert().code(0).stdout("");
+}
+
+#[test]
+fn stream_flag_diffs_documents_as_they_are_read() {
+    let lhs = write_tempfile(r#"{"a":[1,2,3],"b":{"c":1}}"#);
+    let rhs = write_tempfile(r#"{"a":[1,5],"b":{"c":2}}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--stream")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"a\",1]\n- 2\n+ 5\n@ [\"a\",2]\n- 3\n@ [\"b\",\"c\"]\n- 1\n+ 2\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-stream").arg(lhs.path()).arg(lhs.path()).assert().code(0).stdout("");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--stream", "-f", "patch"]).arg(lhs.path()).arg(rhs.path()).assert().code(2);
+}
+
+#[test]
+fn path_flag_restricts_the_diff_to_a_subtree() {
+    let lhs = write_tempfile(r#"{"spec":{"items":[1,2],"replicas":1},"status":"old"}"#);
+    let rhs = write_tempfile(r#"{"spec":{"items":[0,1,2],"replicas":2},"status":"new"}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--path=$.spec.items")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"spec\",\"items\",0]\n[\n+ 0\n  1\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-f", "merge", "-path=$.spec.replicas"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(r#"{"spec":{"replicas":2}}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-path=$.missing").arg(lhs.path()).arg(rhs.path()).assert().code(0).stdout("");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-path=spec")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("invalid path \"spec\": expected it to start with $"));
+}
+
+#[test]
+fn ignore_flag_excludes_volatile_fields() {
+    let lhs = write_tempfile(r#"{"name":"web","metadata":{"uid":"a","resourceVersion":"1"}}"#);
+    let rhs = write_tempfile(r#"{"name":"api","metadata":{"uid":"b","resourceVersion":"2"}}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--ignore=$.metadata.uid", "-ignore", "$.metadata.resourceVersion"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"name\"]\n- \"web\"\n+ \"api\"\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-ignore=$.metadata", "-ignore=$.name"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(0)
+        .stdout("");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-ignore=metadata")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("invalid path \"metadata\""));
+}
+
+#[test]
+fn path_and_ignore_accept_wildcards_and_descendants() {
+    let lhs =
+        write_tempfile(r#"{"items":[{"uid":"a","n":1},{"uid":"b","n":2}],"meta":{"uid":"c"}}"#);
+    let rhs =
+        write_tempfile(r#"{"items":[{"uid":"x","n":1},{"uid":"y","n":3}],"meta":{"uid":"z"}}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-ignore=$..uid"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"items\",1,\"n\"]\n- 2\n+ 3\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-f", "paths", "--path=$.items[*].uid"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("/items/0/uid\n/items/1/uid\n");
+}
+
+#[test]
+fn exclude_keys_flag_skips_matching_keys() {
+    let lhs = write_tempfile(r#"{"name":"web","_etag":"1","meta":{"created_at":1}}"#);
+    let rhs = write_tempfile(r#"{"name":"api","_rev":"2","meta":{"created_at":2}}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--exclude-keys=^_", "-exclude-keys", "_at$"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"name\"]\n- \"web\"\n+ \"api\"\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-exclude-keys=(")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("invalid key pattern \"(\""));
+}
+
+#[test]
+fn moves_flag_reports_reordered_elements_as_moves() {
+    let lhs = write_tempfile(r#"["a","b","c"]"#);
+    let rhs = write_tempfile(r#"["c","a","b"]"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-moves")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("^ {\"from\":[2]}\n@ [0]\n[\n+ \"c\"\n  \"a\"\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--moves", "-f", "patch"]).arg(lhs.path()).arg(rhs.path()).assert().code(1).stdout(
+        "[{\"op\":\"test\",\"path\":\"/2\",\"value\":\"c\"},\
+             {\"op\":\"move\",\"from\":\"/2\",\"path\":\"/0\"}]",
+    );
+}
+
+#[test]
+fn patience_flag_aligns_lists_around_unique_elements() {
+    let lhs = write_tempfile(r#"["a",{},{}]"#);
+    let rhs = write_tempfile(r#"[{},"b",{},{}]"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-patience")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [0]\n[\n- \"a\"\n+ {}\n+ \"b\"\n  {}\n");
+}
+
+#[test]
+fn similarity_flag_pairs_near_identical_objects() {
+    let lhs = write_tempfile(r#"[{"id":1,"v":"a"},{"id":2,"n":"x","v":"b"}]"#);
+    let rhs = write_tempfile(r#"[{"id":2,"n":"x","v":"c"}]"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-similarity=0.6").arg(lhs.path()).arg(rhs.path()).assert().code(1).stdout(
+        "@ [0]\n[\n- {\"id\":1,\"v\":\"a\"}\n  {\"id\":2,\"n\":\"x\",\"v\":\"b\"}\n\
+             @ [0,\"v\"]\n- \"b\"\n+ \"c\"\n",
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--similarity", "2"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("similarity threshold must be greater than 0"));
+}
+
+#[test]
+fn typed_numbers_flag_tells_integers_from_floats() {
+    let lhs = write_tempfile(r#"{"replicas":1,"ratio":0.5}"#);
+    let rhs = write_tempfile(r#"{"replicas":1.0,"ratio":0.5}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg(lhs.path()).arg(rhs.path()).assert().code(0).stdout("");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-typed-numbers")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"replicas\"]\n- 1\n+ 1.0\n");
+}
+
+#[test]
+fn keep_order_flag_writes_patched_keys_in_document_order() {
+    let patch = write_tempfile("@ [\"version\"]\n- 1\n+ 2\n@ [\"id\"]\n+ 3\n");
+    let target = write_tempfile(r#"{"version":1,"name":"jd","deps":{"z":1,"a":2}}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "--keep-order"])
+        .arg(patch.path())
+        .arg(target.path())
+        .assert()
+        .code(0)
+        .stdout(r#"{"version":2,"name":"jd","deps":{"z":1,"a":2},"id":3}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p")
+        .arg(patch.path())
+        .arg(target.path())
+        .assert()
+        .code(0)
+        .stdout(r#"{"deps":{"a":2,"z":1},"id":3,"name":"jd","version":2}"#);
+}
+
+#[test]
+fn duplicate_keys_flag_selects_the_policy() {
+    let lhs = write_tempfile(r#"{"a":1,"a":2}"#);
+    let rhs = write_tempfile(r#"{"a":3}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg(lhs.path()).arg(rhs.path()).assert().code(1).stdout("@ [\"a\"]\n- 2\n+ 3\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-duplicate-keys=first")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"a\"]\n- 1\n+ 3\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--duplicate-keys", "error"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("duplicate key \"a\""));
+}
+
+#[test]
+fn jsonc_flag_accepts_comments_and_trailing_commas() {
+    let lhs = write_tempfile("{\n  // compiler options\n  \"strict\": false, /* for now */\n}\n");
+    let rhs = write_tempfile(r#"{"strict":true}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg(lhs.path()).arg(rhs.path()).assert().code(2);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-jsonc")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"strict\"]\n- false\n+ true\n");
+}
+
+#[cfg(feature = "cbor")]
+#[test]
+fn cbor_flag_diffs_and_patches_binary_documents() {
+    let write_bytes = |bytes: &[u8]| {
+        let mut file = NamedTempFile::new().expect("create tempfile");
+        file.write_all(bytes).expect("write tempfile");
+        file
+    };
+    // {"id": 7, "raw": h'beef'} and {"id": 8, "raw": h'beee'}
+    let lhs =
+        write_bytes(&[0xa2, 0x62, b'i', b'd', 0x07, 0x63, b'r', b'a', b'w', 0x42, 0xbe, 0xef]);
+    let rhs = [0xa2, 0x62, b'i', b'd', 0x08, 0x63, b'r', b'a', b'w', 0x42, 0xbe, 0xee];
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    let diff = cmd
+        .arg("-cbor")
+        .arg(lhs.path())
+        .arg(write_bytes(&rhs).path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"id\"]\n- 7\n+ 8\n@ [\"raw\",\"$bytes\"]\n- \"beef\"\n+ \"beee\"\n")
+        .get_output()
+        .stdout
+        .clone();
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-cbor")
+        .arg("-p")
+        .arg(write_bytes(&diff).path())
+        .arg(lhs.path())
+        .assert()
+        .success()
+        .stdout(rhs.to_vec());
+}
+
+#[cfg(not(feature = "cbor"))]
+#[test]
+fn cbor_flag_requires_the_cbor_feature() {
+    let lhs = write_tempfile("{}");
+    let rhs = write_tempfile("{}");
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--cbor")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("rebuild jd with `--features cbor`"));
+}
+
+#[cfg(feature = "msgpack")]
+#[test]
+fn msgpack_flag_keeps_str_and_bin_apart() {
+    let write_bytes = |bytes: &[u8]| {
+        let mut file = NamedTempFile::new().expect("create tempfile");
+        file.write_all(bytes).expect("write tempfile");
+        file
+    };
+    // {"token": str "abc"} and {"token": bin "abc"}
+    let lhs = write_bytes(&[0x81, 0xa5, b't', b'o', b'k', b'e', b'n', 0xa3, b'a', b'b', b'c']);
+    let rhs = [0x81, 0xa5, b't', b'o', b'k', b'e', b'n', 0xc4, 0x03, b'a', b'b', b'c'];
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    let diff = cmd
+        .arg("-msgpack")
+        .arg(lhs.path())
+        .arg(write_bytes(&rhs).path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"token\"]\n- \"abc\"\n+ {\"$bytes\":\"616263\"}\n")
+        .get_output()
+        .stdout
+        .clone();
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-msgpack")
+        .arg("-p")
+        .arg(write_bytes(&diff).path())
+        .arg(lhs.path())
+        .assert()
+        .success()
+        .stdout(rhs.to_vec());
+}
+
+#[cfg(not(feature = "msgpack"))]
+#[test]
+fn msgpack_flag_requires_the_msgpack_feature() {
+    let lhs = write_tempfile("{}");
+    let rhs = write_tempfile("{}");
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--msgpack")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("rebuild jd with `--features msgpack`"));
+}
+
+#[test]
+fn strategic_flag_pairs_kubernetes_lists_by_merge_key() {
+    let lhs = write_tempfile(
+        r#"{"spec":{"containers":[{"name":"app","image":"app:1"},{"name":"proxy","image":"proxy:1"}]}}"#,
+    );
+    let rhs = write_tempfile(
+        r#"{"spec":{"containers":[{"name":"proxy","image":"proxy:1"},{"name":"app","image":"app:2"}]}}"#,
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--strategic").arg(lhs.path()).arg(rhs.path()).assert().code(1).stdout(
+        "@ [\"spec\",\"containers\",{\"name\":\"app\"},\"image\"]\n- \"app:1\"\n+ \"app:2\"\n",
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--strategic", "-f", "merge"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("cannot express strategic merge patches"));
+}
+
+#[test]
+fn strategic_flag_applies_strategic_merge_patches() {
+    let patch = write_tempfile(r#"{"spec":{"containers":[{"name":"app","image":"app:2"}]}}"#);
+    let target = write_tempfile(
+        r#"{"spec":{"containers":[{"name":"app","image":"app:1"},{"name":"proxy","image":"proxy:1"}]}}"#,
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "-f", "merge", "--strategic"])
+        .arg(patch.path())
+        .arg(target.path())
+        .assert()
+        .code(0)
+        .stdout(
+            r#"{"spec":{"containers":[{"image":"app:2","name":"app"},{"image":"proxy:1","name":"proxy"}]}}"#,
+        );
+}
+
+#[test]
+fn terraform_preset_ignores_volatile_fields_and_summarizes_resources() {
+    let lhs = write_tempfile(
+        r#"{"timestamp":"2024-05-01T00:00:00Z","resource_changes":[{"address":"aws_instance.web","change":{"after":{"ami":"ami-1"}}},{"address":"aws_s3_bucket.logs"}]}"#,
+    );
+    let rhs = write_tempfile(
+        r#"{"timestamp":"2024-05-02T00:00:00Z","resource_changes":[{"address":"aws_iam_role.ci"},{"address":"aws_instance.web","change":{"after":{"ami":"ami-2"}}}]}"#,
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-preset", "terraform", "-summary"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(concat!(
+            "~ aws_instance.web (1 path)\n",
+            "- aws_s3_bucket.logs\n",
+            "+ aws_iam_role.ci\n",
+            "3 changed: 1 added, 1 removed, 1 modified\n",
+        ));
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--summary")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("--summary requires --preset"));
+}
+
+#[test]
+fn openapi_preset_summary_marks_breaking_changes() {
+    let lhs = write_tempfile(
+        r#"{"paths":{"/pets":{"get":{"summary":"List","parameters":[{"name":"limit","in":"query"}]},"delete":{}}}}"#,
+    );
+    let rhs = write_tempfile(
+        r#"{"paths":{"/pets":{"get":{"summary":"List pets","parameters":[{"name":"limit","in":"query"}]},"post":{}}}}"#,
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--preset=openapi", "--summary"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(concat!(
+            "- DELETE /pets (breaking)\n",
+            "~ GET /pets (1 path)\n",
+            "+ POST /pets\n",
+            "3 changed: 1 added, 1 removed, 1 modified; 1 breaking\n",
+        ));
+}
+
+#[test]
+fn schema_flag_rejects_invalid_inputs_and_patch_results() {
+    let schema = write_tempfile(
+        r#"{"type":"object","properties":{"replicas":{"type":"integer","minimum":1}}}"#,
+    );
+    let lhs = write_tempfile(r#"{"replicas":1}"#);
+    let rhs = write_tempfile(r#"{"replicas":"3"}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--schema").arg(schema.path()).arg(lhs.path()).arg(rhs.path()).assert().code(2).stderr(
+        predicate::str::contains(concat!(
+            "the second input does not match the schema:\n",
+            "  [\"replicas\"]: expected integer, found string (at #/properties/replicas/type)",
+        )),
+    );
+
+    let patch = write_tempfile("@ [\"replicas\"]\n- 1\n+ 0\n");
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p")
+        .arg("--schema")
+        .arg(schema.path())
+        .arg(patch.path())
+        .arg(lhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("the patched document does not match the schema:"));
+}
+
+#[test]
+fn dry_run_reports_each_hunk_without_patching() {
+    let patch = write_tempfile("@ [\"a\"]\n- 1\n+ 2\n@ [\"b\",1]\n- 2\n+ 3\n");
+    let clean = write_tempfile(r#"{"a":1,"b":[1,2]}"#);
+    let drifted = write_tempfile(r#"{"a":5,"b":[1,2]}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "--dry-run"])
+        .arg(patch.path())
+        .arg(clean.path())
+        .assert()
+        .success()
+        .stdout("ok @ [\"a\"]\nok @ [\"b\",1]\n2 hunks checked\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "--dry-run"]).arg(patch.path()).arg(drifted.path()).assert().code(1).stdout(
+        concat!(
+            "conflict @ [\"a\"]: found 5 at [a]: expected 1\n",
+            "ok @ [\"b\",1]\n",
+            "2 hunks checked, 1 conflict\n",
+        ),
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--dry-run")
+        .arg(clean.path())
+        .arg(drifted.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("--dry-run requires -p"));
+}
+
+#[test]
+fn strictness_flag_relaxes_patch_matching() {
+    let patch = write_tempfile("@ [\"spec\",\"replicas\"]\n- 1\n+ 2\n");
+    let drifted = write_tempfile(r#"{"spec":{"replicas":3}}"#);
+    let empty = write_tempfile("{}");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p").arg(patch.path()).arg(drifted.path()).assert().code(2);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "--strictness=lenient"])
+        .arg(patch.path())
+        .arg(drifted.path())
+        .assert()
+        .success()
+        .stdout(r#"{"spec":{"replicas":2}}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "--strictness=lenient"]).arg(patch.path()).arg(empty.path()).assert().code(2);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "-strictness", "force"])
+        .arg(patch.path())
+        .arg(empty.path())
+        .assert()
+        .success()
+        .stdout(r#"{"spec":{"replicas":2}}"#);
+}
+
+#[test]
+fn fuzz_flag_applies_shifted_list_hunks() {
+    let patch = write_tempfile("@ [\"steps\",2]\n  \"build\"\n+ \"lint\"\n  \"test\"\n");
+    let drifted =
+        write_tempfile(r#"{"steps":["setup","cache","checkout","build","test","deploy"]}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p").arg(patch.path()).arg(drifted.path()).assert().code(2).stderr(
+        predicate::str::contains("invalid patch. expected \"build\" before. got \"cache\""),
+    );
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "--fuzz=2"])
+        .arg(patch.path())
+        .arg(drifted.path())
+        .assert()
+        .success()
+        .stdout(r#"{"steps":["setup","cache","checkout","build","lint","test","deploy"]}"#)
+        .stderr("applied hunk 1 @ [\"steps\",2] at offset +2\n");
+}
+
+#[test]
+fn rejects_flag_applies_fitting_hunks_and_writes_the_rest() {
+    let patch = write_tempfile("@ [\"a\"]\n- 1\n+ 2\n@ [\"b\"]\n- 1\n+ 2\n");
+    let drifted = write_tempfile(r#"{"a":5,"b":1}"#);
+    let dir = tempfile::tempdir().expect("create tempdir");
+    let rejects = dir.path().join("patch.rej");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p")
+        .arg("--rejects")
+        .arg(&rejects)
+        .arg(patch.path())
+        .arg(drifted.path())
+        .assert()
+        .code(1)
+        .stdout(r#"{"a":5,"b":2}"#)
+        .stderr(predicate::str::contains("1 of 2 hunks rejected"));
+    assert_eq!(fs::read_to_string(&rejects).unwrap(), "@ [\"a\"]\n- 1\n+ 2\n");
+}
+
+#[test]
+fn jd1_format_writes_and_applies_v1_diffs() {
+    let lhs = write_tempfile(r#"{"tags":["a","b","c"]}"#);
+    let rhs = write_tempfile(r#"{"tags":["a","x","c"]}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-f", "jd1"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [\"tags\",1]\n- \"b\"\n+ \"x\"\n");
+
+    let archived = write_tempfile("@ [\"tags\",1]\n- \"b\"\n+ \"x\"\n");
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "-f=jd1"])
+        .arg(archived.path())
+        .arg(lhs.path())
+        .assert()
+        .success()
+        .stdout(r#"{"tags":["a","x","c"]}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-t", "jd12jd"])
+        .arg(archived.path())
+        .assert()
+        .success()
+        .stdout("@ [\"tags\",1]\n- \"b\"\n+ \"x\"\n");
+}
+
+#[test]
+fn jd1_format_writes_merge_paths_and_rejects_v2_headers() {
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-t", "jd2jd1"])
+        .write_stdin("^ {\"Merge\":true}\n@ [\"a\"]\n+\n")
+        .assert()
+        .success()
+        .stdout("@ [[\"MERGE\"],\"a\"]\n+\n");
+
+    let diff = write_tempfile("^ \"SET\"\n@ [\"tags\",{}]\n- \"b\"\n");
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "-f", "jd1"])
+        .arg(diff.path())
+        .write_stdin(r#"{"tags":["b"]}"#)
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("unexpected '^'. expecting one of \"@\""));
+}
+
+#[test]
+fn option_headers_make_patches_self_describing() {
+    let lhs = write_tempfile(r#"{"rate":0.5}"#);
+    let rhs = write_tempfile(r#"{"rate":0.7}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--option-headers", "-precision=0.001"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("^ {\"precision\":0.001}\n@ [\"rate\"]\n- 0.5\n+ 0.7\n");
+
+    // The header lets the removal match a value within the tolerance
+    // without passing -precision again.
+    let diff = write_tempfile("^ {\"precision\":0.001}\n@ [\"rate\"]\n- 0.5\n+ 0.7\n");
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p")
+        .arg(diff.path())
+        .write_stdin(r#"{"rate":0.5004}"#)
+        .assert()
+        .success()
+        .stdout(r#"{"rate":0.7}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--option-headers", "-f", "patch"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("--option-headers only applies to jd diffs"));
+}
+
+#[test]
+fn context_sets_list_context_size() {
+    let lhs = write_tempfile("[1,2,3,4,5]");
+    let rhs = write_tempfile("[1,2,3,9,5]");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-context=3")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [3]\n  1\n  2\n  3\n- 4\n+ 9\n  5\n]\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--context", "0"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout("@ [3]\n- 4\n+ 9\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--context=2", "-f", "patch"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("JSON Patch records at most one element of context"));
+}
+
+#[test]
+fn context_mismatch_warns_and_applies() {
+    let patch = write_tempfile("@ [1]\n  \"a\"\n- \"b\"\n+ \"B\"\n  \"c\"\n");
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("-p")
+        .arg(patch.path())
+        .write_stdin(r#"["x","b","d"]"#)
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("expected \"a\" before. got \"x\""));
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "--context-mismatch=warn"])
+        .arg(patch.path())
+        .write_stdin(r#"["x","b","d"]"#)
+        .assert()
+        .success()
+        .stdout(r#"["x","B","d"]"#)
+        .stderr(concat!(
+            "warning: hunk 1: invalid patch. expected \"a\" before. got \"x\"\n",
+            "warning: hunk 1: invalid patch. expected \"c\" after. got \"d\"\n",
+        ));
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-p", "-context-mismatch", "ignore"])
+        .arg(patch.path())
+        .write_stdin(r#"["x","b","d"]"#)
+        .assert()
+        .success()
+        .stdout(r#"["x","B","d"]"#)
+        .stderr("");
+}
+
+#[test]
+fn string_diff_line_shows_only_changed_lines() {
+    let lhs = write_tempfile(r#"{"a":"x y","s":"one\ntwo\nthree\n"}"#);
+    let rhs = write_tempfile(r#"{"a":"x z","s":"one\n2\nthree\nfour\n"}"#);
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["--string-diff", "line:$.s"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(1)
+        .stdout(concat!(
+            "@ [\"a\"]\n- \"x y\"\n+ \"x z\"\n",
+            "@ [\"s\"]\n@@ -2 +2 @@\n- \"two\\n\"\n+ \"2\\n\"\n@@ -3,0 +4 @@\n+ \"four\\n\"\n",
+        ));
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.args(["-string-diff=line", "-f", "patch"])
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("--string-diff only applies to jd diffs"));
+
+    let mut cmd = Command::cargo_bin("jd").expect("binary jd should be built");
+    cmd.arg("--string-diff=para")
+        .arg(lhs.path())
+        .arg(rhs.path())
+        .assert()
+        .code(2)
+        .stderr(predicate::str::contains("unknown string diff mode \"para\""));
+}
@@ -0,0 +1,227 @@
+//! Runs every upstream parity scenario through both jd-rs and the Go `jd`
+//! binary named by `JD_GO_BIN`, with the same arguments, stdin, and inputs,
+//! and fails on any difference in stdout, stderr, exit status, or written
+//! files that `docs/parity/go-allowlist.txt` does not list. Without
+//! `JD_GO_BIN` set that test passes without running anything. The error
+//! scenarios are also checked against the stderr and exit status captured
+//! from Go `jd` by `scripts/capture_go_errors.sh`, which needs no Go binary.
+
+use std::collections::{BTreeMap, BTreeSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process::{Command, Output};
+
+const GO_BINARY_VAR: &str = "JD_GO_BIN";
+
+/// The binary path the recorded commands use.
+const PLACEHOLDER: &str = "/tmp/jd";
+
+fn repo_root() -> PathBuf {
+    Path::new(env!("CARGO_MANIFEST_DIR")).join("../..")
+}
+
+/// Returns the scenario directories of the parity dataset, in name order.
+fn scenarios() -> Vec<PathBuf> {
+    let dataset = repo_root().join("docs/parity/upstream/jd-v2.2.2");
+    let mut scenarios: Vec<PathBuf> = fs::read_dir(&dataset)
+        .expect("parity dataset readable")
+        .map(|entry| entry.expect("dataset entry").path())
+        .filter(|path| path.join("command.txt").is_file())
+        .collect();
+    scenarios.sort();
+    scenarios
+}
+
+/// Parses the allowlist into the set of (scenario, stream) pairs allowed to
+/// differ.
+fn allowlist() -> BTreeSet<(String, String)> {
+    let text = fs::read_to_string(repo_root().join("docs/parity/go-allowlist.txt"))
+        .expect("allowlist readable");
+    text.lines()
+        .map(str::trim)
+        .filter(|line| !line.is_empty() && !line.starts_with('#'))
+        .map(|line| {
+            let mut fields = line.split_whitespace();
+            match (fields.next(), fields.next(), fields.next()) {
+                (Some(scenario), Some(stream), Some(_reason)) => {
+                    (scenario.to_string(), stream.to_string())
+                }
+                _ => panic!("allowlist entry needs a scenario, stream, and reason: {line}"),
+            }
+        })
+        .collect()
+}
+
+/// Parses `docs/parity/error-mappings.txt` into the text jd-rs's stderr must
+/// contain for each error scenario it words differently from Go `jd`.
+fn error_mappings() -> BTreeMap<String, String> {
+    let text = fs::read_to_string(repo_root().join("docs/parity/error-mappings.txt"))
+        .expect("error mappings readable");
+    text.lines()
+        .map(str::trim)
+        .filter(|line| !line.is_empty() && !line.starts_with('#'))
+        .map(|line| match line.split_once(char::is_whitespace) {
+            Some((scenario, text)) => (scenario.to_string(), text.trim_start().to_string()),
+            None => panic!("error mapping needs a scenario and text: {line}"),
+        })
+        .collect()
+}
+
+/// What one binary did with a scenario.
+struct Run {
+    output: Output,
+    files: BTreeMap<String, Vec<u8>>,
+}
+
+/// Runs the scenario's command with `binary` in place of [`PLACEHOLDER`]
+/// from a fresh copy of the scenario directory.
+fn run(scenario: &Path, binary: &str) -> Run {
+    let command: String = fs::read_to_string(scenario.join("command.txt"))
+        .expect("command.txt readable")
+        .lines()
+        .filter(|line| !line.trim_start().starts_with('#'))
+        .collect::<Vec<_>>()
+        .join("\n")
+        .replace(PLACEHOLDER, binary);
+
+    let workdir = tempfile::tempdir().expect("create workdir");
+    let config = tempfile::tempdir().expect("create config dir");
+    for (name, contents) in files(scenario) {
+        fs::write(workdir.path().join(name), contents).expect("copy scenario input");
+    }
+    let output = Command::new("bash")
+        .arg("-c")
+        .arg(&command)
+        .current_dir(workdir.path())
+        // Keep a developer's ~/.config/jd/config.toml out of the comparison.
+        .env("XDG_CONFIG_HOME", config.path())
+        .env_remove("NO_COLOR")
+        .env_remove("JD_COLOR_THEME")
+        .output()
+        .expect("run scenario command");
+    Run { output, files: files(workdir.path()) }
+}
+
+/// Reads the regular files of `dir` by name.
+fn files(dir: &Path) -> BTreeMap<String, Vec<u8>> {
+    fs::read_dir(dir)
+        .expect("directory readable")
+        .map(|entry| entry.expect("directory entry").path())
+        .filter(|path| path.is_file())
+        .map(|path| {
+            let name = path.file_name().expect("file name").to_string_lossy().into_owned();
+            let contents = fs::read(&path).expect("file readable");
+            (name, contents)
+        })
+        .collect()
+}
+
+/// Lists each stream on which the two runs differ, with both sides.
+fn differences(rust: &Run, go: &Run) -> Vec<(String, String)> {
+    let mut differences = Vec::new();
+    let mut compare = |stream: &str, rust: Option<&[u8]>, go: Option<&[u8]>| {
+        if rust != go {
+            let show = |bytes: Option<&[u8]>| {
+                bytes.map_or("<missing>".to_string(), |b| {
+                    format!("{:?}", String::from_utf8_lossy(b))
+                })
+            };
+            differences.push((
+                stream.to_string(),
+                format!("  jd-rs: {}\n  Go jd: {}", show(rust), show(go)),
+            ));
+        }
+    };
+    compare("stdout", Some(&rust.output.stdout), Some(&go.output.stdout));
+    compare("stderr", Some(&rust.output.stderr), Some(&go.output.stderr));
+    let (rust_code, go_code) =
+        (format!("{:?}", rust.output.status.code()), format!("{:?}", go.output.status.code()));
+    compare("exit", Some(rust_code.as_bytes()), Some(go_code.as_bytes()));
+    let names: BTreeSet<&String> = rust.files.keys().chain(go.files.keys()).collect();
+    for name in names {
+        compare(
+            name,
+            rust.files.get(name).map(Vec::as_slice),
+            go.files.get(name).map(Vec::as_slice),
+        );
+    }
+    differences
+}
+
+#[test]
+fn scenarios_match_go_jd() {
+    let Ok(go_binary) = std::env::var(GO_BINARY_VAR) else {
+        eprintln!("{GO_BINARY_VAR} is not set; skipping the Go jd comparison");
+        return;
+    };
+    let allowed = allowlist();
+    let mut failures = Vec::new();
+    for scenario in scenarios() {
+        let name = scenario.file_name().expect("scenario name").to_string_lossy().into_owned();
+        let rust = run(&scenario, env!("CARGO_BIN_EXE_jd"));
+        let go = run(&scenario, &go_binary);
+        for (stream, detail) in differences(&rust, &go) {
+            if !allowed.contains(&(name.clone(), stream.clone())) {
+                failures.push(format!("{name}: {stream} differs\n{detail}"));
+            }
+        }
+    }
+    assert!(failures.is_empty(), "jd-rs differs from Go jd:\n{}", failures.join("\n"));
+}
+
+#[test]
+fn error_scenarios_match_go_captures() {
+    let mappings = error_mappings();
+    let mut failures = Vec::new();
+    let mut captured = 0;
+    for scenario in scenarios() {
+        let Ok(expected_stderr) = fs::read_to_string(scenario.join("stderr.txt")) else {
+            continue;
+        };
+        captured += 1;
+        let name = scenario.file_name().expect("scenario name").to_string_lossy().into_owned();
+        let expected_code: i32 = fs::read_to_string(scenario.join("exit_code.txt"))
+            .expect("exit_code.txt readable")
+            .trim()
+            .parse()
+            .expect("exit_code.txt holds a status");
+        let rust = run(&scenario, env!("CARGO_BIN_EXE_jd"));
+        let stderr = String::from_utf8_lossy(&rust.output.stderr);
+        if rust.output.status.code() != Some(expected_code) {
+            failures.push(format!(
+                "{name}: expected exit {expected_code}, got {:?}",
+                rust.output.status.code()
+            ));
+        }
+        match mappings.get(&name) {
+            Some(text) if !stderr.contains(text.as_str()) => {
+                failures.push(format!("{name}: stderr lacks {text:?}\n  jd-rs: {stderr:?}"));
+            }
+            Some(_) => {}
+            None if stderr != expected_stderr => failures.push(format!(
+                "{name}: stderr differs\n  jd-rs: {stderr:?}\n  Go jd: {expected_stderr:?}"
+            )),
+            None => {}
+        }
+    }
+    assert!(captured > 0, "no captured error scenarios; run scripts/capture_go_errors.sh");
+    for scenario in mappings.keys() {
+        assert!(
+            scenarios().iter().any(|path| path.ends_with(scenario)),
+            "error mapping names a missing scenario: {scenario}"
+        );
+    }
+    assert!(failures.is_empty(), "jd-rs differs from the Go captures:\n{}", failures.join("\n"));
+}
+
+#[test]
+fn allowlist_entries_are_well_formed() {
+    // Parsed here as well so a malformed entry fails without Go jd at hand.
+    for (scenario, stream) in allowlist() {
+        assert!(!scenario.contains('/'), "allowlist scenario must be a directory name: {scenario}");
+        assert!(
+            !stream.contains('/'),
+            "allowlist stream must be stdout, stderr, exit, or a file name: {stream}"
+        );
+    }
+}
@@ -0,0 +1,267 @@
+//! Reading and editing [`Node`]s in place by [`Path`].
+//!
+//! Key segments address object members and index segments list elements;
+//! an index of `-1`, or one equal to the list length, addresses the slot
+//! just past the end. Set and multiset segments name no single value and
+//! are rejected.
+
+use alloc::collections::BTreeMap;
+
+use crate::prelude::*;
+use crate::{Node, Path, PathError, PathSegment};
+
+impl Node {
+    /// Returns the value at `path`, or `None` when nothing is there.
+    ///
+    /// ```
+    /// # use jd_core::{Node, Path, PathSegment};
+    /// let doc = Node::from_json_str(r#"{"a":[1,{"b":true}]}"#).unwrap();
+    /// let path = Path::from(vec![PathSegment::key("a"), PathSegment::index(1), PathSegment::key("b")]);
+    /// assert_eq!(doc.get(&path), Some(&Node::Bool(true)));
+    /// assert_eq!(doc.get(&path.drop_last().with_segment(PathSegment::key("c"))), None);
+    /// ```
+    #[must_use]
+    pub fn get(&self, path: &Path) -> Option<&Node> {
+        let mut node = self;
+        for segment in path {
+            node = match (node, segment) {
+                (Node::Object(map), PathSegment::Key(key)) => map.get(key)?,
+                (Node::Array(items), PathSegment::Index(index)) => {
+                    items.get(usize::try_from(*index).ok()?)?
+                }
+                _ => return None,
+            };
+        }
+        Some(node).filter(|node| !matches!(node, Node::Void))
+    }
+
+    /// Returns a mutable reference to the value at `path`, or `None` when
+    /// nothing is there.
+    ///
+    /// ```
+    /// # use jd_core::{Node, Path, PathSegment};
+    /// let mut doc = Node::from_json_str(r#"{"a":1}"#).unwrap();
+    /// *doc.get_mut(&Path::from(PathSegment::key("a"))).unwrap() = Node::Null;
+    /// assert_eq!(doc, Node::from_json_str(r#"{"a":null}"#).unwrap());
+    /// ```
+    #[must_use]
+    pub fn get_mut(&mut self, path: &Path) -> Option<&mut Node> {
+        let mut node = self;
+        for segment in path {
+            node = match (node, segment) {
+                (Node::Object(map), PathSegment::Key(key)) => map.get_mut(key)?,
+                (Node::Array(items), PathSegment::Index(index)) => {
+                    items.get_mut(usize::try_from(*index).ok()?)?
+                }
+                _ => return None,
+            };
+        }
+        Some(node).filter(|node| !matches!(node, Node::Void))
+    }
+
+    /// Stores `value` at `path`, returning the value it replaced.
+    ///
+    /// Missing objects and lists along the way are created: a key segment
+    /// creates an object and an index segment a list, whose index must
+    /// then be `0` or `-1`. An index past the end of an existing list
+    /// appends when it equals the length. On error the node is unchanged.
+    /// Storing [`Node::Void`] removes the value instead, like
+    /// [`Node::remove`].
+    ///
+    /// ```
+    /// # use jd_core::{Node, Path, PathSegment};
+    /// let mut doc = Node::from_json_str("{}").unwrap();
+    /// let path = Path::from(vec![PathSegment::key("spec"), PathSegment::key("tags"), PathSegment::index(-1)]);
+    /// assert_eq!(doc.set(&path, Node::String("web".to_string())).unwrap(), None);
+    /// assert_eq!(doc, Node::from_json_str(r#"{"spec":{"tags":["web"]}}"#).unwrap());
+    ///
+    /// let err = doc.set(&Path::from(vec![PathSegment::key("spec"), PathSegment::index(0)]), Node::Null);
+    /// assert_eq!(err.unwrap_err().to_string(), r#"found an object at ["spec"]: expected a list"#);
+    /// ```
+    pub fn set(&mut self, path: &Path, value: Node) -> Result<Option<Node>, PathError> {
+        check_settable(self, path)?;
+        if matches!(value, Node::Void) {
+            return Ok(self.remove(path));
+        }
+        let mut node = self;
+        for segment in path {
+            node = slot(node, segment);
+        }
+        let previous = core::mem::replace(node, value);
+        Ok(Some(previous).filter(|node| !matches!(node, Node::Void)))
+    }
+
+    /// Removes and returns the value at `path`, or returns `None` when
+    /// nothing is there. Later list elements shift down; removing the root
+    /// leaves [`Node::Void`].
+    ///
+    /// ```
+    /// # use jd_core::{Node, Path, PathSegment};
+    /// let mut doc = Node::from_json_str(r#"{"a":[1,2,3]}"#).unwrap();
+    /// let path = Path::from(vec![PathSegment::key("a"), PathSegment::index(0)]);
+    /// assert_eq!(doc.remove(&path), Some(Node::from_json_str("1").unwrap()));
+    /// assert_eq!(doc, Node::from_json_str(r#"{"a":[2,3]}"#).unwrap());
+    /// ```
+    pub fn remove(&mut self, path: &Path) -> Option<Node> {
+        let Some((last, parents)) = path.segments().split_last() else {
+            let previous = core::mem::replace(self, Node::Void);
+            return Some(previous).filter(|node| !matches!(node, Node::Void));
+        };
+        match (self.get_mut(&Path::from(parents.to_vec()))?, last) {
+            (Node::Object(map), PathSegment::Key(key)) => map.remove(key),
+            (Node::Array(items), PathSegment::Index(index)) => {
+                let index = usize::try_from(*index).ok().filter(|index| *index < items.len())?;
+                Some(items.remove(index))
+            }
+            _ => None,
+        }
+    }
+}
+
+/// Walks `path` without changing anything, reporting the first segment
+/// [`Node::set`] could not follow or create.
+fn check_settable(root: &Node, path: &Path) -> Result<(), PathError> {
+    let mut current = Some(root).filter(|node| !matches!(node, Node::Void));
+    for (depth, segment) in path.segments().iter().enumerate() {
+        let at = || path_json(&path.segments()[..depth]);
+        if matches!(segment, PathSegment::Set | PathSegment::MultiSet | PathSegment::SetKeys(_)) {
+            return Err(PathError::UnsupportedSegment { segment: segment.to_string() });
+        }
+        current = match (current, segment) {
+            (Some(Node::Object(map)), PathSegment::Key(key)) => map.get(key),
+            (Some(Node::Array(items)), PathSegment::Index(index)) => {
+                let position = usize::try_from(*index).ok();
+                match position {
+                    Some(position) if position < items.len() => Some(&items[position]),
+                    Some(position) if position == items.len() => None,
+                    None if *index == -1 => None,
+                    _ => {
+                        return Err(PathError::IndexOutOfRange {
+                            path: at(),
+                            index: *index,
+                            len: items.len(),
+                        })
+                    }
+                }
+            }
+            (Some(node), _) => {
+                let expected =
+                    if matches!(segment, PathSegment::Key(_)) { "an object" } else { "a list" };
+                return Err(PathError::Mismatch { path: at(), found: describe(node), expected });
+            }
+            (None, PathSegment::Index(index)) if !matches!(index, 0 | -1) => {
+                return Err(PathError::IndexOutOfRange { path: at(), index: *index, len: 0 });
+            }
+            (None, _) => None,
+        };
+    }
+    Ok(())
+}
+
+/// Returns the child of `node` at `segment`, creating it, and `node` itself
+/// when void, as needed. The path must have passed [`check_settable`].
+fn slot<'a>(node: &'a mut Node, segment: &PathSegment) -> &'a mut Node {
+    if matches!(node, Node::Void) {
+        *node = match segment {
+            PathSegment::Index(_) => Node::Array(Vec::new()),
+            _ => Node::Object(BTreeMap::new()),
+        };
+    }
+    match (node, segment) {
+        (Node::Object(map), PathSegment::Key(key)) => map.entry(key.clone()).or_insert(Node::Void),
+        (Node::Array(items), PathSegment::Index(index)) => {
+            let position = usize::try_from(*index).unwrap_or(items.len());
+            if position == items.len() {
+                items.push(Node::Void);
+            }
+            &mut items[position]
+        }
+        (node, _) => node,
+    }
+}
+
+fn describe(node: &Node) -> &'static str {
+    match node {
+        Node::Void => "nothing",
+        Node::Null => "null",
+        Node::Bool(_) => "a boolean",
+        Node::Number(_) => "a number",
+        Node::String(_) => "a string",
+        Node::Array(_) => "a list",
+        Node::Object(_) => "an object",
+    }
+}
+
+fn path_json(segments: &[PathSegment]) -> String {
+    serde_json::to_string(segments).unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn path(text: &str) -> Path {
+        serde_json::from_str(text).unwrap()
+    }
+
+    #[test]
+    fn get_follows_keys_and_indices() {
+        let doc = json(r#"{"a":[1,{"b":null}]}"#);
+        assert_eq!(doc.get(&path("[]")), Some(&doc));
+        assert_eq!(doc.get(&path(r#"["a",1,"b"]"#)), Some(&Node::Null));
+        assert_eq!(doc.get(&path(r#"["a",2]"#)), None);
+        assert_eq!(doc.get(&path(r#"["a",-1]"#)), None);
+        assert_eq!(doc.get(&path(r#"["a","0"]"#)), None);
+        assert_eq!(doc.get(&path(r#"["a",{}]"#)), None);
+        assert_eq!(Node::Void.get(&path("[]")), None);
+    }
+
+    #[test]
+    fn set_creates_missing_containers() {
+        let mut doc = Node::Void;
+        assert_eq!(doc.set(&path(r#"["a",0,"b"]"#), json("1")).unwrap(), None);
+        assert_eq!(doc, json(r#"{"a":[{"b":1}]}"#));
+        assert_eq!(doc.set(&path(r#"["a",1]"#), json("2")).unwrap(), None);
+        assert_eq!(doc.set(&path(r#"["a",-1]"#), json("3")).unwrap(), None);
+        assert_eq!(doc.set(&path(r#"["a",0]"#), json("0")).unwrap(), Some(json(r#"{"b":1}"#)));
+        assert_eq!(doc, json(r#"{"a":[0,2,3]}"#));
+        assert_eq!(doc.set(&path("[]"), json("true")).unwrap(), Some(json(r#"{"a":[0,2,3]}"#)));
+        assert_eq!(doc, json("true"));
+        let mut doc = json(r#"{"a":1}"#);
+        assert_eq!(doc.set(&path(r#"["a"]"#), Node::Void).unwrap(), Some(json("1")));
+        assert_eq!(doc.set(&path(r#"["b"]"#), Node::Void).unwrap(), None);
+        assert_eq!(doc, json("{}"));
+    }
+
+    #[test]
+    fn set_errors_leave_the_node_unchanged() {
+        let mut doc = json(r#"{"a":[1],"s":"x"}"#);
+        for (target, message) in [
+            (r#"["new",1]"#, r#"index 1 is out of range for the list of length 0 at ["new"]"#),
+            (r#"["a",5]"#, r#"index 5 is out of range for the list of length 1 at ["a"]"#),
+            (r#"["s","k"]"#, r#"found a string at ["s"]: expected an object"#),
+            (r#"["a","k"]"#, r#"found a list at ["a"]: expected an object"#),
+            (r#"["a",{}]"#, "jd path element {} does not name a single value"),
+        ] {
+            let err = doc.set(&path(target), Node::Null).unwrap_err();
+            assert_eq!(err.to_string(), message);
+        }
+        assert_eq!(doc, json(r#"{"a":[1],"s":"x"}"#));
+    }
+
+    #[test]
+    fn remove_shifts_lists_and_reports_misses() {
+        let mut doc = json(r#"{"a":[1,2],"b":true}"#);
+        assert_eq!(doc.remove(&path(r#"["a",0]"#)), Some(json("1")));
+        assert_eq!(doc.remove(&path(r#"["b"]"#)), Some(json("true")));
+        assert_eq!(doc.remove(&path(r#"["b"]"#)), None);
+        assert_eq!(doc.remove(&path(r#"["a",-1]"#)), None);
+        assert_eq!(doc, json(r#"{"a":[2]}"#));
+        assert_eq!(doc.remove(&path("[]")), Some(json(r#"{"a":[2]}"#)));
+        assert_eq!(doc, Node::Void);
+    }
+}
@@ -0,0 +1,582 @@
+//! Arena-allocated node trees (ADR 0007).
+//!
+//! A [`Node`] tree allocates every list, object entry, key, and string on
+//! its own, which dominates parse time and scatters memory on documents of
+//! many small values. A [`NodeArena`] keeps a whole tree in four vectors:
+//! one slot per value, the children of every list, the members of every
+//! object sorted by key, and a single buffer holding all keys and strings.
+//!
+//! [`NodeArena::diff`] walks two arenas object by object, skipping members
+//! whose subtrees are identical without touching the heap. Any other pair of
+//! values that differ is converted to `Node`s and handed to the regular diff
+//! engine, so the result is always the diff [`Node::diff`] computes.
+
+use core::fmt;
+
+use serde::de::{DeserializeSeed, Deserializer, Error, MapAccess, SeqAccess, Visitor};
+
+use crate::diff::{diff_impl, finish, Diff, DiffElement, Path, PathSegment};
+use crate::order::JSON_NUMBER_TOKEN;
+use crate::prelude::*;
+use crate::{CanonicalizeError, DiffOptions, Node, Number};
+
+/// A JSON document stored in a few contiguous buffers instead of a tree of
+/// separately allocated [`Node`]s.
+///
+/// Build one with [`NodeArena::from_json_str`], which reads JSON like
+/// [`Node::from_json_str`], or from an existing tree with
+/// [`NodeArena::from_node`]. Requires the `arena` feature.
+///
+/// ```
+/// # use jd_core::{DiffOptions, Node, NodeArena};
+/// let lhs = NodeArena::from_json_str(r#"{"a":{"id":1},"b":{"id":2}}"#)?;
+/// let rhs = NodeArena::from_json_str(r#"{"a":{"id":1},"b":{"id":3}}"#)?;
+/// let diff = lhs.diff(&rhs, &DiffOptions::default());
+/// assert_eq!(diff, lhs.to_node().diff(&rhs.to_node(), &DiffOptions::default()));
+/// assert_eq!(diff.render(&Default::default()), "@ [\"b\",\"id\"]\n- 2\n+ 3\n");
+/// # Ok::<(), jd_core::CanonicalizeError>(())
+/// ```
+#[derive(Clone, Debug)]
+pub struct NodeArena {
+    slots: Vec<Slot>,
+    items: Vec<usize>,
+    members: Vec<(Span, usize)>,
+    text: String,
+    root: usize,
+}
+
+/// One value of the tree. Lists and objects name a range of `items` or
+/// `members`, and strings a range of `text`.
+#[derive(Clone, Debug)]
+enum Slot {
+    Void,
+    Null,
+    Bool(bool),
+    Number(Number),
+    String(Span),
+    Array(Span),
+    Object(Span),
+}
+
+#[derive(Clone, Copy, Debug)]
+struct Span {
+    start: usize,
+    end: usize,
+}
+
+impl Span {
+    fn range(self) -> core::ops::Range<usize> {
+        self.start..self.end
+    }
+}
+
+impl NodeArena {
+    /// Parses a JSON string into an arena, with the values and errors of
+    /// [`Node::from_json_str`]: a repeated key keeps its last value, and
+    /// blank input is [`Node::Void`].
+    ///
+    /// ```
+    /// # use jd_core::{Node, NodeArena};
+    /// let arena = NodeArena::from_json_str(r#"{"b":[1,"x"],"a":null,"a":true}"#)?;
+    /// assert_eq!(arena.to_node(), Node::from_json_str(r#"{"a":true,"b":[1,"x"]}"#)?);
+    /// assert!(NodeArena::from_json_str("[1,").is_err());
+    /// # Ok::<(), jd_core::CanonicalizeError>(())
+    /// ```
+    pub fn from_json_str(input: &str) -> Result<Self, CanonicalizeError> {
+        let mut builder = Builder::default();
+        if input.trim().is_empty() {
+            return Ok(builder.finish(Slot::Void));
+        }
+        let mut deserializer = serde_json::Deserializer::from_str(input);
+        let root = Seed(&mut builder)
+            .deserialize(&mut deserializer)
+            .and_then(|root| deserializer.end().map(|()| root));
+        if let Some(error) = builder.error.take() {
+            return Err(error);
+        }
+        let root = root?;
+        Ok(builder.finish_at(root))
+    }
+
+    /// Copies a [`Node`] tree into an arena.
+    ///
+    /// ```
+    /// # use jd_core::{Node, NodeArena};
+    /// let node = Node::from_json_str(r#"{"a":[1,{"b":"c"}]}"#)?;
+    /// assert_eq!(NodeArena::from_node(&node).to_node(), node);
+    /// # Ok::<(), jd_core::CanonicalizeError>(())
+    /// ```
+    #[must_use]
+    pub fn from_node(node: &Node) -> Self {
+        let mut builder = Builder::default();
+        let root = builder.copy(node);
+        builder.finish_at(root)
+    }
+
+    /// Builds the [`Node`] tree the arena holds.
+    #[must_use]
+    pub fn to_node(&self) -> Node {
+        self.node(self.root)
+    }
+
+    /// Computes the diff between `self` and `other`, equal to
+    /// `self.to_node().diff(&other.to_node(), options)`.
+    ///
+    /// Members of objects that are identical in both arenas are skipped
+    /// without building nodes. With a [`NodeComparator`](crate::NodeComparator)
+    /// or progress reporting, which need every value as a `Node`, both trees
+    /// are converted first.
+    #[must_use]
+    pub fn diff(&self, other: &Self, options: &DiffOptions) -> Diff {
+        let options = &*options.for_diff();
+        let diff = if options.has_comparators() || options.tracker().is_some() {
+            diff_impl(&self.to_node(), &other.to_node(), &Path::new(), options)
+        } else {
+            let mut elements = Vec::new();
+            Pair { lhs: self, rhs: other }.diff(
+                self.root,
+                other.root,
+                &Path::new(),
+                options,
+                &mut elements,
+            );
+            Diff::from_elements(elements)
+        };
+        finish(diff, options)
+    }
+
+    fn node(&self, id: usize) -> Node {
+        match &self.slots[id] {
+            Slot::Void => Node::Void,
+            Slot::Null => Node::Null,
+            Slot::Bool(value) => Node::Bool(*value),
+            Slot::Number(number) => Node::Number(number.clone()),
+            Slot::String(span) => Node::String(self.str(*span).to_owned()),
+            Slot::Array(span) => {
+                Node::Array(self.items[span.range()].iter().map(|&item| self.node(item)).collect())
+            }
+            Slot::Object(span) => Node::Object(
+                self.members(*span)
+                    .iter()
+                    .map(|&(key, value)| (self.str(key).to_owned(), self.node(value)))
+                    .collect(),
+            ),
+        }
+    }
+
+    fn str(&self, span: Span) -> &str {
+        &self.text[span.range()]
+    }
+
+    fn members(&self, span: Span) -> &[(Span, usize)] {
+        &self.members[span.range()]
+    }
+}
+
+/// Two arenas being diffed.
+struct Pair<'a> {
+    lhs: &'a NodeArena,
+    rhs: &'a NodeArena,
+}
+
+impl Pair<'_> {
+    /// Mirrors `diff_impl` and `diff_objects`, descending into objects
+    /// member by member and handing every other pair to `diff_impl`.
+    fn diff(
+        &self,
+        lhs: usize,
+        rhs: usize,
+        path: &Path,
+        options: &DiffOptions,
+        elements: &mut Vec<DiffElement>,
+    ) {
+        if options.is_spent() || self.same(lhs, rhs) {
+            return;
+        }
+        let (Slot::Object(left), Slot::Object(right)) =
+            (&self.lhs.slots[lhs], &self.rhs.slots[rhs])
+        else {
+            elements.extend(diff_impl(&self.lhs.node(lhs), &self.rhs.node(rhs), path, options));
+            return;
+        };
+        let (left, right) = (self.lhs.members(*left), self.rhs.members(*right));
+
+        let mut cursor = 0;
+        for &(key, value) in left {
+            if options.is_spent() {
+                break;
+            }
+            let key = self.lhs.str(key);
+            let other = find(right, &mut cursor, |span| self.rhs.str(span), key);
+            if other.is_some_and(|other| self.same(value, other)) {
+                continue;
+            }
+            let segment = PathSegment::key(key);
+            let child_options = options.refine(&segment);
+            if child_options.is_ignored() {
+                continue;
+            }
+            let path = path.clone().with_segment(segment);
+            if let Some(other) = other {
+                self.diff(value, other, &path, &child_options, elements);
+            } else {
+                let element =
+                    DiffElement::new().with_path(path).with_remove(vec![self.lhs.node(value)]);
+                options.spend([&element]);
+                elements.push(element);
+            }
+        }
+
+        let mut cursor = 0;
+        for &(key, value) in right {
+            if options.is_spent() {
+                break;
+            }
+            let key = self.rhs.str(key);
+            if find(left, &mut cursor, |span| self.lhs.str(span), key).is_some() {
+                continue;
+            }
+            let segment = PathSegment::key(key);
+            if options.refine(&segment).is_ignored() {
+                continue;
+            }
+            let element = DiffElement::new()
+                .with_path(path.clone().with_segment(segment))
+                .with_add(vec![self.rhs.node(value)]);
+            options.spend([&element]);
+            elements.push(element);
+        }
+    }
+
+    /// Reports whether two subtrees are identical, numbers written as
+    /// integers and as floats included. Identical values are equal under
+    /// any options without comparators, so their diff is empty.
+    fn same(&self, lhs: usize, rhs: usize) -> bool {
+        match (&self.lhs.slots[lhs], &self.rhs.slots[rhs]) {
+            (Slot::Void, Slot::Void) | (Slot::Null, Slot::Null) => true,
+            (Slot::Bool(left), Slot::Bool(right)) => left == right,
+            (Slot::Number(left), Slot::Number(right)) => {
+                left == right && left.is_integer() == right.is_integer()
+            }
+            (Slot::String(left), Slot::String(right)) => {
+                self.lhs.str(*left) == self.rhs.str(*right)
+            }
+            (Slot::Array(left), Slot::Array(right)) => {
+                let (left, right) = (&self.lhs.items[left.range()], &self.rhs.items[right.range()]);
+                left.len() == right.len()
+                    && left.iter().zip(right).all(|(&left, &right)| self.same(left, right))
+            }
+            (Slot::Object(left), Slot::Object(right)) => {
+                let (left, right) = (self.lhs.members(*left), self.rhs.members(*right));
+                left.len() == right.len()
+                    && left.iter().zip(right).all(|(&(lkey, lvalue), &(rkey, rvalue))| {
+                        self.lhs.str(lkey) == self.rhs.str(rkey) && self.same(lvalue, rvalue)
+                    })
+            }
+            _ => false,
+        }
+    }
+}
+
+/// Finds `key` among sorted `members`, starting at `cursor` and leaving it
+/// at the first member not before `key`, for keys looked up in order.
+fn find<'a>(
+    members: &[(Span, usize)],
+    cursor: &mut usize,
+    name: impl Fn(Span) -> &'a str,
+    key: &str,
+) -> Option<usize> {
+    while members.get(*cursor).is_some_and(|&(span, _)| name(span) < key) {
+        *cursor += 1;
+    }
+    members.get(*cursor).filter(|&&(span, _)| name(span) == key).map(|&(_, value)| value)
+}
+
+/// An arena under construction, with stacks of the children of the lists and
+/// objects still being read.
+#[derive(Default)]
+struct Builder {
+    slots: Vec<Slot>,
+    items: Vec<usize>,
+    members: Vec<(Span, usize)>,
+    text: String,
+    pending_items: Vec<usize>,
+    pending_members: Vec<(Span, usize)>,
+    /// A number the parser accepted but a double cannot hold, reported as
+    /// [`Node::from_json_str`] reports it.
+    error: Option<CanonicalizeError>,
+}
+
+impl Builder {
+    fn push(&mut self, slot: Slot) -> usize {
+        self.slots.push(slot);
+        self.slots.len() - 1
+    }
+
+    fn push_str(&mut self, value: &str) -> Span {
+        let start = self.text.len();
+        self.text.push_str(value);
+        Span { start, end: self.text.len() }
+    }
+
+    fn push_number<E: Error>(&mut self, literal: &str) -> Result<usize, E> {
+        match Number::from_literal(literal) {
+            Ok(number) => Ok(self.push(Slot::Number(number))),
+            Err(error) => {
+                let message = error.to_string();
+                self.error = Some(error);
+                Err(E::custom(message))
+            }
+        }
+    }
+
+    /// Closes the list whose items were pushed since `start`.
+    fn close_list(&mut self, start: usize) -> usize {
+        let begin = self.items.len();
+        self.items.extend(self.pending_items.drain(start..));
+        self.push(Slot::Array(Span { start: begin, end: self.items.len() }))
+    }
+
+    /// Closes the object whose members were pushed since `start`, sorting
+    /// them by key and keeping the last value of a repeated key.
+    fn close_object(&mut self, start: usize) -> usize {
+        let Self { members, pending_members, text, .. } = self;
+        let pending = &mut pending_members[start..];
+        pending.sort_by(|(left, _), (right, _)| text[left.range()].cmp(&text[right.range()]));
+        let begin = members.len();
+        for (index, &(key, value)) in pending.iter().enumerate() {
+            let repeated = pending
+                .get(index + 1)
+                .is_some_and(|&(next, _)| text[next.range()] == text[key.range()]);
+            if !repeated {
+                members.push((key, value));
+            }
+        }
+        pending_members.truncate(start);
+        let end = members.len();
+        self.push(Slot::Object(Span { start: begin, end }))
+    }
+
+    fn copy(&mut self, node: &Node) -> usize {
+        match node {
+            Node::Void => self.push(Slot::Void),
+            Node::Null => self.push(Slot::Null),
+            Node::Bool(value) => self.push(Slot::Bool(*value)),
+            Node::Number(number) => self.push(Slot::Number(number.clone())),
+            Node::String(value) => {
+                let span = self.push_str(value);
+                self.push(Slot::String(span))
+            }
+            Node::Array(items) => {
+                let start = self.pending_items.len();
+                for item in items {
+                    let item = self.copy(item);
+                    self.pending_items.push(item);
+                }
+                self.close_list(start)
+            }
+            Node::Object(members) => {
+                let start = self.pending_members.len();
+                for (key, value) in members {
+                    let key = self.push_str(key);
+                    let value = self.copy(value);
+                    self.pending_members.push((key, value));
+                }
+                self.close_object(start)
+            }
+        }
+    }
+
+    fn finish(mut self, root: Slot) -> NodeArena {
+        let root = self.push(root);
+        self.finish_at(root)
+    }
+
+    fn finish_at(self, root: usize) -> NodeArena {
+        NodeArena {
+            slots: self.slots,
+            items: self.items,
+            members: self.members,
+            text: self.text,
+            root,
+        }
+    }
+}
+
+/// Reads one JSON value into the arena, returning its slot.
+struct Seed<'b>(&'b mut Builder);
+
+impl<'de> DeserializeSeed<'de> for Seed<'_> {
+    type Value = usize;
+
+    fn deserialize<D: Deserializer<'de>>(self, deserializer: D) -> Result<usize, D::Error> {
+        deserializer.deserialize_any(self)
+    }
+}
+
+impl<'de> Visitor<'de> for Seed<'_> {
+    type Value = usize;
+
+    fn expecting(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str("any valid JSON value")
+    }
+
+    fn visit_bool<E>(self, value: bool) -> Result<usize, E> {
+        Ok(self.0.push(Slot::Bool(value)))
+    }
+
+    fn visit_i64<E: Error>(self, value: i64) -> Result<usize, E> {
+        self.0.push_number(&serde_json::Number::from(value).to_string())
+    }
+
+    fn visit_u64<E: Error>(self, value: u64) -> Result<usize, E> {
+        self.0.push_number(&serde_json::Number::from(value).to_string())
+    }
+
+    fn visit_f64<E: Error>(self, value: f64) -> Result<usize, E> {
+        let number = serde_json::Number::from_f64(value)
+            .ok_or_else(|| E::custom(format_args!("non-finite number {value}")))?;
+        self.0.push_number(&number.to_string())
+    }
+
+    fn visit_str<E>(self, value: &str) -> Result<usize, E> {
+        let span = self.0.push_str(value);
+        Ok(self.0.push(Slot::String(span)))
+    }
+
+    fn visit_unit<E>(self) -> Result<usize, E> {
+        Ok(self.0.push(Slot::Null))
+    }
+
+    fn visit_seq<A: SeqAccess<'de>>(self, mut seq: A) -> Result<usize, A::Error> {
+        let builder = self.0;
+        let start = builder.pending_items.len();
+        while let Some(item) = seq.next_element_seed(Seed(&mut *builder))? {
+            builder.pending_items.push(item);
+        }
+        Ok(builder.close_list(start))
+    }
+
+    fn visit_map<A: MapAccess<'de>>(self, mut map: A) -> Result<usize, A::Error> {
+        let builder = self.0;
+        let start = builder.pending_members.len();
+        let mut first = true;
+        while let Some(key) = map.next_key_seed(Key(&mut *builder))? {
+            if first && builder.text[key.range()] == *JSON_NUMBER_TOKEN {
+                builder.text.truncate(key.start);
+                let literal: String = map.next_value()?;
+                return builder.push_number(&literal);
+            }
+            first = false;
+            let value = map.next_value_seed(Seed(&mut *builder))?;
+            builder.pending_members.push((key, value));
+        }
+        Ok(builder.close_object(start))
+    }
+}
+
+/// Reads an object key into the arena's text.
+struct Key<'b>(&'b mut Builder);
+
+impl<'de> DeserializeSeed<'de> for Key<'_> {
+    type Value = Span;
+
+    fn deserialize<D: Deserializer<'de>>(self, deserializer: D) -> Result<Span, D::Error> {
+        deserializer.deserialize_str(self)
+    }
+}
+
+impl<'de> Visitor<'de> for Key<'_> {
+    type Value = Span;
+
+    fn expecting(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str("an object key")
+    }
+
+    fn visit_str<E>(self, value: &str) -> Result<Span, E> {
+        Ok(self.0.push_str(value))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{ArrayMode, DiffOption, NumberEquality, PathOption, RenderConfig};
+
+    const DOCUMENTS: &[&str] = &[
+        "",
+        "null",
+        "1",
+        "1.0",
+        r#""a\nb""#,
+        "[1,2,3]",
+        "[3,1,2,2]",
+        r#"{"a":1,"b":[1,{"c":2}],"d":"x"}"#,
+        r#"{"a":1.0,"b":[1,{"c":3}],"e":null}"#,
+        r#"{"a":12345678901234567890123,"id":{"x":1,"y":[true]}}"#,
+        r#"{"a":12345678901234567891123,"id":{"x":1,"y":[false]},"z":{}}"#,
+        r#"{"b":2,"a":1,"b":3}"#,
+        r#"{"ke\"y":"é","n":[]}"#,
+    ];
+
+    fn option_sets() -> Vec<DiffOptions> {
+        vec![
+            DiffOptions::default(),
+            DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap(),
+            DiffOptions::default().with_array_mode(ArrayMode::MultiSet).unwrap(),
+            DiffOptions::default().with_precision(1.5).unwrap(),
+            DiffOptions::default().with_number_equality(NumberEquality::Typed),
+            DiffOptions::default().with_excluded_keys(["^e$"]).unwrap(),
+            DiffOptions::default()
+                .with_path_option(PathOption::new(PathSegment::key("b"), vec![DiffOption::Set]))
+                .unwrap(),
+            DiffOptions::default().with_move_detection(true),
+            DiffOptions::default().with_max_elements(1),
+        ]
+    }
+
+    #[test]
+    fn parses_the_nodes_node_parses() {
+        for document in DOCUMENTS {
+            let node = Node::from_json_str(document).unwrap();
+            let arena = NodeArena::from_json_str(document).unwrap();
+            assert_eq!(arena.to_node(), node, "{document}");
+            assert_eq!(NodeArena::from_node(&node).to_node(), node, "{document}");
+        }
+        let arena = NodeArena::from_json_str("[1,1.0]").unwrap();
+        let Node::Array(items) = arena.to_node() else { panic!("expected a list") };
+        let integers: Vec<_> = items
+            .iter()
+            .map(|item| matches!(item, Node::Number(number) if number.is_integer()))
+            .collect();
+        assert_eq!(integers, [true, false]);
+    }
+
+    #[test]
+    fn reports_the_errors_node_reports() {
+        for document in ["[1,", "{\"a\"}", "1 2", "1e999", "[1e999]"] {
+            let expected = Node::from_json_str(document).unwrap_err().to_string();
+            let actual = NodeArena::from_json_str(document).unwrap_err().to_string();
+            assert_eq!(actual, expected, "{document}");
+        }
+    }
+
+    #[test]
+    fn diffs_like_node() {
+        let config = RenderConfig::default();
+        for options in option_sets() {
+            for lhs in DOCUMENTS {
+                for rhs in DOCUMENTS {
+                    let (left, right) =
+                        (Node::from_json_str(lhs).unwrap(), Node::from_json_str(rhs).unwrap());
+                    let expected = left.diff(&right, &options);
+                    let actual = NodeArena::from_json_str(lhs)
+                        .unwrap()
+                        .diff(&NodeArena::from_json_str(rhs).unwrap(), &options);
+                    assert_eq!(actual.render(&config), expected.render(&config), "{lhs} -> {rhs}");
+                    assert_eq!(actual.is_truncated(), expected.is_truncated(), "{lhs} -> {rhs}");
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,145 @@
+//! Conventions shared by the binary formats for values JSON cannot express.
+//!
+//! A byte string becomes a single-entry object, `{"$bytes": "<hex>"}`, with
+//! its bytes in lowercase hex. Two byte strings therefore diff like any other
+//! strings, and writers turn the object back into bytes. Decoders also share
+//! how they report errors, resolve repeated map keys, and read floats.
+
+use alloc::collections::BTreeMap;
+use core::fmt;
+
+use crate::prelude::*;
+use crate::{CanonicalizeError, DuplicateKeys, Node, Number};
+
+/// The key of the object that stands in for a byte string.
+pub(crate) const BYTES_KEY: &str = "$bytes";
+
+/// Wraps `bytes` as `{"$bytes": "<hex>"}`.
+pub(crate) fn bytes_node(bytes: &[u8]) -> Node {
+    Node::Object(BTreeMap::from([(BYTES_KEY.to_string(), Node::String(hex(bytes)))]))
+}
+
+/// Returns the bytes of an object built by [`bytes_node`], or `None` for any
+/// other node, including `$bytes` objects whose value is not valid hex.
+pub(crate) fn node_bytes(node: &Node) -> Option<Vec<u8>> {
+    let Node::Object(map) = node else { return None };
+    match map.get(BYTES_KEY) {
+        Some(Node::String(text)) if map.len() == 1 => unhex(text),
+        _ => None,
+    }
+}
+
+/// Writes `bytes` as lowercase hex.
+pub(crate) fn hex(bytes: &[u8]) -> String {
+    bytes.iter().map(|byte| format!("{byte:02x}")).collect()
+}
+
+/// Reads hex written by [`hex`], in either case.
+pub(crate) fn unhex(text: &str) -> Option<Vec<u8>> {
+    if !text.len().is_multiple_of(2) || !text.bytes().all(|byte| byte.is_ascii_hexdigit()) {
+        return None;
+    }
+    (0..text.len())
+        .step_by(2)
+        .map(|index| u8::from_str_radix(&text[index..index + 2], 16).ok())
+        .collect()
+}
+
+/// Builds the error for input that `format` cannot decode.
+pub(crate) fn decode_error(format: &'static str, message: impl fmt::Display) -> CanonicalizeError {
+    CanonicalizeError::Decode { format, message: message.to_string() }
+}
+
+/// Decides whether the value of `key` goes into `object`, applying `policy`
+/// when the object already holds the key.
+pub(crate) fn keep_value(
+    object: &BTreeMap<String, Node>,
+    key: &str,
+    policy: DuplicateKeys,
+    format: &'static str,
+) -> Result<bool, CanonicalizeError> {
+    if !object.contains_key(key) {
+        return Ok(true);
+    }
+    match policy {
+        DuplicateKeys::LastWins => Ok(true),
+        DuplicateKeys::FirstWins => Ok(false),
+        DuplicateKeys::Error => Err(decode_error(format, format_args!("duplicate key {key:?}"))),
+    }
+}
+
+/// Reads a binary float. Its `Debug` output is the shortest text that reads
+/// back as the same float and keeps the fraction of integral values, so
+/// `1.0` stays a float for typed number comparisons.
+pub(crate) fn float<F: Copy + Into<f64> + fmt::Debug>(
+    value: F,
+) -> Result<Number, CanonicalizeError> {
+    Number::new(value.into())?;
+    Number::from_literal(&format!("{value:?}"))
+}
+
+/// Returns the exact value of a number written as an integer, for formats
+/// that store integers apart from floats.
+pub(crate) fn integer(number: &Number) -> Option<i128> {
+    if !number.is_integer() {
+        return None;
+    }
+    match number.literal() {
+        Some(literal) => literal.parse().ok(),
+        None => Some(number.get() as i128),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn bytes_round_trip_through_hex() {
+        let node = bytes_node(&[0x00, 0xab, 0x7f]);
+        assert_eq!(node, Node::from_json_str(r#"{"$bytes":"00ab7f"}"#).unwrap());
+        assert_eq!(node_bytes(&node), Some(vec![0x00, 0xab, 0x7f]));
+        assert_eq!(node_bytes(&bytes_node(&[])), Some(Vec::new()));
+        assert_eq!(unhex("00AB7f"), Some(vec![0x00, 0xab, 0x7f]));
+    }
+
+    #[test]
+    fn other_objects_are_not_bytes() {
+        for text in [
+            r#"{"$bytes":"abc"}"#,
+            r#"{"$bytes":"zz"}"#,
+            r#"{"$bytes":"+1"}"#,
+            r#"{"$bytes":1}"#,
+            r#"{"$bytes":"00","x":1}"#,
+            r#"{"bytes":"00"}"#,
+            r#""00""#,
+        ] {
+            assert_eq!(node_bytes(&Node::from_json_str(text).unwrap()), None, "{text}");
+        }
+    }
+
+    #[test]
+    fn floats_keep_their_fraction_and_integers_their_digits() {
+        let one = float(1.0_f32).unwrap();
+        assert!(!one.is_integer());
+        assert_eq!(float(0.1_f32).unwrap().get(), 0.1);
+        assert!(matches!(float(f64::NAN), Err(CanonicalizeError::NotFinite { .. })));
+
+        let Node::Number(big) = Node::from_json_str("18446744073709551615").unwrap() else {
+            panic!()
+        };
+        assert_eq!(integer(&big), Some(u64::MAX.into()));
+        assert_eq!(integer(&Number::new(-3.0).unwrap()), Some(-3));
+        assert_eq!(integer(&one), None);
+    }
+
+    #[test]
+    fn repeated_keys_follow_the_policy() {
+        let object = BTreeMap::from([("a".to_string(), Node::Null)]);
+        assert!(keep_value(&object, "b", DuplicateKeys::Error, "CBOR").unwrap());
+        assert!(keep_value(&object, "a", DuplicateKeys::LastWins, "CBOR").unwrap());
+        assert!(!keep_value(&object, "a", DuplicateKeys::FirstWins, "CBOR").unwrap());
+        let err = keep_value(&object, "a", DuplicateKeys::Error, "CBOR").unwrap_err();
+        assert_eq!(err.to_string(), "invalid CBOR: duplicate key \"a\"");
+    }
+}
@@ -0,0 +1,120 @@
+//! Cooperative cancellation of long diffs and patches.
+//!
+//! A [`CancellationToken`] registered with [`DiffOptions::with_cancellation`]
+//! is checked as the diff walks object keys, list hunks, set members, and the
+//! rows of a list alignment, and before each hunk of a patch, so a service
+//! can give up on a large request from another thread without killing the
+//! one doing the work.
+//!
+//! [`DiffOptions::with_cancellation`]: crate::DiffOptions::with_cancellation
+
+use alloc::sync::Arc;
+use core::sync::atomic::{AtomicBool, Ordering};
+
+/// A flag shared by the caller and a running diff or patch. Clones share the
+/// flag, so one clone can cancel work that another was handed to.
+///
+/// ```
+/// use jd_core::{CancellationToken, DiffOptions, Node};
+///
+/// let token = CancellationToken::new();
+/// let options = DiffOptions::default().with_cancellation(token.clone());
+/// let lhs = Node::from_json_str(r#"{"a":1}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"a":2}"#).unwrap();
+/// assert!(!lhs.diff(&rhs, &options).is_truncated());
+///
+/// token.cancel();
+/// let diff = lhs.diff(&rhs, &options);
+/// assert!(diff.is_empty() && diff.is_truncated());
+/// assert!(lhs.apply_patch_with_options(&lhs.diff(&rhs, &DiffOptions::default()), &options).is_err());
+/// ```
+#[derive(Clone, Debug, Default)]
+pub struct CancellationToken {
+    cancelled: Arc<AtomicBool>,
+}
+
+impl CancellationToken {
+    /// Constructs a token that is not cancelled.
+    ///
+    /// ```
+    /// # use jd_core::CancellationToken;
+    /// assert!(!CancellationToken::new().is_cancelled());
+    /// ```
+    #[must_use]
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Asks every diff and patch holding a clone of this token to stop.
+    ///
+    /// ```
+    /// # use jd_core::CancellationToken;
+    /// let token = CancellationToken::new();
+    /// let handed_out = token.clone();
+    /// token.cancel();
+    /// assert!(handed_out.is_cancelled());
+    /// ```
+    pub fn cancel(&self) {
+        self.cancelled.store(true, Ordering::Relaxed);
+    }
+
+    /// Reports whether [`cancel`](Self::cancel) was called on any clone.
+    ///
+    /// ```
+    /// # use jd_core::CancellationToken;
+    /// let token = CancellationToken::new();
+    /// token.cancel();
+    /// assert!(token.is_cancelled());
+    /// ```
+    #[must_use]
+    pub fn is_cancelled(&self) -> bool {
+        self.cancelled.load(Ordering::Relaxed)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::prelude::*;
+    use crate::{Diff, DiffOptions, Node};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn cancelled() -> DiffOptions {
+        let token = CancellationToken::new();
+        let canceller = token.clone();
+        std::thread::spawn(move || canceller.cancel()).join().unwrap();
+        DiffOptions::default().with_cancellation(token)
+    }
+
+    #[test]
+    fn cancelled_diffs_come_back_empty_and_truncated() {
+        let lhs = json(r#"{"a":[1,2,3],"b":{"c":1}}"#);
+        let rhs = json(r#"{"a":[3,2,1],"b":{"c":2}}"#);
+        let diff = lhs.diff(&rhs, &cancelled());
+        assert!(diff.is_empty());
+        assert!(diff.is_truncated());
+    }
+
+    #[test]
+    fn cancelled_patches_fail_at_the_next_hunk() {
+        let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n+ 2\n@ [\"b\"]\n+ 3\n").unwrap();
+        let base = json(r#"{"a":1}"#);
+        let err = base.apply_patch_with_options(&diff, &cancelled()).unwrap_err();
+        assert_eq!(err.to_string(), "patch cancelled");
+        assert_eq!(err.hunk(), Some(0));
+
+        let partial = base.apply_patch_partial(&diff, &cancelled());
+        assert_eq!(partial.node, base);
+        assert_eq!(partial.rejected.len(), 2);
+    }
+
+    #[cfg(feature = "std")]
+    #[test]
+    fn cancelled_streams_stop_with_an_error() {
+        let result = crate::diff_streams(&b"[1,2]"[..], &b"[1,3]"[..], &cancelled(), |_| Ok(()));
+        assert!(matches!(result, Err(crate::StreamError::Cancelled)));
+    }
+}
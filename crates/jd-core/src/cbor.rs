@@ -0,0 +1,239 @@
+//! CBOR input and output, available with the `cbor` feature.
+//!
+//! CBOR items map onto [`Node`]s the way their JSON counterparts do. The two
+//! kinds of item JSON has no counterpart for are spelled as objects so they
+//! survive a diff and a round trip: byte strings as `{"$bytes": "<hex>"}`
+//! and tagged items, such as the COSE structures, as
+//! `{"$tag": <number>, "$value": <item>}`. Integer map keys are read as
+//! their decimal text and written back as text keys.
+
+use alloc::collections::BTreeMap;
+
+use ciborium::value::{Integer, Value};
+
+use crate::binary::{bytes_node, decode_error, float, integer, keep_value, node_bytes};
+use crate::prelude::*;
+use crate::{CanonicalizeError, DuplicateKeys, Node, Number, ParseOptions};
+
+const FORMAT: &str = "CBOR";
+const TAG_KEY: &str = "$tag";
+const TAG_VALUE_KEY: &str = "$value";
+
+impl Node {
+    /// Decodes a CBOR item into the canonical node representation. Empty
+    /// input decodes to [`Node::Void`], like blank JSON text.
+    ///
+    /// Byte strings decode to `{"$bytes": "<hex>"}` and tagged items to
+    /// `{"$tag": <number>, "$value": <item>}`.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// // {"id": 7, "raw": h'beef'}
+    /// let bytes = [0xa2, 0x62, b'i', b'd', 0x07, 0x63, b'r', b'a', b'w', 0x42, 0xbe, 0xef];
+    /// let node = Node::from_cbor_slice(&bytes).unwrap();
+    /// assert_eq!(node, Node::from_json_str(r#"{"id":7,"raw":{"$bytes":"beef"}}"#).unwrap());
+    /// ```
+    pub fn from_cbor_slice(input: &[u8]) -> Result<Self, CanonicalizeError> {
+        Self::from_cbor_slice_with_options(input, &ParseOptions::default())
+    }
+
+    /// Decodes a CBOR item like [`Node::from_cbor_slice`], resolving keys a
+    /// map repeats with [`ParseOptions::duplicate_keys`].
+    ///
+    /// ```
+    /// # use jd_core::{DuplicateKeys, Node, ParseOptions};
+    /// // {"a": 1, "a": 2}
+    /// let bytes = [0xa2, 0x61, b'a', 0x01, 0x61, b'a', 0x02];
+    /// let first = ParseOptions::default().with_duplicate_keys(DuplicateKeys::FirstWins);
+    /// let node = Node::from_cbor_slice_with_options(&bytes, &first).unwrap();
+    /// assert_eq!(node, Node::from_json_str(r#"{"a":1}"#).unwrap());
+    /// ```
+    pub fn from_cbor_slice_with_options(
+        input: &[u8],
+        options: &ParseOptions,
+    ) -> Result<Self, CanonicalizeError> {
+        if input.is_empty() {
+            return Ok(Self::Void);
+        }
+        let mut reader = input;
+        let value: Value =
+            ciborium::from_reader(&mut reader).map_err(|err| decode_error(FORMAT, err))?;
+        if !reader.is_empty() {
+            let trailing = reader.len();
+            return Err(decode_error(
+                FORMAT,
+                format_args!("{trailing} bytes after the first item"),
+            ));
+        }
+        node(value, options.duplicate_keys())
+    }
+
+    /// Encodes the node as CBOR, turning `$bytes` and `$tag` objects back
+    /// into byte strings and tagged items. Integers are written as CBOR
+    /// integers and other numbers as doubles.
+    ///
+    /// Returns `None` when the node contains [`Node::Void`].
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let node = Node::from_json_str(r#"{"$tag":1,"$value":1700000000}"#).unwrap();
+    /// let bytes = node.to_cbor_vec().unwrap();
+    /// assert_eq!(bytes, [0xc1, 0x1a, 0x65, 0x53, 0xf1, 0x00]);
+    /// assert_eq!(Node::from_cbor_slice(&bytes).unwrap(), node);
+    /// ```
+    #[must_use]
+    pub fn to_cbor_vec(&self) -> Option<Vec<u8>> {
+        let value = value(self)?;
+        let mut out = Vec::new();
+        ciborium::into_writer(&value, &mut out).expect("CBOR values always encode into memory");
+        Some(out)
+    }
+}
+
+fn node(value: Value, policy: DuplicateKeys) -> Result<Node, CanonicalizeError> {
+    Ok(match value {
+        Value::Null => Node::Null,
+        Value::Bool(value) => Node::Bool(value),
+        Value::Integer(value) => {
+            Node::Number(Number::from_literal(&i128::from(value).to_string())?)
+        }
+        Value::Float(value) => Node::Number(float(value)?),
+        Value::Text(text) => Node::String(text),
+        Value::Bytes(bytes) => bytes_node(&bytes),
+        Value::Tag(tag, value) => Node::Object(BTreeMap::from([
+            (TAG_KEY.to_string(), Node::Number(Number::from_literal(&tag.to_string())?)),
+            (TAG_VALUE_KEY.to_string(), node(*value, policy)?),
+        ])),
+        Value::Array(values) => Node::Array(
+            values.into_iter().map(|value| node(value, policy)).collect::<Result<_, _>>()?,
+        ),
+        Value::Map(entries) => {
+            let mut object = BTreeMap::new();
+            for (key, value) in entries {
+                let key = match key {
+                    Value::Text(text) => text,
+                    Value::Integer(value) => i128::from(value).to_string(),
+                    other => {
+                        return Err(decode_error(
+                            FORMAT,
+                            format_args!("unsupported map key {other:?}"),
+                        ))
+                    }
+                };
+                if keep_value(&object, &key, policy, FORMAT)? {
+                    object.insert(key, node(value, policy)?);
+                }
+            }
+            Node::Object(object)
+        }
+        other => return Err(decode_error(FORMAT, format_args!("unsupported item {other:?}"))),
+    })
+}
+
+fn value(node: &Node) -> Option<Value> {
+    Some(match node {
+        Node::Void => return None,
+        Node::Null => Value::Null,
+        Node::Bool(value) => Value::Bool(*value),
+        Node::Number(number) => number_value(number),
+        Node::String(text) => Value::Text(text.clone()),
+        Node::Array(values) => Value::Array(values.iter().map(value).collect::<Option<_>>()?),
+        Node::Object(map) => {
+            if let Some(bytes) = node_bytes(node) {
+                Value::Bytes(bytes)
+            } else if let Some((tag, tagged)) = tag(map) {
+                Value::Tag(tag, Box::new(value(tagged)?))
+            } else {
+                Value::Map(
+                    map.iter()
+                        .map(|(key, node)| Some((Value::Text(key.clone()), value(node)?)))
+                        .collect::<Option<_>>()?,
+                )
+            }
+        }
+    })
+}
+
+/// Returns the tag number and item of a `{"$tag": n, "$value": item}` object.
+fn tag(map: &BTreeMap<String, Node>) -> Option<(u64, &Node)> {
+    let (Some(Node::Number(tag)), Some(tagged)) = (map.get(TAG_KEY), map.get(TAG_VALUE_KEY)) else {
+        return None;
+    };
+    if map.len() != 2 || !tag.is_integer() {
+        return None;
+    }
+    let tag = match tag.literal() {
+        Some(literal) => literal.parse().ok()?,
+        None => u64::try_from(tag.get() as i128).ok()?,
+    };
+    Some((tag, tagged))
+}
+
+/// Writes integers that fit CBOR's 65-bit range as integers, keeping the
+/// digits of preserved literals, and everything else as a double.
+fn number_value(number: &Number) -> Value {
+    match integer(number).and_then(|value| Integer::try_from(value).ok()) {
+        Some(integer) => Value::Integer(integer),
+        None => Value::Float(number.get()),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    #[test]
+    fn documents_round_trip() {
+        let node = json(
+            r#"{"a":[1,-2,1.5,true,null,"x"],"big":18446744073709551615,
+                "raw":{"$bytes":"00ff"},"signed":{"$tag":18,"$value":[{"$bytes":""},{}]}}"#,
+        );
+        let bytes = node.to_cbor_vec().unwrap();
+        assert_eq!(Node::from_cbor_slice(&bytes).unwrap(), node);
+        assert_eq!(Node::Void.to_cbor_vec(), None);
+        assert_eq!(json("[1]").to_cbor_vec().unwrap(), [0x81, 0x01]);
+    }
+
+    #[test]
+    fn floats_stay_floats() {
+        let Node::Number(number) =
+            Node::from_cbor_slice(&json("1.0").to_cbor_vec().unwrap()).unwrap()
+        else {
+            panic!()
+        };
+        assert!(!number.is_integer());
+        assert_eq!(number.get(), 1.0);
+        // A half-precision NaN.
+        assert!(matches!(
+            Node::from_cbor_slice(&[0xf9, 0x7e, 0x00]),
+            Err(CanonicalizeError::NotFinite { .. })
+        ));
+    }
+
+    #[test]
+    fn integer_keys_read_as_text() {
+        // {1: -7, 4: h'01'}, a COSE header.
+        let bytes = [0xa2, 0x01, 0x26, 0x04, 0x41, 0x01];
+        let node = Node::from_cbor_slice(&bytes).unwrap();
+        assert_eq!(node, json(r#"{"1":-7,"4":{"$bytes":"01"}}"#));
+    }
+
+    #[test]
+    fn rejects_malformed_input() {
+        assert_eq!(Node::from_cbor_slice(&[]).unwrap(), Node::Void);
+        for bytes in [&[0x81][..], &[0x01, 0x02], &[0xa1, 0xf5, 0x01]] {
+            let err = Node::from_cbor_slice(bytes).unwrap_err();
+            assert!(err.to_string().starts_with("invalid CBOR: "), "{err}");
+        }
+        // {"a": 1, "a": 2}
+        let strict = ParseOptions::default().with_duplicate_keys(DuplicateKeys::Error);
+        let err =
+            Node::from_cbor_slice_with_options(&[0xa2, 0x61, b'a', 1, 0x61, b'a', 2], &strict)
+                .unwrap_err();
+        assert_eq!(err.to_string(), "invalid CBOR: duplicate key \"a\"");
+    }
+}
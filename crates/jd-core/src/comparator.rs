@@ -0,0 +1,132 @@
+//! Caller-supplied equality for specific paths or value types.
+//!
+//! A [`NodeComparator`] registered with [`DiffOptions::with_comparator`] is
+//! consulted before the built-in comparison whenever two values are compared:
+//! while diffing, when testing equality or hashing, and when a patch checks
+//! its context and removed values. Comparators see the path of the values
+//! being compared, so they can target a subtree, a kind of value, or both.
+//!
+//! [`DiffOptions::with_comparator`]: crate::DiffOptions::with_comparator
+
+use core::fmt;
+
+use crate::{HashCode, Node, Path};
+
+/// Customizes equality for the values a caller cares about.
+///
+/// [`equals`](NodeComparator::equals) returns `None` to defer to the default
+/// comparison, so a comparator only has to recognise the values it handles.
+/// Diffing and patching match list and set members by equality whenever a
+/// comparator is registered, but [`Node::hash_code`] only agrees with a
+/// comparator that also implements [`hash_code`](NodeComparator::hash_code).
+/// Implement both when values the comparator equates hash differently.
+///
+/// ```
+/// use jd_core::{hash_bytes, DiffOptions, HashCode, Node, NodeComparator, Path};
+///
+/// /// Compares URLs with their query parameters in any order.
+/// #[derive(Debug)]
+/// struct UrlQueryOrder;
+///
+/// fn normalized(node: &Node) -> Option<String> {
+///     let Node::String(url) = node else { return None };
+///     let (base, query) = url.split_once('?')?;
+///     let mut params: Vec<_> = query.split('&').collect();
+///     params.sort_unstable();
+///     Some(format!("{base}?{}", params.join("&")))
+/// }
+///
+/// impl NodeComparator for UrlQueryOrder {
+///     fn equals(&self, _path: &Path, lhs: &Node, rhs: &Node) -> Option<bool> {
+///         Some(normalized(lhs)? == normalized(rhs)?)
+///     }
+///
+///     fn hash_code(&self, _path: &Path, node: &Node) -> Option<HashCode> {
+///         normalized(node).map(|url| hash_bytes(url.as_bytes()))
+///     }
+/// }
+///
+/// let lhs = Node::from_json_str(r#"{"next":"https://x.io/?a=1&b=2","n":1}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"next":"https://x.io/?b=2&a=1","n":1}"#).unwrap();
+/// let opts = DiffOptions::default().with_comparator(UrlQueryOrder);
+/// assert!(lhs.diff(&rhs, &opts).is_empty());
+/// assert!(lhs.eq_with_options(&rhs, &opts));
+/// assert_eq!(lhs.hash_code(&opts), rhs.hash_code(&opts));
+/// ```
+pub trait NodeComparator: fmt::Debug + Send + Sync {
+    /// Decides whether `lhs` and `rhs`, both found at `path`, are equal, or
+    /// returns `None` to use the default comparison.
+    fn equals(&self, path: &Path, lhs: &Node, rhs: &Node) -> Option<bool>;
+
+    /// Returns a hash code for `node` at `path` that agrees with
+    /// [`equals`](NodeComparator::equals), or `None` to use the default hash.
+    fn hash_code(&self, path: &Path, node: &Node) -> Option<HashCode> {
+        let _ = (path, node);
+        None
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{ArrayMode, DiffOptions, PathSegment, RenderConfig};
+
+    /// Treats strings under `"tags"` as equal regardless of case.
+    #[derive(Debug)]
+    struct CaseInsensitiveTags;
+
+    impl NodeComparator for CaseInsensitiveTags {
+        fn equals(&self, path: &Path, lhs: &Node, rhs: &Node) -> Option<bool> {
+            if path.segments().first() != Some(&PathSegment::key("tags")) {
+                return None;
+            }
+            match (lhs, rhs) {
+                (Node::String(a), Node::String(b)) => Some(a.eq_ignore_ascii_case(b)),
+                _ => None,
+            }
+        }
+    }
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    #[test]
+    fn comparator_applies_only_where_it_answers() {
+        let lhs = node(r#"{"tags":["a","B"],"name":"x"}"#);
+        let rhs = node(r#"{"tags":["A","b","c"],"name":"X"}"#);
+        let options = DiffOptions::default().with_comparator(CaseInsensitiveTags);
+        assert_eq!(
+            lhs.diff(&rhs, &options).render(&RenderConfig::default()),
+            "@ [\"name\"]\n- \"x\"\n+ \"X\"\n@ [\"tags\",2]\n  \"b\"\n+ \"c\"\n]\n"
+        );
+    }
+
+    #[test]
+    fn comparator_matches_set_members() {
+        let options = DiffOptions::default()
+            .with_array_mode(ArrayMode::Set)
+            .unwrap()
+            .with_comparator(CaseInsensitiveTags);
+        let lhs = node(r#"{"tags":["a","b"]}"#);
+        let rhs = node(r#"{"tags":["B","A"]}"#);
+        assert!(lhs.eq_with_options(&rhs, &options));
+        assert!(lhs.diff(&rhs, &options).is_empty());
+    }
+
+    #[test]
+    fn patches_check_context_with_the_comparator() {
+        let base = node(r#"{"tags":["a","b","c"]}"#);
+        let diff = base.diff(&node(r#"{"tags":["a","x","c"]}"#), &DiffOptions::default());
+        let drifted = node(r#"{"tags":["A","B","C"]}"#);
+        assert!(drifted.apply_patch(&diff).is_err());
+        let options = DiffOptions::default().with_comparator(CaseInsensitiveTags);
+        let patched = drifted.apply_patch_with_options(&diff, &options).unwrap();
+        assert_eq!(patched, node(r#"{"tags":["A","x","C"]}"#));
+
+        let set = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+        let diff = base.diff(&node(r#"{"tags":["a","c"]}"#), &set);
+        let patched = drifted.apply_patch_with_options(&diff, &options).unwrap();
+        assert!(patched.eq_with_options(&node(r#"{"tags":["A","C"]}"#), &set));
+    }
+}
@@ -0,0 +1,144 @@
+//! Size limits that end a diff early.
+//!
+//! With [`DiffOptions::with_max_elements`] or [`DiffOptions::with_max_bytes`]
+//! set, [`diff_nodes`](super::diff_nodes) gives the options one budget for the
+//! whole run. Each place that builds hunks spends them on the budget, and the
+//! loops over object keys, list hunks, and set members stop once it is spent
+//! or the options' [`CancellationToken`](crate::CancellationToken) is
+//! cancelled.
+//! Hunks are built in the order the diff lists them, so the hunks found
+//! before the budget ran out are the first hunks of the full diff.
+
+use core::sync::atomic::{AtomicBool, AtomicUsize, Ordering};
+
+use super::{path_to_json, render_element_native, Diff, DiffElement, RenderConfig};
+use crate::prelude::*;
+use crate::DiffOptions;
+
+/// Counts the hunks and rendered bytes of one diff against its limits.
+#[derive(Debug)]
+pub(crate) struct DiffBudget {
+    max_elements: Option<usize>,
+    max_bytes: Option<usize>,
+    elements: AtomicUsize,
+    bytes: AtomicUsize,
+    spent: AtomicBool,
+}
+
+impl DiffBudget {
+    pub(crate) fn new(max_elements: Option<usize>, max_bytes: Option<usize>) -> Self {
+        Self {
+            max_elements,
+            max_bytes,
+            elements: AtomicUsize::new(0),
+            bytes: AtomicUsize::new(0),
+            spent: AtomicBool::new(false),
+        }
+    }
+
+    /// Counts `elements` and records whether the diff has outgrown a limit.
+    fn spend<'a>(&self, elements: impl IntoIterator<Item = &'a DiffElement>) {
+        for element in elements {
+            let count = self.elements.fetch_add(1, Ordering::Relaxed) + 1;
+            let over_bytes = self.max_bytes.is_some_and(|max| {
+                let size = size(element);
+                self.bytes.fetch_add(size, Ordering::Relaxed) + size > max
+            });
+            if over_bytes || self.max_elements.is_some_and(|max| count > max) {
+                self.spent.store(true, Ordering::Relaxed);
+            }
+        }
+    }
+
+    fn is_spent(&self) -> bool {
+        self.spent.load(Ordering::Relaxed)
+    }
+}
+
+impl DiffOptions {
+    /// Counts hunks just built against the size limits of the diff, if any.
+    pub(crate) fn spend<'a>(&self, elements: impl IntoIterator<Item = &'a DiffElement>) {
+        if let Some(budget) = self.budget() {
+            budget.spend(elements);
+        }
+    }
+
+    /// Reports whether the diff has outgrown its size limits, so the caller
+    /// should stop looking for more hunks.
+    pub(crate) fn is_spent(&self) -> bool {
+        self.is_cancelled() || self.budget().is_some_and(DiffBudget::is_spent)
+    }
+}
+
+/// Cuts a diff built under `options` to its size limits, marking it truncated
+/// when hunks were left out. A cancelled diff is dropped whole.
+pub(super) fn truncate(diff: Diff, options: &DiffOptions) -> Diff {
+    if options.is_cancelled() {
+        // Hunks found before cancelling may come from a partial alignment.
+        let mut diff = Diff::empty();
+        diff.truncated = true;
+        return diff;
+    }
+    let Some(budget) = options.budget() else {
+        return diff;
+    };
+    let mut elements = diff.into_elements();
+    let mut bytes = 0;
+    let fits = elements.iter().position(|element| {
+        bytes += budget.max_bytes.map_or(0, |_| size(element));
+        budget.max_bytes.is_some_and(|max| bytes > max)
+    });
+    let keep = fits.unwrap_or(elements.len()).min(budget.max_elements.unwrap_or(usize::MAX));
+    let truncated = budget.is_spent() || keep < elements.len();
+    elements.truncate(keep);
+    let mut diff = Diff::from_elements(elements);
+    diff.truncated = truncated;
+    diff
+}
+
+/// Returns the length of the native rendering of `element`, with the header
+/// of a move.
+fn size(element: &DiffElement) -> usize {
+    let header = element
+        .moved_from
+        .as_ref()
+        .map_or(0, |from| format!("^ {{\"from\":{}}}\n", path_to_json(from)).len());
+    header + render_element_native(element, &RenderConfig::default(), false).len()
+}
+
+#[cfg(test)]
+mod tests {
+    use crate::{ArrayMode, DiffOptions, Node, RenderConfig};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    #[test]
+    fn truncated_diffs_keep_the_first_hunks_of_the_full_diff() {
+        let lhs = json(r#"{"a":[1,2,{"x":1,"y":[1,2]},4],"b":{"c":1,"d":2},"e":1}"#);
+        let rhs = json(r#"{"a":[0,2,{"x":2,"y":[1,3]},5],"b":{"c":2},"f":1}"#);
+        let full = lhs.diff(&rhs, &DiffOptions::default()).into_elements();
+        for max in 0..full.len() {
+            let diff = lhs.diff(&rhs, &DiffOptions::default().with_max_elements(max));
+            assert!(diff.is_truncated());
+            assert_eq!(diff.into_elements(), full[..max]);
+        }
+        let whole = lhs.diff(&rhs, &DiffOptions::default().with_max_elements(full.len()));
+        assert!(!whole.is_truncated());
+        assert_eq!(whole.into_elements(), full);
+    }
+
+    #[test]
+    fn byte_limits_count_the_native_rendering() {
+        let lhs = json(r#"{"tags":["a","b"],"n":1}"#);
+        let rhs = json(r#"{"tags":["c"],"n":2}"#);
+        let options = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+        let full = lhs.diff(&rhs, &options).render(&RenderConfig::default());
+        let diff = lhs.diff(&rhs, &options.clone().with_max_bytes(full.len()));
+        assert!(!diff.is_truncated());
+        let diff = lhs.diff(&rhs, &options.with_max_bytes(full.len() - 1));
+        assert!(diff.is_truncated());
+        assert_eq!(diff.render(&RenderConfig::default()), "@ [\"n\"]\n- 1\n+ 2\n");
+    }
+}
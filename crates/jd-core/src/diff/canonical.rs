@@ -0,0 +1,198 @@
+//! Canonical form of diffs, the basis of [`Diff::equivalent`].
+//!
+//! Different strategies, options, or versions of jd can write the same change
+//! as different hunks: a move instead of a removal and an insertion, hunks
+//! on separate keys in another order, metadata restated or left implicit.
+//! The canonical form picks one spelling for all of them, so two diffs with
+//! the same canonical form have the same effect on any document.
+
+use core::cmp::Ordering;
+
+use super::simplify::disjoint;
+use super::{Diff, DiffElement, DiffMetadata, Path, PathSegment};
+
+use crate::prelude::*;
+
+impl Diff {
+    /// Returns the canonical form of the diff: moves are split into a
+    /// removal and an insertion, the result is [simplified](Diff::simplify),
+    /// hunks on separate object keys are ordered by key, the values of set
+    /// and multiset hunks are sorted, and metadata is stated once wherever
+    /// it changes. Hunks whose order matters keep it.
+    ///
+    /// The canonical form does not look at the documents a diff applies to,
+    /// so list hunks aligned differently by two strategies stay different.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, RenderConfig};
+    /// let diff = Diff::from_native_str("@ [\"b\"]\n+ 2\n@ [\"a\"]\n- 1\n").unwrap();
+    /// assert_eq!(diff.canonicalize().render(&RenderConfig::default()), "@ [\"a\"]\n- 1\n@ [\"b\"]\n+ 2\n");
+    /// ```
+    #[must_use]
+    pub fn canonicalize(&self) -> Diff {
+        let mut elements = self.without_moves().simplify().into_elements();
+        loop {
+            for element in &mut elements {
+                sort_members(element);
+            }
+            let ordered = order(&elements);
+            // Every rewrite of `simplify` drops a hunk, so this ends.
+            let simplified = Diff::from_elements(ordered.clone()).simplify().into_elements();
+            if simplified == ordered {
+                return Diff::from_elements(ordered);
+            }
+            elements = simplified;
+        }
+    }
+
+    /// Returns whether the two diffs have the same canonical form, and so
+    /// make the same change even when they spell it differently. `==` stays
+    /// structural: it compares the hunks as written.
+    ///
+    /// ```
+    /// # use jd_core::Diff;
+    /// let lhs = Diff::from_native_str("@ [\"b\"]\n+ 2\n@ [\"a\"]\n- 1\n").unwrap();
+    /// let rhs = Diff::from_native_str("@ [\"a\"]\n- 1\n@ [\"b\"]\n+ 2\n").unwrap();
+    /// assert!(lhs.equivalent(&rhs));
+    /// assert_ne!(lhs, rhs);
+    /// ```
+    #[must_use]
+    pub fn equivalent(&self, other: &Diff) -> bool {
+        self.truncated == other.truncated
+            && (self.elements == other.elements
+                || self.canonicalize().elements == other.canonicalize().elements)
+    }
+}
+
+/// Sorts the values a set or multiset hunk removes and adds, which apply in
+/// any order.
+fn sort_members(element: &mut DiffElement) {
+    if matches!(element.path.segments().last(), Some(PathSegment::Set | PathSegment::MultiSet)) {
+        let key = |node: &crate::Node| node.to_json_value().map(|value| value.to_string());
+        element.remove.sort_by_cached_key(key);
+        element.add.sort_by_cached_key(key);
+    }
+}
+
+/// Reorders hunks so that, of those free to go next, the one at the smallest
+/// key always comes first, and restates metadata where it changes. A hunk is
+/// free to go next once every earlier hunk on a related path, or under other
+/// metadata, has gone.
+fn order(elements: &[DiffElement]) -> Vec<DiffElement> {
+    let mut inherited: Option<DiffMetadata> = None;
+    let scopes: Vec<Option<DiffMetadata>> = elements
+        .iter()
+        .map(|element| {
+            if let Some(metadata) = element.metadata.as_ref().filter(|meta| meta.is_effective()) {
+                inherited.get_or_insert_with(DiffMetadata::default).absorb(metadata);
+            }
+            inherited.clone()
+        })
+        .collect();
+    let depends = |earlier: usize, later: usize| {
+        scopes[earlier] != scopes[later]
+            || !disjoint(&elements[earlier].path, &elements[later].path)
+    };
+
+    let mut waiting: Vec<usize> = (0..elements.len())
+        .map(|later| (0..later).filter(|&earlier| depends(earlier, later)).count())
+        .collect();
+    let mut done = vec![false; elements.len()];
+    let mut ordered = Vec::with_capacity(elements.len());
+    let mut stated: Option<&DiffMetadata> = None;
+    while ordered.len() < elements.len() {
+        let Some(next) = (0..elements.len())
+            .filter(|&index| !done[index] && waiting[index] == 0)
+            .min_by(|&lhs, &rhs| key_order(&elements[lhs].path, &elements[rhs].path))
+        else {
+            break;
+        };
+        done[next] = true;
+        for later in next + 1..elements.len() {
+            if !done[later] && depends(next, later) {
+                waiting[later] -= 1;
+            }
+        }
+
+        let scope = scopes[next].as_ref();
+        let metadata = (scope != stated).then(|| scope.cloned()).flatten();
+        stated = scope;
+        ordered.push(DiffElement { metadata, ..elements[next].clone() });
+    }
+    ordered
+}
+
+/// Orders paths by the object keys at which they part; paths that do not
+/// part at keys compare equal.
+fn key_order(lhs: &Path, rhs: &Path) -> Ordering {
+    let parted = lhs.segments().iter().zip(rhs.segments()).find(|(lhs, rhs)| lhs != rhs);
+    match parted {
+        Some((PathSegment::Key(lhs), PathSegment::Key(rhs))) => lhs.cmp(rhs),
+        _ => Ordering::Equal,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffOptions, Node, RenderConfig};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn native(text: &str) -> Diff {
+        Diff::from_native_str(text).unwrap()
+    }
+
+    #[test]
+    fn moves_equal_their_removal_and_insertion() {
+        let lhs = json(r#"{"l":[1,2,3,4,5]}"#);
+        let rhs = json(r#"{"l":[5,1,2,3,4]}"#);
+        let moved = lhs.diff(&rhs, &DiffOptions::default().with_move_detection(true));
+        let plain = lhs.diff(&rhs, &DiffOptions::default());
+        assert!(moved.iter().any(|element| element.moved_from.is_some()));
+        let canonical = moved.canonicalize();
+        assert!(canonical.iter().all(|element| element.moved_from.is_none()));
+        assert_eq!(lhs.apply_patch(&canonical).unwrap(), rhs);
+        assert_eq!(lhs.apply_patch(&plain.canonicalize()).unwrap(), rhs);
+    }
+
+    #[test]
+    fn independent_hunks_sort_by_key_and_related_ones_keep_their_order() {
+        let diff = native(concat!(
+            "@ [\"b\",0]\n[\n- 1\n]\n",
+            "@ [\"a\"]\n- 1\n",
+            "@ [\"b\",0]\n[\n+ 2\n",
+        ));
+        let canonical = diff.canonicalize();
+        assert_eq!(
+            canonical.render(&RenderConfig::default()),
+            "@ [\"a\"]\n- 1\n@ [\"b\",0]\n[\n- 1\n+ 2\n]\n"
+        );
+        assert_eq!(canonical.canonicalize().into_elements(), canonical.into_elements());
+    }
+
+    #[test]
+    fn metadata_scopes_stay_in_order() {
+        let lhs = native("@ [\"b\"]\n- 1\n+ 2\n^ {\"precision\":0.5}\n@ [\"a\"]\n- 1\n+ 2\n");
+        let rhs = native("^ {\"precision\":0.5}\n@ [\"a\"]\n- 1\n+ 2\n@ [\"b\"]\n- 1\n+ 2\n");
+        assert!(!lhs.equivalent(&rhs));
+
+        let restated = native("@ [\"b\"]\n- 1\n+ 2\n^ {\"precision\":0.5}\n@ [\"a\"]\n- 1\n+ 2\n^ {\"precision\":0.5}\n@ [\"c\"]\n+ 3\n");
+        let stated = native(
+            "@ [\"b\"]\n- 1\n+ 2\n^ {\"precision\":0.5}\n@ [\"a\"]\n- 1\n+ 2\n@ [\"c\"]\n+ 3\n",
+        );
+        assert!(restated.equivalent(&stated));
+        assert_ne!(restated, stated);
+    }
+
+    #[test]
+    fn set_values_compare_in_any_order() {
+        let lhs = native("@ [\"tags\",{}]\n- \"a\"\n- \"b\"\n+ \"c\"\n+ \"d\"\n");
+        let rhs = native("@ [\"tags\",{}]\n- \"b\"\n- \"a\"\n+ \"d\"\n+ \"c\"\n");
+        assert!(lhs.equivalent(&rhs));
+        let base = json(r#"{"tags":["a","b"]}"#);
+        assert_eq!(base.apply_patch(&lhs.canonicalize()).unwrap(), base.apply_patch(&rhs).unwrap());
+    }
+}
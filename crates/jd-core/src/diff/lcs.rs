@@ -0,0 +1,352 @@
+//! Longest common subsequence of two hash sequences in bounded memory.
+//!
+//! The alignment must match Go `jd`, which backtracks a full dynamic
+//! programming table from the end: a pair of equal elements is matched, and
+//! otherwise the lhs element is dropped when that does not shorten the
+//! subsequence. Small inputs still do exactly that. Larger ones split the
+//! lhs in the style of Hirschberg: the table row at the midpoint is computed
+//! in linear space, the lower half is backtracked from it first, and the
+//! upper half then continues from the column where the path crossed. Only
+//! one row per level of recursion is kept, so memory grows with
+//! `rhs.len() * log(lhs.len())` instead of `lhs.len() * rhs.len()`, and the
+//! result is identical to the full table.
+//!
+//! Unlike Hirschberg's algorithm, the split does not halve the columns: the
+//! lower half is recomputed across every column up to where the path
+//! starts. Each level therefore redoes up to half of the `n * m` cells, and
+//! time is O(n * m * log n) in the worst case, with about
+//! `log2(n * m / MAX_TABLE_CELLS)` levels before the pieces are small enough
+//! for a full table. Lists whose product exceeds the alignment cost limit are
+//! aligned in near-linear time instead, at the price of a common subsequence
+//! that may not be the longest.
+
+use alloc::collections::VecDeque;
+use hashbrown::{HashMap, HashSet};
+
+use crate::hash::HashCode;
+use crate::prelude::*;
+use crate::CancellationToken;
+
+/// Largest table, in cells, that is built in full before splitting.
+const MAX_TABLE_CELLS: usize = 1 << 20;
+
+/// Returns the hashes of the longest common subsequence of `lhs` and `rhs`.
+///
+/// Before any table is built the lists are shrunk: a shared prefix and
+/// suffix are matched outright, elements whose hash never occurs on the
+/// other side are set aside, and the prefix and suffix of what remains are
+/// matched again. None of this changes which hashes the full backtrack
+/// picks, but a list where most elements are unchanged leaves little or
+/// nothing for the table.
+///
+/// When what remains costs more than `max_cost` (see [`alignment_cost`]),
+/// or once `cancel` is cancelled, the result is only some common
+/// subsequence.
+pub(super) fn longest_common_subsequence(
+    lhs: &[HashCode],
+    rhs: &[HashCode],
+    max_cost: u64,
+    cancel: Option<&CancellationToken>,
+) -> Vec<HashCode> {
+    let (lhs_mid, rhs_mid, outer) = trim(lhs, rhs);
+    let lhs_buckets: HashSet<&HashCode> = lhs_mid.iter().collect();
+    let rhs_buckets: HashSet<&HashCode> = rhs_mid.iter().collect();
+    let lhs_shared: Vec<HashCode> =
+        lhs_mid.iter().filter(|hash| rhs_buckets.contains(hash)).copied().collect();
+    let rhs_shared: Vec<HashCode> =
+        rhs_mid.iter().filter(|hash| lhs_buckets.contains(hash)).copied().collect();
+    let (lhs_core, rhs_core, inner) = trim(&lhs_shared, &rhs_shared);
+
+    let mut common = Vec::with_capacity(outer.len() + inner.len());
+    common.extend_from_slice(outer.prefix);
+    common.extend_from_slice(inner.prefix);
+    common.extend(
+        lcs_pairs(lhs_core, rhs_core, max_cost, cancel).into_iter().map(|(i, _)| lhs_core[i]),
+    );
+    common.extend_from_slice(inner.suffix);
+    common.extend_from_slice(outer.suffix);
+    common
+}
+
+/// The matched ends of two lists.
+struct Ends<'a> {
+    prefix: &'a [HashCode],
+    suffix: &'a [HashCode],
+}
+
+impl Ends<'_> {
+    fn len(&self) -> usize {
+        self.prefix.len() + self.suffix.len()
+    }
+}
+
+/// Splits off the longest shared prefix and suffix, returning the middle of
+/// each list and the shared ends.
+fn trim<'a>(
+    lhs: &'a [HashCode],
+    rhs: &'a [HashCode],
+) -> (&'a [HashCode], &'a [HashCode], Ends<'a>) {
+    let prefix = lhs.iter().zip(rhs).take_while(|(a, b)| a == b).count();
+    let (prefix, lhs) = lhs.split_at(prefix);
+    let rhs = &rhs[prefix.len()..];
+    let suffix = lhs.iter().rev().zip(rhs.iter().rev()).take_while(|(a, b)| a == b).count();
+    let (lhs, suffix) = lhs.split_at(lhs.len() - suffix);
+    let rhs = &rhs[..rhs.len() - suffix.len()];
+    (lhs, rhs, Ends { prefix, suffix })
+}
+
+/// Returns the `(lhs, rhs)` index pairs of a longest common subsequence, or
+/// of some common subsequence when aligning the lists would cost more than
+/// `max_cost` or once `cancel` is cancelled.
+pub(super) fn lcs_pairs(
+    lhs: &[HashCode],
+    rhs: &[HashCode],
+    max_cost: u64,
+    cancel: Option<&CancellationToken>,
+) -> Vec<(usize, usize)> {
+    if alignment_cost(lhs.len(), rhs.len()) > max_cost {
+        return cheap_pairs(lhs, rhs);
+    }
+    pairs_within(lhs, rhs, MAX_TABLE_CELLS, cancel)
+}
+
+/// Estimates the work of aligning lists of the given lengths: one
+/// comparison per pair of elements.
+fn alignment_cost(lhs_len: usize, rhs_len: usize) -> u64 {
+    (lhs_len as u64).saturating_mul(rhs_len as u64)
+}
+
+/// Returns the pairs of a common subsequence found in near-linear time.
+/// Elements unique to both sides are matched first, taking their longest
+/// in-order run as patience alignment does; between two such anchors each
+/// lhs element takes the first equal rhs element after the previous match.
+fn cheap_pairs(lhs: &[HashCode], rhs: &[HashCode]) -> Vec<(usize, usize)> {
+    let mut pairs = Vec::new();
+    let (mut i_start, mut j_start) = (0, 0);
+    for (i, j) in super::patience::unique_anchors(lhs, rhs) {
+        greedy_pairs(&lhs[i_start..i], &rhs[j_start..j], i_start, j_start, &mut pairs);
+        pairs.push((i, j));
+        (i_start, j_start) = (i + 1, j + 1);
+    }
+    greedy_pairs(&lhs[i_start..], &rhs[j_start..], i_start, j_start, &mut pairs);
+    pairs
+}
+
+fn greedy_pairs(
+    lhs: &[HashCode],
+    rhs: &[HashCode],
+    lhs_offset: usize,
+    rhs_offset: usize,
+    pairs: &mut Vec<(usize, usize)>,
+) {
+    let mut positions: HashMap<&HashCode, VecDeque<usize>> = HashMap::new();
+    for (j, hash) in rhs.iter().enumerate() {
+        positions.entry(hash).or_default().push_back(j);
+    }
+    let mut next = 0;
+    for (i, hash) in lhs.iter().enumerate() {
+        let Some(queue) = positions.get_mut(hash) else {
+            continue;
+        };
+        while queue.front().is_some_and(|j| *j < next) {
+            queue.pop_front();
+        }
+        if let Some(j) = queue.pop_front() {
+            pairs.push((lhs_offset + i, rhs_offset + j));
+            next = j + 1;
+        }
+    }
+}
+
+fn pairs_within(
+    lhs: &[HashCode],
+    rhs: &[HashCode],
+    max_cells: usize,
+    cancel: Option<&CancellationToken>,
+) -> Vec<(usize, usize)> {
+    let mut pairs = Vec::new();
+    let first = vec![0; rhs.len() + 1];
+    Rows { lhs, rhs, max_cells, cancel }.backtrack(0, &first, lhs.len(), rhs.len(), &mut pairs);
+    pairs.reverse();
+    pairs
+}
+
+struct Rows<'a> {
+    lhs: &'a [HashCode],
+    rhs: &'a [HashCode],
+    max_cells: usize,
+    cancel: Option<&'a CancellationToken>,
+}
+
+impl Rows<'_> {
+    /// Backtracks from `(hi, col)` until the path reaches row `lo`, whose
+    /// table row is `top`, pushing matched pairs in reverse. Returns the
+    /// column at which the path reached row `lo`.
+    fn backtrack(
+        &self,
+        lo: usize,
+        top: &[usize],
+        hi: usize,
+        col: usize,
+        pairs: &mut Vec<(usize, usize)>,
+    ) -> usize {
+        if hi == lo || col == 0 {
+            return col;
+        }
+        if (hi - lo + 1) * (col + 1) > self.max_cells && hi - lo > 1 {
+            let mid = lo + (hi - lo) / 2;
+            let crossing = {
+                let mut row = top[..=col].to_vec();
+                for i in lo..mid {
+                    if self.is_cancelled() {
+                        return col;
+                    }
+                    row = self.next_row(i, &row);
+                }
+                self.backtrack(mid, &row, hi, col, pairs)
+            };
+            return self.backtrack(lo, top, mid, crossing, pairs);
+        }
+
+        let mut table = Vec::with_capacity(hi - lo + 1);
+        table.push(top[..=col].to_vec());
+        for i in lo..hi {
+            if self.is_cancelled() {
+                return col;
+            }
+            let next = self.next_row(i, &table[i - lo]);
+            table.push(next);
+        }
+        let (mut i, mut j) = (hi, col);
+        while i > lo && j > 0 {
+            if self.lhs[i - 1] == self.rhs[j - 1] {
+                pairs.push((i - 1, j - 1));
+                i -= 1;
+                j -= 1;
+            } else if table[i - 1 - lo][j] >= table[i - lo][j - 1] {
+                i -= 1;
+            } else {
+                j -= 1;
+            }
+        }
+        j
+    }
+
+    fn is_cancelled(&self) -> bool {
+        self.cancel.is_some_and(CancellationToken::is_cancelled)
+    }
+
+    /// Computes the table row after lhs element `i` from the row before it.
+    fn next_row(&self, i: usize, row: &[usize]) -> Vec<usize> {
+        let mut next = vec![0; row.len()];
+        for j in 1..row.len() {
+            next[j] = if self.lhs[i] == self.rhs[j - 1] {
+                row[j - 1] + 1
+            } else {
+                row[j].max(next[j - 1])
+            };
+        }
+        next
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn hashes(values: &[u8]) -> Vec<HashCode> {
+        values.iter().map(|value| [*value; 8]).collect()
+    }
+
+    /// The full-table backtrack the split version must reproduce.
+    fn full_table(lhs: &[HashCode], rhs: &[HashCode]) -> Vec<(usize, usize)> {
+        pairs_within(lhs, rhs, usize::MAX, None)
+    }
+
+    #[test]
+    fn finds_a_longest_common_subsequence() {
+        let (lhs, rhs) = (hashes(b"abcbdab"), hashes(b"bdcaba"));
+        assert_eq!(longest_common_subsequence(&lhs, &rhs, u64::MAX, None), hashes(b"bcba"));
+        assert!(lcs_pairs(&lhs, &[], u64::MAX, None).is_empty());
+        assert!(lcs_pairs(&[], &rhs, u64::MAX, None).is_empty());
+    }
+
+    #[test]
+    fn splitting_keeps_the_full_table_alignment() {
+        // A small generator keeps the test deterministic without extra
+        // dependencies; three symbols give plenty of ties to break.
+        let mut state = 0x2545_f491_u64;
+        let mut next = |len: usize| -> Vec<HashCode> {
+            (0..len)
+                .map(|_| {
+                    state = state.wrapping_mul(6_364_136_223_846_793_005).wrapping_add(1);
+                    [b'a' + (state >> 62) as u8 % 3; 8]
+                })
+                .collect()
+        };
+        for round in 0..200 {
+            let (lhs, rhs) = (next(round % 23), next(round % 17 + 3));
+            let expected = full_table(&lhs, &rhs);
+            for max_cells in [1, 4, 16] {
+                assert_eq!(pairs_within(&lhs, &rhs, max_cells, None), expected, "round {round}");
+            }
+        }
+    }
+
+    #[test]
+    fn cancelled_alignments_stop_before_building_rows() {
+        let token = CancellationToken::new();
+        token.cancel();
+        let (lhs, rhs) = (hashes(b"abcab"), hashes(b"cbacb"));
+        assert!(lcs_pairs(&lhs, &rhs, u64::MAX, Some(&token)).is_empty());
+    }
+
+    #[test]
+    fn shrinking_keeps_the_full_table_hashes() {
+        let mut state = 0x9e37_79b9_u64;
+        let mut next = |len: usize, symbols: &[u8]| -> Vec<HashCode> {
+            (0..len)
+                .map(|_| {
+                    state = state.wrapping_mul(6_364_136_223_846_793_005).wrapping_add(1);
+                    [symbols[(state >> 33) as usize % symbols.len()]; 8]
+                })
+                .collect()
+        };
+        for round in 0..500 {
+            let lhs = next(round % 29, b"abcdexy");
+            let rhs = next(round % 31, b"abcfgxy");
+            let expected: Vec<HashCode> =
+                full_table(&lhs, &rhs).into_iter().map(|(i, _)| lhs[i]).collect();
+            assert_eq!(
+                longest_common_subsequence(&lhs, &rhs, u64::MAX, None),
+                expected,
+                "round {round}"
+            );
+        }
+    }
+
+    #[test]
+    fn alignments_over_the_cost_limit_fall_back_to_a_cheaper_subsequence() {
+        let (lhs, rhs) = (hashes(b"abcdefgh"), hashes(b"hgfedcba"));
+        assert_eq!(lcs_pairs(&lhs, &rhs, 63, None).len(), 1);
+        // Unique elements anchor the fallback and repeated ones fill the gaps
+        // in order.
+        let (lhs, rhs) = (hashes(b"xaxbxcx"), hashes(b"xxaxbxc"));
+        let pairs = lcs_pairs(&lhs, &rhs, 1, None);
+        assert_eq!(pairs, [(0, 0), (1, 2), (2, 3), (3, 4), (4, 5), (5, 6)]);
+        // Only what remains after shrinking counts against the limit, so
+        // these align exactly.
+        let (lhs, rhs) = (hashes(b"abcXYZdef"), hashes(b"abcZYXdef"));
+        let exact = longest_common_subsequence(&lhs, &rhs, u64::MAX, None);
+        assert_eq!(longest_common_subsequence(&lhs, &rhs, 9, None), exact);
+    }
+
+    #[test]
+    fn large_lists_align_without_a_full_table() {
+        let lhs: Vec<HashCode> = (0..4_000u64).map(|i| (i % 1000).to_be_bytes()).collect();
+        let mut rhs = lhs.clone();
+        rhs.remove(10);
+        rhs.insert(3_000, [0xff; 8]);
+        assert_eq!(lcs_pairs(&lhs, &rhs, u64::MAX, None).len(), lhs.len() - 1);
+    }
+}
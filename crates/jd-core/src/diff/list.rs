@@ -1,141 +1,288 @@
+use alloc::borrow::Cow;
+
+use super::lcs::longest_common_subsequence;
+use super::similarity::{self, Step};
+use super::tolerance::{needs_classes, ToleranceClasses};
 use super::{diff_impl, Diff, DiffElement, Path, PathSegment};
+use super::{moves, patience};
 use crate::hash::HashCode;
-use crate::{DiffOptions, Node};
+use crate::node::list_segment;
+use crate::prelude::*;
+use crate::{DiffOptions, ListAlignment, Node};
 
 pub(super) fn diff_lists(lhs: &[Node], rhs: &[Node], path: &Path, options: &DiffOptions) -> Diff {
-    let lhs_hashes: Vec<HashCode> = lhs.iter().map(|node| node.hash_code(options)).collect();
-    let rhs_hashes: Vec<HashCode> = rhs.iter().map(|node| node.hash_code(options)).collect();
-    let common = longest_common_subsequence(&lhs_hashes, &rhs_hashes);
-    let path_with_placeholder = path.clone().with_segment(PathSegment::index(0));
-    let elements = diff_rest(
-        lhs,
-        rhs,
-        0,
-        path_with_placeholder,
-        &lhs_hashes,
-        &rhs_hashes,
-        &common,
-        &Node::Void,
-        options,
-    );
+    if let Some(tracker) = options.tracker() {
+        tracker.aligned(lhs.len() + rhs.len());
+    }
+    let (lhs_hashes, rhs_hashes) = if needs_classes(options) {
+        let mut classes = ToleranceClasses::new();
+        (
+            classified_hashes(lhs, options, &mut classes),
+            classified_hashes(rhs, options, &mut classes),
+        )
+    } else {
+        (element_hashes(lhs, options), element_hashes(rhs, options))
+    };
+    let moves = options
+        .detects_moves()
+        .then(|| {
+            let common = longest_common_subsequence(
+                &lhs_hashes,
+                &rhs_hashes,
+                options.max_alignment_cost(),
+                options.cancellation(),
+            );
+            moves::detect(lhs, path, &lhs_hashes, &rhs_hashes, &common, options.context_size())
+        })
+        .flatten();
+    let Some(moves) = moves else {
+        return Diff::from_elements(diff_sequence(
+            lhs,
+            rhs,
+            path,
+            &lhs_hashes,
+            &rhs_hashes,
+            options,
+        ));
+    };
+    // Diff the list as it is once the moves are applied.
+    let moved: Vec<Node> = moves.order.iter().map(|index| lhs[*index].clone()).collect();
+    let moved_hashes: Vec<HashCode> = moves.order.iter().map(|index| lhs_hashes[*index]).collect();
+    options.spend(&moves.elements);
+    let mut elements = moves.elements;
+    elements.extend(diff_sequence(&moved, rhs, path, &moved_hashes, &rhs_hashes, options));
     Diff::from_elements(elements)
 }
 
-#[allow(clippy::too_many_arguments)]
-fn diff_rest(
+fn diff_sequence(
     lhs: &[Node],
     rhs: &[Node],
-    path_index: i64,
-    path: Path,
+    path: &Path,
     lhs_hashes: &[HashCode],
     rhs_hashes: &[HashCode],
-    common: &[HashCode],
-    previous: &Node,
     options: &DiffOptions,
 ) -> Vec<DiffElement> {
-    let mut a_cursor = 0usize;
-    let mut b_cursor = 0usize;
-    let mut common_cursor = 0usize;
+    let path_with_placeholder = path.clone().with_segment(PathSegment::index(0));
+    let (lhs_keys, rhs_keys, common) = match options.list_alignment() {
+        ListAlignment::Lcs => (
+            Cow::Borrowed(lhs_hashes),
+            Cow::Borrowed(rhs_hashes),
+            longest_common_subsequence(
+                lhs_hashes,
+                rhs_hashes,
+                options.max_alignment_cost(),
+                options.cancellation(),
+            ),
+        ),
+        ListAlignment::Patience => {
+            let pairs = patience::align(
+                lhs_hashes,
+                rhs_hashes,
+                options.max_alignment_cost(),
+                options.cancellation(),
+            );
+            let (lhs_keys, rhs_keys, common) = patience::keys(&pairs, lhs.len(), rhs.len());
+            (Cow::Owned(lhs_keys), Cow::Owned(rhs_keys), common)
+        }
+    };
+    diff_rest(lhs, rhs, 0, path_with_placeholder, &lhs_keys, &rhs_keys, &common, options)
+}
+
+/// Emits one hunk per pass, up to and including the next common element,
+/// then continues with the rest of both lists.
+#[allow(clippy::too_many_arguments)]
+fn diff_rest(
+    mut lhs: &[Node],
+    mut rhs: &[Node],
+    path_index: i64,
+    mut path: Path,
+    mut lhs_hashes: &[HashCode],
+    mut rhs_hashes: &[HashCode],
+    mut common: &[HashCode],
+    options: &DiffOptions,
+) -> Vec<DiffElement> {
+    let mut hunks = Vec::new();
     let mut path_cursor = path_index;
-    let path_len = path.len();
+    let size = options.context_size();
+    // The whole target list and how much of it earlier passes consumed:
+    // the context before a hunk is the target's, as earlier hunks have
+    // already been applied when it patches.
+    let target = rhs;
+    let mut consumed = 0usize;
+    let threshold = options.similarity_threshold();
+    loop {
+        let mut a_cursor = 0usize;
+        let mut b_cursor = 0usize;
+        let mut common_cursor = 0usize;
+        let path_len = path.len();
+        // Whether `diff` starts with this pass's own hunk rather than the
+        // hunks of a nested diff.
+        let mut own = true;
+        // Where the gaps before the next common element end, once needed.
+        let mut gaps = None;
 
-    let mut diff = vec![DiffElement::new()
-        .with_path(path_now(&path, path_cursor))
-        .with_before(vec![previous.clone()])];
+        let mut diff = vec![DiffElement::new()
+            .with_path(path_now(&path, path_cursor))
+            .with_before(before_context(consumed, size, |index| target[index].clone()))];
 
-    loop {
-        match () {
-            _ if a_cursor == lhs.len() => {
-                while b_cursor < rhs.len() {
-                    diff[0].add.push(rhs[b_cursor].clone());
-                    b_cursor += 1;
-                    path_cursor += 2;
+        loop {
+            match () {
+                _ if a_cursor == lhs.len() => {
+                    while b_cursor < rhs.len() {
+                        diff[0].add.push(rhs[b_cursor].clone());
+                        b_cursor += 1;
+                        path_cursor += 2;
+                    }
+                    break;
                 }
-                break;
-            }
-            _ if b_cursor == rhs.len() => {
-                while a_cursor < lhs.len() {
-                    diff[0].remove.push(lhs[a_cursor].clone());
-                    a_cursor += 1;
+                _ if b_cursor == rhs.len() => {
+                    while a_cursor < lhs.len() {
+                        diff[0].remove.push(lhs[a_cursor].clone());
+                        a_cursor += 1;
+                    }
+                    break;
                 }
-                break;
-            }
-            _ if at_common(lhs_hashes, a_cursor, common)
-                && at_common(rhs_hashes, b_cursor, common) =>
-            {
-                a_cursor += 1;
-                b_cursor += 1;
-                common_cursor += 1;
-                path_cursor += 1;
-                break;
-            }
-            _ if at_common(lhs_hashes, a_cursor, common) => {
-                while !at_common(rhs_hashes, b_cursor, common) {
-                    diff[0].add.push(rhs[b_cursor].clone());
+                _ if at_common(lhs_hashes, a_cursor, common)
+                    && at_common(rhs_hashes, b_cursor, common) =>
+                {
+                    a_cursor += 1;
                     b_cursor += 1;
+                    common_cursor += 1;
                     path_cursor += 1;
+                    break;
                 }
-            }
-            _ if at_common(rhs_hashes, b_cursor, common) => {
-                while !at_common(lhs_hashes, a_cursor, common) {
-                    diff[0].remove.push(lhs[a_cursor].clone());
-                    a_cursor += 1;
+                _ if at_common(lhs_hashes, a_cursor, common) => {
+                    while !at_common(rhs_hashes, b_cursor, common) {
+                        diff[0].add.push(rhs[b_cursor].clone());
+                        b_cursor += 1;
+                        path_cursor += 1;
+                    }
                 }
-            }
-            _ if same_container_type(&lhs[a_cursor], &rhs[b_cursor]) => {
-                let sub_path = path_now(&path, path_cursor);
-                let mut sub_diff =
-                    diff_impl(&lhs[a_cursor], &rhs[b_cursor], &sub_path, options).into_elements();
-                if has_changes(&diff) {
-                    diff[0].after = after_context(lhs, a_cursor, common_cursor);
-                    diff.append(&mut sub_diff);
-                } else {
-                    diff = sub_diff;
+                _ if at_common(rhs_hashes, b_cursor, common) => {
+                    while !at_common(lhs_hashes, a_cursor, common) {
+                        diff[0].remove.push(lhs[a_cursor].clone());
+                        a_cursor += 1;
+                    }
+                }
+                _ => {
+                    let step = match (threshold, &lhs[a_cursor], &rhs[b_cursor]) {
+                        (Some(threshold), Node::Object(_), Node::Object(_)) => {
+                            let (lhs_end, rhs_end) = *gaps.get_or_insert_with(|| {
+                                (gap_end(lhs_hashes, common), gap_end(rhs_hashes, common))
+                            });
+                            Some(similarity::step(
+                                &lhs[a_cursor..lhs_end],
+                                &rhs[b_cursor..rhs_end],
+                                threshold,
+                                &options.refine(&PathSegment::index(path_cursor)),
+                            ))
+                        }
+                        _ => None,
+                    };
+                    match step {
+                        Some(Step::Remove) => {
+                            diff[0].remove.push(lhs[a_cursor].clone());
+                            a_cursor += 1;
+                        }
+                        Some(Step::Add) => {
+                            diff[0].add.push(rhs[b_cursor].clone());
+                            b_cursor += 1;
+                            path_cursor += 1;
+                        }
+                        _ if step != Some(Step::Replace)
+                            && same_container_type(&lhs[a_cursor], &rhs[b_cursor]) =>
+                        {
+                            let sub_path = path_now(&path, path_cursor);
+                            let sub_options = options.refine(&PathSegment::index(path_cursor));
+                            let mut sub_diff =
+                                diff_impl(&lhs[a_cursor], &rhs[b_cursor], &sub_path, &sub_options)
+                                    .into_elements();
+                            if has_changes(&diff) {
+                                diff[0].after = after_context(
+                                    a_cursor - common_cursor,
+                                    lhs.len(),
+                                    size,
+                                    |index| lhs[index].clone(),
+                                );
+                                diff.append(&mut sub_diff);
+                            } else {
+                                diff = sub_diff;
+                                own = false;
+                            }
+                            a_cursor += 1;
+                            b_cursor += 1;
+                            path_cursor += 1;
+                            break;
+                        }
+                        _ => {
+                            diff[0].remove.push(lhs[a_cursor].clone());
+                            diff[0].add.push(rhs[b_cursor].clone());
+                            a_cursor += 1;
+                            b_cursor += 1;
+                            path_cursor += 1;
+                        }
+                    }
                 }
-                a_cursor += 1;
-                b_cursor += 1;
-                path_cursor += 1;
-                break;
-            }
-            _ => {
-                diff[0].remove.push(lhs[a_cursor].clone());
-                diff[0].add.push(rhs[b_cursor].clone());
-                a_cursor += 1;
-                b_cursor += 1;
-                path_cursor += 1;
             }
         }
-    }
 
-    if !has_changes(&diff) {
-        diff.clear();
-    } else {
-        let single = diff.len() < 2;
-        if let Some(first) = diff.first_mut() {
-            if first.path.len() <= path_len && single {
-                first.after = after_context(lhs, a_cursor, common_cursor);
+        if !has_changes(&diff) {
+            diff.clear();
+        } else {
+            let single = diff.len() < 2;
+            if let Some(first) = diff.first_mut() {
+                if first.path.len() <= path_len && single {
+                    first.after =
+                        after_context(a_cursor - common_cursor, lhs.len(), size, |index| {
+                            lhs[index].clone()
+                        });
+                }
             }
         }
-    }
 
-    if a_cursor == lhs.len() && b_cursor == rhs.len() {
-        return diff;
+        if own {
+            options.spend(diff.first());
+        }
+        hunks.append(&mut diff);
+        if a_cursor == lhs.len() && b_cursor == rhs.len() || options.is_spent() {
+            return hunks;
+        }
+
+        consumed += b_cursor;
+        path = path_now(&path, path_cursor);
+        lhs = &lhs[a_cursor..];
+        rhs = &rhs[b_cursor..];
+        lhs_hashes = &lhs_hashes[a_cursor..];
+        rhs_hashes = &rhs_hashes[b_cursor..];
+        common = &common[common_cursor..];
     }
+}
+
+fn element_hashes(values: &[Node], options: &DiffOptions) -> Vec<HashCode> {
+    values
+        .iter()
+        .enumerate()
+        .map(|(index, node)| node.hash_code(&options.refine(&list_segment(index))))
+        .collect()
+}
+
+fn classified_hashes(
+    values: &[Node],
+    options: &DiffOptions,
+    classes: &mut ToleranceClasses,
+) -> Vec<HashCode> {
+    values
+        .iter()
+        .enumerate()
+        .map(|(index, node)| classes.hash(node, &options.refine(&list_segment(index))))
+        .collect()
+}
 
-    let previous_node = if b_cursor == 0 { Node::Void } else { rhs[b_cursor - 1].clone() };
-    let mut rest = diff_rest(
-        &lhs[a_cursor..],
-        &rhs[b_cursor..],
-        path_cursor,
-        path_now(&path, path_cursor),
-        &lhs_hashes[a_cursor..],
-        &rhs_hashes[b_cursor..],
-        &common[common_cursor..],
-        &previous_node,
-        options,
-    );
-    diff.append(&mut rest);
-    diff
+/// Returns where the gap before the next common element ends in `hashes`.
+/// The walk never moves past that element within a pass, so the gap can be
+/// measured from the start of the pass.
+fn gap_end(hashes: &[HashCode], common: &[HashCode]) -> usize {
+    hashes.iter().position(|hash| Some(hash) == common.first()).unwrap_or(hashes.len())
 }
 
 fn at_common(hashes: &[HashCode], cursor: usize, common: &[HashCode]) -> bool {
@@ -151,13 +298,35 @@ fn has_changes(diff: &[DiffElement]) -> bool {
         .unwrap_or(false)
 }
 
-fn after_context(lhs: &[Node], a_cursor: usize, common_cursor: usize) -> Vec<Node> {
-    let index = a_cursor.saturating_sub(common_cursor);
-    if index >= lhs.len() {
-        vec![Node::Void]
-    } else {
-        vec![lhs[index].clone()]
+/// Returns the `size` elements ending before `end`, led by a void marker
+/// when the list starts within them.
+pub(super) fn before_context(
+    end: usize,
+    size: usize,
+    element: impl Fn(usize) -> Node,
+) -> Vec<Node> {
+    let mut context = Vec::with_capacity(size);
+    if end < size {
+        context.push(Node::Void);
     }
+    context.extend((end.saturating_sub(size)..end).map(element));
+    context
+}
+
+/// Returns the `size` elements from `start` on of a list `len` long,
+/// closed by a void marker when the list ends within them.
+pub(super) fn after_context(
+    start: usize,
+    len: usize,
+    size: usize,
+    element: impl Fn(usize) -> Node,
+) -> Vec<Node> {
+    let end = start.saturating_add(size);
+    let mut context: Vec<Node> = (start..end.min(len)).map(element).collect();
+    if end > len {
+        context.push(Node::Void);
+    }
+    context
 }
 
 fn path_now(path: &Path, path_cursor: i64) -> Path {
@@ -168,35 +337,3 @@ fn same_container_type(lhs: &Node, rhs: &Node) -> bool {
     matches!(lhs, Node::Object(_)) && matches!(rhs, Node::Object(_))
         || matches!(lhs, Node::Array(_)) && matches!(rhs, Node::Array(_))
 }
-
-fn longest_common_subsequence(lhs: &[HashCode], rhs: &[HashCode]) -> Vec<HashCode> {
-    let n = lhs.len();
-    let m = rhs.len();
-    let mut table = vec![vec![0usize; m + 1]; n + 1];
-    for (i, lhs_hash) in lhs.iter().enumerate() {
-        for (j, rhs_hash) in rhs.iter().enumerate() {
-            if lhs_hash == rhs_hash {
-                table[i + 1][j + 1] = table[i][j] + 1;
-            } else {
-                table[i + 1][j + 1] = table[i][j + 1].max(table[i + 1][j]);
-            }
-        }
-    }
-
-    let mut result = Vec::with_capacity(table[n][m]);
-    let mut i = n;
-    let mut j = m;
-    while i > 0 && j > 0 {
-        if lhs[i - 1] == rhs[j - 1] {
-            result.push(lhs[i - 1]);
-            i -= 1;
-            j -= 1;
-        } else if table[i - 1][j] >= table[i][j - 1] {
-            i -= 1;
-        } else {
-            j -= 1;
-        }
-    }
-    result.reverse();
-    result
-}
@@ -5,17 +5,55 @@
 //! The current milestone implements list-mode diffing and object traversal,
 //! mirroring the upstream Go implementation.
 
+mod budget;
+mod canonical;
+mod lcs;
 mod list;
+mod moves;
+mod multiset;
 mod object;
+mod parse;
 mod path;
+mod patience;
 mod primitives;
-
+mod read;
+mod rediff;
+pub(crate) mod reindex;
+mod render;
+mod set;
+mod similarity;
+mod simplify;
+mod stat;
+#[cfg(feature = "std")]
+mod stream;
+mod theme;
+mod tolerance;
+mod unified;
+mod v1;
+mod visit;
+
+pub use parse::DiffParseError;
 pub use path::{path_from_segments, root_path, Path, PathSegment};
+pub use render::StringGranularity;
+pub use stat::{DiffStat, DiffStats, StatEntry};
+#[cfg(feature = "std")]
+pub use stream::{diff_streams, StreamError};
+pub use theme::ColorTheme;
+pub use unified::{unified_diff, UnifiedConfig};
+pub use visit::{Change, DiffVisitor};
+
+use hashbrown::HashSet;
 
 use serde::{Deserialize, Serialize};
 use serde_json::{self, Number as JsonNumber, Value as JsonValue};
 
-use crate::{ArrayMode, DiffOptions, Node, Number, PatchError};
+use crate::prelude::*;
+use crate::{
+    gojson, ArrayMode, DiffOption, DiffOptions, JsonPath, Node, Number, NumberEquality, PatchError,
+    TranslateError,
+};
+pub(crate) use budget::DiffBudget;
+pub(crate) use theme::COLOR_RESET;
 
 /// Metadata associated with a diff element.
 ///
@@ -24,7 +62,7 @@ use crate::{ArrayMode, DiffOptions, Node, Number, PatchError};
 /// let meta = DiffMetadata::merge();
 /// assert!(meta.merge);
 /// ```
-#[derive(Clone, Debug, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[derive(Clone, Debug, Default, PartialEq, Serialize, Deserialize)]
 pub struct DiffMetadata {
     /// Indicates that merge patch semantics should be used.
     #[serde(default)]
@@ -35,6 +73,14 @@ pub struct DiffMetadata {
     /// Optional color rendering hint (reserved for future parity work).
     #[serde(default, skip_serializing_if = "Option::is_none")]
     pub color: Option<bool>,
+    /// Optional numeric tolerance for patch context checks (`^ {"precision":N}`).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub precision: Option<f64>,
+    /// Other options from `^` header lines, such as `"SET"` or
+    /// `{"@":["tags"],"^":["MULTISET"]}`, applied when the hunk and those
+    /// after it are patched.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub options: Vec<DiffOption>,
 }
 
 impl DiffMetadata {
@@ -47,11 +93,28 @@ impl DiffMetadata {
     /// ```
     #[must_use]
     pub fn merge() -> Self {
-        Self { merge: true, set_keys: None, color: None }
+        Self { merge: true, ..Self::default() }
+    }
+
+    /// Constructs metadata carrying a numeric precision tolerance.
+    ///
+    /// ```
+    /// # use jd_core::DiffMetadata;
+    /// let meta = DiffMetadata::precision(0.01);
+    /// assert_eq!(meta.precision, Some(0.01));
+    /// assert!(!meta.merge);
+    /// ```
+    #[must_use]
+    pub fn precision(precision: f64) -> Self {
+        Self { precision: Some(precision), ..Self::default() }
     }
 
     pub(crate) fn is_effective(&self) -> bool {
-        self.merge || self.set_keys.is_some() || self.color.is_some()
+        self.merge
+            || self.set_keys.is_some()
+            || self.color.is_some()
+            || self.precision.is_some()
+            || !self.options.is_empty()
     }
 
     pub(crate) fn absorb(&mut self, other: &Self) {
@@ -64,14 +127,50 @@ impl DiffMetadata {
         if let Some(color) = other.color {
             self.color = Some(color);
         }
+        if let Some(precision) = other.precision {
+            self.precision = Some(precision);
+        }
+        for option in &other.options {
+            if !self.options.contains(option) {
+                self.options.push(option.clone());
+            }
+        }
+    }
+
+    /// Folds `options` into the metadata: precision and set keys into their
+    /// own fields and the rest into [`options`](DiffMetadata::options).
+    pub(crate) fn absorb_options(&mut self, options: impl IntoIterator<Item = DiffOption>) {
+        for option in options {
+            match option {
+                DiffOption::Precision(precision) => self.precision = Some(precision),
+                DiffOption::SetKeys(keys) => self.set_keys = Some(keys),
+                other if !self.options.contains(&other) => self.options.push(other),
+                _ => {}
+            }
+        }
+    }
+
+    /// Returns `options` with the header options of this metadata added.
+    pub(crate) fn apply_to(&self, options: DiffOptions) -> DiffOptions {
+        let keys = self.set_keys.clone().map(DiffOption::SetKeys);
+        options.with_header_options(&self.options).with_header_options(keys.as_slice())
     }
 
     fn render_header(&self) -> String {
+        let mut header = String::new();
         if self.merge {
-            "^ {\"Merge\":true}\n".to_string()
-        } else {
-            String::new()
+            header.push_str("^ {\"Merge\":true}\n");
+        }
+        for option in &self.options {
+            header.push_str(&option.render_header());
+        }
+        if let Some(keys) = &self.set_keys {
+            header.push_str(&DiffOption::SetKeys(keys.clone()).render_header());
+        }
+        if let Some(precision) = self.precision {
+            header.push_str(&DiffOption::Precision(precision).render_header());
         }
+        header
     }
 }
 
@@ -111,6 +210,12 @@ pub struct DiffElement {
     /// Context after the change (list diffs only).
     #[serde(default, skip_serializing_if = "Vec::is_empty")]
     pub after: Vec<Node>,
+    /// Where the added value is moved from, for list moves found with
+    /// [`DiffOptions::with_move_detection`]. The value is removed from this
+    /// path before it is inserted at [`path`](DiffElement::path), and both
+    /// indices count positions in the list as it is at that point.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub moved_from: Option<Path>,
 }
 
 impl DiffElement {
@@ -206,6 +311,42 @@ impl DiffElement {
         self.after = after;
         self
     }
+
+    /// Marks the element as a list move of its added value from `path`.
+    ///
+    /// ```
+    /// # use jd_core::diff::{Diff, DiffElement, PathSegment};
+    /// # use jd_core::Node;
+    /// let element = DiffElement::new()
+    ///     .with_path(PathSegment::index(0))
+    ///     .with_moved_from(PathSegment::index(2))
+    ///     .with_add(vec![Node::from_json_str("3").unwrap()]);
+    /// let list = Node::from_json_str("[1,2,3]").unwrap();
+    /// let moved = list.apply_patch(&Diff::from_elements(vec![element])).unwrap();
+    /// assert_eq!(moved, Node::from_json_str("[3,1,2]").unwrap());
+    /// ```
+    #[must_use]
+    pub fn with_moved_from<P>(mut self, path: P) -> Self
+    where
+        P: Into<Path>,
+    {
+        self.moved_from = Some(path.into());
+        self
+    }
+
+    /// Splits a move into the removal and the insertion it stands for.
+    /// Other elements are returned unchanged.
+    fn expand_move(&self) -> Vec<DiffElement> {
+        let Some(from) = &self.moved_from else {
+            return vec![self.clone()];
+        };
+        let removal = DiffElement {
+            metadata: self.metadata.clone(),
+            ..DiffElement::new().with_path(from.clone()).with_remove(self.add.clone())
+        };
+        let insertion = DiffElement { metadata: None, moved_from: None, ..self.clone() };
+        vec![removal, insertion]
+    }
 }
 
 /// Collection of diff elements.
@@ -215,16 +356,36 @@ impl DiffElement {
 /// let diff = Diff::from_elements(vec![DiffElement::new()]);
 /// assert_eq!(diff.len(), 1);
 /// ```
+///
+/// `Diff`, [`DiffElement`], and [`Path`] implement serde's `Serialize` and
+/// `Deserialize` in the schema of [`Diff::render_raw`], which the golden
+/// fixtures and `jd -f json` also use. The schema only grows: new fields
+/// are optional and omitted when unset, so a diff persisted or sent over
+/// RPC by one version reloads in later ones and applies as before.
+///
+/// ```
+/// # use jd_core::{Diff, DiffOptions, Node};
+/// let lhs = Node::from_json_str(r#"{"tags":["a"]}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"tags":["a","b"]}"#).unwrap();
+/// let stored = serde_json::to_string(&lhs.diff(&rhs, &DiffOptions::default())).unwrap();
+/// let reloaded: Diff = serde_json::from_str(&stored).unwrap();
+/// assert_eq!(lhs.apply_patch(&reloaded).unwrap(), rhs);
+/// ```
 #[derive(Clone, Debug, Default, PartialEq, Serialize, Deserialize)]
 #[serde(transparent)]
 pub struct Diff {
     elements: Vec<DiffElement>,
+    #[serde(skip)]
+    truncated: bool,
 }
 
 /// Configuration toggles for diff rendering.
-#[derive(Clone, Copy, Debug, Default)]
+#[derive(Clone, Debug, Default)]
 pub struct RenderConfig {
     color: bool,
+    theme: ColorTheme,
+    strings: StringGranularity,
+    string_rules: Vec<(JsonPath, StringGranularity)>,
 }
 
 impl RenderConfig {
@@ -261,9 +422,83 @@ impl RenderConfig {
     /// assert!(config.color_enabled());
     /// ```
     #[must_use]
-    pub fn color_enabled(self) -> bool {
+    pub fn color_enabled(&self) -> bool {
         self.color
     }
+
+    /// Selects the palette used when color is enabled.
+    ///
+    /// ```
+    /// # use jd_core::{ColorTheme, DiffOptions, Node, RenderConfig};
+    /// let lhs = Node::from_json_str("1").unwrap();
+    /// let rhs = Node::from_json_str("2").unwrap();
+    /// let config = RenderConfig::color(true).with_theme(ColorTheme::HighContrast);
+    /// assert_eq!(
+    ///     lhs.diff(&rhs, &DiffOptions::default()).render(&config),
+    ///     "@ []\n\u{1b}[1;91m- 1\n\u{1b}[0m\u{1b}[1;92m+ 2\n\u{1b}[0m"
+    /// );
+    /// ```
+    #[must_use]
+    pub fn with_theme(mut self, theme: ColorTheme) -> Self {
+        self.theme = theme;
+        self
+    }
+
+    /// Returns the color palette.
+    ///
+    /// ```
+    /// # use jd_core::{ColorTheme, RenderConfig};
+    /// assert_eq!(RenderConfig::default().theme(), ColorTheme::Default);
+    /// ```
+    #[must_use]
+    pub fn theme(&self) -> ColorTheme {
+        self.theme
+    }
+
+    /// Selects how hunks that replace one string with another are broken
+    /// down, at every path without a [`RenderConfig::with_string_granularity_at`]
+    /// rule. See [`StringGranularity`].
+    #[must_use]
+    pub fn with_string_granularity(mut self, granularity: StringGranularity) -> Self {
+        self.strings = granularity;
+        self
+    }
+
+    /// Breaks down string replacements at or below the paths `query`
+    /// selects by `granularity`, so a long script or certificate can show
+    /// only its changed lines while other strings keep the default. Later
+    /// rules take precedence over earlier ones.
+    ///
+    /// ```
+    /// # use jd_core::{JsonPath, Node, DiffOptions, RenderConfig, StringGranularity};
+    /// let lhs = Node::from_json_str(r#"{"name":"a\nb","pem":"A\nB\nC"}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"name":"a\nc","pem":"A\nX\nC"}"#).unwrap();
+    /// let query = JsonPath::parse("$.pem").unwrap();
+    /// let config = RenderConfig::new().with_string_granularity_at(query, StringGranularity::Line);
+    /// assert_eq!(
+    ///     lhs.diff(&rhs, &DiffOptions::default()).render(&config),
+    ///     "@ [\"name\"]\n- \"a\\nb\"\n+ \"a\\nc\"\n@ [\"pem\"]\n@@ -2 +2 @@\n- \"B\\n\"\n+ \"X\\n\"\n"
+    /// );
+    /// ```
+    #[must_use]
+    pub fn with_string_granularity_at(
+        mut self,
+        query: JsonPath,
+        granularity: StringGranularity,
+    ) -> Self {
+        self.string_rules.push((query, granularity));
+        self
+    }
+
+    /// Returns how a string replacement at `path` is broken down.
+    #[must_use]
+    pub fn string_granularity(&self, path: &Path) -> StringGranularity {
+        self.string_rules
+            .iter()
+            .rev()
+            .find(|(query, _)| query.contains(path))
+            .map_or(self.strings, |(_, granularity)| *granularity)
+    }
 }
 
 impl RenderConfig {
@@ -299,13 +534,13 @@ impl RenderError {
     }
 }
 
-impl std::fmt::Display for RenderError {
-    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+impl core::fmt::Display for RenderError {
+    fn fmt(&self, f: &mut core::fmt::Formatter<'_>) -> core::fmt::Result {
         f.write_str(&self.message)
     }
 }
 
-impl std::error::Error for RenderError {}
+impl core::error::Error for RenderError {}
 
 impl From<serde_json::Error> for RenderError {
     fn from(err: serde_json::Error) -> Self {
@@ -329,7 +564,7 @@ impl Diff {
     /// ```
     #[must_use]
     pub fn empty() -> Self {
-        Self { elements: Vec::new() }
+        Self { elements: Vec::new(), truncated: false }
     }
 
     /// Builds a diff from the provided elements.
@@ -342,7 +577,7 @@ impl Diff {
     /// ```
     #[must_use]
     pub fn from_elements(elements: Vec<DiffElement>) -> Self {
-        Self { elements }
+        Self { elements, truncated: false }
     }
 
     /// Returns the number of elements in the diff.
@@ -368,6 +603,24 @@ impl Diff {
         self.elements.is_empty()
     }
 
+    /// Reports whether the diff stopped early at the size limits of
+    /// [`DiffOptions::with_max_elements`] or [`DiffOptions::with_max_bytes`],
+    /// leaving out hunks of the full diff, or was cancelled through
+    /// [`DiffOptions::with_cancellation`]. Diffs built or parsed any other way
+    /// are never truncated.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str("[1,2,3]").unwrap();
+    /// let rhs = Node::from_json_str("[1,5,3]").unwrap();
+    /// assert!(!lhs.diff(&rhs, &DiffOptions::default().with_max_elements(1)).is_truncated());
+    /// assert!(lhs.diff(&rhs, &DiffOptions::default().with_max_elements(0)).is_truncated());
+    /// ```
+    #[must_use]
+    pub fn is_truncated(&self) -> bool {
+        self.truncated
+    }
+
     /// Returns an iterator over the elements.
     ///
     /// ```
@@ -376,7 +629,7 @@ impl Diff {
     /// let mut iter = diff.iter();
     /// assert!(iter.next().is_some());
     /// ```
-    pub fn iter(&self) -> std::slice::Iter<'_, DiffElement> {
+    pub fn iter(&self) -> core::slice::Iter<'_, DiffElement> {
         self.elements.iter()
     }
 
@@ -393,6 +646,66 @@ impl Diff {
         self.elements
     }
 
+    /// Returns the diff with every move split into a removal and an
+    /// insertion, for code that reasons about list hunks one range at a time.
+    pub(crate) fn without_moves(&self) -> Diff {
+        Diff::from_elements(self.elements.iter().flat_map(DiffElement::expand_move).collect())
+    }
+
+    /// Returns the hunks whose path satisfies `keep`, such as those below a
+    /// subtree of interest.
+    ///
+    /// `keep` sees list indices as positions in the original document, so a
+    /// path means the same element no matter which other hunks are dropped.
+    /// The kept hunks are re-indexed and their list context is rewritten to
+    /// undo dropped changes, so the filtered diff still applies to the
+    /// original document. Metadata carried by a dropped hunk moves to the
+    /// next kept one. Moves are split into a removal and an insertion that
+    /// are kept or dropped independently.
+    ///
+    /// ```
+    /// # use jd_core::{diff::{Path, PathSegment}, DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"spec":{"replicas":1},"status":"old"}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"spec":{"replicas":2},"status":"new"}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default());
+    /// let spec = Path::from(PathSegment::key("spec"));
+    /// let filtered = diff.filter(|path| path.starts_with(&spec));
+    /// assert_eq!(filtered.len(), 1);
+    /// let patched = lhs.apply_patch(&filtered).unwrap();
+    /// assert_eq!(patched, Node::from_json_str(r#"{"spec":{"replicas":2},"status":"old"}"#).unwrap());
+    /// ```
+    #[must_use]
+    pub fn filter<F>(&self, mut keep: F) -> Diff
+    where
+        F: FnMut(&Path) -> bool,
+    {
+        let plain = self.without_moves();
+        let base = reindex::to_base(&plain);
+        let mut kept = Vec::new();
+        let mut dropped = Vec::new();
+        let mut pending: Option<DiffMetadata> = None;
+        for (rebased, original) in base.iter().zip(&plain.elements) {
+            if !keep(&rebased.path) {
+                if let Some(metadata) = rebased.metadata.as_ref().filter(|meta| meta.is_effective())
+                {
+                    pending.get_or_insert_with(DiffMetadata::default).absorb(metadata);
+                }
+                dropped.push((rebased, original));
+                continue;
+            }
+            let mut element = rebased.clone();
+            if let Some(mut metadata) = pending.take() {
+                if let Some(own) = &element.metadata {
+                    metadata.absorb(own);
+                }
+                element.metadata = Some(metadata);
+            }
+            restore_context(&mut element, &dropped);
+            kept.push(element);
+        }
+        reindex::from_base(kept)
+    }
+
     /// Renders the diff using the native jd text format.
     ///
     /// ```
@@ -412,12 +725,127 @@ impl Diff {
                 output.push_str(&metadata.render_header());
                 inherited = metadata.clone();
             }
+            if let Some(from) = &element.moved_from {
+                output.push_str(&format!("^ {{\"from\":{}}}\n", path_to_json(from)));
+            }
             let is_merge = element.metadata.as_ref().map_or(inherited.merge, |meta| meta.merge);
             output.push_str(&render_element_native(element, config, is_merge));
         }
         output
     }
 
+    /// Records the options the diff was computed with as `^` header lines on
+    /// its first hunk, so the rendered diff describes how to apply itself.
+    ///
+    /// Only options with a header form are kept (see
+    /// [`DiffOptions::header_options`]). Go `jd` writes no such headers, so
+    /// diffs render without them unless this is called. [`Diff::from_native_str`]
+    /// reads the headers back, and patching applies them to the hunks that
+    /// follow.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, DiffOptions, Node, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"{"rate":0.5}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"rate":0.7}"#).unwrap();
+    /// let options = DiffOptions::default().with_precision(0.001).unwrap();
+    /// let diff = lhs.diff(&rhs, &options).with_option_headers(&options);
+    /// let rendered = diff.render(&RenderConfig::default());
+    /// assert_eq!(rendered, "^ {\"precision\":0.001}\n@ [\"rate\"]\n- 0.5\n+ 0.7\n");
+    /// assert_eq!(Diff::from_native_str(&rendered).unwrap(), diff);
+    /// ```
+    #[must_use]
+    pub fn with_option_headers(mut self, options: &DiffOptions) -> Self {
+        let headers = options.header_options();
+        if let Some(first) = self.elements.first_mut().filter(|_| !headers.is_empty()) {
+            first.metadata.get_or_insert_with(DiffMetadata::default).absorb_options(headers);
+        }
+        self
+    }
+
+    /// Parses a diff in the native jd format, mirroring Go's `ReadDiffString`.
+    ///
+    /// `^` option headers become [`DiffMetadata`] on the hunk that follows
+    /// them, so merge and precision headers are honoured when the diff is
+    /// applied.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n+ 2\n").expect("valid diff");
+    /// let base = Node::from_json_str("{\"a\":1}").unwrap();
+    /// let patched = base.apply_patch(&diff).expect("apply diff");
+    /// assert_eq!(patched, Node::from_json_str("{\"a\":2}").unwrap());
+    /// ```
+    pub fn from_native_str(input: &str) -> Result<Self, DiffParseError> {
+        parse::parse_native(input)
+    }
+
+    /// Parses a diff in the native format of jd v1, which has no `^` option
+    /// headers and no context lines, mirroring v1's `ReadDiffString`.
+    ///
+    /// The hunks are ordinary hunks without context, so the diff applies
+    /// like any other and [`Diff::render`] translates it to the v2 format.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node, RenderConfig};
+    /// let diff = Diff::from_native_v1_str("@ [1]\n- 2\n+ 4\n").expect("valid v1 diff");
+    /// let base = Node::from_json_str("[1,2,3]").unwrap();
+    /// assert_eq!(base.apply_patch(&diff).unwrap(), Node::from_json_str("[1,4,3]").unwrap());
+    /// assert!(Diff::from_native_v1_str("^ \"SET\"\n@ [0]\n- 1\n").is_err());
+    /// ```
+    pub fn from_native_v1_str(input: &str) -> Result<Self, DiffParseError> {
+        v1::parse_v1(input)
+    }
+
+    /// Renders the diff in the native format of jd v1, for tools that only
+    /// read that format.
+    ///
+    /// Context lines and option headers are dropped, so list hunks apply by
+    /// index without checking their neighbours. Merge, set, and multiset
+    /// markers are written into the path as v1 metadata. Moves have no v1
+    /// form and are rejected.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str("[1,2,3]").expect("valid JSON");
+    /// let rhs = Node::from_json_str("[1,4,3]").expect("valid JSON");
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default());
+    /// assert_eq!(diff.render_v1().unwrap(), "@ [1]\n- 2\n+ 4\n");
+    /// ```
+    pub fn render_v1(&self) -> Result<String, RenderError> {
+        v1::render_v1(self)
+    }
+
+    /// Reads a JSON Patch (RFC 6902) document as a native diff, mirroring Go's
+    /// `ReadPatchString`.
+    ///
+    /// `test` ops that border a list change become before/after context and
+    /// `test`/`remove` pairs become removals. Ops without a jd equivalent
+    /// (`replace`, `move`, `copy`) are rejected.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, RenderConfig};
+    /// let patch = r#"[{"op":"test","path":"/a","value":1},{"op":"remove","path":"/a","value":1},
+    ///     {"op":"add","path":"/a","value":2}]"#;
+    /// let diff = Diff::from_json_patch_str(patch).expect("valid patch");
+    /// assert_eq!(diff.render(&RenderConfig::default()), "@ [\"a\"]\n- 1\n+ 2\n");
+    /// ```
+    pub fn from_json_patch_str(input: &str) -> Result<Self, TranslateError> {
+        read::read_json_patch(input)
+    }
+
+    /// Reads a JSON Merge Patch (RFC 7386) document as a merge diff, mirroring
+    /// Go's `ReadMergeString`. Every leaf becomes a hunk with
+    /// [`DiffMetadata::merge`] and `null` members become deletions.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, RenderConfig};
+    /// let diff = Diff::from_merge_patch_str(r#"{"a":null}"#).expect("valid merge patch");
+    /// assert_eq!(diff.render(&RenderConfig::default()), "^ {\"Merge\":true}\n@ [\"a\"]\n+\n");
+    /// ```
+    pub fn from_merge_patch_str(input: &str) -> Result<Self, TranslateError> {
+        read::read_merge_patch(input)
+    }
+
     /// Renders the diff as a JSON Patch (RFC 6902).
     ///
     /// ```
@@ -442,6 +870,16 @@ impl Diff {
 
             let pointer = path_to_pointer(&element.path)?;
 
+            if let Some(from) = &element.moved_from {
+                // RFC 6902 moves carry no value, so test it at the source.
+                let from = path_to_pointer(from)?;
+                for value in &element.add {
+                    operations.push(PatchElement::test(from.clone(), node_to_json_value(value)?));
+                    operations.push(PatchElement::moved(from.clone(), pointer.clone()));
+                }
+                continue;
+            }
+
             if element.before.len() > 1 {
                 return Err(RenderError::new(format!(
                     "only one line of before context supported. got {}",
@@ -514,7 +952,7 @@ impl Diff {
             }
         }
 
-        Ok(serde_json::to_string(&operations)?)
+        Ok(gojson::escape(serde_json::to_string(&operations)?))
     }
 
     /// Renders the diff as a JSON Merge Patch (RFC 7386).
@@ -558,21 +996,62 @@ impl Diff {
         let value = patched
             .to_json_value()
             .ok_or_else(|| RenderError::new("merge patch produced void value"))?;
-        Ok(serde_json::to_string(&value)?)
+        Ok(gojson::escape(serde_json::to_string(&value)?))
     }
 
-    /// Serializes the diff structure as JSON for debugging.
+    /// Serializes the diff structure as JSON, the schema of the fixtures the
+    /// Go generators write and of `jd -f json`. Each element of the array
+    /// holds its `path` and, when present, `metadata`, `before`, `remove`,
+    /// `add`, `after`, and `moved_from`; values are tagged as
+    /// `{"type": "Number", "value": 2}`. The output deserializes back into
+    /// an equal [`Diff`].
     ///
     /// ```
-    /// # use jd_core::{Diff, diff::DiffElement};
-    /// let diff = Diff::from_elements(vec![DiffElement::new()]);
+    /// # use jd_core::{Diff, DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"a":1}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"a":2}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default());
     /// let raw = diff.render_raw().unwrap();
-    /// assert!(raw.starts_with("[{"));
+    /// assert_eq!(
+    ///     raw,
+    ///     r#"[{"path":["a"],"remove":[{"type":"Number","value":1}],"add":[{"type":"Number","value":2}]}]"#
+    /// );
+    /// assert_eq!(serde_json::from_str::<Diff>(&raw).unwrap(), diff);
     /// ```
     pub fn render_raw(&self) -> Result<String, RenderError> {
         Ok(serde_json::to_string(&self.elements)?)
     }
 
+    /// Lists the changed paths as JSON Pointers, one per line, without any
+    /// values. Each path appears once, in diff order. A list hunk lists every
+    /// position it replaces, removes, or adds, and a move lists its origin and
+    /// its destination. Keys follow the JSON Patch rules of
+    /// [`Diff::render_patch`]; set segments, which JSON Pointer cannot
+    /// express, are written in native notation as `{}`, `[]`, or
+    /// `{"id":1}`.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"user":{"api/key":"s3cret"},"tags":[1,2]}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"user":{"api/key":"hunter2"},"tags":[]}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default());
+    /// assert_eq!(diff.render_paths().unwrap(), "/tags/0\n/tags/1\n/user/api~1key\n");
+    /// ```
+    pub fn render_paths(&self) -> Result<String, RenderError> {
+        let mut seen = HashSet::new();
+        let mut output = String::new();
+        for element in self.elements.iter().flat_map(DiffElement::expand_move) {
+            for path in changed_positions(&element) {
+                let pointer = path_to_listed_pointer(&path)?;
+                if seen.insert(pointer.clone()) {
+                    output.push_str(&pointer);
+                    output.push('\n');
+                }
+            }
+        }
+        Ok(output)
+    }
+
     /// Reverses a strict diff so that applying it to the target restores the base value.
     ///
     /// ```
@@ -616,7 +1095,16 @@ impl Diff {
             }
 
             let mut clone = element.clone();
-            std::mem::swap(&mut clone.remove, &mut clone.add);
+            if let Some(from) = &element.moved_from {
+                // Move the value back; the forward context describes the
+                // destination, so it does not apply.
+                clone.moved_from = Some(element.path.clone());
+                clone.path = from.clone();
+                clone.before.clear();
+                clone.after.clear();
+            } else {
+                core::mem::swap(&mut clone.remove, &mut clone.add);
+            }
             match metadata {
                 Some(meta) => {
                     if last_emitted.as_ref() != Some(&meta) {
@@ -638,9 +1126,39 @@ impl Diff {
     }
 }
 
+/// Rewrites the `before` context of a list hunk, which reflects earlier hunks
+/// that descended into those elements, to undo the `dropped` ones. Each
+/// dropped hunk is paired with its original, patch-ordered path.
+fn restore_context(element: &mut DiffElement, dropped: &[(&DiffElement, &DiffElement)]) {
+    let Some((PathSegment::Index(position), list)) = element.path.segments().split_last() else {
+        return;
+    };
+    let first = position - element.before.len() as i64;
+    for (offset, context) in element.before.iter_mut().enumerate() {
+        let mut at = list.to_vec();
+        at.push(PathSegment::Index(first + offset as i64));
+        for (rebased, original) in dropped.iter().rev() {
+            let Some(rest) = rebased.path.segments().strip_prefix(at.as_slice()) else {
+                continue;
+            };
+            if rest.is_empty() {
+                continue;
+            }
+            let relative = &original.path.segments()[original.path.len() - rest.len()..];
+            let undo = DiffElement::new()
+                .with_path(Path::from(relative.to_vec()))
+                .with_remove(original.add.clone())
+                .with_add(original.remove.clone());
+            if let Ok(restored) = context.apply_patch(&Diff::from_elements(vec![undo])) {
+                *context = restored;
+            }
+        }
+    }
+}
+
 impl IntoIterator for Diff {
     type Item = DiffElement;
-    type IntoIter = std::vec::IntoIter<DiffElement>;
+    type IntoIter = alloc::vec::IntoIter<DiffElement>;
 
     fn into_iter(self) -> Self::IntoIter {
         self.elements.into_iter()
@@ -649,7 +1167,7 @@ impl IntoIterator for Diff {
 
 impl<'a> IntoIterator for &'a Diff {
     type Item = &'a DiffElement;
-    type IntoIter = std::slice::Iter<'a, DiffElement>;
+    type IntoIter = core::slice::Iter<'a, DiffElement>;
 
     fn into_iter(self) -> Self::IntoIter {
         self.elements.iter()
@@ -662,13 +1180,11 @@ impl From<Vec<DiffElement>> for Diff {
     }
 }
 
-const COLOR_RESET: &str = "\u{1b}[0m";
-const COLOR_RED: &str = "\u{1b}[31m";
-const COLOR_GREEN: &str = "\u{1b}[32m";
-
 #[derive(Serialize)]
 struct PatchElement {
     op: &'static str,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    from: Option<String>,
     path: String,
     #[serde(skip_serializing_if = "Option::is_none")]
     value: Option<JsonValue>,
@@ -676,15 +1192,19 @@ struct PatchElement {
 
 impl PatchElement {
     fn test(path: String, value: JsonValue) -> Self {
-        Self { op: "test", path, value: Some(value) }
+        Self { op: "test", from: None, path, value: Some(value) }
     }
 
     fn remove(path: String, value: JsonValue) -> Self {
-        Self { op: "remove", path, value: Some(value) }
+        Self { op: "remove", from: None, path, value: Some(value) }
     }
 
     fn add(path: String, value: JsonValue) -> Self {
-        Self { op: "add", path, value: Some(value) }
+        Self { op: "add", from: None, path, value: Some(value) }
+    }
+
+    fn moved(from: String, path: String) -> Self {
+        Self { op: "move", from: Some(from), path, value: None }
     }
 }
 
@@ -698,21 +1218,16 @@ fn render_element_native(element: &DiffElement, config: &RenderConfig, is_merge:
     output.push_str(&path_to_json(&element.path));
     output.push('\n');
 
-    struct SingleStringDiff<'a> {
-        common: Vec<char>,
-        old: &'a str,
-        new: &'a str,
-    }
-
-    let string_diff = if element.remove.len() == 1 && element.add.len() == 1 {
-        match (&element.remove[0], &element.add[0]) {
-            (Node::String(old), Node::String(new)) => {
-                Some(SingleStringDiff { common: lcs_chars(old, new), old, new })
-            }
-            _ => None,
-        }
-    } else {
-        None
+    let granularity = config.string_granularity(&element.path);
+    let lines = match granularity {
+        StringGranularity::Char => None,
+        _ => render::render_lines(element, granularity, config),
+    };
+    let string_diff = match granularity {
+        _ if !config.color_enabled() || lines.is_some() => None,
+        StringGranularity::Char => render::StringDiff::from_element(element, config.theme()),
+        StringGranularity::Word => render::StringDiff::words_from_element(element, config.theme()),
+        StringGranularity::Line => None,
     };
 
     for before in &element.before {
@@ -725,20 +1240,19 @@ fn render_element_native(element: &DiffElement, config: &RenderConfig, is_merge:
         }
     }
 
-    for value in &element.remove {
+    if let Some(lines) = &lines {
+        output.push_str(lines);
+    }
+    for value in element.remove.iter().filter(|_| lines.is_none()) {
         if is_void(value) {
             continue;
         }
         if let Some(diff) = &string_diff {
-            if config.color_enabled() {
-                output.push_str("- \"");
-                output.push_str(&color_string_diff(diff.old, &diff.common, COLOR_RED));
-                output.push_str("\"\n");
-                continue;
-            }
+            output.push_str(&diff.render_remove());
+            continue;
         }
         if config.color_enabled() {
-            output.push_str(COLOR_RED);
+            output.push_str(config.theme().removed());
         }
         output.push_str("- ");
         output.push_str(&node_to_json(value));
@@ -748,11 +1262,11 @@ fn render_element_native(element: &DiffElement, config: &RenderConfig, is_merge:
         }
     }
 
-    for value in &element.add {
+    for value in element.add.iter().filter(|_| lines.is_none()) {
         if is_void(value) {
             if is_merge {
                 if config.color_enabled() {
-                    output.push_str(COLOR_GREEN);
+                    output.push_str(config.theme().added());
                 }
                 output.push_str("+\n");
                 if config.color_enabled() {
@@ -762,15 +1276,11 @@ fn render_element_native(element: &DiffElement, config: &RenderConfig, is_merge:
             continue;
         }
         if let Some(diff) = &string_diff {
-            if config.color_enabled() {
-                output.push_str("+ \"");
-                output.push_str(&color_string_diff(diff.new, &diff.common, COLOR_GREEN));
-                output.push_str("\"\n");
-                continue;
-            }
+            output.push_str(&diff.render_add());
+            continue;
         }
         if config.color_enabled() {
-            output.push_str(COLOR_GREEN);
+            output.push_str(config.theme().added());
         }
         output.push_str("+ ");
         output.push_str(&node_to_json(value));
@@ -796,10 +1306,10 @@ fn render_element_native(element: &DiffElement, config: &RenderConfig, is_merge:
 fn node_to_json(node: &Node) -> String {
     match node {
         Node::Void => String::new(),
-        Node::Number(number) => json_number_from_f64(number.get()).to_string(),
+        Node::Number(number) => number.to_json_number().to_string(),
         _ => {
             let value = node_to_json_value(node).expect("serializing node");
-            serde_json::to_string(&value).expect("serializing node")
+            gojson::escape(serde_json::to_string(&value).expect("serializing node"))
         }
     }
 }
@@ -807,14 +1317,14 @@ fn node_to_json(node: &Node) -> String {
 fn node_to_json_value(node: &Node) -> Result<JsonValue, RenderError> {
     match node {
         Node::Void => Err(RenderError::new("cannot encode void value in JSON Patch")),
-        Node::Number(number) => Ok(JsonValue::Number(json_number_from_f64(number.get()))),
+        Node::Number(number) => Ok(JsonValue::Number(number.to_json_number())),
         _ => node
             .to_json_value()
             .ok_or_else(|| RenderError::new("cannot encode void value in JSON Patch")),
     }
 }
 
-fn path_to_json(path: &Path) -> String {
+pub(crate) fn path_to_json(path: &Path) -> String {
     let mut values = Vec::with_capacity(path.len());
     for segment in path.segments() {
         match segment {
@@ -823,107 +1333,104 @@ fn path_to_json(path: &Path) -> String {
                 let number = json_number_from_f64(*index as f64);
                 values.push(JsonValue::Number(number));
             }
+            PathSegment::Set => values.push(JsonValue::Object(serde_json::Map::new())),
+            PathSegment::MultiSet => values.push(JsonValue::Array(Vec::new())),
+            PathSegment::SetKeys(_) => {
+                values.push(serde_json::to_value(segment).expect("serialize set keys"));
+            }
         }
     }
-    serde_json::to_string(&JsonValue::Array(values)).expect("serialize path")
+    gojson::escape(serde_json::to_string(&JsonValue::Array(values)).expect("serialize path"))
 }
 
+/// Writes `path` as the pointer of a JSON Patch operation. Keys that look
+/// like list indices would read back as indices, so they are rejected.
 fn path_to_pointer(path: &Path) -> Result<String, RenderError> {
-    let mut pointer = String::new();
     for segment in path.segments() {
-        pointer.push('/');
-        match segment {
-            PathSegment::Index(index) => {
-                if *index == -1 {
-                    pointer.push('-');
-                } else {
-                    pointer.push_str(&index.to_string());
-                }
-            }
-            PathSegment::Key(key) => {
-                if key.parse::<i64>().is_ok() {
-                    return Err(RenderError::new(format!(
-                        "JSON Pointer does not support object keys that look like numbers: {key}"
-                    )));
-                }
-                if key == "-" {
-                    return Err(RenderError::new("JSON Pointer does not support object key '-'"));
-                }
-                pointer.push_str(&escape_pointer_segment(key));
-            }
+        let PathSegment::Key(key) = segment else {
+            continue;
+        };
+        if key.parse::<i64>().is_ok() {
+            return Err(RenderError::new(format!(
+                "JSON Pointer does not support object keys that look like numbers: {key}"
+            )));
+        }
+        if key == "-" {
+            return Err(RenderError::new("JSON Pointer does not support object key '-'"));
         }
     }
-    Ok(pointer)
+    path.to_json_pointer().map_err(|err| RenderError::new(err.to_string()))
+}
+
+/// Returns the path of every list position a hunk touches: one per value it
+/// removes or adds, whichever is more, counting from the hunk's index.
+fn changed_positions(element: &DiffElement) -> Vec<Path> {
+    let Some((PathSegment::Index(start @ 0..), parent)) = element.path.segments().split_last()
+    else {
+        return vec![element.path.clone()];
+    };
+    let count = element.remove.len().max(element.add.len()).max(1) as i64;
+    (*start..start + count)
+        .map(|index| {
+            let mut path = Path::from(parent.to_vec());
+            path.push(PathSegment::Index(index));
+            path
+        })
+        .collect()
 }
 
-fn escape_pointer_segment(segment: &str) -> String {
-    segment.replace('~', "~0").replace('/', "~1")
+/// Like [`path_to_pointer`], but writes set segments in their native
+/// notation in place of a reference token.
+fn path_to_listed_pointer(path: &Path) -> Result<String, RenderError> {
+    let segments = path.segments().iter().map(|segment| match segment {
+        PathSegment::Set | PathSegment::MultiSet | PathSegment::SetKeys(_) => {
+            PathSegment::key(segment.to_string())
+        }
+        _ => segment.clone(),
+    });
+    path_to_pointer(&Path::from(segments.collect::<Vec<_>>()))
 }
 
 fn json_number_from_f64(value: f64) -> JsonNumber {
     Number::new(value).expect("finite number").to_json_number()
 }
 
-fn color_string_diff(text: &str, common: &[char], color: &str) -> String {
-    let mut result = String::new();
-    let mut common_iter = common.iter();
-    let mut current = common_iter.next();
-    for ch in text.chars() {
-        if let Some(expected) = current {
-            if ch == *expected {
-                result.push(ch);
-                current = common_iter.next();
-                continue;
-            }
-        }
-        result.push_str(color);
-        result.push(ch);
-        result.push_str(COLOR_RESET);
-    }
-    result
+/// Computes the structural diff between two nodes.
+#[must_use]
+pub fn diff_nodes(lhs: &Node, rhs: &Node, options: &DiffOptions) -> Diff {
+    let options = &*options.for_diff();
+    finish(diff_impl(lhs, rhs, &Path::new(), options), options)
 }
 
-fn lcs_chars(lhs: &str, rhs: &str) -> Vec<char> {
-    let left: Vec<char> = lhs.chars().collect();
-    let right: Vec<char> = rhs.chars().collect();
-    let n = left.len();
-    let m = right.len();
-    let mut table = vec![vec![0usize; m + 1]; n + 1];
-    for (i, lhs_char) in left.iter().enumerate() {
-        for (j, rhs_char) in right.iter().enumerate() {
-            if lhs_char == rhs_char {
-                table[i + 1][j + 1] = table[i][j] + 1;
-            } else {
-                table[i + 1][j + 1] = table[i][j + 1].max(table[i + 1][j]);
-            }
-        }
+/// Completes a diff built under options from [`DiffOptions::for_diff`]:
+/// marks typed floats, ends progress reporting, and applies the size limits.
+pub(crate) fn finish(mut diff: Diff, options: &DiffOptions) -> Diff {
+    if options.number_equality() == NumberEquality::Typed {
+        diff = Diff::from_elements(diff.into_iter().map(with_float_forms).collect());
     }
-
-    let mut result = Vec::with_capacity(table[n][m]);
-    let mut i = n;
-    let mut j = m;
-    while i > 0 && j > 0 {
-        if left[i - 1] == right[j - 1] {
-            result.push(left[i - 1]);
-            i -= 1;
-            j -= 1;
-        } else if table[i - 1][j] >= table[i][j - 1] {
-            i -= 1;
-        } else {
-            j -= 1;
-        }
+    if let Some(tracker) = options.tracker() {
+        tracker.finish();
     }
-    result.reverse();
-    result
+    budget::truncate(diff, options)
 }
 
-/// Computes the structural diff between two nodes.
-#[must_use]
-pub fn diff_nodes(lhs: &Node, rhs: &Node, options: &DiffOptions) -> Diff {
-    diff_impl(lhs, rhs, &Path::new(), options)
+/// Makes the integral floats of a hunk print with their fraction, so a
+/// typed change from `1` to `1.0` does not render as `- 1` / `+ 1`.
+pub(super) fn with_float_forms(mut element: DiffElement) -> DiffElement {
+    let nodes = element.before.iter_mut().chain(&mut element.remove);
+    for node in nodes.chain(&mut element.add).chain(&mut element.after) {
+        node.show_float_forms();
+    }
+    element
 }
 
-pub(super) fn diff_impl(lhs: &Node, rhs: &Node, path: &Path, options: &DiffOptions) -> Diff {
+pub(crate) fn diff_impl(lhs: &Node, rhs: &Node, path: &Path, options: &DiffOptions) -> Diff {
+    if options.is_spent() {
+        return Diff::empty();
+    }
+    if let Some(tracker) = options.tracker() {
+        tracker.visited();
+    }
     if lhs.eq_with_options(rhs, options) {
         return Diff::empty();
     }
@@ -934,18 +1441,23 @@ pub(super) fn diff_impl(lhs: &Node, rhs: &Node, path: &Path, options: &DiffOptio
         }
         (Node::Array(left), Node::Array(right)) => match options.array_mode() {
             ArrayMode::List => list::diff_lists(left, right, path, options),
-            mode => {
-                panic!("array mode {mode:?} not implemented in diff engine");
-            }
+            ArrayMode::Set => set::diff_sets(left, right, path, options),
+            ArrayMode::MultiSet => multiset::diff_multisets(left, right, path, options),
         },
-        _ => primitives::diff_primitives(lhs, rhs, path),
+        _ => {
+            let diff = primitives::diff_primitives(lhs, rhs, path);
+            options.spend(diff.iter());
+            diff
+        }
     }
 }
 
 #[cfg(test)]
 mod tests {
+    use alloc::collections::BTreeMap;
+
     use super::*;
-    use crate::DiffOptions;
+    use crate::{DiffOption, DiffOptions, PathOption};
     use proptest::prelude::*;
 
     #[test]
@@ -1015,6 +1527,336 @@ mod tests {
         assert_eq!(diff, expected);
     }
 
+    #[test]
+    fn diff_of_sets_lists_removals_and_additions() {
+        let lhs = Node::from_json_str("{\"tags\":[\"alpha\",\"beta\",\"gamma\"]}").unwrap();
+        let rhs = Node::from_json_str("{\"tags\":[\"gamma\",\"beta\",\"delta\"]}").unwrap();
+        let options = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &options);
+        let expected = Diff::from_elements(vec![DiffElement::new()
+            .with_path(Path::from(vec![PathSegment::key("tags"), PathSegment::Set]))
+            .with_remove(vec![Node::from_json_str("\"alpha\"").unwrap()])
+            .with_add(vec![Node::from_json_str("\"delta\"").unwrap()])]);
+        assert_eq!(diff, expected);
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "@ [\"tags\",{}]\n- \"alpha\"\n+ \"delta\"\n"
+        );
+    }
+
+    #[test]
+    fn diff_of_sets_ignores_order_and_duplicates() {
+        let lhs = Node::from_json_str("[1,2,2,3]").unwrap();
+        let rhs = Node::from_json_str("[3,1,2]").unwrap();
+        let options = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+        assert!(diff_nodes(&lhs, &rhs, &options).is_empty());
+    }
+
+    #[test]
+    fn diff_of_multisets_counts_duplicates() {
+        let lhs =
+            Node::from_json_str("{\"inventory\":[\"widget\",\"widget\",\"gadget\"]}").unwrap();
+        let rhs =
+            Node::from_json_str("{\"inventory\":[\"widget\",\"gizmo\",\"widget\",\"gadget\"]}")
+                .unwrap();
+        let options = DiffOptions::default().with_array_mode(ArrayMode::MultiSet).unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &options);
+        let expected = Diff::from_elements(vec![DiffElement::new()
+            .with_path(Path::from(vec![PathSegment::key("inventory"), PathSegment::MultiSet]))
+            .with_add(vec![Node::from_json_str("\"gizmo\"").unwrap()])]);
+        assert_eq!(diff, expected);
+    }
+
+    #[test]
+    fn diff_of_multisets_reports_each_surplus_copy() {
+        let lhs = Node::from_json_str("[1,1,1,2]").unwrap();
+        let rhs = Node::from_json_str("[2,1]").unwrap();
+        let options = DiffOptions::default().with_array_mode(ArrayMode::MultiSet).unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &options);
+        assert_eq!(diff.render(&RenderConfig::default()), "@ [[]]\n- 1\n- 1\n");
+    }
+
+    #[test]
+    fn diff_of_sets_with_keys_recurses_into_matching_objects() {
+        let lhs = Node::from_json_str("[{\"id\":1,\"role\":\"user\"},{\"id\":2}]").unwrap();
+        let rhs = Node::from_json_str("[{\"id\":1,\"role\":\"admin\"},{\"id\":2}]").unwrap();
+        let options = DiffOptions::default().with_set_keys(["id"]).unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &options);
+        let identity = BTreeMap::from([("id".to_string(), Node::from_json_str("1").unwrap())]);
+        let expected = Diff::from_elements(vec![DiffElement::new()
+            .with_path(Path::from(vec![PathSegment::SetKeys(identity), PathSegment::key("role")]))
+            .with_remove(vec![Node::from_json_str("\"user\"").unwrap()])
+            .with_add(vec![Node::from_json_str("\"admin\"").unwrap()])]);
+        assert_eq!(diff, expected);
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "@ [{\"id\":1},\"role\"]\n- \"user\"\n+ \"admin\"\n"
+        );
+    }
+
+    #[test]
+    fn diff_of_sets_with_keys_falls_back_to_full_identity() {
+        let lhs = Node::from_json_str("[{\"name\":\"a\"}]").unwrap();
+        let rhs = Node::from_json_str("[{\"name\":\"b\"}]").unwrap();
+        let options = DiffOptions::default().with_set_keys(["id"]).unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &options);
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "@ [{}]\n- {\"name\":\"a\"}\n+ {\"name\":\"b\"}\n"
+        );
+    }
+
+    #[test]
+    fn path_options_scope_array_modes_to_subtrees() {
+        let lhs = Node::from_json_str("{\"a\":[1,2],\"b\":{\"c\":[1,1,2]}}").unwrap();
+        let rhs = Node::from_json_str("{\"a\":[2,1],\"b\":{\"c\":[2,1]}}").unwrap();
+        let options = DiffOptions::default()
+            .with_option(
+                DiffOption::from_header("^ {\"@\":[\"b\",\"c\"],\"^\":[\"MULTISET\"]}").unwrap(),
+            )
+            .unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &options);
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "@ [\"a\",0]\n[\n+ 2\n  1\n@ [\"a\",2]\n  1\n- 2\n]\n@ [\"b\",\"c\",[]]\n- 1\n"
+        );
+    }
+
+    #[test]
+    fn path_options_scope_precision_to_subtrees() {
+        let lhs = Node::from_json_str("{\"loose\":1.0,\"strict\":1.0}").unwrap();
+        let rhs = Node::from_json_str("{\"loose\":1.05,\"strict\":1.05}").unwrap();
+        let options = DiffOptions::default()
+            .with_path_option(PathOption::new(
+                PathSegment::key("loose"),
+                vec![DiffOption::Precision(0.1)],
+            ))
+            .unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &options);
+        assert_eq!(diff.render(&RenderConfig::default()), "@ [\"strict\"]\n- 1\n+ 1.05\n");
+    }
+
+    #[test]
+    fn precision_aligns_list_elements_within_tolerance() {
+        let lhs = Node::from_json_str("{\"latency\":[10.0,10.1,10.2],\"rate\":0.1}").unwrap();
+        let rhs = Node::from_json_str("{\"latency\":[10.0,10.11,10.35],\"rate\":0.12}").unwrap();
+        let options = DiffOptions::default().with_precision(0.05).unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &options);
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "@ [\"latency\",2]\n  10.11\n- 10.2\n+ 10.35\n]\n"
+        );
+    }
+
+    #[test]
+    fn precision_matches_set_members_within_tolerance() {
+        let lhs = Node::from_json_str("{\"tags\":[1.0,2.0,3.0]}").unwrap();
+        let rhs = Node::from_json_str("{\"tags\":[3.01,2.0,5.0]}").unwrap();
+        let options = DiffOptions::default()
+            .with_precision(0.05)
+            .unwrap()
+            .with_path_option(PathOption::new(PathSegment::key("tags"), vec![DiffOption::Set]))
+            .unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &options);
+        assert_eq!(diff.len(), 1);
+        assert_eq!(diff.elements[0].remove, vec![Node::from_json_str("1").unwrap()]);
+        assert_eq!(diff.elements[0].add, vec![Node::from_json_str("5").unwrap()]);
+    }
+
+    #[test]
+    fn precision_metadata_renders_as_option_header() {
+        let element = DiffElement::new()
+            .with_metadata(DiffMetadata::precision(0.01))
+            .with_path(PathSegment::key("a"))
+            .with_remove(vec![Node::from_json_str("1").unwrap()]);
+        let diff = Diff::from_elements(vec![element]);
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "^ {\"precision\":0.01}\n@ [\"a\"]\n- 1\n"
+        );
+    }
+
+    #[test]
+    fn set_paths_cannot_render_as_json_patch() {
+        let lhs = Node::from_json_str("[1]").unwrap();
+        let rhs = Node::from_json_str("[2]").unwrap();
+        let options = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+        let err = diff_nodes(&lhs, &rhs, &options).render_patch().unwrap_err();
+        assert_eq!(err.to_string(), "JSON Pointer does not support jd path element {}");
+    }
+
+    #[test]
+    fn path_lists_write_set_segments_natively() {
+        let lhs = Node::from_json_str(r#"{"tags":["a"],"items":[{"id":1,"v":"x"}]}"#).unwrap();
+        let rhs = Node::from_json_str(r#"{"tags":["b"],"items":[{"id":1,"v":"y"}]}"#).unwrap();
+        let options = DiffOptions::default()
+            .with_path_option(PathOption::new(PathSegment::key("tags"), vec![DiffOption::Set]))
+            .unwrap()
+            .with_path_option(PathOption::new(
+                PathSegment::key("items"),
+                vec![DiffOption::SetKeys(vec!["id".into()])],
+            ))
+            .unwrap();
+        assert_eq!(
+            diff_nodes(&lhs, &rhs, &options).render_paths().unwrap(),
+            "/items/{\"id\":1}/v\n/tags/{}\n"
+        );
+    }
+
+    #[test]
+    fn path_lists_name_each_path_once() {
+        let lhs = Node::from_json_str(r#"{"l":[1,2,3],"s":"a"}"#).unwrap();
+        let rhs = Node::from_json_str(r#"{"l":[3,1,2],"s":"b"}"#).unwrap();
+        let options = DiffOptions::default().with_move_detection(true);
+        assert_eq!(diff_nodes(&lhs, &rhs, &options).render_paths().unwrap(), "/l/2\n/l/0\n/s\n");
+        let lhs = Node::from_json_str("[1,2,3]").unwrap();
+        let rhs = Node::from_json_str("[4,5]").unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &DiffOptions::default());
+        assert_eq!(diff.render_paths().unwrap(), "/0\n/1\n/2\n");
+        assert_eq!(Diff::default().render_paths().unwrap(), "");
+    }
+
+    #[test]
+    fn ignored_paths_produce_no_hunks() {
+        let lhs = Node::from_json_str(r#"{"a":1,"ts":1,"l":[1,{"at":1}]}"#).unwrap();
+        let rhs = Node::from_json_str(r#"{"a":2,"uid":"x","l":[1,{"at":2}]}"#).unwrap();
+        let key = |key: &str| Path::from(PathSegment::key(key));
+        let at =
+            Path::from(vec![PathSegment::key("l"), PathSegment::index(1), PathSegment::key("at")]);
+        let options = DiffOptions::default().with_ignored_paths([key("ts"), key("uid"), at]);
+        assert_eq!(
+            diff_nodes(&lhs, &rhs, &options).render(&RenderConfig::default()),
+            "@ [\"a\"]\n- 1\n+ 2\n"
+        );
+        assert!(!lhs.eq_with_options(&rhs, &options));
+        let options = options.with_ignored_paths([key("a")]);
+        assert!(lhs.eq_with_options(&rhs, &options));
+        assert_eq!(lhs.hash_code(&options), rhs.hash_code(&options));
+    }
+
+    #[test]
+    fn ignored_fields_do_not_affect_set_membership() {
+        let lhs = Node::from_json_str(r#"[{"id":1,"at":1},{"id":2,"at":1}]"#).unwrap();
+        let rhs =
+            Node::from_json_str(r#"[{"id":2,"at":2},{"id":1,"at":3},{"id":3,"at":3}]"#).unwrap();
+        let options = DiffOptions::default()
+            .with_array_mode(ArrayMode::Set)
+            .unwrap()
+            .with_ignored_paths([Path::from(vec![PathSegment::Set, PathSegment::key("at")])]);
+        assert_eq!(
+            diff_nodes(&lhs, &rhs, &options).render(&RenderConfig::default()),
+            "@ [{}]\n+ {\"at\":3,\"id\":3}\n"
+        );
+    }
+
+    #[test]
+    fn excluded_keys_are_skipped_on_both_sides() {
+        let lhs = Node::from_json_str(r#"{"_id":1,"items":[{"id":1,"updated_at":1}]}"#).unwrap();
+        let rhs = Node::from_json_str(r#"{"_rev":2,"items":[{"id":1,"updated_at":2},{"id":2}]}"#)
+            .unwrap();
+        let options = DiffOptions::default().with_excluded_keys(["^_", "_at$"]).unwrap();
+        assert_eq!(
+            diff_nodes(&lhs, &rhs, &options).render(&RenderConfig::default()),
+            "@ [\"items\",1]\n  {\"id\":1,\"updated_at\":2}\n+ {\"id\":2}\n]\n"
+        );
+        let set = options.with_array_mode(ArrayMode::Set).unwrap();
+        let rhs = Node::from_json_str(r#"{"items":[{"id":1,"updated_at":3}]}"#).unwrap();
+        assert!(diff_nodes(&lhs, &rhs, &set).is_empty());
+        assert_eq!(lhs.hash_code(&set), rhs.hash_code(&set));
+    }
+
+    #[test]
+    fn filter_reindexes_list_hunks_after_dropped_ones() {
+        let lhs = Node::from_json_str(r#"{"l":[1,2,3,4,5]}"#).unwrap();
+        let rhs = Node::from_json_str(r#"{"l":[0,0,1,2,3,4,9]}"#).unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &DiffOptions::default());
+        let last = Path::from(vec![PathSegment::key("l"), PathSegment::index(4)]);
+        let filtered = diff.filter(|path| *path == last);
+        assert_eq!(filtered.render(&RenderConfig::default()), "@ [\"l\",4]\n  4\n- 5\n+ 9\n]\n");
+        let patched = lhs.apply_patch(&filtered).unwrap();
+        assert_eq!(patched, Node::from_json_str(r#"{"l":[1,2,3,4,9]}"#).unwrap());
+    }
+
+    #[test]
+    fn filter_restores_context_changed_by_dropped_hunks() {
+        let lhs = Node::from_json_str(r#"[{"a":1},2,{"a":1}]"#).unwrap();
+        let rhs = Node::from_json_str(r#"[{"a":2},3,{"a":2}]"#).unwrap();
+        let diff = diff_nodes(&lhs, &rhs, &DiffOptions::default());
+        let filtered = diff.filter(|path| path.len() == 1);
+        assert_eq!(
+            filtered.render(&RenderConfig::default()),
+            "@ [1]\n  {\"a\":1}\n- 2\n+ 3\n  {\"a\":1}\n"
+        );
+        let patched = lhs.apply_patch(&filtered).unwrap();
+        assert_eq!(patched, Node::from_json_str(r#"[{"a":1},3,{"a":1}]"#).unwrap());
+    }
+
+    #[test]
+    fn filter_moves_metadata_to_the_next_kept_hunk() {
+        let merge = |key: &str, value: &str| {
+            DiffElement::new()
+                .with_metadata(DiffMetadata::merge())
+                .with_path(Path::from(PathSegment::key(key)))
+                .with_add(vec![Node::from_json_str(value).unwrap()])
+        };
+        let diff = Diff::from_elements(vec![merge("a", "1"), merge("b", "2")]);
+        let b = Path::from(PathSegment::key("b"));
+        let filtered = diff.filter(|path| *path == b);
+        assert_eq!(
+            filtered.render(&RenderConfig::default()),
+            "^ {\"Merge\":true}\n@ [\"b\"]\n+ 2\n"
+        );
+        assert!(diff.filter(|_| false).is_empty());
+    }
+
+    #[test]
+    fn context_size_round_trips_and_patches() {
+        let cases = [
+            ("[1,2,3,4,5,6]", "[0,1,3,4,9,6,7]"),
+            ("[1,2,3]", "[]"),
+            ("[]", "[1,2]"),
+            ("[[1,2],3,{\"a\":[4,5]}]", "[[1,3],3,{\"a\":[4]}]"),
+            ("[1,2,3,4]", "[4,1,2,3]"),
+        ];
+        for size in 0..4 {
+            for moves in [false, true] {
+                let options =
+                    DiffOptions::default().with_context_size(size).with_move_detection(moves);
+                for (lhs, rhs) in cases {
+                    let (lhs, rhs) =
+                        (Node::from_json_str(lhs).unwrap(), Node::from_json_str(rhs).unwrap());
+                    let diff = lhs.diff(&rhs, &options);
+                    for element in diff.iter().filter(|element| element.path.len() == 1) {
+                        assert!(element.before.len() <= size && element.after.len() <= size);
+                    }
+                    let text = diff.render(&RenderConfig::default());
+                    let parsed = Diff::from_native_str(&text).unwrap();
+                    assert_eq!(parsed.render(&RenderConfig::default()), text);
+                    assert_eq!(lhs.apply_patch(&parsed).unwrap(), rhs, "size {size}: {text}");
+                }
+            }
+        }
+    }
+
+    #[test]
+    fn wider_context_catches_more_drift() {
+        let lhs = Node::from_json_str("[1,2,3,4,5]").unwrap();
+        let rhs = Node::from_json_str("[1,2,3,9,5]").unwrap();
+        let drifted = Node::from_json_str("[0,2,3,4,5]").unwrap();
+        let narrow = lhs.diff(&rhs, &DiffOptions::default());
+        assert_eq!(
+            drifted.apply_patch(&narrow).unwrap(),
+            Node::from_json_str("[0,2,3,9,5]").unwrap()
+        );
+        let wide = lhs.diff(&rhs, &DiffOptions::default().with_context_size(3));
+        assert_eq!(
+            wide.render(&RenderConfig::default()),
+            "@ [3]\n  1\n  2\n  3\n- 4\n+ 9\n  5\n]\n"
+        );
+        let err = drifted.apply_patch(&wide).unwrap_err();
+        assert_eq!(err.to_string(), "invalid patch. expected 1 before. got 0");
+    }
+
     fn arb_json_value() -> impl Strategy<Value = serde_json::Value> {
         use proptest::{collection::btree_map, collection::vec, string::string_regex};
 
@@ -0,0 +1,183 @@
+//! Move detection for list diffs.
+//!
+//! Elements left out of the longest common subsequence are paired up when a
+//! removed value equals an added one. Each pair is moved into place first,
+//! in the order the values appear in the target, right after the nearest
+//! element that precedes it there. The reordered list then shares every
+//! matched element with the target in the same order, so the regular list
+//! diff only has to handle what was genuinely removed, added, or changed.
+
+use super::list::{after_context, before_context};
+use super::{DiffElement, Path, PathSegment};
+use crate::hash::HashCode;
+use crate::prelude::*;
+use crate::Node;
+
+/// Moves found in a list, as hunks in patch order together with the order of
+/// the original elements once they are applied.
+pub(super) struct Moves {
+    pub(super) elements: Vec<DiffElement>,
+    pub(super) order: Vec<usize>,
+}
+
+/// Pairs removed and added elements with equal hashes and returns the moves
+/// that put them in place, with `size` elements of context on each side, or
+/// `None` when nothing moved.
+pub(super) fn detect(
+    lhs: &[Node],
+    path: &Path,
+    lhs_hashes: &[HashCode],
+    rhs_hashes: &[HashCode],
+    common: &[HashCode],
+    size: usize,
+) -> Option<Moves> {
+    let lhs_common = embed(lhs_hashes, common);
+    let rhs_common = embed(rhs_hashes, common);
+    let mut lhs_of_common = vec![0; common.len()];
+    for (index, position) in lhs_common.iter().enumerate() {
+        if let Some(position) = position {
+            lhs_of_common[*position] = index;
+        }
+    }
+
+    // The original element each target element is matched with, if any.
+    let mut matched: Vec<Option<usize>> =
+        rhs_common.iter().map(|position| position.map(|at| lhs_of_common[at])).collect();
+    let mut removed: Vec<usize> = (0..lhs.len()).filter(|i| lhs_common[*i].is_none()).collect();
+    let mut pairs = Vec::new();
+    for (target, hash) in rhs_hashes.iter().enumerate() {
+        if matched[target].is_some() {
+            continue;
+        }
+        if let Some(at) = removed.iter().position(|source| lhs_hashes[*source] == *hash) {
+            let source = removed.remove(at);
+            matched[target] = Some(source);
+            pairs.push((source, target));
+        }
+    }
+    if pairs.is_empty() {
+        return None;
+    }
+
+    let mut order: Vec<usize> = (0..lhs.len()).collect();
+    let mut elements = Vec::new();
+    for (source, target) in pairs {
+        let from = order.iter().position(|index| *index == source).expect("source is listed");
+        order.remove(from);
+        let to = matched[..target]
+            .iter()
+            .rev()
+            .find_map(|index| *index)
+            .map_or(0, |anchor| order.iter().position(|index| *index == anchor).unwrap() + 1);
+        order.insert(to, source);
+        if from == to {
+            continue;
+        }
+        let element = |at: usize| lhs[order[at]].clone();
+        elements.push(
+            DiffElement::new()
+                .with_path(path.clone().with_segment(PathSegment::index(to as i64)))
+                .with_moved_from(path.clone().with_segment(PathSegment::index(from as i64)))
+                .with_before(before_context(to, size, element))
+                .with_add(vec![lhs[source].clone()])
+                .with_after(after_context(to + 1, order.len(), size, element)),
+        );
+    }
+    Some(Moves { elements, order })
+}
+
+/// Maps each element to its position in `common`, matching greedily from
+/// the front the way the list diff walks the subsequence.
+fn embed(hashes: &[HashCode], common: &[HashCode]) -> Vec<Option<usize>> {
+    let mut next = 0;
+    hashes
+        .iter()
+        .map(|hash| {
+            if common.get(next) == Some(hash) {
+                next += 1;
+                Some(next - 1)
+            } else {
+                None
+            }
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffOptions, RenderConfig};
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    fn moves() -> DiffOptions {
+        DiffOptions::default().with_move_detection(true)
+    }
+
+    #[test]
+    fn embed_matches_the_subsequence_greedily() {
+        let hashes = [[1; 8], [2; 8], [1; 8], [3; 8]];
+        assert_eq!(embed(&hashes, &[[1; 8], [3; 8]]), [Some(0), None, None, Some(1)]);
+    }
+
+    #[test]
+    fn swapped_elements_become_one_move() {
+        let lhs = node(r#"[{"id":1},{"id":2},{"id":3}]"#);
+        let rhs = node(r#"[{"id":2},{"id":1},{"id":3}]"#);
+        let diff = lhs.diff(&rhs, &moves());
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "^ {\"from\":[1]}\n@ [0]\n[\n+ {\"id\":2}\n  {\"id\":1}\n"
+        );
+        assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+    }
+
+    #[test]
+    fn moves_combine_with_other_changes() {
+        let lhs = node("[1,2,3,4,5,6]");
+        let rhs = node("[6,1,2,7,4,5,3]");
+        let diff = lhs.diff(&rhs, &moves());
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "^ {\"from\":[5]}\n@ [0]\n[\n+ 6\n  1\n\
+             ^ {\"from\":[3]}\n@ [5]\n  5\n+ 3\n]\n\
+             @ [3]\n  2\n+ 7\n  4\n"
+        );
+        assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+        assert_eq!(rhs.apply_patch(&diff.reverse().unwrap()).unwrap(), lhs);
+    }
+
+    #[test]
+    fn unmoved_lists_diff_as_before() {
+        let lhs = node("[1,2,3]");
+        let rhs = node("[1,4,3,5]");
+        assert_eq!(lhs.diff(&rhs, &moves()), lhs.diff(&rhs, &DiffOptions::default()));
+    }
+
+    #[test]
+    fn moves_round_trip_through_native_and_json_patch() {
+        let lhs = node(r#"{"l":["a","b","c"]}"#);
+        let rhs = node(r#"{"l":["c","a","b"]}"#);
+        let diff = lhs.diff(&rhs, &moves());
+        let native = diff.render(&RenderConfig::default());
+        assert_eq!(crate::Diff::from_native_str(&native).unwrap(), diff);
+        assert_eq!(
+            diff.render_patch().unwrap(),
+            r#"[{"op":"test","path":"/l/2","value":"c"},{"op":"move","from":"/l/2","path":"/l/0"}]"#
+        );
+    }
+
+    #[test]
+    fn split_moves_survive_filtering_and_json_patch() {
+        let lhs = node(r#"{"a":[1,2,3],"b":[1,2]}"#);
+        let rhs = node(r#"{"a":[3,1,2],"b":[2,1]}"#);
+        let diff = lhs.diff(&rhs, &moves());
+        let a = Path::from(PathSegment::key("a"));
+        let filtered = diff.filter(|path| path.starts_with(&a));
+        assert_eq!(lhs.apply_patch(&filtered).unwrap(), node(r#"{"a":[3,1,2],"b":[1,2]}"#));
+        let patch = diff.render_patch().unwrap();
+        assert_eq!(lhs.apply_json_patch(&patch).unwrap(), rhs);
+    }
+}
@@ -0,0 +1,65 @@
+use alloc::collections::BTreeMap;
+
+use super::tolerance::{needs_classes, ToleranceClasses};
+use super::{Diff, DiffElement, Path, PathSegment};
+use crate::hash::HashCode;
+use crate::prelude::*;
+use crate::{DiffOptions, Node};
+
+/// Diffs two arrays as multisets where duplicate values are counted.
+///
+/// Mirrors Go's `jsonMultiset.diff`: each hash bucket contributes
+/// `lhs_count - rhs_count` removals or `rhs_count - lhs_count` additions to a
+/// single element under the `[]` path segment, in hash order.
+pub(super) fn diff_multisets(
+    lhs: &[Node],
+    rhs: &[Node],
+    path: &Path,
+    options: &DiffOptions,
+) -> Diff {
+    let options = &*options.refine(&PathSegment::MultiSet);
+    let mut classes = needs_classes(options).then(ToleranceClasses::new);
+    let lhs_counts = count_by_hash(lhs, options, classes.as_mut());
+    let rhs_counts = count_by_hash(rhs, options, classes.as_mut());
+
+    let mut remove = Vec::new();
+    for (hash, (node, count)) in &lhs_counts {
+        let other = rhs_counts.get(hash).map_or(0, |(_, count)| *count);
+        for _ in other..*count {
+            remove.push((*node).clone());
+        }
+    }
+    let mut add = Vec::new();
+    for (hash, (node, count)) in &rhs_counts {
+        let other = lhs_counts.get(hash).map_or(0, |(_, count)| *count);
+        for _ in other..*count {
+            add.push((*node).clone());
+        }
+    }
+
+    if remove.is_empty() && add.is_empty() {
+        return Diff::empty();
+    }
+    let element = DiffElement::new()
+        .with_path(path.clone().with_segment(PathSegment::MultiSet))
+        .with_remove(remove)
+        .with_add(add);
+    options.spend([&element]);
+    Diff::from_elements(vec![element])
+}
+
+fn count_by_hash<'a>(
+    values: &'a [Node],
+    options: &DiffOptions,
+    mut classes: Option<&mut ToleranceClasses>,
+) -> BTreeMap<HashCode, (&'a Node, usize)> {
+    let mut counts: BTreeMap<HashCode, (&Node, usize)> = BTreeMap::new();
+    for node in values {
+        let hash = match classes.as_deref_mut() {
+            Some(classes) => classes.hash(node, options),
+            None => node.hash_code(options),
+        };
+        counts.entry(hash).or_insert((node, 0)).1 += 1;
+    }
+    counts
+}
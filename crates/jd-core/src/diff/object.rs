@@ -1,6 +1,7 @@
-use std::collections::BTreeMap;
+use alloc::collections::BTreeMap;
 
 use super::{diff_impl, Diff, DiffElement, Path, PathSegment};
+use crate::prelude::*;
 use crate::{DiffOptions, Node};
 
 pub(super) fn diff_objects(
@@ -14,15 +15,23 @@ pub(super) fn diff_objects(
     let mut lhs_keys: Vec<_> = lhs.keys().cloned().collect();
     lhs_keys.sort();
     for key in lhs_keys {
+        if options.is_spent() {
+            break;
+        }
         let value = &lhs[&key];
+        let segment = PathSegment::key(key.clone());
+        let child_options = options.refine(&segment);
+        if child_options.is_ignored() {
+            continue;
+        }
         if let Some(other) = rhs.get(&key) {
-            let sub_path = path.clone().with_segment(PathSegment::key(key));
-            let diff = diff_impl(value, other, &sub_path, options);
+            let diff = diff_impl(value, other, &path.clone().with_segment(segment), &child_options);
             elements.extend(diff.into_iter());
         } else {
             let element = DiffElement::new()
                 .with_path(path.clone().with_segment(PathSegment::key(key)))
                 .with_remove(vec![value.clone()]);
+            options.spend([&element]);
             elements.push(element);
         }
     }
@@ -30,12 +39,16 @@ pub(super) fn diff_objects(
     let mut rhs_keys: Vec<_> = rhs.keys().cloned().collect();
     rhs_keys.sort();
     for key in rhs_keys {
-        if lhs.contains_key(&key) {
+        if options.is_spent() {
+            break;
+        }
+        if lhs.contains_key(&key) || options.refine(&PathSegment::key(key.clone())).is_ignored() {
             continue;
         }
         let element = DiffElement::new()
             .with_path(path.clone().with_segment(PathSegment::key(key.clone())))
             .with_add(vec![rhs[&key].clone()]);
+        options.spend([&element]);
         elements.push(element);
     }
 
@@ -0,0 +1,297 @@
+//! Parser for the native jd diff format.
+//!
+//! Mirrors Go's `ReadDiffString`: a line-oriented state machine over `^`
+//! option headers, `@` paths, `[`/`]` list boundaries, context lines, and
+//! `-`/`+` values. Option headers apply to the hunk that follows them.
+
+use super::{Diff, DiffElement, DiffMetadata, Path};
+use crate::prelude::*;
+use crate::{DiffOption, Node};
+
+/// Errors produced while parsing a native jd diff.
+///
+/// ```
+/// # use jd_core::Diff;
+/// let err = Diff::from_native_str("- 1\n").unwrap_err();
+/// assert_eq!(err.line(), 1);
+/// assert_eq!(err.to_string(), "invalid diff at line 1: unexpected '-'. expecting one of \"^@\"");
+/// ```
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct DiffParseError {
+    line: usize,
+    message: String,
+}
+
+impl DiffParseError {
+    pub(super) fn new(line: usize, message: impl Into<String>) -> Self {
+        Self { line, message: message.into() }
+    }
+
+    /// Returns the 1-based line number where parsing failed.
+    ///
+    /// ```
+    /// # use jd_core::Diff;
+    /// let err = Diff::from_native_str("@ [\"a\"]\n- {\n").unwrap_err();
+    /// assert_eq!(err.line(), 2);
+    /// ```
+    #[must_use]
+    pub fn line(&self) -> usize {
+        self.line
+    }
+}
+
+impl core::fmt::Display for DiffParseError {
+    fn fmt(&self, f: &mut core::fmt::Formatter<'_>) -> core::fmt::Result {
+        write!(f, "invalid diff at line {}: {}", self.line, self.message)
+    }
+}
+
+impl core::error::Error for DiffParseError {}
+
+#[derive(Clone, Copy, PartialEq, Eq)]
+enum State {
+    Init,
+    Meta,
+    At,
+    Before,
+    Remove,
+    Add,
+    After,
+    Closed,
+}
+
+impl State {
+    fn allowed(self) -> &'static str {
+        match self {
+            Self::Init | Self::Meta | Self::Closed => "^@",
+            Self::At => "[ -+",
+            Self::Before => " -+",
+            Self::Remove => "-+ ]^@",
+            Self::Add => "+ ]^@",
+            Self::After => " ]^@",
+        }
+    }
+}
+
+pub(super) fn parse_native(input: &str) -> Result<Diff, DiffParseError> {
+    let mut elements = Vec::new();
+    let mut metadata: Option<DiffMetadata> = None;
+    let mut moved_from: Option<Path> = None;
+    let mut element: Option<DiffElement> = None;
+    let mut state = State::Init;
+
+    for (index, line) in input.lines().enumerate() {
+        let number = index + 1;
+        let Some(header) = line.chars().next() else {
+            continue;
+        };
+        if !state.allowed().contains(header) {
+            return Err(DiffParseError::new(
+                number,
+                format!("unexpected {header:?}. expecting one of {:?}", state.allowed()),
+            ));
+        }
+        let payload = line.get(1..).unwrap_or_default();
+
+        match header {
+            '^' => {
+                finish(&mut elements, element.take(), number)?;
+                if let Some(from) = move_header(payload) {
+                    moved_from = Some(from);
+                    state = State::Meta;
+                    continue;
+                }
+                let option = match merge_header(payload) {
+                    Some(option) => option,
+                    None => DiffOption::from_header(line)
+                        .map(HeaderOption::from)
+                        .map_err(|err| DiffParseError::new(number, err.to_string()))?,
+                };
+                absorb_header(metadata.get_or_insert_with(DiffMetadata::default), option);
+                state = State::Meta;
+            }
+            '@' => {
+                finish(&mut elements, element.take(), number)?;
+                let path: Path = serde_json::from_str(payload.trim())
+                    .map_err(|err| DiffParseError::new(number, format!("invalid path: {err}")))?;
+                let mut next = DiffElement::new().with_path(path);
+                next.metadata = metadata.take();
+                next.moved_from = moved_from.take();
+                element = Some(next);
+                state = State::At;
+            }
+            '[' => {
+                element.as_mut().expect("path precedes context").before.push(Node::Void);
+                state = State::Before;
+            }
+            ']' => {
+                element.as_mut().expect("path precedes context").after.push(Node::Void);
+                state = State::Closed;
+            }
+            ' ' => {
+                let value = parse_value(payload, number)?;
+                let current = element.as_mut().expect("path precedes context");
+                if matches!(state, State::At | State::Before) {
+                    current.before.push(value);
+                    state = State::Before;
+                } else {
+                    current.after.push(value);
+                    state = State::After;
+                }
+            }
+            '-' => {
+                let value = parse_value(payload, number)?;
+                element.as_mut().expect("path precedes values").remove.push(value);
+                state = State::Remove;
+            }
+            '+' => {
+                // A bare `+` adds nothing, which merge diffs use to delete.
+                let value =
+                    if payload.is_empty() { Node::Void } else { parse_value(payload, number)? };
+                element.as_mut().expect("path precedes values").add.push(value);
+                state = State::Add;
+            }
+            _ => unreachable!("header validated against allowed set"),
+        }
+    }
+
+    let last_line = input.lines().count();
+    if matches!(state, State::At | State::Before) {
+        return Err(DiffParseError::new(last_line, "hunk has no removals or additions"));
+    }
+    if metadata.is_some() || moved_from.is_some() {
+        return Err(DiffParseError::new(last_line, "option header is not followed by a hunk"));
+    }
+    finish(&mut elements, element, last_line)?;
+    Ok(Diff::from_elements(elements))
+}
+
+fn finish(
+    elements: &mut Vec<DiffElement>,
+    element: Option<DiffElement>,
+    line: usize,
+) -> Result<(), DiffParseError> {
+    let Some(element) = element else {
+        return Ok(());
+    };
+    if element.remove.is_empty() && element.add.is_empty() {
+        return Err(DiffParseError::new(line, "hunk has no removals or additions"));
+    }
+    elements.push(element);
+    Ok(())
+}
+
+pub(super) fn parse_value(payload: &str, line: usize) -> Result<Node, DiffParseError> {
+    let Some(json) = payload.strip_prefix(' ').filter(|json| !json.trim().is_empty()) else {
+        return Err(DiffParseError::new(line, "expected a JSON value after the line header"));
+    };
+    Node::from_json_str(json).map_err(|err| DiffParseError::new(line, err.to_string()))
+}
+
+/// Recognises the legacy `{"Merge":true}` metadata header.
+fn merge_header(payload: &str) -> Option<HeaderOption> {
+    let value: serde_json::Value = serde_json::from_str(payload.trim()).ok()?;
+    (value == serde_json::json!({"Merge": true})).then_some(HeaderOption::Merge)
+}
+
+/// Recognises the `{"from":path}` header that marks the next hunk as a move.
+fn move_header(payload: &str) -> Option<Path> {
+    let value: serde_json::Value = serde_json::from_str(payload.trim()).ok()?;
+    let map = value.as_object().filter(|map| map.len() == 1)?;
+    serde_json::from_value(map.get("from")?.clone()).ok()
+}
+
+enum HeaderOption {
+    Merge,
+    Option(DiffOption),
+}
+
+impl From<DiffOption> for HeaderOption {
+    fn from(option: DiffOption) -> Self {
+        Self::Option(option)
+    }
+}
+
+fn absorb_header(metadata: &mut DiffMetadata, option: HeaderOption) {
+    match option {
+        HeaderOption::Merge => metadata.merge = true,
+        HeaderOption::Option(option) => metadata.absorb_options([option]),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffOptions, PathSegment, RenderConfig};
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    #[test]
+    fn round_trips_rendered_diffs() {
+        let lhs = node(r#"{"a":[1,2,3],"b":{"c":"x"},"d":true}"#);
+        let rhs = node(r#"{"a":[1,4,3,5],"b":{"c":"y"}}"#);
+        let diff = lhs.diff(&rhs, &DiffOptions::default());
+        let rendered = diff.render(&RenderConfig::default());
+        assert_eq!(parse_native(&rendered).unwrap(), diff);
+    }
+
+    #[test]
+    fn parses_list_boundaries_as_void_context() {
+        let diff = parse_native("@ [0]\n[\n+ 1\n]\n").unwrap();
+        let element = &diff.into_elements()[0];
+        assert_eq!(element.path, Path::from(vec![PathSegment::index(0)]));
+        assert_eq!(element.before, vec![Node::Void]);
+        assert_eq!(element.add, vec![node("1")]);
+        assert_eq!(element.after, vec![Node::Void]);
+    }
+
+    #[test]
+    fn attaches_headers_to_the_next_hunk() {
+        let input = "^ {\"Merge\":true}\n^ {\"precision\":0.5}\n@ [\"a\"]\n+\n@ [\"b\"]\n+ 1\n";
+        let elements = parse_native(input).unwrap().into_elements();
+        let metadata = elements[0].metadata.as_ref().unwrap();
+        assert!(metadata.merge);
+        assert_eq!(metadata.precision, Some(0.5));
+        assert_eq!(elements[0].add, vec![Node::Void]);
+        assert!(elements[1].metadata.is_none());
+    }
+
+    #[test]
+    fn keeps_array_mode_and_path_headers() {
+        let input =
+            "^ \"SET\"\n^ {\"@\":[\"n\"],\"^\":[{\"precision\":0.1}]}\n@ [\"tags\",{}]\n- 1\n";
+        let diff = parse_native(input).unwrap();
+        let elements = diff.iter().collect::<Vec<_>>();
+        assert_eq!(elements[0].path, Path::from(vec![PathSegment::key("tags"), PathSegment::Set]));
+        let options = &elements[0].metadata.as_ref().unwrap().options;
+        assert_eq!(options[0], DiffOption::Set);
+        assert_eq!(options[1].to_string(), r#"{"@":["n"],"^":[{"precision":0.1}]}"#);
+        assert_eq!(diff.render(&RenderConfig::default()), input);
+    }
+
+    #[test]
+    fn reports_unexpected_lines() {
+        let err = parse_native("@ [\"a\"]\n- 1\n[\n").unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "invalid diff at line 3: unexpected '['. expecting one of \"-+ ]^@\""
+        );
+        let err = parse_native("@ [\"a\"]\n  1\n").unwrap_err();
+        assert_eq!(err.to_string(), "invalid diff at line 2: hunk has no removals or additions");
+        let err = parse_native("^ \"BOGUS\"\n").unwrap_err();
+        assert_eq!(err.to_string(), "invalid diff at line 1: invalid option: \"BOGUS\"");
+        let err = parse_native("@ [\"a\"]\n-1\n").unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "invalid diff at line 2: expected a JSON value after the line header"
+        );
+    }
+
+    #[test]
+    fn empty_input_is_an_empty_diff() {
+        assert!(parse_native("").unwrap().is_empty());
+        assert!(parse_native("\n\n").unwrap().is_empty());
+    }
+}
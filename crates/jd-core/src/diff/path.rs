@@ -1,11 +1,22 @@
-use std::fmt;
+use alloc::collections::BTreeMap;
+use core::fmt;
+use core::hash::{Hash, Hasher};
 
-use serde::{Deserialize, Deserializer, Serialize, Serializer};
+use serde::{
+    ser::{SerializeMap, SerializeSeq},
+    Deserialize, Deserializer, Serialize, Serializer,
+};
+use serde_json::Value as JsonValue;
+
+use crate::prelude::*;
+use crate::{DiffOptions, Node, PointerError};
 
 /// Represents a single element within a diff path.
 ///
-/// A segment can either refer to an object key or an array index. Future
-/// milestones will add set and multiset markers.
+/// A segment can refer to an object key, an array index, or mark an array
+/// that is treated as a set or multiset. Set markers render as `{}`,
+/// multiset markers as `[]`, and set-key identities (objects matched by
+/// their `setkeys` fields) as `{"id":1}` in the native format.
 ///
 /// ```
 /// # use jd_core::diff::PathSegment;
@@ -13,13 +24,42 @@ use serde::{Deserialize, Deserializer, Serialize, Serializer};
 /// let index = PathSegment::index(2);
 /// assert!(matches!(key, PathSegment::Key(_)));
 /// assert!(matches!(index, PathSegment::Index(_)));
+/// assert_eq!(PathSegment::Set.to_string(), "{}");
+/// assert_eq!(PathSegment::MultiSet.to_string(), "[]");
 /// ```
-#[derive(Clone, Debug, PartialEq, Eq, Hash)]
+#[derive(Clone, Debug, PartialEq)]
 pub enum PathSegment {
     /// Object key lookup.
     Key(String),
     /// Array index lookup.
     Index(i64),
+    /// Marks an array compared as a set (`{}`).
+    Set,
+    /// Marks an array compared as a multiset (`[]`).
+    MultiSet,
+    /// Selects the object within a set whose identity fields match.
+    SetKeys(BTreeMap<String, Node>),
+}
+
+// Nodes never hold NaN, so structural equality is reflexive.
+impl Eq for PathSegment {}
+
+impl Hash for PathSegment {
+    fn hash<H: Hasher>(&self, state: &mut H) {
+        core::mem::discriminant(self).hash(state);
+        match self {
+            Self::Key(key) => key.hash(state),
+            Self::Index(index) => index.hash(state),
+            Self::Set | Self::MultiSet => {}
+            Self::SetKeys(keys) => {
+                let options = DiffOptions::default();
+                for (key, value) in keys {
+                    key.hash(state);
+                    value.hash_code(&options).hash(state);
+                }
+            }
+        }
+    }
 }
 
 impl PathSegment {
@@ -47,10 +87,21 @@ impl fmt::Display for PathSegment {
         match self {
             Self::Key(key) => f.write_str(key),
             Self::Index(index) => write!(f, "{index}"),
+            Self::Set => f.write_str("{}"),
+            Self::MultiSet => f.write_str("[]"),
+            Self::SetKeys(keys) => f.write_str(&set_keys_json(keys).to_string()),
         }
     }
 }
 
+fn set_keys_json(keys: &BTreeMap<String, Node>) -> JsonValue {
+    JsonValue::Object(
+        keys.iter()
+            .map(|(key, value)| (key.clone(), value.to_json_value().unwrap_or(JsonValue::Null)))
+            .collect(),
+    )
+}
+
 impl Serialize for PathSegment {
     fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
     where
@@ -59,6 +110,9 @@ impl Serialize for PathSegment {
         match self {
             Self::Key(key) => serializer.serialize_str(key),
             Self::Index(index) => serializer.serialize_i64(*index),
+            Self::Set => serializer.serialize_map(Some(0))?.end(),
+            Self::MultiSet => serializer.serialize_seq(Some(0))?.end(),
+            Self::SetKeys(keys) => set_keys_json(keys).serialize(serializer),
         }
     }
 }
@@ -73,8 +127,8 @@ impl<'de> Deserialize<'de> for PathSegment {
         impl<'de> serde::de::Visitor<'de> for Visitor {
             type Value = PathSegment;
 
-            fn expecting(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
-                f.write_str("a string key or integer index")
+            fn expecting(&self, f: &mut core::fmt::Formatter<'_>) -> core::fmt::Result {
+                f.write_str("a string key, integer index, set marker, or empty multiset marker")
             }
 
             fn visit_str<E>(self, v: &str) -> Result<Self::Value, E>
@@ -105,6 +159,32 @@ impl<'de> Deserialize<'de> for PathSegment {
                 let value = i64::try_from(v).map_err(|_| E::custom("index exceeds i64"))?;
                 Ok(PathSegment::Index(value))
             }
+
+            fn visit_map<A>(self, mut map: A) -> Result<Self::Value, A::Error>
+            where
+                A: serde::de::MapAccess<'de>,
+            {
+                let mut keys = BTreeMap::new();
+                while let Some((key, value)) = map.next_entry::<String, JsonValue>()? {
+                    let node = Node::from_json_value(value).map_err(serde::de::Error::custom)?;
+                    keys.insert(key, node);
+                }
+                if keys.is_empty() {
+                    Ok(PathSegment::Set)
+                } else {
+                    Ok(PathSegment::SetKeys(keys))
+                }
+            }
+
+            fn visit_seq<A>(self, mut seq: A) -> Result<Self::Value, A::Error>
+            where
+                A: serde::de::SeqAccess<'de>,
+            {
+                if seq.next_element::<serde::de::IgnoredAny>()?.is_some() {
+                    return Err(serde::de::Error::custom("multiset marker must be an empty array"));
+                }
+                Ok(PathSegment::MultiSet)
+            }
         }
 
         deserializer.deserialize_any(Visitor)
@@ -113,6 +193,16 @@ impl<'de> Deserialize<'de> for PathSegment {
 
 /// Represents the fully qualified location of a diff hunk within a document.
 ///
+/// With serde a path is the JSON array the native format prints in hunk
+/// headers: strings for keys, integers for indices, `{}` and `[]` for set
+/// and multiset markers, and an object of identity fields for set keys.
+///
+/// ```
+/// # use jd_core::diff::Path;
+/// let path: Path = serde_json::from_str(r#"["tags",{},[],{"id":1},0]"#).unwrap();
+/// assert_eq!(serde_json::to_string(&path).unwrap(), r#"["tags",{},[],{"id":1},0]"#);
+/// ```
+///
 /// ```
 /// # use jd_core::diff::{Path, PathSegment};
 /// let path = Path::new().with_segment(PathSegment::key("foo"))
@@ -169,6 +259,20 @@ impl Path {
         Self(segments)
     }
 
+    /// Returns whether `prefix` is a leading part of this path. Every path
+    /// starts with the root path.
+    ///
+    /// ```
+    /// # use jd_core::diff::{Path, PathSegment};
+    /// let path = Path::from(vec![PathSegment::key("spec"), PathSegment::index(0)]);
+    /// assert!(path.starts_with(&Path::from(PathSegment::key("spec"))));
+    /// assert!(!path.starts_with(&Path::from(PathSegment::key("status"))));
+    /// ```
+    #[must_use]
+    pub fn starts_with(&self, prefix: &Path) -> bool {
+        self.0.starts_with(&prefix.0)
+    }
+
     /// Consumes the path and returns the owned segments.
     ///
     /// ```
@@ -205,6 +309,91 @@ impl Path {
     pub fn pop(&mut self) -> Option<PathSegment> {
         self.0.pop()
     }
+
+    /// Writes the path as an RFC 6901 JSON Pointer, escaping `~` as `~0` and
+    /// `/` as `~1`. Index `-1`, which jd uses for the end of a list, becomes
+    /// `-`. Set and multiset segments name no single location, so they are
+    /// rejected.
+    ///
+    /// ```
+    /// # use jd_core::diff::{Path, PathSegment};
+    /// let path = Path::from(vec![PathSegment::key("a/b"), PathSegment::index(0)]);
+    /// assert_eq!(path.to_json_pointer().unwrap(), "/a~1b/0");
+    /// assert_eq!(Path::new().to_json_pointer().unwrap(), "");
+    /// assert!(Path::from(PathSegment::Set).to_json_pointer().is_err());
+    /// ```
+    pub fn to_json_pointer(&self) -> Result<String, PointerError> {
+        let mut pointer = String::new();
+        for segment in &self.0 {
+            pointer.push('/');
+            match segment {
+                PathSegment::Index(-1) => pointer.push('-'),
+                PathSegment::Index(index) => pointer.push_str(&index.to_string()),
+                PathSegment::Key(key) => {
+                    pointer.push_str(&key.replace('~', "~0").replace('/', "~1"));
+                }
+                PathSegment::Set | PathSegment::MultiSet | PathSegment::SetKeys(_) => {
+                    return Err(PointerError::UnsupportedSegment { segment: segment.to_string() });
+                }
+            }
+        }
+        Ok(pointer)
+    }
+
+    /// Reads an RFC 6901 JSON Pointer. A pointer carries no types, so tokens
+    /// that are list indices by the RFC (`0`, or digits without a leading
+    /// zero) become [`PathSegment::Index`], `-` becomes index `-1`, and every
+    /// other token becomes an unescaped [`PathSegment::Key`].
+    ///
+    /// ```
+    /// # use jd_core::diff::{Path, PathSegment};
+    /// let path = Path::from_json_pointer("/a~1b/0/~0x/01").unwrap();
+    /// assert_eq!(
+    ///     path,
+    ///     Path::from(vec![
+    ///         PathSegment::key("a/b"),
+    ///         PathSegment::index(0),
+    ///         PathSegment::key("~x"),
+    ///         PathSegment::key("01"),
+    ///     ])
+    /// );
+    /// assert!(Path::from_json_pointer("/a~2").is_err());
+    /// ```
+    pub fn from_json_pointer(pointer: &str) -> Result<Self, PointerError> {
+        let invalid = || PointerError::Invalid { pointer: pointer.to_string() };
+        if pointer.is_empty() {
+            return Ok(Self::new());
+        }
+        let rest = pointer.strip_prefix('/').ok_or_else(invalid)?;
+        rest.split('/')
+            .map(|token| {
+                if token == "-" {
+                    return Ok(PathSegment::Index(-1));
+                }
+                let index = !token.is_empty()
+                    && token.bytes().all(|byte| byte.is_ascii_digit())
+                    && (token == "0" || !token.starts_with('0'));
+                if let Some(index) = index.then(|| token.parse::<i64>().ok()).flatten() {
+                    return Ok(PathSegment::Index(index));
+                }
+                let mut key = String::with_capacity(token.len());
+                let mut chars = token.chars();
+                while let Some(ch) = chars.next() {
+                    if ch != '~' {
+                        key.push(ch);
+                        continue;
+                    }
+                    match chars.next() {
+                        Some('0') => key.push('~'),
+                        Some('1') => key.push('/'),
+                        _ => return Err(invalid()),
+                    }
+                }
+                Ok(PathSegment::Key(key))
+            })
+            .collect::<Result<Vec<_>, _>>()
+            .map(Self)
+    }
 }
 
 impl From<Vec<PathSegment>> for Path {
@@ -234,7 +423,7 @@ impl fmt::Display for Path {
 
 impl<'a> IntoIterator for &'a Path {
     type Item = &'a PathSegment;
-    type IntoIter = std::slice::Iter<'a, PathSegment>;
+    type IntoIter = core::slice::Iter<'a, PathSegment>;
 
     fn into_iter(self) -> Self::IntoIter {
         self.0.iter()
@@ -243,7 +432,7 @@ impl<'a> IntoIterator for &'a Path {
 
 impl IntoIterator for Path {
     type Item = PathSegment;
-    type IntoIter = std::vec::IntoIter<PathSegment>;
+    type IntoIter = alloc::vec::IntoIter<PathSegment>;
 
     fn into_iter(self) -> Self::IntoIter {
         self.0.into_iter()
@@ -289,4 +478,67 @@ mod tests {
         let decoded: Path = serde_json::from_str(&json).unwrap();
         assert_eq!(decoded, path);
     }
+
+    #[test]
+    fn serde_round_trip_for_set_segments() {
+        let path = path_from_segments([PathSegment::key("tags"), PathSegment::Set]);
+        let json = serde_json::to_string(&path).unwrap();
+        assert_eq!(json, "[\"tags\",{}]");
+        let decoded: Path = serde_json::from_str(&json).unwrap();
+        assert_eq!(decoded, path);
+        assert_eq!(path.to_string(), "[tags {}]");
+    }
+
+    #[test]
+    fn serde_round_trip_for_multiset_segments() {
+        let path = path_from_segments([PathSegment::key("inventory"), PathSegment::MultiSet]);
+        let json = serde_json::to_string(&path).unwrap();
+        assert_eq!(json, "[\"inventory\",[]]");
+        let decoded: Path = serde_json::from_str(&json).unwrap();
+        assert_eq!(decoded, path);
+    }
+
+    #[test]
+    fn serde_round_trip_for_set_keys_segments() {
+        let keys = BTreeMap::from([("id".to_string(), Node::from_json_str("1").unwrap())]);
+        let path = path_from_segments([
+            PathSegment::key("users"),
+            PathSegment::SetKeys(keys),
+            PathSegment::key("role"),
+        ]);
+        let json = serde_json::to_string(&path).unwrap();
+        assert_eq!(json, "[\"users\",{\"id\":1},\"role\"]");
+        let decoded: Path = serde_json::from_str(&json).unwrap();
+        assert_eq!(decoded, path);
+        assert_eq!(path.to_string(), "[users {\"id\":1} role]");
+    }
+
+    #[test]
+    fn json_pointers_round_trip() {
+        let path = path_from_segments([
+            PathSegment::key("a~/b"),
+            PathSegment::key(""),
+            PathSegment::index(12),
+            PathSegment::index(-1),
+        ]);
+        let pointer = path.to_json_pointer().unwrap();
+        assert_eq!(pointer, "/a~0~1b//12/-");
+        assert_eq!(Path::from_json_pointer(&pointer).unwrap(), path);
+    }
+
+    #[test]
+    fn json_pointers_reject_bad_input() {
+        for pointer in ["a", "/~", "/a~x"] {
+            let err = Path::from_json_pointer(pointer).unwrap_err();
+            assert_eq!(err.to_string(), format!("invalid JSON Pointer {pointer:?}"));
+        }
+        let path = path_from_segments([PathSegment::key("tags"), PathSegment::MultiSet]);
+        assert_eq!(
+            path.to_json_pointer().unwrap_err().to_string(),
+            "JSON Pointer does not support jd path element []"
+        );
+        // Tokens that are not RFC 6901 indices stay keys.
+        let keys = Path::from_json_pointer("/-1/+1/99999999999999999999").unwrap();
+        assert!(keys.segments().iter().all(|segment| matches!(segment, PathSegment::Key(_))));
+    }
 }
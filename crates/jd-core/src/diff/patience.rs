@@ -0,0 +1,207 @@
+//! Patience alignment for list diffs.
+//!
+//! Elements that occur exactly once on both sides anchor the alignment: the
+//! longest run of such anchors appearing in the same order on both sides is
+//! matched first, and the gaps between anchors are aligned recursively.
+//! Ranges without unique elements fall back to the longest common
+//! subsequence. Repeated values such as `{}` or `"---"` then no longer pull
+//! unrelated parts of two lists together.
+
+use hashbrown::HashMap;
+
+use crate::hash::HashCode;
+use crate::prelude::*;
+use crate::CancellationToken;
+
+/// Returns the `(lhs, rhs)` index pairs matched by patience alignment, in
+/// increasing order on both sides.
+pub(super) fn align(
+    lhs: &[HashCode],
+    rhs: &[HashCode],
+    max_cost: u64,
+    cancel: Option<&CancellationToken>,
+) -> Vec<(usize, usize)> {
+    let mut pairs = Vec::new();
+    align_range(lhs, rhs, 0, 0, &mut pairs, max_cost, cancel);
+    pairs
+}
+
+/// Rewrites matched pairs as hash sequences for the list walk, which follows
+/// a common subsequence of hashes. The `k`-th pair shares a key of its own
+/// and every unmatched element gets a key that is never common, so the walk
+/// matches exactly the given pairs.
+pub(super) fn keys(
+    pairs: &[(usize, usize)],
+    lhs_len: usize,
+    rhs_len: usize,
+) -> (Vec<HashCode>, Vec<HashCode>, Vec<HashCode>) {
+    const UNMATCHED: HashCode = [0; 8];
+    let mut lhs = vec![UNMATCHED; lhs_len];
+    let mut rhs = vec![UNMATCHED; rhs_len];
+    let mut common = Vec::with_capacity(pairs.len());
+    for (k, (i, j)) in pairs.iter().enumerate() {
+        let key = (k as u64 + 1).to_be_bytes();
+        lhs[*i] = key;
+        rhs[*j] = key;
+        common.push(key);
+    }
+    (lhs, rhs, common)
+}
+
+fn align_range(
+    lhs: &[HashCode],
+    rhs: &[HashCode],
+    lhs_offset: usize,
+    rhs_offset: usize,
+    pairs: &mut Vec<(usize, usize)>,
+    max_cost: u64,
+    cancel: Option<&CancellationToken>,
+) {
+    let prefix = lhs.iter().zip(rhs).take_while(|(a, b)| a == b).count();
+    pairs.extend((0..prefix).map(|i| (lhs_offset + i, rhs_offset + i)));
+    let (lhs, rhs) = (&lhs[prefix..], &rhs[prefix..]);
+    let (lhs_offset, rhs_offset) = (lhs_offset + prefix, rhs_offset + prefix);
+
+    let suffix = lhs.iter().rev().zip(rhs.iter().rev()).take_while(|(a, b)| a == b).count();
+    let (lhs_mid, rhs_mid) = (&lhs[..lhs.len() - suffix], &rhs[..rhs.len() - suffix]);
+
+    let anchors = unique_anchors(lhs_mid, rhs_mid);
+    if anchors.is_empty() {
+        let matched = super::lcs::lcs_pairs(lhs_mid, rhs_mid, max_cost, cancel);
+        pairs.extend(matched.into_iter().map(|(i, j)| (lhs_offset + i, rhs_offset + j)));
+    } else {
+        let (mut i_start, mut j_start) = (0, 0);
+        for (i, j) in anchors {
+            align_range(
+                &lhs_mid[i_start..i],
+                &rhs_mid[j_start..j],
+                lhs_offset + i_start,
+                rhs_offset + j_start,
+                pairs,
+                max_cost,
+                cancel,
+            );
+            pairs.push((lhs_offset + i, rhs_offset + j));
+            (i_start, j_start) = (i + 1, j + 1);
+        }
+        align_range(
+            &lhs_mid[i_start..],
+            &rhs_mid[j_start..],
+            lhs_offset + i_start,
+            rhs_offset + j_start,
+            pairs,
+            max_cost,
+            cancel,
+        );
+    }
+
+    let (lhs_end, rhs_end) = (lhs_offset + lhs_mid.len(), rhs_offset + rhs_mid.len());
+    pairs.extend((0..suffix).map(|i| (lhs_end + i, rhs_end + i)));
+}
+
+/// Returns the longest in-order run of elements unique to both sides.
+pub(super) fn unique_anchors(lhs: &[HashCode], rhs: &[HashCode]) -> Vec<(usize, usize)> {
+    // Occurrence counts and last positions on each side.
+    let mut seen: HashMap<HashCode, (usize, usize, usize, usize)> = HashMap::new();
+    for (i, hash) in lhs.iter().enumerate() {
+        let entry = seen.entry(*hash).or_default();
+        entry.0 += 1;
+        entry.2 = i;
+    }
+    for (j, hash) in rhs.iter().enumerate() {
+        if let Some(entry) = seen.get_mut(hash) {
+            entry.1 += 1;
+            entry.3 = j;
+        }
+    }
+    let mut unique: Vec<(usize, usize)> = seen
+        .into_values()
+        .filter(|(a, b, _, _)| *a == 1 && *b == 1)
+        .map(|(_, _, i, j)| (i, j))
+        .collect();
+    unique.sort_unstable();
+    longest_increasing(&unique)
+}
+
+/// Patience sorting: the longest subsequence of `pairs` (sorted by lhs
+/// index) whose rhs indices increase.
+fn longest_increasing(pairs: &[(usize, usize)]) -> Vec<(usize, usize)> {
+    // Top card of each pile, and the card below it in the previous pile.
+    let mut tops: Vec<usize> = Vec::new();
+    let mut below: Vec<Option<usize>> = vec![None; pairs.len()];
+    for (card, (_, j)) in pairs.iter().enumerate() {
+        let pile = tops.partition_point(|top| pairs[*top].1 < *j);
+        below[card] = pile.checked_sub(1).map(|previous| tops[previous]);
+        if pile == tops.len() {
+            tops.push(card);
+        } else {
+            tops[pile] = card;
+        }
+    }
+    let mut run = Vec::with_capacity(tops.len());
+    let mut card = tops.last().copied();
+    while let Some(current) = card {
+        run.push(pairs[current]);
+        card = below[current];
+    }
+    run.reverse();
+    run
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffOptions, ListAlignment, Node, RenderConfig};
+
+    fn hashes(text: &str) -> Vec<HashCode> {
+        text.bytes().map(|byte| [byte; 8]).collect()
+    }
+
+    #[test]
+    fn longest_increasing_follows_patience_piles() {
+        let pairs = [(0, 3), (1, 0), (2, 4), (3, 1), (4, 2), (5, 5)];
+        assert_eq!(longest_increasing(&pairs), [(1, 0), (3, 1), (4, 2), (5, 5)]);
+    }
+
+    #[test]
+    fn unique_elements_anchor_the_alignment() {
+        // `x` repeats, so `a`, `b`, and `c` decide what lines up.
+        let pairs = align(&hashes("axbxcx"), &hashes("xaxbxc"), u64::MAX, None);
+        assert_eq!(pairs, [(0, 1), (1, 2), (2, 3), (3, 4), (4, 5)]);
+    }
+
+    #[test]
+    fn ranges_without_unique_elements_use_the_common_subsequence() {
+        assert_eq!(
+            align(&hashes("xyxy"), &hashes("yxyx"), u64::MAX, None),
+            [(0, 1), (1, 2), (2, 3)]
+        );
+        assert!(align(&hashes("ab"), &hashes("cd"), u64::MAX, None).is_empty());
+    }
+
+    #[test]
+    fn keys_share_only_matched_pairs() {
+        let (lhs, rhs, common) = keys(&[(0, 1)], 2, 2);
+        assert_eq!(lhs, [[0, 0, 0, 0, 0, 0, 0, 1], [0; 8]]);
+        assert_eq!(rhs, [[0; 8], [0, 0, 0, 0, 0, 0, 0, 1]]);
+        assert_eq!(common, [[0, 0, 0, 0, 0, 0, 0, 1]]);
+    }
+
+    #[test]
+    fn patience_diffs_keep_changes_around_repeated_entries_together() {
+        let options = DiffOptions::default().with_list_alignment(ListAlignment::Patience);
+        let lhs = Node::from_json_str(r#"["a",{},{}]"#).unwrap();
+        let rhs = Node::from_json_str(r#"[{},"b",{},{}]"#).unwrap();
+        assert_eq!(lhs.diff(&rhs, &DiffOptions::default()).len(), 3);
+        assert_eq!(
+            lhs.diff(&rhs, &options).render(&RenderConfig::default()),
+            "@ [0]\n[\n- \"a\"\n+ {}\n+ \"b\"\n  {}\n"
+        );
+
+        let lhs = Node::from_json_str(r#"["a","x",{"id":1},"x",{"id":2},"x"]"#).unwrap();
+        let rhs = Node::from_json_str(r#"["x","a","x",{"id":2},"x",{"id":1}]"#).unwrap();
+        let diff = lhs.diff(&rhs, &options);
+        assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+        assert_eq!(rhs.apply_patch(&diff.reverse().unwrap()).unwrap(), lhs);
+    }
+}
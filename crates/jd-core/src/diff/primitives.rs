@@ -1,4 +1,5 @@
 use super::{Diff, DiffElement, Path};
+use crate::prelude::*;
 use crate::Node;
 
 /// Produces a replacement diff element for non-container nodes.
@@ -0,0 +1,253 @@
+//! Readers that turn JSON Patch and JSON Merge Patch documents back into
+//! native diffs, mirroring Go's `ReadPatchString` and `ReadMergeString`.
+//!
+//! JSON Patch documents are expected in the shape [`Diff::render_patch`]
+//! produces: optional `test` ops for list context, `test`/`remove` pairs for
+//! each removed value, then `add` ops in reverse order. List context that the
+//! patch cannot express (the `[`/`]` boundaries) is restored as void.
+
+use serde::Deserialize;
+use serde_json::Value as JsonValue;
+
+use super::{Diff, DiffElement, DiffMetadata, Path, PathSegment};
+use crate::prelude::*;
+use crate::{Node, TranslateError};
+
+#[derive(Debug, Deserialize)]
+struct Operation {
+    op: String,
+    path: String,
+    #[serde(default)]
+    value: Option<JsonValue>,
+}
+
+impl Operation {
+    fn removes(&self, path: &str) -> bool {
+        self.op == "remove" && self.path == path
+    }
+}
+
+pub(super) fn read_json_patch(input: &str) -> Result<Diff, TranslateError> {
+    let operations: Vec<Operation> = serde_json::from_str(input)
+        .map_err(|err| TranslateError::new(format!("invalid JSON Patch: {err}")))?;
+    let mut elements = Vec::new();
+    let mut index = 0;
+
+    while index < operations.len() {
+        let mut context = Vec::new();
+        while let Some(operation) = operations.get(index) {
+            let strict_remove =
+                operations.get(index + 1).is_some_and(|next| next.removes(&operation.path));
+            if operation.op != "test" || strict_remove {
+                break;
+            }
+            context.push(operation);
+            index += 1;
+        }
+        let Some(first) = operations.get(index) else {
+            let dangling = context.last().map_or("", |operation| operation.path.as_str());
+            return Err(TranslateError::new(format!(
+                "test op at {dangling} is not followed by a remove or add op"
+            )));
+        };
+        let pointer = first.path.as_str();
+        let mut element = DiffElement::new().with_path(pointer_to_path(pointer)?);
+
+        while let Some(operation) = operations.get(index).filter(|op| op.path == pointer) {
+            match operation.op.as_str() {
+                "test" if operations.get(index + 1).is_some_and(|next| next.removes(pointer)) => {
+                    element.remove.push(operation_value(operation)?);
+                    index += 2;
+                }
+                "remove" => {
+                    element.remove.push(operation_value(operation)?);
+                    index += 1;
+                }
+                _ => break,
+            }
+        }
+        while let Some(operation) =
+            operations.get(index).filter(|op| op.op == "add" && op.path == pointer)
+        {
+            element.add.push(operation_value(operation)?);
+            index += 1;
+        }
+        element.add.reverse();
+
+        if element.remove.is_empty() && element.add.is_empty() {
+            return Err(TranslateError::new(format!(
+                "cannot translate {} op at {pointer} into a jd diff",
+                first.op
+            )));
+        }
+        attach_list_context(&mut element, &context)?;
+        elements.push(element);
+    }
+
+    Ok(Diff::from_elements(elements))
+}
+
+/// Turns context `test` ops into before/after lines for list hunks.
+fn attach_list_context(
+    element: &mut DiffElement,
+    context: &[&Operation],
+) -> Result<(), TranslateError> {
+    let Some(PathSegment::Index(position)) = element.path.segments().last().cloned() else {
+        return match context.first() {
+            Some(operation) => Err(TranslateError::new(format!(
+                "test op at {} is only supported as list context",
+                operation.path
+            ))),
+            None => Ok(()),
+        };
+    };
+    let sibling = |offset: i64| {
+        let mut path = element.path.drop_last();
+        path.push(PathSegment::Index(position + offset));
+        path
+    };
+    let before_path = sibling(-1);
+    let after_path = sibling(i64::try_from(element.remove.len()).unwrap_or(i64::MAX));
+
+    let mut before = Node::Void;
+    let mut after = Node::Void;
+    for operation in context {
+        let path = pointer_to_path(&operation.path)?;
+        if path == before_path {
+            before = operation_value(operation)?;
+        } else if path == after_path {
+            after = operation_value(operation)?;
+        } else {
+            return Err(TranslateError::new(format!(
+                "test op at {} does not border the list change at {}",
+                operation.path, element.path
+            )));
+        }
+    }
+    element.before = vec![before];
+    element.after = vec![after];
+    Ok(())
+}
+
+fn operation_value(operation: &Operation) -> Result<Node, TranslateError> {
+    let value = operation.value.clone().ok_or_else(|| {
+        TranslateError::new(format!("{} op at {} has no value", operation.op, operation.path))
+    })?;
+    Node::from_json_value(value)
+        .map_err(|err| TranslateError::new(format!("invalid JSON Patch: {err}")))
+}
+
+/// Converts a JSON Pointer into a jd path, reading index tokens and `-` as
+/// list indices the same way [`Diff::render_patch`] writes them.
+fn pointer_to_path(pointer: &str) -> Result<Path, TranslateError> {
+    Path::from_json_pointer(pointer).map_err(|err| TranslateError::new(err.to_string()))
+}
+
+pub(super) fn read_merge_patch(input: &str) -> Result<Diff, TranslateError> {
+    let patch = Node::from_json_str(input)
+        .map_err(|err| TranslateError::new(format!("invalid JSON Merge Patch: {err}")))?;
+    if matches!(patch, Node::Void) {
+        return Err(TranslateError::new("invalid JSON Merge Patch: empty document"));
+    }
+    let mut elements = Vec::new();
+    match patch {
+        Node::Object(members) => {
+            for (key, value) in members {
+                collect_merge(
+                    Path::new().with_segment(PathSegment::Key(key)),
+                    value,
+                    &mut elements,
+                );
+            }
+        }
+        value => collect_merge(Path::new(), value, &mut elements),
+    }
+    Ok(Diff::from_elements(elements))
+}
+
+/// Emits one merge hunk per leaf; `null` becomes a void addition (deletion).
+fn collect_merge(path: Path, value: Node, elements: &mut Vec<DiffElement>) {
+    match value {
+        Node::Object(members) if !members.is_empty() => {
+            for (key, child) in members {
+                collect_merge(path.clone().with_segment(PathSegment::Key(key)), child, elements);
+            }
+        }
+        value => {
+            let add = if matches!(value, Node::Null) { Node::Void } else { value };
+            elements.push(
+                DiffElement::new()
+                    .with_metadata(DiffMetadata::merge())
+                    .with_path(path)
+                    .with_add(vec![add]),
+            );
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffOptions, RenderConfig};
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    #[test]
+    fn json_patch_round_trips_rendered_diffs() {
+        let lhs = node(r#"{"a":[1,2,3],"b":{"c":"x"},"d":true}"#);
+        let rhs = node(r#"{"a":[1,4,3,5],"b":{"c":"y"}}"#);
+        let diff = lhs.diff(&rhs, &DiffOptions::default());
+        let patch = diff.render_patch().unwrap();
+        let read = read_json_patch(&patch).unwrap();
+        assert_eq!(read.render_patch().unwrap(), patch);
+        assert_eq!(lhs.apply_patch(&read).unwrap(), rhs);
+    }
+
+    #[test]
+    fn json_patch_context_becomes_list_boundaries() {
+        let patch = r#"[{"op":"test","path":"/a/1","value":"x"},{"op":"add","path":"/a/2","value":"y"},
+            {"op":"test","path":"/b","value":1},{"op":"remove","path":"/b","value":1}]"#;
+        let rendered = read_json_patch(patch).unwrap().render(&RenderConfig::default());
+        assert_eq!(rendered, "@ [\"a\",2]\n  \"x\"\n+ \"y\"\n]\n@ [\"b\"]\n- 1\n");
+    }
+
+    #[test]
+    fn json_patch_rejects_ops_without_jd_equivalents() {
+        let err = read_json_patch(r#"[{"op":"replace","path":"/a","value":1}]"#).unwrap_err();
+        assert_eq!(err.to_string(), "cannot translate replace op at /a into a jd diff");
+        let err = read_json_patch(r#"[{"op":"test","path":"/a","value":1}]"#).unwrap_err();
+        assert_eq!(err.to_string(), "test op at /a is not followed by a remove or add op");
+        let err = read_json_patch(
+            r#"[{"op":"test","path":"/a","value":1},{"op":"add","path":"/b","value":2}]"#,
+        )
+        .unwrap_err();
+        assert_eq!(err.to_string(), "test op at /a is only supported as list context");
+        let err = read_json_patch(r#"[{"op":"remove","path":"/a"}]"#).unwrap_err();
+        assert_eq!(err.to_string(), "remove op at /a has no value");
+    }
+
+    #[test]
+    fn merge_patch_becomes_merge_hunks() {
+        let diff = read_merge_patch(r#"{"a":{"b":null,"c":[1]},"d":{}}"#).unwrap();
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "^ {\"Merge\":true}\n@ [\"a\",\"b\"]\n+\n^ {\"Merge\":true}\n@ [\"a\",\"c\"]\n+ [1]\n\
+             ^ {\"Merge\":true}\n@ [\"d\"]\n+ {}\n"
+        );
+        assert!(read_merge_patch("{}").unwrap().is_empty());
+        assert_eq!(
+            read_merge_patch(r#"{"a":{"b":null,"c":[1]}}"#).unwrap().render_merge().unwrap(),
+            r#"{"a":{"b":null,"c":[1]}}"#
+        );
+    }
+
+    #[test]
+    fn merge_patch_replaces_non_object_roots() {
+        let diff = read_merge_patch("[1,2]").unwrap();
+        let elements = diff.into_elements();
+        assert!(elements[0].path.is_empty());
+        assert_eq!(elements[0].add, vec![node("[1,2]")]);
+    }
+}
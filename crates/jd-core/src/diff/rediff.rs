@@ -0,0 +1,221 @@
+//! Updating a diff after a local edit to one of its documents.
+//!
+//! An object diff is the concatenation of the diffs of its keys, so after an
+//! edit below a chain of object keys only the hunks of the last key on the
+//! chain can change. [`Diff::rediff`] follows the edited path down through
+//! keys both documents hold as objects, diffs the value where the chain ends,
+//! and puts its hunks where a full diff would list them. Lists are aligned as
+//! a whole, so an edit inside a list re-diffs the whole list.
+
+use alloc::borrow::Cow;
+use alloc::collections::BTreeMap;
+use core::cmp::Ordering;
+
+use super::{
+    budget, diff_impl, diff_nodes, with_float_forms, Diff, DiffElement, Path, PathSegment,
+};
+use crate::prelude::*;
+use crate::{DiffOptions, Node, NumberEquality};
+
+impl Diff {
+    /// Updates a diff between two documents after the value at `edited`
+    /// changed in one or both of them. `lhs` and `rhs` are the documents as
+    /// they are now, and `self` the diff between them before the edit, built
+    /// with the same `options`.
+    ///
+    /// The result is the diff [`Node::diff`] would return, but only the
+    /// value at `edited`, or the list holding it, is compared again, so an
+    /// editor can re-diff on every keystroke. A truncated diff, or options
+    /// with comparators or size limits, fall back to a full diff.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, Path, PathSegment, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"{"a":{"x":1},"b":[1,2],"c":1}"#).unwrap();
+    /// let mut rhs = Node::from_json_str(r#"{"a":{"x":1},"b":[1,3],"c":1}"#).unwrap();
+    /// let options = DiffOptions::default();
+    /// let diff = lhs.diff(&rhs, &options);
+    ///
+    /// let edited = Path::from(vec![PathSegment::key("a"), PathSegment::key("x")]);
+    /// rhs.set(&edited, Node::from_json_str("2").unwrap()).unwrap();
+    /// let diff = diff.rediff(&lhs, &rhs, &edited, &options);
+    /// assert_eq!(diff.into_elements(), lhs.diff(&rhs, &options).into_elements());
+    /// ```
+    #[must_use]
+    pub fn rediff(&self, lhs: &Node, rhs: &Node, edited: &Path, options: &DiffOptions) -> Diff {
+        if self.truncated
+            || options.has_comparators()
+            || options.max_elements().is_some()
+            || options.max_bytes().is_some()
+        {
+            // Comparators may decide for a whole ancestor of the edit, and
+            // a cut diff lacks the hunks to keep.
+            return diff_nodes(lhs, rhs, options);
+        }
+        let run = &*options.for_diff();
+        let (at, fresh, parents) = rediff_at(lhs, rhs, edited, run);
+        if self.iter().any(|element| element.path != at && at.starts_with(&element.path)) {
+            // A hunk above the edit means the documents changed there too.
+            return diff_nodes(lhs, rhs, options);
+        }
+        if let Some(tracker) = run.tracker() {
+            tracker.finish();
+        }
+        let mut fresh = fresh.into_elements();
+        if run.number_equality() == NumberEquality::Typed {
+            fresh = fresh.into_iter().map(with_float_forms).collect();
+        }
+
+        let mut elements = Vec::with_capacity(self.len() + fresh.len());
+        let mut kept = self.iter().filter(|element| !element.path.starts_with(&at)).peekable();
+        while let Some(element) = kept.next_if(|element| precedes(element, &at, &parents)) {
+            elements.push(element.clone());
+        }
+        elements.extend(fresh);
+        elements.extend(kept.cloned());
+        budget::truncate(Diff::from_elements(elements), run)
+    }
+}
+
+/// The objects both documents hold along the edited path, outermost first.
+type Parents<'a> = Vec<(&'a BTreeMap<String, Node>, &'a BTreeMap<String, Node>)>;
+
+/// Follows `edited` through object keys both documents hold, returning the
+/// path where the chain ends, the hunks a full diff would list there, and
+/// the objects passed on the way.
+fn rediff_at<'a>(
+    lhs: &'a Node,
+    rhs: &'a Node,
+    edited: &Path,
+    options: &DiffOptions,
+) -> (Path, Diff, Parents<'a>) {
+    let mut at = Path::new();
+    let mut parents = Vec::new();
+    let (mut lhs, mut rhs) = (lhs, rhs);
+    let mut options = Cow::Borrowed(options);
+    for segment in edited {
+        let (Node::Object(lhs_map), Node::Object(rhs_map), PathSegment::Key(key)) =
+            (lhs, rhs, segment)
+        else {
+            break;
+        };
+        parents.push((lhs_map, rhs_map));
+        let child = options.refine(segment).into_owned();
+        at.push(segment.clone());
+        if child.is_ignored() {
+            return (at, Diff::empty(), parents);
+        }
+        match (lhs_map.get(key), rhs_map.get(key)) {
+            (Some(lhs_value), Some(rhs_value)) => {
+                (lhs, rhs) = (lhs_value, rhs_value);
+                options = Cow::Owned(child);
+            }
+            (lhs_value, rhs_value) => {
+                let element = DiffElement::new()
+                    .with_path(at.clone())
+                    .with_remove(lhs_value.into_iter().cloned().collect())
+                    .with_add(rhs_value.into_iter().cloned().collect());
+                let diff = if element.remove.is_empty() && element.add.is_empty() {
+                    Diff::empty()
+                } else {
+                    Diff::from_elements(vec![element])
+                };
+                return (at, diff, parents);
+            }
+        }
+    }
+    let diff = diff_impl(lhs, rhs, &at, &options);
+    (at, diff, parents)
+}
+
+/// Reports whether a full diff lists `element` before the hunks at `at`.
+/// Objects list the keys of their left side in order, then the keys only
+/// their right side holds.
+fn precedes(element: &DiffElement, at: &Path, parents: &Parents<'_>) -> bool {
+    let parted =
+        element.path.segments().iter().zip(at.segments()).position(|(lhs, rhs)| lhs != rhs);
+    let Some(depth) = parted else {
+        return true;
+    };
+    let (PathSegment::Key(key), PathSegment::Key(at_key)) =
+        (&element.path.segments()[depth], &at.segments()[depth])
+    else {
+        return true;
+    };
+    let (lhs, _) = parents[depth];
+    let rank = |key: &String| (!lhs.contains_key(key), key.clone());
+    rank(key).cmp(&rank(at_key)) == Ordering::Less
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{ArrayMode, DiffOption};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn path(segments: &[&str]) -> Path {
+        Path::from(segments.iter().map(|key| PathSegment::key(*key)).collect::<Vec<_>>())
+    }
+
+    #[track_caller]
+    fn check(lhs: &Node, rhs: &Node, edits: &[(bool, Path, Node)], options: &DiffOptions) {
+        let (mut lhs, mut rhs) = (lhs.clone(), rhs.clone());
+        let mut diff = lhs.diff(&rhs, options);
+        for (left, at, value) in edits {
+            let side = if *left { &mut lhs } else { &mut rhs };
+            side.set(at, value.clone()).unwrap();
+            diff = diff.rediff(&lhs, &rhs, at, options);
+            assert_eq!(diff.clone().into_elements(), lhs.diff(&rhs, options).into_elements());
+        }
+    }
+
+    #[test]
+    fn edits_below_objects_keep_the_full_diff_order() {
+        let lhs = json(r#"{"a":{"x":1,"y":2},"b":[1,2,3],"d":{"k":1},"z":0}"#);
+        let rhs = json(r#"{"a":{"x":1,"y":3},"b":[1,4,3],"c":1,"d":{"k":1}}"#);
+        let edits = [
+            (false, path(&["a", "x"]), json("5")),
+            (false, path(&["d", "k"]), json("2")),
+            (false, path(&["d", "k"]), json("1")),
+            (false, path(&["a", "new"]), json("[1]")),
+            (true, path(&["c"]), json("1")),
+            (true, path(&["c"]), Node::Void),
+            (false, path(&["z"]), json("0")),
+            (false, path(&["e", "f"]), json("true")),
+            (true, path(&["b"]), json(r#"{"x":1}"#)),
+            (false, Path::new(), json("[]")),
+        ];
+        check(&lhs, &rhs, &edits, &DiffOptions::default());
+    }
+
+    #[test]
+    fn edits_in_lists_rediff_the_list() {
+        let lhs = json(r#"{"l":[{"a":1},{"a":2},{"a":3}],"m":1}"#);
+        let rhs = json(r#"{"l":[{"a":1},{"a":3}],"m":2}"#);
+        let at =
+            Path::from(vec![PathSegment::key("l"), PathSegment::index(0), PathSegment::key("a")]);
+        check(
+            &lhs,
+            &rhs,
+            &[(false, at.clone(), json("9")), (true, at, json("9"))],
+            &DiffOptions::default(),
+        );
+        let sets = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+        check(&lhs, &rhs, &[(false, path(&["l"]), json("[1]"))], &sets);
+    }
+
+    #[test]
+    fn ignored_keys_stay_ignored() {
+        let lhs = json(r#"{"a":{"_t":1,"v":1},"b":1}"#);
+        let rhs = json(r#"{"a":{"_t":2,"v":1},"b":1}"#);
+        let options = DiffOptions::default()
+            .with_excluded_keys(["^_"])
+            .unwrap()
+            .with_option(DiffOption::Ignore(vec![path(&["b"])]))
+            .unwrap();
+        let edits = [(false, path(&["a", "_t"]), json("3")), (false, path(&["b"]), json("2"))];
+        check(&lhs, &rhs, &edits, &options);
+    }
+}
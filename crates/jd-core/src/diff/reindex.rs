@@ -0,0 +1,142 @@
+//! Conversion of list indices between patch order and base positions.
+//!
+//! Hunks address list elements by their index in the partially patched list,
+//! so each index depends on every earlier hunk in the same list. Code that
+//! drops or combines hunks converts their paths to positions in the original
+//! document first, and back to patch order once the final set of hunks is
+//! known.
+
+use hashbrown::HashMap;
+
+use super::{Diff, DiffElement, Path, PathSegment};
+use crate::prelude::*;
+
+/// Returns the hunks of `diff` with list indices rewritten to positions in the
+/// document the diff was computed from. Moves must already be split with
+/// [`Diff::without_moves`]; the halves may then arrive out of index order.
+pub(crate) fn to_base(diff: &Diff) -> Vec<DiffElement> {
+    let mut lists: HashMap<Vec<PathSegment>, Slots> = HashMap::new();
+    diff.iter()
+        .map(|element| {
+            let mut segments = element.path.segments().to_vec();
+            for depth in 0..segments.len() {
+                if let PathSegment::Index(index @ 0..) = segments[depth] {
+                    let slots = lists.entry(segments[..depth].to_vec()).or_default();
+                    segments[depth] = PathSegment::Index(slots.base(index as usize));
+                }
+            }
+            if let Some((PathSegment::Index(index @ 0..), _)) = element.path.segments().split_last()
+            {
+                let list = segments[..segments.len() - 1].to_vec();
+                let slots = lists.entry(list).or_default();
+                slots.splice(*index as usize, element.remove.len(), element.add.len());
+            }
+            DiffElement { path: Path::from(segments), ..element.clone() }
+        })
+        .collect()
+}
+
+/// The elements of one list as hunks are applied in patch order. Each slot
+/// holds the base index of an original element, or `None` for an inserted
+/// one. Diffs do not record list lengths, so slots are created on demand.
+#[derive(Default)]
+struct Slots {
+    slots: Vec<Option<i64>>,
+    created: i64,
+}
+
+impl Slots {
+    /// Returns the base index of the element at `position`, or of the next
+    /// original element when `position` holds an inserted one.
+    fn base(&mut self, position: usize) -> i64 {
+        (position..)
+            .find_map(|at| {
+                self.fill(at + 1);
+                self.slots[at]
+            })
+            .expect("slots are created on demand")
+    }
+
+    fn splice(&mut self, position: usize, removed: usize, added: usize) {
+        self.fill(position + removed);
+        self.slots.splice(position..position + removed, core::iter::repeat_n(None, added));
+    }
+
+    fn fill(&mut self, len: usize) {
+        while self.slots.len() < len {
+            self.slots.push(Some(self.created));
+            self.created += 1;
+        }
+    }
+}
+
+/// Builds a diff from hunks addressed by base positions, mapping each index
+/// back to patch order given the hunks before it.
+pub(crate) fn from_base(mut elements: Vec<DiffElement>) -> Diff {
+    let paths: Vec<Path> = {
+        // Earlier list hunks as (list path, end of the base range, length change).
+        let mut edits: Vec<(&[PathSegment], i64, i64)> = Vec::new();
+        elements
+            .iter()
+            .map(|element| {
+                let base_path = element.path.segments();
+                let mut segments = base_path.to_vec();
+                for (depth, segment) in base_path.iter().enumerate() {
+                    if let PathSegment::Index(index) = segment {
+                        let list = &base_path[..depth];
+                        let shift: i64 = edits
+                            .iter()
+                            .filter(|(path, end, _)| *path == list && end <= index)
+                            .map(|(_, _, delta)| delta)
+                            .sum();
+                        segments[depth] = PathSegment::Index(index + shift);
+                    }
+                }
+                if let Some((PathSegment::Index(index), list)) = base_path.split_last() {
+                    edits.push((list, index + element.remove.len() as i64, length_change(element)));
+                }
+                Path::from(segments)
+            })
+            .collect()
+    };
+    for (element, path) in elements.iter_mut().zip(paths) {
+        element.path = path;
+    }
+    Diff::from_elements(elements)
+}
+
+fn length_change(element: &DiffElement) -> i64 {
+    element.add.len() as i64 - element.remove.len() as i64
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffOptions, Node};
+
+    fn indices(elements: &[DiffElement]) -> Vec<String> {
+        elements.iter().map(|element| element.path.to_string()).collect()
+    }
+
+    #[test]
+    fn round_trips_list_indices() {
+        let lhs = Node::from_json_str("[1,2,3,4,5]").unwrap();
+        let rhs = Node::from_json_str("[0,0,1,2,3,4,9]").unwrap();
+        let diff = lhs.diff(&rhs, &DiffOptions::default());
+        assert_eq!(indices(&diff.clone().into_elements()), ["[0]", "[6]"]);
+
+        let base = to_base(&diff);
+        assert_eq!(indices(&base), ["[0]", "[4]"]);
+        assert_eq!(from_base(base), diff);
+    }
+
+    #[test]
+    fn from_base_skips_dropped_hunks() {
+        let lhs = Node::from_json_str("[1,2,3,4,5]").unwrap();
+        let rhs = Node::from_json_str("[0,0,1,2,3,4,9]").unwrap();
+        let mut base = to_base(&lhs.diff(&rhs, &DiffOptions::default()));
+        base.remove(0);
+        let diff = from_base(base);
+        assert_eq!(indices(&diff.into_elements()), ["[4]"]);
+    }
+}
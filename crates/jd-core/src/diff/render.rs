@@ -0,0 +1,380 @@
+use core::fmt::Write as _;
+
+use super::theme::COLOR_RESET;
+use super::{ColorTheme, DiffElement, RenderConfig};
+use crate::prelude::*;
+use crate::Node;
+
+/// How a hunk that replaces one string with another is broken down when it
+/// is rendered as a native diff.
+///
+/// ```
+/// # use jd_core::{DiffOptions, Node, RenderConfig, StringGranularity};
+/// let lhs = Node::from_json_str(r#"{"script":"set -e\nmake\nmake test\n"}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"script":"set -e\nmake all\nmake test\n"}"#).unwrap();
+/// let config = RenderConfig::new().with_string_granularity(StringGranularity::Line);
+/// assert_eq!(
+///     lhs.diff(&rhs, &DiffOptions::default()).render(&config),
+///     "@ [\"script\"]\n@@ -2 +2 @@\n- \"make\\n\"\n+ \"make all\\n\"\n"
+/// );
+/// ```
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+pub enum StringGranularity {
+    /// The whole strings, with each changed character highlighted when
+    /// color is enabled, as in Go `jd` (default).
+    #[default]
+    Char,
+    /// Like [`StringGranularity::Line`], and with color enabled each
+    /// changed word is highlighted within the lines replaced.
+    Word,
+    /// Multi-line strings show only the lines that changed, each run under
+    /// a `@@ -LINES +LINES @@` header as in a unified diff. Such a hunk
+    /// no longer holds the whole strings, so the output is for reading
+    /// and cannot be applied as a patch.
+    Line,
+}
+
+/// Token-level highlighting for a hunk that replaces one string.
+///
+/// Mirrors Go's colorized rendering: the longest common subsequence of the
+/// two strings is printed plainly and every other token is wrapped in its
+/// own color escape, so with characters as tokens `kitten` → `sitting`
+/// highlights `k`/`e` in red and `s`/`i`/`g` in green.
+pub(super) struct StringDiff<'a> {
+    old: Vec<&'a str>,
+    new: Vec<&'a str>,
+    common: Vec<&'a str>,
+    theme: ColorTheme,
+}
+
+impl<'a> StringDiff<'a> {
+    /// Returns the character diff when `element` swaps exactly one string
+    /// for another.
+    pub(super) fn from_element(element: &'a DiffElement, theme: ColorTheme) -> Option<Self> {
+        let (old, new) = string_pair(element)?;
+        Some(Self::new(chars(old), chars(new), theme))
+    }
+
+    /// Returns the word diff when `element` swaps exactly one string for
+    /// another.
+    pub(super) fn words_from_element(element: &'a DiffElement, theme: ColorTheme) -> Option<Self> {
+        let (old, new) = string_pair(element)?;
+        Some(Self::new(words(old), words(new), theme))
+    }
+
+    fn new(old: Vec<&'a str>, new: Vec<&'a str>, theme: ColorTheme) -> Self {
+        let common = lcs(&old, &new);
+        Self { old, new, common, theme }
+    }
+
+    /// Renders the `- "..."` line with removed tokens in the theme's
+    /// removal color.
+    pub(super) fn render_remove(&self) -> String {
+        format!("- \"{}\"\n", highlight(&self.old, &self.common, self.theme.removed()))
+    }
+
+    /// Renders the `+ "..."` line with added tokens in the theme's
+    /// addition color.
+    pub(super) fn render_add(&self) -> String {
+        format!("+ \"{}\"\n", highlight(&self.new, &self.common, self.theme.added()))
+    }
+}
+
+/// Renders the removed and added lines of a hunk that swaps one multi-line
+/// string for another, in runs under `@@` headers, or returns `None` when
+/// neither string spans more than one line.
+pub(super) fn render_lines(
+    element: &DiffElement,
+    granularity: StringGranularity,
+    config: &RenderConfig,
+) -> Option<String> {
+    let (old, new) = string_pair(element)?;
+    if !old.trim_end_matches('\n').contains('\n') && !new.trim_end_matches('\n').contains('\n') {
+        return None;
+    }
+    let (old, new) = (lines(old), lines(new));
+    let common = lcs(&old, &new);
+    let mut output = String::new();
+    let (mut i, mut j) = (0, 0);
+    for anchor in common.iter().map(Some).chain([None]) {
+        let (old_start, new_start) = (i, j);
+        while i < old.len() && Some(&old[i]) != anchor {
+            i += 1;
+        }
+        while j < new.len() && Some(&new[j]) != anchor {
+            j += 1;
+        }
+        if i > old_start || j > new_start {
+            let _ = writeln!(
+                output,
+                "@@ -{} +{} @@",
+                line_range(old_start, i - old_start),
+                line_range(new_start, j - new_start)
+            );
+            push_run(&mut output, &old[old_start..i], &new[new_start..j], granularity, config);
+        }
+        i += 1;
+        j += 1;
+    }
+    Some(output)
+}
+
+/// Writes one run of replaced lines, pairing removed and added lines in
+/// order for word highlighting.
+fn push_run(
+    output: &mut String,
+    removed: &[&str],
+    added: &[&str],
+    granularity: StringGranularity,
+    config: &RenderConfig,
+) {
+    let theme = config.theme();
+    let highlight = granularity == StringGranularity::Word && config.color_enabled();
+    let paired = if highlight { removed.len().min(added.len()) } else { 0 };
+    let pairs: Vec<StringDiff<'_>> = (0..paired)
+        .map(|index| StringDiff::new(words(removed[index]), words(added[index]), theme))
+        .collect();
+    for diff in &pairs {
+        output.push_str(&diff.render_remove());
+    }
+    for line in &removed[paired..] {
+        push_line(output, '-', line, config.color_enabled().then(|| theme.removed()));
+    }
+    for diff in &pairs {
+        output.push_str(&diff.render_add());
+    }
+    for line in &added[paired..] {
+        push_line(output, '+', line, config.color_enabled().then(|| theme.added()));
+    }
+}
+
+fn push_line(output: &mut String, header: char, line: &str, color: Option<&str>) {
+    output.push_str(color.unwrap_or_default());
+    output.push(header);
+    output.push(' ');
+    output.push_str(&serde_json::to_string(line).expect("serializing a string"));
+    output.push('\n');
+    if color.is_some() {
+        output.push_str(COLOR_RESET);
+    }
+}
+
+/// Formats the lines `start..start + count`, counting from zero, as a
+/// unified diff range: `N` for one line, `N,COUNT` otherwise, where an
+/// empty range names the line before it.
+fn line_range(start: usize, count: usize) -> String {
+    match count {
+        0 => format!("{start},0"),
+        1 => format!("{}", start + 1),
+        _ => format!("{},{count}", start + 1),
+    }
+}
+
+fn string_pair(element: &DiffElement) -> Option<(&str, &str)> {
+    let ([Node::String(old)], [Node::String(new)]) =
+        (element.remove.as_slice(), element.add.as_slice())
+    else {
+        return None;
+    };
+    Some((old, new))
+}
+
+fn chars(text: &str) -> Vec<&str> {
+    text.char_indices().map(|(at, ch)| &text[at..at + ch.len_utf8()]).collect()
+}
+
+/// Splits `text` into words, runs of whitespace, and single other
+/// characters.
+fn words(text: &str) -> Vec<&str> {
+    let class = |ch: char| {
+        if ch.is_alphanumeric() || ch == '_' {
+            0
+        } else if ch.is_whitespace() {
+            1
+        } else {
+            2
+        }
+    };
+    let mut tokens = Vec::new();
+    let mut start = 0;
+    let mut previous = None;
+    for (at, ch) in text.char_indices() {
+        let current = class(ch);
+        if at > start && (current == 2 || previous != Some(current)) {
+            tokens.push(&text[start..at]);
+            start = at;
+        }
+        previous = Some(current);
+    }
+    if start < text.len() {
+        tokens.push(&text[start..]);
+    }
+    tokens
+}
+
+/// Splits `text` into lines, each keeping its `\n`.
+fn lines(text: &str) -> Vec<&str> {
+    text.split_inclusive('\n').collect()
+}
+
+fn highlight(tokens: &[&str], common: &[&str], color: &str) -> String {
+    let mut result = String::new();
+    let mut common_iter = common.iter();
+    let mut current = common_iter.next();
+    for token in tokens {
+        if current == Some(token) {
+            push_escaped(&mut result, token);
+            current = common_iter.next();
+            continue;
+        }
+        result.push_str(color);
+        push_escaped(&mut result, token);
+        result.push_str(COLOR_RESET);
+    }
+    result
+}
+
+/// Appends `text` as it would appear inside a JSON string literal.
+fn push_escaped(output: &mut String, text: &str) {
+    let encoded = serde_json::to_string(text).expect("serializing a string");
+    output.push_str(&encoded[1..encoded.len() - 1]);
+}
+
+fn lcs<'a>(left: &[&'a str], right: &[&'a str]) -> Vec<&'a str> {
+    let n = left.len();
+    let m = right.len();
+    let mut table = vec![vec![0usize; m + 1]; n + 1];
+    for (i, lhs_token) in left.iter().enumerate() {
+        for (j, rhs_token) in right.iter().enumerate() {
+            if lhs_token == rhs_token {
+                table[i + 1][j + 1] = table[i][j] + 1;
+            } else {
+                table[i + 1][j + 1] = table[i][j + 1].max(table[i + 1][j]);
+            }
+        }
+    }
+
+    let mut result = Vec::with_capacity(table[n][m]);
+    let mut i = n;
+    let mut j = m;
+    while i > 0 && j > 0 {
+        if left[i - 1] == right[j - 1] {
+            result.push(left[i - 1]);
+            i -= 1;
+            j -= 1;
+        } else if table[i - 1][j] >= table[i][j - 1] {
+            i -= 1;
+        } else {
+            j -= 1;
+        }
+    }
+    result.reverse();
+    result
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn string_diff(old: &str, new: &str) -> DiffElement {
+        DiffElement::new()
+            .with_remove(vec![Node::String(old.to_string())])
+            .with_add(vec![Node::String(new.to_string())])
+    }
+
+    #[test]
+    fn lcs_keeps_shared_characters_in_order() {
+        assert_eq!(lcs(&chars("kitten"), &chars("sitting")).concat(), "ittn");
+        assert!(lcs(&chars(""), &chars("abc")).is_empty());
+    }
+
+    #[test]
+    fn highlights_each_changed_character() {
+        let element = string_diff("kitten", "sitting");
+        let diff = StringDiff::from_element(&element, ColorTheme::Default).unwrap();
+        assert_eq!(diff.render_remove(), "- \"\u{1b}[31mk\u{1b}[0mitt\u{1b}[31me\u{1b}[0mn\"\n");
+        assert_eq!(
+            diff.render_add(),
+            "+ \"\u{1b}[32ms\u{1b}[0mitt\u{1b}[32mi\u{1b}[0mn\u{1b}[32mg\u{1b}[0m\"\n"
+        );
+    }
+
+    #[test]
+    fn escapes_characters_like_json_strings() {
+        let element = string_diff("a\"b", "a\nb");
+        let diff = StringDiff::from_element(&element, ColorTheme::Default).unwrap();
+        assert_eq!(diff.render_remove(), "- \"a\u{1b}[31m\\\"\u{1b}[0mb\"\n");
+        assert_eq!(diff.render_add(), "+ \"a\u{1b}[32m\\n\u{1b}[0mb\"\n");
+    }
+
+    #[test]
+    fn compares_multibyte_characters_whole() {
+        let element = string_diff("café", "cafe");
+        let diff = StringDiff::from_element(&element, ColorTheme::Default).unwrap();
+        assert_eq!(diff.render_remove(), "- \"caf\u{1b}[31mé\u{1b}[0m\"\n");
+    }
+
+    #[test]
+    fn uses_the_theme_colors() {
+        let element = string_diff("ab", "ac");
+        let diff = StringDiff::from_element(&element, ColorTheme::HighContrast).unwrap();
+        assert_eq!(diff.render_remove(), "- \"a\u{1b}[1;91mb\u{1b}[0m\"\n");
+        assert_eq!(diff.render_add(), "+ \"a\u{1b}[1;92mc\u{1b}[0m\"\n");
+    }
+
+    #[test]
+    fn words_split_on_whitespace_and_punctuation() {
+        assert_eq!(
+            words("let x_1 = f(a, b);"),
+            ["let", " ", "x_1", " ", "=", " ", "f", "(", "a", ",", " ", "b", ")", ";"]
+        );
+        assert!(words("").is_empty());
+    }
+
+    #[test]
+    fn line_runs_show_only_changed_lines() {
+        let element = string_diff("a\nb\nc\nd\ne\n", "a\nB\nc\nd\ne\nf\n");
+        let output =
+            render_lines(&element, StringGranularity::Line, &RenderConfig::default()).unwrap();
+        assert_eq!(output, "@@ -2 +2 @@\n- \"b\\n\"\n+ \"B\\n\"\n@@ -5,0 +6 @@\n+ \"f\\n\"\n");
+
+        let element = string_diff("x\ny\nz", "z");
+        let output =
+            render_lines(&element, StringGranularity::Line, &RenderConfig::default()).unwrap();
+        assert_eq!(output, "@@ -1,2 +0,0 @@\n- \"x\\n\"\n- \"y\\n\"\n");
+
+        assert!(render_lines(
+            &string_diff("a\n", "b\n"),
+            StringGranularity::Line,
+            &RenderConfig::default()
+        )
+        .is_none());
+    }
+
+    #[test]
+    fn word_runs_highlight_changed_words_in_paired_lines() {
+        let element = string_diff("keep\nold value\n", "keep\nnew value\nextra\n");
+        let config = RenderConfig::color(true);
+        let output = render_lines(&element, StringGranularity::Word, &config).unwrap();
+        assert_eq!(
+            output,
+            "@@ -2 +2,2 @@\n\
+             - \"\u{1b}[31mold\u{1b}[0m value\\n\"\n\
+             + \"\u{1b}[32mnew\u{1b}[0m value\\n\"\n\
+             \u{1b}[32m+ \"extra\\n\"\n\u{1b}[0m"
+        );
+        let plain = render_lines(&element, StringGranularity::Word, &RenderConfig::default());
+        assert_eq!(
+            plain,
+            render_lines(&element, StringGranularity::Line, &RenderConfig::default())
+        );
+    }
+
+    #[test]
+    fn ignores_non_string_replacements() {
+        let element = DiffElement::new()
+            .with_remove(vec![Node::String("1".to_string())])
+            .with_add(vec![Node::from_json_str("1").unwrap()]);
+        assert!(StringDiff::from_element(&element, ColorTheme::Default).is_none());
+    }
+}
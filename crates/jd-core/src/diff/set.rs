@@ -0,0 +1,72 @@
+use alloc::collections::BTreeMap;
+
+use super::tolerance::{needs_classes, ToleranceClasses};
+use super::{diff_impl, Diff, DiffElement, Path, PathSegment};
+use crate::hash::HashCode;
+use crate::prelude::*;
+use crate::{DiffOptions, Node};
+
+/// Diffs two arrays as unordered sets of unique values.
+///
+/// Mirrors Go's `jsonSet.diff`: values are bucketed by identity and a single
+/// element under the `{}` path segment lists removals and additions in hash
+/// order. With set keys configured, objects sharing an identity are diffed
+/// recursively beneath a `{"key":value}` segment and those hunks precede the
+/// set element.
+pub(super) fn diff_sets(lhs: &[Node], rhs: &[Node], path: &Path, options: &DiffOptions) -> Diff {
+    let options = &*options.refine(&PathSegment::Set);
+    let mut classes = needs_classes(options).then(ToleranceClasses::new);
+    let lhs_map = index_by_identity(lhs, options, classes.as_mut());
+    let rhs_map = index_by_identity(rhs, options, classes.as_mut());
+
+    let mut elements = Vec::new();
+    let mut remove = Vec::new();
+    for (hash, node) in &lhs_map {
+        if options.is_spent() {
+            return Diff::from_elements(elements);
+        }
+        let Some(other) = rhs_map.get(hash) else {
+            remove.push((*node).clone());
+            continue;
+        };
+        if let Some(identity) = node.identity_keys(options) {
+            let sub_path = path.clone().with_segment(PathSegment::SetKeys(identity));
+            elements.extend(diff_impl(node, other, &sub_path, options));
+        }
+    }
+    let add: Vec<Node> = rhs_map
+        .iter()
+        .filter(|(hash, _)| !lhs_map.contains_key(*hash))
+        .map(|(_, node)| (*node).clone())
+        .collect();
+
+    if !remove.is_empty() || !add.is_empty() {
+        let element = DiffElement::new()
+            .with_path(path.clone().with_segment(PathSegment::Set))
+            .with_remove(remove)
+            .with_add(add);
+        options.spend([&element]);
+        elements.push(element);
+    }
+    Diff::from_elements(elements)
+}
+
+fn index_by_identity<'a>(
+    values: &'a [Node],
+    options: &DiffOptions,
+    mut classes: Option<&mut ToleranceClasses>,
+) -> BTreeMap<HashCode, &'a Node> {
+    // Later duplicates win, matching the Go map assignment semantics.
+    values
+        .iter()
+        .map(|node| {
+            let hash = match classes.as_deref_mut() {
+                Some(classes) if node.identity_keys(options).is_none() => {
+                    classes.hash(node, options)
+                }
+                _ => node.identity_hash(options),
+            };
+            (hash, node)
+        })
+        .collect()
+}
@@ -0,0 +1,141 @@
+//! Similarity matching of objects in list diffs.
+//!
+//! Between two elements of the common subsequence, the list diff walks the
+//! remaining elements of both sides in step and diffs each pair it meets.
+//! With a similarity threshold, two objects are only diffed field by field
+//! when enough of their fields agree. Otherwise the walk looks ahead in the
+//! same gap: an object similar to a later element on the other side stays
+//! for that element, and the one in front of it is removed or added.
+//! Looking ahead compares each object with the rest of the other gap, so it
+//! is skipped when the two gaps together exceed
+//! [`DiffOptions::max_alignment_cost`].
+
+use super::PathSegment;
+use crate::{DiffOptions, Node};
+
+/// What the list walk does with the elements at its cursors.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub(super) enum Step {
+    /// Diff the two objects field by field.
+    Pair,
+    /// Remove the lhs element; the rhs one matches a later lhs element.
+    Remove,
+    /// Add the rhs element; the lhs one matches a later rhs element.
+    Add,
+    /// Replace the lhs element with the rhs one.
+    Replace,
+}
+
+/// Decides how to handle `lhs[0]` and `rhs[0]`, the objects at the front of
+/// the two non-empty gaps `lhs` and `rhs` between common elements.
+pub(super) fn step(lhs: &[Node], rhs: &[Node], threshold: f64, options: &DiffOptions) -> Step {
+    let similar = |lhs: &Node, rhs: &Node| similarity(lhs, rhs, options) >= threshold;
+    let look_ahead =
+        (lhs.len() as u64).saturating_mul(rhs.len() as u64) <= options.max_alignment_cost();
+    if similar(&lhs[0], &rhs[0]) {
+        Step::Pair
+    } else if look_ahead && lhs[1..].iter().any(|later| similar(later, &rhs[0])) {
+        Step::Remove
+    } else if look_ahead && rhs[1..].iter().any(|later| similar(&lhs[0], later)) {
+        Step::Add
+    } else {
+        Step::Replace
+    }
+}
+
+/// Returns the share of fields, from 0 to 1, that two objects hold with
+/// equal values, out of all fields present in either. Other values are 0.
+fn similarity(lhs: &Node, rhs: &Node, options: &DiffOptions) -> f64 {
+    let (Node::Object(lhs), Node::Object(rhs)) = (lhs, rhs) else {
+        return 0.0;
+    };
+    let shared = lhs
+        .iter()
+        .filter(|(key, value)| {
+            rhs.get(*key).is_some_and(|other| {
+                value.eq_with_options(other, &options.refine(&PathSegment::key(key.as_str())))
+            })
+        })
+        .count();
+    let fields = lhs.len() + rhs.keys().filter(|key| !lhs.contains_key(*key)).count();
+    if fields == 0 {
+        1.0
+    } else {
+        shared as f64 / fields as f64
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::RenderConfig;
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    fn similar(threshold: f64) -> DiffOptions {
+        DiffOptions::default().with_similarity_threshold(threshold).unwrap()
+    }
+
+    #[test]
+    fn similarity_counts_equal_fields_over_all_fields() {
+        let options = DiffOptions::default();
+        let lhs = node(r#"{"a":1,"b":2,"c":3}"#);
+        assert_eq!(similarity(&lhs, &node(r#"{"a":1,"b":2,"c":4}"#), &options), 2.0 / 3.0);
+        assert_eq!(similarity(&lhs, &node(r#"{"a":1,"d":3}"#), &options), 1.0 / 4.0);
+        assert_eq!(similarity(&node("{}"), &node("{}"), &options), 1.0);
+        assert_eq!(similarity(&lhs, &node("[1]"), &options), 0.0);
+    }
+
+    #[test]
+    fn similar_objects_are_diffed_after_a_removal() {
+        let lhs = node(r#"[{"id":1,"v":"a"},{"id":2,"n":"x","v":"b"}]"#);
+        let rhs = node(r#"[{"id":2,"n":"x","v":"c"}]"#);
+        let diff = lhs.diff(&rhs, &similar(0.6));
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "@ [0]\n[\n- {\"id\":1,\"v\":\"a\"}\n  {\"id\":2,\"n\":\"x\",\"v\":\"b\"}\n\
+             @ [0,\"v\"]\n- \"b\"\n+ \"c\"\n"
+        );
+        assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+    }
+
+    #[test]
+    fn similar_objects_are_diffed_after_an_addition() {
+        let lhs = node(r#"[{"id":1,"n":"x","v":"a"},0]"#);
+        let rhs = node(r#"[{"id":3},{"id":1,"n":"x","v":"b"},0]"#);
+        let diff = lhs.diff(&rhs, &similar(0.6));
+        assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+        assert_eq!(rhs.apply_patch(&diff.reverse().unwrap()).unwrap(), lhs);
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "@ [0]\n[\n+ {\"id\":3}\n  {\"id\":1,\"n\":\"x\",\"v\":\"a\"}\n\
+             @ [1,\"v\"]\n- \"a\"\n+ \"b\"\n"
+        );
+    }
+
+    #[test]
+    fn look_ahead_stays_within_the_alignment_cost() {
+        let lhs = node(r#"[{"id":1,"v":"a"},{"id":2,"n":"x","v":"b"}]"#);
+        let rhs = node(r#"[{"id":2,"n":"x","v":"c"}]"#);
+        let diff = lhs.diff(&rhs, &similar(0.6).with_max_alignment_cost(1));
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "@ [0]\n[\n- {\"id\":1,\"v\":\"a\"}\n- {\"id\":2,\"n\":\"x\",\"v\":\"b\"}\n\
+             + {\"id\":2,\"n\":\"x\",\"v\":\"c\"}\n]\n"
+        );
+        assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+    }
+
+    #[test]
+    fn dissimilar_objects_are_replaced() {
+        let lhs = node(r#"[{"id":1,"v":"a"}]"#);
+        let rhs = node(r#"[{"id":2,"v":"b"}]"#);
+        assert_eq!(
+            lhs.diff(&rhs, &similar(0.6)).render(&RenderConfig::default()),
+            "@ [0]\n[\n- {\"id\":1,\"v\":\"a\"}\n+ {\"id\":2,\"v\":\"b\"}\n]\n"
+        );
+        assert_eq!(lhs.diff(&rhs, &DiffOptions::default()).len(), 2);
+    }
+}
@@ -0,0 +1,328 @@
+//! Simplification of hand-built and composed diffs.
+//!
+//! Diffs computed by jd never change a value twice, but hunks written by
+//! hand or concatenated from several diffs can. Three rewrites run until
+//! none applies: hunks that add back what they remove are dropped,
+//! consecutive hunks whose list ranges touch become one, and a change inside
+//! a value that a neighbouring hunk replaces is folded into that
+//! replacement. Each rewrite keeps the effect of the diff on any document it
+//! applies to.
+
+use super::{Diff, DiffElement, DiffMetadata, Path, PathSegment};
+use crate::prelude::*;
+use crate::Node;
+
+impl Diff {
+    /// Returns an equivalent diff with fewer hunks. Hunks that remove and add
+    /// the same values are dropped, consecutive hunks on touching ranges of
+    /// one list are joined, and a hunk that changes something inside a value
+    /// which the hunk next to it replaces, inserts, or removes is folded into
+    /// that hunk. Metadata of a dropped hunk moves to the next one. Moves and
+    /// hunks under merge metadata are kept as they are, and list hunks are not
+    /// trimmed of values they remove and add back unchanged.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, DiffOptions, Node, RenderConfig};
+    /// let json = |text: &str| Node::from_json_str(text).unwrap();
+    /// let (v1, v2, v3) = (json(r#"{"a":1,"b":[1]}"#), json(r#"{"a":2,"b":[1,2]}"#), json(r#"{"a":1,"b":[1,2,3]}"#));
+    /// let options = DiffOptions::default();
+    /// let composed: Vec<_> = v1.diff(&v2, &options).into_iter().chain(v2.diff(&v3, &options)).collect();
+    /// let simplified = Diff::from_elements(composed).simplify();
+    /// assert_eq!(simplified.render(&RenderConfig::default()), "@ [\"b\",1]\n  1\n+ 2\n+ 3\n]\n");
+    /// assert_eq!(v1.apply_patch(&simplified).unwrap(), v3);
+    /// ```
+    #[must_use]
+    pub fn simplify(&self) -> Diff {
+        let mut elements = self.elements.clone();
+        loop {
+            let dropped = drop_noops(&mut elements);
+            let joined = join_neighbours(&mut elements);
+            if !dropped && !joined {
+                break;
+            }
+        }
+        Diff::from_elements(elements)
+    }
+}
+
+/// Drops hunks that add back exactly what they remove, handing their
+/// metadata to the next hunk. Returns whether any hunk was dropped.
+fn drop_noops(elements: &mut Vec<DiffElement>) -> bool {
+    let count = elements.len();
+    let mut kept = Vec::with_capacity(count);
+    let mut pending: Option<DiffMetadata> = None;
+    for mut element in elements.drain(..) {
+        if element.moved_from.is_none() && element.remove == element.add {
+            if let Some(metadata) = element.metadata.filter(DiffMetadata::is_effective) {
+                pending.get_or_insert_with(DiffMetadata::default).absorb(&metadata);
+            }
+            continue;
+        }
+        if let Some(mut metadata) = pending.take() {
+            if let Some(own) = &element.metadata {
+                metadata.absorb(own);
+            }
+            element.metadata = Some(metadata);
+        }
+        kept.push(element);
+    }
+    *elements = kept;
+    elements.len() != count
+}
+
+/// Replaces pairs of hunks that can be written as one. A hunk pairs with the
+/// next hunk on a related path when the hunks between them change other
+/// keys, so it could move up to sit right after the first. Returns whether
+/// any pair was replaced.
+fn join_neighbours(elements: &mut Vec<DiffElement>) -> bool {
+    let mut joined = false;
+    let mut inherited: Option<DiffMetadata> = None;
+    let mut index = 0;
+    while index + 1 < elements.len() {
+        let first = &elements[index];
+        let mut scope = inherited.clone();
+        if let Some(metadata) = first.metadata.as_ref().filter(|meta| meta.is_effective()) {
+            scope.get_or_insert_with(DiffMetadata::default).absorb(metadata);
+        }
+        let partner = partner(elements, index);
+        let replacement =
+            partner.filter(|_| !scope.as_ref().is_some_and(|meta| meta.merge)).and_then(|later| {
+                let second = &elements[later];
+                join_list_hunks(first, second).or_else(|| fold(first, second, scope.as_ref()))
+            });
+        match (partner, replacement) {
+            (Some(later), Some(element)) => {
+                elements.remove(later);
+                elements[index] = element;
+                joined = true;
+            }
+            _ => {
+                inherited = scope;
+                index += 1;
+            }
+        }
+    }
+    joined
+}
+
+/// Returns the position of the first hunk after `index` whose path is
+/// related to its own, if every hunk up to it changes keys the partner does
+/// not touch. Moves and hunks with their own metadata pair with nothing.
+fn partner(elements: &[DiffElement], index: usize) -> Option<usize> {
+    let first = &elements[index];
+    if first.moved_from.is_some() {
+        return None;
+    }
+    let mut between: Vec<&Path> = Vec::new();
+    for (later, element) in elements.iter().enumerate().skip(index + 1) {
+        if element.moved_from.is_some()
+            || element.metadata.as_ref().is_some_and(DiffMetadata::is_effective)
+        {
+            return None;
+        }
+        if !disjoint(&first.path, &element.path) {
+            let movable = between.iter().all(|path| disjoint(path, &element.path));
+            return movable.then_some(later);
+        }
+        between.push(&element.path);
+    }
+    None
+}
+
+/// Reports whether hunks at `lhs` and `rhs` change separate values no matter
+/// their order: the paths part at two different object keys.
+pub(super) fn disjoint(lhs: &Path, rhs: &Path) -> bool {
+    let parted = lhs.segments().iter().zip(rhs.segments()).find(|(lhs, rhs)| lhs != rhs);
+    matches!(parted, Some((PathSegment::Key(_), PathSegment::Key(_))))
+}
+
+/// Joins two hunks on one list when the second starts inside, or right
+/// after, the values the first inserts.
+fn join_list_hunks(first: &DiffElement, second: &DiffElement) -> Option<DiffElement> {
+    let Some((PathSegment::Index(start), list)) = first.path.segments().split_last() else {
+        return None;
+    };
+    let Some((PathSegment::Index(next), other)) = second.path.segments().split_last() else {
+        return None;
+    };
+    if list != other {
+        return None;
+    }
+    if *start == -1 && *next == -1 && first.remove.is_empty() && second.remove.is_empty() {
+        let add = first.add.iter().chain(&second.add).cloned().collect();
+        return Some(DiffElement { add, after: second.after.clone(), ..first.clone() });
+    }
+    if *start < 0 {
+        return None;
+    }
+    let offset = usize::try_from(next - start).ok().filter(|offset| *offset <= first.add.len())?;
+    // The second hunk may remove values the first inserted, and then values
+    // that followed the first hunk's range.
+    let overlap = second.remove.len().min(first.add.len() - offset);
+    if first.add[offset..offset + overlap] != second.remove[..overlap] {
+        return None;
+    }
+    let spill = &second.remove[overlap..];
+    Some(DiffElement {
+        remove: first.remove.iter().chain(spill).cloned().collect(),
+        add: first.add[..offset]
+            .iter()
+            .chain(&second.add)
+            .chain(&first.add[offset + overlap..])
+            .cloned()
+            .collect(),
+        after: if spill.is_empty() { first.after.clone() } else { second.after.clone() },
+        ..first.clone()
+    })
+}
+
+/// Folds a hunk that changes something inside a value the other hunk
+/// replaces, inserts, or removes into that other hunk.
+fn fold(
+    first: &DiffElement,
+    second: &DiffElement,
+    scope: Option<&DiffMetadata>,
+) -> Option<DiffElement> {
+    if let Some((position, rest)) = locate(&first.path, &first.add, &second.path) {
+        // Edit the value the first hunk adds as the second hunk would.
+        let added = first.add.get(position).unwrap_or(&Node::Void);
+        let edit = Diff::from_elements(vec![relative(second, rest, scope)]);
+        let edited = added.apply_patch(&edit).ok()?;
+        let mut element = first.clone();
+        put(&mut element.add, position, edited);
+        return Some(element);
+    }
+    if let Some((position, rest)) = locate(&second.path, &second.remove, &first.path) {
+        // Undo the first hunk on the value the second hunk removes.
+        let removed = second.remove.get(position).unwrap_or(&Node::Void);
+        let undo = Diff::from_elements(vec![relative(first, rest, scope)]).reverse().ok()?;
+        let original = removed.apply_patch(&undo).ok()?;
+        let mut element = DiffElement { metadata: first.metadata.clone(), ..second.clone() };
+        put(&mut element.remove, position, original);
+        return Some(element);
+    }
+    None
+}
+
+/// Finds the value among `values`, removed or added at `parent`, that
+/// `child` points into, returning its position and the rest of the path. A
+/// hunk at an object key or the root holds at most one value; a list hunk
+/// holds a range of elements, and `child` must point inside one of them.
+fn locate<'a>(
+    parent: &Path,
+    values: &[Node],
+    child: &'a Path,
+) -> Option<(usize, &'a [PathSegment])> {
+    let parent = parent.segments();
+    match parent.split_last() {
+        Some((PathSegment::Index(start @ 0..), list)) => {
+            let rest = child.segments().strip_prefix(list)?;
+            let Some((PathSegment::Index(at), rest)) = rest.split_first() else {
+                return None;
+            };
+            let position = usize::try_from(at - start).ok().filter(|at| *at < values.len())?;
+            (!rest.is_empty()).then_some((position, rest))
+        }
+        Some((PathSegment::Key(_), _)) | None => {
+            let rest = child.segments().strip_prefix(parent)?;
+            (values.len() <= 1).then_some((0, rest))
+        }
+        Some(_) => None,
+    }
+}
+
+/// Returns `element` moved to `rest`, a path inside the value it changes,
+/// under the metadata it applies with.
+fn relative(
+    element: &DiffElement,
+    rest: &[PathSegment],
+    scope: Option<&DiffMetadata>,
+) -> DiffElement {
+    DiffElement { metadata: scope.cloned(), path: Path::from(rest.to_vec()), ..element.clone() }
+}
+
+/// Stores `value` at `position` of `values`, removing the slot when the value
+/// is void.
+fn put(values: &mut Vec<Node>, position: usize, value: Node) {
+    if matches!(value, Node::Void) {
+        if position < values.len() {
+            values.remove(position);
+        }
+    } else if position < values.len() {
+        values[position] = value;
+    } else {
+        values.push(value);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffOptions, RenderConfig};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn native(text: &str) -> Diff {
+        Diff::from_native_str(text).unwrap()
+    }
+
+    fn render(diff: &Diff) -> String {
+        diff.render(&RenderConfig::default())
+    }
+
+    #[test]
+    fn noops_are_dropped_and_pass_on_metadata() {
+        let diff = native("^ {\"precision\":0.5}\n@ [\"a\"]\n- 1\n+ 1\n@ [\"b\"]\n- 1\n+ 2\n");
+        let simplified = diff.simplify();
+        assert_eq!(simplified.len(), 1);
+        assert_eq!(
+            json(r#"{"a":1,"b":1.2}"#).apply_patch(&simplified).unwrap(),
+            json(r#"{"a":1,"b":2}"#)
+        );
+
+        let undone = native("@ [\"a\"]\n- 1\n+ 2\n@ [\"a\"]\n- 2\n+ 1\n");
+        assert!(undone.simplify().is_empty());
+    }
+
+    #[test]
+    fn overlapping_list_hunks_join() {
+        let base = json("[1,4,5]");
+        let diff = native("@ [1]\n  1\n+ 2\n+ 3\n  4\n@ [2]\n  2\n- 3\n- 4\n+ 9\n  5\n");
+        let simplified = diff.simplify();
+        assert_eq!(render(&simplified), "@ [1]\n  1\n- 4\n+ 2\n+ 9\n  5\n");
+        assert_eq!(base.apply_patch(&simplified).unwrap(), base.apply_patch(&diff).unwrap());
+
+        let appends = native("@ [-1]\n+ 1\n@ [-1]\n+ 2\n").simplify();
+        assert_eq!(render(&appends), "@ [-1]\n+ 1\n+ 2\n");
+    }
+
+    #[test]
+    fn changes_inside_replaced_values_fold_into_the_replacement() {
+        let base = json(r#"{"a":{"b":1},"l":[{"x":1},{"x":2}]}"#);
+        let diff = native(concat!(
+            "@ [\"a\",\"b\"]\n- 1\n+ 2\n",
+            "@ [\"a\"]\n- {\"b\":2}\n+ 3\n",
+            "@ [\"l\",1]\n  {\"x\":1}\n- {\"x\":2}\n+ {\"x\":3}\n]\n",
+            "@ [\"l\",1,\"x\"]\n- 3\n+ 4\n",
+        ));
+        let simplified = diff.simplify();
+        assert_eq!(
+            render(&simplified),
+            concat!(
+                "@ [\"a\"]\n- {\"b\":1}\n+ 3\n",
+                "@ [\"l\",1]\n  {\"x\":1}\n- {\"x\":2}\n+ {\"x\":4}\n]\n",
+            )
+        );
+        assert_eq!(base.apply_patch(&simplified).unwrap(), base.apply_patch(&diff).unwrap());
+    }
+
+    #[test]
+    fn computed_diffs_are_already_simple() {
+        let lhs = json(r#"{"a":[1,2,3,4],"b":{"c":1},"d":"x"}"#);
+        let rhs = json(r#"{"a":[0,2,4,5],"b":{"c":2},"e":"y"}"#);
+        let diff = lhs.diff(&rhs, &DiffOptions::default());
+        assert_eq!(diff.simplify().into_elements(), diff.into_elements());
+    }
+}
@@ -0,0 +1,354 @@
+//! Per-path change counts, rendered like `git diff --stat`.
+
+use alloc::collections::BTreeSet;
+use core::fmt::Write as _;
+
+use super::theme::COLOR_RESET;
+use super::{is_void, path_to_json, Diff, DiffElement, Path, PathSegment, RenderConfig};
+
+use crate::prelude::*;
+
+/// Widest bar of `+` and `-` markers; longer bars are scaled down.
+const MAX_BAR: usize = 40;
+
+/// The number of values a diff adds and removes at one path.
+///
+/// ```
+/// # use jd_core::{DiffOptions, Node};
+/// let lhs = Node::from_json_str(r#"{"a":1}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"a":2}"#).unwrap();
+/// let stat = lhs.diff(&rhs, &DiffOptions::default()).stat();
+/// let entry = &stat.entries()[0];
+/// assert_eq!((entry.additions, entry.removals), (1, 1));
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub struct StatEntry {
+    /// Path of the changed subtree, as in the hunk header.
+    pub path: Path,
+    /// Values added at the path.
+    pub additions: usize,
+    /// Values removed from the path.
+    pub removals: usize,
+}
+
+/// A summary of a diff: one [`StatEntry`] per changed path, in diff order.
+///
+/// ```
+/// # use jd_core::{DiffOptions, Node, RenderConfig};
+/// let lhs = Node::from_json_str(r#"{"a":1,"b":[1]}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"a":2,"b":[1,2]}"#).unwrap();
+/// let stat = lhs.diff(&rhs, &DiffOptions::default()).stat();
+/// assert_eq!(
+///     stat.render(&RenderConfig::default()),
+///     " [\"a\"]   | 2 +-\n [\"b\",1] | 1 +\n 2 paths changed, 2 additions(+), 1 removal(-)\n"
+/// );
+/// ```
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct DiffStat {
+    entries: Vec<StatEntry>,
+}
+
+/// Totals for a whole diff, for checks such as failing a build when more
+/// than a set number of values changed.
+///
+/// ```
+/// # use jd_core::{DiffOptions, Node};
+/// let lhs = Node::from_json_str(r#"{"name":"api","spec":{"replicas":1,"ports":[80]}}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"name":"web","spec":{"replicas":1,"ports":[80,443]}}"#).unwrap();
+/// let stats = lhs.diff(&rhs, &DiffOptions::default()).stats();
+/// assert_eq!((stats.additions, stats.removals, stats.replacements), (1, 0, 1));
+/// assert_eq!(stats.top_level_keys.iter().collect::<Vec<_>>(), ["name", "spec"]);
+/// assert_eq!(stats.max_depth, 3);
+/// ```
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+pub struct DiffStats {
+    /// Values added without one being removed in their place.
+    pub additions: usize,
+    /// Values removed without one being added in their place.
+    pub removals: usize,
+    /// Values replaced by another value at the same path.
+    pub replacements: usize,
+    /// The keys of the root object under which anything changed.
+    pub top_level_keys: BTreeSet<String>,
+    /// The most path segments of any changed path; zero when nothing, or only
+    /// the root, changed.
+    pub max_depth: usize,
+}
+
+impl DiffStats {
+    /// Returns the number of values added, removed, or replaced.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str("[1,2,3]").unwrap();
+    /// let rhs = Node::from_json_str("[1,4]").unwrap();
+    /// assert_eq!(lhs.diff(&rhs, &DiffOptions::default()).stats().changes(), 2);
+    /// ```
+    #[must_use]
+    pub fn changes(&self) -> usize {
+        self.additions + self.removals + self.replacements
+    }
+}
+
+impl Diff {
+    /// Totals the changes of the whole diff. Within a hunk, each removed
+    /// value paired with an added one counts as a replacement and the rest
+    /// as additions or removals. Moves and void additions count as in
+    /// [`Diff::stat`]. A hunk that replaces the whole document names no
+    /// top-level keys.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"a":1,"b":2}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"a":3,"c":4}"#).unwrap();
+    /// let stats = lhs.diff(&rhs, &DiffOptions::default()).stats();
+    /// assert_eq!((stats.additions, stats.removals, stats.replacements), (1, 1, 1));
+    /// assert_eq!(stats.changes(), 3);
+    /// ```
+    #[must_use]
+    pub fn stats(&self) -> DiffStats {
+        let mut stats = DiffStats::default();
+        for element in self.iter().flat_map(|element| element.expand_move()) {
+            let (additions, removals) = counts(&element);
+            if additions + removals == 0 {
+                continue;
+            }
+            let replacements = additions.min(removals);
+            stats.replacements += replacements;
+            stats.additions += additions - replacements;
+            stats.removals += removals - replacements;
+            if let Some(PathSegment::Key(key)) = element.path.segments().first() {
+                stats.top_level_keys.insert(key.clone());
+            }
+            stats.max_depth = stats.max_depth.max(element.path.segments().len());
+        }
+        stats
+    }
+
+    /// Counts the values each hunk adds and removes. A move counts as a
+    /// removal at its origin and an addition at its destination, and a void
+    /// addition, which deletes a key in a merge diff, as a removal.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str("[1,2,3]").unwrap();
+    /// let rhs = Node::from_json_str("[1,4]").unwrap();
+    /// let stat = lhs.diff(&rhs, &DiffOptions::default()).stat();
+    /// assert_eq!((stat.additions(), stat.removals()), (1, 2));
+    /// ```
+    #[must_use]
+    pub fn stat(&self) -> DiffStat {
+        let mut stat = DiffStat::default();
+        for element in self.iter().flat_map(|element| element.expand_move()) {
+            let (additions, removals) = counts(&element);
+            if additions + removals == 0 {
+                continue;
+            }
+            match stat.entries.iter_mut().find(|entry| entry.path == element.path) {
+                Some(entry) => {
+                    entry.additions += additions;
+                    entry.removals += removals;
+                }
+                None => stat.entries.push(StatEntry { path: element.path, additions, removals }),
+            }
+        }
+        stat
+    }
+}
+
+impl DiffStat {
+    /// Returns the changed paths with their counts.
+    ///
+    /// ```
+    /// # use jd_core::Diff;
+    /// assert!(Diff::default().stat().entries().is_empty());
+    /// ```
+    #[must_use]
+    pub fn entries(&self) -> &[StatEntry] {
+        &self.entries
+    }
+
+    /// Reports whether nothing changed.
+    ///
+    /// ```
+    /// # use jd_core::Diff;
+    /// assert!(Diff::default().stat().is_empty());
+    /// ```
+    #[must_use]
+    pub fn is_empty(&self) -> bool {
+        self.entries.is_empty()
+    }
+
+    /// Returns the number of values added across all paths.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str("{}").unwrap();
+    /// let rhs = Node::from_json_str(r#"{"a":1,"b":2}"#).unwrap();
+    /// assert_eq!(lhs.diff(&rhs, &DiffOptions::default()).stat().additions(), 2);
+    /// ```
+    #[must_use]
+    pub fn additions(&self) -> usize {
+        self.entries.iter().map(|entry| entry.additions).sum()
+    }
+
+    /// Returns the number of values removed across all paths.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"a":1}"#).unwrap();
+    /// let rhs = Node::from_json_str("{}").unwrap();
+    /// assert_eq!(lhs.diff(&rhs, &DiffOptions::default()).stat().removals(), 1);
+    /// ```
+    #[must_use]
+    pub fn removals(&self) -> usize {
+        self.entries.iter().map(|entry| entry.removals).sum()
+    }
+
+    /// Renders one line per path, with the path, its number of changes, and
+    /// a bar of `+` and `-` markers, then a totals line. An empty summary
+    /// renders as an empty string.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"{"a":1}"#).unwrap();
+    /// let rhs = Node::from_json_str("{}").unwrap();
+    /// let stat = lhs.diff(&rhs, &DiffOptions::default()).stat();
+    /// assert_eq!(
+    ///     stat.render(&RenderConfig::default()),
+    ///     " [\"a\"] | 1 -\n 1 path changed, 1 removal(-)\n"
+    /// );
+    /// ```
+    #[must_use]
+    pub fn render(&self, config: &RenderConfig) -> String {
+        if self.is_empty() {
+            return String::new();
+        }
+        let paths: Vec<String> =
+            self.entries.iter().map(|entry| path_to_json(&entry.path)).collect();
+        let path_width = paths.iter().map(|path| path.chars().count()).max().unwrap_or(0);
+        let most = self.entries.iter().map(|entry| entry.additions + entry.removals).max();
+        let most = most.unwrap_or(0);
+        let count_width = most.to_string().len();
+
+        let mut output = String::new();
+        for (entry, path) in self.entries.iter().zip(&paths) {
+            let total = entry.additions + entry.removals;
+            let padding = path_width - path.chars().count();
+            let _ = write!(output, " {path}{:padding$} | {total:>count_width$} ", "");
+            let (plus, minus) = bar(entry.additions, entry.removals, most);
+            push_marks(&mut output, '+', plus, config.theme().added(), config);
+            push_marks(&mut output, '-', minus, config.theme().removed(), config);
+            output.push('\n');
+        }
+
+        let count =
+            |n: usize, one: &str, many: &str| format!("{n} {}", if n == 1 { one } else { many });
+        let _ = write!(output, " {} changed", count(self.entries.len(), "path", "paths"));
+        if self.additions() > 0 {
+            let _ = write!(output, ", {}(+)", count(self.additions(), "addition", "additions"));
+        }
+        if self.removals() > 0 {
+            let _ = write!(output, ", {}(-)", count(self.removals(), "removal", "removals"));
+        }
+        output.push('\n');
+        output
+    }
+}
+
+/// Returns the values `element` adds and removes, counting a void addition,
+/// which deletes a key in a merge diff, as a removal.
+fn counts(element: &DiffElement) -> (usize, usize) {
+    let voids = element.add.iter().filter(|value| is_void(value)).count();
+    let removals = element.remove.iter().filter(|value| !is_void(value)).count() + voids;
+    (element.add.len() - voids, removals)
+}
+
+/// Scales the marker counts so the largest bar is at most [`MAX_BAR`] wide,
+/// keeping at least one marker for any nonzero count.
+fn bar(additions: usize, removals: usize, most: usize) -> (usize, usize) {
+    if most <= MAX_BAR {
+        return (additions, removals);
+    }
+    let scale = |n: usize| if n == 0 { 0 } else { (n * MAX_BAR / most).max(1) };
+    (scale(additions), scale(removals))
+}
+
+fn push_marks(output: &mut String, mark: char, count: usize, color: &str, config: &RenderConfig) {
+    if count == 0 {
+        return;
+    }
+    if config.color_enabled() {
+        output.push_str(color);
+    }
+    output.extend(core::iter::repeat_n(mark, count));
+    if config.color_enabled() {
+        output.push_str(COLOR_RESET);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffElement, DiffMetadata, DiffOptions, Node, PathSegment};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    #[test]
+    fn moves_count_at_both_ends() {
+        let options = DiffOptions::default().with_move_detection(true);
+        let stat = json("[1,2,3]").diff(&json("[3,1,2]"), &options).stat();
+        assert_eq!(stat.entries().len(), 2);
+        assert_eq!((stat.additions(), stat.removals()), (1, 1));
+    }
+
+    #[test]
+    fn merge_deletions_count_as_removals() {
+        let element = DiffElement::new()
+            .with_metadata(DiffMetadata::merge())
+            .with_path(PathSegment::key("gone"))
+            .with_add(vec![Node::Void]);
+        let stat = Diff::from_elements(vec![element]).stat();
+        assert_eq!((stat.additions(), stat.removals()), (0, 1));
+    }
+
+    #[test]
+    fn stats_pair_replacements_within_hunks() {
+        let lhs = json(r#"{"tags":["a","b","c"],"spec":{"ports":[{"port":80}]},"old":1}"#);
+        let rhs = json(r#"{"tags":["x","y"],"spec":{"ports":[{"port":8080}]},"new":true}"#);
+        let stats = lhs.diff(&rhs, &DiffOptions::default()).stats();
+        assert_eq!((stats.additions, stats.removals, stats.replacements), (1, 2, 3));
+        assert_eq!(
+            stats.top_level_keys.into_iter().collect::<Vec<_>>(),
+            ["new", "old", "spec", "tags"]
+        );
+        assert_eq!(stats.max_depth, 4);
+
+        let stats = json("[1]").diff(&json(r#"{"a":1}"#), &DiffOptions::default()).stats();
+        assert_eq!((stats.replacements, stats.max_depth), (1, 0));
+        assert!(stats.top_level_keys.is_empty());
+    }
+
+    #[test]
+    fn long_bars_are_scaled() {
+        let many: Vec<String> = (0..100).map(|n| n.to_string()).collect();
+        let lhs = json(&format!(r#"{{"a":[{}],"b":1}}"#, many.join(",")));
+        let stat = lhs.diff(&json(r#"{"a":[],"b":2}"#), &DiffOptions::default()).stat();
+        let rendered = stat.render(&RenderConfig::default());
+        let lines: Vec<&str> = rendered.lines().collect();
+        assert_eq!(lines[0], format!(" [\"a\",0] | 100 {}", "-".repeat(40)));
+        assert_eq!(lines[1], " [\"b\"]   |   2 +-");
+        assert_eq!(lines[2], " 2 paths changed, 1 addition(+), 101 removals(-)");
+    }
+
+    #[test]
+    fn color_marks_the_bar() {
+        let stat = json("1").diff(&json("2"), &DiffOptions::default()).stat();
+        assert_eq!(
+            stat.render(&RenderConfig::color(true)),
+            " [] | 2 \u{1b}[32m+\u{1b}[0m\u{1b}[31m-\u{1b}[0m\n 1 path changed, 1 addition(+), 1 removal(-)\n"
+        );
+    }
+}
@@ -0,0 +1,541 @@
+//! Streaming diffs of JSON documents too large to hold in memory.
+//!
+//! Both inputs are read as a sequence of tokens. Wherever both sides hold an
+//! object or both hold a list, the walk descends into them in step and only
+//! materializes the values that differ. Equal subtrees are read and dropped
+//! without ever becoming a [`Node`], and hunks are handed to the caller as
+//! soon as they are known.
+//!
+//! Object fields are compared in document order. When keys line up, their
+//! values are streamed; otherwise each value is kept until the same key turns
+//! up on the other side, so memory grows with the fields whose order
+//! differs. Lists are compared position by position, the way `--ndjson`
+//! pairs records, and their hunks carry no context because neighbouring
+//! elements may already be gone. Set and multiset arrays, values with a
+//! custom comparator, and values of different kinds are materialized and
+//! diffed as usual.
+
+use alloc::collections::BTreeMap;
+use std::io::{self, BufRead};
+
+use thiserror::Error;
+
+use super::{diff_impl, with_float_forms, Diff, DiffElement, Path, PathSegment};
+use crate::prelude::*;
+use crate::{ArrayMode, CanonicalizeError, DiffOptions, Node, NumberEquality};
+
+/// Errors raised while streaming a diff.
+///
+/// ```
+/// # use jd_core::{diff_streams, DiffOptions, StreamError};
+/// let err = diff_streams(&b"[1,"[..], &b"[1]"[..], &DiffOptions::default(), |_| Ok(()))
+///     .unwrap_err();
+/// assert!(matches!(err, StreamError::Syntax { offset: 3, .. }));
+/// ```
+#[derive(Debug, Error)]
+pub enum StreamError {
+    /// Reading an input or emitting a hunk failed.
+    #[error("I/O error: {0}")]
+    Io(#[from] io::Error),
+    /// An input is not well-formed JSON.
+    #[error("invalid JSON at byte {offset}: {message}")]
+    Syntax {
+        /// Byte offset in the input where the problem was found.
+        offset: u64,
+        /// What was wrong.
+        message: String,
+    },
+    /// A value could not be canonicalized into a [`Node`].
+    #[error("invalid value at byte {offset}: {source}")]
+    Value {
+        /// Byte offset in the input where the value starts.
+        offset: u64,
+        /// The underlying canonicalization error.
+        source: CanonicalizeError,
+    },
+    /// The [`CancellationToken`](crate::CancellationToken) of the options
+    /// was cancelled.
+    #[error("diff cancelled")]
+    Cancelled,
+}
+
+/// Diffs two JSON documents read from `lhs` and `rhs` without materializing
+/// either, passing each hunk to `emit` as soon as it is known.
+///
+/// Applying the emitted hunks to `lhs` in order yields `rhs`. They may differ
+/// from [`Node::diff`]: fields appear in document order, and lists are
+/// compared by position with no context lines instead of being aligned. An
+/// empty input stands for a missing value, as it does elsewhere in `jd`.
+///
+/// ```
+/// # use jd_core::{diff_streams, Diff, DiffOptions, Node, RenderConfig};
+/// let lhs = r#"{"name":"jd","tags":["a","b"]}"#;
+/// let rhs = r#"{"name":"jd","tags":["a","c"]}"#;
+/// let mut elements = Vec::new();
+/// diff_streams(lhs.as_bytes(), rhs.as_bytes(), &DiffOptions::default(), |element| {
+///     elements.push(element);
+///     Ok(())
+/// })
+/// .unwrap();
+/// let diff = Diff::from_elements(elements);
+/// assert_eq!(diff.render(&RenderConfig::default()), "@ [\"tags\",1]\n- \"b\"\n+ \"c\"\n");
+/// let patched = Node::from_json_str(lhs).unwrap().apply_patch(&diff).unwrap();
+/// assert_eq!(patched, Node::from_json_str(rhs).unwrap());
+/// ```
+pub fn diff_streams<L, R, F>(
+    lhs: L,
+    rhs: R,
+    options: &DiffOptions,
+    emit: F,
+) -> Result<(), StreamError>
+where
+    L: BufRead,
+    R: BufRead,
+    F: FnMut(DiffElement) -> io::Result<()>,
+{
+    let typed = options.number_equality() == NumberEquality::Typed;
+    let mut emit = emit;
+    let emit = move |element| emit(if typed { with_float_forms(element) } else { element });
+    let mut walk = Walk { lhs: Tokens::new(lhs), rhs: Tokens::new(rhs), emit };
+    if walk.lhs.is_empty()? || walk.rhs.is_empty()? {
+        let lhs = walk.lhs.read_root()?;
+        let rhs = walk.rhs.read_root()?;
+        walk.emit_all(diff_impl(&lhs, &rhs, &Path::new(), options), options)?;
+    } else if options.is_ignored() {
+        walk.lhs.skip()?;
+        walk.rhs.skip()?;
+    } else {
+        walk.value(&Path::new(), options)?;
+    }
+    walk.lhs.finish()?;
+    walk.rhs.finish()
+}
+
+struct Walk<L, R, F> {
+    lhs: Tokens<L>,
+    rhs: Tokens<R>,
+    emit: F,
+}
+
+impl<L, R, F> Walk<L, R, F>
+where
+    L: BufRead,
+    R: BufRead,
+    F: FnMut(DiffElement) -> io::Result<()>,
+{
+    fn value(&mut self, path: &Path, options: &DiffOptions) -> Result<(), StreamError> {
+        if options.is_cancelled() {
+            return Err(StreamError::Cancelled);
+        }
+        let kinds = (self.lhs.peek_kind()?, self.rhs.peek_kind()?);
+        match kinds {
+            _ if options.has_comparators() => self.materialized(path, options),
+            (Kind::Object, Kind::Object) => self.objects(path, options),
+            (Kind::Array, Kind::Array) if options.array_mode() == ArrayMode::List => {
+                self.lists(path, options)
+            }
+            _ => self.materialized(path, options),
+        }
+    }
+
+    fn materialized(&mut self, path: &Path, options: &DiffOptions) -> Result<(), StreamError> {
+        let lhs = self.lhs.read_node()?;
+        let rhs = self.rhs.read_node()?;
+        self.emit_all(diff_impl(&lhs, &rhs, path, options), options)
+    }
+
+    fn objects(&mut self, path: &Path, options: &DiffOptions) -> Result<(), StreamError> {
+        self.lhs.enter();
+        self.rhs.enter();
+        let mut lhs_pending: BTreeMap<String, Node> = BTreeMap::new();
+        let mut rhs_pending: BTreeMap<String, Node> = BTreeMap::new();
+        let mut lhs_key = self.lhs.next_key(true)?;
+        let mut rhs_key = self.rhs.next_key(true)?;
+        while lhs_key.is_some() || rhs_key.is_some() {
+            if lhs_key == rhs_key {
+                let segment = PathSegment::key(lhs_key.take().expect("keys remain"));
+                let child = options.refine(&segment);
+                if child.is_ignored() {
+                    self.lhs.skip()?;
+                    self.rhs.skip()?;
+                } else {
+                    self.value(&path.clone().with_segment(segment), &child)?;
+                }
+                lhs_key = self.lhs.next_key(false)?;
+                rhs_key = self.rhs.next_key(false)?;
+                continue;
+            }
+            if let Some(key) = lhs_key.take() {
+                let node = self.lhs.read_node()?;
+                match rhs_pending.remove(&key) {
+                    Some(other) => self.pair(path, options, key, &node, &other)?,
+                    None => drop(lhs_pending.insert(key, node)),
+                }
+                lhs_key = self.lhs.next_key(false)?;
+            }
+            if let Some(key) = rhs_key.take() {
+                let node = self.rhs.read_node()?;
+                match lhs_pending.remove(&key) {
+                    Some(other) => self.pair(path, options, key, &other, &node)?,
+                    None => drop(rhs_pending.insert(key, node)),
+                }
+                rhs_key = self.rhs.next_key(false)?;
+            }
+        }
+
+        for (key, node) in lhs_pending {
+            let segment = PathSegment::key(key);
+            if !options.refine(&segment).is_ignored() {
+                let element = DiffElement::new()
+                    .with_path(path.clone().with_segment(segment))
+                    .with_remove(vec![node]);
+                (self.emit)(element)?;
+            }
+        }
+        for (key, node) in rhs_pending {
+            let segment = PathSegment::key(key);
+            if !options.refine(&segment).is_ignored() {
+                let element = DiffElement::new()
+                    .with_path(path.clone().with_segment(segment))
+                    .with_add(vec![node]);
+                (self.emit)(element)?;
+            }
+        }
+        Ok(())
+    }
+
+    /// Diffs the values of a field that appeared at different places.
+    fn pair(
+        &mut self,
+        path: &Path,
+        options: &DiffOptions,
+        key: String,
+        lhs: &Node,
+        rhs: &Node,
+    ) -> Result<(), StreamError> {
+        let segment = PathSegment::key(key);
+        let child = options.refine(&segment);
+        if child.is_ignored() {
+            return Ok(());
+        }
+        self.emit_all(diff_impl(lhs, rhs, &path.clone().with_segment(segment), &child), &child)
+    }
+
+    fn lists(&mut self, path: &Path, options: &DiffOptions) -> Result<(), StreamError> {
+        self.lhs.enter();
+        self.rhs.enter();
+        let mut index = 0;
+        let mut more = (self.lhs.next_element(true)?, self.rhs.next_element(true)?);
+        while more == (true, true) {
+            let segment = PathSegment::index(index);
+            let child = options.refine(&segment);
+            if child.is_ignored() {
+                self.lhs.skip()?;
+                self.rhs.skip()?;
+            } else {
+                self.value(&path.clone().with_segment(segment), &child)?;
+            }
+            index += 1;
+            more = (self.lhs.next_element(false)?, self.rhs.next_element(false)?);
+        }
+
+        // Every hunk past the shared length applies at the same position:
+        // removals close the gap behind them and additions extend the list.
+        let at = path.clone().with_segment(PathSegment::index(index));
+        let mut remaining = more.0;
+        while remaining {
+            let node = self.lhs.read_node()?;
+            (self.emit)(DiffElement::new().with_path(at.clone()).with_remove(vec![node]))?;
+            remaining = self.lhs.next_element(false)?;
+        }
+        let mut remaining = more.1;
+        while remaining {
+            let node = self.rhs.read_node()?;
+            let at = path.clone().with_segment(PathSegment::index(index));
+            (self.emit)(DiffElement::new().with_path(at).with_add(vec![node]))?;
+            index += 1;
+            remaining = self.rhs.next_element(false)?;
+        }
+        Ok(())
+    }
+
+    fn emit_all(&mut self, diff: Diff, options: &DiffOptions) -> Result<(), StreamError> {
+        // A cancelled diff may hold hunks of a partial alignment.
+        if options.is_cancelled() {
+            return Err(StreamError::Cancelled);
+        }
+        for element in diff {
+            (self.emit)(element)?;
+        }
+        Ok(())
+    }
+}
+
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+enum Kind {
+    Object,
+    Array,
+    Scalar,
+}
+
+/// A pull reader over the tokens of one JSON document.
+///
+/// Structure is checked as it is walked; scalars and materialized values are
+/// captured as raw text and checked by the regular parser.
+struct Tokens<R> {
+    input: R,
+    offset: u64,
+}
+
+impl<R: BufRead> Tokens<R> {
+    fn new(input: R) -> Self {
+        Self { input, offset: 0 }
+    }
+
+    fn peek(&mut self) -> Result<Option<u8>, StreamError> {
+        Ok(self.input.fill_buf()?.first().copied())
+    }
+
+    fn bump(&mut self) {
+        self.input.consume(1);
+        self.offset += 1;
+    }
+
+    /// Skips whitespace and returns the next byte without consuming it.
+    fn peek_token(&mut self) -> Result<Option<u8>, StreamError> {
+        while let Some(b' ' | b'\t' | b'\n' | b'\r') = self.peek()? {
+            self.bump();
+        }
+        self.peek()
+    }
+
+    fn syntax(&self, message: impl Into<String>) -> StreamError {
+        StreamError::Syntax { offset: self.offset, message: message.into() }
+    }
+
+    fn expect(&mut self, byte: u8) -> Result<(), StreamError> {
+        match self.peek_token()? {
+            Some(found) if found == byte => {
+                self.bump();
+                Ok(())
+            }
+            Some(found) => Err(self.syntax(format!(
+                "expected `{}`, found `{}`",
+                char::from(byte),
+                char::from(found)
+            ))),
+            None => {
+                Err(self.syntax(format!("expected `{}`, found end of input", char::from(byte))))
+            }
+        }
+    }
+
+    fn is_empty(&mut self) -> Result<bool, StreamError> {
+        Ok(self.peek_token()?.is_none())
+    }
+
+    fn peek_kind(&mut self) -> Result<Kind, StreamError> {
+        match self.peek_token()? {
+            Some(b'{') => Ok(Kind::Object),
+            Some(b'[') => Ok(Kind::Array),
+            Some(_) => Ok(Kind::Scalar),
+            None => Err(self.syntax("unexpected end of input")),
+        }
+    }
+
+    /// Consumes the opening bracket found by [`Self::peek_kind`].
+    fn enter(&mut self) {
+        self.bump();
+    }
+
+    /// Reads the next key of the current object up to its colon, or consumes
+    /// the closing brace and returns `None`.
+    fn next_key(&mut self, first: bool) -> Result<Option<String>, StreamError> {
+        if self.peek_token()? == Some(b'}') {
+            self.bump();
+            return Ok(None);
+        }
+        if !first {
+            self.expect(b',')?;
+        }
+        if self.peek_token()? != Some(b'"') {
+            return Err(self.syntax("expected an object key"));
+        }
+        let offset = self.offset;
+        let raw = self.read_raw()?;
+        let key = serde_json::from_slice(&raw)
+            .map_err(|err| StreamError::Syntax { offset, message: err.to_string() })?;
+        self.expect(b':')?;
+        Ok(Some(key))
+    }
+
+    /// Moves to the next element of the current list, or consumes the
+    /// closing bracket and returns `false`.
+    fn next_element(&mut self, first: bool) -> Result<bool, StreamError> {
+        if self.peek_token()? == Some(b']') {
+            self.bump();
+            return Ok(false);
+        }
+        if !first {
+            self.expect(b',')?;
+        }
+        Ok(true)
+    }
+
+    fn read_node(&mut self) -> Result<Node, StreamError> {
+        self.peek_token()?;
+        let offset = self.offset;
+        let raw = self.read_raw()?;
+        let text = core::str::from_utf8(&raw)
+            .map_err(|err| StreamError::Syntax { offset, message: err.to_string() })?;
+        Node::from_json_str(text).map_err(|source| StreamError::Value { offset, source })
+    }
+
+    /// Reads the whole document, or [`Node::Void`] when it is empty.
+    fn read_root(&mut self) -> Result<Node, StreamError> {
+        if self.is_empty()? {
+            return Ok(Node::Void);
+        }
+        self.read_node()
+    }
+
+    /// Reads past the next value without keeping it.
+    fn skip(&mut self) -> Result<(), StreamError> {
+        self.read_node().map(drop)
+    }
+
+    /// Captures the raw text of the next value. Strings and containers are
+    /// delimited here; everything else runs up to the next delimiter.
+    fn read_raw(&mut self) -> Result<Vec<u8>, StreamError> {
+        let mut raw = Vec::new();
+        let mut depth = 0usize;
+        let mut in_string = false;
+        let mut escaped = false;
+        loop {
+            let Some(byte) = self.peek()? else {
+                if depth > 0 || in_string {
+                    return Err(self.syntax("unexpected end of input"));
+                }
+                break;
+            };
+            if in_string {
+                if escaped {
+                    escaped = false;
+                } else if byte == b'\\' {
+                    escaped = true;
+                } else if byte == b'"' {
+                    in_string = false;
+                }
+            } else {
+                match byte {
+                    b'"' => in_string = true,
+                    b'{' | b'[' => depth += 1,
+                    b'}' | b']' if depth > 0 => depth -= 1,
+                    b',' | b'}' | b']' | b':' | b' ' | b'\t' | b'\n' | b'\r' if depth == 0 => {
+                        break;
+                    }
+                    _ => {}
+                }
+            }
+            raw.push(byte);
+            self.bump();
+            if depth == 0 && !in_string && matches!(byte, b'"' | b'}' | b']') {
+                break;
+            }
+        }
+        if raw.is_empty() {
+            return Err(self.syntax("expected a value"));
+        }
+        Ok(raw)
+    }
+
+    /// Checks that nothing but whitespace follows the document.
+    fn finish(&mut self) -> Result<(), StreamError> {
+        match self.peek_token()? {
+            None => Ok(()),
+            Some(_) => Err(self.syntax("trailing data after the document")),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::RenderConfig;
+
+    fn stream(lhs: &str, rhs: &str, options: &DiffOptions) -> Diff {
+        let mut elements = Vec::new();
+        diff_streams(lhs.as_bytes(), rhs.as_bytes(), options, |element| {
+            elements.push(element);
+            Ok(())
+        })
+        .unwrap();
+        Diff::from_elements(elements)
+    }
+
+    fn assert_round_trip(lhs: &str, rhs: &str) {
+        let diff = stream(lhs, rhs, &DiffOptions::default());
+        let (lhs, rhs) = (Node::from_json_str(lhs).unwrap(), Node::from_json_str(rhs).unwrap());
+        assert_eq!(
+            lhs.apply_patch(&diff).unwrap(),
+            rhs,
+            "{}",
+            diff.render(&RenderConfig::default())
+        );
+    }
+
+    #[test]
+    fn streamed_hunks_patch_lhs_into_rhs() {
+        assert_round_trip(r#"{"a":1,"b":[1,2,3]}"#, r#"{"a":2,"b":[1,4]}"#);
+        assert_round_trip("[1,2]", "[1,2,3,4]");
+        assert_round_trip(r#"{"b":{"x":1},"a":"s"}"#, r#"{"a":"t","c":null,"b":{"x":1}}"#);
+        assert_round_trip(r#"[{"k":[]},"x"]"#, r#"[{"k":[{}]},["x"]]"#);
+        assert_round_trip(r#" "a" "#, "\n[]\n");
+        assert_round_trip(r#"{"s":"a\"b]}"}"#, r#"{"s":"a\"b]}!"}"#);
+    }
+
+    #[test]
+    fn equal_documents_emit_nothing() {
+        let doc = r#"{"a":[1,{"b":"c"}],"d":1.0}"#;
+        assert!(
+            stream(doc, r#"{ "a" : [1, {"b":"c"}], "d" : 1 }"#, &DiffOptions::default()).is_empty()
+        );
+    }
+
+    #[test]
+    fn fields_are_reported_in_document_order() {
+        let diff = stream(r#"{"z":1,"a":1}"#, r#"{"a":2,"y":1}"#, &DiffOptions::default());
+        assert_eq!(
+            diff.render(&RenderConfig::default()),
+            "@ [\"a\"]\n- 1\n+ 2\n@ [\"z\"]\n- 1\n@ [\"y\"]\n+ 1\n"
+        );
+    }
+
+    #[test]
+    fn options_apply_to_streamed_values() {
+        let options = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+        assert!(stream("[1,2]", "[2,1]", &options).is_empty());
+        let options = DiffOptions::default().with_excluded_keys(["^ts$"]).unwrap();
+        assert!(stream(r#"{"ts":1,"v":2}"#, r#"{"v":2,"ts":3}"#, &options).is_empty());
+        let options = DiffOptions::default()
+            .with_ignored_paths([Path::from(vec![PathSegment::key("l"), PathSegment::index(1)])]);
+        assert!(stream(r#"{"l":[1,2]}"#, r#"{"l":[1,3]}"#, &options).is_empty());
+    }
+
+    #[test]
+    fn empty_inputs_stand_for_missing_values() {
+        let diff = stream("", "1", &DiffOptions::default());
+        assert_eq!(diff.render(&RenderConfig::default()), "@ []\n+ 1\n");
+    }
+
+    #[test]
+    fn malformed_input_is_reported_with_its_offset() {
+        let options = DiffOptions::default();
+        let err = diff_streams(&b"{\"a\" 1}"[..], &b"{}"[..], &options, |_| Ok(())).unwrap_err();
+        assert!(matches!(err, StreamError::Syntax { offset: 5, .. }), "{err}");
+        let err = diff_streams(&b"[1] 2"[..], &b"[1]"[..], &options, |_| Ok(())).unwrap_err();
+        assert!(matches!(err, StreamError::Syntax { offset: 4, .. }), "{err}");
+        let err = diff_streams(&b"[tru]"[..], &b"[1]"[..], &options, |_| Ok(())).unwrap_err();
+        assert!(matches!(err, StreamError::Value { offset: 1, .. }), "{err}");
+    }
+}
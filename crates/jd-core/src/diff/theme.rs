@@ -0,0 +1,55 @@
+//! ANSI palettes for colored output.
+
+/// Resets the terminal color after a colored span.
+pub(crate) const COLOR_RESET: &str = "\u{1b}[0m";
+
+/// The colors used for removed and added values when color is enabled.
+///
+/// ```
+/// # use jd_core::ColorTheme;
+/// assert_eq!(ColorTheme::default(), ColorTheme::Default);
+/// assert_eq!(ColorTheme::Default.removed(), "\u{1b}[31m");
+/// ```
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq)]
+pub enum ColorTheme {
+    /// Red removals and green additions, exactly as Go jd prints them.
+    #[default]
+    Default,
+    /// Bold, bright red and green for dim or low-contrast terminals.
+    HighContrast,
+    /// Orange removals and blue additions, which stay distinct under the
+    /// common forms of color blindness. Needs a 256-color terminal.
+    ColorblindSafe,
+}
+
+impl ColorTheme {
+    /// Returns the escape sequence that starts a removed value.
+    ///
+    /// ```
+    /// # use jd_core::ColorTheme;
+    /// assert_eq!(ColorTheme::HighContrast.removed(), "\u{1b}[1;91m");
+    /// ```
+    #[must_use]
+    pub fn removed(self) -> &'static str {
+        match self {
+            Self::Default => "\u{1b}[31m",
+            Self::HighContrast => "\u{1b}[1;91m",
+            Self::ColorblindSafe => "\u{1b}[38;5;208m",
+        }
+    }
+
+    /// Returns the escape sequence that starts an added value.
+    ///
+    /// ```
+    /// # use jd_core::ColorTheme;
+    /// assert_eq!(ColorTheme::ColorblindSafe.added(), "\u{1b}[38;5;33m");
+    /// ```
+    #[must_use]
+    pub fn added(self) -> &'static str {
+        match self {
+            Self::Default => "\u{1b}[32m",
+            Self::HighContrast => "\u{1b}[1;92m",
+            Self::ColorblindSafe => "\u{1b}[38;5;33m",
+        }
+    }
+}
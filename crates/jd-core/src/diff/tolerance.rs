@@ -0,0 +1,60 @@
+use crate::hash::HashCode;
+use crate::prelude::*;
+use crate::{DiffOptions, Node};
+
+/// Assigns stand-in hash codes that honour a numeric precision tolerance.
+///
+/// Exact hash codes distinguish `10.1` from `10.11` even when the precision
+/// option says they are equal, so hash-driven alignment (the list LCS and the
+/// set/multiset buckets) would report spurious changes. When a tolerance is
+/// configured each value is instead mapped to the first representative seen
+/// so far that it compares equal to, and the representative's own hash code
+/// stands in for the value's. Keeping real hash codes preserves the hash
+/// ordering of set and multiset output. Both sides of a diff must share one
+/// classifier.
+pub(super) struct ToleranceClasses {
+    representatives: Vec<(Node, HashCode)>,
+}
+
+impl ToleranceClasses {
+    pub(super) fn new() -> Self {
+        Self { representatives: Vec::new() }
+    }
+
+    pub(super) fn hash(&mut self, node: &Node, options: &DiffOptions) -> HashCode {
+        if let Some((_, hash)) = self
+            .representatives
+            .iter()
+            .find(|(candidate, _)| candidate.eq_with_options(node, options))
+        {
+            return *hash;
+        }
+        let hash = node.hash_code(options);
+        self.representatives.push((node.clone(), hash));
+        hash
+    }
+}
+
+/// Reports whether hash codes alone can decide equality under `options`.
+///
+/// Path-scoped options, excluded keys, and comparators may loosen comparisons
+/// further down the tree, so their presence also opts into classification.
+pub(super) fn needs_classes(options: &DiffOptions) -> bool {
+    options.precision() > 0.0 || options.is_refined()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn values_within_tolerance_share_a_class() {
+        let options = DiffOptions::default().with_precision(0.05).unwrap();
+        let mut classes = ToleranceClasses::new();
+        let a = classes.hash(&Node::from_json_str("10.1").unwrap(), &options);
+        let b = classes.hash(&Node::from_json_str("10.11").unwrap(), &options);
+        let c = classes.hash(&Node::from_json_str("10.35").unwrap(), &options);
+        assert_eq!(a, b);
+        assert_ne!(a, c);
+    }
+}
@@ -0,0 +1,340 @@
+//! Line-based unified diffs of pretty-printed documents.
+//!
+//! Both documents are printed canonically (sorted keys, two-space indent,
+//! numbers as [`Number::to_json_number`](crate::Number::to_json_number)
+//! writes them) and their lines are aligned with the same longest common
+//! subsequence as list diffs. The output follows `diff -u`: a `---`/`+++`
+//! header, then hunks of changed lines surrounded by context, each under a
+//! `@@ -start,count +start,count @@` line, so patch review tools that only
+//! understand text diffs can read it.
+
+use core::fmt::Write as _;
+use core::ops::Range;
+
+use super::lcs::longest_common_subsequence;
+use super::theme::COLOR_RESET;
+use super::ColorTheme;
+use crate::hash::hash_bytes;
+use crate::prelude::*;
+use crate::{DiffOptions, Node};
+
+/// Labels, context size, and colors for [`unified_diff`].
+///
+/// ```
+/// # use jd_core::UnifiedConfig;
+/// let config = UnifiedConfig::new().with_labels("old.json", "new.json").with_context(1);
+/// assert_eq!(config.context(), 1);
+/// ```
+#[derive(Clone, Debug)]
+pub struct UnifiedConfig {
+    from: String,
+    to: String,
+    context: usize,
+    color: bool,
+    theme: ColorTheme,
+}
+
+impl Default for UnifiedConfig {
+    fn default() -> Self {
+        Self {
+            from: "a".to_string(),
+            to: "b".to_string(),
+            context: 3,
+            color: false,
+            theme: ColorTheme::Default,
+        }
+    }
+}
+
+impl UnifiedConfig {
+    /// Constructs the default configuration: labels `a` and `b`, three lines
+    /// of context, and no color.
+    ///
+    /// ```
+    /// # use jd_core::UnifiedConfig;
+    /// assert_eq!(UnifiedConfig::new().context(), 3);
+    /// ```
+    #[must_use]
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Sets the names printed on the `---` and `+++` lines.
+    ///
+    /// ```
+    /// # use jd_core::{unified_diff, Node, UnifiedConfig};
+    /// let (lhs, rhs) = (Node::from_json_str("1").unwrap(), Node::from_json_str("2").unwrap());
+    /// let config = UnifiedConfig::new().with_labels("before.json", "after.json");
+    /// assert!(unified_diff(&lhs, &rhs, &config).starts_with("--- before.json\n+++ after.json\n"));
+    /// ```
+    #[must_use]
+    pub fn with_labels(mut self, from: impl Into<String>, to: impl Into<String>) -> Self {
+        self.from = from.into();
+        self.to = to.into();
+        self
+    }
+
+    /// Sets how many unchanged lines surround each change.
+    ///
+    /// ```
+    /// # use jd_core::UnifiedConfig;
+    /// assert_eq!(UnifiedConfig::new().with_context(0).context(), 0);
+    /// ```
+    #[must_use]
+    pub fn with_context(mut self, lines: usize) -> Self {
+        self.context = lines;
+        self
+    }
+
+    /// Enables or disables ANSI color for removed and added lines.
+    ///
+    /// ```
+    /// # use jd_core::UnifiedConfig;
+    /// assert!(UnifiedConfig::new().with_color(true).color_enabled());
+    /// ```
+    #[must_use]
+    pub fn with_color(mut self, enabled: bool) -> Self {
+        self.color = enabled;
+        self
+    }
+
+    /// Selects the palette for removed and added lines.
+    ///
+    /// ```
+    /// # use jd_core::{ColorTheme, UnifiedConfig};
+    /// let config = UnifiedConfig::new().with_theme(ColorTheme::ColorblindSafe);
+    /// assert_eq!(config.theme(), ColorTheme::ColorblindSafe);
+    /// ```
+    #[must_use]
+    pub fn with_theme(mut self, theme: ColorTheme) -> Self {
+        self.theme = theme;
+        self
+    }
+
+    /// Returns the number of context lines.
+    ///
+    /// ```
+    /// # use jd_core::UnifiedConfig;
+    /// assert_eq!(UnifiedConfig::default().context(), 3);
+    /// ```
+    #[must_use]
+    pub fn context(&self) -> usize {
+        self.context
+    }
+
+    /// Indicates whether color output is enabled.
+    ///
+    /// ```
+    /// # use jd_core::UnifiedConfig;
+    /// assert!(!UnifiedConfig::default().color_enabled());
+    /// ```
+    #[must_use]
+    pub fn color_enabled(&self) -> bool {
+        self.color
+    }
+
+    /// Returns the color palette.
+    ///
+    /// ```
+    /// # use jd_core::{ColorTheme, UnifiedConfig};
+    /// assert_eq!(UnifiedConfig::default().theme(), ColorTheme::Default);
+    /// ```
+    #[must_use]
+    pub fn theme(&self) -> ColorTheme {
+        self.theme
+    }
+}
+
+/// Pretty-prints both documents and renders a unified diff of their lines.
+/// Equal documents produce an empty string, and [`Node::Void`] prints as no
+/// lines at all.
+///
+/// ```
+/// # use jd_core::{unified_diff, Node, UnifiedConfig};
+/// let lhs = Node::from_json_str(r#"{"name":"jd","tags":["a","b"]}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"name":"jd","tags":["a","c"]}"#).unwrap();
+/// let config = UnifiedConfig::new().with_context(1);
+/// assert_eq!(
+///     unified_diff(&lhs, &rhs, &config),
+///     "--- a\n+++ b\n@@ -4,3 +4,3 @@\n     \"a\",\n-    \"b\"\n+    \"c\"\n   ]\n"
+/// );
+/// ```
+#[must_use]
+pub fn unified_diff(lhs: &Node, rhs: &Node, config: &UnifiedConfig) -> String {
+    let (lhs_text, rhs_text) = (pretty(lhs), pretty(rhs));
+    let lhs_lines: Vec<&str> = lhs_text.lines().collect();
+    let rhs_lines: Vec<&str> = rhs_text.lines().collect();
+    let lines = edit_script(&lhs_lines, &rhs_lines);
+    if lines.iter().all(|line| line.kind == Kind::Same) {
+        return String::new();
+    }
+
+    let mut output = format!("--- {}\n+++ {}\n", config.from, config.to);
+    for hunk in hunks(&lines, config.context) {
+        render_hunk(&mut output, &lines[hunk], config);
+    }
+    output
+}
+
+fn pretty(node: &Node) -> String {
+    node.to_json_value()
+        .map(|value| serde_json::to_string_pretty(&value).expect("JSON values always serialize"))
+        .unwrap_or_default()
+}
+
+/// One line of the edit script.
+#[derive(Clone, Copy, Debug, PartialEq)]
+struct Line<'a> {
+    kind: Kind,
+    /// How many lines of each document come before this one.
+    lhs: usize,
+    rhs: usize,
+    text: &'a str,
+}
+
+#[derive(Clone, Copy, Debug, PartialEq)]
+enum Kind {
+    Same,
+    Removed,
+    Added,
+}
+
+/// Aligns the lines on their longest common subsequence. Between two
+/// matched lines, removals come before additions.
+fn edit_script<'a>(lhs: &[&'a str], rhs: &[&'a str]) -> Vec<Line<'a>> {
+    let lhs_hashes: Vec<_> = lhs.iter().map(|line| hash_bytes(line.as_bytes())).collect();
+    let rhs_hashes: Vec<_> = rhs.iter().map(|line| hash_bytes(line.as_bytes())).collect();
+    let common = longest_common_subsequence(
+        &lhs_hashes,
+        &rhs_hashes,
+        DiffOptions::DEFAULT_MAX_ALIGNMENT_COST,
+        None,
+    );
+    let (mut i, mut j) = (0, 0);
+    let mut lines = Vec::with_capacity(lhs.len().max(rhs.len()));
+    // A final `None` flushes the lines after the last match.
+    for common in common.into_iter().map(Some).chain([None]) {
+        while i < lhs.len() && Some(lhs_hashes[i]) != common {
+            lines.push(Line { kind: Kind::Removed, lhs: i, rhs: j, text: lhs[i] });
+            i += 1;
+        }
+        while j < rhs.len() && Some(rhs_hashes[j]) != common {
+            lines.push(Line { kind: Kind::Added, lhs: i, rhs: j, text: rhs[j] });
+            j += 1;
+        }
+        if common.is_some() {
+            lines.push(Line { kind: Kind::Same, lhs: i, rhs: j, text: lhs[i] });
+            (i, j) = (i + 1, j + 1);
+        }
+    }
+    lines
+}
+
+/// Groups changed lines with `context` lines around them, merging groups
+/// whose context would touch.
+fn hunks(lines: &[Line<'_>], context: usize) -> Vec<Range<usize>> {
+    let mut hunks: Vec<Range<usize>> = Vec::new();
+    for (index, line) in lines.iter().enumerate() {
+        if line.kind == Kind::Same {
+            continue;
+        }
+        let start = index.saturating_sub(context);
+        let end = (index + context + 1).min(lines.len());
+        match hunks.last_mut() {
+            Some(last) if start <= last.end => last.end = end,
+            _ => hunks.push(start..end),
+        }
+    }
+    hunks
+}
+
+fn render_hunk(output: &mut String, lines: &[Line<'_>], config: &UnifiedConfig) {
+    let first = lines[0];
+    let lhs_count = lines.iter().filter(|line| line.kind != Kind::Added).count();
+    let rhs_count = lines.iter().filter(|line| line.kind != Kind::Removed).count();
+    let _ =
+        writeln!(output, "@@ -{} +{} @@", range(first.lhs, lhs_count), range(first.rhs, rhs_count));
+    for line in lines {
+        let (marker, color) = match line.kind {
+            Kind::Same => (' ', None),
+            Kind::Removed => ('-', Some(config.theme.removed())),
+            Kind::Added => ('+', Some(config.theme.added())),
+        };
+        let color = color.filter(|_| config.color);
+        if let Some(color) = color {
+            output.push_str(color);
+        }
+        output.push(marker);
+        output.push_str(line.text);
+        output.push('\n');
+        if color.is_some() {
+            output.push_str(COLOR_RESET);
+        }
+    }
+}
+
+/// Formats one side of a hunk header like `diff -u`: the 1-based first line
+/// and the line count, which is left out when it is 1. A side without lines
+/// names the line before the hunk instead.
+fn range(before: usize, count: usize) -> String {
+    match count {
+        0 => format!("{before},0"),
+        1 => format!("{}", before + 1),
+        count => format!("{},{count}", before + 1),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn render(lhs: &str, rhs: &str, context: usize) -> String {
+        unified_diff(&json(lhs), &json(rhs), &UnifiedConfig::new().with_context(context))
+    }
+
+    #[test]
+    fn equal_documents_render_nothing() {
+        assert_eq!(render(r#"{"a":[1,2]}"#, r#"{"a":[1,2]}"#, 3), "");
+        assert_eq!(unified_diff(&Node::Void, &Node::Void, &UnifiedConfig::new()), "");
+    }
+
+    #[test]
+    fn distant_changes_get_separate_hunks() {
+        let lhs = "[1,2,3,4,5,6,7,8,9]";
+        let rhs = "[0,2,3,4,5,6,7,8,10]";
+        assert_eq!(
+            render(lhs, rhs, 1),
+            "--- a\n+++ b\n\
+             @@ -1,3 +1,3 @@\n [\n-  1,\n+  0,\n   2,\n\
+             @@ -9,3 +9,3 @@\n   8,\n-  9\n+  10\n ]\n"
+        );
+        // With more context the two hunks touch and merge.
+        assert_eq!(render(lhs, rhs, 4).matches("@@ -").count(), 1);
+    }
+
+    #[test]
+    fn empty_sides_name_the_line_before() {
+        assert_eq!(
+            render("[1,2]", "[1,2,3]", 0),
+            "--- a\n+++ b\n@@ -3 +3,2 @@\n-  2\n+  2,\n+  3\n"
+        );
+        let added = unified_diff(&Node::Void, &json("[1]"), &UnifiedConfig::new());
+        assert_eq!(added, "--- a\n+++ b\n@@ -0,0 +1,3 @@\n+[\n+  1\n+]\n");
+        let removed = unified_diff(&json("true"), &Node::Void, &UnifiedConfig::new());
+        assert_eq!(removed, "--- a\n+++ b\n@@ -1 +0,0 @@\n-true\n");
+    }
+
+    #[test]
+    fn color_wraps_changed_lines() {
+        let config = UnifiedConfig::new().with_color(true);
+        let rendered = unified_diff(&json("1"), &json("2"), &config);
+        assert_eq!(
+            rendered,
+            "--- a\n+++ b\n@@ -1 +1 @@\n\u{1b}[31m-1\n\u{1b}[0m\u{1b}[32m+2\n\u{1b}[0m"
+        );
+    }
+}
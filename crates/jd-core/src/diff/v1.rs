@@ -0,0 +1,273 @@
+//! Reader and writer for the native diff format of jd v1.
+//!
+//! jd v1 wrote `@` path, `-` and `+` lines as v2 does, but no `^` option
+//! headers and no context lines: a list hunk is addressed by index alone.
+//! Its paths carry the options instead, as arrays of strings ahead of the
+//! segment they apply to: `["MERGE"]` opens the path of a merge hunk, and
+//! `["set"]` or `["multiset"]` precede the `{}` that marks a set or
+//! multiset. Such hunks are valid v2 hunks without context, so a v1 diff
+//! reads into an ordinary [`Diff`] and applies like one. Writing v1 drops
+//! the context and the option headers, which only guard or narrow how a
+//! hunk applies, and refuses what v1 cannot express: moves.
+
+use serde_json::Value as JsonValue;
+
+use super::parse::{parse_value, DiffParseError};
+use super::{node_to_json, Diff, DiffElement, DiffMetadata, Path, PathSegment, RenderError};
+use crate::prelude::*;
+use crate::{gojson, Node};
+
+#[derive(Clone, Copy, PartialEq, Eq)]
+enum State {
+    Init,
+    At,
+    Remove,
+    Add,
+}
+
+impl State {
+    /// The line headers Go jd v1's `ReadDiffString` accepts in each state.
+    fn allowed(self) -> &'static str {
+        match self {
+            Self::Init => "@",
+            Self::At => "-+",
+            Self::Remove => "-+@",
+            Self::Add => "+@",
+        }
+    }
+}
+
+pub(super) fn parse_v1(input: &str) -> Result<Diff, DiffParseError> {
+    let mut elements = Vec::new();
+    let mut element: Option<DiffElement> = None;
+    let mut state = State::Init;
+
+    for (index, line) in input.lines().enumerate() {
+        let number = index + 1;
+        let Some(header) = line.chars().next() else {
+            continue;
+        };
+        if !state.allowed().contains(header) {
+            return Err(DiffParseError::new(
+                number,
+                format!("unexpected {header:?}. expecting one of {:?}", state.allowed()),
+            ));
+        }
+        let payload = line.get(1..).unwrap_or_default();
+
+        match header {
+            '@' => {
+                elements.extend(element.take());
+                let (path, merge) = read_path(payload.trim())
+                    .map_err(|err| DiffParseError::new(number, format!("invalid path: {err}")))?;
+                let mut hunk = DiffElement::new().with_path(path);
+                if merge {
+                    hunk = hunk.with_metadata(DiffMetadata::merge());
+                }
+                element = Some(hunk);
+                state = State::At;
+            }
+            '-' => {
+                let value = parse_value(payload, number)?;
+                element.as_mut().expect("path precedes values").remove.push(value);
+                state = State::Remove;
+            }
+            '+' => {
+                let value =
+                    if payload.is_empty() { Node::Void } else { parse_value(payload, number)? };
+                element.as_mut().expect("path precedes values").add.push(value);
+                state = State::Add;
+            }
+            _ => unreachable!("header validated against allowed set"),
+        }
+    }
+
+    if state == State::At {
+        return Err(DiffParseError::new(
+            input.lines().count(),
+            "hunk has no removals or additions",
+        ));
+    }
+    elements.extend(element);
+    Ok(Diff::from_elements(elements))
+}
+
+/// Reads a v1 hunk path into its segments and whether it opens with
+/// `["MERGE"]`. Metadata v1 did not recognize is skipped, as v1 skips it.
+fn read_path(payload: &str) -> Result<(Path, bool), serde_json::Error> {
+    let values: Vec<JsonValue> = serde_json::from_str(payload)?;
+    let merge = values
+        .first()
+        .and_then(JsonValue::as_array)
+        .is_some_and(|metadata| metadata.iter().any(|name| name.as_str() == Some("MERGE")));
+    let mut segments = Vec::with_capacity(values.len());
+    let mut multiset = false;
+    for value in values {
+        match value {
+            JsonValue::Array(metadata) => {
+                multiset |= metadata.iter().any(|name| name.as_str() == Some("multiset"));
+            }
+            JsonValue::Object(keys) if keys.is_empty() && multiset => {
+                segments.push(PathSegment::MultiSet);
+                multiset = false;
+            }
+            other => {
+                segments.push(serde_json::from_value(other)?);
+                multiset = false;
+            }
+        }
+    }
+    Ok((Path::from(segments), merge))
+}
+
+/// Writes `path` as v1 does, with the metadata arrays v1 reads.
+fn write_path(path: &Path, merge: bool) -> String {
+    let mut values = Vec::with_capacity(path.len() + 1);
+    if merge {
+        values.push(serde_json::json!(["MERGE"]));
+    }
+    for segment in path.segments() {
+        match segment {
+            PathSegment::Set => values.extend([serde_json::json!(["set"]), serde_json::json!({})]),
+            PathSegment::MultiSet => {
+                values.extend([serde_json::json!(["multiset"]), serde_json::json!({})]);
+            }
+            PathSegment::SetKeys(keys) => {
+                let names: Vec<&str> = keys.keys().map(String::as_str).collect();
+                values.push(serde_json::json!(["set", format!("setkeys={}", names.join(","))]));
+                values.push(serde_json::to_value(segment).expect("serialize set keys"));
+            }
+            _ => values.push(serde_json::to_value(segment).expect("serialize path segment")),
+        }
+    }
+    gojson::escape(serde_json::to_string(&values).expect("serialize path"))
+}
+
+pub(super) fn render_v1(diff: &Diff) -> Result<String, RenderError> {
+    let mut output = String::new();
+    for (index, element) in diff.iter().enumerate() {
+        let merge = element.metadata.as_ref().is_some_and(|metadata| metadata.merge);
+        if element.moved_from.is_some() {
+            return Err(RenderError::new(format!(
+                "hunk {} is a move, which jd v1 diffs cannot express",
+                index + 1
+            )));
+        }
+        output.push_str("@ ");
+        output.push_str(&write_path(&element.path, merge));
+        output.push('\n');
+        for (header, values) in [('-', &element.remove), ('+', &element.add)] {
+            for value in values {
+                match value {
+                    // A merge hunk deletes by adding nothing.
+                    Node::Void if merge && header == '+' => output.push_str("+\n"),
+                    Node::Void => {}
+                    value => {
+                        output.push(header);
+                        output.push(' ');
+                        output.push_str(&node_to_json(value));
+                        output.push('\n');
+                    }
+                }
+            }
+        }
+    }
+    Ok(output)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffMetadata, DiffOptions, PathSegment, RenderConfig};
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    #[test]
+    fn reads_hunks_without_context() {
+        let diff = parse_v1("@ [\"a\",1]\n- 2\n+ 4\n@ [\"b\"]\n+ true\n").unwrap();
+        let elements = diff.into_elements();
+        assert_eq!(elements.len(), 2);
+        assert_eq!(
+            elements[0].path,
+            Path::from(vec![PathSegment::key("a"), PathSegment::index(1)])
+        );
+        assert!(elements[0].before.is_empty() && elements[0].after.is_empty());
+        assert_eq!(elements[0].remove, vec![node("2")]);
+        assert_eq!(elements[1].add, vec![node("true")]);
+    }
+
+    #[test]
+    fn rejects_v2_only_lines() {
+        let err = parse_v1("^ \"SET\"\n@ [\"a\"]\n- 1\n").unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "invalid diff at line 1: unexpected '^'. expecting one of \"@\""
+        );
+        let err = parse_v1("@ [0]\n  1\n+ 2\n").unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "invalid diff at line 2: unexpected ' '. expecting one of \"-+\""
+        );
+        let err = parse_v1("@ [\"a\"]\n+ 1\n- 2\n").unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "invalid diff at line 3: unexpected '-'. expecting one of \"+@\""
+        );
+        let err = parse_v1("@ [\"a\"]\n").unwrap_err();
+        assert_eq!(err.to_string(), "invalid diff at line 1: hunk has no removals or additions");
+    }
+
+    #[test]
+    fn writes_diffs_without_context_or_headers() {
+        let lhs = node(r#"{"a":[1,2,3],"b":{"c":"x"}}"#);
+        let rhs = node(r#"{"a":[1,4,3,5],"b":{"c":"y"}}"#);
+        let v1 = render_v1(&lhs.diff(&rhs, &DiffOptions::default())).unwrap();
+        assert_eq!(
+            v1,
+            "@ [\"a\",1]\n- 2\n+ 4\n@ [\"a\",3]\n+ 5\n@ [\"b\",\"c\"]\n- \"x\"\n+ \"y\"\n"
+        );
+        assert_eq!(lhs.apply_patch(&parse_v1(&v1).unwrap()).unwrap(), rhs);
+
+        let headed = Diff::from_native_str("^ {\"precision\":0.5}\n@ [1]\n  1\n- 2\n]\n").unwrap();
+        assert_eq!(render_v1(&headed).unwrap(), "@ [1]\n- 2\n");
+    }
+
+    #[test]
+    fn v1_diffs_translate_to_v2() {
+        let diff = parse_v1("@ [\"tags\",{}]\n- \"old\"\n+ \"new\"\n").unwrap();
+        let v2 = diff.render(&RenderConfig::default());
+        assert_eq!(v2, "@ [\"tags\",{}]\n- \"old\"\n+ \"new\"\n");
+        assert_eq!(Diff::from_native_str(&v2).unwrap(), diff);
+    }
+
+    #[test]
+    fn reads_and_writes_path_metadata() {
+        let v1 = concat!(
+            "@ [\"tags\",[\"set\"],{}]\n- \"a\"\n",
+            "@ [\"bag\",[\"multiset\"],{}]\n+ 1\n",
+            "@ [\"users\",[\"set\",\"setkeys=id\"],{\"id\":1},\"role\"]\n- \"user\"\n",
+            "@ [[\"MERGE\"],\"a\"]\n+\n",
+        );
+        let elements = parse_v1(v1).unwrap().into_elements();
+        assert_eq!(elements[0].path, Path::from(vec![PathSegment::key("tags"), PathSegment::Set]));
+        assert_eq!(
+            elements[1].path,
+            Path::from(vec![PathSegment::key("bag"), PathSegment::MultiSet])
+        );
+        assert_eq!(elements[2].path.to_string(), "[users {\"id\":1} role]");
+        assert_eq!(elements[3].metadata, Some(DiffMetadata::merge()));
+        assert_eq!(elements[3].add, vec![Node::Void]);
+        assert_eq!(render_v1(&Diff::from_elements(elements)).unwrap(), v1);
+    }
+
+    #[test]
+    fn refuses_moves() {
+        let moved = Diff::from_native_str("^ {\"from\":[0]}\n@ [2]\n+ 1\n").unwrap();
+        assert_eq!(
+            render_v1(&moved).unwrap_err().to_string(),
+            "hunk 1 is a move, which jd v1 diffs cannot express"
+        );
+    }
+}
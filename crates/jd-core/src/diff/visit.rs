@@ -0,0 +1,281 @@
+//! Typed, per-value views of diff hunks for consumers that analyze or
+//! transform diffs.
+
+use super::{is_void, Diff, DiffElement, Path, PathSegment};
+use crate::prelude::*;
+use crate::Node;
+
+/// One value-level change, as reported by [`Diff::changes`].
+///
+/// ```
+/// # use jd_core::{Change, DiffOptions, Node};
+/// let lhs = Node::from_json_str(r#"{"a":1}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"a":2}"#).unwrap();
+/// let diff = lhs.diff(&rhs, &DiffOptions::default());
+/// let change = diff.changes().next().unwrap();
+/// assert!(matches!(change, Change::Replace { .. }));
+/// assert_eq!(change.path().to_string(), "[a]");
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub enum Change<'a> {
+    /// A value appears at the path.
+    Add {
+        /// Where the value is added.
+        path: Path,
+        /// The added value.
+        value: &'a Node,
+    },
+    /// A value disappears from the path. Merge diffs do not record the
+    /// deleted value, so their deletions report [`Node::Void`].
+    Remove {
+        /// Where the value is removed.
+        path: Path,
+        /// The removed value.
+        value: &'a Node,
+    },
+    /// The value at the path changes.
+    Replace {
+        /// Where the value changes.
+        path: Path,
+        /// The value before the change.
+        old: &'a Node,
+        /// The value after the change.
+        new: &'a Node,
+    },
+}
+
+impl Change<'_> {
+    /// Returns the path the change applies to.
+    ///
+    /// ```
+    /// # use jd_core::{Change, Node, Path};
+    /// let change = Change::Add { path: Path::new(), value: &Node::Null };
+    /// assert!(change.path().is_empty());
+    /// ```
+    #[must_use]
+    pub fn path(&self) -> &Path {
+        match self {
+            Self::Add { path, .. } | Self::Remove { path, .. } | Self::Replace { path, .. } => path,
+        }
+    }
+}
+
+/// Callbacks for [`Diff::visit`]. Every method does nothing by default, so
+/// visitors implement only the changes they care about.
+///
+/// ```
+/// # use jd_core::{DiffOptions, DiffVisitor, Node, Path};
+/// #[derive(Default)]
+/// struct Removed(Vec<String>);
+///
+/// impl DiffVisitor for Removed {
+///     fn on_remove(&mut self, path: &Path, _value: &Node) {
+///         self.0.push(path.to_string());
+///     }
+/// }
+///
+/// let lhs = Node::from_json_str(r#"{"a":1,"b":2,"c":3}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"b":4}"#).unwrap();
+/// let mut removed = Removed::default();
+/// lhs.diff(&rhs, &DiffOptions::default()).visit(&mut removed);
+/// assert_eq!(removed.0, ["[a]", "[c]"]);
+/// ```
+pub trait DiffVisitor {
+    /// Called for each value a diff adds.
+    fn on_add(&mut self, path: &Path, value: &Node) {
+        let _ = (path, value);
+    }
+
+    /// Called for each value a diff removes.
+    fn on_remove(&mut self, path: &Path, value: &Node) {
+        let _ = (path, value);
+    }
+
+    /// Called for each value a diff replaces.
+    fn on_replace(&mut self, path: &Path, old: &Node, new: &Node) {
+        let _ = (path, old, new);
+    }
+}
+
+impl DiffElement {
+    /// Breaks the hunk into value-level changes.
+    ///
+    /// Removed and added values at the same position pair up as
+    /// replacements, except in sets and multisets, whose members have no
+    /// position. In a list hunk the n-th value is reported n positions past
+    /// the hunk's index, counting in the list as the hunk finds it for
+    /// removals and as it leaves it for additions. A move is a removal at
+    /// its origin and an addition at its destination.
+    ///
+    /// ```
+    /// # use jd_core::{Change, DiffOptions, Node};
+    /// let lhs = Node::from_json_str("[1,2,3]").unwrap();
+    /// let rhs = Node::from_json_str("[1,4]").unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default());
+    /// let paths: Vec<String> =
+    ///     diff.iter().flat_map(|hunk| hunk.changes()).map(|change| change.path().to_string()).collect();
+    /// assert_eq!(paths, ["[1]", "[2]"]);
+    /// ```
+    #[must_use]
+    pub fn changes(&self) -> Vec<Change<'_>> {
+        if let Some(from) = &self.moved_from {
+            return self
+                .add
+                .iter()
+                .flat_map(|value| {
+                    [
+                        Change::Remove { path: from.clone(), value },
+                        Change::Add { path: self.path.clone(), value },
+                    ]
+                })
+                .collect();
+        }
+        let unordered =
+            matches!(self.path.segments().last(), Some(PathSegment::Set | PathSegment::MultiSet));
+        let paired = if unordered { 0 } else { self.remove.len().min(self.add.len()) };
+        let mut changes = Vec::new();
+        for (offset, (old, new)) in self.remove.iter().zip(&self.add).take(paired).enumerate() {
+            let path = self.value_path(offset);
+            changes.push(if is_void(new) {
+                Change::Remove { path, value: old }
+            } else {
+                Change::Replace { path, old, new }
+            });
+        }
+        for (offset, value) in self.remove.iter().enumerate().skip(paired) {
+            changes.push(Change::Remove { path: self.value_path(offset), value });
+        }
+        for (offset, value) in self.add.iter().enumerate().skip(paired) {
+            let path = self.value_path(offset);
+            changes.push(if is_void(value) {
+                Change::Remove { path, value }
+            } else {
+                Change::Add { path, value }
+            });
+        }
+        changes
+    }
+
+    /// Returns the path of the value `offset` places into a list hunk, or
+    /// the hunk path for any other hunk.
+    fn value_path(&self, offset: usize) -> Path {
+        match self.path.segments().split_last() {
+            Some((PathSegment::Index(index), parent)) if *index >= 0 && offset > 0 => {
+                let index = index.saturating_add(i64::try_from(offset).unwrap_or(i64::MAX));
+                Path::from(parent.to_vec()).with_segment(PathSegment::Index(index))
+            }
+            _ => self.path.clone(),
+        }
+    }
+}
+
+impl Diff {
+    /// Iterates over the value-level changes of every hunk, in diff order.
+    /// See [`DiffElement::changes`].
+    ///
+    /// ```
+    /// # use jd_core::{Change, DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"a":1}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"b":1}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default());
+    /// let kinds: Vec<&str> = diff
+    ///     .changes()
+    ///     .map(|change| match change {
+    ///         Change::Add { .. } => "add",
+    ///         Change::Remove { .. } => "remove",
+    ///         Change::Replace { .. } => "replace",
+    ///     })
+    ///     .collect();
+    /// assert_eq!(kinds, ["remove", "add"]);
+    /// ```
+    pub fn changes(&self) -> impl Iterator<Item = Change<'_>> + '_ {
+        self.iter().flat_map(DiffElement::changes)
+    }
+
+    /// Passes every change to the matching [`DiffVisitor`] callback, in diff
+    /// order.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, DiffVisitor, Node, Path};
+    /// struct Count(usize);
+    ///
+    /// impl DiffVisitor for Count {
+    ///     fn on_replace(&mut self, _path: &Path, _old: &Node, _new: &Node) {
+    ///         self.0 += 1;
+    ///     }
+    /// }
+    ///
+    /// let lhs = Node::from_json_str("[1,2]").unwrap();
+    /// let rhs = Node::from_json_str("[3,4]").unwrap();
+    /// let mut count = Count(0);
+    /// lhs.diff(&rhs, &DiffOptions::default()).visit(&mut count);
+    /// assert_eq!(count.0, 2);
+    /// ```
+    pub fn visit<V>(&self, visitor: &mut V)
+    where
+        V: DiffVisitor + ?Sized,
+    {
+        for change in self.changes() {
+            match change {
+                Change::Add { path, value } => visitor.on_add(&path, value),
+                Change::Remove { path, value } => visitor.on_remove(&path, value),
+                Change::Replace { path, old, new } => visitor.on_replace(&path, old, new),
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{ArrayMode, DiffMetadata, DiffOptions};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn summary(diff: &Diff) -> Vec<String> {
+        diff.changes()
+            .map(|change| match change {
+                Change::Add { path, value } => format!("+ {path} {value:?}"),
+                Change::Remove { path, value } => format!("- {path} {value:?}"),
+                Change::Replace { path, old, new } => format!("~ {path} {old:?} {new:?}"),
+            })
+            .collect()
+    }
+
+    #[test]
+    fn list_hunks_pair_values_by_position() {
+        let diff = json("[0,1,2,3]").diff(&json("[0,7,8,9,3]"), &DiffOptions::default());
+        let paths: Vec<String> = diff.changes().map(|change| change.path().to_string()).collect();
+        assert_eq!(paths, ["[1]", "[2]", "[3]"]);
+        assert!(matches!(diff.changes().nth(2), Some(Change::Add { .. })));
+    }
+
+    #[test]
+    fn set_members_are_never_paired() {
+        let options = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+        let diff = json("[1,2]").diff(&json("[1,3]"), &options);
+        let kinds: Vec<bool> =
+            diff.changes().map(|change| matches!(change, Change::Remove { .. })).collect();
+        assert_eq!(kinds, [true, false]);
+    }
+
+    #[test]
+    fn moves_split_into_a_removal_and_an_addition() {
+        let options = DiffOptions::default().with_move_detection(true);
+        let diff = json("[1,2,3,4,5]").diff(&json("[5,1,2,3,4]"), &options);
+        let paths: Vec<String> = diff.changes().map(|change| change.path().to_string()).collect();
+        assert_eq!(paths, ["[4]", "[0]"]);
+    }
+
+    #[test]
+    fn merge_deletions_are_removals() {
+        let element = DiffElement::new()
+            .with_metadata(DiffMetadata::merge())
+            .with_path(PathSegment::key("gone"))
+            .with_add(vec![Node::Void]);
+        let diff = Diff::from_elements(vec![element]);
+        assert_eq!(summary(&diff), ["- [gone] Void"]);
+    }
+}
@@ -0,0 +1,293 @@
+//! JSON and YAML readers that apply a [`DuplicateKeys`] policy.
+//!
+//! `serde_json::Value` keeps the last value of a repeated key and
+//! `serde_yaml::Value` rejects the whole document, so neither can be used as
+//! is. The seeds here build the same values while deciding every repeated
+//! key themselves. Errors carry the parser's position of the repeated key.
+
+use core::fmt;
+
+#[cfg(feature = "yaml")]
+use serde::de::{value::EnumAccessDeserializer, EnumAccess};
+use serde::de::{DeserializeSeed, Deserializer, Error, IgnoredAny, MapAccess, SeqAccess, Visitor};
+#[cfg(feature = "yaml")]
+use serde::Deserialize;
+use serde_json::Value as JsonValue;
+#[cfg(feature = "yaml")]
+use serde_yaml::{Mapping, Value as YamlValue};
+
+use crate::order::JSON_NUMBER_TOKEN;
+use crate::prelude::*;
+use crate::DuplicateKeys;
+
+/// Parses one JSON document, resolving repeated keys with `policy`.
+pub(crate) fn json_value(
+    input: &str,
+    policy: DuplicateKeys,
+) -> Result<JsonValue, serde_json::Error> {
+    json_value_from(serde_json::Deserializer::from_str(input), policy)
+}
+
+/// Parses one JSON document from `reader`, resolving repeated keys with
+/// `policy`.
+#[cfg(feature = "std")]
+pub(crate) fn json_value_from_reader(
+    reader: impl std::io::Read,
+    policy: DuplicateKeys,
+) -> Result<JsonValue, serde_json::Error> {
+    json_value_from(serde_json::Deserializer::from_reader(reader), policy)
+}
+
+fn json_value_from<'de, R: serde_json::de::Read<'de>>(
+    mut deserializer: serde_json::Deserializer<R>,
+    policy: DuplicateKeys,
+) -> Result<JsonValue, serde_json::Error> {
+    let value = Json(policy).deserialize(&mut deserializer)?;
+    deserializer.end()?;
+    Ok(value)
+}
+
+#[cfg(feature = "yaml")]
+/// Parses one YAML document, resolving repeated keys with `policy`.
+pub(crate) fn yaml_value(
+    input: &str,
+    policy: DuplicateKeys,
+) -> Result<YamlValue, serde_yaml::Error> {
+    Yaml(policy).deserialize(serde_yaml::Deserializer::from_str(input))
+}
+
+#[cfg(feature = "yaml")]
+/// Parses every document of a `---`-separated YAML stream, resolving
+/// repeated keys with `policy`.
+pub(crate) fn yaml_values(
+    input: &str,
+    policy: DuplicateKeys,
+) -> Result<Vec<YamlValue>, serde_yaml::Error> {
+    serde_yaml::Deserializer::from_str(input)
+        .map(|document| Yaml(policy).deserialize(document))
+        .collect()
+}
+
+/// What to do with the value of a key the object already holds.
+enum Repeat {
+    Keep,
+    Skip,
+}
+
+impl DuplicateKeys {
+    fn repeat<E: Error>(self, key: &dyn fmt::Display) -> Result<Repeat, E> {
+        match self {
+            Self::LastWins => Ok(Repeat::Keep),
+            Self::FirstWins => Ok(Repeat::Skip),
+            Self::Error => Err(E::custom(format_args!("duplicate key {key}"))),
+        }
+    }
+}
+
+#[derive(Clone, Copy)]
+struct Json(DuplicateKeys);
+
+impl<'de> DeserializeSeed<'de> for Json {
+    type Value = JsonValue;
+
+    fn deserialize<D: Deserializer<'de>>(self, deserializer: D) -> Result<JsonValue, D::Error> {
+        deserializer.deserialize_any(self)
+    }
+}
+
+impl<'de> Visitor<'de> for Json {
+    type Value = JsonValue;
+
+    fn expecting(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str("any valid JSON value")
+    }
+
+    fn visit_bool<E>(self, value: bool) -> Result<JsonValue, E> {
+        Ok(JsonValue::Bool(value))
+    }
+
+    fn visit_i64<E>(self, value: i64) -> Result<JsonValue, E> {
+        Ok(JsonValue::from(value))
+    }
+
+    fn visit_u64<E>(self, value: u64) -> Result<JsonValue, E> {
+        Ok(JsonValue::from(value))
+    }
+
+    fn visit_f64<E>(self, value: f64) -> Result<JsonValue, E> {
+        Ok(JsonValue::from(value))
+    }
+
+    fn visit_str<E>(self, value: &str) -> Result<JsonValue, E> {
+        Ok(JsonValue::String(value.to_owned()))
+    }
+
+    fn visit_string<E>(self, value: String) -> Result<JsonValue, E> {
+        Ok(JsonValue::String(value))
+    }
+
+    fn visit_unit<E>(self) -> Result<JsonValue, E> {
+        Ok(JsonValue::Null)
+    }
+
+    fn visit_seq<A: SeqAccess<'de>>(self, mut seq: A) -> Result<JsonValue, A::Error> {
+        let mut items = Vec::new();
+        while let Some(item) = seq.next_element_seed(self)? {
+            items.push(item);
+        }
+        Ok(JsonValue::Array(items))
+    }
+
+    fn visit_map<A: MapAccess<'de>>(self, mut map: A) -> Result<JsonValue, A::Error> {
+        let mut object = serde_json::Map::new();
+        while let Some(key) = map.next_key::<String>()? {
+            if key == JSON_NUMBER_TOKEN && object.is_empty() {
+                let literal: String = map.next_value()?;
+                return literal.parse().map(JsonValue::Number).map_err(A::Error::custom);
+            }
+            if object.contains_key(&key) {
+                if let Repeat::Skip = self.0.repeat(&format_args!("{key:?}"))? {
+                    map.next_value::<IgnoredAny>()?;
+                    continue;
+                }
+            }
+            let value = map.next_value_seed(self)?;
+            object.insert(key, value);
+        }
+        Ok(JsonValue::Object(object))
+    }
+}
+
+#[cfg(feature = "yaml")]
+#[derive(Clone, Copy)]
+struct Yaml(DuplicateKeys);
+
+#[cfg(feature = "yaml")]
+impl<'de> DeserializeSeed<'de> for Yaml {
+    type Value = YamlValue;
+
+    fn deserialize<D: Deserializer<'de>>(self, deserializer: D) -> Result<YamlValue, D::Error> {
+        deserializer.deserialize_any(self)
+    }
+}
+
+#[cfg(feature = "yaml")]
+impl<'de> Visitor<'de> for Yaml {
+    type Value = YamlValue;
+
+    fn expecting(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str("any YAML value")
+    }
+
+    fn visit_bool<E>(self, value: bool) -> Result<YamlValue, E> {
+        Ok(YamlValue::Bool(value))
+    }
+
+    fn visit_i64<E>(self, value: i64) -> Result<YamlValue, E> {
+        Ok(YamlValue::Number(value.into()))
+    }
+
+    fn visit_u64<E>(self, value: u64) -> Result<YamlValue, E> {
+        Ok(YamlValue::Number(value.into()))
+    }
+
+    // Integers past 64 bits end up as doubles in a `Node` anyway.
+    fn visit_i128<E>(self, value: i128) -> Result<YamlValue, E> {
+        Ok(YamlValue::Number((value as f64).into()))
+    }
+
+    fn visit_u128<E>(self, value: u128) -> Result<YamlValue, E> {
+        Ok(YamlValue::Number((value as f64).into()))
+    }
+
+    fn visit_f64<E>(self, value: f64) -> Result<YamlValue, E> {
+        Ok(YamlValue::Number(value.into()))
+    }
+
+    fn visit_str<E>(self, value: &str) -> Result<YamlValue, E> {
+        Ok(YamlValue::String(value.to_owned()))
+    }
+
+    fn visit_string<E>(self, value: String) -> Result<YamlValue, E> {
+        Ok(YamlValue::String(value))
+    }
+
+    fn visit_unit<E>(self) -> Result<YamlValue, E> {
+        Ok(YamlValue::Null)
+    }
+
+    fn visit_none<E>(self) -> Result<YamlValue, E> {
+        Ok(YamlValue::Null)
+    }
+
+    fn visit_some<D: Deserializer<'de>>(self, deserializer: D) -> Result<YamlValue, D::Error> {
+        self.deserialize(deserializer)
+    }
+
+    fn visit_seq<A: SeqAccess<'de>>(self, mut seq: A) -> Result<YamlValue, A::Error> {
+        let mut items = Vec::new();
+        while let Some(item) = seq.next_element_seed(self)? {
+            items.push(item);
+        }
+        Ok(YamlValue::Sequence(items))
+    }
+
+    fn visit_map<A: MapAccess<'de>>(self, mut map: A) -> Result<YamlValue, A::Error> {
+        let mut mapping = Mapping::new();
+        while let Some(key) = map.next_key::<YamlValue>()? {
+            if mapping.contains_key(&key) {
+                let shown = serde_yaml::to_string(&key).map_err(A::Error::custom)?;
+                if let Repeat::Skip = self.0.repeat(&shown.trim_end())? {
+                    map.next_value::<IgnoredAny>()?;
+                    continue;
+                }
+            }
+            let value = map.next_value_seed(self)?;
+            mapping.insert(key, value);
+        }
+        Ok(YamlValue::Mapping(mapping))
+    }
+
+    /// Tagged values are left to `serde_yaml`; `Node` rejects them anyway.
+    fn visit_enum<A: EnumAccess<'de>>(self, data: A) -> Result<YamlValue, A::Error> {
+        YamlValue::deserialize(EnumAccessDeserializer::new(data))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn json_policies_resolve_repeated_keys() {
+        let input = r#"{"a":1,"b":{"c":2,"c":3},"a":[4]}"#;
+        let last = json_value(input, DuplicateKeys::LastWins).unwrap();
+        assert_eq!(last, serde_json::json!({"a":[4],"b":{"c":3}}));
+        assert_eq!(last, serde_json::from_str::<JsonValue>(input).unwrap());
+        let first = json_value(input, DuplicateKeys::FirstWins).unwrap();
+        assert_eq!(first, serde_json::json!({"a":1,"b":{"c":2}}));
+        let err = json_value(input, DuplicateKeys::Error).unwrap_err();
+        assert!(err.to_string().starts_with("duplicate key \"c\""), "{err}");
+    }
+
+    #[test]
+    fn json_numbers_keep_their_literals() {
+        let input = r#"[12345678901234567890123,-0.0,1.5e3]"#;
+        let value = json_value(input, DuplicateKeys::FirstWins).unwrap();
+        assert_eq!(value, serde_json::from_str::<JsonValue>(input).unwrap());
+        assert_eq!(value.to_string(), "[12345678901234567890123,-0.0,1.5e3]");
+        assert!(json_value("[1] 2", DuplicateKeys::FirstWins).is_err());
+    }
+
+    #[cfg(feature = "yaml")]
+    #[test]
+    fn yaml_policies_resolve_repeated_keys() {
+        let input = "a: 1\nb:\n  c: 2\n  c: 3\na: 4\n";
+        let last = yaml_value(input, DuplicateKeys::LastWins).unwrap();
+        assert_eq!(last, serde_yaml::from_str::<YamlValue>("a: 4\nb:\n  c: 3\n").unwrap());
+        let first = yaml_value(input, DuplicateKeys::FirstWins).unwrap();
+        assert_eq!(first, serde_yaml::from_str::<YamlValue>("a: 1\nb:\n  c: 2\n").unwrap());
+        let err = yaml_value(input, DuplicateKeys::Error).unwrap_err();
+        assert!(err.to_string().starts_with("duplicate key c"), "{err}");
+    }
+}
@@ -1,5 +1,7 @@
 use thiserror::Error;
 
+use crate::prelude::*;
+
 /// Errors that can occur while canonicalizing external data into [`Node`](crate::Node).
 ///
 /// ```
@@ -13,6 +15,7 @@ pub enum CanonicalizeError {
     #[error("invalid JSON: {0}")]
     Json(#[from] serde_json::Error),
     /// The provided YAML input was invalid.
+    #[cfg(feature = "yaml")]
     #[error("invalid YAML: {0}")]
     Yaml(#[from] serde_yaml::Error),
     /// Encountered a number that cannot be represented as an IEEE-754 f64.
@@ -34,6 +37,23 @@ pub enum CanonicalizeError {
         /// The tag identifier encountered in the document.
         tag: String,
     },
+    /// An input file could not be read.
+    #[cfg(feature = "std")]
+    #[error("failed to read {path}: {source}")]
+    Io {
+        /// The path that failed to read.
+        path: String,
+        /// The underlying I/O error.
+        source: std::io::Error,
+    },
+    /// A binary document, such as CBOR or MessagePack, could not be decoded.
+    #[error("invalid {format}: {message}")]
+    Decode {
+        /// The name of the binary format.
+        format: &'static str,
+        /// What the decoder rejected.
+        message: String,
+    },
     /// Attempted to construct a [`Number`](crate::Number) that is not finite.
     #[error("non-finite number encountered: {value}")]
     NotFinite {
@@ -63,4 +83,108 @@ pub enum OptionsError {
     /// Set keys must be non-empty strings.
     #[error("set keys must be non-empty strings")]
     EmptySetKey,
+    /// An excluded-key pattern is not a valid regular expression.
+    #[error("invalid key pattern {pattern:?}: {message}")]
+    InvalidKeyPattern {
+        /// The rejected pattern.
+        pattern: String,
+        /// The regex parser error.
+        message: String,
+    },
+    /// A similarity threshold lies outside `(0, 1]`.
+    #[error("similarity threshold must be greater than 0 and at most 1, got {threshold}")]
+    InvalidSimilarityThreshold {
+        /// The rejected threshold, as written.
+        threshold: String,
+    },
+    /// An option could not be parsed from its JSON representation.
+    #[error("invalid option: {message}")]
+    InvalidOption {
+        /// The offending option or parser error.
+        message: String,
+    },
+}
+
+/// Errors converting between [`Path`](crate::Path) and RFC 6901 JSON Pointers.
+///
+/// ```
+/// # use jd_core::{Path, PointerError};
+/// let err = Path::from_json_pointer("a").unwrap_err();
+/// assert_eq!(err, PointerError::Invalid { pointer: "a".to_string() });
+/// ```
+#[derive(Debug, Error, PartialEq, Eq)]
+pub enum PointerError {
+    /// The pointer neither is empty nor starts with `/`, or has a `~` that
+    /// is not followed by `0` or `1`.
+    #[error("invalid JSON Pointer {pointer:?}")]
+    Invalid {
+        /// The rejected pointer.
+        pointer: String,
+    },
+    /// The path has a set or multiset segment, which names no single
+    /// location in a JSON document.
+    #[error("JSON Pointer does not support jd path element {segment}")]
+    UnsupportedSegment {
+        /// The segment as the native format writes it.
+        segment: String,
+    },
+}
+
+/// Errors parsing a [`JsonPath`](crate::JsonPath) expression.
+///
+/// ```
+/// # use jd_core::{JsonPath, QueryError};
+/// let err = JsonPath::parse("$[x]").unwrap_err();
+/// assert_eq!(err.to_string(), "invalid path \"$[x]\": expected an index or quoted key");
+/// assert!(matches!(err, QueryError::Syntax { .. }));
+/// ```
+#[derive(Debug, Error, PartialEq, Eq)]
+pub enum QueryError {
+    /// The expression does not follow the supported JSONPath syntax.
+    #[error("invalid path {expression:?}: {reason}")]
+    Syntax {
+        /// The rejected expression.
+        expression: String,
+        /// What the parser expected.
+        reason: &'static str,
+    },
+}
+
+/// Errors storing a value with [`Node::set`](crate::Node::set).
+///
+/// ```
+/// # use jd_core::{Node, Path, PathError, PathSegment};
+/// let mut doc = Node::from_json_str("[1]").unwrap();
+/// let err = doc.set(&Path::from(PathSegment::index(3)), Node::Null).unwrap_err();
+/// assert_eq!(err, PathError::IndexOutOfRange { path: "[]".to_string(), index: 3, len: 1 });
+/// ```
+#[derive(Debug, Error, PartialEq, Eq)]
+pub enum PathError {
+    /// A segment does not fit the value it descends into, such as a key
+    /// segment on a list or any segment on a scalar.
+    #[error("found {found} at {path}: expected {expected}")]
+    Mismatch {
+        /// Path of the value, as a JSON array.
+        path: String,
+        /// The kind of value found, such as `a string`.
+        found: &'static str,
+        /// The kind of value the segment needs.
+        expected: &'static str,
+    },
+    /// An index lies past the end of a list by more than one.
+    #[error("index {index} is out of range for the list of length {len} at {path}")]
+    IndexOutOfRange {
+        /// Path of the list, as a JSON array.
+        path: String,
+        /// The rejected index.
+        index: i64,
+        /// The length of the list.
+        len: usize,
+    },
+    /// The path has a set or multiset segment.
+    #[error("jd path element {segment} does not name a single value")]
+    UnsupportedSegment {
+        /// The segment as the native format writes it.
+        segment: String,
+    },
 }
@@ -0,0 +1,105 @@
+//! Where Go's `encoding/json` and `serde_json` disagree about strings.
+//!
+//! Go reads a `\u` escape naming half of a surrogate pair without its other
+//! half as U+FFFD, where `serde_json` rejects the document;
+//! [`replace_lone_surrogates`] rewrites such escapes before parsing. Go also writes `<`, `>`, `&`,
+//! U+2028, and U+2029 as `\u` escapes, which [`escape`] applies to the JSON
+//! text `serde_json` writes.
+
+use crate::prelude::*;
+
+/// Returns `input` with every `\u` escape of an unpaired surrogate inside a
+/// string replaced by `\ufffd`, or `None` if there is none. The two escapes
+/// have the same length, so parse errors keep their positions.
+pub(crate) fn replace_lone_surrogates(input: &str) -> Option<String> {
+    if !input.contains("\\u") {
+        return None;
+    }
+    let bytes = input.as_bytes();
+    let mut out: Option<Vec<u8>> = None;
+    let mut in_string = false;
+    let mut index = 0;
+    while index < bytes.len() {
+        match bytes[index] {
+            b'"' => in_string = !in_string,
+            b'\\' if in_string => {
+                match surrogate_at(bytes, index) {
+                    Some(0xD800..=0xDBFF)
+                        if matches!(surrogate_at(bytes, index + 6), Some(0xDC00..=0xDFFF)) =>
+                    {
+                        index += 12;
+                    }
+                    Some(_) => {
+                        out.get_or_insert_with(|| bytes.to_vec())[index..index + 6]
+                            .copy_from_slice(b"\\ufffd");
+                        index += 6;
+                    }
+                    None => index += 2,
+                }
+                continue;
+            }
+            _ => {}
+        }
+        index += 1;
+    }
+    out.map(|out| String::from_utf8(out).expect("only ASCII bytes are replaced"))
+}
+
+/// Reads the surrogate a `\uXXXX` escape at `index` names, if it names one.
+fn surrogate_at(bytes: &[u8], index: usize) -> Option<u16> {
+    let escape = bytes.get(index..index + 6)?;
+    if escape[..2] != *b"\\u" {
+        return None;
+    }
+    let hex = core::str::from_utf8(&escape[2..]).ok()?;
+    u16::from_str_radix(hex, 16).ok().filter(|unit| (0xD800..=0xDFFF).contains(unit))
+}
+
+/// Escapes the characters Go writes as `\u` escapes in JSON text written
+/// by `serde_json`. None of them can appear outside a string literal, so
+/// only strings change.
+pub(crate) fn escape(json: String) -> String {
+    if !json.contains(['<', '>', '&', '\u{2028}', '\u{2029}']) {
+        return json;
+    }
+    let mut escaped = String::with_capacity(json.len() + 16);
+    for c in json.chars() {
+        match c {
+            '<' => escaped.push_str("\\u003c"),
+            '>' => escaped.push_str("\\u003e"),
+            '&' => escaped.push_str("\\u0026"),
+            '\u{2028}' => escaped.push_str("\\u2028"),
+            '\u{2029}' => escaped.push_str("\\u2029"),
+            c => escaped.push(c),
+        }
+    }
+    escaped
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn lone_surrogates_become_replacement_characters() {
+        let input = r#"{"\ud800":"\udc00x😀","k":"\\ud800"}"#;
+        let replaced = replace_lone_surrogates(input).unwrap();
+        assert_eq!(replaced, r#"{"\ufffd":"\ufffdx😀","k":"\\ud800"}"#);
+        let value: serde_json::Value = serde_json::from_str(&replaced).unwrap();
+        assert_eq!(value, serde_json::json!({"\u{fffd}": "\u{fffd}x😀", "k": "\\ud800"}));
+    }
+
+    #[test]
+    fn only_unpaired_surrogates_change() {
+        assert_eq!(replace_lone_surrogates(r#"["😀","é"]"#), None);
+        assert_eq!(replace_lone_surrogates("[1]"), None);
+        assert_eq!(replace_lone_surrogates(r#"["\ud83d😀"]"#).unwrap(), r#"["\ufffd😀"]"#);
+    }
+
+    #[test]
+    fn escapes_what_go_escapes() {
+        let json = serde_json::to_string("<a&b>\u{2028}\u{2029}é").unwrap();
+        assert_eq!(escape(json), r#""\u003ca\u0026b\u003e\u2028\u2029é""#);
+        assert_eq!(escape("[1]".to_string()), "[1]");
+    }
+}
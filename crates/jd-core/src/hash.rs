@@ -1,3 +1,5 @@
+use crate::prelude::*;
+
 /// Type alias representing the 64-bit hash code used throughout the diff engine.
 ///
 /// ```
@@ -0,0 +1,105 @@
+//! Comment and trailing comma removal for JSONC input.
+//!
+//! JSON with comments, as used by `tsconfig.json` and VS Code settings,
+//! allows `//` line comments, `/* */` block comments, and a comma after the
+//! last member of an object or array. [`strip`] blanks all three out with
+//! spaces and keeps every newline, so parse errors in the remaining JSON
+//! still point at the right line.
+
+use crate::prelude::*;
+
+/// Returns `input` with comments and trailing commas replaced by spaces.
+/// An unterminated block comment is left in place for the parser to reject.
+pub(crate) fn strip(input: &str) -> String {
+    let bytes = input.as_bytes();
+    let mut out = bytes.to_vec();
+    let mut trailing_comma = None;
+    let mut index = 0;
+    while index < bytes.len() {
+        match (bytes[index], bytes.get(index + 1)) {
+            (b'"', _) => {
+                trailing_comma = None;
+                index += 1;
+                while index < bytes.len() {
+                    match bytes[index] {
+                        b'\\' => index += 2,
+                        b'"' => {
+                            index += 1;
+                            break;
+                        }
+                        _ => index += 1,
+                    }
+                }
+            }
+            (b'/', Some(b'/')) => {
+                let end = bytes[index..]
+                    .iter()
+                    .position(|&b| b == b'\n')
+                    .map_or(bytes.len(), |n| index + n);
+                blank(&mut out[index..end]);
+                index = end;
+            }
+            (b'/', Some(b'*')) => {
+                let Some(length) = input[index + 2..].find("*/") else {
+                    break;
+                };
+                let end = index + 2 + length + 2;
+                blank(&mut out[index..end]);
+                index = end;
+            }
+            (b',', _) => {
+                trailing_comma = Some(index);
+                index += 1;
+            }
+            (b'}' | b']', _) => {
+                if let Some(comma) = trailing_comma.take() {
+                    out[comma] = b' ';
+                }
+                index += 1;
+            }
+            (byte, _) => {
+                if !byte.is_ascii_whitespace() {
+                    trailing_comma = None;
+                }
+                index += 1;
+            }
+        }
+    }
+    String::from_utf8(out).expect("only ASCII bytes are replaced")
+}
+
+/// Overwrites a comment with spaces, keeping its line breaks.
+fn blank(comment: &mut [u8]) {
+    for byte in comment.iter_mut().filter(|byte| !matches!(byte, b'\n' | b'\r')) {
+        *byte = b' ';
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn strips_comments_and_trailing_commas() {
+        let input =
+            "{\n  // compiler options\n  \"a\": [1, 2,], /* inline */\n  \"b\": \"//kept/*\",\n}";
+        let stripped = strip(input);
+        assert_eq!(stripped.lines().count(), input.lines().count());
+        let value: serde_json::Value = serde_json::from_str(&stripped).unwrap();
+        assert_eq!(value, serde_json::json!({"a": [1, 2], "b": "//kept/*"}));
+    }
+
+    #[test]
+    fn keeps_escaped_quotes_and_multiline_comments() {
+        let input = "[\"a\\\"//b\", /* one\n two */ 3 // end\n]";
+        let value: serde_json::Value = serde_json::from_str(&strip(input)).unwrap();
+        assert_eq!(value, serde_json::json!(["a\"//b", 3]));
+    }
+
+    #[test]
+    fn leaves_unterminated_comments_and_inner_commas() {
+        assert!(serde_json::from_str::<serde_json::Value>(&strip("[1] /* open")).is_err());
+        assert!(serde_json::from_str::<serde_json::Value>(&strip("[1,,]")).is_err());
+        assert_eq!(strip("[1, 2]"), "[1, 2]");
+    }
+}
@@ -22,24 +22,79 @@
 //!     Ok(())
 //! }
 //! ```
+//!
+//! The crate is `no_std` and needs only `alloc`. File and stream I/O sit
+//! behind the default `std` feature, and YAML parsing behind the default
+//! `yaml` feature.
+#![no_std]
 #![forbid(unsafe_code)]
 #![warn(missing_docs)]
 
+extern crate alloc;
+#[cfg(any(feature = "std", test))]
+extern crate std;
+
+mod access;
+#[cfg(feature = "arena")]
+mod arena;
+#[cfg(any(feature = "cbor", feature = "msgpack"))]
+mod binary;
+mod cancel;
+#[cfg(feature = "cbor")]
+mod cbor;
+mod comparator;
 pub mod diff;
+mod duplicates;
 mod error;
+mod gojson;
 mod hash;
+mod jsonc;
+mod merge3;
+#[cfg(feature = "msgpack")]
+mod msgpack;
 mod node;
 mod number;
 mod options;
+mod order;
 mod patch;
+mod prelude;
+mod preset;
+mod progress;
+mod query;
+mod schema;
+mod translate;
+mod yaml;
 
-pub use diff::{Diff, DiffElement, DiffMetadata, Path, PathSegment, RenderConfig, RenderError};
-pub use error::{CanonicalizeError, OptionsError};
+#[cfg(feature = "arena")]
+pub use arena::NodeArena;
+pub use cancel::CancellationToken;
+pub use comparator::NodeComparator;
+#[cfg(feature = "std")]
+pub use diff::{diff_streams, StreamError};
+pub use diff::{
+    unified_diff, Change, ColorTheme, Diff, DiffElement, DiffMetadata, DiffParseError, DiffStat,
+    DiffStats, DiffVisitor, Path, PathSegment, RenderConfig, RenderError, StatEntry,
+    StringGranularity, UnifiedConfig,
+};
+pub use error::{CanonicalizeError, OptionsError, PathError, PointerError, QueryError};
 pub use hash::{combine, hash_bytes, HashCode};
+pub use merge3::{merge3, Conflict, MergeError};
 pub use node::Node;
 pub use number::Number;
-pub use options::{ArrayMode, DiffOptions};
-pub use patch::PatchError;
+pub use options::{
+    ArrayMode, ContextMismatch, DiffOption, DiffOptions, DuplicateKeys, ListAlignment,
+    NumberEquality, ParseOptions, PatchStrictness, PathOption,
+};
+pub use order::KeyOrder;
+pub use patch::{
+    FuzzyPatch, HunkCheck, HunkOffset, NullMerge, PartialPatch, PatchCheck, PatchError,
+    RejectedHunk, StrategicMerge,
+};
+pub use preset::{Preset, Summary, SummaryChange, SummaryEntry};
+pub use progress::{Progress, ProgressPhase, ProgressReporter};
+pub use query::{JsonPath, QueryMatch};
+pub use schema::{JsonSchema, SchemaError, SchemaViolation};
+pub use translate::{TranslateError, Translation};
 
 /// Returns the semantic version of the `jd-core` crate.
 ///
@@ -0,0 +1,351 @@
+//! Three-way merges of JSON documents.
+//!
+//! [`merge3`] diffs a common base against two edited copies and combines the
+//! hunks. Changes made by only one side are kept, changes made identically by
+//! both sides are kept once, and changes that touch the same value are
+//! reported as [`Conflict`]s rather than resolved by guesswork.
+//!
+//! List hunks carry indices into the partially patched list, so each side's
+//! hunks are first rebased onto base indices. Two list hunks conflict when
+//! their ranges of base elements overlap or when both insert at the same
+//! position; edits to neighbouring elements merge cleanly. Set hunks conflict
+//! only when both sides remove the same element.
+
+use alloc::collections::BTreeMap;
+use core::fmt;
+
+use crate::diff::reindex;
+use crate::prelude::*;
+use crate::{DiffElement, DiffOptions, Node, PatchError, Path, PathSegment};
+
+/// Merges the changes from `base` to `ours` and from `base` to `theirs`.
+///
+/// Both diffs are computed with `options`, so array modes, set keys, and
+/// precision decide what counts as a change just like in [`Node::diff`].
+///
+/// ```
+/// # use jd_core::{merge3, DiffOptions, Node};
+/// let base = Node::from_json_str(r#"{"host":"a","port":80,"tags":[1,2,3]}"#).unwrap();
+/// let ours = Node::from_json_str(r#"{"host":"b","port":80,"tags":[0,1,2,3]}"#).unwrap();
+/// let theirs = Node::from_json_str(r#"{"host":"a","port":81,"tags":[1,2,4]}"#).unwrap();
+/// let merged = merge3(&base, &ours, &theirs, &DiffOptions::default()).unwrap();
+/// assert_eq!(
+///     merged,
+///     Node::from_json_str(r#"{"host":"b","port":81,"tags":[0,1,2,4]}"#).unwrap()
+/// );
+/// ```
+///
+/// # Errors
+///
+/// Returns [`MergeError::Conflicts`] listing every pair of overlapping
+/// changes, or [`MergeError::Patch`] if the combined hunks cannot be applied.
+pub fn merge3(
+    base: &Node,
+    ours: &Node,
+    theirs: &Node,
+    options: &DiffOptions,
+) -> Result<Node, MergeError> {
+    // Moves would only be split again, so both sides are diffed without them.
+    let diff_options = options.clone().with_move_detection(false);
+    let ours = reindex::to_base(&base.diff(ours, &diff_options));
+    let theirs = reindex::to_base(&base.diff(theirs, &diff_options));
+
+    let mut merged = ours.clone();
+    let mut conflicts = Vec::new();
+    for mut element in theirs {
+        if ours.iter().any(|other| same_change(other, &element)) {
+            continue;
+        }
+        let clashes: Vec<Conflict> = ours
+            .iter()
+            .filter_map(|other| {
+                let depth = overlap(other, &element)?;
+                Some(Conflict {
+                    path: Path::from(element.path.segments()[..depth].to_vec()),
+                    ours: other.clone(),
+                    theirs: element.clone(),
+                })
+            })
+            .collect();
+        if !clashes.is_empty() {
+            conflicts.extend(clashes);
+            continue;
+        }
+        if is_set_change(&element) {
+            // Values added to the same set by both sides are added once.
+            for other in ours.iter().filter(|other| other.path == element.path) {
+                element.add.retain(|value| !other.add.contains(value));
+            }
+            if element.remove.is_empty() && element.add.is_empty() {
+                continue;
+            }
+        }
+        merged.push(element);
+    }
+    if !conflicts.is_empty() {
+        return Err(MergeError::Conflicts(conflicts));
+    }
+    // List context describes the base, but neighbouring elements may have
+    // been changed by the other side.
+    for element in &mut merged {
+        element.before.clear();
+        element.after.clear();
+    }
+    Ok(base.apply_patch_with_options(&reindex::from_base(merged), options)?)
+}
+
+/// Two changes to the same part of the document, as reported by [`merge3`].
+///
+/// Both hunks use list indices of the base document.
+///
+/// ```
+/// # use jd_core::{merge3, DiffOptions, MergeError, Node, PathSegment};
+/// let base = Node::from_json_str(r#"{"a":1}"#).unwrap();
+/// let ours = Node::from_json_str(r#"{"a":2}"#).unwrap();
+/// let theirs = Node::from_json_str(r#"{"a":3}"#).unwrap();
+/// let Err(MergeError::Conflicts(conflicts)) =
+///     merge3(&base, &ours, &theirs, &DiffOptions::default())
+/// else {
+///     panic!("expected a conflict");
+/// };
+/// assert_eq!(conflicts[0].path.segments(), [PathSegment::key("a")]);
+/// assert_eq!(conflicts[0].ours.add, vec![Node::from_json_str("2").unwrap()]);
+/// assert_eq!(conflicts[0].theirs.add, vec![Node::from_json_str("3").unwrap()]);
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub struct Conflict {
+    /// Deepest path containing both changes.
+    pub path: Path,
+    /// The hunk from the base to `ours`.
+    pub ours: DiffElement,
+    /// The hunk from the base to `theirs`.
+    pub theirs: DiffElement,
+}
+
+/// Errors returned by [`merge3`].
+///
+/// ```
+/// # use jd_core::{merge3, DiffOptions, Node};
+/// let base = Node::from_json_str("[1,2]").unwrap();
+/// let ours = Node::from_json_str("[1,3]").unwrap();
+/// let theirs = Node::from_json_str("[1,4]").unwrap();
+/// let err = merge3(&base, &ours, &theirs, &DiffOptions::default()).unwrap_err();
+/// assert_eq!(err.to_string(), "merge conflicts at []");
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub enum MergeError {
+    /// Both sides changed the same values differently.
+    Conflicts(Vec<Conflict>),
+    /// The merged hunks could not be applied to the base.
+    Patch(PatchError),
+}
+
+impl fmt::Display for MergeError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Self::Conflicts(conflicts) => {
+                f.write_str("merge conflicts at ")?;
+                for (idx, conflict) in conflicts.iter().enumerate() {
+                    if idx > 0 {
+                        f.write_str(", ")?;
+                    }
+                    let path = serde_json::to_string(&conflict.path).map_err(|_| fmt::Error)?;
+                    f.write_str(&path)?;
+                }
+                Ok(())
+            }
+            Self::Patch(err) => write!(f, "failed to apply merged changes: {err}"),
+        }
+    }
+}
+
+impl core::error::Error for MergeError {
+    fn source(&self) -> Option<&(dyn core::error::Error + 'static)> {
+        match self {
+            Self::Conflicts(_) => None,
+            Self::Patch(err) => Some(err),
+        }
+    }
+}
+
+impl From<PatchError> for MergeError {
+    fn from(err: PatchError) -> Self {
+        Self::Patch(err)
+    }
+}
+
+fn same_change(lhs: &DiffElement, rhs: &DiffElement) -> bool {
+    lhs.path == rhs.path && lhs.remove == rhs.remove && lhs.add == rhs.add
+}
+
+fn is_set_change(element: &DiffElement) -> bool {
+    matches!(element.path.segments().last(), Some(PathSegment::Set | PathSegment::MultiSet))
+}
+
+/// The range of base list elements `element` touches in the list at `depth`:
+/// the removed elements for a list hunk, or the single element it descends
+/// into.
+fn span(element: &DiffElement, depth: usize, index: i64) -> (i64, i64) {
+    if depth + 1 == element.path.len() {
+        (index, index + element.remove.len() as i64)
+    } else {
+        (index, index + 1)
+    }
+}
+
+/// Returns the depth at which `ours` and `theirs` change the same value, or
+/// `None` when they are independent.
+fn overlap(ours: &DiffElement, theirs: &DiffElement) -> Option<usize> {
+    let (lhs_path, rhs_path) = (ours.path.segments(), theirs.path.segments());
+    for depth in 0.. {
+        let (Some(lhs), Some(rhs)) = (lhs_path.get(depth), rhs_path.get(depth)) else {
+            // One change replaces a value the other descends into.
+            return Some(depth);
+        };
+        match (lhs, rhs) {
+            (PathSegment::Index(i), PathSegment::Index(j)) => {
+                let nested = depth + 1 < lhs_path.len() && depth + 1 < rhs_path.len();
+                if nested && i == j {
+                    continue;
+                }
+                let (lhs_span, rhs_span) = (span(ours, depth, *i), span(theirs, depth, *j));
+                return spans_overlap(lhs_span, rhs_span).then_some(depth);
+            }
+            (
+                PathSegment::Set | PathSegment::MultiSet,
+                PathSegment::Set | PathSegment::MultiSet,
+            ) => {
+                let shared = ours.remove.iter().any(|value| theirs.remove.contains(value));
+                return shared.then_some(depth);
+            }
+            (PathSegment::Set | PathSegment::MultiSet, PathSegment::SetKeys(keys)) => {
+                return ours.remove.iter().any(|value| has_keys(value, keys)).then_some(depth);
+            }
+            (PathSegment::SetKeys(keys), PathSegment::Set | PathSegment::MultiSet) => {
+                return theirs.remove.iter().any(|value| has_keys(value, keys)).then_some(depth);
+            }
+            _ if lhs == rhs => {}
+            _ => return None,
+        }
+    }
+    unreachable!("paths are finite")
+}
+
+/// Whether two `[start, end)` ranges of list elements overlap. An empty range
+/// is an insertion point, which clashes with another insertion at the same
+/// point or with a range it would split.
+fn spans_overlap((lhs_start, lhs_end): (i64, i64), (rhs_start, rhs_end): (i64, i64)) -> bool {
+    match (lhs_start == lhs_end, rhs_start == rhs_end) {
+        (true, true) => lhs_start == rhs_start,
+        (true, false) => rhs_start < lhs_start && lhs_start < rhs_end,
+        (false, true) => lhs_start < rhs_start && rhs_start < lhs_end,
+        (false, false) => lhs_start < rhs_end && rhs_start < lhs_end,
+    }
+}
+
+fn has_keys(value: &Node, keys: &BTreeMap<String, Node>) -> bool {
+    match value {
+        Node::Object(members) => keys.iter().all(|(key, wanted)| members.get(key) == Some(wanted)),
+        _ => false,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::ArrayMode;
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    fn merge(base: &str, ours: &str, theirs: &str) -> Result<Node, MergeError> {
+        merge3(&node(base), &node(ours), &node(theirs), &DiffOptions::default())
+    }
+
+    fn conflict_paths(err: MergeError) -> Vec<String> {
+        match err {
+            MergeError::Conflicts(conflicts) => conflicts
+                .iter()
+                .map(|conflict| serde_json::to_string(&conflict.path).unwrap())
+                .collect(),
+            MergeError::Patch(err) => panic!("unexpected patch error: {err}"),
+        }
+    }
+
+    #[test]
+    fn merges_independent_object_changes() {
+        let merged =
+            merge(r#"{"a":1,"b":{"c":1}}"#, r#"{"a":2,"b":{"c":1}}"#, r#"{"a":1,"b":{"c":2}}"#)
+                .unwrap();
+        assert_eq!(merged, node(r#"{"a":2,"b":{"c":2}}"#));
+    }
+
+    #[test]
+    fn identical_changes_are_taken_once() {
+        let merged =
+            merge(r#"{"a":1,"l":[1,2]}"#, r#"{"a":2,"l":[1,2,3]}"#, r#"{"a":2,"l":[1,2,3]}"#)
+                .unwrap();
+        assert_eq!(merged, node(r#"{"a":2,"l":[1,2,3]}"#));
+    }
+
+    #[test]
+    fn merges_list_edits_at_different_positions() {
+        let merged = merge("[1,2,3,4,5]", "[0,0,1,2,3,4,5]", "[1,2,4,9]").unwrap();
+        assert_eq!(merged, node("[0,0,1,2,4,9]"));
+        let merged = merge("[1,2,3,4,5]", "[1,9,3,4,5]", "[1,2,8,4,5]").unwrap();
+        assert_eq!(merged, node("[1,9,8,4,5]"));
+        let merged =
+            merge(r#"[{"x":1},{"x":2}]"#, r#"[{"x":1},{"x":3}]"#, r#"[{"x":1},{"x":2},7]"#)
+                .unwrap();
+        assert_eq!(merged, node(r#"[{"x":1},{"x":3},7]"#));
+    }
+
+    #[test]
+    fn reports_overlapping_changes() {
+        let err = merge(r#"{"a":{"b":1}}"#, r#"{"a":{"b":2}}"#, r#"{"a":3}"#).unwrap_err();
+        assert_eq!(conflict_paths(err), ["[\"a\"]"]);
+        let err = merge(r#"{"a":1}"#, r#"{"a":2}"#, "{}").unwrap_err();
+        assert_eq!(conflict_paths(err), ["[\"a\"]"]);
+        let err = merge("[1,2,3]", "[1,3]", r#"[1,4,3]"#).unwrap_err();
+        assert_eq!(conflict_paths(err), ["[]"]);
+        let err = merge(r#"{"l":[1,2]}"#, r#"{"l":[0,1,2]}"#, r#"{"l":[9,1,2]}"#).unwrap_err();
+        assert_eq!(conflict_paths(err), ["[\"l\"]"]);
+    }
+
+    #[test]
+    fn conflicts_carry_both_hunks_in_base_positions() {
+        let err = merge("[1,2,3,4]", "[0,1,2,3,5]", "[1,2,3,6]").unwrap_err();
+        let MergeError::Conflicts(conflicts) = err else { panic!("expected conflicts") };
+        assert_eq!(conflicts.len(), 1);
+        assert_eq!(conflicts[0].ours.path, Path::from(vec![PathSegment::Index(3)]));
+        assert_eq!(conflicts[0].ours.add, vec![node("5")]);
+        assert_eq!(conflicts[0].theirs.path, Path::from(vec![PathSegment::Index(3)]));
+        assert_eq!(conflicts[0].theirs.add, vec![node("6")]);
+    }
+
+    #[test]
+    fn merges_set_changes_unless_both_remove_the_same_value() {
+        let options = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+        let merged =
+            merge3(&node("[1,2,3]"), &node("[2,3,4]"), &node("[1,3,4,5]"), &options).unwrap();
+        assert_eq!(merged.diff(&node("[3,4,5]"), &options).len(), 0);
+        let err =
+            merge3(&node("[1,2,3]"), &node("[2,3,4]"), &node("[2,3,5]"), &options).unwrap_err();
+        assert_eq!(conflict_paths(err), ["[]"]);
+    }
+
+    #[test]
+    fn set_key_members_conflict_with_their_removal() {
+        let options = DiffOptions::default()
+            .with_array_mode(ArrayMode::Set)
+            .and_then(|options| options.with_set_keys(["id"]))
+            .unwrap();
+        let base = node(r#"[{"id":1,"v":1},{"id":2,"v":1}]"#);
+        let ours = node(r#"[{"id":1,"v":2},{"id":2,"v":1}]"#);
+        let merged = merge3(&base, &ours, &node(r#"[{"id":1,"v":1}]"#), &options).unwrap();
+        assert_eq!(merged, node(r#"[{"id":1,"v":2}]"#));
+        let err = merge3(&base, &ours, &node(r#"[{"id":2,"v":1}]"#), &options).unwrap_err();
+        assert_eq!(err.to_string(), "merge conflicts at []");
+    }
+}
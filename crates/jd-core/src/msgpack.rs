@@ -0,0 +1,246 @@
+//! MessagePack input and output, available with the `msgpack` feature.
+//!
+//! MessagePack keeps text (`str`) and raw bytes (`bin`) apart, and so does
+//! the conversion: a `str` becomes a string and a `bin` becomes
+//! `{"$bytes": "<hex>"}`, even when its bytes happen to be valid UTF-8. A
+//! `str` holding invalid UTF-8, as written by encoders from before the `bin`
+//! type existed, is read as bytes too. Extension values become
+//! `{"$ext": <type>, "$bytes": "<hex>"}`. Integer map keys are read as their
+//! decimal text and written back as text keys.
+
+use alloc::collections::BTreeMap;
+
+use rmpv::{Integer, Value};
+
+use crate::binary::{
+    bytes_node, decode_error, float, hex, integer, keep_value, node_bytes, unhex, BYTES_KEY,
+};
+use crate::prelude::*;
+use crate::{CanonicalizeError, DuplicateKeys, Node, Number, ParseOptions};
+
+const FORMAT: &str = "MessagePack";
+const EXT_KEY: &str = "$ext";
+
+impl Node {
+    /// Decodes a MessagePack value into the canonical node representation.
+    /// Empty input decodes to [`Node::Void`], like blank JSON text.
+    ///
+    /// `bin` values and `str` values that are not valid UTF-8 decode to
+    /// `{"$bytes": "<hex>"}`, and extension values to
+    /// `{"$ext": <type>, "$bytes": "<hex>"}`.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// // {"id": 7, "raw": bin 0xbeef}
+    /// let bytes = [0x82, 0xa2, b'i', b'd', 0x07, 0xa3, b'r', b'a', b'w', 0xc4, 0x02, 0xbe, 0xef];
+    /// let node = Node::from_msgpack_slice(&bytes).unwrap();
+    /// assert_eq!(node, Node::from_json_str(r#"{"id":7,"raw":{"$bytes":"beef"}}"#).unwrap());
+    /// ```
+    pub fn from_msgpack_slice(input: &[u8]) -> Result<Self, CanonicalizeError> {
+        Self::from_msgpack_slice_with_options(input, &ParseOptions::default())
+    }
+
+    /// Decodes a MessagePack value like [`Node::from_msgpack_slice`],
+    /// resolving keys a map repeats with [`ParseOptions::duplicate_keys`].
+    ///
+    /// ```
+    /// # use jd_core::{DuplicateKeys, Node, ParseOptions};
+    /// // {"a": 1, "a": 2}
+    /// let bytes = [0x82, 0xa1, b'a', 0x01, 0xa1, b'a', 0x02];
+    /// let strict = ParseOptions::default().with_duplicate_keys(DuplicateKeys::Error);
+    /// assert!(Node::from_msgpack_slice_with_options(&bytes, &strict).is_err());
+    /// ```
+    pub fn from_msgpack_slice_with_options(
+        input: &[u8],
+        options: &ParseOptions,
+    ) -> Result<Self, CanonicalizeError> {
+        if input.is_empty() {
+            return Ok(Self::Void);
+        }
+        let mut reader = input;
+        let value =
+            rmpv::decode::read_value(&mut reader).map_err(|err| decode_error(FORMAT, err))?;
+        if !reader.is_empty() {
+            let trailing = reader.len();
+            return Err(decode_error(
+                FORMAT,
+                format_args!("{trailing} bytes after the first value"),
+            ));
+        }
+        node(value, options.duplicate_keys())
+    }
+
+    /// Encodes the node as MessagePack, turning `$bytes` and `$ext` objects
+    /// back into `bin` and extension values. Integers are written in the
+    /// smallest integer format that holds them and other numbers as 64-bit
+    /// floats.
+    ///
+    /// Returns `None` when the node contains [`Node::Void`].
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let node = Node::from_json_str(r#"["ok",{"$bytes":"6f6b"}]"#).unwrap();
+    /// let bytes = node.to_msgpack_vec().unwrap();
+    /// assert_eq!(bytes, [0x92, 0xa2, b'o', b'k', 0xc4, 0x02, b'o', b'k']);
+    /// assert_eq!(Node::from_msgpack_slice(&bytes).unwrap(), node);
+    /// ```
+    #[must_use]
+    pub fn to_msgpack_vec(&self) -> Option<Vec<u8>> {
+        let value = value(self)?;
+        let mut out = Vec::new();
+        rmpv::encode::write_value(&mut out, &value)
+            .expect("MessagePack values always encode into memory");
+        Some(out)
+    }
+}
+
+fn node(value: Value, policy: DuplicateKeys) -> Result<Node, CanonicalizeError> {
+    Ok(match value {
+        Value::Nil => Node::Null,
+        Value::Boolean(value) => Node::Bool(value),
+        Value::Integer(value) => Node::Number(Number::from_literal(&integer_text(value))?),
+        Value::F32(value) => Node::Number(float(value)?),
+        Value::F64(value) => Node::Number(float(value)?),
+        Value::String(text) if text.is_str() => {
+            Node::String(text.into_str().expect("checked to be UTF-8"))
+        }
+        Value::String(text) => bytes_node(&text.into_bytes()),
+        Value::Binary(bytes) => bytes_node(&bytes),
+        Value::Ext(kind, data) => Node::Object(BTreeMap::from([
+            (EXT_KEY.to_string(), Node::Number(Number::from_literal(&kind.to_string())?)),
+            (BYTES_KEY.to_string(), Node::String(hex(&data))),
+        ])),
+        Value::Array(values) => Node::Array(
+            values.into_iter().map(|value| node(value, policy)).collect::<Result<_, _>>()?,
+        ),
+        Value::Map(entries) => {
+            let mut object = BTreeMap::new();
+            for (key, value) in entries {
+                let key = match key {
+                    Value::String(text) if text.is_str() => {
+                        text.into_str().expect("checked to be UTF-8")
+                    }
+                    Value::Integer(value) => integer_text(value),
+                    other => {
+                        return Err(decode_error(
+                            FORMAT,
+                            format_args!("unsupported map key {other:?}"),
+                        ))
+                    }
+                };
+                if keep_value(&object, &key, policy, FORMAT)? {
+                    object.insert(key, node(value, policy)?);
+                }
+            }
+            Node::Object(object)
+        }
+    })
+}
+
+fn integer_text(value: Integer) -> String {
+    match value.as_u64() {
+        Some(value) => value.to_string(),
+        None => value.as_i64().expect("MessagePack integers fit in 64 bits").to_string(),
+    }
+}
+
+fn value(node: &Node) -> Option<Value> {
+    Some(match node {
+        Node::Void => return None,
+        Node::Null => Value::Nil,
+        Node::Bool(value) => Value::Boolean(*value),
+        Node::Number(number) => number_value(number),
+        Node::String(text) => Value::String(text.clone().into()),
+        Node::Array(values) => Value::Array(values.iter().map(value).collect::<Option<_>>()?),
+        Node::Object(map) => {
+            if let Some(bytes) = node_bytes(node) {
+                Value::Binary(bytes)
+            } else if let Some((kind, data)) = ext(map) {
+                Value::Ext(kind, data)
+            } else {
+                Value::Map(
+                    map.iter()
+                        .map(|(key, node)| Some((Value::String(key.clone().into()), value(node)?)))
+                        .collect::<Option<_>>()?,
+                )
+            }
+        }
+    })
+}
+
+/// Returns the type and data of a `{"$ext": type, "$bytes": hex}` object.
+fn ext(map: &BTreeMap<String, Node>) -> Option<(i8, Vec<u8>)> {
+    let (Some(Node::Number(kind)), Some(Node::String(data))) =
+        (map.get(EXT_KEY), map.get(BYTES_KEY))
+    else {
+        return None;
+    };
+    if map.len() != 2 {
+        return None;
+    }
+    Some((i8::try_from(integer(kind)?).ok()?, unhex(data)?))
+}
+
+/// Writes integers that fit in 64 bits as integers and everything else as a
+/// 64-bit float.
+fn number_value(number: &Number) -> Value {
+    let integer = integer(number);
+    if let Some(value) = integer.and_then(|value| u64::try_from(value).ok()) {
+        return Value::Integer(value.into());
+    }
+    if let Some(value) = integer.and_then(|value| i64::try_from(value).ok()) {
+        return Value::Integer(value.into());
+    }
+    Value::F64(number.get())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    #[test]
+    fn documents_round_trip() {
+        let node = json(
+            r#"{"a":[1,-2,-200,70000,1.5,true,null,"x"],"big":18446744073709551615,
+                "raw":{"$bytes":"00ff"},"time":{"$ext":-1,"$bytes":"6553f100"}}"#,
+        );
+        let bytes = node.to_msgpack_vec().unwrap();
+        assert_eq!(Node::from_msgpack_slice(&bytes).unwrap(), node);
+        assert_eq!(Node::Void.to_msgpack_vec(), None);
+        assert_eq!(json("[1,-1]").to_msgpack_vec().unwrap(), [0x92, 0x01, 0xff]);
+    }
+
+    #[test]
+    fn wide_numbers_become_floats() {
+        let node = json("[-18446744073709551615, 1e300]");
+        let bytes = node.to_msgpack_vec().unwrap();
+        assert_eq!(bytes[1], 0xcb);
+        assert_eq!(
+            Node::from_msgpack_slice(&bytes).unwrap(),
+            json("[-1.8446744073709552e19, 1e300]")
+        );
+    }
+
+    #[test]
+    fn single_precision_floats_read_as_written() {
+        // [float32 0.1, float32 1.0]
+        let bytes = [0x92, 0xca, 0x3d, 0xcc, 0xcc, 0xcd, 0xca, 0x3f, 0x80, 0x00, 0x00];
+        let Node::Array(items) = Node::from_msgpack_slice(&bytes).unwrap() else { panic!() };
+        assert_eq!(items[0], json("0.1"));
+        let Node::Number(one) = &items[1] else { panic!() };
+        assert!(!one.is_integer());
+    }
+
+    #[test]
+    fn rejects_malformed_input() {
+        assert_eq!(Node::from_msgpack_slice(&[]).unwrap(), Node::Void);
+        for bytes in [&[0x91][..], &[0x01, 0x02], &[0x81, 0xc3, 0x01], &[0xc1]] {
+            let err = Node::from_msgpack_slice(bytes).unwrap_err();
+            assert!(err.to_string().starts_with("invalid MessagePack: "), "{err}");
+        }
+    }
+}
@@ -1,20 +1,36 @@
-use std::collections::{BTreeMap, BTreeSet};
+use alloc::collections::{BTreeMap, BTreeSet};
+#[cfg(feature = "std")]
+use std::io::BufReader;
 
 use serde::{Deserialize, Serialize};
 use serde_json::Value as JsonValue;
+#[cfg(feature = "yaml")]
 use serde_yaml::Value as YamlValue;
 
+use crate::prelude::*;
 use crate::{
+    diff::PathSegment,
+    duplicates, gojson,
     hash::{combine, hash_bytes, HashCode},
-    ArrayMode, CanonicalizeError, DiffOptions, Number, PatchError,
+    jsonc, ArrayMode, CanonicalizeError, DiffOptions, DuplicateKeys, KeyOrder, NullMerge, Number,
+    NumberEquality, ParseOptions, PatchError, StrategicMerge,
 };
 
+#[cfg(feature = "std")]
+use crate::progress::CountingReader;
+
 const VOID_HASH: HashCode = [0xF3, 0x97, 0x6B, 0x21, 0x91, 0x26, 0x8D, 0x96];
 const NULL_HASH: HashCode = [0xFE, 0x73, 0xAB, 0xCC, 0xE6, 0x32, 0xE0, 0x88];
 const BOOL_TRUE_HASH: HashCode = [0x24, 0x6B, 0xE3, 0xE4, 0xAF, 0x59, 0xDC, 0x1C];
 const BOOL_FALSE_HASH: HashCode = [0xC6, 0x38, 0x77, 0xD1, 0x0A, 0x7E, 0x1F, 0xBF];
+/// Shared by every ignored value so ignored fields never affect identity.
+const IGNORED_HASH: HashCode = [0x49, 0x47, 0x4E, 0x4F, 0x52, 0x45, 0x44, 0x00];
 const LIST_SEED: [u8; 8] = [0xF5, 0x18, 0x0A, 0x71, 0xA4, 0xC4, 0x03, 0xF3];
 const OBJECT_SEED: [u8; 8] = [0x00, 0x5D, 0x39, 0xA4, 0x18, 0x10, 0xEA, 0xD5];
+/// Combined with the set-key values of an object into its identity.
+const IDENTITY_SEED: HashCode = [0x4B, 0x08, 0xD2, 0x0F, 0xBD, 0xC8, 0xDE, 0x9A];
+/// Mixed into the hash of floats under [`NumberEquality::Typed`].
+const FLOAT_SEED: [u8; 8] = [0x46, 0x4C, 0x4F, 0x41, 0x54, 0x00, 0x00, 0x00];
 
 /// Represents the canonical JSON data model used by the diff engine.
 #[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
@@ -45,11 +61,58 @@ impl Node {
     /// assert!(matches!(node, Node::Object(_)));
     /// ```
     pub fn from_json_str(input: &str) -> Result<Self, CanonicalizeError> {
+        Self::from_json_str_with_options(input, &ParseOptions::default())
+    }
+
+    /// Parses a JSON string like [`Node::from_json_str`], resolving keys an
+    /// object repeats with [`ParseOptions::duplicate_keys`] and accepting
+    /// comments when [`ParseOptions::jsonc`] is set. As in Go `jd`, a `\u`
+    /// escape naming half of a surrogate pair reads as U+FFFD.
+    ///
+    /// ```
+    /// # use jd_core::{DuplicateKeys, Node, ParseOptions};
+    /// let strict = ParseOptions::default().with_duplicate_keys(DuplicateKeys::Error);
+    /// assert!(Node::from_json_str_with_options(r#"{"a":1,"b":{"a":2}}"#, &strict).is_ok());
+    /// assert!(Node::from_json_str_with_options(r#"{"a":1,"a":2}"#, &strict).is_err());
+    /// ```
+    pub fn from_json_str_with_options(
+        input: &str,
+        options: &ParseOptions,
+    ) -> Result<Self, CanonicalizeError> {
+        let stripped;
+        let input = if options.jsonc() {
+            stripped = jsonc::strip(input);
+            &stripped
+        } else {
+            input
+        };
+        let replaced;
+        let input = match gojson::replace_lone_surrogates(input) {
+            Some(text) => {
+                replaced = text;
+                &replaced
+            }
+            None => input,
+        };
         if input.trim().is_empty() {
             return Ok(Self::Void);
         }
-        let value: JsonValue = serde_json::from_str(input)?;
-        Self::from_json_value(value)
+        #[cfg(feature = "std")]
+        if let Some(tracker) = options.tracker() {
+            let reader = BufReader::new(CountingReader::new(input, &tracker));
+            let value = duplicates::json_value_from_reader(reader, options.duplicate_keys());
+            tracker.finish();
+            return Self::from_json_value(value?);
+        }
+        let value = match options.duplicate_keys() {
+            // Both JSON parsers already keep the last value.
+            DuplicateKeys::LastWins => parse_json(input),
+            policy => duplicates::json_value(input, policy),
+        };
+        // Without `std` there is no reader to count bytes through.
+        #[cfg(not(feature = "std"))]
+        parsed_whole(input, options);
+        Self::from_json_value(value?)
     }
 
     /// Parses a YAML string into the canonical node representation.
@@ -59,12 +122,101 @@ impl Node {
     /// let node = Node::from_yaml_str("---\nanswer: 42\n").expect("valid YAML");
     /// assert!(matches!(node, Node::Object(_)));
     /// ```
+    #[cfg(feature = "yaml")]
     pub fn from_yaml_str(input: &str) -> Result<Self, CanonicalizeError> {
+        Self::from_yaml_str_with_options(input, &ParseOptions::default())
+    }
+
+    /// Parses a YAML string like [`Node::from_yaml_str`], resolving keys a
+    /// mapping repeats with [`ParseOptions::duplicate_keys`].
+    ///
+    /// ```
+    /// # use jd_core::{DuplicateKeys, Node, ParseOptions};
+    /// let first = ParseOptions::default().with_duplicate_keys(DuplicateKeys::FirstWins);
+    /// let node = Node::from_yaml_str_with_options("a: 1\na: 2\n", &first).unwrap();
+    /// assert_eq!(node, Node::from_json_str(r#"{"a":1}"#).unwrap());
+    /// ```
+    #[cfg(feature = "yaml")]
+    pub fn from_yaml_str_with_options(
+        input: &str,
+        options: &ParseOptions,
+    ) -> Result<Self, CanonicalizeError> {
         if input.trim().is_empty() {
             return Ok(Self::Void);
         }
-        let value: YamlValue = serde_yaml::from_str(input)?;
-        Self::from_yaml_value(value)
+        let value = duplicates::yaml_value(input, options.duplicate_keys());
+        parsed_whole(input, options);
+        Self::from_yaml_value(value?)
+    }
+
+    /// Parses every document of a `---`-separated YAML stream, such as a
+    /// file of Kubernetes manifests. Empty and `null` documents, like the one
+    /// a trailing `---` leaves, are skipped.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let text = "kind: Service\n---\nkind: Deployment\n---\n";
+    /// let documents = Node::from_yaml_documents_str(text).unwrap();
+    /// assert_eq!(documents.len(), 2);
+    /// assert_eq!(documents[1], Node::from_json_str(r#"{"kind":"Deployment"}"#).unwrap());
+    /// ```
+    #[cfg(feature = "yaml")]
+    pub fn from_yaml_documents_str(input: &str) -> Result<Vec<Self>, CanonicalizeError> {
+        Self::from_yaml_documents_str_with_options(input, &ParseOptions::default())
+    }
+
+    /// Parses a YAML stream like [`Node::from_yaml_documents_str`], resolving
+    /// keys a mapping repeats with [`ParseOptions::duplicate_keys`].
+    ///
+    /// ```
+    /// # use jd_core::{DuplicateKeys, Node, ParseOptions};
+    /// let strict = ParseOptions::default().with_duplicate_keys(DuplicateKeys::Error);
+    /// let text = "a: 1\n---\na: 1\na: 2\n";
+    /// assert!(Node::from_yaml_documents_str_with_options(text, &strict).is_err());
+    /// ```
+    #[cfg(feature = "yaml")]
+    pub fn from_yaml_documents_str_with_options(
+        input: &str,
+        options: &ParseOptions,
+    ) -> Result<Vec<Self>, CanonicalizeError> {
+        let values = duplicates::yaml_values(input, options.duplicate_keys());
+        parsed_whole(input, options);
+        values?
+            .into_iter()
+            .filter(|value| !matches!(value, YamlValue::Null))
+            .map(Self::from_yaml_value)
+            .collect()
+    }
+
+    /// Reads and parses a JSON file into the canonical node representation.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let path = std::env::temp_dir().join("jd_core_from_json_file.json");
+    /// std::fs::write(&path, "{\"a\":1}").unwrap();
+    /// let node = Node::from_json_file(&path).expect("readable JSON");
+    /// assert_eq!(node, Node::from_json_str("{\"a\":1}").unwrap());
+    /// ```
+    #[cfg(feature = "std")]
+    pub fn from_json_file(path: impl AsRef<std::path::Path>) -> Result<Self, CanonicalizeError> {
+        Self::from_json_str(&read_file(path.as_ref())?)
+    }
+
+    /// Reads and parses a YAML file into the canonical node representation.
+    ///
+    /// YAML scalars are normalized exactly as in [`Node::from_yaml_str`], so
+    /// a YAML document and its JSON equivalent produce equal nodes.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let path = std::env::temp_dir().join("jd_core_from_yaml_file.yaml");
+    /// std::fs::write(&path, "a: 1\n").unwrap();
+    /// let node = Node::from_yaml_file(&path).expect("readable YAML");
+    /// assert_eq!(node, Node::from_json_str("{\"a\":1}").unwrap());
+    /// ```
+    #[cfg(feature = "yaml")]
+    pub fn from_yaml_file(path: impl AsRef<std::path::Path>) -> Result<Self, CanonicalizeError> {
+        Self::from_yaml_str(&read_file(path.as_ref())?)
     }
 
     /// Converts a serde JSON value into a [`Node`].
@@ -79,13 +231,7 @@ impl Node {
         match value {
             JsonValue::Null => Ok(Self::Null),
             JsonValue::Bool(v) => Ok(Self::Bool(v)),
-            JsonValue::Number(num) => {
-                let text = num.to_string();
-                let Some(as_f64) = num.as_f64() else {
-                    return Err(CanonicalizeError::NumberOutOfRange { value: text });
-                };
-                Ok(Self::Number(Number::new(as_f64)?))
-            }
+            JsonValue::Number(num) => Ok(Self::Number(Number::from_literal(&num.to_string())?)),
             JsonValue::String(s) => Ok(Self::String(s)),
             JsonValue::Array(values) => {
                 let mut items = Vec::with_capacity(values.len());
@@ -104,6 +250,7 @@ impl Node {
         }
     }
 
+    #[cfg(feature = "yaml")]
     fn from_yaml_value(value: YamlValue) -> Result<Self, CanonicalizeError> {
         match value {
             YamlValue::Null => Ok(Self::Null),
@@ -188,44 +335,97 @@ impl Node {
         }
     }
 
-    /// Structural equality that respects [`DiffOptions`].
+    /// Renders the node as YAML using the same layout as Go jd's `-yaml`
+    /// output: sorted keys, unindented nested sequences, and quoting only
+    /// where a plain scalar would be read back as a different type.
+    ///
+    /// Returns `None` for [`Node::Void`], mirroring [`Node::to_json_value`].
     ///
     /// ```
-    /// # use jd_core::{ArrayMode, DiffOptions, Node};
-    /// let lhs = Node::from_json_str("[1,2]").expect("valid JSON");
-    /// let rhs = Node::from_json_str("[2,1]").expect("valid JSON");
-    /// let opts = DiffOptions::default()
-    ///     .with_array_mode(ArrayMode::Set)
-    ///     .expect("set mode");
+    /// # use jd_core::Node;
+    /// let node = Node::from_json_str(r#"{"b":["x","true"],"a":1000000}"#).expect("valid JSON");
+    /// assert_eq!(node.to_yaml_string().unwrap(), "a: 1e+06\nb:\n- x\n- \"true\"\n");
+    /// assert!(Node::Void.to_yaml_string().is_none());
+    /// ```
+    #[must_use]
+    pub fn to_yaml_string(&self) -> Option<String> {
+        crate::yaml::render(self, &KeyOrder::default())
+    }
+
+    /// Renders the node as compact JSON with object keys in the order
+    /// recorded by `order`, rather than sorted as by
+    /// [`Node::to_json_value`]. Keys missing from `order` follow the recorded
+    /// ones in sorted order.
+    ///
+    /// Returns `None` when the node contains [`Node::Void`].
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, KeyOrder, Node};
+    /// let text = r#"{"version":1,"name":"jd"}"#;
+    /// let base = Node::from_json_str(text).unwrap();
+    /// let diff = base.diff(&Node::from_json_str(r#"{"version":2,"name":"jd","license":"MIT"}"#).unwrap(), &DiffOptions::default());
+    /// let patched = base.apply_patch(&diff).unwrap();
+    /// let order = KeyOrder::from_json_str(text).unwrap();
+    /// assert_eq!(patched.to_json_string_ordered(&order).unwrap(), r#"{"version":2,"name":"jd","license":"MIT"}"#);
+    /// ```
+    #[must_use]
+    pub fn to_json_string_ordered(&self, order: &KeyOrder) -> Option<String> {
+        crate::order::json_string(self, order)
+    }
+
+    /// Renders the node as YAML like [`Node::to_yaml_string`], but with
+    /// mapping keys in the order recorded by `order`. Keys missing from
+    /// `order` follow the recorded ones in yaml.v2's sorted order.
+    ///
+    /// ```
+    /// # use jd_core::{KeyOrder, Node};
+    /// let text = "name: jd\nversion: 1\n";
+    /// let order = KeyOrder::from_yaml_str(text).unwrap();
+    /// let node = Node::from_json_str(r#"{"version":1,"name":"jd","id":7}"#).unwrap();
+    /// assert_eq!(node.to_yaml_string_ordered(&order).unwrap(), "name: jd\nversion: 1\nid: 7\n");
+    /// ```
+    #[must_use]
+    pub fn to_yaml_string_ordered(&self, order: &KeyOrder) -> Option<String> {
+        crate::yaml::render(self, order)
+    }
+
+    /// Returns whether [`Node::diff`] with the same options would be empty,
+    /// stopping at the first difference instead of building the diff.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"replicas":3,"tags":["a","b"]}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"replicas":3,"tags":["b","a"]}"#).unwrap();
+    /// let opts = DiffOptions::from_json_str(r#"[{"@":["tags"],"^":["SET"]}]"#).unwrap();
     /// assert!(lhs.eq_with_options(&rhs, &opts));
+    /// assert!(!lhs.eq_with_options(&rhs, &DiffOptions::default()));
     /// ```
     #[must_use]
     pub fn eq_with_options(&self, other: &Self, options: &DiffOptions) -> bool {
+        if options.is_ignored() {
+            return true;
+        }
+        if let Some(equal) = options.compare(self, other) {
+            return equal;
+        }
         match (self, other) {
             (Self::Void, Self::Void) => true,
             (Self::Null, Self::Null) => true,
             (Self::Bool(a), Self::Bool(b)) => a == b,
-            (Self::Number(a), Self::Number(b)) => a.equals_with_precision(*b, options.precision()),
+            (Self::Number(a), Self::Number(b)) => {
+                let typed = options.number_equality() == NumberEquality::Typed;
+                !(typed && a.is_integer() != b.is_integer())
+                    && a.equals_with_precision(b, options.precision())
+            }
             (Self::String(a), Self::String(b)) => a == b,
             (Self::Array(a), Self::Array(b)) => match options.array_mode() {
                 ArrayMode::List => list_equals(a, b, options),
-                ArrayMode::Set => set_equals(a, b, options),
-                ArrayMode::MultiSet => multiset_equals(a, b, options),
-            },
-            (Self::Object(a), Self::Object(b)) => {
-                if a.len() != b.len() {
-                    return false;
+                ArrayMode::Set => set_equals(a, b, &options.refine(&PathSegment::Set)),
+                ArrayMode::MultiSet => {
+                    multiset_equals(a, b, &options.refine(&PathSegment::MultiSet))
                 }
-                for (key, value_a) in a {
-                    let Some(value_b) = b.get(key) else {
-                        return false;
-                    };
-                    if !value_a.eq_with_options(value_b, options) {
-                        return false;
-                    }
-                }
-                true
-            }
+            },
+            (Self::Object(a), Self::Object(b)) => object_equals(a, b, options),
             _ => false,
         }
     }
@@ -244,6 +444,16 @@ impl Node {
         crate::diff::diff_nodes(self, other, options)
     }
 
+    /// Marks every number written as a float to render with its fraction.
+    pub(crate) fn show_float_forms(&mut self) {
+        match self {
+            Self::Number(number) => number.show_float_form(),
+            Self::Array(values) => values.iter_mut().for_each(Self::show_float_forms),
+            Self::Object(map) => map.values_mut().for_each(Self::show_float_forms),
+            _ => {}
+        }
+    }
+
     /// Applies a diff to this node, returning the patched node on success.
     ///
     /// ```
@@ -255,11 +465,182 @@ impl Node {
     /// assert_eq!(patched, target);
     /// ```
     pub fn apply_patch(&self, diff: &crate::Diff) -> Result<Self, PatchError> {
-        crate::patch::apply_patch(self, diff)
+        self.apply_patch_with_options(diff, &DiffOptions::default())
+    }
+
+    /// Applies a diff, honouring the numeric precision in `options` when
+    /// checking removed values and list context.
+    ///
+    /// A `^ {"precision":N}` header carried by the diff takes priority over
+    /// the precision in `options`. Context mismatches let through under
+    /// [`ContextMismatch::Warn`](crate::ContextMismatch::Warn) are not
+    /// returned here; [`Node::apply_patch_fuzzy`] returns them.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let base = Node::from_json_str("{\"a\":1.0}").expect("valid JSON");
+    /// let target = Node::from_json_str("{\"a\":2}").expect("valid JSON");
+    /// let diff = base.diff(&target, &DiffOptions::default());
+    /// let drifted = Node::from_json_str("{\"a\":1.001}").expect("valid JSON");
+    /// assert!(drifted.apply_patch(&diff).is_err());
+    /// let options = DiffOptions::default().with_precision(0.01).expect("valid precision");
+    /// let patched = drifted.apply_patch_with_options(&diff, &options).expect("apply diff");
+    /// assert_eq!(patched, target);
+    /// ```
+    pub fn apply_patch_with_options(
+        &self,
+        diff: &crate::Diff,
+        options: &DiffOptions,
+    ) -> Result<Self, PatchError> {
+        crate::patch::apply_patch(self, diff, options)
+    }
+
+    /// Applies a diff like [`Node::apply_patch_with_options`], also
+    /// reporting the list hunks that applied away from their index under
+    /// [`DiffOptions::with_patch_fuzz`].
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"[1,2,3]"#).unwrap();
+    /// let diff = lhs.diff(&Node::from_json_str("[1,3]").unwrap(), &DiffOptions::default());
+    /// let drifted = Node::from_json_str("[0,0,1,2,3]").unwrap();
+    /// let options = DiffOptions::default().with_patch_fuzz(3);
+    /// let patched = drifted.apply_patch_fuzzy(&diff, &options).expect("apply diff");
+    /// assert_eq!(patched.node, Node::from_json_str("[0,0,1,3]").unwrap());
+    /// assert_eq!(patched.offsets[0].offset, 2);
+    /// ```
+    pub fn apply_patch_fuzzy(
+        &self,
+        diff: &crate::Diff,
+        options: &DiffOptions,
+    ) -> Result<crate::FuzzyPatch, PatchError> {
+        crate::patch::apply_patch_fuzzy(self, diff, options)
+    }
+
+    /// Applies every hunk of a diff that fits and sets the others aside,
+    /// instead of failing on the first conflict. Hunks that do not apply
+    /// leave the document unchanged and are returned with their errors in
+    /// [`PartialPatch::rejected`]; later hunks still apply.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"a":1,"b":[1,2]}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"a":2,"b":[1,3]}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default());
+    /// let drifted = Node::from_json_str(r#"{"a":1,"b":[1,4]}"#).unwrap();
+    /// let partial = drifted.apply_patch_partial(&diff, &DiffOptions::default());
+    /// assert_eq!(partial.node, Node::from_json_str(r#"{"a":2,"b":[1,4]}"#).unwrap());
+    /// assert_eq!(partial.rejected.len(), 1);
+    /// ```
+    #[must_use]
+    pub fn apply_patch_partial(
+        &self,
+        diff: &crate::Diff,
+        options: &DiffOptions,
+    ) -> crate::PartialPatch {
+        crate::patch::apply_patch_partial(self, diff, options)
+    }
+
+    /// Applies an RFC 6902 JSON Patch document to this node.
+    ///
+    /// All six operations (`add`, `remove`, `replace`, `move`, `copy`, and
+    /// `test`) are supported. Operations apply in order and the first failure
+    /// aborts the patch.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let base = Node::from_json_str("{\"a\":[1,2]}").expect("valid JSON");
+    /// let patch = r#"[{"op":"test","path":"/a/0","value":1},{"op":"replace","path":"/a/0","value":3}]"#;
+    /// let patched = base.apply_json_patch(patch).expect("apply patch");
+    /// assert_eq!(patched, Node::from_json_str("{\"a\":[3,2]}").unwrap());
+    /// ```
+    pub fn apply_json_patch(&self, patch: &str) -> Result<Self, PatchError> {
+        crate::patch::apply_json_patch(self, patch)
+    }
+
+    /// Applies an RFC 7386 JSON Merge Patch document to this node.
+    ///
+    /// `null` members delete keys, objects merge recursively, and any other
+    /// value (including arrays) replaces the target outright.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let base = Node::from_json_str("{\"a\":{\"b\":1,\"c\":2},\"d\":[1]}").expect("valid JSON");
+    /// let patched = base.apply_merge_patch(r#"{"a":{"c":null},"d":[2]}"#).expect("apply patch");
+    /// assert_eq!(patched, Node::from_json_str("{\"a\":{\"b\":1},\"d\":[2]}").unwrap());
+    /// ```
+    pub fn apply_merge_patch(&self, patch: &str) -> Result<Self, PatchError> {
+        crate::patch::apply_merge_patch(self, patch)
+    }
+
+    /// Applies a Kubernetes strategic merge patch to this node.
+    ///
+    /// Objects merge as in [`Node::apply_merge_patch`], but the lists that
+    /// `merge` names merge too: object lists element by element on their
+    /// merge key, and scalar lists as a union. Other lists are replaced.
+    /// `$patch`, `$retainKeys`, and `$deleteFromPrimitiveList` directives
+    /// are honored.
+    ///
+    /// ```
+    /// # use jd_core::{Node, StrategicMerge};
+    /// let pod = Node::from_json_str(
+    ///     r#"{"spec":{"containers":[{"name":"app","image":"app:1"},{"name":"proxy","image":"proxy:1"}]}}"#,
+    /// ).unwrap();
+    /// let patch = Node::from_json_str(r#"{"spec":{"containers":[{"name":"app","image":"app:2"}]}}"#).unwrap();
+    /// let patched = pod.apply_strategic_merge_patch(&patch, &StrategicMerge::kubernetes()).unwrap();
+    /// let images = patched.query("$.spec.containers[*].image").unwrap();
+    /// assert_eq!(images.len(), 2);
+    /// assert_eq!(images[0].node, &Node::String("app:2".into()));
+    /// ```
+    pub fn apply_strategic_merge_patch(
+        &self,
+        patch: &Node,
+        merge: &StrategicMerge,
+    ) -> Result<Self, PatchError> {
+        crate::patch::apply_strategic_merge_patch(self, patch, merge)
+    }
+
+    /// Recursively merges `other` into a copy of this node, following RFC
+    /// 7386: objects merge key by key, `null` members delete keys, and any
+    /// other value, arrays included, replaces what was there. Merging
+    /// [`Node::Void`] leaves the node unchanged.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let base = Node::from_json_str(r#"{"spec":{"replicas":1,"paused":true}}"#).unwrap();
+    /// let overlay = Node::from_json_str(r#"{"spec":{"replicas":3,"paused":null}}"#).unwrap();
+    /// let merged = base.deep_merge(&overlay);
+    /// assert_eq!(merged, Node::from_json_str(r#"{"spec":{"replicas":3}}"#).unwrap());
+    /// ```
+    #[must_use]
+    pub fn deep_merge(&self, other: &Self) -> Self {
+        self.deep_merge_with(other, NullMerge::Delete)
+    }
+
+    /// Recursively merges `other` into a copy of this node like
+    /// [`Node::deep_merge`], with `nulls` deciding whether `null` members
+    /// delete keys or are stored as values.
+    ///
+    /// ```
+    /// # use jd_core::{Node, NullMerge};
+    /// let base = Node::from_json_str(r#"{"a":{"b":1,"c":2}}"#).unwrap();
+    /// let overlay = Node::from_json_str(r#"{"a":{"b":null}}"#).unwrap();
+    /// let merged = base.deep_merge_with(&overlay, NullMerge::Assign);
+    /// assert_eq!(merged, Node::from_json_str(r#"{"a":{"b":null,"c":2}}"#).unwrap());
+    /// ```
+    #[must_use]
+    pub fn deep_merge_with(&self, other: &Self, nulls: NullMerge) -> Self {
+        crate::patch::deep_merge(self, other, nulls)
     }
 
     /// Computes the Go-compatible hash code for this node.
     ///
+    /// The hash follows `options` the way the diff engine does: arrays hash
+    /// as lists, sets, or multisets per the array mode, ignored values and
+    /// excluded keys do not contribute, and comparators may supply their
+    /// own hash. Numeric precision is not taken into account, so numbers
+    /// equal only within the tolerance may hash differently.
+    ///
     /// ```
     /// # use jd_core::{DiffOptions, Node};
     /// let node = Node::from_json_str("{\"x\":true}").expect("valid JSON");
@@ -269,21 +650,90 @@ impl Node {
     /// ```
     #[must_use]
     pub fn hash_code(&self, options: &DiffOptions) -> HashCode {
+        if options.is_ignored() {
+            return IGNORED_HASH;
+        }
+        if let Some(hash) = options.comparator_hash(self) {
+            return hash;
+        }
         match self {
             Self::Void => VOID_HASH,
             Self::Null => NULL_HASH,
             Self::Bool(true) => BOOL_TRUE_HASH,
             Self::Bool(false) => BOOL_FALSE_HASH,
+            Self::Number(n)
+                if !n.is_integer() && options.number_equality() == NumberEquality::Typed =>
+            {
+                combine(vec![n.hash_code(), FLOAT_SEED])
+            }
             Self::Number(n) => n.hash_code(),
             Self::String(s) => hash_bytes(s.as_bytes()),
             Self::Array(values) => match options.array_mode() {
                 ArrayMode::List => hash_list(values, options),
-                ArrayMode::Set => hash_set(values, options),
-                ArrayMode::MultiSet => hash_multiset(values, options),
+                ArrayMode::Set => hash_set(values, &options.refine(&PathSegment::Set)),
+                ArrayMode::MultiSet => {
+                    hash_multiset(values, &options.refine(&PathSegment::MultiSet))
+                }
             },
             Self::Object(map) => hash_object(map, options),
         }
     }
+
+    /// Computes the structural hash of this node: [`Node::hash_code`] under
+    /// default options, where arrays are ordered lists.
+    ///
+    /// Nodes that compare equal hash equally, so the hash suits deduping,
+    /// bucketing, and cache keys. It is FNV-1a over a canonical encoding
+    /// with object keys in sorted order, matching Go jd's `hashCode`, and
+    /// does not depend on platform, process, or run. Changing it is a
+    /// breaking change. It is not a cryptographic hash.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let a = Node::from_json_str(r#"{"x":1,"y":[true]}"#).unwrap();
+    /// let b = Node::from_json_str(r#"{"y":[true],"x":1.0}"#).unwrap();
+    /// assert_eq!(a.structural_hash(), b.structural_hash());
+    /// let c = Node::from_json_str(r#"{"x":1,"y":[false]}"#).unwrap();
+    /// assert_ne!(a.structural_hash(), c.structural_hash());
+    /// ```
+    #[must_use]
+    pub fn structural_hash(&self) -> HashCode {
+        self.hash_code(&DiffOptions::default())
+    }
+
+    /// Returns the identity used to match this node within a set.
+    ///
+    /// When set keys are configured, objects are identified by the values of
+    /// the fields named by those keys, combined as Go's `jsonObject.ident`
+    /// combines them so sets list their hunks in Go's order. Objects without
+    /// any of the keys, and all other nodes, fall back to
+    /// [`Node::hash_code`].
+    pub(crate) fn identity_hash(&self, options: &DiffOptions) -> HashCode {
+        match self.identity_keys(options) {
+            Some(identity) => {
+                let mut codes = vec![IDENTITY_SEED];
+                codes.extend(
+                    identity.iter().map(|(key, value)| {
+                        value.hash_code(&options.refine(&PathSegment::key(key)))
+                    }),
+                );
+                combine(codes)
+            }
+            None => self.hash_code(options),
+        }
+    }
+
+    /// Extracts the set-key fields that identify this object, if any.
+    pub(crate) fn identity_keys(&self, options: &DiffOptions) -> Option<BTreeMap<String, Node>> {
+        let (Self::Object(map), Some(keys)) = (self, options.set_keys()) else {
+            return None;
+        };
+        let identity: BTreeMap<String, Node> = keys
+            .iter()
+            .filter_map(|key| map.get(key).map(|value| (key.clone(), value.clone())))
+            .collect();
+        (!identity.is_empty()).then_some(identity)
+    }
 }
 
 impl TryFrom<JsonValue> for Node {
@@ -294,14 +744,82 @@ impl TryFrom<JsonValue> for Node {
     }
 }
 
+/// Reports the whole of `input` parsed, for readers that cannot count bytes
+/// as they go.
+#[cfg(any(not(feature = "std"), feature = "yaml"))]
+fn parsed_whole(input: &str, options: &ParseOptions) {
+    if let Some(tracker) = options.tracker() {
+        tracker.parsed(input.len());
+        tracker.finish();
+    }
+}
+
+/// Parses JSON text into a serde value with simd-json, falling back to
+/// `serde_json` for anything simd-json rejects. Errors and edge cases such as
+/// integers wider than 64 bits therefore behave exactly as without the
+/// `simd` feature. simd-json reads numbers as doubles, so input that may
+/// hold a literal a double cannot represent goes to `serde_json` as well,
+/// which keeps the literal.
+#[cfg(feature = "simd")]
+fn parse_json(input: &str) -> Result<JsonValue, serde_json::Error> {
+    if may_need_literals(input) {
+        return serde_json::from_str(input);
+    }
+    let mut bytes = input.as_bytes().to_vec();
+    simd_json::serde::from_slice(&mut bytes).or_else(|_| serde_json::from_str(input))
+}
+
+/// Reports whether `input` contains a run of 16 or more digits, possibly
+/// split by a decimal point. Shorter literals always round-trip through a
+/// double; digits inside strings merely cause a needless fallback.
+#[cfg(feature = "simd")]
+fn may_need_literals(input: &str) -> bool {
+    let mut digits = 0;
+    for byte in input.bytes() {
+        match byte {
+            b'0'..=b'9' => {
+                digits += 1;
+                if digits >= 16 {
+                    return true;
+                }
+            }
+            b'.' => {}
+            _ => digits = 0,
+        }
+    }
+    false
+}
+
+#[cfg(not(feature = "simd"))]
+fn parse_json(input: &str) -> Result<JsonValue, serde_json::Error> {
+    serde_json::from_str(input)
+}
+
+#[cfg(feature = "std")]
+fn read_file(path: &std::path::Path) -> Result<String, CanonicalizeError> {
+    std::fs::read_to_string(path)
+        .map_err(|source| CanonicalizeError::Io { path: path.display().to_string(), source })
+}
+
 fn list_equals(lhs: &[Node], rhs: &[Node], options: &DiffOptions) -> bool {
     if lhs.len() != rhs.len() {
         return false;
     }
-    lhs.iter().zip(rhs.iter()).all(|(a, b)| a.eq_with_options(b, options))
+    lhs.iter()
+        .zip(rhs.iter())
+        .enumerate()
+        .all(|(index, (a, b))| a.eq_with_options(b, &options.refine(&list_segment(index))))
 }
 
 fn set_equals(lhs: &[Node], rhs: &[Node], options: &DiffOptions) -> bool {
+    if is_tolerant(options) {
+        // Hash codes cannot see a precision tolerance, so fall back to
+        // pairwise comparison in both directions.
+        let covered = |from: &[Node], to: &[Node]| {
+            from.iter().all(|a| to.iter().any(|b| a.eq_with_options(b, options)))
+        };
+        return covered(lhs, rhs) && covered(rhs, lhs);
+    }
     let lhs_hashes: BTreeSet<HashCode> = lhs.iter().map(|n| n.hash_code(options)).collect();
     let rhs_hashes: BTreeSet<HashCode> = rhs.iter().map(|n| n.hash_code(options)).collect();
     lhs_hashes == rhs_hashes
@@ -311,6 +829,18 @@ fn multiset_equals(lhs: &[Node], rhs: &[Node], options: &DiffOptions) -> bool {
     if lhs.len() != rhs.len() {
         return false;
     }
+    if is_tolerant(options) {
+        let mut unmatched: Vec<&Node> = rhs.iter().collect();
+        for a in lhs {
+            match unmatched.iter().position(|b| a.eq_with_options(b, options)) {
+                Some(index) => {
+                    unmatched.swap_remove(index);
+                }
+                None => return false,
+            }
+        }
+        return true;
+    }
     let mut counts = BTreeMap::new();
     for hash in lhs.iter().map(|n| n.hash_code(options)) {
         *counts.entry(hash).or_insert(0usize) += 1;
@@ -324,15 +854,46 @@ fn multiset_equals(lhs: &[Node], rhs: &[Node], options: &DiffOptions) -> bool {
     counts.values().all(|count| *count == 0)
 }
 
+/// Compares objects key by key. A key missing on one side only matters when
+/// it is not ignored.
+fn object_equals(
+    lhs: &BTreeMap<String, Node>,
+    rhs: &BTreeMap<String, Node>,
+    options: &DiffOptions,
+) -> bool {
+    if lhs.len() != rhs.len() && !options.is_refined() {
+        return false;
+    }
+    let rhs_only = rhs.keys().filter(|key| !lhs.contains_key(*key));
+    lhs.keys().chain(rhs_only).all(|key| {
+        let options = options.refine(&PathSegment::key(key));
+        match (lhs.get(key), rhs.get(key)) {
+            (Some(a), Some(b)) => a.eq_with_options(b, &options),
+            _ => options.is_ignored(),
+        }
+    })
+}
+
+/// Reports whether comparisons under `options` may be looser than hash
+/// equality, either here or further down through path-scoped options,
+/// excluded keys, or comparators.
+fn is_tolerant(options: &DiffOptions) -> bool {
+    options.precision() > 0.0 || options.is_refined()
+}
+
 fn hash_list(values: &[Node], options: &DiffOptions) -> HashCode {
     let mut bytes = Vec::with_capacity(8 + values.len() * 8);
     bytes.extend_from_slice(&LIST_SEED);
-    for value in values {
-        bytes.extend_from_slice(&value.hash_code(options));
+    for (index, value) in values.iter().enumerate() {
+        bytes.extend_from_slice(&value.hash_code(&options.refine(&list_segment(index))));
     }
     hash_bytes(&bytes)
 }
 
+pub(crate) fn list_segment(index: usize) -> PathSegment {
+    PathSegment::Index(i64::try_from(index).unwrap_or(i64::MAX))
+}
+
 fn hash_set(values: &[Node], options: &DiffOptions) -> HashCode {
     let mut unique = BTreeSet::new();
     for value in values {
@@ -350,8 +911,12 @@ fn hash_object(map: &BTreeMap<String, Node>, options: &DiffOptions) -> HashCode
     let mut bytes = Vec::with_capacity(OBJECT_SEED.len() + map.len() * 16);
     bytes.extend_from_slice(&OBJECT_SEED);
     for (key, value) in map {
+        let options = options.refine(&PathSegment::key(key));
+        if options.is_ignored() {
+            continue;
+        }
         bytes.extend_from_slice(&hash_bytes(key.as_bytes()));
-        bytes.extend_from_slice(&value.hash_code(options));
+        bytes.extend_from_slice(&value.hash_code(&options));
     }
     hash_bytes(&bytes)
 }
@@ -392,6 +957,101 @@ mod tests {
         })
     }
 
+    #[test]
+    fn json_parsing_matches_serde_json() {
+        for input in [
+            r#"{"a":[1,-2.5e3,"\u00e9"],"b":{}}"#,
+            "18446744073709551616",
+            "[true,null,0.5]",
+            "[9007199254740993,0.10000000000000000001]",
+        ] {
+            let expected = Node::from_json_value(serde_json::from_str(input).unwrap()).unwrap();
+            let parsed = Node::from_json_value(parse_json(input).unwrap()).unwrap();
+            assert_eq!(parsed, expected, "{input}");
+        }
+        let expected = serde_json::from_str::<JsonValue>("[1,]").unwrap_err();
+        assert_eq!(parse_json("[1,]").unwrap_err().to_string(), expected.to_string());
+    }
+
+    #[test]
+    fn typed_numbers_keep_integers_and_floats_apart() {
+        let typed = DiffOptions::default().with_number_equality(NumberEquality::Typed);
+        let node = |json: &str| Node::from_json_str(json).unwrap();
+        assert!(node("1").eq_with_options(&node("1.0"), &DiffOptions::default()));
+        assert!(!node("1").eq_with_options(&node("1.0"), &typed));
+        assert!(node("1.0").eq_with_options(&node("1e0"), &typed));
+        assert_ne!(node("1").hash_code(&typed), node("1.0").hash_code(&typed));
+
+        let sets = typed.clone().with_array_mode(ArrayMode::Set).unwrap();
+        assert!(node("[1,2.0]").eq_with_options(&node("[2.0,1]"), &sets));
+        let diff = node("[1]").diff(&node("[1.0]"), &sets);
+        assert_eq!(diff.len(), 1);
+        assert_eq!(node("[1]").apply_patch_with_options(&diff, &sets).unwrap(), node("[1.0]"));
+
+        let diff = crate::Diff::from_native_str("@ [\"n\"]\n- 1.0\n+ 2\n").unwrap();
+        assert!(node(r#"{"n":1}"#).apply_patch_with_options(&diff, &typed).is_err());
+        assert!(node(r#"{"n":1}"#).apply_patch(&diff).is_ok());
+    }
+
+    #[test]
+    fn option_equality_agrees_with_empty_diffs() {
+        let options = |json: &str| DiffOptions::from_json_str(json).unwrap();
+        for (lhs, rhs, opts, equal) in [
+            ("[1,2,2]", "[2,1]", options(r#"["SET"]"#), true),
+            ("[1,2,2]", "[2,1]", options(r#"["MULTISET"]"#), false),
+            ("[1,2,2]", "[2,2,1]", options(r#"["MULTISET"]"#), true),
+            ("[1.0,2]", "[1.05,2]", options(r#"[{"precision":0.1}]"#), true),
+            ("[1.0,2]", "[1.5,2]", options(r#"[{"precision":0.1}]"#), false),
+            (
+                r#"{"a":[1,2],"b":[1,2]}"#,
+                r#"{"a":[2,1],"b":[1,2]}"#,
+                options(r#"[{"@":["a"],"^":["SET"]}]"#),
+                true,
+            ),
+            (
+                r#"{"a":[1,2],"b":[1,2]}"#,
+                r#"{"a":[1,2],"b":[2,1]}"#,
+                options(r#"[{"@":["a"],"^":["SET"]}]"#),
+                false,
+            ),
+            (
+                r#"[{"id":1,"n":1},{"id":2}]"#,
+                r#"[{"id":2},{"id":1,"n":2}]"#,
+                options(r#"[{"setkeys":["id"]}]"#),
+                false,
+            ),
+            (
+                r#"{"id":1,"meta":{"uid":"a"}}"#,
+                r#"{"id":1,"meta":{"uid":"b"}}"#,
+                options(r#"[{"ignore":[["meta","uid"]]}]"#),
+                true,
+            ),
+            (
+                r#"{"_links":1,"v":[{"_at":1}]}"#,
+                r#"{"_links":2,"v":[{"_at":2}]}"#,
+                options(r#"[{"excludeKeys":["^_"]}]"#),
+                true,
+            ),
+        ] {
+            let (lhs, rhs) = (Node::from_json_str(lhs).unwrap(), Node::from_json_str(rhs).unwrap());
+            assert_eq!(lhs.eq_with_options(&rhs, &opts), equal, "{lhs:?} {rhs:?}");
+            assert_eq!(lhs.diff(&rhs, &opts).is_empty(), equal, "{lhs:?} {rhs:?}");
+        }
+    }
+
+    #[test]
+    fn structural_hashes_are_stable() {
+        for (json, expected) in [
+            ("null", NULL_HASH),
+            ("1", [0xB8, 0x1D, 0xBA, 0x29, 0x32, 0x69, 0xB1, 0xAA]),
+            ("\"jd\"", [0x3B, 0xE4, 0x64, 0xB5, 0x07, 0x60, 0xC1, 0x08]),
+            ("[1,2]", [0xE4, 0xA4, 0xFC, 0xDF, 0x10, 0xDB, 0xB7, 0xC8]),
+            (r#"{"a":[1,"x"],"b":null}"#, [0xDA, 0x26, 0x54, 0x56, 0xB8, 0xD3, 0x33, 0x95]),
+        ] {
+            assert_eq!(Node::from_json_str(json).unwrap().structural_hash(), expected, "{json}");
+        }
+    }
+
     #[test]
     fn json_whitespace_is_void() {
         let node = Node::from_json_str("   \n\t").expect("whitespace should canonicalize to void");
@@ -412,7 +1072,7 @@ mod tests {
         let value = node.to_json_value().unwrap();
         assert_eq!(value, serde_json::json!(5));
 
-        let neg_zero = Node::from_json_str("-0").unwrap();
+        let neg_zero = Node::from_json_str("-0.0").unwrap();
         let neg_zero_value = neg_zero.to_json_value().unwrap();
         assert_eq!(serde_json::to_string(&neg_zero_value).unwrap(), "-0.0");
     }
@@ -434,6 +1094,40 @@ mod tests {
         };
     }
 
+    #[test]
+    fn yaml_streams_split_into_documents() {
+        let documents =
+            Node::from_yaml_documents_str("---\na: 1\n---\n[1, 2]\n---\n---\n\"b\"\n").unwrap();
+        assert_eq!(
+            documents,
+            vec![
+                Node::from_json_str(r#"{"a":1}"#).unwrap(),
+                Node::from_json_str("[1,2]").unwrap(),
+                Node::String("b".into()),
+            ]
+        );
+        assert!(Node::from_yaml_documents_str("").unwrap().is_empty());
+    }
+
+    #[test]
+    fn yaml_scalars_normalize_like_json() {
+        let yaml =
+            Node::from_yaml_str("name: service\nretries: 2\nratio: 0.5\nenabled: true\nnote: ~\n")
+                .unwrap();
+        let json = Node::from_json_str(
+            "{\"name\":\"service\",\"retries\":2,\"ratio\":0.5,\"enabled\":true,\"note\":null}",
+        )
+        .unwrap();
+        assert_eq!(yaml, json);
+    }
+
+    #[test]
+    #[cfg(feature = "std")]
+    fn missing_files_report_the_path() {
+        let err = Node::from_yaml_file("/nonexistent/jd-core.yaml").unwrap_err();
+        assert!(err.to_string().starts_with("failed to read /nonexistent/jd-core.yaml:"));
+    }
+
     #[test]
     fn number_precision_controls_equality() {
         let lhs = Node::from_json_str("1.0").unwrap();
@@ -1,12 +1,30 @@
-use serde::{Deserialize, Serialize};
+use core::cmp::Ordering;
+use core::fmt;
+
+use serde::{Deserialize, Deserializer, Serialize, Serializer};
 use serde_json::Number as JsonNumber;
 
+use crate::prelude::*;
 use crate::{hash::hash_bytes, CanonicalizeError};
 
 /// Represents a JSON number using IEEE-754 double precision, mirroring Go's `float64`.
-#[derive(Clone, Copy, Debug, PartialOrd, Serialize, Deserialize)]
-#[serde(transparent)]
-pub struct Number(f64);
+///
+/// A number parsed from JSON text that a double cannot hold exactly, such as
+/// an identifier beyond 2^53 or a decimal with more than 15 significant
+/// digits, also keeps its original literal. Such numbers compare, hash, and
+/// render by that literal, so distinct values never collapse into the same
+/// double (ADR 0006). Every other number behaves exactly like Go's `float64`.
+///
+/// Whether a number was written as an integer is recorded as well, for
+/// [`NumberEquality::Typed`](crate::NumberEquality::Typed) comparisons.
+#[derive(Clone, Debug)]
+pub struct Number {
+    value: f64,
+    literal: Option<Box<str>>,
+    integer: bool,
+    /// Render integral values with a fraction, as in `1.0`.
+    float_form: bool,
+}
 
 impl Number {
     /// Creates a new [`Number`] after validating finiteness.
@@ -18,12 +36,29 @@ impl Number {
     /// ```
     pub fn new(value: f64) -> Result<Self, CanonicalizeError> {
         if value.is_finite() {
-            Ok(Self(value))
+            Ok(Self { value, literal: None, integer: is_integral(value), float_form: false })
         } else {
             Err(CanonicalizeError::NotFinite { value })
         }
     }
 
+    /// Creates a [`Number`] from a JSON number literal, keeping the literal
+    /// when the nearest double does not represent it exactly.
+    pub(crate) fn from_literal(text: &str) -> Result<Self, CanonicalizeError> {
+        let value = text
+            .parse::<f64>()
+            .ok()
+            .filter(|value| value.is_finite())
+            .ok_or_else(|| CanonicalizeError::NumberOutOfRange { value: text.to_string() })?;
+        let exact = Decimal::parse(text) == Decimal::parse(&value.to_string());
+        Ok(Self {
+            value,
+            literal: (!exact).then(|| text.into()),
+            integer: !text.contains(['.', 'e', 'E']),
+            float_form: false,
+        })
+    }
+
     /// Returns the raw floating-point value.
     ///
     /// ```
@@ -32,21 +67,62 @@ impl Number {
     /// assert_eq!(num.get(), 1.5);
     /// ```
     #[must_use]
-    pub fn get(self) -> f64 {
-        self.0
+    pub fn get(&self) -> f64 {
+        self.value
+    }
+
+    /// Returns the original literal when the number was parsed from text
+    /// that [`get`](Self::get) cannot represent exactly.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let Node::Number(id) = Node::from_json_str("9007199254740993").unwrap() else { panic!() };
+    /// assert_eq!(id.literal(), Some("9007199254740993"));
+    /// assert_eq!(id.get(), 9007199254740992.0);
+    /// let Node::Number(small) = Node::from_json_str("1.50").unwrap() else { panic!() };
+    /// assert_eq!(small.literal(), None);
+    /// ```
+    #[must_use]
+    pub fn literal(&self) -> Option<&str> {
+        self.literal.as_deref()
     }
 
-    /// Compares two numbers using the provided absolute tolerance.
+    /// Reports whether the number was written as an integer, without a
+    /// fraction or exponent. Numbers built from an `f64` count as integers
+    /// when they have no fractional part.
+    ///
+    /// ```
+    /// # use jd_core::{Node, Number};
+    /// let Node::Number(float) = Node::from_json_str("1.0").unwrap() else { panic!() };
+    /// assert!(!float.is_integer());
+    /// assert!(Number::new(1.0).unwrap().is_integer());
+    /// ```
+    #[must_use]
+    pub fn is_integer(&self) -> bool {
+        self.integer
+    }
+
+    /// Marks a number written with a fraction or exponent to render that
+    /// way even when its value is integral, so `1.0` does not print as `1`.
+    pub(crate) fn show_float_form(&mut self) {
+        self.float_form = !self.integer;
+    }
+
+    /// Compares two numbers using the provided absolute tolerance. Without a
+    /// tolerance the comparison is exact, including preserved literals.
     ///
     /// ```
     /// # use jd_core::Number;
     /// let lhs = Number::new(10.0).expect("finite");
     /// let rhs = Number::new(10.4).expect("finite");
-    /// assert!(lhs.equals_with_precision(rhs, 0.5));
+    /// assert!(lhs.equals_with_precision(&rhs, 0.5));
     /// ```
     #[must_use]
-    pub fn equals_with_precision(self, other: Self, precision: f64) -> bool {
-        (self.0 - other.0).abs() <= precision
+    pub fn equals_with_precision(&self, other: &Self, precision: f64) -> bool {
+        if precision == 0.0 {
+            return self == other;
+        }
+        (self.value - other.value).abs() <= precision
     }
 
     /// Computes the hash code following the Go implementation's strategy.
@@ -58,8 +134,11 @@ impl Number {
     /// assert_eq!(hash.len(), 8);
     /// ```
     #[must_use]
-    pub fn hash_code(self) -> crate::hash::HashCode {
-        hash_bytes(&self.0.to_le_bytes())
+    pub fn hash_code(&self) -> crate::hash::HashCode {
+        match &self.literal {
+            Some(literal) => hash_bytes(Decimal::parse(literal).to_string().as_bytes()),
+            None => hash_bytes(&self.value.to_le_bytes()),
+        }
     }
 
     /// Converts the number into a `serde_json::Number` using minimal integer representation when possible.
@@ -71,21 +150,217 @@ impl Number {
     /// let as_float = Number::new(5.25).expect("finite").to_json_number();
     /// assert!(as_float.as_f64().unwrap() > 5.0);
     /// ```
-    pub fn to_json_number(self) -> JsonNumber {
-        if self.0.fract() == 0.0 && !(self.0 == 0.0 && self.0.is_sign_negative()) {
-            if (i64::MIN as f64) <= self.0 && self.0 <= (i64::MAX as f64) {
-                return JsonNumber::from(self.0 as i64);
+    pub fn to_json_number(&self) -> JsonNumber {
+        if let Some(literal) = &self.literal {
+            return serde_json::from_str(literal).expect("literal is a JSON number");
+        }
+        let value = self.value;
+        if is_integral(value) && !self.float_form && !(value == 0.0 && value.is_sign_negative()) {
+            if (i64::MIN as f64) <= value && value <= (i64::MAX as f64) {
+                return JsonNumber::from(value as i64);
             }
-            if self.0 >= 0.0 && self.0 <= (u64::MAX as f64) {
-                return JsonNumber::from(self.0 as u64);
+            if value >= 0.0 && value <= (u64::MAX as f64) {
+                return JsonNumber::from(value as u64);
             }
         }
-        JsonNumber::from_f64(self.0).expect("finite number")
+        JsonNumber::from_f64(value).expect("finite number")
+    }
+
+    fn decimal(&self) -> Decimal {
+        match &self.literal {
+            Some(literal) => Decimal::parse(literal),
+            None => Decimal::parse(&self.value.to_string()),
+        }
     }
 }
 
 impl PartialEq for Number {
     fn eq(&self, other: &Self) -> bool {
-        self.0 == other.0
+        match (&self.literal, &other.literal) {
+            (None, None) => self.value == other.value,
+            _ => self.decimal() == other.decimal(),
+        }
+    }
+}
+
+impl PartialOrd for Number {
+    /// Orders by value. Preserved literals that round to the same double but
+    /// differ are unordered.
+    fn partial_cmp(&self, other: &Self) -> Option<Ordering> {
+        match self.value.partial_cmp(&other.value) {
+            Some(Ordering::Equal) if self != other => None,
+            ordering => ordering,
+        }
+    }
+}
+
+/// Serialized as [`Number::to_json_number`], so integers stay integers and
+/// preserved literals keep their digits.
+impl Serialize for Number {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        self.to_json_number().serialize(serializer)
+    }
+}
+
+impl<'de> Deserialize<'de> for Number {
+    fn deserialize<D: Deserializer<'de>>(deserializer: D) -> Result<Self, D::Error> {
+        let number = JsonNumber::deserialize(deserializer)?;
+        Self::from_literal(&number.to_string()).map_err(serde::de::Error::custom)
+    }
+}
+
+/// A decimal literal reduced to its sign, significant digits, and exponent,
+/// so that one value compares equal however it was written: `1.50`, `15e-1`,
+/// and `0.15E1` all become `0.15e1`.
+#[derive(Debug, PartialEq, Eq)]
+struct Decimal {
+    negative: bool,
+    digits: String,
+    exponent: i64,
+}
+
+impl Decimal {
+    /// Parses a JSON number literal or the `Display` output of an `f64`.
+    fn parse(text: &str) -> Self {
+        let (negative, unsigned) = match text.strip_prefix('-') {
+            Some(rest) => (true, rest),
+            None => (false, text),
+        };
+        let (mantissa, exponent) = match unsigned.split_once(['e', 'E']) {
+            Some((mantissa, exponent)) => {
+                // Exponents too large for `i64` are far outside `f64` anyway;
+                // clamping keeps them ordered without overflowing below.
+                let clamped = if exponent.starts_with('-') { i64::MIN / 4 } else { i64::MAX / 4 };
+                (mantissa, exponent.parse().unwrap_or(clamped).clamp(i64::MIN / 4, i64::MAX / 4))
+            }
+            None => (unsigned, 0),
+        };
+        let (integer, fraction) = mantissa.split_once('.').unwrap_or((mantissa, ""));
+        let all: String = integer.chars().chain(fraction.chars()).collect();
+        let significant = all.trim_start_matches('0');
+        let leading = all.len() - significant.len();
+        let digits = significant.trim_end_matches('0');
+        if digits.is_empty() {
+            return Self { negative: false, digits: String::new(), exponent: 0 };
+        }
+        Self {
+            negative,
+            digits: digits.to_string(),
+            exponent: exponent + integer.len() as i64 - leading as i64,
+        }
+    }
+}
+
+impl fmt::Display for Decimal {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let sign = if self.negative { "-" } else { "" };
+        write!(f, "{sign}0.{}e{}", self.digits, self.exponent)
+    }
+}
+
+/// Doubles this large in magnitude have no fractional bits.
+const INTEGRAL_BOUND: f64 = 4_503_599_627_370_496.0;
+
+/// Reports whether `value` is finite and whole, as `value.fract() == 0.0`
+/// does with `std`.
+pub(crate) fn is_integral(value: f64) -> bool {
+    value.is_finite() && trunc(value) == value
+}
+
+/// Rounds half away from zero, as `f64::round` does with `std`.
+pub(crate) fn round(value: f64) -> f64 {
+    let whole = trunc(value);
+    match value - whole {
+        fraction if fraction >= 0.5 => whole + 1.0,
+        fraction if fraction <= -0.5 => whole - 1.0,
+        _ => whole,
+    }
+}
+
+fn trunc(value: f64) -> f64 {
+    if value.abs() < INTEGRAL_BOUND {
+        value as i64 as f64
+    } else {
+        value
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn number(text: &str) -> Number {
+        Number::from_literal(text).unwrap()
+    }
+
+    #[test]
+    fn decimals_normalize_equal_values() {
+        for text in ["1.50", "15e-1", "0.15E1", "1.5", "000.0150e2"] {
+            assert_eq!(Decimal::parse(text).to_string(), "0.15e1", "{text}");
+        }
+        assert_eq!(Decimal::parse("-0.000"), Decimal::parse("0"));
+        assert_eq!(Decimal::parse("120").to_string(), "0.12e3");
+    }
+
+    #[test]
+    fn literals_are_kept_only_when_the_double_is_inexact() {
+        for exact in ["1", "1.0", "-0", "0.1", "1e300", "9007199254740992", "123456789012345"] {
+            assert_eq!(number(exact).literal(), None, "{exact}");
+        }
+        for inexact in ["9007199254740993", "0.10000000000000000001", "12345678901234567890"] {
+            assert_eq!(number(inexact).literal(), Some(inexact));
+        }
+        assert!(matches!(
+            Number::from_literal("1e400"),
+            Err(CanonicalizeError::NumberOutOfRange { .. })
+        ));
+    }
+
+    #[test]
+    fn preserved_literals_compare_and_hash_losslessly() {
+        let (lhs, rhs) = (number("9007199254740993"), number("9007199254740992"));
+        assert_eq!(lhs.get(), rhs.get());
+        assert_ne!(lhs, rhs);
+        assert_ne!(lhs.hash_code(), rhs.hash_code());
+        assert_eq!(lhs.partial_cmp(&rhs), None);
+        assert!(lhs.equals_with_precision(&rhs, 1.0));
+
+        let (same, respelled) = (number("9007199254740993"), number("90071992547409930e-1"));
+        assert_eq!(same, respelled);
+        assert_eq!(same.hash_code(), respelled.hash_code());
+        assert_eq!(same.to_json_number().to_string(), "9007199254740993");
+    }
+
+    #[test]
+    fn float_form_keeps_the_fraction_of_integral_floats() {
+        let (mut float, mut integer) = (number("1.0"), number("1"));
+        assert_eq!(float.to_json_number().to_string(), "1");
+        float.show_float_form();
+        integer.show_float_form();
+        assert_eq!(float.to_json_number().to_string(), "1.0");
+        assert_eq!(integer.to_json_number().to_string(), "1");
+        assert_eq!(float, integer);
+        assert_eq!(float.hash_code(), integer.hash_code());
+    }
+
+    #[test]
+    fn serde_keeps_integers_and_literals() {
+        for text in ["2", "-0.5", "9007199254740993", "1.5e3"] {
+            let json = serde_json::to_string(&number(text)).unwrap();
+            let back: Number = serde_json::from_str(&json).unwrap();
+            assert_eq!(back, number(text), "{text}");
+        }
+        assert_eq!(serde_json::to_string(&number("2")).unwrap(), "2");
+        assert_eq!(serde_json::to_string(&number("9007199254740993")).unwrap(), "9007199254740993");
+    }
+
+    #[test]
+    fn integral_and_round_match_std() {
+        for value in [0.0, -0.0, 0.4, -0.5, 1.5, -2.5, 2.4999, 1e300, -4503599627370497.0] {
+            assert_eq!(is_integral(value), value.fract() == 0.0, "{value}");
+            assert_eq!(round(value).abs(), value.round().abs(), "{value}");
+        }
+        assert!(!is_integral(f64::INFINITY) && !is_integral(f64::NAN));
+        assert_eq!(round(f64::NEG_INFINITY), f64::NEG_INFINITY);
     }
 }
@@ -1,8 +1,20 @@
-use std::fmt;
+use alloc::borrow::Cow;
+use alloc::sync::Arc;
+use core::fmt;
+use core::str::FromStr;
 
-use serde::{Deserialize, Serialize};
+use regex::Regex;
+use serde::{Deserialize, Deserializer, Serialize, Serializer};
+use serde_json::{json, Value as JsonValue};
 
-use crate::OptionsError;
+use crate::diff::{DiffBudget, Path, PathSegment};
+use crate::prelude::*;
+use crate::progress::{ProgressPhase, ProgressTracker};
+use crate::query::QueryCursor;
+use crate::{
+    CancellationToken, HashCode, JsonPath, Node, NodeComparator, Number, OptionsError, Preset,
+    ProgressReporter, StrategicMerge,
+};
 
 /// Controls how arrays are interpreted during equality and diff operations.
 #[derive(Clone, Copy, Debug, PartialEq, Eq, Serialize, Deserialize)]
@@ -21,17 +33,299 @@ impl Default for ArrayMode {
     }
 }
 
+/// Controls whether numbers written as integers and as floats can be equal.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub enum NumberEquality {
+    /// Numbers are equal when their values are, so `1` equals `1.0`, as in
+    /// Go `jd` (default).
+    #[default]
+    Numeric,
+    /// Numbers written as integers never equal numbers written with a
+    /// fraction or exponent, so `1` and `1.0` differ while `1.0` and `1e0`
+    /// do not.
+    Typed,
+}
+
+/// Controls how the elements of two lists are lined up before diffing.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub enum ListAlignment {
+    /// Longest common subsequence, matching Go `jd` (default).
+    #[default]
+    Lcs,
+    /// Patience alignment: elements that occur once on each side are lined
+    /// up first, so repeated values do not pull unrelated parts together.
+    Patience,
+}
+
+/// Controls how closely a document must match a diff for the diff to apply.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub enum PatchStrictness {
+    /// Removed values and list context must match the document exactly, as
+    /// in Go `jd` (default).
+    #[default]
+    Strict,
+    /// Hunks apply by path alone: removed values and list context are not
+    /// compared, removing a value that is already gone succeeds, and list
+    /// insertions past the end append. The containers on the path must
+    /// still exist.
+    Lenient,
+    /// Like [`PatchStrictness::Lenient`], and missing objects and lists on
+    /// the path are created, as are objects matching a set-keys segment.
+    Force,
+}
+
+/// Controls what patching does when the context around a list hunk does not
+/// match the document.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub enum ContextMismatch {
+    /// The hunk fails, as in Go `jd` (default).
+    #[default]
+    Error,
+    /// The hunk applies at its index, and the mismatch is reported by
+    /// [`Node::apply_patch_fuzzy`] and [`Node::apply_patch_partial`].
+    Warn,
+    /// The hunk applies at its index without a report.
+    Ignore,
+}
+
+/// Controls what a reader does with an object that lists a key more than
+/// once.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub enum DuplicateKeys {
+    /// The last value wins, as in Go `jd` (default).
+    #[default]
+    LastWins,
+    /// The first value wins and later ones are skipped.
+    FirstWins,
+    /// A repeated key is a parse error.
+    Error,
+}
+
+/// Options for reading JSON and YAML documents into [`Node`]s.
+///
+/// ```
+/// # use jd_core::{DuplicateKeys, Node, ParseOptions};
+/// let text = r#"{"a":1,"a":2}"#;
+/// let first = ParseOptions::default().with_duplicate_keys(DuplicateKeys::FirstWins);
+/// assert_eq!(Node::from_json_str_with_options(text, &first).unwrap(), Node::from_json_str(r#"{"a":1}"#).unwrap());
+/// assert_eq!(Node::from_json_str(text).unwrap(), Node::from_json_str(r#"{"a":2}"#).unwrap());
+/// ```
+#[derive(Clone, Debug, Default)]
+pub struct ParseOptions {
+    duplicate_keys: DuplicateKeys,
+    jsonc: bool,
+    progress: Option<Arc<dyn ProgressReporter>>,
+}
+
+impl PartialEq for ParseOptions {
+    fn eq(&self, other: &Self) -> bool {
+        let same_progress = match (&self.progress, &other.progress) {
+            (Some(lhs), Some(rhs)) => Arc::ptr_eq(lhs, rhs),
+            (lhs, rhs) => lhs.is_none() && rhs.is_none(),
+        };
+        self.duplicate_keys == other.duplicate_keys && self.jsonc == other.jsonc && same_progress
+    }
+}
+
+impl Eq for ParseOptions {}
+
+impl ParseOptions {
+    /// Selects how objects that repeat a key are read. Without this, the
+    /// last value wins for both JSON and YAML.
+    ///
+    /// ```
+    /// # use jd_core::{DuplicateKeys, Node, ParseOptions};
+    /// let strict = ParseOptions::default().with_duplicate_keys(DuplicateKeys::Error);
+    /// let err = Node::from_json_str_with_options(r#"{"a":1,"a":2}"#, &strict).unwrap_err();
+    /// assert!(err.to_string().starts_with(r#"invalid JSON: duplicate key "a""#));
+    /// ```
+    #[must_use]
+    pub fn with_duplicate_keys(mut self, policy: DuplicateKeys) -> Self {
+        self.duplicate_keys = policy;
+        self
+    }
+
+    /// Returns the duplicate key policy.
+    ///
+    /// ```
+    /// # use jd_core::{DuplicateKeys, ParseOptions};
+    /// assert_eq!(ParseOptions::default().duplicate_keys(), DuplicateKeys::LastWins);
+    /// ```
+    #[must_use]
+    pub fn duplicate_keys(&self) -> DuplicateKeys {
+        self.duplicate_keys
+    }
+
+    /// Reads JSON input as JSONC, the comment-tolerant dialect of
+    /// `tsconfig.json` and VS Code settings: `//` and `/* */` comments and
+    /// trailing commas are ignored. YAML input is unaffected.
+    ///
+    /// ```
+    /// # use jd_core::{Node, ParseOptions};
+    /// let text = "{\n  // strict mode\n  \"strict\": true, /* for now */\n}";
+    /// assert!(Node::from_json_str(text).is_err());
+    /// let jsonc = ParseOptions::default().with_jsonc(true);
+    /// let node = Node::from_json_str_with_options(text, &jsonc).unwrap();
+    /// assert_eq!(node, Node::from_json_str(r#"{"strict":true}"#).unwrap());
+    /// ```
+    #[must_use]
+    pub fn with_jsonc(mut self, enabled: bool) -> Self {
+        self.jsonc = enabled;
+        self
+    }
+
+    /// Reports whether JSON input is read as JSONC.
+    ///
+    /// ```
+    /// # use jd_core::ParseOptions;
+    /// assert!(!ParseOptions::default().jsonc());
+    /// ```
+    #[must_use]
+    pub fn jsonc(&self) -> bool {
+        self.jsonc
+    }
+
+    /// Sends [`Progress`](crate::Progress) reports from reading JSON and
+    /// YAML to `reporter`. JSON is read through a buffer when progress is
+    /// reported, so bytes are counted as the parser takes them.
+    ///
+    /// ```
+    /// # use std::sync::{Arc, Mutex};
+    /// # use jd_core::{Node, ParseOptions, Progress, ProgressPhase, ProgressReporter};
+    /// #[derive(Debug, Default)]
+    /// struct Reports(Mutex<Vec<Progress>>);
+    ///
+    /// impl ProgressReporter for Reports {
+    ///     fn report(&self, progress: &Progress) {
+    ///         self.0.lock().unwrap().push(*progress);
+    ///     }
+    /// }
+    ///
+    /// let reports = Arc::new(Reports::default());
+    /// let options = ParseOptions::default().with_progress(reports.clone());
+    /// Node::from_json_str_with_options(r#"{"a":[1,2,3]}"#, &options).unwrap();
+    /// let last = *reports.0.lock().unwrap().last().unwrap();
+    /// assert_eq!((last.phase, last.bytes_parsed, last.finished), (ProgressPhase::Parse, 13, true));
+    /// ```
+    #[must_use]
+    pub fn with_progress<R>(mut self, reporter: R) -> Self
+    where
+        R: ProgressReporter + 'static,
+    {
+        self.progress = Some(Arc::new(reporter));
+        self
+    }
+
+    /// Returns the reporter progress goes to, if any.
+    #[must_use]
+    pub fn progress(&self) -> Option<&dyn ProgressReporter> {
+        self.progress.as_deref()
+    }
+
+    /// Starts progress totals for one parse, when its progress is reported.
+    pub(crate) fn tracker(&self) -> Option<ProgressTracker> {
+        self.progress.clone().map(|reporter| ProgressTracker::new(reporter, ProgressPhase::Parse))
+    }
+}
+
 /// Configuration knobs passed to equality and diff operations.
+///
+/// Options apply to the whole document unless they are scoped to a subtree
+/// with [`DiffOptions::with_path_option`].
 #[derive(Clone, Debug, Serialize, Deserialize)]
 pub struct DiffOptions {
     array_mode: ArrayMode,
     precision: f64,
     set_keys: Option<Vec<String>>,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    path_options: Vec<PathOption>,
+    #[serde(default)]
+    ignored: bool,
+    #[serde(default)]
+    detect_moves: bool,
+    #[serde(default)]
+    list_alignment: ListAlignment,
+    /// Largest list alignment cost, which has no Go JSON form.
+    #[serde(skip)]
+    max_alignment_cost: Option<u64>,
+    /// Context elements around list hunks, which has no Go JSON form.
+    #[serde(skip)]
+    context_size: Option<usize>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    similarity_threshold: Option<f64>,
+    #[serde(default)]
+    number_equality: NumberEquality,
+    /// How patches match documents, which has no Go JSON form.
+    #[serde(skip)]
+    patch_strictness: PatchStrictness,
+    /// What patching does with list context that does not match, which
+    /// has no Go JSON form.
+    #[serde(skip)]
+    context_mismatch: ContextMismatch,
+    /// How far list hunks may move from their index when patching.
+    #[serde(skip)]
+    patch_fuzz: usize,
+    #[serde(default, skip_serializing_if = "Vec::is_empty", with = "key_patterns")]
+    excluded_keys: Vec<Regex>,
+    #[serde(skip)]
+    comparators: Vec<Arc<dyn NodeComparator>>,
+    /// Options scoped by JSONPath expressions, which have no Go JSON form.
+    #[serde(skip)]
+    query_options: Vec<QueryOption>,
+    /// Array settings to restore below the members of a list that a
+    /// list-scoped query option configured.
+    #[serde(skip)]
+    list_scope: Option<Box<ListScope>>,
+    /// Path of the value these options apply to, tracked only while
+    /// comparators need it.
+    #[serde(skip)]
+    location: Path,
+    #[serde(skip)]
+    max_elements: Option<usize>,
+    #[serde(skip)]
+    max_bytes: Option<usize>,
+    /// Hunks found so far by the diff these options are running, shared by
+    /// every refinement of them.
+    #[serde(skip)]
+    budget: Option<Arc<DiffBudget>>,
+    #[serde(skip)]
+    cancellation: Option<CancellationToken>,
+    #[serde(skip)]
+    progress: Option<Arc<dyn ProgressReporter>>,
+    /// Totals of the diff these options are running, shared like `budget`.
+    #[serde(skip)]
+    tracker: Option<Arc<ProgressTracker>>,
 }
 
 impl Default for DiffOptions {
     fn default() -> Self {
-        Self { array_mode: ArrayMode::List, precision: 0.0, set_keys: None }
+        Self {
+            array_mode: ArrayMode::List,
+            precision: 0.0,
+            set_keys: None,
+            path_options: Vec::new(),
+            ignored: false,
+            detect_moves: false,
+            list_alignment: ListAlignment::Lcs,
+            max_alignment_cost: None,
+            context_size: None,
+            similarity_threshold: None,
+            number_equality: NumberEquality::Numeric,
+            patch_strictness: PatchStrictness::Strict,
+            context_mismatch: ContextMismatch::Error,
+            patch_fuzz: 0,
+            excluded_keys: Vec::new(),
+            comparators: Vec::new(),
+            query_options: Vec::new(),
+            list_scope: None,
+            location: Path::new(),
+            max_elements: None,
+            max_bytes: None,
+            budget: None,
+            cancellation: None,
+            progress: None,
+            tracker: None,
+        }
     }
 }
 
@@ -141,6 +435,886 @@ impl DiffOptions {
         Ok(self)
     }
 
+    /// Returns the options scoped to subtrees of the document.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOption, DiffOptions, PathOption, PathSegment};
+    /// let scoped = PathOption::new(PathSegment::key("tags"), vec![DiffOption::Set]);
+    /// let opts = DiffOptions::default().with_path_option(scoped).expect("path option");
+    /// assert_eq!(opts.path_options().len(), 1);
+    /// ```
+    #[must_use]
+    pub fn path_options(&self) -> &[PathOption] {
+        &self.path_options
+    }
+
+    /// Excludes the values at `paths` from comparison, for volatile fields
+    /// such as timestamps or generated IDs.
+    ///
+    /// Ignored values always compare equal and produce no hunks, and an
+    /// ignored object key is skipped even when only one side has it. Paths
+    /// address values like [`DiffOptions::with_path_option`] does; an empty
+    /// path ignores the whole document.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, Path, PathSegment};
+    /// let lhs = Node::from_json_str(r#"{"name":"a","meta":{"version":1}}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"name":"a","meta":{"version":2,"uid":"x"}}"#).unwrap();
+    /// let meta = |key: &str| Path::from(vec![PathSegment::key("meta"), PathSegment::key(key)]);
+    /// let opts = DiffOptions::default().with_ignored_paths([meta("version"), meta("uid")]);
+    /// assert!(lhs.diff(&rhs, &opts).is_empty());
+    /// ```
+    #[must_use]
+    pub fn with_ignored_paths<I, P>(mut self, paths: I) -> Self
+    where
+        I: IntoIterator<Item = P>,
+        P: Into<Path>,
+    {
+        for path in paths {
+            self.ignore(path.into());
+        }
+        self
+    }
+
+    /// Excludes object keys matching any of the regular expressions from
+    /// comparison, on both sides and in every object beneath the scope the
+    /// options apply to. Patterns are unanchored, so use `^` and `$` to match
+    /// whole keys.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"{"name":"a","_etag":"1","meta":{"created_at":1}}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"name":"b","_etag":"2","meta":{"created_at":2}}"#).unwrap();
+    /// let opts = DiffOptions::default().with_excluded_keys(["^_", "_at$"]).expect("patterns");
+    /// let rendered = lhs.diff(&rhs, &opts).render(&RenderConfig::default());
+    /// assert_eq!(rendered, "@ [\"name\"]\n- \"a\"\n+ \"b\"\n");
+    /// ```
+    pub fn with_excluded_keys<I, S>(mut self, patterns: I) -> Result<Self, OptionsError>
+    where
+        I: IntoIterator<Item = S>,
+        S: AsRef<str>,
+    {
+        for pattern in patterns {
+            self.excluded_keys.push(compile_key_pattern(pattern.as_ref())?);
+        }
+        Ok(self)
+    }
+
+    /// Reports list elements that changed position as moves rather than as
+    /// a removal and an addition. Each move becomes a single hunk whose
+    /// [`DiffElement::moved_from`](crate::DiffElement::moved_from) names the
+    /// old position. This is a `jd-rs` extension; Go `jd` cannot read moves.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"["a","b","c"]"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"["c","a","b"]"#).unwrap();
+    /// let opts = DiffOptions::default().with_move_detection(true);
+    /// let diff = lhs.diff(&rhs, &opts);
+    /// assert_eq!(diff.render(&RenderConfig::default()), "^ {\"from\":[2]}\n@ [0]\n[\n+ \"c\"\n  \"a\"\n");
+    /// assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+    /// ```
+    #[must_use]
+    pub fn with_move_detection(mut self, enabled: bool) -> Self {
+        self.detect_moves = enabled;
+        self
+    }
+
+    /// Reports whether list moves are detected.
+    #[must_use]
+    pub fn detects_moves(&self) -> bool {
+        self.detect_moves
+    }
+
+    /// Selects how list elements are aligned before they are diffed. The
+    /// default, [`ListAlignment::Lcs`], matches Go `jd`;
+    /// [`ListAlignment::Patience`] gives more readable hunks for lists with
+    /// many repeated elements.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, ListAlignment, Node, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"["a",{},{}]"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"[{},"b",{},{}]"#).unwrap();
+    /// let opts = DiffOptions::default().with_list_alignment(ListAlignment::Patience);
+    /// let diff = lhs.diff(&rhs, &opts);
+    /// // The default alignment needs three hunks for the same change.
+    /// assert_eq!(lhs.diff(&rhs, &DiffOptions::default()).len(), 3);
+    /// assert_eq!(
+    ///     diff.render(&RenderConfig::default()),
+    ///     "@ [0]\n[\n- \"a\"\n+ {}\n+ \"b\"\n  {}\n"
+    /// );
+    /// assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+    /// ```
+    #[must_use]
+    pub fn with_list_alignment(mut self, alignment: ListAlignment) -> Self {
+        self.list_alignment = alignment;
+        self
+    }
+
+    /// Returns the list alignment strategy.
+    #[must_use]
+    pub fn list_alignment(&self) -> ListAlignment {
+        self.list_alignment
+    }
+
+    /// Limit of [`DiffOptions::with_max_alignment_cost`] unless set: about
+    /// 134 million comparisons, a few seconds of work, reached by two
+    /// lists of 11,585 elements holding the same values in different orders.
+    pub const DEFAULT_MAX_ALIGNMENT_COST: u64 = 1 << 27;
+
+    /// Limits the work of aligning two lists, counted as the product of
+    /// their lengths once the elements they share at both ends, and those
+    /// found on one side only, are set aside. A list over the limit is
+    /// aligned in near-linear time instead: elements that occur once on
+    /// each side are matched in order, and the rest greedily. The diff
+    /// still patches `lhs` into `rhs` but may hold more hunks than the
+    /// longest common subsequence would, and than Go `jd` prints. The
+    /// default is [`DiffOptions::DEFAULT_MAX_ALIGNMENT_COST`]; `u64::MAX`
+    /// always aligns exactly.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str("[1,2,3,4,5,6]").unwrap();
+    /// let rhs = Node::from_json_str("[6,5,4,3,2,1]").unwrap();
+    /// let guarded = DiffOptions::default().with_max_alignment_cost(10);
+    /// let diff = lhs.diff(&rhs, &guarded);
+    /// assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+    /// ```
+    #[must_use]
+    pub fn with_max_alignment_cost(mut self, max: u64) -> Self {
+        self.max_alignment_cost = Some(max);
+        self
+    }
+
+    /// Returns the most work a list alignment may take before falling back
+    /// to the cheaper one.
+    #[must_use]
+    pub fn max_alignment_cost(&self) -> u64 {
+        self.max_alignment_cost.unwrap_or(Self::DEFAULT_MAX_ALIGNMENT_COST)
+    }
+
+    /// Context elements [`DiffOptions::with_context_size`] captures unless
+    /// set: one on each side, as Go `jd` does.
+    pub const DEFAULT_CONTEXT_SIZE: usize = 1;
+
+    /// Sets how many elements before and after each list hunk the diff
+    /// records as context. Patching checks every recorded element, so more
+    /// context catches a hunk applied to a list that changed around it, at
+    /// the cost of a longer diff; with `0` a list hunk is checked only
+    /// against the values it removes. Context cut short by either end of
+    /// the list is closed by a [`Node::Void`](crate::Node::Void) marker.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, RenderConfig};
+    /// let lhs = Node::from_json_str("[1,2,3,4,5]").unwrap();
+    /// let rhs = Node::from_json_str("[1,2,9,4,5]").unwrap();
+    /// let wide = DiffOptions::default().with_context_size(2);
+    /// assert_eq!(
+    ///     lhs.diff(&rhs, &wide).render(&RenderConfig::default()),
+    ///     "@ [2]\n  1\n  2\n- 3\n+ 9\n  4\n  5\n"
+    /// );
+    /// let bare = DiffOptions::default().with_context_size(0);
+    /// let diff = lhs.diff(&rhs, &bare);
+    /// assert_eq!(diff.render(&RenderConfig::default()), "@ [2]\n- 3\n+ 9\n");
+    /// let drifted = Node::from_json_str("[0,2,3,4,5]").unwrap();
+    /// assert_eq!(
+    ///     drifted.apply_patch(&diff).unwrap(),
+    ///     Node::from_json_str("[0,2,9,4,5]").unwrap()
+    /// );
+    /// ```
+    #[must_use]
+    pub fn with_context_size(mut self, size: usize) -> Self {
+        self.context_size = Some(size);
+        self
+    }
+
+    /// Returns how many elements of context the diff records on each side
+    /// of a list hunk.
+    #[must_use]
+    pub fn context_size(&self) -> usize {
+        self.context_size.unwrap_or(Self::DEFAULT_CONTEXT_SIZE)
+    }
+
+    /// Pairs objects in lists by similarity: two objects outside the common
+    /// subsequence are diffed field by field when at least `threshold` of
+    /// their fields (the share of fields present in either object that hold
+    /// equal values) match, and are otherwise removed and added. A removed
+    /// object is kept back for a later, similar element instead of being
+    /// diffed against whatever happens to share its position. That search
+    /// is skipped for runs of changed elements whose lengths multiply past
+    /// [`DiffOptions::max_alignment_cost`].
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"[{"id":1,"v":"a"},{"id":2,"n":"x","v":"b"}]"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"[{"id":2,"n":"x","v":"c"}]"#).unwrap();
+    /// let opts = DiffOptions::default().with_similarity_threshold(0.6).unwrap();
+    /// let diff = lhs.diff(&rhs, &opts);
+    /// assert_eq!(
+    ///     diff.render(&RenderConfig::default()),
+    ///     "@ [0]\n[\n- {\"id\":1,\"v\":\"a\"}\n  {\"id\":2,\"n\":\"x\",\"v\":\"b\"}\n\
+    ///      @ [0,\"v\"]\n- \"b\"\n+ \"c\"\n"
+    /// );
+    /// assert_eq!(lhs.apply_patch(&diff).unwrap(), rhs);
+    /// ```
+    ///
+    /// # Errors
+    ///
+    /// Returns [`OptionsError::InvalidSimilarityThreshold`] unless
+    /// `0 < threshold <= 1`.
+    pub fn with_similarity_threshold(mut self, threshold: f64) -> Result<Self, OptionsError> {
+        if !(threshold > 0.0 && threshold <= 1.0) {
+            return Err(OptionsError::InvalidSimilarityThreshold {
+                threshold: threshold.to_string(),
+            });
+        }
+        self.similarity_threshold = Some(threshold);
+        Ok(self)
+    }
+
+    /// Returns the similarity threshold for pairing objects in lists, if any.
+    #[must_use]
+    pub fn similarity_threshold(&self) -> Option<f64> {
+        self.similarity_threshold
+    }
+
+    /// Selects whether integers and floats of equal value compare equal.
+    /// With [`NumberEquality::Typed`] they differ in diffs, set matching,
+    /// and patch context checks, and hunks print integral floats with
+    /// their fraction so the change stays visible.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, NumberEquality, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"{"n":1}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"n":1.0}"#).unwrap();
+    /// assert!(lhs.diff(&rhs, &DiffOptions::default()).is_empty());
+    /// let opts = DiffOptions::default().with_number_equality(NumberEquality::Typed);
+    /// let diff = lhs.diff(&rhs, &opts);
+    /// assert_eq!(diff.render(&RenderConfig::default()), "@ [\"n\"]\n- 1\n+ 1.0\n");
+    /// ```
+    #[must_use]
+    pub fn with_number_equality(mut self, equality: NumberEquality) -> Self {
+        self.number_equality = equality;
+        self
+    }
+
+    /// Returns how numbers written as integers and floats are compared.
+    #[must_use]
+    pub fn number_equality(&self) -> NumberEquality {
+        self.number_equality
+    }
+
+    /// Selects how closely a document must match a diff for
+    /// [`Node::apply_patch_with_options`] and [`Diff::check_with_options`]
+    /// to apply it. Diffing is unaffected.
+    ///
+    /// [`Diff::check_with_options`]: crate::Diff::check_with_options
+    ///
+    /// ```
+    /// # use jd_core::{Diff, DiffOptions, Node, PatchStrictness};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n+ 2\n").unwrap();
+    /// let drifted = Node::from_json_str(r#"{"a":5}"#).unwrap();
+    /// assert!(drifted.apply_patch(&diff).is_err());
+    /// let lenient = DiffOptions::default().with_patch_strictness(PatchStrictness::Lenient);
+    /// let patched = drifted.apply_patch_with_options(&diff, &lenient).unwrap();
+    /// assert_eq!(patched, Node::from_json_str(r#"{"a":2}"#).unwrap());
+    /// ```
+    #[must_use]
+    pub fn with_patch_strictness(mut self, strictness: PatchStrictness) -> Self {
+        self.patch_strictness = strictness;
+        self
+    }
+
+    /// Returns how closely a document must match a diff for it to apply.
+    #[must_use]
+    pub fn patch_strictness(&self) -> PatchStrictness {
+        self.patch_strictness
+    }
+
+    /// Selects what patching does when the elements before or after a list
+    /// hunk do not match the document, which happens when the list changed
+    /// around the hunk since the diff was made. Removed values are still
+    /// checked. Under [`ContextMismatch::Warn`] and
+    /// [`ContextMismatch::Ignore`] a hunk first looks for a position where
+    /// its context matches, within [`DiffOptions::with_patch_fuzz`], and
+    /// applies at its index otherwise.
+    ///
+    /// ```
+    /// # use jd_core::{ContextMismatch, Diff, DiffOptions, Node};
+    /// let diff = Diff::from_native_str("@ [1]\n  \"a\"\n- \"b\"\n+ \"B\"\n  \"c\"\n").unwrap();
+    /// let drifted = Node::from_json_str(r#"["x","b","c"]"#).unwrap();
+    /// assert!(drifted.apply_patch(&diff).is_err());
+    /// let warn = DiffOptions::default().with_context_mismatch(ContextMismatch::Warn);
+    /// let patched = drifted.apply_patch_fuzzy(&diff, &warn).unwrap();
+    /// assert_eq!(patched.node, Node::from_json_str(r#"["x","B","c"]"#).unwrap());
+    /// assert_eq!(patched.warnings[0].to_string(), "invalid patch. expected \"a\" before. got \"x\"");
+    /// ```
+    #[must_use]
+    pub fn with_context_mismatch(mut self, mismatch: ContextMismatch) -> Self {
+        self.context_mismatch = mismatch;
+        self
+    }
+
+    /// Returns what patching does with list context that does not match.
+    #[must_use]
+    pub fn context_mismatch(&self) -> ContextMismatch {
+        self.context_mismatch
+    }
+
+    /// Lets a list hunk whose context and removed values do not match at
+    /// its index apply up to `max_offset` positions before or after it,
+    /// like the fuzz of GNU `patch`, so diffs still apply to lists that
+    /// gained or lost elements since. The nearest match wins, later
+    /// positions first. [`Node::apply_patch_fuzzy`] reports the offsets
+    /// used.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"["a","b","c"]"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"["a","B","c"]"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default());
+    /// let drifted = Node::from_json_str(r#"["x","a","b","c"]"#).unwrap();
+    /// assert!(drifted.apply_patch(&diff).is_err());
+    /// let fuzzy = DiffOptions::default().with_patch_fuzz(2);
+    /// let patched = drifted.apply_patch_with_options(&diff, &fuzzy).unwrap();
+    /// assert_eq!(patched, Node::from_json_str(r#"["x","a","B","c"]"#).unwrap());
+    /// ```
+    #[must_use]
+    pub fn with_patch_fuzz(mut self, max_offset: usize) -> Self {
+        self.patch_fuzz = max_offset;
+        self
+    }
+
+    /// Returns how many positions a list hunk may move when patching.
+    #[must_use]
+    pub fn patch_fuzz(&self) -> usize {
+        self.patch_fuzz
+    }
+
+    /// Stops the diff once it holds more than `max` hunks, keeping the first
+    /// `max` and marking the diff [truncated](crate::Diff::is_truncated), so
+    /// checking whether two huge documents are nearly equal does not pay for
+    /// the full diff.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"a":1,"b":1,"c":1}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"a":2,"b":2,"c":2}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default().with_max_elements(2));
+    /// assert_eq!(diff.len(), 2);
+    /// assert!(diff.is_truncated());
+    /// ```
+    #[must_use]
+    pub fn with_max_elements(mut self, max: usize) -> Self {
+        self.max_elements = Some(max);
+        self
+    }
+
+    /// Returns the most hunks a diff may hold, if limited.
+    #[must_use]
+    pub fn max_elements(&self) -> Option<usize> {
+        self.max_elements
+    }
+
+    /// Stops the diff once its native rendering, without color, would take
+    /// more than `max` bytes, keeping the hunks that fit and marking the diff
+    /// [truncated](crate::Diff::is_truncated).
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"{"a":1,"b":1}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"a":2,"b":2}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default().with_max_bytes(20));
+    /// assert_eq!(diff.render(&RenderConfig::default()), "@ [\"a\"]\n- 1\n+ 2\n");
+    /// assert!(diff.is_truncated());
+    /// ```
+    #[must_use]
+    pub fn with_max_bytes(mut self, max: usize) -> Self {
+        self.max_bytes = Some(max);
+        self
+    }
+
+    /// Returns the most bytes the native rendering of a diff may take, if
+    /// limited.
+    #[must_use]
+    pub fn max_bytes(&self) -> Option<usize> {
+        self.max_bytes
+    }
+
+    /// Lets `token` stop diffs and patches run with these options. A
+    /// cancelled diff comes back empty and
+    /// [truncated](crate::Diff::is_truncated), and a cancelled patch fails
+    /// with a [`PatchError`](crate::PatchError) at the hunk it reached. See
+    /// [`CancellationToken`] for an example.
+    #[must_use]
+    pub fn with_cancellation(mut self, token: CancellationToken) -> Self {
+        self.cancellation = Some(token);
+        self
+    }
+
+    /// Returns the token that can cancel work run with these options, if any.
+    #[must_use]
+    pub fn cancellation(&self) -> Option<&CancellationToken> {
+        self.cancellation.as_ref()
+    }
+
+    /// Reports whether the work these options run has been cancelled.
+    pub(crate) fn is_cancelled(&self) -> bool {
+        self.cancellation.as_ref().is_some_and(CancellationToken::is_cancelled)
+    }
+
+    /// Sends [`Progress`](crate::Progress) reports from diffs and patches
+    /// run with these options to `reporter`. See [`ProgressReporter`] for an
+    /// example.
+    #[must_use]
+    pub fn with_progress<R>(mut self, reporter: R) -> Self
+    where
+        R: ProgressReporter + 'static,
+    {
+        self.progress = Some(Arc::new(reporter));
+        self
+    }
+
+    /// Returns the reporter progress goes to, if any.
+    #[must_use]
+    pub fn progress(&self) -> Option<&dyn ProgressReporter> {
+        self.progress.as_deref()
+    }
+
+    /// Returns the options with a fresh budget and progress totals for one
+    /// diff, when its size is limited or its progress reported.
+    pub(crate) fn for_diff(&self) -> Cow<'_, DiffOptions> {
+        let limited = self.max_elements.is_some() || self.max_bytes.is_some();
+        if !limited && self.progress.is_none() {
+            return Cow::Borrowed(self);
+        }
+        let mut options = self.clone();
+        if limited {
+            options.budget = Some(Arc::new(DiffBudget::new(self.max_elements, self.max_bytes)));
+        }
+        options.tracker = self
+            .progress
+            .clone()
+            .map(|reporter| Arc::new(ProgressTracker::new(reporter, ProgressPhase::Diff)));
+        Cow::Owned(options)
+    }
+
+    /// Returns the progress totals of the diff these options are running.
+    pub(crate) fn tracker(&self) -> Option<&ProgressTracker> {
+        self.tracker.as_deref()
+    }
+
+    /// Starts progress totals for one patch, when its progress is reported.
+    pub(crate) fn patch_tracker(&self) -> Option<ProgressTracker> {
+        self.progress.clone().map(|reporter| ProgressTracker::new(reporter, ProgressPhase::Patch))
+    }
+
+    pub(crate) fn budget(&self) -> Option<&DiffBudget> {
+        self.budget.as_deref()
+    }
+
+    /// Registers a comparator that can override equality for the values it
+    /// recognises. Comparators are consulted in registration order and the
+    /// first one to return a decision wins. See [`NodeComparator`] for an
+    /// example.
+    #[must_use]
+    pub fn with_comparator<C>(mut self, comparator: C) -> Self
+    where
+        C: NodeComparator + 'static,
+    {
+        self.comparators.push(Arc::new(comparator));
+        self
+    }
+
+    /// Applies a single option, mirroring how Go's `jd` accepts a list of
+    /// options.
+    ///
+    /// ```
+    /// # use jd_core::{ArrayMode, DiffOption, DiffOptions};
+    /// let opts = DiffOptions::default()
+    ///     .with_option(DiffOption::MultiSet)
+    ///     .expect("multiset");
+    /// assert_eq!(opts.array_mode(), ArrayMode::MultiSet);
+    /// ```
+    pub fn with_option(self, option: DiffOption) -> Result<Self, OptionsError> {
+        match option {
+            DiffOption::Set => self.with_array_mode(ArrayMode::Set),
+            DiffOption::MultiSet => self.with_array_mode(ArrayMode::MultiSet),
+            DiffOption::Precision(precision) => self.with_precision(precision),
+            DiffOption::SetKeys(keys) => self.with_set_keys(keys),
+            DiffOption::Path(path_option) => self.with_path_option(path_option),
+            DiffOption::Ignore(paths) => Ok(self.with_ignored_paths(paths)),
+            DiffOption::ExcludeKeys(patterns) => self.with_excluded_keys(patterns),
+        }
+    }
+
+    /// Scopes options to the subtree rooted at a path.
+    ///
+    /// The scoped options take effect at the node addressed by the path and
+    /// are inherited by everything beneath it. Object keys and list indices
+    /// address children as usual; a `{}` or `[]` segment addresses every
+    /// member of a set or multiset. An empty path applies the options to the
+    /// whole document.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOption, DiffOptions, Node, PathOption, PathSegment, RenderConfig};
+    /// let lhs = Node::from_json_str(r#"{"tags":["a","b"],"list":[1,2]}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"tags":["b","a"],"list":[2,1]}"#).unwrap();
+    /// let opts = DiffOptions::default()
+    ///     .with_path_option(PathOption::new(PathSegment::key("tags"), vec![DiffOption::Set]))
+    ///     .expect("path option");
+    /// let rendered = lhs.diff(&rhs, &opts).render(&RenderConfig::default());
+    /// assert!(rendered.starts_with("@ [\"list\",0]"));
+    /// assert!(!rendered.contains("tags"));
+    /// ```
+    pub fn with_path_option(mut self, option: PathOption) -> Result<Self, OptionsError> {
+        let mut scoped = DiffOptions::default();
+        for nested in &option.then {
+            scoped = scoped.with_option(nested.clone())?;
+        }
+        if option.at.is_empty() {
+            for nested in option.then {
+                self = self.with_option(nested)?;
+            }
+            return Ok(self);
+        }
+        self.path_options.push(option);
+        Ok(self)
+    }
+
+    /// Scopes options to every node a JSONPath expression selects.
+    ///
+    /// Unlike [`DiffOptions::with_path_option`], one expression can reach
+    /// many subtrees through `*` and `..`. The options apply where the
+    /// expression matches and are inherited beneath it; an expression of
+    /// just `$` applies them to the whole document.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOption, DiffOptions, JsonPath, Node, Path};
+    /// let lhs = Node::from_json_str(r#"{"a":{"uid":1,"n":1},"b":[{"uid":2}]}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"a":{"uid":3,"n":1},"b":[{"uid":4}]}"#).unwrap();
+    /// let uids = JsonPath::parse("$..uid").unwrap();
+    /// let opts = DiffOptions::default()
+    ///     .with_query_option(&uids, vec![DiffOption::Ignore(vec![Path::new()])])
+    ///     .expect("query option");
+    /// assert!(lhs.diff(&rhs, &opts).is_empty());
+    /// ```
+    pub fn with_query_option(
+        mut self,
+        query: &JsonPath,
+        then: Vec<DiffOption>,
+    ) -> Result<Self, OptionsError> {
+        let mut scoped = DiffOptions::default();
+        for nested in &then {
+            scoped = scoped.with_option(nested.clone())?;
+        }
+        let cursor = query.cursor();
+        if cursor.is_done() {
+            for nested in then {
+                self = self.with_option(nested)?;
+            }
+            return Ok(self);
+        }
+        self.query_options.push(QueryOption { cursor, then, list_only: false });
+        Ok(self)
+    }
+
+    /// Pairs the elements of the lists `merge` names by their merge keys,
+    /// as `kubectl diff` sees them, instead of by position.
+    ///
+    /// Object lists become sets keyed by their merge key and scalar lists
+    /// plain sets. Unlike other scoped options, these settings stop at the
+    /// list's members, so lists nested inside them, such as a container's
+    /// `args`, keep their order.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, RenderConfig, StrategicMerge};
+    /// let lhs = Node::from_json_str(
+    ///     r#"{"spec":{"containers":[{"name":"a","image":"a:1"},{"name":"b","args":["x","y"]}]}}"#,
+    /// ).unwrap();
+    /// let rhs = Node::from_json_str(
+    ///     r#"{"spec":{"containers":[{"name":"b","args":["y","x"]},{"name":"a","image":"a:2"}]}}"#,
+    /// ).unwrap();
+    /// let opts = DiffOptions::default().with_strategic_merge(&StrategicMerge::kubernetes());
+    /// let rendered = lhs.diff(&rhs, &opts).render(&RenderConfig::default());
+    /// assert!(rendered.contains(r#"@ ["spec","containers",{"name":"a"},"image"]"#));
+    /// assert!(rendered.contains(r#"@ ["spec","containers",{"name":"b"},"args",0]"#));
+    /// ```
+    #[must_use]
+    pub fn with_strategic_merge(mut self, merge: &StrategicMerge) -> Self {
+        for (list, key) in merge.rules() {
+            let then = match key {
+                Some(key) => DiffOption::SetKeys(vec![key.to_string()]),
+                None => DiffOption::Set,
+            };
+            self = self.with_list_option(list, then);
+        }
+        self
+    }
+
+    /// Adds the ignored fields and keyed lists of `preset`, a bundle of
+    /// settings for one document format.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, Preset};
+    /// let lhs = Node::from_json_str(
+    ///     r#"{"resource_changes":[{"address":"a.x","change":{}},{"address":"b.y","change":{}}]}"#,
+    /// ).unwrap();
+    /// let rhs = Node::from_json_str(
+    ///     r#"{"resource_changes":[{"address":"b.y","change":{}},{"address":"a.x","change":{}}]}"#,
+    /// ).unwrap();
+    /// let opts = DiffOptions::default().with_preset(Preset::TerraformPlan);
+    /// assert!(lhs.diff(&rhs, &opts).is_empty());
+    /// ```
+    #[must_use]
+    pub fn with_preset(self, preset: Preset) -> Self {
+        preset.apply(self)
+    }
+
+    /// Applies `then` to the lists `list` matches and to their members, but
+    /// not to the values nested in those members.
+    pub(crate) fn with_list_option(mut self, list: &JsonPath, then: DiffOption) -> Self {
+        let cursor = list.cursor();
+        if cursor.is_done() {
+            self.apply_scoped(then);
+        } else {
+            self.query_options.push(QueryOption { cursor, then: vec![then], list_only: true });
+        }
+        self
+    }
+
+    /// Builds options from their Go-compatible JSON representations.
+    ///
+    /// ```
+    /// # use jd_core::{ArrayMode, DiffOptions};
+    /// let opts = DiffOptions::from_json_str(r#"["SET",{"@":["n"],"^":[{"precision":0.1}]}]"#)
+    ///     .expect("options");
+    /// assert_eq!(opts.array_mode(), ArrayMode::Set);
+    /// assert_eq!(opts.path_options().len(), 1);
+    /// ```
+    pub fn from_json_str(input: &str) -> Result<Self, OptionsError> {
+        let values: Vec<JsonValue> = serde_json::from_str(input)
+            .map_err(|err| OptionsError::InvalidOption { message: err.to_string() })?;
+        let mut options = Self::default();
+        for value in values {
+            options = options.with_option(DiffOption::from_json_value(&value)?)?;
+        }
+        Ok(options)
+    }
+
+    /// Returns the options a native diff can carry in `^` header lines, in
+    /// their Go-compatible form: the array mode or set keys, the precision,
+    /// path-scoped and ignored paths, and excluded keys. Settings with no
+    /// header form, such as JSONPath-scoped options, move detection, or
+    /// list alignment, are left out.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOption, DiffOptions};
+    /// let opts = DiffOptions::from_json_str(r#"[{"precision":0.1},{"@":["tags"],"^":["SET"]}]"#)
+    ///     .expect("options");
+    /// let rendered: Vec<String> = opts.header_options().iter().map(DiffOption::to_string).collect();
+    /// assert_eq!(rendered, [r#"{"precision":0.1}"#, r#"{"@":["tags"],"^":["SET"]}"#]);
+    /// assert!(DiffOptions::default().header_options().is_empty());
+    /// ```
+    #[must_use]
+    pub fn header_options(&self) -> Vec<DiffOption> {
+        let mut options = Vec::new();
+        match (&self.set_keys, self.array_mode) {
+            (Some(keys), _) => options.push(DiffOption::SetKeys(keys.clone())),
+            (None, ArrayMode::Set) => options.push(DiffOption::Set),
+            (None, ArrayMode::MultiSet) => options.push(DiffOption::MultiSet),
+            (None, ArrayMode::List) => {}
+        }
+        if self.precision != 0.0 {
+            options.push(DiffOption::Precision(self.precision));
+        }
+        if self.ignored {
+            options.push(DiffOption::Ignore(vec![Path::new()]));
+        }
+        options.extend(self.path_options.iter().cloned().map(DiffOption::Path));
+        if !self.excluded_keys.is_empty() {
+            let patterns = self.excluded_keys.iter().map(|pattern| pattern.as_str().to_string());
+            options.push(DiffOption::ExcludeKeys(patterns.collect()));
+        }
+        options
+    }
+
+    /// Adds options read from `^` header lines. Like scoped options they
+    /// override the current settings without validating the combination,
+    /// since a header may pair an array mode with a precision.
+    pub(crate) fn with_header_options(mut self, options: &[DiffOption]) -> Self {
+        for option in options {
+            self.apply_scoped(option.clone());
+        }
+        self
+    }
+
+    /// Reports whether the value these options apply to is ignored.
+    pub(crate) fn is_ignored(&self) -> bool {
+        self.ignored
+    }
+
+    /// Reports whether children may see different options than `self`,
+    /// through path options, excluded keys, or comparators.
+    pub(crate) fn is_refined(&self) -> bool {
+        !self.path_options.is_empty()
+            || !self.query_options.is_empty()
+            || self.list_scope.is_some()
+            || !self.excluded_keys.is_empty()
+            || self.has_comparators()
+    }
+
+    pub(crate) fn has_comparators(&self) -> bool {
+        !self.comparators.is_empty()
+    }
+
+    /// Asks the comparators whether `lhs` and `rhs` are equal.
+    pub(crate) fn compare(&self, lhs: &Node, rhs: &Node) -> Option<bool> {
+        self.comparators.iter().find_map(|comparator| comparator.equals(&self.location, lhs, rhs))
+    }
+
+    /// Asks the comparators for the hash code of `node`.
+    pub(crate) fn comparator_hash(&self, node: &Node) -> Option<HashCode> {
+        self.comparators.iter().find_map(|comparator| comparator.hash_code(&self.location, node))
+    }
+
+    /// Returns these options positioned at `path`, for callers such as the
+    /// patch engine that reach values without refining segment by segment.
+    pub(crate) fn located_at(&self, path: &[PathSegment]) -> Cow<'_, DiffOptions> {
+        if !self.has_comparators() {
+            return Cow::Borrowed(self);
+        }
+        let mut located = self.clone();
+        located.location = Path::from(path.to_vec());
+        Cow::Owned(located)
+    }
+
+    /// Copies the comparators of `other` onto these options.
+    pub(crate) fn with_comparators_of(mut self, other: &DiffOptions) -> Self {
+        self.comparators.extend(other.comparators.iter().cloned());
+        self
+    }
+
+    fn ignore(&mut self, path: Path) {
+        if path.is_empty() {
+            self.ignored = true;
+        } else {
+            let here = DiffOption::Ignore(vec![Path::new()]);
+            self.path_options.push(PathOption { at: path, then: vec![here] });
+        }
+    }
+
+    /// Returns the options that apply to the child reached through `segment`.
+    ///
+    /// Borrows `self` when no path options are pending, which keeps the
+    /// common unscoped case allocation-free.
+    pub(crate) fn refine(&self, segment: &PathSegment) -> Cow<'_, DiffOptions> {
+        if !self.is_refined() {
+            return Cow::Borrowed(self);
+        }
+        let mut refined = self.clone();
+        refined.path_options = Vec::new();
+        refined.query_options = Vec::new();
+        if self.has_comparators() {
+            refined.location = self.location.clone().with_segment(segment.clone());
+        }
+        if let PathSegment::Key(key) = segment {
+            if self.excluded_keys.iter().any(|pattern| pattern.is_match(key)) {
+                refined.ignored = true;
+            }
+        }
+        if let Some(scope) = refined.list_scope.take() {
+            if scope.levels > 1 {
+                refined.list_scope =
+                    Some(Box::new(ListScope { levels: scope.levels - 1, ..*scope }));
+            } else {
+                refined.array_mode = scope.array_mode;
+                refined.set_keys = scope.set_keys;
+            }
+        }
+        let mut activated = Vec::new();
+        let mut list_activated = Vec::new();
+        for option in &self.path_options {
+            let Some((head, rest)) = option.at.segments().split_first() else {
+                continue;
+            };
+            if head != segment {
+                continue;
+            }
+            if rest.is_empty() {
+                activated.extend(option.then.iter().cloned());
+            } else {
+                refined
+                    .path_options
+                    .push(PathOption { at: Path::from(rest.to_vec()), then: option.then.clone() });
+            }
+        }
+        for option in &self.query_options {
+            for cursor in option.cursor.advance(segment) {
+                if !cursor.is_done() {
+                    refined.query_options.push(QueryOption { cursor, ..option.clone() });
+                } else if option.list_only {
+                    list_activated.extend(option.then.iter().cloned());
+                } else {
+                    activated.extend(option.then.iter().cloned());
+                }
+            }
+        }
+        for option in activated {
+            refined.apply_scoped(option);
+        }
+        if !list_activated.is_empty() {
+            // The list itself, then its `{}` members, keep the settings;
+            // values inside the members get the current ones back.
+            refined.list_scope = Some(Box::new(ListScope {
+                array_mode: refined.array_mode,
+                set_keys: refined.set_keys.clone(),
+                levels: 2,
+            }));
+            for option in list_activated {
+                refined.apply_scoped(option);
+            }
+        }
+        Cow::Owned(refined)
+    }
+
+    // Scoped options override inherited settings without re-validating the
+    // combination, since they were validated in isolation when registered.
+    fn apply_scoped(&mut self, option: DiffOption) {
+        match option {
+            DiffOption::Set => self.array_mode = ArrayMode::Set,
+            DiffOption::MultiSet => {
+                self.array_mode = ArrayMode::MultiSet;
+                self.set_keys = None;
+            }
+            DiffOption::Precision(precision) => self.precision = precision,
+            DiffOption::SetKeys(mut keys) => {
+                keys.sort();
+                keys.dedup();
+                self.set_keys = Some(keys);
+                self.array_mode = ArrayMode::Set;
+            }
+            DiffOption::Path(option) => {
+                if option.at.is_empty() {
+                    for nested in option.then {
+                        self.apply_scoped(nested);
+                    }
+                } else {
+                    self.path_options.push(option);
+                }
+            }
+            DiffOption::Ignore(paths) => {
+                for path in paths {
+                    self.ignore(path);
+                }
+            }
+            DiffOption::ExcludeKeys(patterns) => {
+                let compiled = patterns.iter().filter_map(|p| compile_key_pattern(p).ok());
+                self.excluded_keys.extend(compiled);
+            }
+        }
+    }
+
     fn validate(&self) -> Result<(), OptionsError> {
         if !matches!(self.array_mode, ArrayMode::List) && self.precision > 0.0 {
             return Err(OptionsError::PrecisionIncompatible);
@@ -152,6 +1326,254 @@ impl DiffOptions {
     }
 }
 
+/// A single option in the form used by Go's `jd` library.
+///
+/// Options serialize to the same JSON as upstream (`"SET"`,
+/// `{"precision":0.1}`, `{"@":["tags"],"^":["SET"]}`), which is also the
+/// payload of `^` option header lines in the native diff format.
+///
+/// ```
+/// # use jd_core::DiffOption;
+/// let option: DiffOption = r#"{"setkeys":["id"]}"#.parse().expect("valid option");
+/// assert_eq!(option, DiffOption::SetKeys(vec!["id".to_string()]));
+/// assert_eq!(option.to_string(), r#"{"setkeys":["id"]}"#);
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub enum DiffOption {
+    /// Treat arrays as sets (`"SET"`).
+    Set,
+    /// Treat arrays as multisets (`"MULTISET"`).
+    MultiSet,
+    /// Numeric equality tolerance (`{"precision":N}`).
+    Precision(f64),
+    /// Identity keys for objects within sets (`{"setkeys":[...]}`).
+    SetKeys(Vec<String>),
+    /// Options scoped to a subtree (`{"@":path,"^":[...]}`).
+    Path(PathOption),
+    /// Values excluded from comparison (`{"ignore":[path,...]}`). This is a
+    /// `jd-rs` extension with no Go equivalent.
+    Ignore(Vec<Path>),
+    /// Regular expressions for object keys excluded from comparison
+    /// (`{"excludeKeys":[regex,...]}`). This is a `jd-rs` extension with no
+    /// Go equivalent.
+    ExcludeKeys(Vec<String>),
+}
+
+impl DiffOption {
+    /// Parses the payload of a native diff option header line (`^ ...`).
+    ///
+    /// ```
+    /// # use jd_core::{DiffOption, PathOption, PathSegment};
+    /// let option = DiffOption::from_header(r#"^ {"@":["tags"],"^":["SET"]}"#).unwrap();
+    /// let expected = PathOption::new(PathSegment::key("tags"), vec![DiffOption::Set]);
+    /// assert_eq!(option, DiffOption::Path(expected));
+    /// ```
+    pub fn from_header(line: &str) -> Result<Self, OptionsError> {
+        let Some(payload) = line.strip_prefix('^') else {
+            return Err(OptionsError::InvalidOption {
+                message: format!("expected option header starting with ^. got {line:?}"),
+            });
+        };
+        payload.trim().parse()
+    }
+
+    /// Renders the option as a native diff header line, including the
+    /// trailing newline.
+    ///
+    /// ```
+    /// # use jd_core::DiffOption;
+    /// assert_eq!(DiffOption::MultiSet.render_header(), "^ \"MULTISET\"\n");
+    /// ```
+    #[must_use]
+    pub fn render_header(&self) -> String {
+        format!("^ {self}\n")
+    }
+
+    fn to_json_value(&self) -> JsonValue {
+        match self {
+            Self::Set => json!("SET"),
+            Self::MultiSet => json!("MULTISET"),
+            Self::Precision(precision) => {
+                let number = Number::new(*precision)
+                    .map_or(JsonValue::Null, |number| JsonValue::Number(number.to_json_number()));
+                json!({ "precision": number })
+            }
+            Self::SetKeys(keys) => json!({ "setkeys": keys }),
+            Self::Path(option) => json!({
+                "@": option.at,
+                "^": option.then.iter().map(Self::to_json_value).collect::<Vec<_>>(),
+            }),
+            Self::Ignore(paths) => json!({ "ignore": paths }),
+            Self::ExcludeKeys(patterns) => json!({ "excludeKeys": patterns }),
+        }
+    }
+
+    fn from_json_value(value: &JsonValue) -> Result<Self, OptionsError> {
+        let invalid = || OptionsError::InvalidOption { message: value.to_string() };
+        match value {
+            JsonValue::String(name) => match name.as_str() {
+                "SET" => Ok(Self::Set),
+                "MULTISET" => Ok(Self::MultiSet),
+                _ => Err(invalid()),
+            },
+            JsonValue::Object(map) if map.len() == 1 && map.contains_key("precision") => {
+                map["precision"].as_f64().map(Self::Precision).ok_or_else(invalid)
+            }
+            JsonValue::Object(map) if map.len() == 1 && map.contains_key("setkeys") => {
+                let keys = map["setkeys"].as_array().ok_or_else(invalid)?;
+                keys.iter()
+                    .map(|key| key.as_str().map(str::to_owned).ok_or_else(invalid))
+                    .collect::<Result<_, _>>()
+                    .map(Self::SetKeys)
+            }
+            JsonValue::Object(map) if map.len() == 1 && map.contains_key("ignore") => {
+                serde_json::from_value(map["ignore"].clone())
+                    .map(Self::Ignore)
+                    .map_err(|_| invalid())
+            }
+            JsonValue::Object(map) if map.len() == 1 && map.contains_key("excludeKeys") => {
+                serde_json::from_value(map["excludeKeys"].clone())
+                    .map(Self::ExcludeKeys)
+                    .map_err(|_| invalid())
+            }
+            JsonValue::Object(map) if map.len() == 2 && map.contains_key("@") => {
+                let at: Path = serde_json::from_value(map["@"].clone()).map_err(|_| invalid())?;
+                let then = map.get("^").and_then(JsonValue::as_array).ok_or_else(invalid)?;
+                let then = then.iter().map(Self::from_json_value).collect::<Result<_, _>>()?;
+                Ok(Self::Path(PathOption { at, then }))
+            }
+            _ => Err(invalid()),
+        }
+    }
+}
+
+impl fmt::Display for DiffOption {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(&self.to_json_value().to_string())
+    }
+}
+
+impl FromStr for DiffOption {
+    type Err = OptionsError;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let value: JsonValue = serde_json::from_str(s)
+            .map_err(|err| OptionsError::InvalidOption { message: err.to_string() })?;
+        Self::from_json_value(&value)
+    }
+}
+
+impl Serialize for DiffOption {
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: Serializer,
+    {
+        self.to_json_value().serialize(serializer)
+    }
+}
+
+impl<'de> Deserialize<'de> for DiffOption {
+    fn deserialize<D>(deserializer: D) -> Result<Self, D::Error>
+    where
+        D: Deserializer<'de>,
+    {
+        let value = JsonValue::deserialize(deserializer)?;
+        Self::from_json_value(&value).map_err(serde::de::Error::custom)
+    }
+}
+
+/// Options waiting for the rest of a JSONPath expression to match.
+#[derive(Clone, Debug)]
+struct QueryOption {
+    cursor: QueryCursor,
+    then: Vec<DiffOption>,
+    /// Applies to the matched list and its members only, not to values
+    /// nested inside the members.
+    list_only: bool,
+}
+
+/// Array settings saved when a list-scoped option took effect, restored
+/// once refinement has gone `levels` segments further.
+#[derive(Clone, Debug)]
+struct ListScope {
+    array_mode: ArrayMode,
+    set_keys: Option<Vec<String>>,
+    levels: u8,
+}
+
+/// Options that apply only to the subtree rooted at a path, equivalent to
+/// Go's `PathOption`.
+///
+/// ```
+/// # use jd_core::{DiffOption, PathOption, PathSegment};
+/// let option = PathOption::new(PathSegment::key("tags"), vec![DiffOption::Set]);
+/// assert_eq!(DiffOption::Path(option).to_string(), r#"{"@":["tags"],"^":["SET"]}"#);
+/// ```
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct PathOption {
+    #[serde(rename = "@")]
+    at: Path,
+    #[serde(rename = "^")]
+    then: Vec<DiffOption>,
+}
+
+impl PathOption {
+    /// Creates a path-scoped option set.
+    #[must_use]
+    pub fn new<P>(at: P, then: Vec<DiffOption>) -> Self
+    where
+        P: Into<Path>,
+    {
+        Self { at: at.into(), then }
+    }
+
+    /// Returns the path the options are scoped to.
+    #[must_use]
+    pub fn at(&self) -> &Path {
+        &self.at
+    }
+
+    /// Returns the scoped options.
+    #[must_use]
+    pub fn then(&self) -> &[DiffOption] {
+        &self.then
+    }
+}
+
+fn compile_key_pattern(pattern: &str) -> Result<Regex, OptionsError> {
+    Regex::new(pattern).map_err(|err| OptionsError::InvalidKeyPattern {
+        pattern: pattern.to_string(),
+        message: err.to_string(),
+    })
+}
+
+/// Serializes compiled key patterns as their source strings.
+mod key_patterns {
+    use alloc::string::String;
+    use alloc::vec::Vec;
+
+    use regex::Regex;
+    use serde::{de, Deserialize, Deserializer, Serializer};
+
+    pub(super) fn serialize<S>(patterns: &[Regex], serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: Serializer,
+    {
+        serializer.collect_seq(patterns.iter().map(Regex::as_str))
+    }
+
+    pub(super) fn deserialize<'de, D>(deserializer: D) -> Result<Vec<Regex>, D::Error>
+    where
+        D: Deserializer<'de>,
+    {
+        let patterns = Vec::<String>::deserialize(deserializer)?;
+        patterns
+            .iter()
+            .map(|pattern| super::compile_key_pattern(pattern).map_err(de::Error::custom))
+            .collect()
+    }
+}
+
 impl fmt::Display for ArrayMode {
     fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
         match self {
@@ -181,6 +1603,145 @@ mod tests {
         assert_eq!(err, OptionsError::EmptySetKey);
     }
 
+    #[test]
+    fn similarity_threshold_must_be_a_positive_share() {
+        for threshold in [0.0, -0.5, 1.5, f64::NAN] {
+            let err = DiffOptions::default().with_similarity_threshold(threshold).unwrap_err();
+            assert_eq!(
+                err,
+                OptionsError::InvalidSimilarityThreshold { threshold: threshold.to_string() }
+            );
+        }
+        let options = DiffOptions::default().with_similarity_threshold(1.0).unwrap();
+        assert_eq!(options.similarity_threshold(), Some(1.0));
+    }
+
+    #[test]
+    fn options_round_trip_through_go_json() {
+        let inputs = [
+            r#""SET""#,
+            r#""MULTISET""#,
+            r#"{"precision":0.01}"#,
+            r#"{"precision":1}"#,
+            r#"{"setkeys":["id","name"]}"#,
+            r#"{"@":["a",0,{}],"^":["MULTISET"]}"#,
+            r#"{"ignore":[["a","b"],["c",0],[]]}"#,
+            r#"{"@":["a"],"^":[{"ignore":[["b"]]}]}"#,
+            r#"{"excludeKeys":["^_",".*_at$"]}"#,
+        ];
+        for input in inputs {
+            let option: DiffOption = input.parse().unwrap();
+            assert_eq!(option.to_string(), input);
+        }
+    }
+
+    #[test]
+    fn unknown_options_are_rejected() {
+        let err = "\"LIST\"".parse::<DiffOption>().unwrap_err();
+        assert_eq!(err, OptionsError::InvalidOption { message: "\"LIST\"".to_string() });
+    }
+
+    #[test]
+    fn path_options_validate_in_isolation() {
+        let option = PathOption::new(
+            PathSegment::key("n"),
+            vec![DiffOption::Set, DiffOption::Precision(0.1)],
+        );
+        let err = DiffOptions::default().with_path_option(option).unwrap_err();
+        assert_eq!(err, OptionsError::PrecisionIncompatible);
+    }
+
+    #[test]
+    fn refine_marks_ignored_paths() {
+        let opts = DiffOptions::from_json_str(r#"[{"ignore":[["a","b"]]}]"#).unwrap();
+        let a = opts.refine(&PathSegment::key("a"));
+        assert!(!a.is_ignored());
+        assert!(a.refine(&PathSegment::key("b")).is_ignored());
+        assert!(!a.refine(&PathSegment::key("c")).is_ignored());
+        assert!(DiffOptions::default().with_ignored_paths([Path::new()]).is_ignored());
+    }
+
+    #[test]
+    fn refine_ignores_keys_matching_excluded_patterns() {
+        let opts =
+            DiffOptions::from_json_str(r#"[{"@":["meta"],"^":[{"excludeKeys":["^_"]}]}]"#).unwrap();
+        assert!(!opts.refine(&PathSegment::key("_id")).is_ignored());
+        let meta = opts.refine(&PathSegment::key("meta"));
+        assert!(meta.refine(&PathSegment::key("_id")).is_ignored());
+        assert!(!meta.refine(&PathSegment::key("id")).is_ignored());
+        let nested = meta.refine(&PathSegment::key("labels"));
+        assert!(nested.refine(&PathSegment::key("_rev")).is_ignored());
+        assert!(!nested.refine(&PathSegment::index(0)).is_ignored());
+    }
+
+    #[test]
+    fn rejects_invalid_key_patterns() {
+        let err = DiffOptions::default().with_excluded_keys(["("]).unwrap_err();
+        assert!(
+            matches!(err, OptionsError::InvalidKeyPattern { ref pattern, .. } if pattern == "(")
+        );
+        let err = DiffOptions::from_json_str(r#"[{"@":["a"],"^":[{"excludeKeys":["["]}]}]"#);
+        assert!(matches!(err, Err(OptionsError::InvalidKeyPattern { .. })));
+    }
+
+    #[test]
+    fn refine_activates_options_at_their_path() {
+        let option = PathOption::new(
+            Path::from(vec![PathSegment::key("a"), PathSegment::key("b")]),
+            vec![DiffOption::MultiSet],
+        );
+        let opts = DiffOptions::default().with_path_option(option).unwrap();
+        let a = opts.refine(&PathSegment::key("a"));
+        assert_eq!(a.array_mode(), ArrayMode::List);
+        let b = a.refine(&PathSegment::key("b"));
+        assert_eq!(b.array_mode(), ArrayMode::MultiSet);
+        assert_eq!(b.refine(&PathSegment::MultiSet).array_mode(), ArrayMode::MultiSet);
+        assert_eq!(opts.refine(&PathSegment::key("c")).path_options().len(), 0);
+    }
+
+    #[test]
+    fn refine_activates_query_options_wherever_they_match() {
+        let query = JsonPath::parse("$..tags").unwrap();
+        let opts = DiffOptions::default().with_query_option(&query, vec![DiffOption::Set]).unwrap();
+        let tags = opts.refine(&PathSegment::key("tags"));
+        assert_eq!(tags.array_mode(), ArrayMode::Set);
+        let nested = opts.refine(&PathSegment::index(0)).into_owned();
+        assert_eq!(nested.array_mode(), ArrayMode::List);
+        assert_eq!(nested.refine(&PathSegment::key("tags")).array_mode(), ArrayMode::Set);
+        let root = JsonPath::parse("$").unwrap();
+        let opts = DiffOptions::default().with_query_option(&root, vec![DiffOption::Set]).unwrap();
+        assert_eq!(opts.array_mode(), ArrayMode::Set);
+        assert!(!opts.is_refined());
+    }
+
+    #[test]
+    fn strategic_merge_keys_stop_at_list_members() {
+        let merge = StrategicMerge::new().with_merge_key(JsonPath::parse("$.items").unwrap(), "id");
+        let opts = DiffOptions::default().with_strategic_merge(&merge);
+        let items = opts.refine(&PathSegment::key("items"));
+        assert_eq!(items.set_keys(), Some(&["id".to_string()][..]));
+        let members = items.refine(&PathSegment::Set);
+        assert_eq!(members.array_mode(), ArrayMode::Set);
+        let inner = members.refine(&PathSegment::key("tags"));
+        assert_eq!(inner.array_mode(), ArrayMode::List);
+        assert_eq!(inner.set_keys(), None);
+
+        let lhs = Node::from_json_str(r#"{"items":[{"id":1,"tags":[1,2]},{"id":2}]}"#).unwrap();
+        let rhs = Node::from_json_str(r#"{"items":[{"id":2},{"id":1,"tags":[2,1]}]}"#).unwrap();
+        let diff = lhs.diff(&rhs, &opts);
+        assert_eq!(diff.len(), 2);
+        let patched = lhs.apply_patch_with_options(&diff, &opts).unwrap();
+        assert!(patched.eq_with_options(&rhs, &opts));
+    }
+
+    #[test]
+    fn empty_path_applies_globally() {
+        let option = PathOption::new(Path::new(), vec![DiffOption::Set]);
+        let opts = DiffOptions::default().with_path_option(option).unwrap();
+        assert_eq!(opts.array_mode(), ArrayMode::Set);
+        assert!(opts.path_options().is_empty());
+    }
+
     #[test]
     fn set_keys_force_set_mode() {
         let opts = DiffOptions::default().with_set_keys(["id"]).unwrap();
@@ -0,0 +1,296 @@
+//! Key order recorded from source documents.
+//!
+//! [`Node`] objects live in sorted maps, so equality, hashing, and diffs never
+//! depend on how a document happened to list its keys. A [`KeyOrder`] records
+//! that listing on the side, which lets a patched document be written back
+//! with its keys where the author put them instead of sorted.
+
+use alloc::collections::BTreeMap;
+use core::fmt;
+
+use serde::de::{Deserialize, Deserializer, IgnoredAny, MapAccess, SeqAccess, Visitor};
+use serde_json::Value as JsonValue;
+
+use crate::prelude::*;
+use crate::{jsonc, CanonicalizeError, Node, ParseOptions};
+
+/// The key that serde_json's `arbitrary_precision` feature uses to hand a
+/// number to a visitor as a single-entry map.
+pub(crate) const JSON_NUMBER_TOKEN: &str = "$serde_json::private::Number";
+
+/// Shared by every value without a recorded order.
+static UNORDERED: KeyOrder = KeyOrder { shape: Shape::Unordered };
+
+/// The order in which a document listed the keys of each of its objects.
+///
+/// Pass it to [`Node::to_json_string_ordered`] or
+/// [`Node::to_yaml_string_ordered`] to render a node, typically the result of
+/// a patch, with its objects' keys in the recorded order. Keys the document
+/// did not have follow in the usual sorted order. List items take the order
+/// recorded for the item at the same index.
+///
+/// ```
+/// # use jd_core::{KeyOrder, Node};
+/// let text = r#"{"name":"jd","deps":{"z":1,"a":2}}"#;
+/// let order = KeyOrder::from_json_str(text).unwrap();
+/// let node = Node::from_json_str(text).unwrap();
+/// assert_eq!(node.to_json_value().unwrap().to_string(), r#"{"deps":{"a":2,"z":1},"name":"jd"}"#);
+/// assert_eq!(node.to_json_string_ordered(&order).unwrap(), text);
+/// ```
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+pub struct KeyOrder {
+    shape: Shape,
+}
+
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+enum Shape {
+    /// A scalar, or a document that recorded nothing.
+    #[default]
+    Unordered,
+    /// Keys in document order, with the order recorded beneath each one.
+    Object {
+        keys: Vec<String>,
+        fields: BTreeMap<String, KeyOrder>,
+    },
+    Array(Vec<KeyOrder>),
+}
+
+impl KeyOrder {
+    /// Records the key order of a JSON document. Blank input records nothing,
+    /// as [`Node::from_json_str`] reads it as [`Node::Void`].
+    ///
+    /// ```
+    /// # use jd_core::KeyOrder;
+    /// assert!(KeyOrder::from_json_str(r#"{"b":1,"a":2}"#).is_ok());
+    /// assert!(KeyOrder::from_json_str("{").is_err());
+    /// ```
+    pub fn from_json_str(input: &str) -> Result<Self, CanonicalizeError> {
+        Self::from_json_str_with_options(input, &ParseOptions::default())
+    }
+
+    /// Records the key order of a JSON document read with `options`, so
+    /// that JSONC input is accepted when [`ParseOptions::jsonc`] is set.
+    ///
+    /// ```
+    /// # use jd_core::{KeyOrder, ParseOptions};
+    /// let jsonc = ParseOptions::default().with_jsonc(true);
+    /// assert!(KeyOrder::from_json_str_with_options("{\"b\":1, // note\n\"a\":2,}", &jsonc).is_ok());
+    /// ```
+    pub fn from_json_str_with_options(
+        input: &str,
+        options: &ParseOptions,
+    ) -> Result<Self, CanonicalizeError> {
+        let stripped;
+        let input = if options.jsonc() {
+            stripped = jsonc::strip(input);
+            &stripped
+        } else {
+            input
+        };
+        if input.trim().is_empty() {
+            return Ok(Self::default());
+        }
+        Ok(serde_json::from_str(input)?)
+    }
+
+    /// Records the key order of a YAML document.
+    #[cfg(feature = "yaml")]
+    ///
+    /// ```
+    /// # use jd_core::{KeyOrder, Node};
+    /// let text = "kind: Pod\nmetadata:\n  name: web\n";
+    /// let order = KeyOrder::from_yaml_str(text).unwrap();
+    /// let node = Node::from_yaml_str(text).unwrap();
+    /// assert_eq!(node.to_yaml_string_ordered(&order).unwrap(), text);
+    /// ```
+    pub fn from_yaml_str(input: &str) -> Result<Self, CanonicalizeError> {
+        if input.trim().is_empty() {
+            return Ok(Self::default());
+        }
+        Ok(serde_yaml::from_str(input)?)
+    }
+
+    /// Returns the order recorded beneath `key`.
+    pub(crate) fn field(&self, key: &str) -> &KeyOrder {
+        match &self.shape {
+            Shape::Object { fields, .. } => fields.get(key).unwrap_or(&UNORDERED),
+            _ => &UNORDERED,
+        }
+    }
+
+    /// Returns the order recorded for the list item at `index`.
+    pub(crate) fn item(&self, index: usize) -> &KeyOrder {
+        match &self.shape {
+            Shape::Array(items) => items.get(index).unwrap_or(&UNORDERED),
+            _ => &UNORDERED,
+        }
+    }
+
+    /// Puts the entries of `map` with a recorded key first, in document
+    /// order, followed by the remaining `sorted` entries as given.
+    pub(crate) fn arrange<'a>(
+        &self,
+        map: &'a BTreeMap<String, Node>,
+        sorted: Vec<(&'a String, &'a Node)>,
+    ) -> Vec<(&'a String, &'a Node)> {
+        let Shape::Object { keys, fields } = &self.shape else {
+            return sorted;
+        };
+        let mut entries: Vec<_> = keys.iter().filter_map(|key| map.get_key_value(key)).collect();
+        entries.extend(sorted.into_iter().filter(|(key, _)| !fields.contains_key(*key)));
+        entries
+    }
+}
+
+impl<'de> Deserialize<'de> for KeyOrder {
+    fn deserialize<D: Deserializer<'de>>(deserializer: D) -> Result<Self, D::Error> {
+        deserializer.deserialize_any(OrderVisitor)
+    }
+}
+
+struct OrderVisitor;
+
+impl<'de> Visitor<'de> for OrderVisitor {
+    type Value = KeyOrder;
+
+    fn expecting(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str("a JSON or YAML value")
+    }
+
+    fn visit_bool<E>(self, _: bool) -> Result<KeyOrder, E> {
+        Ok(KeyOrder::default())
+    }
+
+    fn visit_i64<E>(self, _: i64) -> Result<KeyOrder, E> {
+        Ok(KeyOrder::default())
+    }
+
+    fn visit_u64<E>(self, _: u64) -> Result<KeyOrder, E> {
+        Ok(KeyOrder::default())
+    }
+
+    fn visit_f64<E>(self, _: f64) -> Result<KeyOrder, E> {
+        Ok(KeyOrder::default())
+    }
+
+    fn visit_str<E>(self, _: &str) -> Result<KeyOrder, E> {
+        Ok(KeyOrder::default())
+    }
+
+    fn visit_unit<E>(self) -> Result<KeyOrder, E> {
+        Ok(KeyOrder::default())
+    }
+
+    fn visit_none<E>(self) -> Result<KeyOrder, E> {
+        Ok(KeyOrder::default())
+    }
+
+    fn visit_some<D: Deserializer<'de>>(self, deserializer: D) -> Result<KeyOrder, D::Error> {
+        KeyOrder::deserialize(deserializer)
+    }
+
+    fn visit_seq<A: SeqAccess<'de>>(self, mut seq: A) -> Result<KeyOrder, A::Error> {
+        let mut items = Vec::new();
+        while let Some(item) = seq.next_element()? {
+            items.push(item);
+        }
+        Ok(KeyOrder { shape: Shape::Array(items) })
+    }
+
+    fn visit_map<A: MapAccess<'de>>(self, mut map: A) -> Result<KeyOrder, A::Error> {
+        let mut keys = Vec::new();
+        let mut fields = BTreeMap::new();
+        while let Some(key) = map.next_key::<String>()? {
+            if key == JSON_NUMBER_TOKEN && keys.is_empty() {
+                map.next_value::<IgnoredAny>()?;
+                return Ok(KeyOrder::default());
+            }
+            let child = map.next_value()?;
+            // A repeated key keeps its first position.
+            if fields.insert(key.clone(), child).is_none() {
+                keys.push(key);
+            }
+        }
+        Ok(KeyOrder { shape: Shape::Object { keys, fields } })
+    }
+}
+
+/// Writes `node` as compact JSON, ordering object keys by `order`. Returns
+/// `None` when the node contains [`Node::Void`].
+pub(crate) fn json_string(node: &Node, order: &KeyOrder) -> Option<String> {
+    let mut out = String::new();
+    write_json(node, order, &mut out)?;
+    Some(out)
+}
+
+fn write_json(node: &Node, order: &KeyOrder, out: &mut String) -> Option<()> {
+    match node {
+        Node::Array(values) => {
+            out.push('[');
+            for (index, value) in values.iter().enumerate() {
+                if index > 0 {
+                    out.push(',');
+                }
+                write_json(value, order.item(index), out)?;
+            }
+            out.push(']');
+        }
+        Node::Object(map) => {
+            out.push('{');
+            for (index, (key, value)) in
+                order.arrange(map, map.iter().collect()).into_iter().enumerate()
+            {
+                if index > 0 {
+                    out.push(',');
+                }
+                out.push_str(&JsonValue::String(key.clone()).to_string());
+                out.push(':');
+                write_json(value, order.field(key), out)?;
+            }
+            out.push('}');
+        }
+        scalar => out.push_str(&scalar.to_json_value()?.to_string()),
+    }
+    Some(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn ordered(text: &str, node: &Node) -> String {
+        json_string(node, &KeyOrder::from_json_str(text).unwrap()).unwrap()
+    }
+
+    #[test]
+    fn recorded_keys_come_first_and_new_keys_follow_sorted() {
+        let text = r#"{"z":1,"m":{"y":[{"q":1,"p":2}],"x":2},"a":3}"#;
+        let mut node = Node::from_json_str(text).unwrap();
+        assert_eq!(ordered(text, &node), text);
+
+        let Node::Object(map) = &mut node else { panic!() };
+        map.remove("z");
+        map.insert("c".into(), Node::Null);
+        map.insert("b".into(), Node::Bool(true));
+        assert_eq!(
+            ordered(text, &node),
+            r#"{"m":{"y":[{"q":1,"p":2}],"x":2},"a":3,"b":true,"c":null}"#
+        );
+    }
+
+    #[test]
+    fn repeated_keys_keep_their_first_position() {
+        let text = r#"{"b":1,"a":2,"b":3}"#;
+        let node = Node::from_json_str(r#"{"a":2,"b":3}"#).unwrap();
+        assert_eq!(ordered(text, &node), r#"{"b":3,"a":2}"#);
+    }
+
+    #[test]
+    fn numbers_and_blank_input_record_nothing() {
+        assert_eq!(KeyOrder::from_json_str("12345678901234567890").unwrap(), KeyOrder::default());
+        assert_eq!(KeyOrder::from_json_str(" ").unwrap(), KeyOrder::default());
+        let node = Node::from_json_str(r#"{"b":1,"a":2}"#).unwrap();
+        assert_eq!(json_string(&node, &KeyOrder::default()).unwrap(), r#"{"a":2,"b":1}"#);
+        assert_eq!(json_string(&Node::Void, &KeyOrder::default()), None);
+    }
+}
@@ -4,16 +4,43 @@
 //! interpreting `DiffElement` metadata, enforcing list context validation, and
 //! recursing through objects and arrays using strict or merge strategies.
 
-use std::collections::BTreeMap;
-use std::fmt;
+mod check;
+mod fuzz;
+mod partial;
+mod rfc6902;
+mod rfc7386;
+mod strategic;
 
+pub use check::{HunkCheck, PatchCheck};
+pub use fuzz::{FuzzyPatch, HunkOffset};
+pub use partial::{PartialPatch, RejectedHunk};
+pub use rfc7386::NullMerge;
+pub use strategic::StrategicMerge;
+
+use alloc::collections::BTreeMap;
+use core::fmt;
+
+use serde::ser::{Serialize, SerializeMap, Serializer};
+
+use crate::prelude::*;
 use crate::{
     diff::{Path, PathSegment},
-    Diff, DiffMetadata, Node,
+    hash::HashCode,
+    number::is_integral,
+    ArrayMode, ContextMismatch, Diff, DiffElement, DiffMetadata, DiffOptions, Node, NumberEquality,
+    PatchStrictness,
 };
 
 /// Errors that can occur while applying a diff.
 ///
+/// Besides the message, a conflict records where it happened: the hunk
+/// being applied, the path of the value checked there, and the value the
+/// diff expected next to the one found. Each part is `None` when it does not
+/// apply; an expected or found [`Node::Void`] stands for a missing value.
+/// The error serializes as a JSON object with `message`, `hunk`, `path`,
+/// `expected`, and `actual` fields, leaving out the parts it does not have,
+/// for tools that act on conflicts.
+///
 /// ```
 /// # use jd_core::{DiffOptions, Node};
 /// let base = Node::from_json_str("[1,2,3]").unwrap();
@@ -21,15 +48,114 @@ use crate::{
 /// let diff = base.diff(&target, &DiffOptions::default());
 /// let err = Node::from_json_str("[0,2,3]").unwrap().apply_patch(&diff).unwrap_err();
 /// assert_eq!(err.to_string(), "invalid patch. expected 1 before. got 0");
+/// assert_eq!(
+///     serde_json::to_string(&err).unwrap(),
+///     r#"{"message":"invalid patch. expected 1 before. got 0","hunk":0,"path":[0],"expected":1,"actual":0}"#
+/// );
 /// ```
-#[derive(Debug, Clone, PartialEq, Eq)]
+#[derive(Debug, Clone, PartialEq)]
 pub struct PatchError {
     message: String,
+    hunk: Option<usize>,
+    path: Option<Path>,
+    expected: Option<Box<Node>>,
+    actual: Option<Box<Node>>,
 }
 
 impl PatchError {
     fn new(message: impl Into<String>) -> Self {
-        Self { message: message.into() }
+        Self { message: message.into(), hunk: None, path: None, expected: None, actual: None }
+    }
+
+    /// Records the hunk, or JSON Patch operation, being applied.
+    fn in_hunk(mut self, index: usize) -> Self {
+        self.hunk = Some(index);
+        self
+    }
+
+    /// Records the path of the value the error is about.
+    fn at(mut self, path: &[PathSegment]) -> Self {
+        self.path = Some(Path::from(path.to_vec()));
+        self
+    }
+
+    /// Records the value the diff expected.
+    fn expecting(mut self, expected: &Node) -> Self {
+        self.expected = Some(Box::new(expected.clone()));
+        self
+    }
+
+    /// Records the value the document held instead.
+    fn finding(mut self, actual: &Node) -> Self {
+        self.actual = Some(Box::new(actual.clone()));
+        self
+    }
+
+    /// Returns the message, as the error displays.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let err = Node::Null.apply_json_patch("{").unwrap_err();
+    /// assert!(err.message().starts_with("invalid JSON Patch"));
+    /// ```
+    #[must_use]
+    pub fn message(&self) -> &str {
+        &self.message
+    }
+
+    /// Returns the position, counting from zero, of the hunk or JSON Patch
+    /// operation that failed.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n+ 1\n@ [\"b\"]\n- 2\n").unwrap();
+    /// let err = Node::from_json_str("{}").unwrap().apply_patch(&diff).unwrap_err();
+    /// assert_eq!(err.hunk(), Some(1));
+    /// ```
+    #[must_use]
+    pub fn hunk(&self) -> Option<usize> {
+        self.hunk
+    }
+
+    /// Returns the path of the value the error is about: the value compared
+    /// against the diff, or the container that could not be entered.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node, Path, PathSegment};
+    /// let diff = Diff::from_native_str("@ [\"a\",0]\n- 1\n").unwrap();
+    /// let err = Node::from_json_str(r#"{"a":[2]}"#).unwrap().apply_patch(&diff).unwrap_err();
+    /// let expected = Path::from(vec![PathSegment::key("a"), PathSegment::Index(0)]);
+    /// assert_eq!(err.path(), Some(&expected));
+    /// ```
+    #[must_use]
+    pub fn path(&self) -> Option<&Path> {
+        self.path.as_ref()
+    }
+
+    /// Returns the value the diff expected at [`PatchError::path`].
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n+ 2\n").unwrap();
+    /// let err = Node::from_json_str(r#"{"a":3}"#).unwrap().apply_patch(&diff).unwrap_err();
+    /// assert_eq!(err.expected(), Some(&Node::from_json_str("1").unwrap()));
+    /// ```
+    #[must_use]
+    pub fn expected(&self) -> Option<&Node> {
+        self.expected.as_deref()
+    }
+
+    /// Returns the value found at [`PatchError::path`] instead.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n").unwrap();
+    /// let err = Node::from_json_str("{}").unwrap().apply_patch(&diff).unwrap_err();
+    /// assert_eq!(err.actual(), Some(&Node::Void));
+    /// ```
+    #[must_use]
+    pub fn actual(&self) -> Option<&Node> {
+        self.actual.as_deref()
     }
 }
 
@@ -39,7 +165,26 @@ impl fmt::Display for PatchError {
     }
 }
 
-impl std::error::Error for PatchError {}
+impl Serialize for PatchError {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        let mut map = serializer.serialize_map(None)?;
+        map.serialize_entry("message", &self.message)?;
+        if let Some(hunk) = self.hunk {
+            map.serialize_entry("hunk", &hunk)?;
+        }
+        if let Some(path) = &self.path {
+            map.serialize_entry("path", path)?;
+        }
+        for (key, value) in [("expected", &self.expected), ("actual", &self.actual)] {
+            if let Some(value) = value.as_deref().and_then(Node::to_json_value) {
+                map.serialize_entry(key, &value)?;
+            }
+        }
+        map.end()
+    }
+}
+
+impl core::error::Error for PatchError {}
 
 #[derive(Clone, Copy, Debug, PartialEq, Eq)]
 enum PatchStrategy {
@@ -66,31 +211,127 @@ impl fmt::Display for PatchStrategy {
     }
 }
 
-pub(crate) fn apply_patch(node: &Node, diff: &Diff) -> Result<Node, PatchError> {
-    let mut current = node.clone();
-    let mut inherited_metadata: Option<DiffMetadata> = None;
-    for element in diff.iter() {
-        if let Some(meta) = element.metadata.as_ref().filter(|metadata| metadata.is_effective()) {
-            if let Some(existing) = inherited_metadata.as_mut() {
-                existing.absorb(meta);
-            } else {
-                inherited_metadata = Some(meta.clone());
-            }
+pub(crate) fn apply_patch(
+    node: &Node,
+    diff: &Diff,
+    options: &DiffOptions,
+) -> Result<Node, PatchError> {
+    fuzz::apply(node, diff, options).map(|patched| patched.node)
+}
+
+pub(crate) fn apply_patch_fuzzy(
+    node: &Node,
+    diff: &Diff,
+    options: &DiffOptions,
+) -> Result<FuzzyPatch, PatchError> {
+    fuzz::apply(node, diff, options)
+}
+
+pub(crate) fn apply_patch_partial(node: &Node, diff: &Diff, options: &DiffOptions) -> PartialPatch {
+    partial::apply(node, diff, options)
+}
+
+/// Folds the effective metadata of `element` into the metadata inherited from
+/// earlier hunks.
+fn inherit_metadata(inherited: &mut Option<DiffMetadata>, element: &DiffElement) {
+    if let Some(meta) = element.metadata.as_ref().filter(|metadata| metadata.is_effective()) {
+        if let Some(existing) = inherited.as_mut() {
+            existing.absorb(meta);
+        } else {
+            *inherited = Some(meta.clone());
+        }
+    }
+}
+
+/// Applies one hunk to `current` under the metadata inherited so far,
+/// returning the patched node and the context mismatches let through.
+fn apply_element(
+    mut current: Node,
+    element: &DiffElement,
+    inherited: Option<&DiffMetadata>,
+    options: &DiffOptions,
+) -> Result<(Node, Vec<PatchError>), PatchError> {
+    if options.is_cancelled() {
+        return Err(PatchError::new("patch cancelled").at(element.path.segments()));
+    }
+    let metadata = inherited.filter(|metadata| metadata.is_effective());
+    let strategy = PatchStrategy::from_metadata(metadata);
+    let precision = metadata.and_then(|metadata| metadata.precision);
+    let mut compare = compare_options(precision.unwrap_or_else(|| options.precision()))
+        .with_number_equality(options.number_equality())
+        .with_patch_strictness(options.patch_strictness())
+        .with_context_mismatch(options.context_mismatch())
+        .with_comparators_of(options);
+    if let Some(metadata) = metadata {
+        compare = metadata.apply_to(compare);
+    }
+    if compare.is_refined() {
+        // Header options scoped to a path hold from the document root, while
+        // the values checked below sit at the hunk's path.
+        for segment in element.path.segments() {
+            compare = compare.refine(segment).into_owned();
         }
-        let metadata = inherited_metadata.as_ref().filter(|metadata| metadata.is_effective());
-        let strategy = PatchStrategy::from_metadata(metadata);
+    }
+    let mut warnings = Vec::new();
+    if let Some(from) = &element.moved_from {
+        // Take the moved value out first; the insertion below puts it back.
         current = patch_element(
             current,
             Vec::new(),
-            element.path.segments(),
-            &element.before,
-            &element.remove,
+            from.segments(),
+            &[],
             &element.add,
-            &element.after,
+            &[],
+            &[],
             strategy,
+            &compare,
+            &mut warnings,
         )?;
     }
-    Ok(current)
+    let patched = patch_element(
+        current,
+        Vec::new(),
+        element.path.segments(),
+        &element.before,
+        &element.remove,
+        &element.add,
+        &element.after,
+        strategy,
+        &compare,
+        &mut warnings,
+    )?;
+    Ok((patched, warnings))
+}
+
+pub(crate) fn apply_json_patch(node: &Node, patch: &str) -> Result<Node, PatchError> {
+    rfc6902::apply(node, patch)
+}
+
+pub(crate) fn apply_merge_patch(node: &Node, patch: &str) -> Result<Node, PatchError> {
+    rfc7386::apply(node, patch)
+}
+
+pub(crate) fn apply_strategic_merge_patch(
+    node: &Node,
+    patch: &Node,
+    merge: &StrategicMerge,
+) -> Result<Node, PatchError> {
+    strategic::apply(node, patch, merge)
+}
+
+pub(crate) fn deep_merge(target: &Node, other: &Node, nulls: NullMerge) -> Node {
+    if matches!(other, Node::Void) {
+        return target.clone();
+    }
+    rfc7386::merge(target.clone(), other.clone(), nulls)
+}
+
+/// Builds the options used for context checks: exact list comparison with an
+/// optional numeric tolerance. Invalid precisions fall back to exact matching.
+/// Callers add the patch options' number equality, strictness, and
+/// comparators on top.
+fn compare_options(precision: f64) -> DiffOptions {
+    DiffOptions::default().with_precision(precision).unwrap_or_default()
 }
 
 // Mirrors the Go implementation signature for parity with the CLI contract.
@@ -104,11 +345,17 @@ fn patch_element(
     add: &[Node],
     after: &[Node],
     strategy: PatchStrategy,
+    compare: &DiffOptions,
+    warnings: &mut Vec<PatchError>,
 ) -> Result<Node, PatchError> {
+    let node = match path_ahead.first() {
+        Some(segment) if is_void(&node) && is_forced(compare) => empty_container(segment),
+        _ => node,
+    };
     if !path_ahead.is_empty() && strategy == PatchStrategy::Merge {
         let (segment, rest) = path_ahead.split_first().unwrap();
         let PathSegment::Key(key) = segment else {
-            return Err(expected_collection_error(&node, segment));
+            return Err(expected_collection_error(&node, &path_behind, segment));
         };
 
         match node {
@@ -122,8 +369,10 @@ fn patch_element(
                 });
                 let mut new_path = path_behind.clone();
                 new_path.push(PathSegment::Key(key.clone()));
-                let patched =
-                    patch_element(existing, new_path, rest, before, remove, add, after, strategy)?;
+                let patched = patch_element(
+                    existing, new_path, rest, before, remove, add, after, strategy, compare,
+                    warnings,
+                )?;
                 if is_void(&patched) && rest.is_empty() {
                     // Removal handled via map.remove above.
                 } else if !is_void(&patched) || !rest.is_empty() {
@@ -135,8 +384,9 @@ fn patch_element(
                 let seed = if rest.is_empty() { Node::Void } else { Node::Object(BTreeMap::new()) };
                 let mut new_path = path_behind.clone();
                 new_path.push(PathSegment::Key(key.clone()));
-                let patched =
-                    patch_element(seed, new_path, rest, before, remove, add, after, strategy)?;
+                let patched = patch_element(
+                    seed, new_path, rest, before, remove, add, after, strategy, compare, warnings,
+                )?;
                 let mut map = BTreeMap::new();
                 if !is_void(&patched) || !rest.is_empty() {
                     map.insert(key.clone(), patched);
@@ -147,17 +397,45 @@ fn patch_element(
     }
 
     match node {
-        Node::Array(values) => {
-            patch_list(values, path_behind, path_ahead, before, remove, add, after, strategy)
-        }
-        Node::Object(map) => {
-            patch_object(map, path_behind, path_ahead, before, remove, add, after, strategy)
-        }
+        Node::Array(values) => patch_list(
+            values,
+            path_behind,
+            path_ahead,
+            before,
+            remove,
+            add,
+            after,
+            strategy,
+            compare,
+            warnings,
+        ),
+        Node::Object(map) => patch_object(
+            map,
+            path_behind,
+            path_ahead,
+            before,
+            remove,
+            add,
+            after,
+            strategy,
+            compare,
+            warnings,
+        ),
         other => {
             if let Some(segment) = path_ahead.first() {
-                return Err(expected_collection_error(&other, segment));
+                return Err(scalar_path_error(&path_behind, segment));
             }
-            patch_scalar(other, path_behind, path_ahead, before, remove, add, after, strategy)
+            patch_scalar(
+                other,
+                path_behind,
+                path_ahead,
+                before,
+                remove,
+                add,
+                after,
+                strategy,
+                compare,
+            )
         }
     }
 }
@@ -173,10 +451,11 @@ fn patch_scalar(
     new_values: &[Node],
     _after: &[Node],
     strategy: PatchStrategy,
+    compare: &DiffOptions,
 ) -> Result<Node, PatchError> {
     if !path_ahead.is_empty() {
         if let Some(segment) = path_ahead.first() {
-            return Err(expected_collection_error(&node, segment));
+            return Err(scalar_path_error(&path_behind, segment));
         }
     }
     if old_values.len() > 1 || new_values.len() > 1 {
@@ -191,11 +470,12 @@ fn patch_scalar(
                     "patch with merge strategy at {} has unnecessary old value {}",
                     path_to_string(&path_behind),
                     node_json(&old_value)
-                )));
+                ))
+                .at(&path_behind));
             }
         }
         PatchStrategy::Strict => {
-            if !node_equals(&node, &old_value) {
+            if !is_lenient(compare) && !node_equals(&node, &old_value, &path_behind, compare) {
                 return Err(expect_value_error(&old_value, &node, &path_behind));
             }
         }
@@ -209,11 +489,13 @@ fn patch_object(
     mut map: BTreeMap<String, Node>,
     path_behind: Vec<PathSegment>,
     path_ahead: &[PathSegment],
-    _before: &[Node],
+    before: &[Node],
     old_values: &[Node],
     new_values: &[Node],
-    _after: &[Node],
+    after: &[Node],
     strategy: PatchStrategy,
+    compare: &DiffOptions,
+    warnings: &mut Vec<PatchError>,
 ) -> Result<Node, PatchError> {
     if path_ahead.is_empty() {
         if old_values.len() > 1 || new_values.len() > 1 {
@@ -224,7 +506,10 @@ fn patch_object(
             return Ok(new_value);
         }
         let old_value = single_value(old_values);
-        if !node_equals(&Node::Object(map.clone()), &old_value) {
+        if is_lenient(compare) {
+            return Ok(new_value);
+        }
+        if !node_equals(&Node::Object(map.clone()), &old_value, &path_behind, compare) {
             return Err(expect_value_error(&old_value, &Node::Object(map), &path_behind));
         }
         return Ok(new_value);
@@ -232,11 +517,14 @@ fn patch_object(
 
     let (segment, rest) = path_ahead.split_first().unwrap();
     let PathSegment::Key(key) = segment else {
+        let found = Node::Object(map);
         return Err(PatchError::new(format!(
             "found {} at {}: expected JSON object",
-            node_json(&Node::Object(map.clone())),
+            node_json(&found),
             path_to_string(&path_behind)
-        )));
+        ))
+        .at(&path_behind)
+        .finding(&found));
     };
 
     let mut next = map.get(key).cloned();
@@ -255,8 +543,18 @@ fn patch_object(
 
     let mut new_path = path_behind.clone();
     new_path.push(PathSegment::Key(key.clone()));
-    let patched =
-        patch_element(next.unwrap(), new_path, rest, &[], old_values, new_values, &[], strategy)?;
+    let patched = patch_element(
+        next.unwrap(),
+        new_path,
+        rest,
+        before,
+        old_values,
+        new_values,
+        after,
+        strategy,
+        compare,
+        warnings,
+    )?;
 
     if is_void(&patched) {
         map.remove(key);
@@ -277,6 +575,8 @@ fn patch_list(
     add: &[Node],
     after: &[Node],
     strategy: PatchStrategy,
+    compare: &DiffOptions,
+    warnings: &mut Vec<PatchError>,
 ) -> Result<Node, PatchError> {
     if strategy == PatchStrategy::Merge {
         return patch_scalar(
@@ -288,24 +588,35 @@ fn patch_list(
             add,
             after,
             strategy,
+            compare,
         );
     }
 
     if path_ahead.is_empty() {
         if remove.len() > 1 || add.len() > 1 {
-            return Err(PatchError::new("cannot replace list with multiple values"));
+            return Err(
+                PatchError::new("cannot replace list with multiple values").at(&path_behind)
+            );
+        }
+        if is_lenient(compare) {
+            return Ok(add.first().cloned().unwrap_or(Node::Void));
         }
         if remove.is_empty() {
-            return Err(PatchError::new("invalid diff. must declare list to replace it"));
+            return Err(
+                PatchError::new("invalid diff. must declare list to replace it").at(&path_behind)
+            );
         }
         let wanted = &remove[0];
         let current = Node::Array(list);
-        if !node_equals(&current, wanted) {
+        if !node_equals(&current, wanted, &path_behind, compare) {
             return Err(PatchError::new(format!(
                 "wanted {}. found {}",
                 node_json(wanted),
                 node_json(&current)
-            )));
+            ))
+            .at(&path_behind)
+            .expecting(wanted)
+            .finding(&current));
         }
         if add.is_empty() {
             return Ok(Node::Void);
@@ -314,19 +625,46 @@ fn patch_list(
     }
 
     let (segment, rest) = path_ahead.split_first().unwrap();
+    match segment {
+        PathSegment::Set => return patch_set(list, path_behind, rest, remove, add, compare),
+        PathSegment::MultiSet => {
+            return patch_multiset(list, path_behind, rest, remove, add, compare)
+        }
+        PathSegment::SetKeys(keys) => {
+            return patch_set_member(
+                list,
+                path_behind,
+                keys,
+                rest,
+                before,
+                remove,
+                add,
+                after,
+                strategy,
+                compare,
+                warnings,
+            );
+        }
+        _ => {}
+    }
     let PathSegment::Index(raw_index) = segment else {
-        return Err(invalid_path_element_error(segment));
+        return Err(invalid_path_element_error(segment).at(&path_behind));
     };
+    let lenient = is_lenient(compare);
+    let (before, after) = if lenient { (&[][..], &[][..]) } else { (before, after) };
 
     if !rest.is_empty() {
         if *raw_index < 0 || (*raw_index as usize) >= list.len() {
-            return Err(PatchError::new(format!("patch index out of bounds: {raw_index}")));
+            return Err(PatchError::new(format!("patch index out of bounds: {raw_index}"))
+                .at(&index_path(&path_behind, *raw_index)));
         }
         let mut new_path = path_behind.clone();
         new_path.push(PathSegment::Index(*raw_index));
         let mut list_clone = list.clone();
         let child = list_clone[*raw_index as usize].clone();
-        let patched = patch_element(child, new_path, rest, &[], remove, add, &[], strategy)?;
+        let patched = patch_element(
+            child, new_path, rest, before, remove, add, after, strategy, compare, warnings,
+        )?;
         list_clone[*raw_index as usize] = patched;
         return Ok(Node::Array(list_clone));
     }
@@ -335,7 +673,8 @@ fn patch_list(
         if !remove.is_empty() {
             return Err(PatchError::new(
                 "invalid patch. appending to -1 index. but want to remove values",
-            ));
+            )
+            .at(&index_path(&path_behind, -1)));
         }
         let mut list_clone = list.clone();
         list_clone.extend(add.iter().cloned());
@@ -343,7 +682,8 @@ fn patch_list(
     }
 
     if *raw_index < 0 {
-        return Err(PatchError::new(format!("patch index out of bounds: {raw_index}")));
+        return Err(PatchError::new(format!("patch index out of bounds: {raw_index}"))
+            .at(&index_path(&path_behind, *raw_index)));
     }
 
     let insertion_index = *raw_index as usize;
@@ -356,40 +696,70 @@ fn patch_list(
             if check_index == -1 && is_void(context) {
                 continue;
             }
-            return Err(PatchError::new(format!(
-                "invalid patch. before context {} out of bounds: {check_index}",
-                node_json(context)
-            )));
+            context_mismatch(
+                PatchError::new(format!(
+                    "invalid patch. before context {} out of bounds: {check_index}",
+                    node_json(context)
+                ))
+                .at(&index_path(&path_behind, check_index as i64))
+                .expecting(context)
+                .finding(&Node::Void),
+                compare,
+                warnings,
+            )?;
+            continue;
         }
         let check_index = check_index as usize;
-        if !node_equals(&original[check_index], context) {
-            return Err(PatchError::new(format!(
-                "invalid patch. expected {} before. got {}",
-                node_json(context),
-                node_json(&original[check_index])
-            )));
+        let at = element_path(&path_behind, check_index);
+        if !node_equals(&original[check_index], context, &at, compare) {
+            context_mismatch(
+                PatchError::new(format!(
+                    "invalid patch. expected {} before. got {}",
+                    node_json(context),
+                    node_json(&original[check_index])
+                ))
+                .at(&at)
+                .expecting(context)
+                .finding(&original[check_index]),
+                compare,
+                warnings,
+            )?;
         }
     }
 
     let mut working = original.clone();
-    if !remove.is_empty() {
+    if lenient {
+        // Remove by position alone, stopping at the end of the list.
+        let end = (insertion_index + remove.len()).min(working.len());
+        working.drain(insertion_index.min(end)..end);
+    } else if !remove.is_empty() {
         if insertion_index >= working.len() {
-            return Err(PatchError::new(format!("remove values out bounds: {raw_index}")));
+            return Err(PatchError::new(format!("remove values out bounds: {raw_index}"))
+                .at(&index_path(&path_behind, *raw_index))
+                .expecting(&remove[0])
+                .finding(&Node::Void));
         }
+        let at = element_path(&path_behind, insertion_index);
         for expected in remove {
-            if !node_equals(&working[insertion_index], expected) {
+            if !node_equals(&working[insertion_index], expected, &at, compare) {
                 return Err(PatchError::new(format!(
                     "invalid patch. wanted {}. found {}",
                     node_json(expected),
                     node_json(&working[insertion_index])
-                )));
+                ))
+                .at(&at)
+                .expecting(expected)
+                .finding(&working[insertion_index]));
             }
             working.remove(insertion_index);
         }
     }
 
+    let insertion_index =
+        if lenient { insertion_index.min(working.len()) } else { insertion_index };
     if insertion_index > working.len() {
-        return Err(PatchError::new(format!("remove values out bounds: {raw_index}")));
+        return Err(PatchError::new(format!("remove values out bounds: {raw_index}"))
+            .at(&index_path(&path_behind, *raw_index)));
     }
 
     let mut result = Vec::with_capacity(working.len() + add.len());
@@ -403,23 +773,261 @@ fn patch_list(
             if check_index == working.len() && is_void(context) {
                 continue;
             }
+            context_mismatch(
+                PatchError::new(format!(
+                    "invalid patch. after context {} out of bounds: {check_index}",
+                    node_json(context)
+                ))
+                .at(&element_path(&path_behind, check_index))
+                .expecting(context)
+                .finding(&Node::Void),
+                compare,
+                warnings,
+            )?;
+            continue;
+        }
+        let at = element_path(&path_behind, check_index);
+        if !node_equals(&working[check_index], context, &at, compare) {
+            context_mismatch(
+                PatchError::new(format!(
+                    "invalid patch. expected {} after. got {}",
+                    node_json(context),
+                    node_json(&working[check_index])
+                ))
+                .at(&at)
+                .expecting(context)
+                .finding(&working[check_index]),
+                compare,
+                warnings,
+            )?;
+        }
+    }
+
+    Ok(Node::Array(result))
+}
+
+/// Settles a list context check that failed with `error` the way `compare`
+/// asks: fails the hunk, records the mismatch in `warnings`, or lets it pass.
+fn context_mismatch(
+    error: PatchError,
+    compare: &DiffOptions,
+    warnings: &mut Vec<PatchError>,
+) -> Result<(), PatchError> {
+    match compare.context_mismatch() {
+        ContextMismatch::Error => Err(error),
+        ContextMismatch::Warn => {
+            warnings.push(error);
+            Ok(())
+        }
+        ContextMismatch::Ignore => Ok(()),
+    }
+}
+
+fn patch_set(
+    set: Vec<Node>,
+    path_behind: Vec<PathSegment>,
+    path_ahead: &[PathSegment],
+    remove: &[Node],
+    add: &[Node],
+    compare: &DiffOptions,
+) -> Result<Node, PatchError> {
+    let mut path = path_behind;
+    path.push(PathSegment::Set);
+    if !path_ahead.is_empty() {
+        return Err(PatchError::new(format!(
+            "invalid path {}: set segment must be the last element",
+            path_to_string(&path)
+        ))
+        .at(&path));
+    }
+
+    let options = set_options();
+    let mut members: BTreeMap<HashCode, Node> =
+        set.into_iter().map(|node| (node.hash_code(&options), node)).collect();
+    for expected in remove {
+        let hash = member_hash(&members, expected, &path, &options, compare, |node| node);
+        if hash.and_then(|hash| members.remove(&hash)).is_none() && !is_lenient(compare) {
             return Err(PatchError::new(format!(
-                "invalid patch. after context {} out of bounds: {check_index}",
-                node_json(context)
-            )));
+                "invalid diff: expected {} at {} but found nothing",
+                node_json(expected),
+                path_to_string(&path[..path.len() - 1])
+            ))
+            .at(&path)
+            .expecting(expected)
+            .finding(&Node::Void));
         }
-        if !node_equals(&working[check_index], context) {
+    }
+    for value in add {
+        members.insert(value.hash_code(&options), value.clone());
+    }
+    // Go rebuilds patched sets in hash order; do the same for parity.
+    Ok(Node::Array(members.into_values().collect()))
+}
+
+// Mirrors the Go implementation signature for parity with the CLI contract.
+#[allow(clippy::too_many_arguments)]
+fn patch_set_member(
+    mut set: Vec<Node>,
+    path_behind: Vec<PathSegment>,
+    keys: &BTreeMap<String, Node>,
+    path_ahead: &[PathSegment],
+    before: &[Node],
+    remove: &[Node],
+    add: &[Node],
+    after: &[Node],
+    strategy: PatchStrategy,
+    compare: &DiffOptions,
+    warnings: &mut Vec<PatchError>,
+) -> Result<Node, PatchError> {
+    let mut path = path_behind;
+    path.push(PathSegment::SetKeys(keys.clone()));
+    let position = match set.iter().position(|node| matches_set_keys(node, keys)) {
+        Some(position) => position,
+        None if is_forced(compare) => {
+            set.push(Node::Object(keys.clone()));
+            set.len() - 1
+        }
+        None => {
             return Err(PatchError::new(format!(
-                "invalid patch. expected {} after. got {}",
-                node_json(context),
-                node_json(&working[check_index])
-            )));
+                "invalid diff: expected object with id {} but found none",
+                PathSegment::SetKeys(keys.clone())
+            ))
+            .at(&path)
+            .finding(&Node::Void));
         }
+    };
+    let member = set[position].clone();
+    let patched = patch_element(
+        member, path, path_ahead, before, remove, add, after, strategy, compare, warnings,
+    )?;
+    if is_void(&patched) {
+        set.remove(position);
+    } else {
+        set[position] = patched;
     }
+    Ok(Node::Array(set))
+}
 
+fn matches_set_keys(node: &Node, keys: &BTreeMap<String, Node>) -> bool {
+    let Node::Object(map) = node else {
+        return false;
+    };
+    keys.iter().all(|(key, value)| map.get(key) == Some(value))
+}
+
+fn patch_multiset(
+    multiset: Vec<Node>,
+    path_behind: Vec<PathSegment>,
+    path_ahead: &[PathSegment],
+    remove: &[Node],
+    add: &[Node],
+    compare: &DiffOptions,
+) -> Result<Node, PatchError> {
+    let mut path = path_behind;
+    path.push(PathSegment::MultiSet);
+    if !path_ahead.is_empty() {
+        return Err(PatchError::new(format!(
+            "invalid path {}: multiset segment must be the last element",
+            path_to_string(&path)
+        ))
+        .at(&path));
+    }
+
+    let options = multiset_options();
+    let mut members: BTreeMap<HashCode, (Node, usize)> = BTreeMap::new();
+    for node in multiset {
+        members.entry(node.hash_code(&options)).or_insert((node, 0)).1 += 1;
+    }
+    for expected in remove {
+        let hash = member_hash(&members, expected, &path, &options, compare, |(node, _)| node);
+        match hash.map(|hash| (hash, members.get_mut(&hash))) {
+            Some((_, Some((_, count)))) if *count > 1 => *count -= 1,
+            Some((hash, Some(_))) => {
+                members.remove(&hash);
+            }
+            _ if is_lenient(compare) => {}
+            _ => {
+                return Err(PatchError::new(format!(
+                    "invalid diff: expected {} at {} but found nothing",
+                    node_json(expected),
+                    path_to_string(&path[..path.len() - 1])
+                ))
+                .at(&path)
+                .expecting(expected)
+                .finding(&Node::Void));
+            }
+        }
+    }
+    for value in add {
+        members.entry(value.hash_code(&options)).or_insert((value.clone(), 0)).1 += 1;
+    }
+    let mut result = Vec::new();
+    for (node, count) in members.into_values() {
+        result.extend(core::iter::repeat_n(node, count));
+    }
     Ok(Node::Array(result))
 }
 
+/// Locates the member bucket matching `expected`, falling back to a
+/// tolerance- and comparator-aware scan when an exact hash lookup misses.
+fn member_hash<V>(
+    members: &BTreeMap<HashCode, V>,
+    expected: &Node,
+    path: &[PathSegment],
+    options: &DiffOptions,
+    compare: &DiffOptions,
+    node_of: impl Fn(&V) -> &Node,
+) -> Option<HashCode> {
+    let hash = expected.hash_code(options);
+    // Typed numbers share a bucket with their numeric twins, so a hit still
+    // needs the scan below to tell `1` from `1.0`.
+    let scan = if members.contains_key(&hash) {
+        compare.number_equality() == NumberEquality::Typed
+    } else {
+        compare.precision() != 0.0 || compare.has_comparators()
+    };
+    if !scan {
+        return Some(hash).filter(|hash| members.contains_key(hash));
+    }
+    let compare = compare.located_at(path);
+    members
+        .iter()
+        .find(|(_, member)| node_of(member).eq_with_options(expected, &compare))
+        .map(|(hash, _)| *hash)
+}
+
+/// Reports whether hunks apply by path alone, without comparing the values
+/// they remove or their list context.
+fn is_lenient(compare: &DiffOptions) -> bool {
+    compare.patch_strictness() != PatchStrictness::Strict
+}
+
+/// Reports whether missing containers on a hunk's path are created.
+fn is_forced(compare: &DiffOptions) -> bool {
+    compare.patch_strictness() == PatchStrictness::Force
+}
+
+/// Returns the empty container that `segment` descends into.
+fn empty_container(segment: &PathSegment) -> Node {
+    match segment {
+        PathSegment::Key(_) => Node::Object(BTreeMap::new()),
+        PathSegment::Index(_)
+        | PathSegment::Set
+        | PathSegment::MultiSet
+        | PathSegment::SetKeys(_) => Node::Array(Vec::new()),
+    }
+}
+
+fn set_options() -> DiffOptions {
+    DiffOptions::default().with_array_mode(ArrayMode::Set).expect("set mode without precision")
+}
+
+fn multiset_options() -> DiffOptions {
+    DiffOptions::default()
+        .with_array_mode(ArrayMode::MultiSet)
+        .expect("multiset mode without precision")
+}
+
 fn non_set_diff_error(
     old_values: &[Node],
     _new_values: &[Node],
@@ -429,12 +1037,14 @@ fn non_set_diff_error(
         return PatchError::new(format!(
             "invalid diff: multiple removals from non-set at {}",
             path_to_string(path)
-        ));
+        ))
+        .at(path);
     }
     PatchError::new(format!(
         "invalid diff: multiple additions to a non-set at {}",
         path_to_string(path)
     ))
+    .at(path)
 }
 
 fn expect_value_error(expected: &Node, found: &Node, path: &[PathSegment]) -> PatchError {
@@ -444,20 +1054,41 @@ fn expect_value_error(expected: &Node, found: &Node, path: &[PathSegment]) -> Pa
         path_to_string(path),
         node_json(expected)
     ))
+    .at(path)
+    .expecting(expected)
+    .finding(found)
 }
 
-fn expected_collection_error(node: &Node, segment: &PathSegment) -> PatchError {
+fn expected_collection_error(
+    node: &Node,
+    path: &[PathSegment],
+    segment: &PathSegment,
+) -> PatchError {
     let expected = match segment {
         PathSegment::Key(_) => "JSON object",
-        PathSegment::Index(_) => "JSON array",
+        PathSegment::Index(_)
+        | PathSegment::Set
+        | PathSegment::MultiSet
+        | PathSegment::SetKeys(_) => "JSON array",
     };
     PatchError::new(format!("found {} at {segment}: expected {expected}", node_json(node)))
+        .at(path)
+        .finding(node)
+}
+
+/// Go reports a path running past a scalar by the next path element alone,
+/// with no "found" value.
+fn scalar_path_error(path: &[PathSegment], segment: &PathSegment) -> PatchError {
+    PatchError::new(format!("invalid path element {segment}")).at(path)
 }
 
 fn invalid_path_element_error(segment: &PathSegment) -> PatchError {
     let type_name = match segment {
         PathSegment::Key(_) => "string",
         PathSegment::Index(_) => "float64",
+        PathSegment::Set => "set",
+        PathSegment::MultiSet => "multiset",
+        PathSegment::SetKeys(_) => "set keys",
     };
     PatchError::new(format!("invalid path element {type_name}: expected float64"))
 }
@@ -470,16 +1101,30 @@ fn is_void(node: &Node) -> bool {
     matches!(node, Node::Void)
 }
 
-fn node_equals(lhs: &Node, rhs: &Node) -> bool {
-    lhs == rhs
+fn element_path(list: &[PathSegment], index: usize) -> Vec<PathSegment> {
+    index_path(list, index as i64)
+}
+
+/// Like [`element_path`], for indices read from a diff, which may be negative.
+fn index_path(list: &[PathSegment], index: i64) -> Vec<PathSegment> {
+    let mut path = list.to_vec();
+    path.push(PathSegment::Index(index));
+    path
+}
+
+fn node_equals(lhs: &Node, rhs: &Node, path: &[PathSegment], compare: &DiffOptions) -> bool {
+    lhs.eq_with_options(rhs, &compare.located_at(path))
 }
 
 fn node_json(node: &Node) -> String {
     match node {
         Node::Void => String::new(),
         Node::Number(number) => {
+            if let Some(literal) = number.literal() {
+                return literal.to_string();
+            }
             let value = number.get();
-            if value.fract() == 0.0 {
+            if is_integral(value) {
                 format!("{value:.0}")
             } else {
                 serde_json::Number::from_f64(value).map(|n| n.to_string()).unwrap_or_default()
@@ -500,6 +1145,220 @@ fn path_to_string(path: &[PathSegment]) -> String {
 mod tests {
     use super::*;
 
+    #[test]
+    fn set_patch_removes_and_adds_members() {
+        let base = Node::from_json_str("{\"tags\":[\"alpha\",\"beta\"]}").unwrap();
+        let target = Node::from_json_str("{\"tags\":[\"delta\",\"beta\"]}").unwrap();
+        let options = set_options();
+        let diff = base.diff(&target, &options);
+        let patched = base.apply_patch(&diff).unwrap();
+        assert!(patched.eq_with_options(&target, &options));
+    }
+
+    #[test]
+    fn set_patch_requires_removed_member() {
+        let base = Node::from_json_str("[1,2]").unwrap();
+        let diff = base.diff(&Node::from_json_str("[2]").unwrap(), &set_options());
+        let err = Node::from_json_str("[2,3]").unwrap().apply_patch(&diff).unwrap_err();
+        assert_eq!(err.to_string(), "invalid diff: expected 1 at [] but found nothing");
+    }
+
+    #[test]
+    fn multiset_patch_tracks_duplicate_counts() {
+        let base = Node::from_json_str("[\"widget\",\"widget\",\"gadget\"]").unwrap();
+        let target = Node::from_json_str("[\"gadget\",\"widget\",\"gizmo\"]").unwrap();
+        let options = multiset_options();
+        let diff = base.diff(&target, &options);
+        let patched = base.apply_patch(&diff).unwrap();
+        assert!(patched.eq_with_options(&target, &options));
+        assert!(!patched.eq_with_options(&base, &options));
+    }
+
+    #[test]
+    fn multiset_patch_rejects_missing_copy() {
+        let base = Node::from_json_str("[1,1]").unwrap();
+        let diff = base.diff(&Node::from_json_str("[]").unwrap(), &multiset_options());
+        let err = Node::from_json_str("[1]").unwrap().apply_patch(&diff).unwrap_err();
+        assert_eq!(err.to_string(), "invalid diff: expected 1 at [] but found nothing");
+    }
+
+    #[test]
+    fn set_keys_patch_updates_matching_member() {
+        let base = Node::from_json_str(
+            "{\"users\":[{\"id\":1,\"role\":\"user\"},{\"id\":2,\"role\":\"admin\"}]}",
+        )
+        .unwrap();
+        let target = Node::from_json_str(
+            "{\"users\":[{\"id\":2,\"role\":\"admin\"},{\"id\":1,\"role\":\"admin\"}]}",
+        )
+        .unwrap();
+        let options = DiffOptions::default().with_set_keys(["id"]).unwrap();
+        let diff = base.diff(&target, &options);
+        let patched = base.apply_patch(&diff).unwrap();
+        assert!(patched.eq_with_options(&target, &options));
+    }
+
+    #[test]
+    fn set_keys_patch_requires_matching_member() {
+        let base = Node::from_json_str("[{\"id\":1,\"role\":\"user\"}]").unwrap();
+        let target = Node::from_json_str("[{\"id\":1,\"role\":\"admin\"}]").unwrap();
+        let options = DiffOptions::default().with_set_keys(["id"]).unwrap();
+        let diff = base.diff(&target, &options);
+        let err = Node::from_json_str("[{\"id\":2}]").unwrap().apply_patch(&diff).unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "invalid diff: expected object with id {\"id\":1} but found none"
+        );
+    }
+
+    #[test]
+    fn precision_relaxes_list_context_checks() {
+        let base = Node::from_json_str("[1.0,2.0,3.0]").unwrap();
+        let diff =
+            base.diff(&Node::from_json_str("[1.0,4.0,3.0]").unwrap(), &DiffOptions::default());
+        let drifted = Node::from_json_str("[1.01,2.01,2.99]").unwrap();
+        assert!(drifted.apply_patch(&diff).is_err());
+        let options = DiffOptions::default().with_precision(0.05).unwrap();
+        let patched = drifted.apply_patch_with_options(&diff, &options).unwrap();
+        assert_eq!(patched, Node::from_json_str("[1.01,4.0,2.99]").unwrap());
+    }
+
+    #[test]
+    fn precision_metadata_overrides_patch_options() {
+        let diff = Diff::from_elements(vec![crate::diff::DiffElement::new()
+            .with_metadata(DiffMetadata::precision(0.1))
+            .with_path(PathSegment::key("a"))
+            .with_remove(vec![Node::from_json_str("1").unwrap()])
+            .with_add(vec![Node::from_json_str("2").unwrap()])]);
+        let patched = Node::from_json_str("{\"a\":1.05}").unwrap().apply_patch(&diff).unwrap();
+        assert_eq!(patched, Node::from_json_str("{\"a\":2}").unwrap());
+    }
+
+    #[test]
+    fn option_headers_shape_value_checks() {
+        let diff = Diff::from_native_str("^ \"SET\"\n@ [\"a\"]\n- [1,2]\n+ 3\n").unwrap();
+        let patched = Node::from_json_str("{\"a\":[2,1]}").unwrap().apply_patch(&diff).unwrap();
+        assert_eq!(patched, Node::from_json_str("{\"a\":3}").unwrap());
+
+        let scoped = Diff::from_native_str(
+            "^ {\"@\":[\"a\"],\"^\":[\"SET\"]}\n@ [\"a\"]\n- [1,2]\n+ 3\n@ [\"b\"]\n- [1,2]\n+ 3\n",
+        )
+        .unwrap();
+        let err = Node::from_json_str("{\"a\":[2,1],\"b\":[2,1]}")
+            .unwrap()
+            .apply_patch(&scoped)
+            .unwrap_err();
+        assert_eq!(err.to_string(), "wanted [1,2]. found [2,1]");
+    }
+
+    #[test]
+    fn precision_finds_set_members_within_tolerance() {
+        let patched = patch_set(
+            vec![Node::from_json_str("1.0").unwrap(), Node::from_json_str("2.0").unwrap()],
+            Vec::new(),
+            &[],
+            &[Node::from_json_str("1.01").unwrap()],
+            &[],
+            &compare_options(0.05),
+        )
+        .unwrap();
+        assert_eq!(patched, Node::from_json_str("[2]").unwrap());
+    }
+
+    fn with_strictness(strictness: PatchStrictness) -> DiffOptions {
+        DiffOptions::default().with_patch_strictness(strictness)
+    }
+
+    #[test]
+    fn lenient_patches_ignore_removed_values_and_context() {
+        let diff = Diff::from_native_str(concat!(
+            "@ [\"a\"]\n- 1\n+ 2\n",
+            "@ [\"gone\"]\n- true\n",
+            "@ [\"list\",1]\n  \"x\"\n- \"y\"\n+ \"z\"\n  \"w\"\n",
+            "@ [\"tags\",{}]\n- \"old\"\n+ \"new\"\n",
+        ))
+        .unwrap();
+        let drifted = Node::from_json_str(r#"{"a":5,"list":["p","q","r"],"tags":[]}"#).unwrap();
+        assert!(drifted.apply_patch(&diff).is_err());
+        let patched = drifted
+            .apply_patch_with_options(&diff, &with_strictness(PatchStrictness::Lenient))
+            .unwrap();
+        assert_eq!(
+            patched,
+            Node::from_json_str(r#"{"a":2,"list":["p","z","r"],"tags":["new"]}"#).unwrap()
+        );
+
+        let append = Diff::from_native_str("@ [5]\n+ 4\n").unwrap();
+        let patched = Node::from_json_str("[1,2,3]")
+            .unwrap()
+            .apply_patch_with_options(&append, &with_strictness(PatchStrictness::Lenient))
+            .unwrap();
+        assert_eq!(patched, Node::from_json_str("[1,2,3,4]").unwrap());
+    }
+
+    #[test]
+    fn lenient_patches_still_need_their_containers() {
+        let diff = Diff::from_native_str("@ [\"spec\",\"replicas\"]\n+ 2\n").unwrap();
+        let base = Node::from_json_str("{}").unwrap();
+        let lenient = with_strictness(PatchStrictness::Lenient);
+        assert!(base.apply_patch_with_options(&diff, &lenient).is_err());
+        let forced = with_strictness(PatchStrictness::Force);
+        let patched = base.apply_patch_with_options(&diff, &forced).unwrap();
+        assert_eq!(patched, Node::from_json_str(r#"{"spec":{"replicas":2}}"#).unwrap());
+    }
+
+    #[test]
+    fn forced_patches_create_lists_and_keyed_members() {
+        let diff = Diff::from_native_str(concat!(
+            "@ [\"args\",0]\n[\n+ \"-v\"\n]\n",
+            "@ [\"containers\",{\"name\":\"app\"},\"image\"]\n+ \"nginx\"\n",
+        ))
+        .unwrap();
+        let patched = Node::from_json_str(r#"{"containers":[]}"#)
+            .unwrap()
+            .apply_patch_with_options(&diff, &with_strictness(PatchStrictness::Force))
+            .unwrap();
+        assert_eq!(
+            patched,
+            Node::from_json_str(r#"{"args":["-v"],"containers":[{"image":"nginx","name":"app"}]}"#)
+                .unwrap()
+        );
+    }
+
+    #[test]
+    fn conflicts_record_hunk_path_and_values() {
+        let json = |text: &str| Node::from_json_str(text).unwrap();
+        let diff = Diff::from_native_str(concat!(
+            "@ [\"name\"]\n- \"api\"\n+ \"web\"\n",
+            "@ [\"tags\",{}]\n- \"beta\"\n",
+        ))
+        .unwrap();
+        let err = json(r#"{"name":"api","tags":["alpha"]}"#).apply_patch(&diff).unwrap_err();
+        assert_eq!(err.hunk(), Some(1));
+        assert_eq!(err.path(), Some(&Path::from(vec![PathSegment::key("tags"), PathSegment::Set])));
+        assert_eq!(err.expected(), Some(&json("\"beta\"")));
+        assert_eq!(err.actual(), Some(&Node::Void));
+        assert_eq!(
+            serde_json::to_value(&err).unwrap(),
+            serde_json::json!({
+                "message": "invalid diff: expected \"beta\" at [tags] but found nothing",
+                "hunk": 1,
+                "path": ["tags", {}],
+                "expected": "beta",
+            })
+        );
+
+        let err = json(r#"{"a":[1]}"#)
+            .apply_json_patch(
+                r#"[{"op":"add","path":"/b","value":1},{"op":"test","path":"/a/0","value":2}]"#,
+            )
+            .unwrap_err();
+        assert_eq!(
+            (err.hunk(), err.expected(), err.actual()),
+            (Some(1), Some(&json("2")), Some(&json("1")))
+        );
+    }
+
     #[test]
     fn node_json_void() {
         assert_eq!(node_json(&Node::Void), "");
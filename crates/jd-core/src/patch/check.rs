@@ -0,0 +1,287 @@
+//! Dry runs of jd diffs: which hunks would apply, and why the others fail.
+
+use core::fmt::Write as _;
+
+use super::PatchError;
+use crate::diff::{path_to_json, COLOR_RESET};
+use crate::prelude::*;
+use crate::{Diff, DiffOptions, Node, Path, RenderConfig};
+
+/// Whether one hunk of a diff applies to a document.
+///
+/// ```
+/// # use jd_core::{Diff, Node};
+/// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n+ 2\n").unwrap();
+/// let check = diff.check(&Node::from_json_str(r#"{"a":3}"#).unwrap());
+/// let hunk = &check.hunks()[0];
+/// assert_eq!(hunk.index, 0);
+/// assert!(!hunk.is_clean());
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub struct HunkCheck {
+    /// Position of the hunk in the diff, counting from zero.
+    pub index: usize,
+    /// Path from the hunk header.
+    pub path: Path,
+    /// Why the hunk does not apply, or `None` when it does.
+    pub error: Option<PatchError>,
+    /// How many positions away from its list index the hunk applies, with
+    /// [`DiffOptions::with_patch_fuzz`]; zero when it applies in place or
+    /// not at all.
+    pub offset: i64,
+    /// The list context checks the hunk failed but applied regardless,
+    /// under [`ContextMismatch::Warn`](crate::ContextMismatch::Warn).
+    pub warnings: Vec<PatchError>,
+}
+
+impl HunkCheck {
+    /// Reports whether the hunk applies.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n+ 1\n").unwrap();
+    /// assert!(diff.check(&Node::from_json_str("{}").unwrap()).hunks()[0].is_clean());
+    /// ```
+    #[must_use]
+    pub fn is_clean(&self) -> bool {
+        self.error.is_none()
+    }
+}
+
+/// The outcome of checking a diff against a document: one [`HunkCheck`] per
+/// hunk, in diff order.
+///
+/// ```
+/// # use jd_core::{Diff, Node, RenderConfig};
+/// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n+ 2\n@ [\"b\"]\n+ 3\n").unwrap();
+/// let check = diff.check(&Node::from_json_str(r#"{"a":0}"#).unwrap());
+/// assert_eq!(
+///     check.render(&RenderConfig::default()),
+///     "conflict @ [\"a\"]: found 0 at [a]: expected 1\n\
+///      ok @ [\"b\"]\n\
+///      2 hunks checked, 1 conflict\n"
+/// );
+/// ```
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct PatchCheck {
+    hunks: Vec<HunkCheck>,
+}
+
+impl Diff {
+    /// Checks that every hunk of the diff applies to `node` without producing
+    /// the patched document, as [`Node::apply_patch`] would apply them.
+    ///
+    /// Hunks are checked in order against the document patched by the hunks
+    /// before them. A hunk that does not apply is left out, so a conflict in
+    /// a list can make later hunks in the same list conflict too.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node};
+    /// let lhs = Node::from_json_str(r#"{"a":1,"b":[1,2]}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"a":2,"b":[1,3]}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default());
+    /// assert!(diff.check(&lhs).is_clean());
+    /// let drifted = Node::from_json_str(r#"{"a":5,"b":[1,2]}"#).unwrap();
+    /// let check = diff.check(&drifted);
+    /// assert_eq!(check.conflicts().count(), 1);
+    /// ```
+    #[must_use]
+    pub fn check(&self, node: &Node) -> PatchCheck {
+        self.check_with_options(node, &DiffOptions::default())
+    }
+
+    /// Checks the diff like [`Diff::check`], comparing values with the
+    /// numeric precision and comparators of `options`, as
+    /// [`Node::apply_patch_with_options`] would.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, DiffOptions, Node};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n+ 2\n").unwrap();
+    /// let drifted = Node::from_json_str(r#"{"a":1.001}"#).unwrap();
+    /// assert!(!diff.check(&drifted).is_clean());
+    /// let options = DiffOptions::default().with_precision(0.01).unwrap();
+    /// assert!(diff.check_with_options(&drifted, &options).is_clean());
+    /// ```
+    #[must_use]
+    pub fn check_with_options(&self, node: &Node, options: &DiffOptions) -> PatchCheck {
+        let partial = node.apply_patch_partial(self, options);
+        let mut rejected = partial.rejected.into_iter().peekable();
+        let mut offsets = partial.offsets.into_iter().peekable();
+        let mut warnings = partial.warnings.into_iter().peekable();
+        let hunks = self
+            .iter()
+            .enumerate()
+            .map(|(index, element)| HunkCheck {
+                index,
+                path: element.path.clone(),
+                error: rejected.next_if(|hunk| hunk.index == index).map(|hunk| hunk.error),
+                offset: offsets.next_if(|offset| offset.index == index).map_or(0, |o| o.offset),
+                warnings: core::iter::from_fn(|| {
+                    warnings.next_if(|warning| warning.hunk() == Some(index))
+                })
+                .collect(),
+            })
+            .collect();
+        PatchCheck { hunks }
+    }
+}
+
+impl PatchCheck {
+    /// Returns the outcome of every hunk, in diff order.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node};
+    /// assert!(Diff::default().check(&Node::Null).hunks().is_empty());
+    /// ```
+    #[must_use]
+    pub fn hunks(&self) -> &[HunkCheck] {
+        &self.hunks
+    }
+
+    /// Returns the hunks that do not apply.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n").unwrap();
+    /// let check = diff.check(&Node::from_json_str("{}").unwrap());
+    /// assert_eq!(check.conflicts().map(|hunk| hunk.index).collect::<Vec<_>>(), [0]);
+    /// ```
+    pub fn conflicts(&self) -> impl Iterator<Item = &HunkCheck> {
+        self.hunks.iter().filter(|hunk| !hunk.is_clean())
+    }
+
+    /// Reports whether every hunk applies. An empty diff is clean.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node};
+    /// assert!(Diff::default().check(&Node::Null).is_clean());
+    /// ```
+    #[must_use]
+    pub fn is_clean(&self) -> bool {
+        self.hunks.iter().all(HunkCheck::is_clean)
+    }
+
+    /// Renders one line per hunk, `ok` or `conflict` followed by the hunk
+    /// path and, for conflicts, the reason, then a totals line. Hunks that
+    /// apply away from their list index show the offset, and each context
+    /// mismatch a hunk applied despite follows it on a `warning` line.
+    /// Conflicts are colored as removals. A check of an empty diff renders as an empty
+    /// string.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Node, RenderConfig};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n+ 1\n").unwrap();
+    /// let check = diff.check(&Node::from_json_str("{}").unwrap());
+    /// assert_eq!(check.render(&RenderConfig::default()), "ok @ [\"a\"]\n1 hunk checked\n");
+    /// ```
+    #[must_use]
+    pub fn render(&self, config: &RenderConfig) -> String {
+        if self.hunks.is_empty() {
+            return String::new();
+        }
+        let mut output = String::new();
+        for hunk in &self.hunks {
+            let path = path_to_json(&hunk.path);
+            match &hunk.error {
+                None if hunk.offset != 0 => {
+                    let _ = writeln!(output, "ok @ {path} (offset {:+})", hunk.offset);
+                }
+                None => {
+                    let _ = writeln!(output, "ok @ {path}");
+                }
+                Some(error) => {
+                    let color = config.color_enabled().then(|| config.theme().removed());
+                    output.push_str(color.unwrap_or_default());
+                    let _ = write!(output, "conflict @ {path}: {error}");
+                    if color.is_some() {
+                        output.push_str(COLOR_RESET);
+                    }
+                    output.push('\n');
+                }
+            }
+            for warning in &hunk.warnings {
+                let _ = writeln!(output, "warning @ {path}: {warning}");
+            }
+        }
+
+        let count =
+            |n: usize, one: &str, many: &str| format!("{n} {}", if n == 1 { one } else { many });
+        let _ = write!(output, "{} checked", count(self.hunks.len(), "hunk", "hunks"));
+        let conflicts = self.conflicts().count();
+        if conflicts > 0 {
+            let _ = write!(output, ", {}", count(conflicts, "conflict", "conflicts"));
+        }
+        let warnings = self.hunks.iter().map(|hunk| hunk.warnings.len()).sum();
+        if warnings > 0 {
+            let _ = write!(output, ", {}", count(warnings, "warning", "warnings"));
+        }
+        output.push('\n');
+        output
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{DiffElement, PathSegment};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    #[test]
+    fn clean_check_matches_apply() {
+        let lhs = json(r#"{"a":[1,2,3],"b":{"c":true}}"#);
+        let rhs = json(r#"{"a":[1,3,4],"b":{"c":false,"d":1}}"#);
+        let diff = lhs.diff(&rhs, &DiffOptions::default());
+        let check = diff.check(&lhs);
+        assert!(check.is_clean());
+        assert_eq!(check.hunks().len(), diff.len());
+        assert!(lhs.apply_patch(&diff).is_ok());
+    }
+
+    #[test]
+    fn conflicting_hunks_are_skipped_and_checking_continues() {
+        let diff = Diff::from_elements(vec![
+            DiffElement::new().with_path(PathSegment::key("a")).with_remove(vec![json("1")]),
+            DiffElement::new().with_path(PathSegment::key("a")).with_add(vec![json("2")]),
+            DiffElement::new().with_path(PathSegment::key("b")).with_add(vec![json("3")]),
+        ]);
+        let check = diff.check(&json(r#"{"a":0,"b":1}"#));
+        let clean: Vec<_> = check.hunks().iter().map(HunkCheck::is_clean).collect();
+        // The first hunk is skipped, so the second finds `a` still present.
+        assert_eq!(clean, [false, false, false]);
+        assert_eq!(
+            check.conflicts().next().unwrap().error.as_ref().unwrap().to_string(),
+            "found 0 at [a]: expected 1"
+        );
+
+        let check = diff.check(&json(r#"{"a":1}"#));
+        assert!(check.is_clean());
+    }
+
+    #[test]
+    fn context_warnings_follow_their_hunk() {
+        let diff = Diff::from_native_str("@ [1]\n  1\n- 2\n+ 3\n  4\n@ [\"b\"]\n+ 1\n").unwrap();
+        let drifted = json("[0,2,5]");
+        let warn = DiffOptions::default().with_context_mismatch(crate::ContextMismatch::Warn);
+        let check = diff.check_with_options(&drifted, &warn);
+        assert_eq!(check.hunks()[0].warnings.len(), 2);
+        assert_eq!(
+            check.render(&RenderConfig::default()),
+            "ok @ [1]\n\
+             warning @ [1]: invalid patch. expected 1 before. got 0\n\
+             warning @ [1]: invalid patch. expected 4 after. got 5\n\
+             conflict @ [\"b\"]: invalid path element string: expected float64\n\
+             2 hunks checked, 1 conflict, 2 warnings\n"
+        );
+    }
+
+    #[test]
+    fn merge_metadata_carries_across_hunks() {
+        let diff =
+            Diff::from_native_str("^ {\"Merge\":true}\n@ [\"a\",\"b\"]\n+ 1\n@ [\"c\"]\n+ 2\n")
+                .unwrap();
+        assert!(diff.check(&json("{}")).is_clean());
+    }
+}
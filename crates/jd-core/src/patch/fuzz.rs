@@ -0,0 +1,234 @@
+//! Offset search for list hunks whose index has drifted.
+//!
+//! A list hunk names one position, but its `before` and `after` context and
+//! removed values identify the spot on their own. When they do not match at
+//! the named index, the hunk is retried at growing distances from it, up to
+//! [`DiffOptions::patch_fuzz`], and applied at the first position where
+//! everything matches. When context mismatches are tolerated, a hunk that
+//! matches nowhere applies at its index after all, letting its context
+//! mismatch through.
+
+use super::{apply_element, inherit_metadata, PatchError};
+use crate::prelude::*;
+use crate::{
+    ContextMismatch, Diff, DiffElement, DiffMetadata, DiffOptions, Node, Path, PathSegment,
+};
+
+/// A list hunk that applied away from the index its path names.
+///
+/// ```
+/// # use jd_core::{Diff, DiffOptions, Node};
+/// let diff = Diff::from_native_str("@ [1]\n  \"a\"\n- \"b\"\n+ \"B\"\n  \"c\"\n").unwrap();
+/// let drifted = Node::from_json_str(r#"["x","a","b","c"]"#).unwrap();
+/// let options = DiffOptions::default().with_patch_fuzz(1);
+/// let patched = drifted.apply_patch_fuzzy(&diff, &options).unwrap();
+/// let offset = &patched.offsets[0];
+/// assert_eq!((offset.index, offset.offset), (0, 1));
+/// ```
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub struct HunkOffset {
+    /// Position of the hunk in the diff, counting from zero.
+    pub index: usize,
+    /// Path from the hunk header.
+    pub path: Path,
+    /// How many positions after (or, when negative, before) its index the
+    /// hunk applied.
+    pub offset: i64,
+}
+
+/// A patched document, the list hunks that needed an offset to apply, and
+/// the context mismatches let through.
+///
+/// ```
+/// # use jd_core::{DiffOptions, Node};
+/// let lhs = Node::from_json_str("[1,2,3]").unwrap();
+/// let diff = lhs.diff(&Node::from_json_str("[1,3]").unwrap(), &DiffOptions::default());
+/// let patched = lhs.apply_patch_fuzzy(&diff, &DiffOptions::default()).unwrap();
+/// assert_eq!(patched.node, Node::from_json_str("[1,3]").unwrap());
+/// assert!(patched.offsets.is_empty());
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub struct FuzzyPatch {
+    /// The patched document.
+    pub node: Node,
+    /// The hunks applied away from their index, in diff order.
+    pub offsets: Vec<HunkOffset>,
+    /// The list context checks that failed under
+    /// [`ContextMismatch::Warn`], in diff order, each naming its hunk.
+    pub warnings: Vec<PatchError>,
+}
+
+pub(super) fn apply(
+    node: &Node,
+    diff: &Diff,
+    options: &DiffOptions,
+) -> Result<FuzzyPatch, PatchError> {
+    let tracker = options.patch_tracker();
+    let mut current = node.clone();
+    let mut offsets = Vec::new();
+    let mut warnings = Vec::new();
+    let mut inherited: Option<DiffMetadata> = None;
+    for (index, element) in diff.iter().enumerate() {
+        inherit_metadata(&mut inherited, element);
+        let applied = apply_hunk(current, element, inherited.as_ref(), options);
+        if let Some(tracker) = &tracker {
+            tracker.applied();
+            if applied.is_err() {
+                tracker.finish();
+            }
+        }
+        let (patched, offset, mismatches) = applied.map_err(|error| error.in_hunk(index))?;
+        current = patched;
+        if offset != 0 {
+            offsets.push(HunkOffset { index, path: element.path.clone(), offset });
+        }
+        warnings.extend(mismatches.into_iter().map(|warning| warning.in_hunk(index)));
+    }
+    if let Some(tracker) = &tracker {
+        tracker.finish();
+    }
+    Ok(FuzzyPatch { node: current, offsets, warnings })
+}
+
+/// Applies one hunk, searching for its list position when it does not apply
+/// at its index. Returns the patched node with the offset used and the
+/// context mismatches let through, or the error from the hunk's own index
+/// when no position within reach matches.
+pub(super) fn apply_hunk(
+    current: Node,
+    element: &DiffElement,
+    inherited: Option<&DiffMetadata>,
+    options: &DiffOptions,
+) -> Result<(Node, i64, Vec<PatchError>), PatchError> {
+    if options.context_mismatch() == ContextMismatch::Error {
+        return search(current, element, inherited, options)
+            .map(|(node, offset)| (node, offset, Vec::new()));
+    }
+    // Prefer a position where the context matches.
+    let exact = options.clone().with_context_mismatch(ContextMismatch::Error);
+    if let Ok((node, offset)) = search(current.clone(), element, inherited, &exact) {
+        return Ok((node, offset, Vec::new()));
+    }
+    let (node, warnings) = apply_element(current, element, inherited, options)?;
+    Ok((node, 0, warnings))
+}
+
+/// Applies one hunk at its index or, failing that, at the nearest offset
+/// within [`DiffOptions::patch_fuzz`] where it matches.
+fn search(
+    current: Node,
+    element: &DiffElement,
+    inherited: Option<&DiffMetadata>,
+    options: &DiffOptions,
+) -> Result<(Node, i64), PatchError> {
+    let max_offset = i64::try_from(options.patch_fuzz()).unwrap_or(i64::MAX);
+    let Some((PathSegment::Index(index), list)) = element.path.segments().split_last() else {
+        return apply_element(current, element, inherited, options).map(|(node, _)| (node, 0));
+    };
+    // Without context or removed values, every position would match.
+    let anchored =
+        !(element.before.is_empty() && element.remove.is_empty() && element.after.is_empty());
+    if max_offset == 0 || *index < 0 || element.moved_from.is_some() || !anchored {
+        return apply_element(current, element, inherited, options).map(|(node, _)| (node, 0));
+    }
+
+    let error = match apply_element(current.clone(), element, inherited, options) {
+        Ok((patched, _)) => return Ok((patched, 0)),
+        Err(error) => error,
+    };
+    for distance in 1..=max_offset {
+        for offset in [distance, -distance] {
+            let Some(at) = index.checked_add(offset).filter(|at| *at >= 0) else {
+                continue;
+            };
+            let mut segments = list.to_vec();
+            segments.push(PathSegment::Index(at));
+            let shifted = DiffElement { path: Path::from(segments), ..element.clone() };
+            if let Ok((patched, _)) = apply_element(current.clone(), &shifted, inherited, options) {
+                return Ok((patched, offset));
+            }
+        }
+    }
+    Err(error)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn fuzzy(max_offset: usize) -> DiffOptions {
+        DiffOptions::default().with_patch_fuzz(max_offset)
+    }
+
+    #[test]
+    fn shifted_hunks_apply_within_reach() {
+        let lhs = json(r#"{"steps":["checkout","build","test","deploy"]}"#);
+        let rhs = json(r#"{"steps":["checkout","build","lint","test","deploy"]}"#);
+        let diff = lhs.diff(&rhs, &DiffOptions::default());
+        let drifted = json(r#"{"steps":["setup","cache","checkout","build","test","deploy"]}"#);
+
+        let err = drifted.apply_patch_fuzzy(&diff, &fuzzy(1)).unwrap_err();
+        assert_eq!(err, drifted.apply_patch(&diff).unwrap_err());
+
+        let patched = drifted.apply_patch_fuzzy(&diff, &fuzzy(2)).unwrap();
+        assert_eq!(
+            patched.node,
+            json(r#"{"steps":["setup","cache","checkout","build","lint","test","deploy"]}"#)
+        );
+        assert_eq!(
+            patched.offsets,
+            [HunkOffset { index: 0, path: diff.iter().next().unwrap().path.clone(), offset: 2 }]
+        );
+    }
+
+    #[test]
+    fn earlier_positions_are_searched_too() {
+        let diff = Diff::from_native_str("@ [3]\n  2\n- 3\n  4\n").unwrap();
+        let patched = json("[1,2,3,4]").apply_patch_fuzzy(&diff, &fuzzy(3)).unwrap();
+        assert_eq!(patched.node, json("[1,2,4]"));
+        assert_eq!(patched.offsets[0].offset, -1);
+    }
+
+    #[test]
+    fn tolerated_context_mismatches_prefer_a_matching_offset() {
+        let diff = Diff::from_native_str("@ [1]\n  \"a\"\n- \"b\"\n+ \"B\"\n  \"c\"\n").unwrap();
+        let warn = fuzzy(1).with_context_mismatch(ContextMismatch::Warn);
+
+        let shifted = json(r#"["x","a","b","c"]"#).apply_patch_fuzzy(&diff, &warn).unwrap();
+        assert_eq!(shifted.node, json(r#"["x","a","B","c"]"#));
+        assert_eq!(shifted.offsets[0].offset, 1);
+        assert!(shifted.warnings.is_empty());
+
+        let drifted = json(r#"["x","b","y"]"#);
+        let patched = drifted.apply_patch_fuzzy(&diff, &warn).unwrap();
+        assert_eq!(patched.node, json(r#"["x","B","y"]"#));
+        assert!(patched.offsets.is_empty());
+        let hunks: Vec<_> = patched.warnings.iter().map(PatchError::hunk).collect();
+        assert_eq!(hunks, [Some(0), Some(0)]);
+        assert_eq!(patched.warnings[1].expected(), Some(&json(r#""c""#)));
+
+        let ignore = DiffOptions::default().with_context_mismatch(ContextMismatch::Ignore);
+        let patched = drifted.apply_patch_fuzzy(&diff, &ignore).unwrap();
+        assert_eq!(patched.node, json(r#"["x","B","y"]"#));
+        assert!(patched.warnings.is_empty());
+    }
+
+    #[test]
+    fn removed_values_are_checked_under_any_context_mismatch() {
+        let diff = Diff::from_native_str("@ [1]\n  \"a\"\n- \"b\"\n+ \"B\"\n  \"c\"\n").unwrap();
+        let ignore = DiffOptions::default().with_context_mismatch(ContextMismatch::Ignore);
+        let err = json(r#"["a","z","c"]"#).apply_patch_fuzzy(&diff, &ignore).unwrap_err();
+        assert_eq!(err.to_string(), "invalid patch. wanted \"b\". found \"z\"");
+        assert_eq!(err.hunk(), Some(0));
+    }
+
+    #[test]
+    fn appends_and_unanchored_insertions_stay_put() {
+        let diff = Diff::from_native_str("@ [5]\n+ 9\n").unwrap();
+        assert!(json("[1,2]").apply_patch_fuzzy(&diff, &fuzzy(5)).is_err());
+    }
+}
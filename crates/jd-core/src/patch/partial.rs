@@ -0,0 +1,191 @@
+//! Partial application of jd diffs: apply what fits, reject the rest.
+//!
+//! Like `patch` writing a `.rej` file, a conflicting hunk is set aside with
+//! the error that rejected it and the remaining hunks still apply, so a
+//! reviewer can resolve the rejects by hand instead of redoing the whole
+//! patch.
+
+use super::fuzz::apply_hunk;
+use super::{inherit_metadata, HunkOffset, PatchError};
+use crate::prelude::*;
+use crate::{Diff, DiffElement, DiffMetadata, DiffOptions, Node};
+
+/// A hunk that did not apply during [`Node::apply_patch_partial`].
+///
+/// ```
+/// # use jd_core::{Diff, DiffOptions, Node};
+/// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n+ 2\n").unwrap();
+/// let base = Node::from_json_str(r#"{"a":3}"#).unwrap();
+/// let partial = base.apply_patch_partial(&diff, &DiffOptions::default());
+/// let rejected = &partial.rejected[0];
+/// assert_eq!(rejected.index, 0);
+/// assert_eq!(rejected.error.to_string(), "found 3 at [a]: expected 1");
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub struct RejectedHunk {
+    /// Position of the hunk in the diff, counting from zero.
+    pub index: usize,
+    /// The hunk, carrying the metadata it inherited from earlier hunks so
+    /// it applies on its own.
+    pub hunk: DiffElement,
+    /// Why the hunk did not apply.
+    pub error: PatchError,
+}
+
+/// A document patched with the hunks that applied, and the hunks that did
+/// not.
+///
+/// ```
+/// # use jd_core::{DiffOptions, Node, RenderConfig};
+/// let lhs = Node::from_json_str(r#"{"a":1,"b":1}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"a":2,"b":2}"#).unwrap();
+/// let diff = lhs.diff(&rhs, &DiffOptions::default());
+/// let drifted = Node::from_json_str(r#"{"a":5,"b":1}"#).unwrap();
+/// let partial = drifted.apply_patch_partial(&diff, &DiffOptions::default());
+/// assert_eq!(partial.node, Node::from_json_str(r#"{"a":5,"b":2}"#).unwrap());
+/// assert_eq!(partial.rejects().render(&RenderConfig::default()), "@ [\"a\"]\n- 1\n+ 2\n");
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub struct PartialPatch {
+    /// The document with every hunk that applied.
+    pub node: Node,
+    /// The hunks that applied away from their list index, in diff order.
+    pub offsets: Vec<HunkOffset>,
+    /// The list context checks that failed under
+    /// [`ContextMismatch::Warn`](crate::ContextMismatch::Warn) in hunks
+    /// that applied, in diff order.
+    pub warnings: Vec<PatchError>,
+    /// The hunks that did not apply, in diff order.
+    pub rejected: Vec<RejectedHunk>,
+}
+
+impl PartialPatch {
+    /// Reports whether every hunk applied.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, DiffOptions, Node};
+    /// let partial = Node::Null.apply_patch_partial(&Diff::default(), &DiffOptions::default());
+    /// assert!(partial.is_complete());
+    /// ```
+    #[must_use]
+    pub fn is_complete(&self) -> bool {
+        self.rejected.is_empty()
+    }
+
+    /// Returns the rejected hunks as a diff, the equivalent of a `.rej`
+    /// file, to render in any format or apply once resolved. List indices
+    /// count positions in the document as it was when each hunk was tried.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, DiffOptions, Node};
+    /// let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n@ [\"b\"]\n- 2\n").unwrap();
+    /// let base = Node::from_json_str(r#"{"a":1}"#).unwrap();
+    /// let partial = base.apply_patch_partial(&diff, &DiffOptions::default());
+    /// assert_eq!(partial.rejects().render_patch().unwrap(), r#"[{"op":"test","path":"/b","value":2},{"op":"remove","path":"/b","value":2}]"#);
+    /// ```
+    #[must_use]
+    pub fn rejects(&self) -> Diff {
+        let mut previous: Option<&DiffMetadata> = None;
+        let mut elements = Vec::with_capacity(self.rejected.len());
+        for rejected in &self.rejected {
+            let mut hunk = rejected.hunk.clone();
+            // Inherited metadata only needs restating when it changes.
+            if hunk.metadata.is_some() && hunk.metadata.as_ref() == previous {
+                hunk.metadata = None;
+            } else {
+                previous = rejected.hunk.metadata.as_ref();
+            }
+            elements.push(hunk);
+        }
+        Diff::from_elements(elements)
+    }
+}
+
+pub(super) fn apply(node: &Node, diff: &Diff, options: &DiffOptions) -> PartialPatch {
+    let tracker = options.patch_tracker();
+    let mut current = node.clone();
+    let mut offsets = Vec::new();
+    let mut warnings = Vec::new();
+    let mut rejected = Vec::new();
+    let mut inherited: Option<DiffMetadata> = None;
+    for (index, element) in diff.iter().enumerate() {
+        inherit_metadata(&mut inherited, element);
+        let applied = apply_hunk(current.clone(), element, inherited.as_ref(), options);
+        if let Some(tracker) = &tracker {
+            tracker.applied();
+        }
+        match applied {
+            Ok((patched, offset, mismatches)) => {
+                current = patched;
+                if offset != 0 {
+                    offsets.push(HunkOffset { index, path: element.path.clone(), offset });
+                }
+                warnings.extend(mismatches.into_iter().map(|warning| warning.in_hunk(index)));
+            }
+            Err(error) => {
+                let metadata = inherited.clone().or_else(|| element.metadata.clone());
+                let hunk = DiffElement { metadata, ..element.clone() };
+                rejected.push(RejectedHunk { index, hunk, error: error.in_hunk(index) });
+            }
+        }
+    }
+    if let Some(tracker) = &tracker {
+        tracker.finish();
+    }
+    PartialPatch { node: current, offsets, warnings, rejected }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{PathSegment, RenderConfig};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    #[test]
+    fn fitting_hunks_apply_around_rejects() {
+        let lhs = json(r#"{"name":"api","replicas":1,"ports":[80,443],"env":{"LOG":"info"}}"#);
+        let rhs = json(r#"{"name":"web","replicas":2,"ports":[80,8443],"env":{"LOG":"debug"}}"#);
+        let diff = lhs.diff(&rhs, &DiffOptions::default());
+        let drifted = json(r#"{"name":"api","replicas":3,"ports":[80,443],"env":{"LOG":"warn"}}"#);
+
+        let partial = drifted.apply_patch_partial(&diff, &DiffOptions::default());
+        assert_eq!(
+            partial.node,
+            json(r#"{"name":"web","replicas":3,"ports":[80,8443],"env":{"LOG":"warn"}}"#)
+        );
+        let indices: Vec<_> = partial.rejected.iter().map(|hunk| hunk.index).collect();
+        assert_eq!(indices, [0, 3]);
+        assert!(!partial.is_complete());
+        assert_eq!(
+            partial.rejects().render(&RenderConfig::default()),
+            "@ [\"env\",\"LOG\"]\n- \"info\"\n+ \"debug\"\n@ [\"replicas\"]\n- 1\n+ 2\n"
+        );
+    }
+
+    #[test]
+    fn rejects_keep_inherited_metadata_once() {
+        let hunk = |key: &str, from: &str, to: &str| {
+            DiffElement::new()
+                .with_path(PathSegment::key(key))
+                .with_remove(vec![json(from)])
+                .with_add(vec![json(to)])
+        };
+        let diff = Diff::from_elements(vec![
+            hunk("a", "1", "2").with_metadata(DiffMetadata::precision(0.1)),
+            hunk("b", "1", "2"),
+            hunk("c", "1", "2"),
+        ]);
+        let base = json(r#"{"a":1.05,"b":3,"c":3}"#);
+        let partial = base.apply_patch_partial(&diff, &DiffOptions::default());
+        assert_eq!(partial.node, json(r#"{"a":2,"b":3,"c":3}"#));
+
+        let rejects = partial.rejects();
+        let metadata: Vec<_> = rejects.iter().map(|hunk| hunk.metadata.clone()).collect();
+        assert_eq!(metadata, [Some(DiffMetadata::precision(0.1)), None]);
+        let resolved = json(r#"{"b":1.05,"c":0.95}"#).apply_patch(&rejects).unwrap();
+        assert_eq!(resolved, json(r#"{"b":2,"c":2}"#));
+    }
+}
@@ -0,0 +1,314 @@
+//! RFC 6902 JSON Patch application.
+//!
+//! Documents are parsed into typed operations and applied in order to a copy
+//! of the input node; the first failing operation aborts the whole patch.
+//! Test failures reuse the jd `found X at [path]: expected Y` wording so that
+//! errors read the same whether a patch arrives as a jd diff or as JSON Patch.
+
+use serde::Deserialize;
+use serde_json::Value as JsonValue;
+
+use super::{expect_value_error, node_json, PatchError};
+use crate::prelude::*;
+use crate::{Node, PathSegment};
+
+#[derive(Debug, Deserialize)]
+#[serde(tag = "op", rename_all = "lowercase")]
+enum Operation {
+    Add { path: String, value: JsonValue },
+    Remove { path: String },
+    Replace { path: String, value: JsonValue },
+    Move { from: String, path: String },
+    Copy { from: String, path: String },
+    Test { path: String, value: JsonValue },
+}
+
+pub(super) fn apply(node: &Node, patch: &str) -> Result<Node, PatchError> {
+    let operations: Vec<Operation> = serde_json::from_str(patch)
+        .map_err(|err| PatchError::new(format!("invalid JSON Patch: {err}")))?;
+    let mut current = node.clone();
+    for (index, operation) in operations.into_iter().enumerate() {
+        apply_operation(&mut current, operation).map_err(|error| error.in_hunk(index))?;
+    }
+    Ok(current)
+}
+
+fn apply_operation(root: &mut Node, operation: Operation) -> Result<(), PatchError> {
+    match operation {
+        Operation::Add { path, value } => {
+            let tokens = parse_pointer(&path)?;
+            add(root, &tokens, to_node(value)?, &path)
+        }
+        Operation::Remove { path } => {
+            let tokens = parse_pointer(&path)?;
+            remove(root, &tokens, &path).map(drop)
+        }
+        Operation::Replace { path, value } => {
+            let tokens = parse_pointer(&path)?;
+            *lookup_mut(root, &tokens, &path)? = to_node(value)?;
+            Ok(())
+        }
+        Operation::Move { from, path } => {
+            let from_tokens = parse_pointer(&from)?;
+            let tokens = parse_pointer(&path)?;
+            if tokens.len() > from_tokens.len() && tokens.starts_with(&from_tokens) {
+                return Err(PatchError::new(format!(
+                    "invalid patch. cannot move {from} into its own child {path}"
+                )));
+            }
+            let value = remove(root, &from_tokens, &from)?;
+            add(root, &tokens, value, &path)
+        }
+        Operation::Copy { from, path } => {
+            let from_tokens = parse_pointer(&from)?;
+            let tokens = parse_pointer(&path)?;
+            let value = lookup_mut(root, &from_tokens, &from)?.clone();
+            add(root, &tokens, value, &path)
+        }
+        Operation::Test { path, value } => {
+            let tokens = parse_pointer(&path)?;
+            let expected = to_node(value)?;
+            let jd_path = jd_path(root, &tokens);
+            let actual = lookup_mut(root, &tokens, &path)?;
+            if *actual != expected {
+                return Err(expect_value_error(&expected, actual, &jd_path));
+            }
+            Ok(())
+        }
+    }
+}
+
+fn add(root: &mut Node, tokens: &[String], value: Node, pointer: &str) -> Result<(), PatchError> {
+    let Some((last, parent_tokens)) = tokens.split_last() else {
+        *root = value;
+        return Ok(());
+    };
+    match lookup_mut(root, parent_tokens, pointer)? {
+        Node::Object(map) => {
+            map.insert(last.clone(), value);
+        }
+        Node::Array(values) => {
+            let index = array_index(last, values.len(), true, pointer)?;
+            values.insert(index, value);
+        }
+        other => return Err(not_a_container_error(other, pointer)),
+    }
+    Ok(())
+}
+
+fn remove(root: &mut Node, tokens: &[String], pointer: &str) -> Result<Node, PatchError> {
+    let Some((last, parent_tokens)) = tokens.split_last() else {
+        return Ok(core::mem::replace(root, Node::Void));
+    };
+    match lookup_mut(root, parent_tokens, pointer)? {
+        Node::Object(map) => map.remove(last).ok_or_else(|| missing_error(pointer)),
+        Node::Array(values) => {
+            let index = array_index(last, values.len(), false, pointer)?;
+            Ok(values.remove(index))
+        }
+        other => Err(not_a_container_error(other, pointer)),
+    }
+}
+
+fn lookup_mut<'a>(
+    root: &'a mut Node,
+    tokens: &[String],
+    pointer: &str,
+) -> Result<&'a mut Node, PatchError> {
+    let mut current = root;
+    for token in tokens {
+        current = match current {
+            Node::Object(map) => map.get_mut(token).ok_or_else(|| missing_error(pointer))?,
+            Node::Array(values) => {
+                let index = array_index(token, values.len(), false, pointer)?;
+                &mut values[index]
+            }
+            _ => return Err(missing_error(pointer)),
+        };
+    }
+    if matches!(current, Node::Void) {
+        return Err(missing_error(pointer));
+    }
+    Ok(current)
+}
+
+/// Translates pointer tokens into jd path segments for error messages.
+fn jd_path(root: &Node, tokens: &[String]) -> Vec<PathSegment> {
+    let mut segments = Vec::with_capacity(tokens.len());
+    let mut current = Some(root);
+    for token in tokens {
+        match current {
+            Some(Node::Array(values)) => {
+                let index = token.parse::<usize>().ok();
+                segments.push(PathSegment::Index(index.map_or(-1, |index| index as i64)));
+                current = index.and_then(|index| values.get(index));
+            }
+            Some(Node::Object(map)) => {
+                segments.push(PathSegment::Key(token.clone()));
+                current = map.get(token);
+            }
+            _ => {
+                segments.push(PathSegment::Key(token.clone()));
+                current = None;
+            }
+        }
+    }
+    segments
+}
+
+/// Splits a JSON Pointer (RFC 6901) into unescaped reference tokens.
+fn parse_pointer(pointer: &str) -> Result<Vec<String>, PatchError> {
+    if pointer.is_empty() {
+        return Ok(Vec::new());
+    }
+    let Some(rest) = pointer.strip_prefix('/') else {
+        return Err(invalid_pointer_error(pointer));
+    };
+    rest.split('/')
+        .map(|token| {
+            let mut unescaped = String::with_capacity(token.len());
+            let mut chars = token.chars();
+            while let Some(ch) = chars.next() {
+                if ch != '~' {
+                    unescaped.push(ch);
+                    continue;
+                }
+                match chars.next() {
+                    Some('0') => unescaped.push('~'),
+                    Some('1') => unescaped.push('/'),
+                    _ => return Err(invalid_pointer_error(pointer)),
+                }
+            }
+            Ok(unescaped)
+        })
+        .collect()
+}
+
+fn array_index(
+    token: &str,
+    len: usize,
+    allow_end: bool,
+    pointer: &str,
+) -> Result<usize, PatchError> {
+    if token == "-" && allow_end {
+        return Ok(len);
+    }
+    let well_formed = !token.is_empty()
+        && token.bytes().all(|byte| byte.is_ascii_digit())
+        && (token == "0" || !token.starts_with('0'));
+    let index = well_formed.then(|| token.parse::<usize>().ok()).flatten();
+    match index {
+        Some(index) if index < len || (allow_end && index == len) => Ok(index),
+        Some(_) => Err(PatchError::new(format!("patch index out of bounds: {token}"))),
+        None => Err(missing_error(pointer)),
+    }
+}
+
+fn to_node(value: JsonValue) -> Result<Node, PatchError> {
+    Node::from_json_value(value)
+        .map_err(|err| PatchError::new(format!("invalid JSON Patch: {err}")))
+}
+
+fn missing_error(pointer: &str) -> PatchError {
+    PatchError::new(format!("invalid patch. nothing found at {pointer}"))
+}
+
+fn invalid_pointer_error(pointer: &str) -> PatchError {
+    PatchError::new(format!("invalid JSON Pointer {pointer:?}"))
+}
+
+fn not_a_container_error(node: &Node, pointer: &str) -> PatchError {
+    PatchError::new(format!(
+        "found {} at parent of {pointer}: expected JSON object or array",
+        node_json(node)
+    ))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    fn patched(base: &str, patch: &str) -> Result<Node, PatchError> {
+        apply(&node(base), patch)
+    }
+
+    #[test]
+    fn add_inserts_into_objects_and_arrays() {
+        let result = patched(
+            r#"{"a":[1,3]}"#,
+            r#"[{"op":"add","path":"/a/1","value":2},{"op":"add","path":"/a/-","value":4},
+                {"op":"add","path":"/b","value":{}}]"#,
+        )
+        .unwrap();
+        assert_eq!(result, node(r#"{"a":[1,2,3,4],"b":{}}"#));
+    }
+
+    #[test]
+    fn remove_and_replace_require_existing_targets() {
+        let result = patched(
+            r#"{"a":1,"b":[1,2]}"#,
+            r#"[{"op":"remove","path":"/a"},{"op":"replace","path":"/b/0","value":"x"}]"#,
+        )
+        .unwrap();
+        assert_eq!(result, node(r#"{"b":["x",2]}"#));
+
+        let err = patched(r#"{"a":1}"#, r#"[{"op":"remove","path":"/b"}]"#).unwrap_err();
+        assert_eq!(err.to_string(), "invalid patch. nothing found at /b");
+        let err = patched(r#"[1]"#, r#"[{"op":"replace","path":"/1","value":2}]"#).unwrap_err();
+        assert_eq!(err.to_string(), "patch index out of bounds: 1");
+    }
+
+    #[test]
+    fn move_and_copy_relocate_values() {
+        let result = patched(
+            r#"{"a":{"b":1},"c":[]}"#,
+            r#"[{"op":"copy","from":"/a/b","path":"/c/0"},{"op":"move","from":"/a","path":"/d"}]"#,
+        )
+        .unwrap();
+        assert_eq!(result, node(r#"{"c":[1],"d":{"b":1}}"#));
+
+        let err =
+            patched(r#"{"a":{}}"#, r#"[{"op":"move","from":"/a","path":"/a/b"}]"#).unwrap_err();
+        assert_eq!(err.to_string(), "invalid patch. cannot move /a into its own child /a/b");
+    }
+
+    #[test]
+    fn test_failures_use_jd_wording() {
+        assert!(patched(r#"{"a":[1.0]}"#, r#"[{"op":"test","path":"/a/0","value":1}]"#).is_ok());
+        let err =
+            patched(r#"{"a":[1]}"#, r#"[{"op":"test","path":"/a/0","value":2}]"#).unwrap_err();
+        assert_eq!(err.to_string(), "found 1 at [a 0]: expected 2");
+    }
+
+    #[test]
+    fn pointers_unescape_reference_tokens() {
+        let result =
+            patched(r#"{"a/b":{"~":1}}"#, r#"[{"op":"remove","path":"/a~1b/~0"}]"#).unwrap();
+        assert_eq!(result, node(r#"{"a/b":{}}"#));
+        let err = patched("{}", r#"[{"op":"remove","path":"a"}]"#).unwrap_err();
+        assert_eq!(err.to_string(), "invalid JSON Pointer \"a\"");
+        let err = patched("[1]", r#"[{"op":"remove","path":"/01"}]"#).unwrap_err();
+        assert_eq!(err.to_string(), "invalid patch. nothing found at /01");
+    }
+
+    #[test]
+    fn whole_document_operations_target_the_root() {
+        assert_eq!(
+            patched("1", r#"[{"op":"replace","path":"","value":[2]}]"#).unwrap(),
+            node("[2]")
+        );
+        assert_eq!(patched("", r#"[{"op":"add","path":"","value":3}]"#).unwrap(), node("3"));
+    }
+
+    #[test]
+    fn rejects_malformed_documents() {
+        let err = patched("{}", r#"[{"op":"frobnicate","path":"/a"}]"#).unwrap_err();
+        assert!(err.to_string().starts_with("invalid JSON Patch: unknown variant `frobnicate`"));
+        let err = patched("{}", r#"{"op":"add"}"#).unwrap_err();
+        assert!(err.to_string().starts_with("invalid JSON Patch:"));
+    }
+}
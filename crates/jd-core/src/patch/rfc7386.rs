@@ -0,0 +1,119 @@
+//! RFC 7386 JSON Merge Patch application.
+//!
+//! Follows the RFC's `MergePatch` pseudo-code: object patches merge key by
+//! key, `null` members delete keys, and any other patch value (arrays
+//! included) replaces the target wholesale. [`Node::deep_merge_with`] reuses
+//! the same recursion and can keep `null` members as values instead.
+
+use alloc::collections::BTreeMap;
+
+use super::PatchError;
+use crate::prelude::*;
+use crate::Node;
+
+pub(super) fn apply(node: &Node, patch: &str) -> Result<Node, PatchError> {
+    let patch = Node::from_json_str(patch)
+        .map_err(|err| PatchError::new(format!("invalid JSON Merge Patch: {err}")))?;
+    if matches!(patch, Node::Void) {
+        return Err(PatchError::new("invalid JSON Merge Patch: empty document"));
+    }
+    Ok(merge(node.clone(), patch, NullMerge::Delete))
+}
+
+/// How [`Node::deep_merge_with`] treats `null` members of the merged-in
+/// object.
+///
+/// ```
+/// # use jd_core::{Node, NullMerge};
+/// let base = Node::from_json_str(r#"{"a":1}"#).unwrap();
+/// let other = Node::from_json_str(r#"{"a":null}"#).unwrap();
+/// assert_eq!(base.deep_merge_with(&other, NullMerge::Delete), Node::from_json_str("{}").unwrap());
+/// assert_eq!(base.deep_merge_with(&other, NullMerge::Assign), other);
+/// ```
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq)]
+pub enum NullMerge {
+    /// `null` deletes the key, as in RFC 7386.
+    #[default]
+    Delete,
+    /// `null` is stored like any other value.
+    Assign,
+}
+
+pub(crate) fn merge(target: Node, patch: Node, nulls: NullMerge) -> Node {
+    let Node::Object(members) = patch else {
+        return patch;
+    };
+    let mut result = match target {
+        Node::Object(map) => map,
+        _ => BTreeMap::new(),
+    };
+    for (key, value) in members {
+        if matches!(value, Node::Null) && nulls == NullMerge::Delete {
+            result.remove(&key);
+            continue;
+        }
+        let existing = result.remove(&key).unwrap_or(Node::Void);
+        result.insert(key, merge(existing, value, nulls));
+    }
+    Node::Object(result)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn patched(target: &str, patch: &str) -> Node {
+        apply(&Node::from_json_str(target).unwrap(), patch).unwrap()
+    }
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    #[test]
+    fn rfc_7386_appendix_a_examples() {
+        let cases = [
+            (r#"{"a":"b"}"#, r#"{"a":"c"}"#, r#"{"a":"c"}"#),
+            (r#"{"a":"b"}"#, r#"{"b":"c"}"#, r#"{"a":"b","b":"c"}"#),
+            (r#"{"a":"b"}"#, r#"{"a":null}"#, r#"{}"#),
+            (r#"{"a":"b","b":"c"}"#, r#"{"a":null}"#, r#"{"b":"c"}"#),
+            (r#"{"a":["b"]}"#, r#"{"a":"c"}"#, r#"{"a":"c"}"#),
+            (r#"{"a":"c"}"#, r#"{"a":["b"]}"#, r#"{"a":["b"]}"#),
+            (r#"{"a":{"b":"c"}}"#, r#"{"a":{"b":"d","c":null}}"#, r#"{"a":{"b":"d"}}"#),
+            (r#"{"a":[{"b":"c"}]}"#, r#"{"a":[1]}"#, r#"{"a":[1]}"#),
+            (r#"["a","b"]"#, r#"["c","d"]"#, r#"["c","d"]"#),
+            (r#"{"a":"b"}"#, r#"["c"]"#, r#"["c"]"#),
+            (r#"{"a":"foo"}"#, "null", "null"),
+            (r#"{"a":"foo"}"#, r#""bar""#, r#""bar""#),
+            (r#"{"e":null}"#, r#"{"a":1}"#, r#"{"e":null,"a":1}"#),
+            (r#"[1,2]"#, r#"{"a":"b","c":null}"#, r#"{"a":"b"}"#),
+            (r#"{}"#, r#"{"a":{"bb":{"ccc":null}}}"#, r#"{"a":{"bb":{}}}"#),
+        ];
+        for (target, patch, expected) in cases {
+            assert_eq!(patched(target, patch), node(expected), "{target} + {patch}");
+        }
+    }
+
+    #[test]
+    fn merges_into_empty_documents() {
+        assert_eq!(patched("", r#"{"a":{"b":null,"c":1}}"#), node(r#"{"a":{"c":1}}"#));
+    }
+
+    #[test]
+    fn assigned_nulls_are_kept_at_every_depth() {
+        let merged = merge(
+            node(r#"{"a":{"b":1,"c":2},"d":3}"#),
+            node(r#"{"a":{"b":null},"d":null,"e":null}"#),
+            NullMerge::Assign,
+        );
+        assert_eq!(merged, node(r#"{"a":{"b":null,"c":2},"d":null,"e":null}"#));
+    }
+
+    #[test]
+    fn rejects_invalid_documents() {
+        let err = apply(&node("{}"), "{").unwrap_err();
+        assert!(err.to_string().starts_with("invalid JSON Merge Patch:"));
+        let err = apply(&node("{}"), " ").unwrap_err();
+        assert_eq!(err.to_string(), "invalid JSON Merge Patch: empty document");
+    }
+}
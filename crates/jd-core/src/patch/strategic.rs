@@ -0,0 +1,436 @@
+//! Kubernetes strategic merge patch.
+//!
+//! A strategic merge patch is a JSON Merge Patch whose lists may merge
+//! instead of being replaced: lists with a `patchMergeKey` merge element by
+//! element on that key, and lists of scalars with `patchStrategy: merge`
+//! take the union. [`StrategicMerge`] records which lists do, located by
+//! JSONPath, since the real table lives in the Kubernetes Go types. The same
+//! table makes diffs pair list elements by their merge keys, through
+//! [`DiffOptions::with_strategic_merge`](crate::DiffOptions::with_strategic_merge).
+//!
+//! The `$patch` (`replace`, `delete`, `merge`), `$retainKeys`, and
+//! `$deleteFromPrimitiveList/<field>` directives are supported.
+//! `$setElementOrder/<field>` directives are accepted and ignored.
+
+use alloc::collections::BTreeMap;
+
+use super::PatchError;
+use crate::prelude::*;
+use crate::{JsonPath, Node, Path, PathSegment};
+
+/// Which lists merge, and on what key, under strategic merge patch.
+///
+/// ```
+/// # use jd_core::{JsonPath, Node, StrategicMerge};
+/// let merge = StrategicMerge::new()
+///     .with_merge_key(JsonPath::parse("$.items").unwrap(), "id");
+/// let base = Node::from_json_str(r#"{"items":[{"id":1,"n":1},{"id":2,"n":2}]}"#).unwrap();
+/// let patch = Node::from_json_str(r#"{"items":[{"id":2,"n":3}]}"#).unwrap();
+/// let patched = base.apply_strategic_merge_patch(&patch, &merge).unwrap();
+/// assert_eq!(patched, Node::from_json_str(r#"{"items":[{"id":1,"n":1},{"id":2,"n":3}]}"#).unwrap());
+/// ```
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct StrategicMerge {
+    rules: Vec<MergeRule>,
+}
+
+/// A list that merges, with the key its object elements merge on, or none
+/// for a list of scalars merged as a union.
+#[derive(Clone, Debug, PartialEq)]
+struct MergeRule {
+    list: JsonPath,
+    key: Option<String>,
+}
+
+/// Lists of the built-in Kubernetes types that merge by key, as declared
+/// by their `patchMergeKey` tags.
+const KUBERNETES_MERGE_KEYS: &[(&str, &str)] = &[
+    ("$..containers", "name"),
+    ("$..initContainers", "name"),
+    ("$..ephemeralContainers", "name"),
+    ("$..containers[*].ports", "containerPort"),
+    ("$..initContainers[*].ports", "containerPort"),
+    ("$..ephemeralContainers[*].ports", "containerPort"),
+    ("$..env", "name"),
+    ("$..volumeMounts", "mountPath"),
+    ("$..volumeDevices", "devicePath"),
+    ("$..volumes", "name"),
+    ("$..imagePullSecrets", "name"),
+    ("$..hostAliases", "ip"),
+    ("$..topologySpreadConstraints", "topologyKey"),
+    ("$..conditions", "type"),
+    ("$..ownerReferences", "uid"),
+    ("$.spec.ports", "port"),
+];
+
+/// Lists of scalars with `patchStrategy: merge`.
+const KUBERNETES_MERGE_LISTS: &[&str] = &["$.metadata.finalizers"];
+
+impl StrategicMerge {
+    /// Creates a table in which every list is replaced, as in RFC 7386.
+    ///
+    /// ```
+    /// # use jd_core::StrategicMerge;
+    /// assert!(StrategicMerge::new().is_empty());
+    /// ```
+    #[must_use]
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Returns the merge keys of common Kubernetes types: containers,
+    /// volumes, and environment variables merge by `name`, container ports
+    /// by `containerPort`, volume mounts by `mountPath`, Service ports by
+    /// `port`, and so on, while `metadata.finalizers` merges as a union.
+    ///
+    /// ```
+    /// # use jd_core::StrategicMerge;
+    /// assert!(!StrategicMerge::kubernetes().is_empty());
+    /// ```
+    #[must_use]
+    pub fn kubernetes() -> Self {
+        let parse = |expression: &str| {
+            JsonPath::parse(expression).expect("built-in merge key paths are valid")
+        };
+        let keyed = KUBERNETES_MERGE_KEYS
+            .iter()
+            .map(|(list, key)| MergeRule { list: parse(list), key: Some((*key).to_string()) });
+        let scalars =
+            KUBERNETES_MERGE_LISTS.iter().map(|list| MergeRule { list: parse(list), key: None });
+        Self { rules: keyed.chain(scalars).collect() }
+    }
+
+    /// Merges the object lists `list` selects element by element, pairing
+    /// elements whose `key` members are equal.
+    ///
+    /// ```
+    /// # use jd_core::{JsonPath, StrategicMerge};
+    /// let merge = StrategicMerge::new().with_merge_key(JsonPath::parse("$..rules").unwrap(), "host");
+    /// assert!(!merge.is_empty());
+    /// ```
+    #[must_use]
+    pub fn with_merge_key(mut self, list: JsonPath, key: impl Into<String>) -> Self {
+        self.rules.push(MergeRule { list, key: Some(key.into()) });
+        self
+    }
+
+    /// Merges the scalar lists `list` selects as a union.
+    ///
+    /// ```
+    /// # use jd_core::{JsonPath, Node, StrategicMerge};
+    /// let merge = StrategicMerge::new().with_merge_list(JsonPath::parse("$.tags").unwrap());
+    /// let base = Node::from_json_str(r#"{"tags":["a","b"]}"#).unwrap();
+    /// let patch = Node::from_json_str(r#"{"tags":["b","c"]}"#).unwrap();
+    /// let patched = base.apply_strategic_merge_patch(&patch, &merge).unwrap();
+    /// assert_eq!(patched, Node::from_json_str(r#"{"tags":["a","b","c"]}"#).unwrap());
+    /// ```
+    #[must_use]
+    pub fn with_merge_list(mut self, list: JsonPath) -> Self {
+        self.rules.push(MergeRule { list, key: None });
+        self
+    }
+
+    /// Reports whether every list is replaced.
+    ///
+    /// ```
+    /// # use jd_core::StrategicMerge;
+    /// assert!(StrategicMerge::default().is_empty());
+    /// ```
+    #[must_use]
+    pub fn is_empty(&self) -> bool {
+        self.rules.is_empty()
+    }
+
+    /// Yields each merging list with its merge key, if any.
+    pub(crate) fn rules(&self) -> impl Iterator<Item = (&JsonPath, Option<&str>)> {
+        self.rules.iter().map(|rule| (&rule.list, rule.key.as_deref()))
+    }
+
+    fn rule_at(&self, path: &Path) -> Option<&MergeRule> {
+        self.rules.iter().find(|rule| rule.list.matches(path))
+    }
+}
+
+pub(super) fn apply(node: &Node, patch: &Node, merge: &StrategicMerge) -> Result<Node, PatchError> {
+    if matches!(patch, Node::Void) {
+        return Err(PatchError::new("invalid strategic merge patch: empty document"));
+    }
+    merge_value(node.clone(), patch, &Path::new(), merge)
+}
+
+fn merge_value(
+    target: Node,
+    patch: &Node,
+    path: &Path,
+    merge: &StrategicMerge,
+) -> Result<Node, PatchError> {
+    match patch {
+        Node::Object(members) => merge_object(target, members, path, merge),
+        Node::Array(elements) => match (merge.rule_at(path), target) {
+            (Some(rule), Node::Array(existing)) => match &rule.key {
+                Some(key) => merge_keyed_list(existing, elements, key, path, merge),
+                None => merge_scalar_list(existing, elements, path),
+            },
+            (_, _) => new_list(elements, path, merge),
+        },
+        _ => Ok(patch.clone()),
+    }
+}
+
+fn merge_object(
+    target: Node,
+    members: &BTreeMap<String, Node>,
+    path: &Path,
+    merge: &StrategicMerge,
+) -> Result<Node, PatchError> {
+    match directive(members, path)? {
+        Some("delete") => return Ok(Node::Void),
+        Some("replace") => return merge_object(Node::Void, &without_patch(members), path, merge),
+        _ => {}
+    }
+    let mut result = match target {
+        Node::Object(map) => map,
+        _ => BTreeMap::new(),
+    };
+    for (key, value) in members {
+        if key == "$patch" || key == "$retainKeys" || key.starts_with("$setElementOrder/") {
+            continue;
+        }
+        if let Some(field) = key.strip_prefix("$deleteFromPrimitiveList/") {
+            let Node::Array(deleted) = value else {
+                return Err(invalid(path, format!("{key} must be a list")));
+            };
+            if let Some(Node::Array(list)) = result.get_mut(field) {
+                list.retain(|item| !deleted.contains(item));
+            }
+            continue;
+        }
+        if key.starts_with('$') {
+            return Err(invalid(path, format!("unsupported directive {key}")));
+        }
+        if matches!(value, Node::Null) {
+            result.remove(key);
+            continue;
+        }
+        let child = path.clone().with_segment(PathSegment::key(key.as_str()));
+        let existing = result.remove(key).unwrap_or(Node::Void);
+        let merged = merge_value(existing, value, &child, merge)?;
+        if !matches!(merged, Node::Void) {
+            result.insert(key.clone(), merged);
+        }
+    }
+    if let Some(retained) = members.get("$retainKeys") {
+        let Node::Array(retained) = retained else {
+            return Err(invalid(path, "$retainKeys must be a list".to_string()));
+        };
+        result.retain(|key, _| retained.contains(&Node::String(key.clone())));
+    }
+    Ok(Node::Object(result))
+}
+
+fn merge_keyed_list(
+    mut existing: Vec<Node>,
+    elements: &[Node],
+    key: &str,
+    path: &Path,
+    merge: &StrategicMerge,
+) -> Result<Node, PatchError> {
+    if elements.iter().any(|element| is_directive(element, "replace")) {
+        let kept: Vec<Node> =
+            elements.iter().filter(|element| !is_directive(element, "replace")).cloned().collect();
+        return new_list(&kept, path, merge);
+    }
+    for element in elements {
+        let Node::Object(members) = element else {
+            return Err(invalid(path, format!("list elements need the merge key {key:?}")));
+        };
+        let Some(identity) = members.get(key) else {
+            return Err(invalid(path, format!("list elements need the merge key {key:?}")));
+        };
+        let position = existing.iter().position(|item| match item {
+            Node::Object(map) => map.get(key) == Some(identity),
+            _ => false,
+        });
+        let index = position.unwrap_or(existing.len());
+        let child = path.clone().with_segment(PathSegment::index(index as i64));
+        let target = match position {
+            Some(index) => existing.remove(index),
+            None => Node::Void,
+        };
+        let merged = merge_value(target, element, &child, merge)?;
+        if !matches!(merged, Node::Void) {
+            existing.insert(index, merged);
+        }
+    }
+    Ok(Node::Array(existing))
+}
+
+fn merge_scalar_list(
+    mut existing: Vec<Node>,
+    elements: &[Node],
+    path: &Path,
+) -> Result<Node, PatchError> {
+    for element in elements {
+        if matches!(element, Node::Object(_) | Node::Array(_)) {
+            return Err(invalid(
+                path,
+                "merged scalar lists cannot hold objects or lists".to_string(),
+            ));
+        }
+        if !existing.contains(element) {
+            existing.push(element.clone());
+        }
+    }
+    Ok(Node::Array(existing))
+}
+
+/// Builds a list from patch elements alone, dropping their directives.
+fn new_list(elements: &[Node], path: &Path, merge: &StrategicMerge) -> Result<Node, PatchError> {
+    let mut list = Vec::with_capacity(elements.len());
+    for (index, element) in elements.iter().enumerate() {
+        let child = path.clone().with_segment(PathSegment::index(index as i64));
+        let value = merge_value(Node::Void, element, &child, merge)?;
+        if !matches!(value, Node::Void) {
+            list.push(value);
+        }
+    }
+    Ok(Node::Array(list))
+}
+
+fn directive<'a>(
+    members: &'a BTreeMap<String, Node>,
+    path: &Path,
+) -> Result<Option<&'a str>, PatchError> {
+    match members.get("$patch") {
+        None => Ok(None),
+        Some(Node::String(value)) if matches!(value.as_str(), "replace" | "delete" | "merge") => {
+            Ok(Some(value))
+        }
+        Some(value) => Err(invalid(path, format!("unsupported $patch directive {value:?}"))),
+    }
+}
+
+fn is_directive(element: &Node, name: &str) -> bool {
+    match element {
+        Node::Object(members) => {
+            matches!(members.get("$patch"), Some(Node::String(value)) if value == name)
+        }
+        _ => false,
+    }
+}
+
+fn without_patch(members: &BTreeMap<String, Node>) -> BTreeMap<String, Node> {
+    members
+        .iter()
+        .filter(|(key, _)| *key != "$patch")
+        .map(|(k, v)| (k.clone(), v.clone()))
+        .collect()
+}
+
+fn invalid(path: &Path, reason: String) -> PatchError {
+    PatchError::new(format!("invalid strategic merge patch at {}: {reason}", path_text(path)))
+}
+
+fn path_text(path: &Path) -> String {
+    serde_json::to_string(path).unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn node(json: &str) -> Node {
+        Node::from_json_str(json).unwrap()
+    }
+
+    fn patched(target: &str, patch: &str) -> Result<Node, PatchError> {
+        apply(&node(target), &node(patch), &StrategicMerge::kubernetes())
+    }
+
+    const POD: &str = r#"{"spec":{"containers":[
+        {"name":"app","image":"app:1","args":["-v"],"env":[{"name":"A","value":"1"},{"name":"B","value":"2"}]},
+        {"name":"sidecar","image":"proxy:1"}]}}"#;
+
+    #[test]
+    fn containers_and_env_merge_by_name() {
+        let patch = r#"{"spec":{"containers":[{"name":"app","image":"app:2","env":[{"name":"B","value":"3"},{"name":"C","value":"4"}]}]}}"#;
+        let expected = r#"{"spec":{"containers":[
+            {"name":"app","image":"app:2","args":["-v"],"env":[{"name":"A","value":"1"},{"name":"B","value":"3"},{"name":"C","value":"4"}]},
+            {"name":"sidecar","image":"proxy:1"}]}}"#;
+        assert_eq!(patched(POD, patch).unwrap(), node(expected));
+    }
+
+    #[test]
+    fn unkeyed_lists_are_replaced() {
+        let patch = r#"{"spec":{"containers":[{"name":"app","args":["-q"]}]}}"#;
+        let result = patched(POD, patch).unwrap();
+        let args = result.query("$.spec.containers[0].args").unwrap();
+        assert_eq!(args[0].node, &node(r#"["-q"]"#));
+    }
+
+    #[test]
+    fn directives_delete_and_replace() {
+        let patch = r#"{"spec":{"containers":[{"name":"sidecar","$patch":"delete"}]}}"#;
+        let result = patched(POD, patch).unwrap();
+        assert_eq!(result.query("$.spec.containers[*].name").unwrap().len(), 1);
+
+        let patch = r#"{"spec":{"containers":[{"$patch":"replace"},{"name":"only","image":"x"}]}}"#;
+        let result = patched(POD, patch).unwrap();
+        assert_eq!(result, node(r#"{"spec":{"containers":[{"name":"only","image":"x"}]}}"#));
+
+        let patch = r#"{"spec":{"$patch":"replace","replicas":1}}"#;
+        assert_eq!(patched(POD, patch).unwrap(), node(r#"{"spec":{"replicas":1}}"#));
+        let patch =
+            r#"{"spec":{"containers":[{"name":"app","env":[{"name":"A","$patch":"delete"}]}]}}"#;
+        let result = patched(POD, patch).unwrap();
+        assert_eq!(result.query("$.spec.containers[0].env[*]").unwrap().len(), 1);
+    }
+
+    #[test]
+    fn scalar_lists_merge_as_unions() {
+        let target = r#"{"metadata":{"finalizers":["a","b"]}}"#;
+        let result = patched(target, r#"{"metadata":{"finalizers":["b","c"]}}"#).unwrap();
+        assert_eq!(result, node(r#"{"metadata":{"finalizers":["a","b","c"]}}"#));
+        let patch = r#"{"metadata":{"$deleteFromPrimitiveList/finalizers":["a"]}}"#;
+        let result = patched(target, patch).unwrap();
+        assert_eq!(result, node(r#"{"metadata":{"finalizers":["b"]}}"#));
+    }
+
+    #[test]
+    fn retain_keys_and_element_order_directives() {
+        let target =
+            r#"{"spec":{"strategy":{"type":"RollingUpdate","rollingUpdate":{"maxSurge":1}}}}"#;
+        let patch = r#"{"spec":{"strategy":{"$retainKeys":["type"],"type":"Recreate"}}}"#;
+        let result = patched(target, patch).unwrap();
+        assert_eq!(result, node(r#"{"spec":{"strategy":{"type":"Recreate"}}}"#));
+        let patch = r#"{"spec":{"$setElementOrder/containers":[{"name":"app"}]}}"#;
+        assert_eq!(patched(POD, patch).unwrap(), node(POD));
+    }
+
+    #[test]
+    fn invalid_patches_are_rejected() {
+        let err = patched(POD, r#"{"spec":{"containers":[{"image":"x"}]}}"#).unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            r#"invalid strategic merge patch at ["spec","containers"]: list elements need the merge key "name""#
+        );
+        let err = patched(POD, r#"{"spec":{"$patch":"swap"}}"#).unwrap_err();
+        assert!(err.to_string().contains("unsupported $patch directive"));
+        let err = patched(POD, r#"{"$unknown":1}"#).unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "invalid strategic merge patch at []: unsupported directive $unknown"
+        );
+    }
+
+    #[test]
+    fn without_rules_lists_are_replaced_as_in_merge_patch() {
+        let base = node(r#"{"a":[1,2],"b":{"c":1}}"#);
+        let patch = node(r#"{"a":[3],"b":{"c":null}}"#);
+        let result = apply(&base, &patch, &StrategicMerge::new()).unwrap();
+        assert_eq!(
+            result,
+            base.apply_merge_patch(&patch.to_json_value().unwrap().to_string()).unwrap()
+        );
+    }
+}
@@ -0,0 +1,323 @@
+//! Option bundles for well-known document formats.
+//!
+//! A [`Preset`] knows the shape of one kind of document: which fields are
+//! volatile and should be ignored, and which lists hold records that should
+//! be paired by an identifying field rather than by position. It also groups
+//! the hunks of a diff by the record they touch, so a reviewer sees "three
+//! resources changed" before reading the hunks themselves, and flags the
+//! changes that may break consumers of formats such as API specifications.
+
+use core::fmt::{self, Write as _};
+use core::str::FromStr;
+
+use crate::diff::COLOR_RESET;
+use crate::prelude::*;
+use crate::{Diff, DiffOptions, OptionsError, Path, RenderConfig};
+
+mod openapi;
+mod terraform;
+
+/// A bundle of diff options and summary rules for one document format.
+///
+/// ```
+/// # use jd_core::{DiffOptions, Node, Preset};
+/// let preset: Preset = "terraform".parse().unwrap();
+/// let lhs = Node::from_json_str(r#"{"timestamp":"2024-01-01T00:00:00Z"}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"timestamp":"2024-01-02T00:00:00Z"}"#).unwrap();
+/// assert!(lhs.diff(&rhs, &DiffOptions::default().with_preset(preset)).is_empty());
+/// ```
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum Preset {
+    /// `terraform show -json` plan output. Timestamps and version stamps are
+    /// ignored, resource lists are paired by `address`, and the summary has
+    /// one entry per resource address.
+    TerraformPlan,
+    /// OpenAPI 3 or Swagger 2 API specifications. Parameters are paired by
+    /// `name` and `in`, tags by `name`, and servers by `url`; `required`,
+    /// `enum`, and `security` lists are unordered. The summary has one entry
+    /// per operation (`GET /pets`) or component and flags breaking changes.
+    OpenApi,
+}
+
+impl Preset {
+    /// Returns the name the preset is parsed from.
+    ///
+    /// ```
+    /// # use jd_core::Preset;
+    /// assert_eq!(Preset::TerraformPlan.name(), "terraform");
+    /// ```
+    #[must_use]
+    pub fn name(self) -> &'static str {
+        match self {
+            Self::TerraformPlan => "terraform",
+            Self::OpenApi => "openapi",
+        }
+    }
+
+    /// Groups the hunks of `diff` by the record they change. `diff` should
+    /// have been computed with options carrying this preset, so that records
+    /// are paired by their identifying fields.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, Preset, SummaryChange};
+    /// let preset = Preset::TerraformPlan;
+    /// let lhs = Node::from_json_str(r#"{"resource_changes":[{"address":"aws_s3_bucket.a"}]}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"resource_changes":[]}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default().with_preset(preset));
+    /// let summary = preset.summarize(&diff);
+    /// assert_eq!(summary.entries()[0].subject, "aws_s3_bucket.a");
+    /// assert_eq!(summary.entries()[0].change, SummaryChange::Removed);
+    /// ```
+    #[must_use]
+    pub fn summarize(self, diff: &Diff) -> Summary {
+        let mut summary = Summary::default();
+        for element in diff.iter() {
+            let records = match self {
+                Self::TerraformPlan => terraform::records(element),
+                Self::OpenApi => openapi::records(element),
+            };
+            for record in records {
+                summary.record(record, &element.path);
+            }
+        }
+        summary
+    }
+
+    pub(crate) fn apply(self, options: DiffOptions) -> DiffOptions {
+        match self {
+            Self::TerraformPlan => terraform::options(options),
+            Self::OpenApi => openapi::options(options),
+        }
+    }
+}
+
+impl FromStr for Preset {
+    type Err = OptionsError;
+
+    fn from_str(name: &str) -> Result<Self, Self::Err> {
+        const ALL: [Preset; 2] = [Preset::TerraformPlan, Preset::OpenApi];
+        ALL.into_iter().find(|preset| preset.name() == name).ok_or_else(|| {
+            OptionsError::InvalidOption { message: format!("unknown preset {name:?}") }
+        })
+    }
+}
+
+impl fmt::Display for Preset {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.name())
+    }
+}
+
+/// How a diff changed one record.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum SummaryChange {
+    /// The record exists only in the second document.
+    Added,
+    /// The record exists only in the first document.
+    Removed,
+    /// The record exists in both documents with different contents.
+    Modified,
+}
+
+impl SummaryChange {
+    fn marker(self) -> char {
+        match self {
+            Self::Added => '+',
+            Self::Removed => '-',
+            Self::Modified => '~',
+        }
+    }
+}
+
+/// One record a diff changed.
+#[derive(Clone, Debug, PartialEq)]
+pub struct SummaryEntry {
+    /// The record's identifier, such as a Terraform resource address.
+    pub subject: String,
+    /// How the record changed.
+    pub change: SummaryChange,
+    /// Paths of the hunks that changed the record, in diff order.
+    pub paths: Vec<Path>,
+    /// Whether the change may break consumers of the document. Only presets
+    /// that classify changes, such as [`Preset::OpenApi`], set it.
+    pub breaking: bool,
+}
+
+/// A record one hunk changes, as a preset names and classifies it.
+#[derive(Clone, Debug, PartialEq)]
+struct Record {
+    subject: String,
+    change: SummaryChange,
+    breaking: bool,
+}
+
+impl Record {
+    fn new(subject: impl Into<String>, change: SummaryChange) -> Self {
+        Self { subject: subject.into(), change, breaking: false }
+    }
+}
+
+/// The records a diff changed, grouped by a [`Preset`].
+///
+/// ```
+/// # use jd_core::{DiffOptions, Node, Preset, RenderConfig};
+/// let preset = Preset::TerraformPlan;
+/// let lhs = Node::from_json_str(
+///     r#"{"resource_changes":[{"address":"aws_instance.web","change":{"after":{"ami":"a"}}}]}"#,
+/// ).unwrap();
+/// let rhs = Node::from_json_str(
+///     r#"{"resource_changes":[{"address":"aws_instance.web","change":{"after":{"ami":"b"}}}]}"#,
+/// ).unwrap();
+/// let diff = lhs.diff(&rhs, &DiffOptions::default().with_preset(preset));
+/// assert_eq!(
+///     preset.summarize(&diff).render(&RenderConfig::default()),
+///     "~ aws_instance.web (1 path)\n1 changed: 1 modified\n"
+/// );
+/// ```
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct Summary {
+    entries: Vec<SummaryEntry>,
+}
+
+impl Summary {
+    /// Returns the changed records, in the order the diff first touches them.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Preset};
+    /// assert!(Preset::TerraformPlan.summarize(&Diff::default()).entries().is_empty());
+    /// ```
+    #[must_use]
+    pub fn entries(&self) -> &[SummaryEntry] {
+        &self.entries
+    }
+
+    /// Reports whether no record changed.
+    ///
+    /// ```
+    /// # use jd_core::{Diff, Preset};
+    /// assert!(Preset::TerraformPlan.summarize(&Diff::default()).is_empty());
+    /// ```
+    #[must_use]
+    pub fn is_empty(&self) -> bool {
+        self.entries.is_empty()
+    }
+
+    /// Renders one line per record, marked `+` when added, `-` when removed,
+    /// and `~` with its number of changed paths when modified, then a totals
+    /// line. Breaking changes are marked `(breaking)` and counted in the
+    /// totals. An empty summary renders as an empty string.
+    ///
+    /// ```
+    /// # use jd_core::{DiffOptions, Node, Preset, RenderConfig};
+    /// let preset = Preset::TerraformPlan;
+    /// let lhs = Node::from_json_str(r#"{"resource_changes":[]}"#).unwrap();
+    /// let rhs = Node::from_json_str(r#"{"resource_changes":[{"address":"aws_s3_bucket.a"}]}"#).unwrap();
+    /// let diff = lhs.diff(&rhs, &DiffOptions::default().with_preset(preset));
+    /// assert_eq!(
+    ///     preset.summarize(&diff).render(&RenderConfig::default()),
+    ///     "+ aws_s3_bucket.a\n1 changed: 1 added\n"
+    /// );
+    /// ```
+    #[must_use]
+    pub fn render(&self, config: &RenderConfig) -> String {
+        if self.is_empty() {
+            return String::new();
+        }
+        let mut output = String::new();
+        for entry in &self.entries {
+            let color = match entry.change {
+                SummaryChange::Added => Some(config.theme().added()),
+                SummaryChange::Removed => Some(config.theme().removed()),
+                SummaryChange::Modified => None,
+            }
+            .filter(|_| config.color_enabled());
+            if let Some(color) = color {
+                output.push_str(color);
+            }
+            let _ = write!(output, "{} {}", entry.change.marker(), entry.subject);
+            if entry.change == SummaryChange::Modified {
+                let count = entry.paths.len();
+                let _ = write!(output, " ({count} {})", if count == 1 { "path" } else { "paths" });
+            }
+            if entry.breaking {
+                output.push_str(" (breaking)");
+            }
+            if color.is_some() {
+                output.push_str(COLOR_RESET);
+            }
+            output.push('\n');
+        }
+
+        let _ = write!(output, "{} changed", self.entries.len());
+        let mut separator = ':';
+        for (change, label) in [
+            (SummaryChange::Added, "added"),
+            (SummaryChange::Removed, "removed"),
+            (SummaryChange::Modified, "modified"),
+        ] {
+            let count = self.entries.iter().filter(|entry| entry.change == change).count();
+            if count > 0 {
+                let _ = write!(output, "{separator} {count} {label}");
+                separator = ',';
+            }
+        }
+        let breaking = self.entries.iter().filter(|entry| entry.breaking).count();
+        if breaking > 0 {
+            let _ = write!(output, "; {breaking} breaking");
+        }
+        output.push('\n');
+        output
+    }
+
+    /// Adds a hunk at `path` that changed a record. A record both added and
+    /// removed, or changed in place anywhere, counts as modified, and one
+    /// breaking hunk makes the whole record breaking.
+    fn record(&mut self, record: Record, path: &Path) {
+        let Record { subject, change, breaking } = record;
+        match self.entries.iter_mut().find(|entry| entry.subject == subject) {
+            Some(entry) => {
+                if entry.change != change {
+                    entry.change = SummaryChange::Modified;
+                }
+                entry.breaking |= breaking;
+                if !entry.paths.contains(path) {
+                    entry.paths.push(path.clone());
+                }
+            }
+            None => self.entries.push(SummaryEntry {
+                subject,
+                change,
+                paths: vec![path.clone()],
+                breaking,
+            }),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn names_round_trip() {
+        for preset in [Preset::TerraformPlan, Preset::OpenApi] {
+            assert_eq!(preset.to_string().parse::<Preset>().unwrap(), preset);
+        }
+        let err = "helm".parse::<Preset>().unwrap_err();
+        assert_eq!(err.to_string(), "invalid option: unknown preset \"helm\"");
+    }
+
+    #[test]
+    fn mixed_changes_to_one_record_are_modifications() {
+        let mut summary = Summary::default();
+        let path = Path::new();
+        summary.record(Record::new("a", SummaryChange::Added), &path);
+        summary.record(Record::new("a", SummaryChange::Removed), &path);
+        summary.record(Record::new("b", SummaryChange::Added), &path);
+        summary.record(Record { breaking: true, ..Record::new("b", SummaryChange::Added) }, &path);
+        let changes: Vec<_> = summary.entries().iter().map(|entry| entry.change).collect();
+        assert_eq!(changes, [SummaryChange::Modified, SummaryChange::Added]);
+        assert_eq!(summary.entries()[1].paths.len(), 1);
+        assert!(!summary.entries()[0].breaking && summary.entries()[1].breaking);
+    }
+}
@@ -0,0 +1,248 @@
+//! The OpenAPI specification preset.
+//!
+//! Operations are objects keyed by path and method, so they already pair
+//! up; the lists inside them are what shift. Parameters are identified by
+//! `name` and `in`, tags by `name`, and servers by `url`, while `required`,
+//! `enum`, and `security` lists carry no order at all.
+//!
+//! Breaking changes are classified conservatively from the hunks alone:
+//! removing anything, changing a `type`, `format`, `$ref`, or parameter
+//! location, and newly requiring a parameter or property are breaking.
+//! Changes to descriptions, examples, and `x-` extensions never are.
+
+use super::{Record, SummaryChange};
+use crate::prelude::*;
+use crate::{DiffElement, DiffOption, DiffOptions, JsonPath, Node, PathSegment};
+
+/// Lists of objects, with the fields that identify their elements.
+const KEYED: &[(&str, &[&str])] = &[
+    ("$.paths.*.parameters", &["in", "name"]),
+    ("$.paths.*.*.parameters", &["in", "name"]),
+    ("$.tags", &["name"]),
+    ("$..servers", &["url"]),
+];
+
+/// Lists whose order carries no meaning.
+const UNORDERED: &[&str] = &[
+    "$.paths.*.*.tags",
+    "$..required",
+    "$..enum",
+    "$..security",
+    "$..consumes",
+    "$..produces",
+    "$..schemes",
+];
+
+/// Operation keys of a path item.
+const METHODS: &[&str] = &["get", "put", "post", "delete", "options", "head", "patch", "trace"];
+
+/// Fields that document an API without changing its contract.
+const DOCUMENTATION: &[&str] =
+    &["description", "summary", "title", "example", "examples", "externalDocs", "deprecated"];
+
+/// Fields whose new value changes what a consumer must send or accept.
+const CONTRACT: &[&str] = &["type", "format", "$ref", "in", "name"];
+
+pub(super) fn options(mut options: DiffOptions) -> DiffOptions {
+    for (list, keys) in KEYED {
+        let then = DiffOption::SetKeys(keys.iter().map(|key| (*key).to_string()).collect());
+        options = options.with_list_option(&parse(list), then);
+    }
+    for list in UNORDERED {
+        options = options.with_list_option(&parse(list), DiffOption::Set);
+    }
+    options
+}
+
+fn parse(path: &str) -> JsonPath {
+    JsonPath::parse(path).expect("built-in OpenAPI paths are valid")
+}
+
+/// Returns the operations, path items, or components `element` changes.
+pub(super) fn records(element: &DiffElement) -> Vec<Record> {
+    let segments = element.path.segments();
+    let keys: Vec<&str> = segments
+        .iter()
+        .map_while(|segment| match segment {
+            PathSegment::Key(key) => Some(key.as_str()),
+            _ => None,
+        })
+        .collect();
+    let (subject, depth) = match keys.as_slice() {
+        ["paths", path, method, ..] if METHODS.contains(method) => {
+            (format!("{} {path}", method.to_uppercase()), 3)
+        }
+        ["paths", path] if segments.len() == 2 => {
+            let operations = operations(path, element);
+            if !operations.is_empty() {
+                return operations;
+            }
+            ((*path).to_string(), 2)
+        }
+        ["paths", path, ..] => ((*path).to_string(), 2),
+        ["components", kind, name, ..] => (format!("#/components/{kind}/{name}"), 3),
+        ["definitions", name, ..] => (format!("#/definitions/{name}"), 2),
+        [field, ..] => ((*field).to_string(), 1),
+        [] => ("$".to_string(), 0),
+    };
+    let added = element.add.iter().any(|value| !matches!(value, Node::Void));
+    let change = match (segments.len() == depth, element.remove.is_empty(), added) {
+        (true, true, true) => SummaryChange::Added,
+        (true, false, false) => SummaryChange::Removed,
+        _ => SummaryChange::Modified,
+    };
+    let breaking = match change {
+        SummaryChange::Added => false,
+        SummaryChange::Removed => true,
+        SummaryChange::Modified => is_breaking(element),
+    };
+    vec![Record { subject, change, breaking }]
+}
+
+/// Names each operation of a path item added or removed as a whole.
+fn operations(path: &str, element: &DiffElement) -> Vec<Record> {
+    let removed = element.remove.iter().map(|value| (value, SummaryChange::Removed));
+    let added = element.add.iter().map(|value| (value, SummaryChange::Added));
+    let mut records = Vec::new();
+    for (value, change) in removed.chain(added) {
+        let Node::Object(item) = value else { continue };
+        for method in item.keys().filter(|key| METHODS.contains(&key.as_str())) {
+            records.push(Record {
+                breaking: change == SummaryChange::Removed,
+                ..Record::new(format!("{} {path}", method.to_uppercase()), change)
+            });
+        }
+    }
+    records
+}
+
+/// Reports whether a hunk inside an existing record may break consumers.
+fn is_breaking(element: &DiffElement) -> bool {
+    let segments = element.path.segments();
+    let documentation = segments.iter().any(|segment| match segment {
+        PathSegment::Key(key) => DOCUMENTATION.contains(&key.as_str()) || key.starts_with("x-"),
+        _ => false,
+    });
+    if documentation {
+        return false;
+    }
+    let removes = !element.remove.is_empty();
+    let added: Vec<&Node> =
+        element.add.iter().filter(|value| !matches!(value, Node::Void)).collect();
+    let last_key = match segments.last() {
+        Some(PathSegment::Key(key)) => Some(key.as_str()),
+        _ => None,
+    };
+
+    // Removed fields, and values removed from lists and sets.
+    if removes && (added.is_empty() || last_key.is_none()) {
+        return true;
+    }
+    if removes && last_key.is_some_and(|key| CONTRACT.contains(&key)) {
+        return true;
+    }
+    // A parameter that became required, or a newly required property.
+    if last_key == Some("required") && added.contains(&&Node::Bool(true)) {
+        return true;
+    }
+    let in_required_list = segments.windows(2).any(|pair| {
+        matches!(&pair[0], PathSegment::Key(key) if key == "required")
+            && !matches!(pair[1], PathSegment::Key(_))
+    });
+    if in_required_list && !added.is_empty() {
+        return true;
+    }
+    // A new parameter that callers must send.
+    added.iter().any(|value| match value {
+        Node::Object(fields) => {
+            last_key.is_none()
+                && segments.iter().any(|segment| segment == &PathSegment::key("parameters"))
+                && fields.get("required") == Some(&Node::Bool(true))
+        }
+        _ => false,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{Preset, RenderConfig};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn summarize(lhs: &str, rhs: &str) -> String {
+        let preset = Preset::OpenApi;
+        let options = DiffOptions::default().with_preset(preset);
+        let diff = json(lhs).diff(&json(rhs), &options);
+        preset.summarize(&diff).render(&RenderConfig::default())
+    }
+
+    #[test]
+    fn parameters_pair_by_name_and_location() {
+        let options = DiffOptions::default().with_preset(Preset::OpenApi);
+        let lhs = json(
+            r#"{"paths":{"/pets":{"get":{"parameters":[
+                {"name":"limit","in":"query","schema":{"type":"integer"}},
+                {"name":"id","in":"header","schema":{"type":"string"}}
+            ]}}}}"#,
+        );
+        let rhs = json(
+            r#"{"paths":{"/pets":{"get":{"parameters":[
+                {"name":"id","in":"header","schema":{"type":"string"}},
+                {"name":"limit","in":"query","schema":{"type":"string"}}
+            ]}}}}"#,
+        );
+        let rendered = lhs.diff(&rhs, &options).render(&RenderConfig::default());
+        assert_eq!(
+            rendered,
+            concat!(
+                r#"@ ["paths","/pets","get","parameters",{"in":"query","name":"limit"},"schema","type"]"#,
+                "\n- \"integer\"\n+ \"string\"\n"
+            )
+        );
+    }
+
+    #[test]
+    fn removed_operations_and_type_changes_are_breaking() {
+        let summary = summarize(
+            r#"{"paths":{"/pets":{"get":{"responses":{"200":{"description":"ok"}}},"delete":{}},"/owners":{"get":{}}}}"#,
+            r#"{"paths":{"/pets":{"get":{"responses":{"200":{"description":"OK"}}},"post":{}},"/stores":{"get":{}}}}"#,
+        );
+        assert_eq!(
+            summary,
+            concat!(
+                "- GET /owners (breaking)\n",
+                "- DELETE /pets (breaking)\n",
+                "~ GET /pets (1 path)\n",
+                "+ POST /pets\n",
+                "+ GET /stores\n",
+                "5 changed: 2 added, 2 removed, 1 modified; 2 breaking\n",
+            )
+        );
+    }
+
+    #[test]
+    fn newly_required_inputs_are_breaking() {
+        let summary = summarize(
+            r#"{"components":{"schemas":{
+                "Pet":{"type":"object","required":["id"],"properties":{"id":{"type":"integer"}}},
+                "Tag":{"type":"object","properties":{"name":{"type":"string"}}}
+            }},"paths":{"/pets":{"get":{"parameters":[]}}}}"#,
+            r#"{"components":{"schemas":{
+                "Pet":{"type":"object","required":["id","name"],"properties":{"id":{"type":"integer"}}},
+                "Tag":{"type":"object","properties":{"name":{"type":"string","maxLength":10}}}
+            }},"paths":{"/pets":{"get":{"parameters":[{"name":"page","in":"query","required":true}]}}}}"#,
+        );
+        assert_eq!(
+            summary,
+            concat!(
+                "~ #/components/schemas/Pet (1 path) (breaking)\n",
+                "~ #/components/schemas/Tag (1 path)\n",
+                "~ GET /pets (1 path) (breaking)\n",
+                "3 changed: 3 modified; 2 breaking\n",
+            )
+        );
+    }
+}
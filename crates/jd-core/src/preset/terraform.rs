@@ -0,0 +1,196 @@
+//! The `terraform show -json` plan preset.
+//!
+//! Plans list resources under `resource_changes`, `resource_drift`,
+//! `planned_values`, `prior_state`, and `configuration`, each element
+//! carrying its module-qualified `address`. Terraform orders these lists by
+//! address, so inserting a resource shifts every later element; pairing
+//! elements by `address` instead keeps diffs to the resources that changed.
+
+use super::{Record, SummaryChange};
+use crate::prelude::*;
+use crate::{DiffElement, DiffOption, DiffOptions, JsonPath, Node, PathSegment};
+
+/// Fields that change on every `terraform plan` run.
+const VOLATILE: &[&str] = &[
+    "$.timestamp",
+    "$.terraform_version",
+    "$.format_version",
+    "$.prior_state.terraform_version",
+    "$.prior_state.format_version",
+];
+
+/// Lists of resources and modules, paired by their `address` field.
+const ADDRESSED: &[&str] = &[
+    "$.resource_changes",
+    "$.resource_drift",
+    "$.planned_values.root_module.resources",
+    "$.prior_state.values.root_module.resources",
+    "$..child_modules",
+    "$..child_modules[*].resources",
+    "$.configuration..resources",
+];
+
+/// Lists whose order carries no meaning.
+const UNORDERED: &[&str] = &["$.relevant_attributes"];
+
+pub(super) fn options(mut options: DiffOptions) -> DiffOptions {
+    options = options.with_ignored_paths(VOLATILE.iter().filter_map(|path| parse(path).to_path()));
+    for list in ADDRESSED {
+        let then = DiffOption::SetKeys(vec!["address".to_string()]);
+        options = options.with_list_option(&parse(list), then);
+    }
+    for list in UNORDERED {
+        options = options.with_list_option(&parse(list), DiffOption::Set);
+    }
+    options
+}
+
+fn parse(path: &str) -> JsonPath {
+    JsonPath::parse(path).expect("built-in Terraform paths are valid")
+}
+
+/// Returns the resources, outputs, or variables `element` changes.
+pub(super) fn records(element: &DiffElement) -> Vec<Record> {
+    let segments = element.path.segments();
+    let keyed = segments.iter().rev().find_map(|segment| match segment {
+        PathSegment::SetKeys(keys) => address(keys.get("address")?),
+        _ => None,
+    });
+    if let Some(address) = keyed {
+        return vec![Record::new(address, SummaryChange::Modified)];
+    }
+    if segments.last() == Some(&PathSegment::Set) {
+        let removed = element.remove.iter().map(|value| (value, SummaryChange::Removed));
+        let added = element.add.iter().map(|value| (value, SummaryChange::Added));
+        let records: Vec<_> = removed
+            .chain(added)
+            .filter_map(|(value, change)| match value {
+                Node::Object(fields) => Some(Record::new(address(fields.get("address")?)?, change)),
+                _ => None,
+            })
+            .collect();
+        if !records.is_empty() {
+            return records;
+        }
+    }
+
+    let (subject, depth) = subject(segments);
+    let added = element.add.iter().any(|value| !matches!(value, Node::Void));
+    let change = match (segments.len() == depth, element.remove.is_empty(), added) {
+        (true, true, true) => SummaryChange::Added,
+        (true, false, false) => SummaryChange::Removed,
+        _ => SummaryChange::Modified,
+    };
+    vec![Record::new(subject, change)]
+}
+
+fn address(value: &Node) -> Option<String> {
+    match value {
+        Node::String(address) => Some(address.clone()),
+        _ => None,
+    }
+}
+
+/// Names the output or variable beneath `segments`, falling back to the
+/// top-level field, with the number of segments that locate it.
+fn subject(segments: &[PathSegment]) -> (String, usize) {
+    let keys: Vec<&str> = segments
+        .iter()
+        .map_while(|segment| match segment {
+            PathSegment::Key(key) => Some(key.as_str()),
+            _ => None,
+        })
+        .collect();
+    match keys.as_slice() {
+        ["output_changes", name, ..] | ["planned_values", "outputs", name, ..] => {
+            (format!("output.{name}"), if keys[0] == "output_changes" { 2 } else { 3 })
+        }
+        ["prior_state", "values", "outputs", name, ..] => (format!("output.{name}"), 4),
+        ["variables", name, ..] => (format!("var.{name}"), 2),
+        [field, ..] => ((*field).to_string(), 1),
+        [] => ("$".to_string(), 0),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{Preset, RenderConfig};
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    fn plan(resources: &str, image: &str) -> Node {
+        json(&format!(
+            r#"{{
+                "format_version": "1.2",
+                "terraform_version": "1.{image}.0",
+                "timestamp": "2024-05-0{image}T00:00:00Z",
+                "variables": {{"region": {{"value": "us-east-1"}}}},
+                "planned_values": {{"root_module": {{
+                    "resources": [{resources}],
+                    "child_modules": [{{
+                        "address": "module.app",
+                        "resources": [{{"address": "module.app.aws_instance.web", "values": {{"ami": "ami-{image}", "tags": ["b", "a"]}}}}]
+                    }}]
+                }}}},
+                "resource_changes": [{resources}],
+                "relevant_attributes": [{{"resource": "a", "attribute": ["id"]}}, {{"resource": "b", "attribute": ["id"]}}]
+            }}"#
+        ))
+    }
+
+    #[test]
+    fn volatile_fields_and_resource_order_are_ignored() {
+        let options = DiffOptions::default().with_preset(Preset::TerraformPlan);
+        let lhs = plan(r#"{"address":"aws_s3_bucket.a"},{"address":"aws_s3_bucket.b"}"#, "1");
+        let mut rhs = plan(r#"{"address":"aws_s3_bucket.b"},{"address":"aws_s3_bucket.a"}"#, "1");
+        assert!(lhs.diff(&rhs, &options).is_empty());
+
+        rhs = plan(r#"{"address":"aws_s3_bucket.b"},{"address":"aws_s3_bucket.a"}"#, "2");
+        let rendered = lhs.diff(&rhs, &options).render(&RenderConfig::default());
+        assert_eq!(
+            rendered,
+            concat!(
+                r#"@ ["planned_values","root_module","child_modules",{"address":"module.app"},"resources",{"address":"module.app.aws_instance.web"},"values","ami"]"#,
+                "\n- \"ami-1\"\n+ \"ami-2\"\n"
+            )
+        );
+    }
+
+    #[test]
+    fn nested_lists_keep_their_order() {
+        let options = DiffOptions::default().with_preset(Preset::TerraformPlan);
+        let lhs = json(
+            r#"{"resource_changes":[{"address":"a.b","change":{"after":{"tags":["x","y"]}}}]}"#,
+        );
+        let rhs = json(
+            r#"{"resource_changes":[{"address":"a.b","change":{"after":{"tags":["y","x"]}}}]}"#,
+        );
+        assert_eq!(lhs.diff(&rhs, &options).len(), 2);
+    }
+
+    #[test]
+    fn summary_groups_hunks_by_address() {
+        let preset = Preset::TerraformPlan;
+        let options = DiffOptions::default().with_preset(preset);
+        let lhs = plan(r#"{"address":"aws_s3_bucket.a"},{"address":"aws_s3_bucket.b"}"#, "1");
+        let rhs = plan(r#"{"address":"aws_s3_bucket.b"},{"address":"aws_s3_bucket.c"}"#, "2");
+        let mut rhs_value = rhs.to_json_value().unwrap();
+        rhs_value["variables"]["zone"] = serde_json::json!({"value": "a"});
+        let rhs = json(&rhs_value.to_string());
+
+        let summary = preset.summarize(&lhs.diff(&rhs, &options));
+        assert_eq!(
+            summary.render(&RenderConfig::default()),
+            concat!(
+                "~ module.app.aws_instance.web (1 path)\n",
+                "- aws_s3_bucket.a\n",
+                "+ aws_s3_bucket.c\n",
+                "+ var.zone\n",
+                "4 changed: 2 added, 1 removed, 1 modified\n",
+            )
+        );
+    }
+}
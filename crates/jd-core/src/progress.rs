@@ -0,0 +1,283 @@
+//! Progress reports from long parses, diffs, and patches.
+//!
+//! A [`ProgressReporter`] registered with [`ParseOptions::with_progress`] or
+//! [`DiffOptions::with_progress`] is handed running totals while the work
+//! goes on: bytes of JSON read, pairs of values compared, list elements
+//! aligned, and patch hunks applied. Reports come every so many units of
+//! work rather than on each one, and a last report marked
+//! [`finished`](Progress::finished) closes every run, so a progress bar can
+//! follow multi-hundred-megabyte inputs without slowing them down.
+//!
+//! [`ParseOptions::with_progress`]: crate::ParseOptions::with_progress
+//! [`DiffOptions::with_progress`]: crate::DiffOptions::with_progress
+
+use alloc::sync::Arc;
+use core::fmt;
+use core::sync::atomic::{AtomicU64, Ordering};
+#[cfg(feature = "std")]
+use std::io::{self, Read};
+
+/// Bytes read between two reports while parsing.
+const BYTES_INTERVAL: u64 = 1 << 20;
+/// Values compared, or list elements aligned, between two reports.
+const NODES_INTERVAL: u64 = 4096;
+/// Patch hunks applied between two reports.
+const HUNKS_INTERVAL: u64 = 256;
+
+/// The operation a [`Progress`] report comes from.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum ProgressPhase {
+    /// Reading a document.
+    Parse,
+    /// Diffing two documents.
+    Diff,
+    /// Applying a diff to a document.
+    Patch,
+}
+
+/// Running totals of one parse, diff, or patch. Counts that do not apply to
+/// the phase stay zero.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct Progress {
+    /// The operation reporting.
+    pub phase: ProgressPhase,
+    /// Bytes of input read so far. JSON input is counted as it is parsed,
+    /// or without the `std` feature once it has been read; YAML input once,
+    /// when it has been read.
+    pub bytes_parsed: u64,
+    /// Pairs of values the diff has compared.
+    pub nodes_visited: u64,
+    /// Elements of the lists the diff has aligned, counting both sides.
+    pub elements_aligned: u64,
+    /// Hunks the patch has tried to apply.
+    pub hunks_applied: u64,
+    /// Whether this is the last report of the run.
+    pub finished: bool,
+}
+
+/// Receives [`Progress`] reports, possibly from another thread than the one
+/// that registered it.
+///
+/// ```
+/// use std::sync::Mutex;
+/// use jd_core::{DiffOptions, Node, Progress, ProgressReporter};
+///
+/// #[derive(Debug, Default)]
+/// struct Last(Mutex<Option<Progress>>);
+///
+/// impl ProgressReporter for Last {
+///     fn report(&self, progress: &Progress) {
+///         *self.0.lock().unwrap() = Some(*progress);
+///     }
+/// }
+///
+/// let reporter = std::sync::Arc::new(Last::default());
+/// let options = DiffOptions::default().with_progress(reporter.clone());
+/// let lhs = Node::from_json_str(r#"{"a":[1,2,3],"b":1}"#).unwrap();
+/// let rhs = Node::from_json_str(r#"{"a":[1,3],"b":2}"#).unwrap();
+/// assert_eq!(lhs.diff(&rhs, &options).len(), 2);
+/// let last = reporter.0.lock().unwrap().unwrap();
+/// assert!(last.finished);
+/// assert_eq!((last.nodes_visited, last.elements_aligned), (3, 5));
+/// ```
+pub trait ProgressReporter: fmt::Debug + Send + Sync {
+    /// Takes the latest totals.
+    fn report(&self, progress: &Progress);
+}
+
+impl<R: ProgressReporter + ?Sized> ProgressReporter for Arc<R> {
+    fn report(&self, progress: &Progress) {
+        (**self).report(progress);
+    }
+}
+
+/// Totals of one run, reported to a [`ProgressReporter`] as they grow.
+#[derive(Debug)]
+pub(crate) struct ProgressTracker {
+    reporter: Arc<dyn ProgressReporter>,
+    phase: ProgressPhase,
+    bytes_parsed: AtomicU64,
+    nodes_visited: AtomicU64,
+    elements_aligned: AtomicU64,
+    hunks_applied: AtomicU64,
+}
+
+impl ProgressTracker {
+    pub(crate) fn new(reporter: Arc<dyn ProgressReporter>, phase: ProgressPhase) -> Self {
+        Self {
+            reporter,
+            phase,
+            bytes_parsed: AtomicU64::new(0),
+            nodes_visited: AtomicU64::new(0),
+            elements_aligned: AtomicU64::new(0),
+            hunks_applied: AtomicU64::new(0),
+        }
+    }
+
+    pub(crate) fn parsed(&self, bytes: usize) {
+        self.add(&self.bytes_parsed, bytes, BYTES_INTERVAL);
+    }
+
+    pub(crate) fn visited(&self) {
+        self.add(&self.nodes_visited, 1, NODES_INTERVAL);
+    }
+
+    pub(crate) fn aligned(&self, elements: usize) {
+        self.add(&self.elements_aligned, elements, NODES_INTERVAL);
+    }
+
+    pub(crate) fn applied(&self) {
+        self.add(&self.hunks_applied, 1, HUNKS_INTERVAL);
+    }
+
+    /// Sends the last report of the run.
+    pub(crate) fn finish(&self) {
+        self.report(true);
+    }
+
+    /// Adds `amount` to `counter`, reporting when the total passes a
+    /// multiple of `interval`.
+    fn add(&self, counter: &AtomicU64, amount: usize, interval: u64) {
+        let amount = u64::try_from(amount).unwrap_or(u64::MAX);
+        let before = counter.fetch_add(amount, Ordering::Relaxed);
+        if before / interval != before.saturating_add(amount) / interval {
+            self.report(false);
+        }
+    }
+
+    fn report(&self, finished: bool) {
+        self.reporter.report(&Progress {
+            phase: self.phase,
+            bytes_parsed: self.bytes_parsed.load(Ordering::Relaxed),
+            nodes_visited: self.nodes_visited.load(Ordering::Relaxed),
+            elements_aligned: self.elements_aligned.load(Ordering::Relaxed),
+            hunks_applied: self.hunks_applied.load(Ordering::Relaxed),
+            finished,
+        });
+    }
+}
+
+/// Reads input for the JSON parser, counting the bytes it takes.
+#[cfg(feature = "std")]
+pub(crate) struct CountingReader<'a> {
+    input: &'a [u8],
+    tracker: &'a ProgressTracker,
+}
+
+#[cfg(feature = "std")]
+impl<'a> CountingReader<'a> {
+    pub(crate) fn new(input: &'a str, tracker: &'a ProgressTracker) -> Self {
+        Self { input: input.as_bytes(), tracker }
+    }
+}
+
+#[cfg(feature = "std")]
+impl Read for CountingReader<'_> {
+    fn read(&mut self, buf: &mut [u8]) -> io::Result<usize> {
+        let read = self.input.read(buf)?;
+        self.tracker.parsed(read);
+        Ok(read)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use std::sync::Mutex;
+
+    use super::*;
+    use crate::prelude::*;
+    use crate::{Diff, DiffOptions, Node, ParseOptions};
+
+    #[derive(Debug, Default)]
+    struct Reports(Mutex<Vec<Progress>>);
+
+    impl ProgressReporter for Reports {
+        fn report(&self, progress: &Progress) {
+            self.0.lock().unwrap().push(*progress);
+        }
+    }
+
+    impl Reports {
+        fn take(&self) -> Vec<Progress> {
+            core::mem::take(&mut self.0.lock().unwrap())
+        }
+    }
+
+    fn json(text: &str) -> Node {
+        Node::from_json_str(text).unwrap()
+    }
+
+    #[test]
+    fn large_diffs_report_as_they_go() {
+        let lhs = Node::from_json_value((0..5000).collect()).unwrap();
+        let rhs = Node::from_json_value((0..5000).map(|n| n * 2).collect()).unwrap();
+        let reports = Arc::new(Reports::default());
+        let diff = lhs.diff(&rhs, &DiffOptions::default().with_progress(reports.clone()));
+        assert!(!diff.is_empty());
+        let reports = reports.take();
+        assert!(reports.len() > 1);
+        assert!(reports.iter().all(|report| report.phase == ProgressPhase::Diff));
+        assert!(reports
+            .windows(2)
+            .all(|pair| pair[0].elements_aligned <= pair[1].elements_aligned));
+        let last = reports.last().unwrap();
+        assert!(last.finished);
+        assert_eq!(last.elements_aligned, 10_000);
+        assert_eq!(reports.iter().filter(|report| report.finished).count(), 1);
+    }
+
+    #[test]
+    fn patches_count_hunks_and_finish_on_failure() {
+        let reports = Arc::new(Reports::default());
+        let options = DiffOptions::default().with_progress(reports.clone());
+        let diff = Diff::from_native_str("@ [\"a\"]\n- 1\n+ 2\n@ [\"b\"]\n- 1\n+ 2\n").unwrap();
+        json(r#"{"a":1,"b":1}"#).apply_patch_with_options(&diff, &options).unwrap();
+        let last = *reports.take().last().unwrap();
+        assert_eq!(
+            (last.phase, last.hunks_applied, last.finished),
+            (ProgressPhase::Patch, 2, true)
+        );
+
+        assert!(json(r#"{"a":3,"b":1}"#).apply_patch_with_options(&diff, &options).is_err());
+        let last = *reports.take().last().unwrap();
+        assert_eq!((last.hunks_applied, last.finished), (1, true));
+
+        let partial = json(r#"{"a":3,"b":1}"#).apply_patch_partial(&diff, &options);
+        assert_eq!(partial.rejected.len(), 1);
+        let last = *reports.take().last().unwrap();
+        assert_eq!((last.hunks_applied, last.finished), (2, true));
+    }
+
+    #[test]
+    fn parses_count_bytes() {
+        let reports = Arc::new(Reports::default());
+        let options = ParseOptions::default().with_progress(reports.clone());
+        let text = format!("[{}]", vec!["\"value\""; 200_000].join(","));
+        let node = Node::from_json_str_with_options(&text, &options).unwrap();
+        assert_eq!(node, Node::from_json_str(&text).unwrap());
+        let reports = reports.take();
+        assert!(reports.len() > 1);
+        assert_eq!(reports.last().unwrap().bytes_parsed, text.len() as u64);
+
+        let err = Node::from_json_str_with_options("[1,", &ParseOptions::default())
+            .unwrap_err()
+            .to_string();
+        let counted = ParseOptions::default().with_progress(Reports::default());
+        assert_eq!(Node::from_json_str_with_options("[1,", &counted).unwrap_err().to_string(), err);
+
+        let reports = Arc::new(Reports::default());
+        let options = ParseOptions::default().with_progress(reports.clone());
+        Node::from_yaml_str_with_options("a: 1\n", &options).unwrap();
+        assert_eq!(
+            reports.take(),
+            [Progress {
+                phase: ProgressPhase::Parse,
+                bytes_parsed: 5,
+                nodes_visited: 0,
+                elements_aligned: 0,
+                hunks_applied: 0,
+                finished: true,
+            }]
+        );
+    }
+}
@@ -0,0 +1,426 @@
+//! JSONPath queries over [`Node`]s.
+//!
+//! Expressions use a subset of RFC 9535: `$` for the root, then `.name`,
+//! `["name"]`, or `['name']` for object keys, `[N]` for list indices, `.*`
+//! or `[*]` for every child, and `..` before any of these to select at any
+//! depth, as in `$.store.book[*].author` or `$..uid`. Besides evaluating
+//! against a document, an expression can be matched against diff paths,
+//! which is how it filters hunks and scopes options without the documents
+//! at hand.
+
+use core::fmt;
+use core::str::FromStr;
+
+use crate::prelude::*;
+use crate::{Node, Path, PathSegment, QueryError};
+
+/// A parsed JSONPath expression.
+///
+/// ```
+/// # use jd_core::{JsonPath, Node};
+/// let store = Node::from_json_str(
+///     r#"{"store":{"book":[{"author":"Rees"},{"author":"Waugh"}]}}"#,
+/// ).unwrap();
+/// let query: JsonPath = "$.store.book[*].author".parse().unwrap();
+/// let authors: Vec<String> =
+///     query.query(&store).iter().map(|found| found.node.to_json_value().unwrap().to_string()).collect();
+/// assert_eq!(authors, [r#""Rees""#, r#""Waugh""#]);
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub struct JsonPath {
+    expression: String,
+    steps: Vec<Step>,
+}
+
+/// A node selected by a [`JsonPath`], with its location in the document.
+#[derive(Clone, Debug, PartialEq)]
+pub struct QueryMatch<'a> {
+    /// Where the node sits in the queried document.
+    pub path: Path,
+    /// The selected node.
+    pub node: &'a Node,
+}
+
+/// One `.name`, `[N]`, or `*` step, optionally preceded by `..`.
+#[derive(Clone, Debug, PartialEq)]
+pub(crate) struct Step {
+    descendants: bool,
+    selector: Selector,
+}
+
+#[derive(Clone, Debug, PartialEq)]
+enum Selector {
+    Key(String),
+    Index(i64),
+    Wildcard,
+}
+
+impl Selector {
+    fn accepts(&self, segment: &PathSegment) -> bool {
+        match (self, segment) {
+            (Self::Wildcard, _) => true,
+            (Self::Key(key), PathSegment::Key(other)) => key == other,
+            (Self::Index(index), PathSegment::Index(other)) => index == other,
+            _ => false,
+        }
+    }
+}
+
+impl JsonPath {
+    /// Parses an expression such as `$.spec.containers[0]["image"]`.
+    ///
+    /// ```
+    /// # use jd_core::JsonPath;
+    /// assert!(JsonPath::parse("$..metadata['uid']").is_ok());
+    /// let err = JsonPath::parse("spec").unwrap_err();
+    /// assert_eq!(err.to_string(), "invalid path \"spec\": expected it to start with $");
+    /// ```
+    pub fn parse(expression: &str) -> Result<Self, QueryError> {
+        let invalid = |reason: &'static str| QueryError::Syntax {
+            expression: expression.to_string(),
+            reason,
+        };
+        let Some(mut rest) = expression.strip_prefix('$') else {
+            return Err(invalid("expected it to start with $"));
+        };
+        let mut steps = Vec::new();
+        while !rest.is_empty() {
+            let (descendants, after) = match rest.strip_prefix("..") {
+                Some(after) => (true, after),
+                None => (false, rest),
+            };
+            let (selector, remaining) = if after.starts_with('[') {
+                bracketed(after).map_err(invalid)?
+            } else if descendants {
+                dotted(after).map_err(invalid)?
+            } else if let Some(name) = after.strip_prefix('.') {
+                dotted(name).map_err(invalid)?
+            } else {
+                return Err(invalid("expected . or ["));
+            };
+            steps.push(Step { descendants, selector });
+            rest = remaining;
+        }
+        Ok(Self { expression: expression.to_string(), steps })
+    }
+
+    /// Selects the matching nodes of `root`, in document order.
+    ///
+    /// ```
+    /// # use jd_core::{JsonPath, Node, Path, PathSegment};
+    /// let doc = Node::from_json_str(r#"{"a":{"uid":1},"b":[{"uid":2}]}"#).unwrap();
+    /// let found = JsonPath::parse("$..uid").unwrap().query(&doc);
+    /// let paths: Vec<String> = found.iter().map(|found| found.path.to_string()).collect();
+    /// assert_eq!(paths, ["[a uid]", "[b 0 uid]"]);
+    /// ```
+    #[must_use]
+    pub fn query<'a>(&self, root: &'a Node) -> Vec<QueryMatch<'a>> {
+        let mut current = vec![QueryMatch { path: Path::new(), node: root }];
+        for step in &self.steps {
+            let mut next = Vec::new();
+            for found in current {
+                if step.descendants {
+                    for (path, node) in subtree(found.path, found.node) {
+                        select(&step.selector, &path, node, &mut next);
+                    }
+                } else {
+                    select(&step.selector, &found.path, found.node, &mut next);
+                }
+            }
+            current = next;
+        }
+        current
+    }
+
+    /// Reports whether `path` is one the expression selects, without
+    /// looking at a document. A wildcard also accepts the `{}` and `[]`
+    /// segments of set and multiset diffs.
+    ///
+    /// ```
+    /// # use jd_core::{JsonPath, Path, PathSegment};
+    /// let query = JsonPath::parse("$.items[*].id").unwrap();
+    /// let path = Path::from(vec![PathSegment::key("items"), PathSegment::index(3), PathSegment::key("id")]);
+    /// assert!(query.matches(&path));
+    /// assert!(!query.matches(&path.drop_last()));
+    /// ```
+    #[must_use]
+    pub fn matches(&self, path: &Path) -> bool {
+        walk(&self.steps, path.segments(), &|rest| rest.is_empty())
+    }
+
+    /// Reports whether `path` is a selected path or lies below one.
+    ///
+    /// ```
+    /// # use jd_core::{JsonPath, Path, PathSegment};
+    /// let query = JsonPath::parse("$.spec").unwrap();
+    /// assert!(query.contains(&Path::from(vec![PathSegment::key("spec"), PathSegment::key("x")])));
+    /// assert!(!query.contains(&Path::new()));
+    /// ```
+    #[must_use]
+    pub fn contains(&self, path: &Path) -> bool {
+        walk(&self.steps, path.segments(), &|_| true)
+    }
+
+    /// Returns the single path the expression names when it has no
+    /// wildcards or descendant steps.
+    ///
+    /// ```
+    /// # use jd_core::{JsonPath, Path, PathSegment};
+    /// let path = JsonPath::parse("$.a[0]").unwrap().to_path();
+    /// assert_eq!(path, Some(Path::from(vec![PathSegment::key("a"), PathSegment::index(0)])));
+    /// assert_eq!(JsonPath::parse("$.a[*]").unwrap().to_path(), None);
+    /// ```
+    #[must_use]
+    pub fn to_path(&self) -> Option<Path> {
+        self.steps
+            .iter()
+            .map(|step| match (&step.selector, step.descendants) {
+                (Selector::Key(key), false) => Some(PathSegment::Key(key.clone())),
+                (Selector::Index(index), false) => Some(PathSegment::Index(*index)),
+                _ => None,
+            })
+            .collect::<Option<Vec<_>>>()
+            .map(Path::from)
+    }
+
+    pub(crate) fn cursor(&self) -> QueryCursor {
+        QueryCursor(self.steps.clone())
+    }
+}
+
+impl FromStr for JsonPath {
+    type Err = QueryError;
+
+    fn from_str(expression: &str) -> Result<Self, Self::Err> {
+        Self::parse(expression)
+    }
+}
+
+impl fmt::Display for JsonPath {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(&self.expression)
+    }
+}
+
+impl Node {
+    /// Evaluates a JSONPath expression against this node.
+    ///
+    /// ```
+    /// # use jd_core::Node;
+    /// let doc = Node::from_json_str(r#"{"tags":["a","b"]}"#).unwrap();
+    /// let found = doc.query("$.tags[1]").unwrap();
+    /// assert_eq!(found[0].node, &Node::String("b".to_string()));
+    /// ```
+    pub fn query(&self, expression: &str) -> Result<Vec<QueryMatch<'_>>, QueryError> {
+        Ok(JsonPath::parse(expression)?.query(self))
+    }
+}
+
+/// The steps of a [`JsonPath`] left to match while options descend into a
+/// document segment by segment.
+#[derive(Clone, Debug, PartialEq)]
+pub(crate) struct QueryCursor(Vec<Step>);
+
+impl QueryCursor {
+    /// Reports whether every step has matched.
+    pub(crate) fn is_done(&self) -> bool {
+        self.0.is_empty()
+    }
+
+    /// Returns the cursors left after descending through `segment`. A
+    /// descendant step stays pending as well, since it may match deeper.
+    pub(crate) fn advance(&self, segment: &PathSegment) -> Vec<QueryCursor> {
+        let Some((step, rest)) = self.0.split_first() else {
+            return Vec::new();
+        };
+        let mut next = Vec::new();
+        if step.descendants {
+            next.push(self.clone());
+        }
+        if step.selector.accepts(segment) {
+            next.push(QueryCursor(rest.to_vec()));
+        }
+        next
+    }
+}
+
+/// Parses the name after `.` or `..`, up to the next step.
+fn dotted(text: &str) -> Result<(Selector, &str), &'static str> {
+    let end = text.find(['.', '[']).unwrap_or(text.len());
+    let selector = match &text[..end] {
+        "" => return Err("expected a key after ."),
+        "*" => Selector::Wildcard,
+        name => Selector::Key(name.to_string()),
+    };
+    Ok((selector, &text[end..]))
+}
+
+/// Parses a `[...]` step; quoted keys may themselves contain `]`.
+fn bracketed(text: &str) -> Result<(Selector, &str), &'static str> {
+    let quote = text[1..].chars().next().filter(|ch| matches!(ch, '"' | '\''));
+    let end = match quote {
+        Some(quote) => {
+            let close = [quote, ']'].iter().collect::<String>();
+            text.get(2..).and_then(|tail| tail.find(&close)).map(|at| at + 3)
+        }
+        None => text.find(']'),
+    };
+    let Some(end) = end else {
+        return Err("unclosed [");
+    };
+    let inner = &text[1..end];
+    let selector = match quote {
+        Some('"') => Selector::Key(
+            serde_json::from_str(inner).map_err(|_| "expected a JSON string inside [\"...\"]")?,
+        ),
+        Some(_) => Selector::Key(inner[1..inner.len() - 1].to_string()),
+        None if inner == "*" => Selector::Wildcard,
+        None => {
+            let index: i64 = inner.parse().map_err(|_| "expected an index or quoted key")?;
+            if index < 0 {
+                return Err("list indices cannot be negative");
+            }
+            Selector::Index(index)
+        }
+    };
+    Ok((selector, &text[end + 1..]))
+}
+
+fn children(node: &Node) -> Vec<(PathSegment, &Node)> {
+    match node {
+        Node::Object(members) => {
+            members.iter().map(|(key, child)| (PathSegment::Key(key.clone()), child)).collect()
+        }
+        Node::Array(items) => {
+            (0_i64..).zip(items).map(|(i, c)| (PathSegment::Index(i), c)).collect()
+        }
+        _ => Vec::new(),
+    }
+}
+
+/// Lists `node` and everything beneath it, parents before children.
+fn subtree(path: Path, node: &Node) -> Vec<(Path, &Node)> {
+    let mut nodes = Vec::new();
+    let mut pending = vec![(path, node)];
+    while let Some((path, node)) = pending.pop() {
+        let mut below = children(node);
+        below.reverse();
+        pending.extend(
+            below.into_iter().map(|(segment, child)| (path.clone().with_segment(segment), child)),
+        );
+        nodes.push((path, node));
+    }
+    nodes
+}
+
+fn select<'a>(selector: &Selector, path: &Path, node: &'a Node, out: &mut Vec<QueryMatch<'a>>) {
+    for (segment, child) in children(node) {
+        if selector.accepts(&segment) {
+            out.push(QueryMatch { path: path.clone().with_segment(segment), node: child });
+        }
+    }
+}
+
+/// Matches `steps` against the start of `segments`, calling `done` with
+/// the segments left over after each way all steps can match.
+fn walk(steps: &[Step], segments: &[PathSegment], done: &dyn Fn(&[PathSegment]) -> bool) -> bool {
+    let Some((step, rest)) = steps.split_first() else {
+        return done(segments);
+    };
+    let skippable = if step.descendants { segments.len() } else { 0 };
+    (0..=skippable).any(|skipped| match segments.get(skipped) {
+        Some(segment) if step.selector.accepts(segment) => {
+            walk(rest, &segments[skipped + 1..], done)
+        }
+        _ => false,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn paths(expression: &str, json: &str) -> Vec<String> {
+        let doc = Node::from_json_str(json).unwrap();
+        doc.query(expression).unwrap().iter().map(|found| found.path.to_string()).collect()
+    }
+
+    fn path(json: &str) -> Path {
+        serde_json::from_str(json).unwrap()
+    }
+
+    #[test]
+    fn parses_keys_indices_and_wildcards() {
+        let query = JsonPath::parse(r#"$.spec.containers[0]["image.tag"]['a]b'][*].*"#).unwrap();
+        assert_eq!(
+            query.steps.iter().map(|step| step.selector.clone()).collect::<Vec<_>>(),
+            [
+                Selector::Key("spec".to_string()),
+                Selector::Key("containers".to_string()),
+                Selector::Index(0),
+                Selector::Key("image.tag".to_string()),
+                Selector::Key("a]b".to_string()),
+                Selector::Wildcard,
+                Selector::Wildcard,
+            ]
+        );
+        assert_eq!(query.to_string(), r#"$.spec.containers[0]["image.tag"]['a]b'][*].*"#);
+        let query = JsonPath::parse("$..a..[1]").unwrap();
+        assert!(query.steps.iter().all(|step| step.descendants));
+    }
+
+    #[test]
+    fn rejects_malformed_expressions() {
+        for (expression, reason) in [
+            ("spec", "expected it to start with $"),
+            ("$.", "expected a key after ."),
+            ("$..", "expected a key after ."),
+            ("$[0", "unclosed ["),
+            ("$[\"a]", "unclosed ["),
+            ("$['a]", "unclosed ["),
+            ("$[x]", "expected an index or quoted key"),
+            ("$[-1]", "list indices cannot be negative"),
+            ("$a", "expected . or ["),
+        ] {
+            let err = JsonPath::parse(expression).unwrap_err();
+            assert_eq!(err.to_string(), format!("invalid path {expression:?}: {reason}"));
+        }
+    }
+
+    #[test]
+    fn queries_select_in_document_order() {
+        let doc =
+            r#"{"store":{"book":[{"author":"A","price":1},{"author":"B"}],"bike":{"price":2}}}"#;
+        assert_eq!(
+            paths("$.store.book[*].author", doc),
+            ["[store book 0 author]", "[store book 1 author]"]
+        );
+        assert_eq!(paths("$..price", doc), ["[store bike price]", "[store book 0 price]"]);
+        assert_eq!(paths("$.store.*", doc), ["[store bike]", "[store book]"]);
+        assert_eq!(paths("$", doc), ["[]"]);
+        assert!(paths("$.store.book[5]", doc).is_empty());
+        assert!(paths("$.store[0]", doc).is_empty());
+    }
+
+    #[test]
+    fn paths_match_without_a_document() {
+        let query = JsonPath::parse("$..metadata.uid").unwrap();
+        assert!(query.matches(&path(r#"["metadata","uid"]"#)));
+        assert!(query.matches(&path(r#"["items",2,"metadata","uid"]"#)));
+        assert!(!query.matches(&path(r#"["items",2,"metadata"]"#)));
+        assert!(query.contains(&path(r#"["items",2,"metadata","uid","x"]"#)));
+        let query = JsonPath::parse("$.tags[*]").unwrap();
+        assert!(query.matches(&path(r#"["tags",{}]"#)));
+    }
+
+    #[test]
+    fn cursors_advance_segment_by_segment() {
+        let cursor = JsonPath::parse("$..uid").unwrap().cursor();
+        let next = cursor.advance(&PathSegment::key("meta"));
+        assert_eq!(next, core::slice::from_ref(&cursor));
+        let next = cursor.advance(&PathSegment::key("uid"));
+        assert_eq!(next.len(), 2);
+        assert!(next[1].is_done());
+        assert!(next[1].advance(&PathSegment::key("x")).is_empty());
+    }
+}
@@ -0,0 +1,830 @@
+//! JSON Schema validation, so pipelines can refuse documents a diff or
+//! patch should never see or produce.
+//!
+//! [`JsonSchema`] checks [`Node`]s against the assertion keywords shared by
+//! drafts 7 through 2020-12: `type`, `enum`, `const`, the numeric, string,
+//! array, and object bounds, `pattern`, `properties` and its relatives,
+//! `items`/`prefixItems`, `contains`, the dependency keywords, `allOf`,
+//! `anyOf`, `oneOf`, `not`, and `if`/`then`/`else`. `$ref` may point
+//! anywhere in the same schema (`#/$defs/...`, `#/definitions/...`). Other
+//! keywords, including `format` and `unevaluated*`, are annotations here and
+//! are not checked. Patterns use Rust's `regex` syntax, which agrees with
+//! ECMA-262 for the patterns schemas usually contain.
+
+use alloc::collections::BTreeMap;
+use core::fmt;
+use hashbrown::HashMap;
+
+use regex::Regex;
+use thiserror::Error;
+
+use crate::number::{is_integral, round};
+use crate::prelude::*;
+use crate::{Node, Path, PathSegment};
+
+/// How many `$ref`s validation follows in a row before assuming the schema
+/// loops without consuming the document.
+const MAX_REF_DEPTH: usize = 64;
+
+/// A compiled JSON Schema.
+///
+/// ```
+/// # use jd_core::{JsonSchema, Node};
+/// let schema = JsonSchema::new(Node::from_json_str(
+///     r#"{"type":"object","required":["name"],"properties":{"replicas":{"type":"integer","minimum":1}}}"#,
+/// ).unwrap()).unwrap();
+/// assert!(schema.validate(&Node::from_json_str(r#"{"name":"web","replicas":3}"#).unwrap()).is_ok());
+///
+/// let violations = schema.violations(&Node::from_json_str(r#"{"replicas":0}"#).unwrap());
+/// let messages: Vec<String> = violations.iter().map(ToString::to_string).collect();
+/// assert_eq!(messages, [
+///     r#"[]: missing required property "name""#,
+///     r#"["replicas"]: 0 is less than the minimum of 1"#,
+/// ]);
+/// ```
+#[derive(Clone, Debug)]
+pub struct JsonSchema {
+    root: Node,
+    patterns: HashMap<String, Regex>,
+}
+
+/// One way a document fails a schema.
+///
+/// ```
+/// # use jd_core::{JsonSchema, Node, Path, PathSegment};
+/// let schema = JsonSchema::new(Node::from_json_str(r#"{"items":{"type":"string"}}"#).unwrap()).unwrap();
+/// let violations = schema.violations(&Node::from_json_str(r#"["a",1]"#).unwrap());
+/// assert_eq!(violations[0].path, Path::from(PathSegment::index(1)));
+/// assert_eq!(violations[0].keyword, "#/items/type");
+/// assert_eq!(violations[0].message, "expected string, found integer");
+/// ```
+#[derive(Clone, Debug, PartialEq)]
+pub struct SchemaViolation {
+    /// Location of the offending value in the document.
+    pub path: Path,
+    /// JSON Pointer fragment of the keyword that failed, such as
+    /// `#/properties/name/type`. After a `$ref`, it points into the
+    /// referenced schema.
+    pub keyword: String,
+    /// What is wrong with the value.
+    pub message: String,
+}
+
+impl fmt::Display for SchemaViolation {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let path = serde_json::to_string(&self.path).unwrap_or_default();
+        write!(f, "{path}: {}", self.message)
+    }
+}
+
+/// Errors compiling a schema or validating a document against it.
+///
+/// ```
+/// # use jd_core::{JsonSchema, Node, SchemaError};
+/// let err = JsonSchema::new(Node::from_json_str(r#"{"$ref":"other.json"}"#).unwrap()).unwrap_err();
+/// assert!(matches!(err, SchemaError::InvalidSchema { .. }));
+/// ```
+#[derive(Debug, Error, PartialEq)]
+pub enum SchemaError {
+    /// The schema itself is malformed or uses something unsupported.
+    #[error("invalid schema: {message}")]
+    InvalidSchema {
+        /// What is wrong with the schema.
+        message: String,
+    },
+    /// The document does not match the schema.
+    #[error("document does not match the schema: {}", summarize(.violations))]
+    Invalid {
+        /// Every violation found, in document order.
+        violations: Vec<SchemaViolation>,
+    },
+}
+
+fn summarize(violations: &[SchemaViolation]) -> String {
+    match violations {
+        [] => String::new(),
+        [only] => only.to_string(),
+        [first, rest @ ..] => format!("{first} (and {} more)", rest.len()),
+    }
+}
+
+impl JsonSchema {
+    /// Compiles `schema`, checking that its patterns and references are
+    /// usable.
+    ///
+    /// ```
+    /// # use jd_core::{JsonSchema, Node};
+    /// assert!(JsonSchema::new(Node::from_json_str(r#"{"pattern":"^[a-z]+$"}"#).unwrap()).is_ok());
+    /// assert!(JsonSchema::new(Node::from_json_str(r#"{"pattern":"("}"#).unwrap()).is_err());
+    /// ```
+    pub fn new(schema: Node) -> Result<Self, SchemaError> {
+        let mut compiled = Self { root: schema, patterns: HashMap::new() };
+        let mut patterns = Vec::new();
+        let mut references = Vec::new();
+        collect(&compiled.root, &mut patterns, &mut references);
+        for pattern in patterns {
+            let regex = Regex::new(&pattern).map_err(|err| SchemaError::InvalidSchema {
+                message: format!("invalid pattern {pattern:?}: {err}"),
+            })?;
+            compiled.patterns.insert(pattern, regex);
+        }
+        for reference in references {
+            if compiled.resolve(&reference).is_none() {
+                return Err(SchemaError::InvalidSchema {
+                    message: format!("unsupported or unresolvable $ref {reference:?}"),
+                });
+            }
+        }
+        Ok(compiled)
+    }
+
+    /// Parses and compiles a schema written as JSON.
+    ///
+    /// ```
+    /// # use jd_core::JsonSchema;
+    /// assert!(JsonSchema::from_json_str(r#"{"type":"object"}"#).is_ok());
+    /// assert!(JsonSchema::from_json_str("{").is_err());
+    /// ```
+    pub fn from_json_str(input: &str) -> Result<Self, SchemaError> {
+        let schema = Node::from_json_str(input)
+            .map_err(|err| SchemaError::InvalidSchema { message: err.to_string() })?;
+        Self::new(schema)
+    }
+
+    /// Checks `document`, failing with [`SchemaError::Invalid`] and every
+    /// violation found.
+    ///
+    /// ```
+    /// # use jd_core::{JsonSchema, Node, SchemaError};
+    /// let schema = JsonSchema::from_json_str(r#"{"type":"array","maxItems":1}"#).unwrap();
+    /// let err = schema.validate(&Node::from_json_str("[1,2]").unwrap()).unwrap_err();
+    /// assert_eq!(
+    ///     err.to_string(),
+    ///     "document does not match the schema: []: expected at most 1 item, found 2"
+    /// );
+    /// ```
+    pub fn validate(&self, document: &Node) -> Result<(), SchemaError> {
+        let violations = self.violations(document);
+        if violations.is_empty() {
+            Ok(())
+        } else {
+            Err(SchemaError::Invalid { violations })
+        }
+    }
+
+    /// Returns every way `document` fails the schema, in document order.
+    ///
+    /// ```
+    /// # use jd_core::{JsonSchema, Node};
+    /// let schema = JsonSchema::from_json_str(r#"{"enum":["a","b"]}"#).unwrap();
+    /// assert!(schema.violations(&Node::from_json_str(r#""a""#).unwrap()).is_empty());
+    /// assert_eq!(schema.violations(&Node::from_json_str(r#""c""#).unwrap()).len(), 1);
+    /// ```
+    #[must_use]
+    pub fn violations(&self, document: &Node) -> Vec<SchemaViolation> {
+        let mut violations = Vec::new();
+        let mut path = Path::new();
+        self.check(&self.root, "#", document, &mut path, 0, &mut violations);
+        violations
+    }
+
+    /// Looks up a `#`-relative JSON Pointer reference within the schema.
+    fn resolve(&self, reference: &str) -> Option<&Node> {
+        let pointer = reference.strip_prefix('#')?;
+        if pointer.is_empty() {
+            return Some(&self.root);
+        }
+        let mut node = &self.root;
+        for token in pointer.strip_prefix('/')?.split('/') {
+            let token = percent_decode(token).replace("~1", "/").replace("~0", "~");
+            node = match node {
+                Node::Object(fields) => fields.get(&token)?,
+                Node::Array(items) => items.get(token.parse::<usize>().ok()?)?,
+                _ => return None,
+            };
+        }
+        Some(node)
+    }
+
+    fn is_valid(&self, schema: &Node, instance: &Node, path: &mut Path, refs: usize) -> bool {
+        let mut violations = Vec::new();
+        self.check(schema, "#", instance, path, refs, &mut violations);
+        violations.is_empty()
+    }
+
+    fn check(
+        &self,
+        schema: &Node,
+        location: &str,
+        instance: &Node,
+        path: &mut Path,
+        refs: usize,
+        out: &mut Vec<SchemaViolation>,
+    ) {
+        let fields = match schema {
+            Node::Bool(true) => return,
+            Node::Bool(false) => {
+                out.push(violation(path, location, "no value is allowed here".to_string()));
+                return;
+            }
+            Node::Object(fields) => fields,
+            _ => return,
+        };
+        let at = |keyword: &str| format!("{location}/{}", escape(keyword));
+        if let Some(Node::String(reference)) = fields.get("$ref") {
+            if refs >= MAX_REF_DEPTH {
+                let message = format!("$ref {reference:?} nests too deeply");
+                out.push(violation(path, &at("$ref"), message));
+            } else if let Some(target) = self.resolve(reference) {
+                self.check(target, reference, instance, path, refs + 1, out);
+            }
+        }
+        let mut fail = |path: &Path, keyword: &str, message: String| {
+            out.push(violation(path, &at(keyword), message));
+        };
+
+        if let Some(expected) = fields.get("type") {
+            let names: Vec<&str> = match expected {
+                Node::String(name) => vec![name.as_str()],
+                Node::Array(names) => names
+                    .iter()
+                    .filter_map(|name| match name {
+                        Node::String(name) => Some(name.as_str()),
+                        _ => None,
+                    })
+                    .collect(),
+                _ => Vec::new(),
+            };
+            if !names.is_empty() && !names.iter().any(|name| has_type(instance, name)) {
+                let message =
+                    format!("expected {}, found {}", names.join(" or "), type_name(instance));
+                fail(path, "type", message);
+            }
+        }
+        if let Some(Node::Array(allowed)) = fields.get("enum") {
+            if !allowed.contains(instance) {
+                fail(path, "enum", format!("{} is not one of the allowed values", show(instance)));
+            }
+        }
+        if let Some(constant) = fields.get("const") {
+            if constant != instance {
+                fail(
+                    path,
+                    "const",
+                    format!("expected {}, found {}", show(constant), show(instance)),
+                );
+            }
+        }
+
+        check_bounds(fields, &mut fail, instance, path);
+        if let (Node::String(text), Some(Node::String(pattern))) = (instance, fields.get("pattern"))
+        {
+            if self.patterns.get(pattern).is_some_and(|regex| !regex.is_match(text)) {
+                let message = format!("{} does not match the pattern {pattern:?}", show(instance));
+                fail(path, "pattern", message);
+            }
+        }
+
+        // Applicators, which recurse into subschemas and report their own
+        // violations.
+        if let Some(Node::Array(schemas)) = fields.get("allOf") {
+            for (index, subschema) in schemas.iter().enumerate() {
+                self.check(
+                    subschema,
+                    &format!("{}/{index}", at("allOf")),
+                    instance,
+                    path,
+                    refs,
+                    out,
+                );
+            }
+        }
+        if let Some(Node::Array(schemas)) = fields.get("anyOf") {
+            if !schemas.iter().any(|subschema| self.is_valid(subschema, instance, path, refs)) {
+                out.push(violation(
+                    path,
+                    &at("anyOf"),
+                    "does not match any schema in anyOf".to_string(),
+                ));
+            }
+        }
+        if let Some(Node::Array(schemas)) = fields.get("oneOf") {
+            let matched = schemas
+                .iter()
+                .filter(|subschema| self.is_valid(subschema, instance, path, refs))
+                .count();
+            if matched != 1 {
+                let message = format!("matches {matched} schemas in oneOf instead of exactly 1");
+                out.push(violation(path, &at("oneOf"), message));
+            }
+        }
+        if let Some(subschema) = fields.get("not") {
+            if self.is_valid(subschema, instance, path, refs) {
+                out.push(violation(path, &at("not"), "matches the schema in not".to_string()));
+            }
+        }
+        if let Some(condition) = fields.get("if") {
+            let branch =
+                if self.is_valid(condition, instance, path, refs) { "then" } else { "else" };
+            if let Some(subschema) = fields.get(branch) {
+                self.check(subschema, &at(branch), instance, path, refs, out);
+            }
+        }
+
+        match instance {
+            Node::Array(items) => self.check_items(fields, location, items, path, refs, out),
+            Node::Object(members) => {
+                self.check_members(fields, location, members, path, refs, out);
+            }
+            _ => {}
+        }
+    }
+
+    fn check_items(
+        &self,
+        fields: &BTreeMap<String, Node>,
+        location: &str,
+        items: &[Node],
+        path: &mut Path,
+        refs: usize,
+        out: &mut Vec<SchemaViolation>,
+    ) {
+        let at = |keyword: &str| format!("{location}/{}", escape(keyword));
+        // Draft 7 spells tuples as an `items` array and the rest as
+        // `additionalItems`; 2020-12 uses `prefixItems` and `items`.
+        let (prefix, prefix_keyword, rest, rest_keyword) = match fields.get("items") {
+            Some(Node::Array(prefix)) => {
+                (prefix.as_slice(), "items", fields.get("additionalItems"), "additionalItems")
+            }
+            rest => {
+                let prefix = match fields.get("prefixItems") {
+                    Some(Node::Array(prefix)) => prefix.as_slice(),
+                    _ => &[],
+                };
+                (prefix, "prefixItems", rest, "items")
+            }
+        };
+        for (index, item) in items.iter().enumerate() {
+            path.push(PathSegment::index(index as i64));
+            match prefix.get(index) {
+                Some(subschema) => {
+                    let location = format!("{}/{index}", at(prefix_keyword));
+                    self.check(subschema, &location, item, path, refs, out);
+                }
+                None => {
+                    if let Some(subschema) = rest {
+                        self.check(subschema, &at(rest_keyword), item, path, refs, out);
+                    }
+                }
+            }
+            path.pop();
+        }
+
+        if let Some(subschema) = fields.get("contains") {
+            let matched = (0..items.len())
+                .filter(|&index| {
+                    path.push(PathSegment::index(index as i64));
+                    let valid = self.is_valid(subschema, &items[index], path, refs);
+                    path.pop();
+                    valid
+                })
+                .count();
+            let bound = |keyword: &str| match fields.get(keyword) {
+                Some(Node::Number(bound)) if bound.get() >= 0.0 => Some(bound.get() as usize),
+                _ => None,
+            };
+            let minimum = bound("minContains").unwrap_or(1);
+            if matched < minimum {
+                let expected = counted(minimum, ("item", "items"));
+                let message =
+                    format!("expected at least {expected} matching contains, found {matched}");
+                out.push(violation(path, &at("contains"), message));
+            }
+            if let Some(maximum) = bound("maxContains").filter(|maximum| matched > *maximum) {
+                let expected = counted(maximum, ("item", "items"));
+                let message =
+                    format!("expected at most {expected} matching contains, found {matched}");
+                out.push(violation(path, &at("maxContains"), message));
+            }
+        }
+    }
+
+    fn check_members(
+        &self,
+        fields: &BTreeMap<String, Node>,
+        location: &str,
+        members: &BTreeMap<String, Node>,
+        path: &mut Path,
+        refs: usize,
+        out: &mut Vec<SchemaViolation>,
+    ) {
+        let at = |keyword: &str| format!("{location}/{}", escape(keyword));
+        let properties = match fields.get("properties") {
+            Some(Node::Object(properties)) => Some(properties),
+            _ => None,
+        };
+        let patterns: Vec<(&Regex, &str, &Node)> = match fields.get("patternProperties") {
+            Some(Node::Object(patterns)) => patterns
+                .iter()
+                .filter_map(|(pattern, subschema)| {
+                    Some((self.patterns.get(pattern)?, pattern.as_str(), subschema))
+                })
+                .collect(),
+            _ => Vec::new(),
+        };
+
+        for (name, value) in members {
+            path.push(PathSegment::key(name.clone()));
+            let mut evaluated = false;
+            if let Some(subschema) = properties.and_then(|properties| properties.get(name)) {
+                let location = format!("{}/{}", at("properties"), escape(name));
+                self.check(subschema, &location, value, path, refs, out);
+                evaluated = true;
+            }
+            for (regex, pattern, subschema) in &patterns {
+                if regex.is_match(name) {
+                    let location = format!("{}/{}", at("patternProperties"), escape(pattern));
+                    self.check(subschema, &location, value, path, refs, out);
+                    evaluated = true;
+                }
+            }
+            if !evaluated {
+                match fields.get("additionalProperties") {
+                    Some(Node::Bool(false)) => out.push(violation(
+                        path,
+                        &at("additionalProperties"),
+                        format!("property {name:?} is not allowed"),
+                    )),
+                    Some(subschema) => {
+                        self.check(subschema, &at("additionalProperties"), value, path, refs, out);
+                    }
+                    None => {}
+                }
+            }
+            if let Some(subschema) = fields.get("propertyNames") {
+                let key = Node::String(name.clone());
+                if !self.is_valid(subschema, &key, path, refs) {
+                    let message = format!("property name {name:?} does not match propertyNames");
+                    out.push(violation(path, &at("propertyNames"), message));
+                }
+            }
+            path.pop();
+        }
+
+        for keyword in ["dependentSchemas", "dependencies"] {
+            let Some(Node::Object(dependencies)) = fields.get(keyword) else { continue };
+            for (name, subschema) in dependencies {
+                if members.contains_key(name) && !matches!(subschema, Node::Array(_)) {
+                    let location = format!("{}/{}", at(keyword), escape(name));
+                    self.check(
+                        subschema,
+                        &location,
+                        &Node::Object(members.clone()),
+                        path,
+                        refs,
+                        out,
+                    );
+                }
+            }
+        }
+    }
+}
+
+/// Checks the keywords that bound a single number, string, array, or object
+/// without looking into its members.
+fn check_bounds(
+    fields: &BTreeMap<String, Node>,
+    fail: &mut impl FnMut(&Path, &str, String),
+    instance: &Node,
+    path: &Path,
+) {
+    let number = |keyword: &str| match fields.get(keyword) {
+        Some(node @ Node::Number(bound)) => Some((bound.get(), show(node))),
+        _ => None,
+    };
+    let size = |keyword: &str| match fields.get(keyword) {
+        Some(Node::Number(bound)) if bound.get() >= 0.0 && is_integral(bound.get()) => {
+            Some(bound.get() as usize)
+        }
+        _ => None,
+    };
+    let mut check_size = |length: usize, (min, max): (&str, &str), unit: (&str, &str)| {
+        if let Some(minimum) = size(min).filter(|minimum| length < *minimum) {
+            fail(
+                path,
+                min,
+                format!("expected at least {}, found {length}", counted(minimum, unit)),
+            );
+        }
+        if let Some(maximum) = size(max).filter(|maximum| length > *maximum) {
+            fail(path, max, format!("expected at most {}, found {length}", counted(maximum, unit)));
+        }
+    };
+
+    match instance {
+        Node::Number(value) => {
+            let (value, shown) = (value.get(), show(instance));
+            if let Some((_, minimum)) = number("minimum").filter(|(minimum, _)| value < *minimum) {
+                fail(path, "minimum", format!("{shown} is less than the minimum of {minimum}"));
+            }
+            if let Some((_, maximum)) = number("maximum").filter(|(maximum, _)| value > *maximum) {
+                fail(path, "maximum", format!("{shown} is greater than the maximum of {maximum}"));
+            }
+            let exclusive = number("exclusiveMinimum").filter(|(minimum, _)| value <= *minimum);
+            if let Some((_, minimum)) = exclusive {
+                fail(path, "exclusiveMinimum", format!("{shown} is not greater than {minimum}"));
+            }
+            let exclusive = number("exclusiveMaximum").filter(|(maximum, _)| value >= *maximum);
+            if let Some((_, maximum)) = exclusive {
+                fail(path, "exclusiveMaximum", format!("{shown} is not less than {maximum}"));
+            }
+            if let Some((divisor, shown_divisor)) = number("multipleOf") {
+                let quotient = value / divisor;
+                if divisor > 0.0 && (quotient - round(quotient)).abs() > 1e-9 {
+                    fail(
+                        path,
+                        "multipleOf",
+                        format!("{shown} is not a multiple of {shown_divisor}"),
+                    );
+                }
+            }
+        }
+        Node::String(text) => {
+            let bounds = ("minLength", "maxLength");
+            check_size(text.chars().count(), bounds, ("character", "characters"));
+            // Patterns are checked by the caller, which holds the compiled
+            // regexes.
+        }
+        Node::Array(items) => {
+            check_size(items.len(), ("minItems", "maxItems"), ("item", "items"));
+            if fields.get("uniqueItems") == Some(&Node::Bool(true)) {
+                let duplicate =
+                    (1..items.len()).find(|&index| items[..index].contains(&items[index]));
+                if let Some(index) = duplicate {
+                    let mut element = path.clone();
+                    element.push(PathSegment::index(index as i64));
+                    let message = format!("{} appears more than once", show(&items[index]));
+                    fail(&element, "uniqueItems", message);
+                }
+            }
+        }
+        Node::Object(members) => {
+            let bounds = ("minProperties", "maxProperties");
+            check_size(members.len(), bounds, ("property", "properties"));
+            if let Some(Node::Array(required)) = fields.get("required") {
+                for name in required {
+                    if let Node::String(name) = name {
+                        if !members.contains_key(name) {
+                            fail(path, "required", format!("missing required property {name:?}"));
+                        }
+                    }
+                }
+            }
+            for keyword in ["dependentRequired", "dependencies"] {
+                let Some(Node::Object(dependencies)) = fields.get(keyword) else { continue };
+                for (name, needed) in dependencies {
+                    let Node::Array(needed) = needed else { continue };
+                    if !members.contains_key(name) {
+                        continue;
+                    }
+                    for other in needed {
+                        if let Node::String(other) = other {
+                            if !members.contains_key(other) {
+                                let message =
+                                    format!("property {name:?} requires property {other:?}");
+                                fail(path, keyword, message);
+                            }
+                        }
+                    }
+                }
+            }
+        }
+        _ => {}
+    }
+}
+
+/// Gathers every `pattern`, `patternProperties` key, and `$ref` in a schema.
+fn collect(schema: &Node, patterns: &mut Vec<String>, references: &mut Vec<String>) {
+    match schema {
+        Node::Object(fields) => {
+            for (keyword, value) in fields {
+                match (keyword.as_str(), value) {
+                    ("pattern", Node::String(pattern)) => patterns.push(pattern.clone()),
+                    ("$ref", Node::String(reference)) => references.push(reference.clone()),
+                    ("patternProperties", Node::Object(properties)) => {
+                        patterns.extend(properties.keys().cloned());
+                    }
+                    _ => {}
+                }
+                collect(value, patterns, references);
+            }
+        }
+        Node::Array(items) => {
+            for item in items {
+                collect(item, patterns, references);
+            }
+        }
+        _ => {}
+    }
+}
+
+fn violation(path: &Path, keyword: &str, message: String) -> SchemaViolation {
+    SchemaViolation { path: path.clone(), keyword: keyword.to_string(), message }
+}
+
+fn has_type(instance: &Node, name: &str) -> bool {
+    match (name, instance) {
+        ("null", Node::Null)
+        | ("boolean", Node::Bool(_))
+        | ("number", Node::Number(_))
+        | ("string", Node::String(_))
+        | ("array", Node::Array(_))
+        | ("object", Node::Object(_)) => true,
+        ("integer", Node::Number(number)) => is_integral(number.get()),
+        _ => false,
+    }
+}
+
+fn type_name(instance: &Node) -> &'static str {
+    match instance {
+        Node::Void => "nothing",
+        Node::Null => "null",
+        Node::Bool(_) => "boolean",
+        Node::Number(number) if is_integral(number.get()) => "integer",
+        Node::Number(_) => "number",
+        Node::String(_) => "string",
+        Node::Array(_) => "array",
+        Node::Object(_) => "object",
+    }
+}
+
+/// Renders a value as compact JSON for a message.
+fn show(value: &Node) -> String {
+    value.to_json_value().map(|value| value.to_string()).unwrap_or_default()
+}
+
+/// Formats `count` with the singular or plural form of `unit`.
+fn counted(count: usize, (one, many): (&str, &str)) -> String {
+    format!("{count} {}", if count == 1 { one } else { many })
+}
+
+/// Escapes a key as a JSON Pointer token.
+fn escape(token: &str) -> String {
+    token.replace('~', "~0").replace('/', "~1")
+}
+
+/// Decodes the `%XX` escapes a URI fragment may use.
+fn percent_decode(token: &str) -> String {
+    let bytes = token.as_bytes();
+    let mut decoded = Vec::with_capacity(bytes.len());
+    let mut index = 0;
+    while index < bytes.len() {
+        let hex = bytes.get(index + 1..index + 3).and_then(|hex| core::str::from_utf8(hex).ok());
+        match (bytes[index], hex.and_then(|hex| u8::from_str_radix(hex, 16).ok())) {
+            (b'%', Some(byte)) => {
+                decoded.push(byte);
+                index += 3;
+            }
+            (byte, _) => {
+                decoded.push(byte);
+                index += 1;
+            }
+        }
+    }
+    String::from_utf8_lossy(&decoded).into_owned()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn schema(text: &str) -> JsonSchema {
+        JsonSchema::from_json_str(text).unwrap()
+    }
+
+    fn messages(schema: &JsonSchema, document: &str) -> Vec<String> {
+        let document = Node::from_json_str(document).unwrap();
+        schema.violations(&document).iter().map(ToString::to_string).collect()
+    }
+
+    #[test]
+    fn references_resolve_within_the_schema() {
+        let schema = schema(
+            r##"{
+                "$defs": {"port": {"type": "integer", "minimum": 1, "maximum": 65535}},
+                "properties": {"ports": {"type": "array", "items": {"$ref": "#/$defs/port"}}}
+            }"##,
+        );
+        assert!(messages(&schema, r#"{"ports":[80,443]}"#).is_empty());
+        let document = Node::from_json_str(r#"{"ports":[80,70000]}"#).unwrap();
+        let violations = schema.violations(&document);
+        assert_eq!(violations.len(), 1);
+        assert_eq!(violations[0].keyword, "#/$defs/port/maximum");
+        assert_eq!(
+            violations[0].to_string(),
+            r#"["ports",1]: 70000 is greater than the maximum of 65535"#
+        );
+    }
+
+    #[test]
+    fn recursive_references_follow_the_document() {
+        let schema = schema(
+            r##"{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#"}}},"additionalProperties":false}"##,
+        );
+        assert!(messages(&schema, r#"{"children":[{"children":[]}]}"#).is_empty());
+        assert_eq!(
+            messages(&schema, r#"{"children":[{"name":"x"}]}"#),
+            [r#"["children",0,"name"]: property "name" is not allowed"#]
+        );
+    }
+
+    #[test]
+    fn unresolvable_references_are_rejected_up_front() {
+        let err = JsonSchema::from_json_str(r##"{"$ref":"#/$defs/missing"}"##).unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            r##"invalid schema: unsupported or unresolvable $ref "#/$defs/missing""##
+        );
+    }
+
+    #[test]
+    fn combinators_and_conditionals() {
+        let schema = schema(
+            r#"{
+                "oneOf": [{"type": "string"}, {"type": "integer"}],
+                "not": {"const": 0},
+                "if": {"type": "string"}, "then": {"minLength": 2}, "else": {"minimum": -5}
+            }"#,
+        );
+        assert!(messages(&schema, r#""ab""#).is_empty());
+        assert_eq!(messages(&schema, r#""a""#), ["[]: expected at least 2 characters, found 1"]);
+        assert_eq!(messages(&schema, "0"), ["[]: matches the schema in not"]);
+        assert_eq!(
+            messages(&schema, "-6.5"),
+            [
+                "[]: matches 0 schemas in oneOf instead of exactly 1",
+                "[]: -6.5 is less than the minimum of -5"
+            ]
+        );
+    }
+
+    #[test]
+    fn tuples_in_both_spellings() {
+        let draft7 =
+            schema(r#"{"items":[{"type":"string"}],"additionalItems":{"type":"integer"}}"#);
+        let draft2020 = schema(r#"{"prefixItems":[{"type":"string"}],"items":{"type":"integer"}}"#);
+        for schema in [draft7, draft2020] {
+            assert!(messages(&schema, r#"["a",1,2]"#).is_empty());
+            assert_eq!(
+                messages(&schema, r#"["a","b"]"#),
+                [r#"[1]: expected integer, found string"#]
+            );
+        }
+    }
+
+    #[test]
+    fn object_keywords() {
+        let schema = schema(
+            r#"{
+                "patternProperties": {"^x-": true},
+                "additionalProperties": {"type": "string"},
+                "propertyNames": {"maxLength": 5},
+                "dependentRequired": {"a": ["b"]},
+                "maxProperties": 3
+            }"#,
+        );
+        assert!(messages(&schema, r#"{"x-1":1,"a":"","b":""}"#).is_empty());
+        assert_eq!(
+            messages(&schema, r#"{"a":"","toolong":1}"#),
+            [
+                r#"[]: property "a" requires property "b""#,
+                r#"["toolong"]: expected string, found integer"#,
+                r#"["toolong"]: property name "toolong" does not match propertyNames"#,
+            ]
+        );
+    }
+
+    #[test]
+    fn arrays_report_duplicates_and_contains() {
+        let schema = schema(r#"{"uniqueItems":true,"contains":{"const":1},"maxContains":1}"#);
+        assert!(messages(&schema, "[1,2]").is_empty());
+        assert_eq!(
+            messages(&schema, "[2,1,1]"),
+            [
+                "[2]: 1 appears more than once",
+                "[]: expected at most 1 item matching contains, found 2"
+            ]
+        );
+        assert_eq!(
+            messages(&schema, "[2]"),
+            ["[]: expected at least 1 item matching contains, found 0"]
+        );
+    }
+
+    #[test]
+    fn integers_include_integral_floats() {
+        let schema = schema(r#"{"type":"integer","multipleOf":0.5}"#);
+        assert!(messages(&schema, "2.0").is_empty());
+        assert_eq!(messages(&schema, "2.5"), ["[]: expected integer, found number"]);
+    }
+}
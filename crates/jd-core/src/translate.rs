@@ -0,0 +1,224 @@
+//! Translation between diff and document formats, backing `jd -t`.
+//!
+//! Each [`Translation`] reads its input in one format and renders it in
+//! another without diffing anything, mirroring the Go CLI's translate mode.
+
+use core::fmt;
+use core::str::FromStr;
+
+use crate::prelude::*;
+use crate::{CanonicalizeError, Diff, DiffParseError, RenderConfig, RenderError};
+
+/// Errors produced while translating between formats.
+///
+/// ```
+/// # use jd_core::Translation;
+/// let err = "jd2xml".parse::<Translation>().unwrap_err();
+/// assert_eq!(err.to_string(), "unsupported translation: \"jd2xml\"");
+/// ```
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TranslateError {
+    message: String,
+}
+
+impl TranslateError {
+    pub(crate) fn new(message: impl Into<String>) -> Self {
+        Self { message: message.into() }
+    }
+}
+
+impl fmt::Display for TranslateError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(&self.message)
+    }
+}
+
+impl core::error::Error for TranslateError {}
+
+impl From<DiffParseError> for TranslateError {
+    fn from(err: DiffParseError) -> Self {
+        Self::new(err.to_string())
+    }
+}
+
+impl From<RenderError> for TranslateError {
+    fn from(err: RenderError) -> Self {
+        Self::new(err.to_string())
+    }
+}
+
+impl From<CanonicalizeError> for TranslateError {
+    fn from(err: CanonicalizeError) -> Self {
+        Self::new(err.to_string())
+    }
+}
+
+/// A `jd -t` translation, named `<from>2<to>` like the Go CLI.
+///
+/// ```
+/// # use jd_core::Translation;
+/// let translation: Translation = "jd2patch".parse().expect("known translation");
+/// let patch = translation.apply("@ [\"a\"]\n+ 1\n").expect("valid diff");
+/// assert_eq!(patch, r#"[{"op":"add","path":"/a","value":1}]"#);
+/// ```
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Translation {
+    /// Native jd diff to JSON Patch (RFC 6902).
+    JdToPatch,
+    /// JSON Patch (RFC 6902) to native jd diff.
+    PatchToJd,
+    /// Native jd merge diff to JSON Merge Patch (RFC 7386).
+    JdToMerge,
+    /// JSON Merge Patch (RFC 7386) to native jd merge diff.
+    MergeToJd,
+    /// YAML document to compact JSON.
+    YamlToJson,
+    /// JSON document to YAML.
+    JsonToYaml,
+    /// jd v1 native diff to native jd diff. Not in the Go CLI.
+    JdV1ToJd,
+    /// Native jd diff to jd v1 native diff. Not in the Go CLI.
+    JdToJdV1,
+}
+
+impl Translation {
+    /// Translates `input`, returning the rendered output.
+    ///
+    /// Diff outputs use the same renderers as diff mode; document outputs
+    /// match patch mode (compact JSON, or YAML via [`Node::to_yaml_string`](crate::Node::to_yaml_string)).
+    ///
+    /// ```
+    /// # use jd_core::Translation;
+    /// let diff = Translation::MergeToJd.apply(r#"{"a":null}"#).expect("valid merge patch");
+    /// assert_eq!(diff, "^ {\"Merge\":true}\n@ [\"a\"]\n+\n");
+    /// let json = Translation::YamlToJson.apply("b: 1\na:\n- x\n").expect("valid YAML");
+    /// assert_eq!(json, r#"{"a":["x"],"b":1}"#);
+    /// ```
+    pub fn apply(self, input: &str) -> Result<String, TranslateError> {
+        let config = RenderConfig::default();
+        match self {
+            Self::JdToPatch => Ok(Diff::from_native_str(input)?.render_patch()?),
+            Self::PatchToJd => Ok(Diff::from_json_patch_str(input)?.render(&config)),
+            Self::JdToMerge => Ok(Diff::from_native_str(input)?.render_merge()?),
+            Self::MergeToJd => Ok(Diff::from_merge_patch_str(input)?.render(&config)),
+            #[cfg(feature = "yaml")]
+            Self::YamlToJson => {
+                let node = crate::Node::from_yaml_str(input)?;
+                Ok(node.to_json_value().map(|value| value.to_string()).unwrap_or_default())
+            }
+            #[cfg(not(feature = "yaml"))]
+            Self::YamlToJson => Err(TranslateError::new("yaml2json requires the yaml feature")),
+            Self::JsonToYaml => {
+                Ok(crate::Node::from_json_str(input)?.to_yaml_string().unwrap_or_default())
+            }
+            Self::JdV1ToJd => Ok(Diff::from_native_v1_str(input)?.render(&config)),
+            Self::JdToJdV1 => Ok(Diff::from_native_str(input)?.render_v1()?),
+        }
+    }
+
+    /// Returns the `jd -t` name of the translation (for example `jd2patch`).
+    ///
+    /// ```
+    /// # use jd_core::Translation;
+    /// assert_eq!(Translation::MergeToJd.name(), "merge2jd");
+    /// ```
+    #[must_use]
+    pub fn name(self) -> &'static str {
+        match self {
+            Self::JdToPatch => "jd2patch",
+            Self::PatchToJd => "patch2jd",
+            Self::JdToMerge => "jd2merge",
+            Self::MergeToJd => "merge2jd",
+            Self::YamlToJson => "yaml2json",
+            Self::JsonToYaml => "json2yaml",
+            Self::JdV1ToJd => "jd12jd",
+            Self::JdToJdV1 => "jd2jd1",
+        }
+    }
+}
+
+impl FromStr for Translation {
+    type Err = TranslateError;
+
+    fn from_str(name: &str) -> Result<Self, Self::Err> {
+        const ALL: [Translation; 8] = [
+            Translation::JdToPatch,
+            Translation::PatchToJd,
+            Translation::JdToMerge,
+            Translation::MergeToJd,
+            Translation::YamlToJson,
+            Translation::JsonToYaml,
+            Translation::JdV1ToJd,
+            Translation::JdToJdV1,
+        ];
+        ALL.into_iter()
+            .find(|translation| translation.name() == name)
+            .ok_or_else(|| TranslateError::new(format!("unsupported translation: {name:?}")))
+    }
+}
+
+impl fmt::Display for Translation {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.name())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn names_round_trip() {
+        for name in [
+            "jd2patch",
+            "patch2jd",
+            "jd2merge",
+            "merge2jd",
+            "yaml2json",
+            "json2yaml",
+            "jd12jd",
+            "jd2jd1",
+        ] {
+            assert_eq!(name.parse::<Translation>().unwrap().to_string(), name);
+        }
+        assert!("patch2merge".parse::<Translation>().is_err());
+    }
+
+    #[test]
+    fn jd_and_patch_translate_both_ways() {
+        let diff = "@ [\"items\",1]\n  \"a\"\n- \"b\"\n+ \"c\"\n]\n@ [\"note\"]\n+ \"new\"\n";
+        let patch = Translation::JdToPatch.apply(diff).unwrap();
+        assert_eq!(
+            patch,
+            r#"[{"op":"test","path":"/items/0","value":"a"},{"op":"test","path":"/items/1","value":"b"},{"op":"remove","path":"/items/1","value":"b"},{"op":"add","path":"/items/1","value":"c"},{"op":"add","path":"/note","value":"new"}]"#
+        );
+        assert_eq!(Translation::PatchToJd.apply(&patch).unwrap(), diff);
+    }
+
+    #[test]
+    fn jd_to_merge_requires_merge_hunks() {
+        let merge =
+            Translation::JdToMerge.apply("^ {\"Merge\":true}\n@ [\"a\",\"b\"]\n+\n").unwrap();
+        assert_eq!(merge, r#"{"a":{"b":null}}"#);
+        let err = Translation::JdToMerge.apply("@ [\"a\"]\n+ 1\n").unwrap_err();
+        assert_eq!(err.to_string(), "cannot render non-merge element as merge");
+    }
+
+    #[test]
+    fn jd_v1_and_v2_translate_both_ways() {
+        let v2 = "@ [\"items\",1]\n  \"a\"\n- \"b\"\n+ \"c\"\n]\n";
+        let v1 = Translation::JdToJdV1.apply(v2).unwrap();
+        assert_eq!(v1, "@ [\"items\",1]\n- \"b\"\n+ \"c\"\n");
+        assert_eq!(Translation::JdV1ToJd.apply(&v1).unwrap(), v1);
+        let err = Translation::JdV1ToJd.apply(v2).unwrap_err();
+        assert!(err.to_string().starts_with("invalid diff at line 2:"));
+    }
+
+    #[test]
+    fn reports_input_errors() {
+        let err = Translation::JdToPatch.apply("- 1\n").unwrap_err();
+        assert!(err.to_string().starts_with("invalid diff at line 1:"));
+        let err = Translation::JsonToYaml.apply("{").unwrap_err();
+        assert!(err.to_string().starts_with("invalid JSON:"));
+    }
+}
@@ -0,0 +1,716 @@
+//! YAML rendering that mirrors Go jd's `Yaml()` output.
+//!
+//! Go jd marshals nodes with `gopkg.in/yaml.v2`, so this emitter reproduces
+//! that library's block layout rather than delegating to `serde_yaml`:
+//!
+//! * mapping keys use yaml.v2's natural ordering (letters after other
+//!   characters, digit runs compared numerically);
+//! * sequences nested in mappings are not indented, and empty collections use
+//!   flow style (`[]`, `{}`);
+//! * numbers are formatted like `strconv.FormatFloat(f, 'g', -1, 64)`, so
+//!   `1000000` becomes `1e+06`;
+//! * strings stay plain unless they would resolve to another type or contain
+//!   indicators, in which case they are single- or double-quoted;
+//! * long scalars are folded at spaces once a line passes 80 columns.
+
+use alloc::collections::BTreeMap;
+
+use crate::prelude::*;
+use crate::{KeyOrder, Node};
+
+const BEST_WIDTH: usize = 80;
+const BEST_INDENT: usize = 2;
+
+/// Renders `node` as a YAML document with mapping keys in `order`, returning
+/// `None` when it contains [`Node::Void`].
+pub(crate) fn render(node: &Node, order: &KeyOrder) -> Option<String> {
+    let mut emitter = Emitter::default();
+    match node {
+        Node::Void => return None,
+        Node::Object(map) if !map.is_empty() => emitter.mapping(map, order, 0, false)?,
+        Node::Array(values) if !values.is_empty() => emitter.sequence(values, order, 0, false)?,
+        scalar => {
+            emitter.scalar(scalar, 0, true)?;
+            emitter.newline();
+        }
+    }
+    Some(emitter.output)
+}
+
+#[derive(Default)]
+struct Emitter {
+    output: String,
+    column: usize,
+}
+
+impl Emitter {
+    fn mapping(
+        &mut self,
+        map: &BTreeMap<String, Node>,
+        order: &KeyOrder,
+        indent: usize,
+        inline: bool,
+    ) -> Option<()> {
+        let entries = order.arrange(map, sorted_entries(map));
+        for (position, (key, value)) in entries.into_iter().enumerate() {
+            if position > 0 || !inline {
+                self.pad(indent);
+            }
+            self.string(key, indent, false);
+            self.push(":");
+            match value {
+                Node::Object(child) if !child.is_empty() => {
+                    self.newline();
+                    self.mapping(child, order.field(key), indent + BEST_INDENT, false)?;
+                }
+                Node::Array(child) if !child.is_empty() => {
+                    self.newline();
+                    self.sequence(child, order.field(key), indent, false)?;
+                }
+                scalar => {
+                    self.push(" ");
+                    self.scalar(scalar, indent + BEST_INDENT, true)?;
+                    self.newline();
+                }
+            }
+        }
+        Some(())
+    }
+
+    fn sequence(
+        &mut self,
+        values: &[Node],
+        order: &KeyOrder,
+        indent: usize,
+        inline: bool,
+    ) -> Option<()> {
+        for (position, value) in values.iter().enumerate() {
+            if position > 0 || !inline {
+                self.pad(indent);
+            }
+            self.push("- ");
+            match value {
+                Node::Object(child) if !child.is_empty() => {
+                    self.mapping(child, order.item(position), indent + BEST_INDENT, true)?;
+                }
+                Node::Array(child) if !child.is_empty() => {
+                    self.sequence(child, order.item(position), indent + BEST_INDENT, true)?;
+                }
+                scalar => {
+                    self.scalar(scalar, indent + BEST_INDENT, true)?;
+                    self.newline();
+                }
+            }
+        }
+        Some(())
+    }
+
+    /// Writes a scalar or empty collection. `indent` is where folded
+    /// continuation lines start.
+    fn scalar(&mut self, node: &Node, indent: usize, allow_breaks: bool) -> Option<()> {
+        match node {
+            Node::Void => return None,
+            Node::Null => self.push("null"),
+            Node::Bool(value) => self.push(if *value { "true" } else { "false" }),
+            Node::Number(number) => match number.literal() {
+                Some(literal) => self.push(literal),
+                None => self.push(&format_float(number.get())),
+            },
+            Node::String(value) => self.string(value, indent, allow_breaks),
+            Node::Array(_) => self.push("[]"),
+            Node::Object(_) => self.push("{}"),
+        }
+        Some(())
+    }
+
+    fn string(&mut self, value: &str, indent: usize, allow_breaks: bool) {
+        match ScalarStyle::for_string(value, allow_breaks) {
+            ScalarStyle::Plain => self.plain(value, indent, allow_breaks),
+            ScalarStyle::SingleQuoted => self.single_quoted(value, indent, allow_breaks),
+            ScalarStyle::DoubleQuoted => self.double_quoted(value, indent, allow_breaks),
+        }
+    }
+
+    fn plain(&mut self, value: &str, indent: usize, allow_breaks: bool) {
+        let chars: Vec<char> = value.chars().collect();
+        let mut spaces = false;
+        for (index, &ch) in chars.iter().enumerate() {
+            if ch == ' ' {
+                if allow_breaks
+                    && !spaces
+                    && self.column > BEST_WIDTH
+                    && chars.get(index + 1) != Some(&' ')
+                {
+                    self.fold(indent);
+                } else {
+                    self.push_char(ch);
+                }
+                spaces = true;
+            } else {
+                self.push_char(ch);
+                spaces = false;
+            }
+        }
+    }
+
+    fn single_quoted(&mut self, value: &str, indent: usize, allow_breaks: bool) {
+        let chars: Vec<char> = value.chars().collect();
+        let last = chars.len().saturating_sub(1);
+        let mut spaces = false;
+        let mut breaks = false;
+        self.push_char('\'');
+        for (index, &ch) in chars.iter().enumerate() {
+            if ch == ' ' {
+                if allow_breaks
+                    && !spaces
+                    && self.column > BEST_WIDTH
+                    && index != 0
+                    && index != last
+                    && chars.get(index + 1) != Some(&' ')
+                {
+                    self.fold(indent);
+                } else {
+                    self.push_char(ch);
+                }
+                spaces = true;
+            } else if ch == '\n' {
+                // A single line break folds to a space, so each one is doubled.
+                if !breaks {
+                    self.newline();
+                }
+                self.newline();
+                breaks = true;
+            } else {
+                if breaks {
+                    self.pad(indent);
+                }
+                if ch == '\'' {
+                    self.push_char('\'');
+                }
+                self.push_char(ch);
+                spaces = false;
+                breaks = false;
+            }
+        }
+        self.push_char('\'');
+    }
+
+    fn double_quoted(&mut self, value: &str, indent: usize, allow_breaks: bool) {
+        let chars: Vec<char> = value.chars().collect();
+        let last = chars.len().saturating_sub(1);
+        let mut spaces = false;
+        self.push_char('"');
+        for (index, &ch) in chars.iter().enumerate() {
+            if !is_printable(ch) || ch == '\u{feff}' || ch == '\n' || ch == '"' || ch == '\\' {
+                self.push(&escape(ch));
+                spaces = false;
+            } else if ch == ' ' {
+                if allow_breaks
+                    && !spaces
+                    && self.column > BEST_WIDTH
+                    && index != 0
+                    && index != last
+                {
+                    self.fold(indent);
+                    if chars.get(index + 1) == Some(&' ') {
+                        self.push_char('\\');
+                    }
+                } else {
+                    self.push_char(ch);
+                }
+                spaces = true;
+            } else {
+                self.push_char(ch);
+                spaces = false;
+            }
+        }
+        self.push_char('"');
+    }
+
+    fn fold(&mut self, indent: usize) {
+        self.newline();
+        self.pad(indent);
+    }
+
+    fn pad(&mut self, indent: usize) {
+        while self.column < indent {
+            self.push_char(' ');
+        }
+    }
+
+    fn newline(&mut self) {
+        self.output.push('\n');
+        self.column = 0;
+    }
+
+    fn push(&mut self, text: &str) {
+        text.chars().for_each(|ch| self.push_char(ch));
+    }
+
+    fn push_char(&mut self, ch: char) {
+        self.output.push(ch);
+        self.column += 1;
+    }
+}
+
+#[derive(Debug, PartialEq, Eq)]
+enum ScalarStyle {
+    Plain,
+    SingleQuoted,
+    DoubleQuoted,
+}
+
+impl ScalarStyle {
+    /// Chooses a style the way yaml.v2's encoder and emitter do together.
+    fn for_string(value: &str, allow_breaks: bool) -> Self {
+        if !resolves_to_string(value) || is_base60_float(value) {
+            return Self::DoubleQuoted;
+        }
+        let analysis = Analysis::of(value);
+        if analysis.special || analysis.space_break || analysis.break_space {
+            return Self::DoubleQuoted;
+        }
+        if analysis.line_breaks && !allow_breaks {
+            // Multi-line mapping keys cannot be simple keys; quoting them keeps
+            // the output a plain block mapping.
+            return Self::DoubleQuoted;
+        }
+        if analysis.plain_allowed() {
+            Self::Plain
+        } else {
+            Self::SingleQuoted
+        }
+    }
+}
+
+/// The subset of `yaml_emitter_analyze_scalar` that affects block output.
+#[derive(Default)]
+struct Analysis {
+    indicators: bool,
+    edge_whitespace: bool,
+    line_breaks: bool,
+    special: bool,
+    space_break: bool,
+    break_space: bool,
+}
+
+impl Analysis {
+    fn of(value: &str) -> Self {
+        let chars: Vec<char> = value.chars().collect();
+        let mut analysis = Self::default();
+        if value.starts_with("---") || value.starts_with("...") {
+            analysis.indicators = true;
+        }
+        let is_blank = |index: usize| matches!(chars.get(index), None | Some(' ' | '\t' | '\n'));
+        let mut previous_space = false;
+        let mut previous_break = false;
+        for (index, &ch) in chars.iter().enumerate() {
+            let followed_by_whitespace = is_blank(index + 1);
+            if index == 0 {
+                match ch {
+                    '#' | ',' | '[' | ']' | '{' | '}' | '&' | '*' | '!' | '|' | '>' | '\''
+                    | '"' | '%' | '@' | '`' => analysis.indicators = true,
+                    '?' | ':' | '-' if followed_by_whitespace => analysis.indicators = true,
+                    _ => {}
+                }
+            } else {
+                match ch {
+                    ':' if followed_by_whitespace => analysis.indicators = true,
+                    '#' if is_blank(index - 1) => analysis.indicators = true,
+                    _ => {}
+                }
+            }
+            if !is_printable(ch) || ch == '\u{feff}' {
+                analysis.special = true;
+            }
+            if ch == '\n' {
+                analysis.line_breaks = true;
+            }
+            if matches!(ch, ' ' | '\n') && (index == 0 || index + 1 == chars.len()) {
+                analysis.edge_whitespace = true;
+            }
+            if ch == ' ' {
+                if previous_break {
+                    analysis.break_space = true;
+                }
+                previous_space = true;
+                previous_break = false;
+            } else if ch == '\n' {
+                if previous_space {
+                    analysis.space_break = true;
+                }
+                previous_space = false;
+                previous_break = true;
+            } else {
+                previous_space = false;
+                previous_break = false;
+            }
+        }
+        analysis
+    }
+
+    fn plain_allowed(&self) -> bool {
+        !(self.indicators || self.edge_whitespace || self.line_breaks)
+    }
+}
+
+fn is_printable(ch: char) -> bool {
+    matches!(ch, '\n' | '\u{20}'..='\u{7e}' | '\u{a0}'..='\u{d7ff}' | '\u{e000}'..='\u{fffd}')
+}
+
+fn escape(ch: char) -> String {
+    let short = match ch {
+        '\0' => '0',
+        '\u{7}' => 'a',
+        '\u{8}' => 'b',
+        '\t' => 't',
+        '\n' => 'n',
+        '\u{b}' => 'v',
+        '\u{c}' => 'f',
+        '\r' => 'r',
+        '\u{1b}' => 'e',
+        '"' => '"',
+        '\\' => '\\',
+        '\u{85}' => 'N',
+        '\u{a0}' => '_',
+        '\u{2028}' => 'L',
+        '\u{2029}' => 'P',
+        _ => {
+            let code = u32::from(ch);
+            return match code {
+                0..=0xff => format!("\\x{code:02X}"),
+                0x100..=0xffff => format!("\\u{code:04X}"),
+                _ => format!("\\U{code:08X}"),
+            };
+        }
+    };
+    format!("\\{short}")
+}
+
+/// Reports whether yaml.v2 would read `value` back as a string when unquoted.
+fn resolves_to_string(value: &str) -> bool {
+    const SPECIAL: &[&str] = &[
+        "", "~", "null", "Null", "NULL", "y", "Y", "yes", "Yes", "YES", "on", "On", "ON", "true",
+        "True", "TRUE", "n", "N", "no", "No", "NO", "off", "Off", "OFF", "false", "False", "FALSE",
+        ".nan", ".NaN", ".NAN", ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF", "-.inf",
+        "-.Inf", "-.INF",
+    ];
+    if SPECIAL.contains(&value) {
+        return false;
+    }
+    match value.chars().next() {
+        Some('.') => !is_yaml_float(value),
+        Some('0'..='9' | '+' | '-') => {
+            let plain = value.replace('_', "");
+            !(is_go_int(&plain) || is_yaml_float(&plain) || is_timestamp(value))
+        }
+        _ => true,
+    }
+}
+
+/// Mirrors Go's `strconv.ParseInt(s, 0, 64)` / `ParseUint(s, 0, 64)`.
+fn is_go_int(value: &str) -> bool {
+    let (negative, digits) = match value.as_bytes().first() {
+        Some(b'-') => (true, &value[1..]),
+        Some(b'+') => (false, &value[1..]),
+        _ => (false, value),
+    };
+    let lower = digits.to_ascii_lowercase();
+    let (radix, body) = if let Some(rest) = lower.strip_prefix("0x") {
+        (16, rest)
+    } else if let Some(rest) = lower.strip_prefix("0b") {
+        (2, rest)
+    } else if let Some(rest) = lower.strip_prefix("0o") {
+        (8, rest)
+    } else if lower.len() > 1 && lower.starts_with('0') {
+        (8, &lower[1..])
+    } else {
+        (10, lower.as_str())
+    };
+    if body.is_empty() || !body.chars().all(|ch| ch.is_digit(radix)) {
+        return false;
+    }
+    match u128::from_str_radix(body, radix) {
+        Ok(magnitude) if negative => magnitude <= 1 << 63,
+        Ok(magnitude) => magnitude <= u128::from(u64::MAX),
+        Err(_) => false,
+    }
+}
+
+/// Matches `^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`.
+fn is_yaml_float(value: &str) -> bool {
+    let value = value.strip_prefix(['-', '+']).unwrap_or(value);
+    let (mantissa, exponent) = match value.find(['e', 'E']) {
+        Some(index) => (&value[..index], Some(&value[index + 1..])),
+        None => (value, None),
+    };
+    let all_digits = |text: &str| !text.is_empty() && text.bytes().all(|b| b.is_ascii_digit());
+    let mantissa_ok = match mantissa.split_once('.') {
+        Some(("", fraction)) => all_digits(fraction),
+        Some((whole, fraction)) => {
+            all_digits(whole) && fraction.bytes().all(|b| b.is_ascii_digit())
+        }
+        None => all_digits(mantissa),
+    };
+    let exponent_ok = exponent
+        .is_none_or(|exponent| all_digits(exponent.strip_prefix(['-', '+']).unwrap_or(exponent)));
+    mantissa_ok && exponent_ok
+}
+
+/// Matches `^[-+]?[0-9][0-9_]*(?::[0-5]?[0-9])+(?:\.[0-9_]*)?$`.
+fn is_base60_float(value: &str) -> bool {
+    let value = value.strip_prefix(['-', '+']).unwrap_or(value);
+    let (value, fraction) = match value.split_once('.') {
+        Some((value, fraction)) => (value, Some(fraction)),
+        None => (value, None),
+    };
+    if fraction.is_some_and(|fraction| !fraction.bytes().all(|b| b.is_ascii_digit() || b == b'_')) {
+        return false;
+    }
+    let mut parts = value.split(':');
+    let head = parts.next().unwrap_or_default();
+    let head_ok = head.as_bytes().first().is_some_and(u8::is_ascii_digit)
+        && head.bytes().all(|b| b.is_ascii_digit() || b == b'_');
+    let mut sexagesimal = parts.peekable();
+    if !head_ok || sexagesimal.peek().is_none() {
+        return false;
+    }
+    sexagesimal.all(|part| match part.as_bytes() {
+        [digit] => digit.is_ascii_digit(),
+        [tens, digit] => (b'0'..=b'5').contains(tens) && digit.is_ascii_digit(),
+        _ => false,
+    })
+}
+
+/// Recognises the `YYYY-M-D` prefix that yaml.v2 resolves as a timestamp,
+/// optionally followed by a time.
+fn is_timestamp(value: &str) -> bool {
+    let bytes = value.as_bytes();
+    if bytes.len() < 8 || !bytes[..4].iter().all(u8::is_ascii_digit) || bytes[4] != b'-' {
+        return false;
+    }
+    let Some((month, tail)) = value[5..].split_once('-') else {
+        return false;
+    };
+    let day_len = tail.bytes().take_while(u8::is_ascii_digit).count();
+    let short_number =
+        |text: &str| (1..=2).contains(&text.len()) && text.bytes().all(|b| b.is_ascii_digit());
+    if !short_number(month) || !(1..=2).contains(&day_len) {
+        return false;
+    }
+    match &tail.as_bytes()[day_len..] {
+        [] => true,
+        [b'T' | b't' | b' ', time @ ..] => {
+            time.first().is_some_and(u8::is_ascii_digit) && time.contains(&b':')
+        }
+        _ => false,
+    }
+}
+
+/// Formats like Go's `strconv.FormatFloat(value, 'g', -1, 64)`.
+fn format_float(value: f64) -> String {
+    if value == 0.0 {
+        return if value.is_sign_negative() { "-0" } else { "0" }.to_string();
+    }
+    let scientific = format!("{value:e}");
+    let (mantissa, exponent) = scientific.split_once('e').expect("scientific notation");
+    let exponent: i32 = exponent.parse().expect("integer exponent");
+    let sign = if value.is_sign_negative() { "-" } else { "" };
+    let digits: String = mantissa.chars().filter(char::is_ascii_digit).collect();
+
+    if !(-4..6).contains(&exponent) {
+        let (first, rest) = digits.split_at(1);
+        let fraction = if rest.is_empty() { String::new() } else { format!(".{rest}") };
+        let exponent_sign = if exponent < 0 { '-' } else { '+' };
+        return format!("{sign}{first}{fraction}e{exponent_sign}{:02}", exponent.abs());
+    }
+    if exponent < 0 {
+        let zeros = "0".repeat((-exponent - 1) as usize);
+        return format!("{sign}0.{zeros}{digits}");
+    }
+    let whole_len = exponent as usize + 1;
+    if digits.len() <= whole_len {
+        format!("{sign}{digits:0<whole_len$}")
+    } else {
+        let (whole, fraction) = digits.split_at(whole_len);
+        format!("{sign}{whole}.{fraction}")
+    }
+}
+
+/// Sorts keys with yaml.v2's `keyList.Less`, inserting one key at a time so
+/// that an inconsistent comparison can never panic.
+fn sorted_entries(map: &BTreeMap<String, Node>) -> Vec<(&String, &Node)> {
+    let mut entries: Vec<(&String, &Node)> = Vec::with_capacity(map.len());
+    for entry in map {
+        let position = entries.partition_point(|(key, _)| !key_less(entry.0, key));
+        entries.insert(position, entry);
+    }
+    entries
+}
+
+fn key_less(lhs: &str, rhs: &str) -> bool {
+    let left: Vec<char> = lhs.chars().collect();
+    let right: Vec<char> = rhs.chars().collect();
+    for index in 0..left.len().min(right.len()) {
+        let (a, b) = (left[index], right[index]);
+        if a == b {
+            continue;
+        }
+        let (a_letter, b_letter) = (a.is_alphabetic(), b.is_alphabetic());
+        if a_letter && b_letter {
+            return a < b;
+        }
+        if a_letter || b_letter {
+            return b_letter;
+        }
+        let (mut a_number, mut b_number) = (0i64, 0i64);
+        if a == '0' || b == '0' {
+            let nonzero_prefix = left[..index]
+                .iter()
+                .rev()
+                .take_while(|ch| ch.is_ascii_digit())
+                .any(|&ch| ch != '0');
+            if nonzero_prefix {
+                (a_number, b_number) = (1, 1);
+            }
+        }
+        let a_end = digit_run(&left, index, &mut a_number);
+        let b_end = digit_run(&right, index, &mut b_number);
+        if a_number != b_number {
+            return a_number < b_number;
+        }
+        if a_end != b_end {
+            return a_end < b_end;
+        }
+        return a < b;
+    }
+    left.len() < right.len()
+}
+
+fn digit_run(chars: &[char], start: usize, number: &mut i64) -> usize {
+    let mut end = start;
+    while let Some(digit) = chars.get(end).and_then(|ch| ch.to_digit(10)) {
+        *number = number.wrapping_mul(10).wrapping_add(i64::from(digit));
+        end += 1;
+    }
+    end
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn yaml(json: &str) -> String {
+        render(&Node::from_json_str(json).unwrap(), &KeyOrder::default()).unwrap()
+    }
+
+    #[test]
+    fn renders_block_collections_like_yaml_v2() {
+        let rendered = yaml(r#"{"b":[1,{"c":true,"d":[]}],"a":{"x":null,"y":{}},"e":[[1,2]]}"#);
+        assert_eq!(
+            rendered,
+            "a:\n  x: null\n  \"y\": {}\nb:\n- 1\n- c: true\n  d: []\ne:\n- - 1\n  - 2\n"
+        );
+        assert_eq!(yaml("[]"), "[]\n");
+        assert_eq!(yaml(r#""text""#), "text\n");
+        assert!(render(&Node::Void, &KeyOrder::default()).is_none());
+    }
+
+    #[test]
+    fn sorts_keys_naturally() {
+        assert_eq!(
+            yaml(r#"{"a10":1,"a2":2,"B":3,"_":4,"a":5}"#),
+            "_: 4\nB: 3\na: 5\na2: 2\na10: 1\n"
+        );
+    }
+
+    #[test]
+    fn recorded_key_order_wins_over_sorting() {
+        let text = "spec:\n  b: 1\n  a:\n  - z: 1\n    y: 2\nkind: Pod\n";
+        let order = KeyOrder::from_yaml_str(text).unwrap();
+        let Node::Object(mut map) = Node::from_yaml_str(text).unwrap() else { panic!() };
+        map.insert("api".into(), Node::String("v1".into()));
+        let rendered = render(&Node::Object(map), &order).unwrap();
+        assert_eq!(rendered, "spec:\n  b: 1\n  a:\n  - z: 1\n    \"y\": 2\nkind: Pod\napi: v1\n");
+    }
+
+    #[test]
+    fn formats_numbers_like_go() {
+        let cases = [
+            (0.0, "0"),
+            (1.0, "1"),
+            (-2.5, "-2.5"),
+            (123_456.0, "123456"),
+            (1_000_000.0, "1e+06"),
+            (1_234_567.0, "1.234567e+06"),
+            (0.0001, "0.0001"),
+            (0.000_01, "1e-05"),
+            (1e21, "1e+21"),
+            (0.1 + 0.2, "0.30000000000000004"),
+        ];
+        for (value, expected) in cases {
+            assert_eq!(format_float(value), expected, "{value}");
+        }
+    }
+
+    #[test]
+    fn quotes_strings_that_would_change_type() {
+        let cases = [
+            ("plain", "plain"),
+            ("", "\"\""),
+            ("true", "\"true\""),
+            ("yes", "\"yes\""),
+            ("null", "\"null\""),
+            ("1", "\"1\""),
+            ("1_000", "\"1_000\""),
+            ("0x1F", "\"0x1F\""),
+            ("1.5e3", "\"1.5e3\""),
+            (".5", "\".5\""),
+            ("12:30", "\"12:30\""),
+            ("2001-12-14", "\"2001-12-14\""),
+            ("1.2.3", "1.2.3"),
+            ("+inf", "+inf"),
+        ];
+        for (value, expected) in cases {
+            assert_eq!(yaml(&serde_json::to_string(value).unwrap()), format!("{expected}\n"));
+        }
+    }
+
+    #[test]
+    fn quotes_strings_with_indicators() {
+        let cases = [
+            ("a: b", "'a: b'"),
+            ("a:b", "a:b"),
+            ("- item", "'- item'"),
+            ("-item", "-item"),
+            ("#tag", "'#tag'"),
+            ("a #b", "'a #b'"),
+            ("a#b", "a#b"),
+            ("it's", "it's"),
+            ("'quoted'", "'''quoted'''"),
+            (" padded", "' padded'"),
+            ("---", "'---'"),
+            ("tab\there", "\"tab\\there\""),
+            ("emoji 😀", "\"emoji \\U0001F600\""),
+            ("café", "café"),
+        ];
+        for (value, expected) in cases {
+            assert_eq!(yaml(&serde_json::to_string(value).unwrap()), format!("{expected}\n"));
+        }
+        assert_eq!(yaml(r#"{"true":1,"a b":2}"#), "a b: 2\n\"true\": 1\n");
+    }
+
+    #[test]
+    fn folds_multiline_strings_in_single_quotes() {
+        assert_eq!(yaml(r#"{"k":"a\nb"}"#), "k: 'a\n\n  b'\n");
+        assert_eq!(yaml(r#"{"k":"a \nb"}"#), "k: \"a \\nb\"\n");
+    }
+
+    #[test]
+    fn folds_long_lines_at_spaces() {
+        let words = ["word"; 20].join(" ");
+        let rendered = yaml(&format!(r#"{{"key":"{words}"}}"#));
+        let expected = format!("key: {}\n  {}\n", ["word"; 16].join(" "), ["word"; 4].join(" "));
+        assert_eq!(rendered, expected);
+    }
+}
@@ -0,0 +1,59 @@
+#![cfg(feature = "msgpack")]
+
+use std::fs;
+use std::path::Path;
+
+use jd_core::{DiffOptions, Node};
+use serde::Deserialize;
+
+/// A MessagePack value, the node it decodes to, and the bytes that node
+/// encodes to when they differ from the input.
+#[derive(Debug, Deserialize)]
+struct Fixture {
+    description: String,
+    msgpack: String,
+    node: serde_json::Value,
+    #[serde(default)]
+    encoded: Option<String>,
+}
+
+fn unhex(text: &str) -> Vec<u8> {
+    (0..text.len()).step_by(2).map(|i| u8::from_str_radix(&text[i..i + 2], 16).unwrap()).collect()
+}
+
+#[test]
+fn msgpack_fixtures_decode_and_encode() {
+    let fixtures_root = Path::new(env!("CARGO_MANIFEST_DIR")).join("tests/fixtures/msgpack");
+    let mut entries: Vec<_> = fs::read_dir(&fixtures_root)
+        .expect("fixtures directory must exist")
+        .filter_map(|entry| entry.ok())
+        .map(|entry| entry.path())
+        .filter(|path| path.extension().is_some_and(|ext| ext == "json"))
+        .collect();
+    entries.sort();
+    assert!(!entries.is_empty(), "expected MessagePack fixtures under tests/fixtures/msgpack");
+
+    for path in entries {
+        let data = fs::read_to_string(&path).expect("fixture should be readable");
+        let fixture: Fixture = serde_json::from_str(&data).expect("fixture should deserialize");
+        let input = unhex(&fixture.msgpack);
+        let node = Node::from_msgpack_slice(&input).expect("fixture input decodes");
+        let expected = Node::from_json_value(fixture.node).expect("fixture node is valid");
+        assert_eq!(node, expected, "{}: {path:?}", fixture.description);
+
+        let encoded = fixture.encoded.as_deref().map_or_else(|| input.clone(), unhex);
+        assert_eq!(node.to_msgpack_vec().unwrap(), encoded, "{}: {path:?}", fixture.description);
+    }
+}
+
+#[test]
+fn str_and_bin_with_the_same_bytes_differ() {
+    let text = Node::from_msgpack_slice(&[0xa3, b'a', b'b', b'c']).unwrap();
+    let bytes = Node::from_msgpack_slice(&[0xc4, 0x03, b'a', b'b', b'c']).unwrap();
+    assert_ne!(text, bytes);
+    let diff = text.diff(&bytes, &DiffOptions::default());
+    assert_eq!(
+        text.apply_patch(&diff).unwrap().to_msgpack_vec().unwrap(),
+        [0xc4, 3, b'a', b'b', b'c']
+    );
+}
@@ -1,4 +1,4 @@
-use jd_core::{diff::PathSegment, Diff, DiffElement, DiffMetadata, DiffOptions, Node};
+use jd_core::{diff::PathSegment, ArrayMode, Diff, DiffElement, DiffMetadata, DiffOptions, Node};
 use proptest::prop_assert_eq;
 
 #[test]
@@ -53,6 +53,34 @@ fn apply_patch_rejects_merge_old_value() {
     assert_eq!(err.to_string(), "patch with merge strategy at [a] has unnecessary old value 1");
 }
 
+#[test]
+fn apply_json_patch_consumes_rendered_patches() {
+    let base = Node::from_json_str("{\"a\":[1,2,3],\"b\":\"x\"}").unwrap();
+    let target = Node::from_json_str("{\"a\":[1,4,3],\"c\":true}").unwrap();
+    let patch = base.diff(&target, &DiffOptions::default()).render_patch().unwrap();
+    assert_eq!(base.apply_json_patch(&patch).unwrap(), target);
+}
+
+#[test]
+fn apply_json_patch_reports_failed_tests() {
+    let patch = r#"[{"op":"test","path":"/a","value":1},{"op":"remove","path":"/a"}]"#;
+    let base = Node::from_json_str("{\"a\":2}").unwrap();
+    let err = base.apply_json_patch(patch).expect_err("test op should fail");
+    assert_eq!(err.to_string(), "found 2 at [a]: expected 1");
+}
+
+#[test]
+fn apply_merge_patch_round_trips_rendered_merge_patches() {
+    let element = DiffElement::new()
+        .with_metadata(DiffMetadata::merge())
+        .with_path(vec![PathSegment::key("a"), PathSegment::key("b")])
+        .with_add(vec![Node::Void]);
+    let patch = Diff::from_elements(vec![element]).render_merge().unwrap();
+    let base = Node::from_json_str("{\"a\":{\"b\":1,\"c\":2}}").unwrap();
+    let patched = base.apply_merge_patch(&patch).unwrap();
+    assert_eq!(patched, Node::from_json_str("{\"a\":{\"c\":2}}").unwrap());
+}
+
 fn arb_json_value() -> impl proptest::strategy::Strategy<Value = serde_json::Value> {
     use proptest::{collection::btree_map, collection::vec, prelude::*, string::string_regex};
 
@@ -83,7 +111,155 @@ fn arb_json_value() -> impl proptest::strategy::Strategy<Value = serde_json::Val
     })
 }
 
+/// Small documents over few keys and values, so that successive versions
+/// change the same places.
+fn arb_similar_json() -> impl proptest::strategy::Strategy<Value = serde_json::Value> {
+    use proptest::{collection::btree_map, collection::vec, prelude::*, sample::select};
+
+    let leaf = (0..3i64).prop_map(serde_json::Value::from);
+    leaf.prop_recursive(3, 12, 4, move |inner| {
+        prop_oneof![
+            vec(inner.clone(), 0..5).prop_map(serde_json::Value::Array),
+            btree_map(select(vec!["a", "b", "c"]), inner, 0..3).prop_map(|map| {
+                let object = map.into_iter().map(|(k, v)| (k.to_string(), v)).collect();
+                serde_json::Value::Object(object)
+            }),
+        ]
+    })
+}
+
+/// The option modes a diff can run in: arrays as lists, as lists compared
+/// within a numeric precision, as sets, or as multisets. Precision does not
+/// combine with the set modes.
+fn mode_options(mode: usize) -> DiffOptions {
+    let options = DiffOptions::default();
+    match mode {
+        0 => options,
+        1 => options.with_precision(0.5).unwrap(),
+        2 => options.with_array_mode(ArrayMode::Set).unwrap(),
+        _ => options.with_array_mode(ArrayMode::MultiSet).unwrap(),
+    }
+}
+
+/// Builds the JSON Merge Patch from `lhs` to `rhs`, which holds no `null`
+/// object members.
+fn merge_patch(lhs: &serde_json::Value, rhs: &serde_json::Value) -> serde_json::Value {
+    use serde_json::Value;
+
+    let (Value::Object(lhs), Value::Object(rhs)) = (lhs, rhs) else {
+        return rhs.clone();
+    };
+    let mut patch = serde_json::Map::new();
+    for (key, value) in lhs {
+        match rhs.get(key) {
+            None => {
+                patch.insert(key.clone(), Value::Null);
+            }
+            Some(other) if other != value => {
+                patch.insert(key.clone(), merge_patch(value, other));
+            }
+            Some(_) => {}
+        }
+    }
+    for (key, value) in rhs {
+        if !lhs.contains_key(key) {
+            patch.insert(key.clone(), value.clone());
+        }
+    }
+    Value::Object(patch)
+}
+
+/// Replaces `null` object members, which a merge patch can only delete.
+fn without_null_members(value: serde_json::Value) -> serde_json::Value {
+    use serde_json::Value;
+
+    match value {
+        Value::Object(members) => Value::Object(
+            members
+                .into_iter()
+                .map(|(key, value)| match value {
+                    Value::Null => (key, Value::Bool(false)),
+                    value => (key, without_null_members(value)),
+                })
+                .collect(),
+        ),
+        Value::Array(items) => Value::Array(items.into_iter().map(without_null_members).collect()),
+        value => value,
+    }
+}
+
 proptest::proptest! {
+    #[test]
+    fn diff_and_patch_roundtrip_across_option_modes(
+        a_json in arb_json_value(),
+        b_json in arb_json_value(),
+        mode in 0..4usize,
+        merge in proptest::bool::ANY,
+    ) {
+        let opts = mode_options(mode);
+        let a = Node::from_json_value(a_json.clone()).unwrap();
+        let (b, diff) = if merge {
+            let b_json = without_null_members(b_json);
+            // A null or empty merge patch at the root reads as no change,
+            // as it does in Go jd.
+            proptest::prop_assume!(!b_json.is_null());
+            proptest::prop_assume!(a_json.is_object() || b_json != serde_json::json!({}));
+            let patch = merge_patch(&a_json, &b_json).to_string();
+            (Node::from_json_value(b_json).unwrap(), Diff::from_merge_patch_str(&patch).unwrap())
+        } else {
+            let b = Node::from_json_value(b_json).unwrap();
+            let diff = a.diff(&b, &opts);
+            (b, diff)
+        };
+        let patched = a.apply_patch_with_options(&diff, &opts).unwrap();
+        proptest::prop_assert!(patched.eq_with_options(&b, &opts), "{patched:?} != {b:?}");
+
+        if !merge {
+            let reverse = b.diff(&a, &opts);
+            let restored = b.apply_patch_with_options(&reverse, &opts).unwrap();
+            proptest::prop_assert!(restored.eq_with_options(&a, &opts), "{restored:?} != {a:?}");
+        }
+    }
+
+    #[test]
+    fn composed_diffs_simplify_to_equivalent_diffs(
+        a in arb_similar_json(),
+        b in arb_similar_json(),
+        c in arb_similar_json(),
+    ) {
+        let (a, b, c) = (
+            Node::from_json_value(a).unwrap(),
+            Node::from_json_value(b).unwrap(),
+            Node::from_json_value(c).unwrap(),
+        );
+        let opts = DiffOptions::default();
+        let composed: Vec<DiffElement> =
+            a.diff(&b, &opts).into_iter().chain(b.diff(&c, &opts)).collect();
+        let composed = Diff::from_elements(composed);
+        let simplified = composed.simplify();
+        prop_assert_eq!(a.apply_patch(&simplified).unwrap(), c);
+        proptest::prop_assert!(simplified.len() <= composed.len());
+    }
+
+    #[test]
+    fn canonical_forms_apply_alike_and_are_stable(
+        a in arb_similar_json(),
+        b in arb_similar_json(),
+        c in arb_similar_json(),
+    ) {
+        let (a, b, c) = (
+            Node::from_json_value(a).unwrap(),
+            Node::from_json_value(b).unwrap(),
+            Node::from_json_value(c).unwrap(),
+        );
+        let opts = DiffOptions::default().with_move_detection(true);
+        let composed: Vec<DiffElement> =
+            a.diff(&b, &opts).into_iter().chain(b.diff(&c, &opts)).collect();
+        let canonical = Diff::from_elements(composed).canonicalize();
+        prop_assert_eq!(a.apply_patch(&canonical).unwrap(), c);
+        prop_assert_eq!(canonical.canonicalize().into_elements(), canonical.into_elements());
+    }
+
     #[test]
     fn diff_and_patch_roundtrip(a_json in arb_json_value(), b_json in arb_json_value()) {
         let a = Node::from_json_value(a_json.clone()).unwrap();
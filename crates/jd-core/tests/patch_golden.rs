@@ -0,0 +1,52 @@
+use std::fs;
+use std::path::Path;
+
+use jd_core::{Diff, Node};
+use serde::Deserialize;
+
+#[derive(Debug, Deserialize)]
+struct Fixture {
+    target: String,
+    diff: String,
+    #[serde(default)]
+    patched: Option<String>,
+    #[serde(default)]
+    error: Option<String>,
+}
+
+fn load_fixture(path: &Path) -> Fixture {
+    let data = fs::read_to_string(path).expect("fixture should be readable");
+    serde_json::from_str(&data).expect("fixture should deserialize")
+}
+
+#[test]
+fn patch_parity_matches_go_outputs() {
+    let fixtures_root = Path::new(env!("CARGO_MANIFEST_DIR")).join("tests/fixtures/patch");
+    let mut entries: Vec<_> = fs::read_dir(&fixtures_root)
+        .expect("fixtures directory must exist")
+        .filter_map(|entry| entry.ok())
+        .map(|entry| entry.path())
+        .filter(|path| path.extension().is_some_and(|ext| ext == "json"))
+        .collect();
+    entries.sort();
+
+    assert!(!entries.is_empty(), "expected at least one patch fixture under tests/fixtures/patch");
+
+    for path in entries {
+        let fixture = load_fixture(&path);
+        let target = Node::from_json_str(&fixture.target).expect("target parses");
+        let diff = Diff::from_native_str(&fixture.diff).expect("diff parses");
+        let result = target.apply_patch(&diff);
+        match (fixture.patched, fixture.error) {
+            (Some(patched), None) => {
+                let expected = Node::from_json_str(&patched).expect("patched output parses");
+                assert_eq!(result.expect("patch applies"), expected, "fixture {path:?}");
+            }
+            (None, Some(error)) => {
+                let err = result.expect_err(&format!("fixture {path:?}: Go jd failed"));
+                assert_eq!(err.to_string(), error, "fixture {path:?}");
+            }
+            _ => panic!("fixture {path:?} must hold either patched or error"),
+        }
+    }
+}
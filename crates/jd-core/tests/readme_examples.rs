@@ -1,4 +1,4 @@
-use jd_core::{DiffOptions, Node};
+use jd_core::{merge3, DiffOptions, MergeError, Node, NodeComparator, Path, PathSegment};
 
 #[test]
 fn jd_core_readme_example() -> Result<(), Box<dyn std::error::Error>> {
@@ -16,3 +16,46 @@ fn jd_core_readme_example() -> Result<(), Box<dyn std::error::Error>> {
     assert_eq!(patched, target);
     Ok(())
 }
+
+#[test]
+fn jd_core_readme_merge3_example() -> Result<(), Box<dyn std::error::Error>> {
+    let base = Node::from_json_str(r#"{"replicas":1,"image":"app:1"}"#)?;
+    let ours = Node::from_json_str(r#"{"replicas":3,"image":"app:1"}"#)?;
+    let theirs = Node::from_json_str(r#"{"replicas":1,"image":"app:2"}"#)?;
+
+    let merged = merge3(&base, &ours, &theirs, &DiffOptions::default())?;
+    assert_eq!(merged, Node::from_json_str(r#"{"replicas":3,"image":"app:2"}"#)?);
+
+    let rival = Node::from_json_str(r#"{"replicas":5,"image":"app:1"}"#)?;
+    let Err(MergeError::Conflicts(conflicts)) =
+        merge3(&base, &ours, &rival, &DiffOptions::default())
+    else {
+        panic!("expected a conflict");
+    };
+    assert_eq!(conflicts.len(), 1);
+    Ok(())
+}
+
+/// Compares hostnames case-insensitively.
+#[derive(Debug)]
+struct Hostnames;
+
+impl NodeComparator for Hostnames {
+    fn equals(&self, path: &Path, lhs: &Node, rhs: &Node) -> Option<bool> {
+        let is_host = path.segments().last() == Some(&PathSegment::key("host"));
+        match (lhs, rhs) {
+            (Node::String(a), Node::String(b)) if is_host => Some(a.eq_ignore_ascii_case(b)),
+            _ => None,
+        }
+    }
+}
+
+#[test]
+fn jd_core_readme_comparator_example() -> Result<(), Box<dyn std::error::Error>> {
+    let lhs = Node::from_json_str(r#"{"server":{"host":"Example.COM","port":80}}"#)?;
+    let rhs = Node::from_json_str(r#"{"server":{"host":"example.com","port":80}}"#)?;
+    let options = DiffOptions::default().with_comparator(Hostnames);
+    assert!(lhs.diff(&rhs, &options).is_empty());
+    assert!(!lhs.diff(&rhs, &DiffOptions::default()).is_empty());
+    Ok(())
+}
@@ -1,5 +1,5 @@
 use jd_core::{
-    diff::PathSegment, Diff, DiffElement, DiffMetadata, DiffOptions, Node, RenderConfig,
+    diff::PathSegment, ArrayMode, Diff, DiffElement, DiffMetadata, DiffOptions, Node, RenderConfig,
 };
 use proptest::prelude::*;
 
@@ -92,6 +92,36 @@ fn render_raw_serializes_diff() {
     assert_eq!(parsed.as_array().unwrap().len(), 1);
 }
 
+#[test]
+fn serde_round_trips_every_hunk_kind() {
+    let set = DiffOptions::default().with_array_mode(ArrayMode::Set).unwrap();
+    let multiset = DiffOptions::default().with_array_mode(ArrayMode::MultiSet).unwrap();
+    let set_keys = DiffOptions::default().with_set_keys(["id"]).unwrap();
+    let moves = DiffOptions::default().with_move_detection(true);
+    for (lhs, rhs, options) in [
+        (r#"{"a":1.5,"b":[1,2]}"#, r#"{"a":"x","b":[1,3,4]}"#, DiffOptions::default()),
+        (r#"{"a":[1,2,3]}"#, r#"{"a":[3,1,4]}"#, set),
+        (r#"[1,2,3]"#, r#"[1,2,3,3]"#, multiset),
+        (r#"[{"id":1,"n":1},{"id":2}]"#, r#"[{"id":1,"n":2},{"id":2}]"#, set_keys),
+        (r#"[1,2,3,4,5]"#, r#"[5,1,2,3,4]"#, moves),
+    ] {
+        let lhs = Node::from_json_str(lhs).unwrap();
+        let rhs = Node::from_json_str(rhs).unwrap();
+        let diff = lhs.diff(&rhs, &options);
+        let reloaded: Diff = serde_json::from_str(&serde_json::to_string(&diff).unwrap()).unwrap();
+        assert_eq!(reloaded, diff);
+        assert!(lhs
+            .apply_patch_with_options(&reloaded, &options)
+            .unwrap()
+            .eq_with_options(&rhs, &options));
+    }
+
+    let merge = Diff::from_native_str("^ {\"Merge\":true}\n@ [\"a\"]\n+\n").unwrap();
+    let raw = serde_json::to_string(&merge).unwrap();
+    assert_eq!(raw, r#"[{"metadata":{"merge":true},"path":["a"],"add":[{"type":"Void"}]}]"#);
+    assert_eq!(serde_json::from_str::<Diff>(&raw).unwrap(), merge);
+}
+
 #[test]
 fn reverse_swaps_add_remove() {
     let diff = simple_diff();
@@ -1,7 +1,7 @@
 use std::fs;
 use std::path::Path;
 
-use jd_core::{Diff, DiffOptions, Node, RenderConfig};
+use jd_core::{ArrayMode, Diff, DiffOptions, Node, RenderConfig};
 use serde::Deserialize;
 
 #[derive(Debug, Deserialize)]
@@ -14,6 +14,8 @@ struct RenderOutputs {
     patch: Option<String>,
     #[serde(default)]
     merge: Option<String>,
+    #[serde(default)]
+    native_bytes: Option<Vec<u8>>,
 }
 
 #[derive(Debug, Deserialize)]
@@ -22,6 +24,8 @@ struct Fixture {
     rhs: String,
     #[serde(default)]
     options: Vec<String>,
+    #[serde(default)]
+    format: Option<String>,
     diff: Diff,
     render: RenderOutputs,
 }
@@ -31,53 +35,154 @@ fn load_fixture(path: &Path) -> Fixture {
     serde_json::from_str(&data).expect("fixture should deserialize")
 }
 
-#[test]
-fn render_parity_matches_go_outputs() {
-    let fixtures_root = Path::new(env!("CARGO_MANIFEST_DIR")).join("tests/fixtures/render");
-    let mut entries: Vec<_> = fs::read_dir(&fixtures_root)
+fn parse_input(input: &str, format: Option<&str>) -> Node {
+    match format {
+        Some("yaml") => Node::from_yaml_str(input).expect("YAML input parses"),
+        Some(other) => panic!("unsupported fixture format {other:?}"),
+        None => Node::from_json_str(input).expect("JSON input parses"),
+    }
+}
+
+fn options_from(names: &[String]) -> DiffOptions {
+    let mut options = DiffOptions::default();
+    for name in names {
+        options = match name.as_str() {
+            "set" => options.with_array_mode(ArrayMode::Set).expect("set option"),
+            "mset" => options.with_array_mode(ArrayMode::MultiSet).expect("mset option"),
+            other => {
+                if let Some(keys) = other.strip_prefix("setkeys=") {
+                    options.with_set_keys(keys.split(',')).expect("setkeys option")
+                } else if let Some(precision) = other.strip_prefix("precision=") {
+                    let precision = precision.parse().expect("precision is a number");
+                    options.with_precision(precision).expect("precision option")
+                } else {
+                    panic!("unsupported fixture option {other:?}")
+                }
+            }
+        };
+    }
+    options
+}
+
+fn fixture_paths(fixtures_root: &Path) -> Vec<std::path::PathBuf> {
+    let mut entries: Vec<_> = fs::read_dir(fixtures_root)
         .expect("fixtures directory must exist")
         .filter_map(|entry| entry.ok())
         .map(|entry| entry.path())
         .filter(|path| path.extension().is_some_and(|ext| ext == "json"))
         .collect();
     entries.sort();
+    entries
+}
+
+fn check_fixture(path: &Path) {
+    let fixture = load_fixture(path);
+    let lhs = parse_input(&fixture.lhs, fixture.format.as_deref());
+    let rhs = parse_input(&fixture.rhs, fixture.format.as_deref());
+
+    let diff = if fixture.options.iter().any(|opt| opt == "merge") {
+        fixture.diff
+    } else {
+        let computed = lhs.diff(&rhs, &options_from(&fixture.options));
+        assert_eq!(computed, fixture.diff, "fixture {path:?} diff");
+        computed
+    };
+
+    if let Some(expected) = fixture.render.native {
+        let rendered = diff.render(&RenderConfig::default());
+        assert_eq!(rendered, expected, "fixture {path:?} native output");
+        let parsed = Diff::from_native_str(&expected).expect("native output parses");
+        assert_eq!(parsed, diff, "fixture {path:?} parsed native output");
+    }
+
+    if let Some(expected) = fixture.render.native_bytes {
+        let rendered = diff.render(&RenderConfig::default());
+        assert_eq!(rendered.as_bytes(), expected, "fixture {path:?} native bytes");
+    }
+
+    if let Some(expected) = fixture.render.native_color {
+        let rendered = diff.render(&RenderConfig::default().with_color(true));
+        assert_eq!(rendered, expected, "fixture {path:?} native color output");
+    }
+
+    if let Some(expected) = fixture.render.patch {
+        let rendered = diff.render_patch().expect("render_patch");
+        assert_eq!(rendered, expected, "fixture {path:?} patch output");
+    }
+
+    if let Some(expected) = fixture.render.merge {
+        let rendered = diff.render_merge().expect("render_merge");
+        assert_eq!(rendered, expected, "fixture {path:?} merge output");
+    }
+}
 
+#[test]
+fn render_parity_matches_go_outputs() {
+    let fixtures_root = Path::new(env!("CARGO_MANIFEST_DIR")).join("tests/fixtures/render");
+    let entries = fixture_paths(&fixtures_root);
     assert!(
         !entries.is_empty(),
         "expected at least one render fixture under tests/fixtures/render",
     );
-
     for path in entries {
-        let fixture = load_fixture(&path);
-        let lhs = Node::from_json_str(&fixture.lhs).expect("lhs parses");
-        let rhs = Node::from_json_str(&fixture.rhs).expect("rhs parses");
-
-        let diff = if fixture.options.iter().any(|opt| opt == "merge") {
-            fixture.diff
-        } else {
-            let computed = lhs.diff(&rhs, &DiffOptions::default());
-            assert_eq!(computed, fixture.diff, "fixture {path:?} diff");
-            computed
-        };
-
-        if let Some(expected) = fixture.render.native {
-            let rendered = diff.render(&RenderConfig::default());
-            assert_eq!(rendered, expected, "fixture {path:?} native output");
-        }
+        check_fixture(&path);
+    }
+}
 
-        if let Some(expected) = fixture.render.native_color {
-            let rendered = diff.render(&RenderConfig::default().with_color(true));
-            assert_eq!(rendered, expected, "fixture {path:?} native color output");
-        }
+/// Generated fixtures whose Go output jd-rs departs from on purpose, with
+/// the reason, as `scripts/run_parity.sh` lists its known divergences.
+const KNOWN_DIVERGENCES: &[(&str, &str)] = &[
+    ("matrix/numbers__precision_0_5", PRECISION_IGNORED),
+    ("matrix/records__precision_0_5", PRECISION_IGNORED),
+    ("matrix/scalars__precision_0_5", PRECISION_IGNORED),
+    ("matrix/numbers__set__merge", SET_MERGE_ORDER),
+    ("matrix/numbers__setkeys_id__merge", SET_MERGE_ORDER),
+];
 
-        if let Some(expected) = fixture.render.patch {
-            let rendered = diff.render_patch().expect("render_patch");
-            assert_eq!(rendered, expected, "fixture {path:?} patch output");
-        }
+const PRECISION_IGNORED: &str =
+    "upstream v2.2.2 ignores precision; see ADRs/0004-honor-precision-in-diffs.md";
+const SET_MERGE_ORDER: &str = "Go writes a set replaced by a merge hunk in hash order when \
+     rendering a merge patch straight from the diff, and in document order after reading the \
+     diff back; jd-rs always keeps document order";
 
-        if let Some(expected) = fixture.render.merge {
-            let rendered = diff.render_merge().expect("render_merge");
-            assert_eq!(rendered, expected, "fixture {path:?} merge output");
+/// Checks a suite of fixtures that `scripts/gen_fixtures.go` writes from
+/// `scripts/fixtures.json`.
+fn check_generated_suite(dir: &str) {
+    let fixtures_root = Path::new(env!("CARGO_MANIFEST_DIR")).join("tests/fixtures").join(dir);
+    assert!(
+        fixtures_root.is_dir(),
+        "no {dir} fixtures; run scripts/gen_fixtures.go to generate them",
+    );
+    let entries = fixture_paths(&fixtures_root);
+    assert!(!entries.is_empty(), "expected at least one fixture under tests/fixtures/{dir}");
+    for path in entries {
+        let name = format!("{dir}/{}", path.file_stem().unwrap().to_string_lossy());
+        if let Some((_, reason)) = KNOWN_DIVERGENCES.iter().find(|(known, _)| *known == name) {
+            eprintln!("skipping {name}: {reason}");
+            continue;
         }
+        check_fixture(&path);
     }
 }
+
+#[test]
+fn option_matrix_matches_go_outputs() {
+    check_generated_suite("matrix");
+}
+
+#[test]
+fn unicode_escaping_matches_go_outputs() {
+    check_generated_suite("unicode");
+}
+
+#[test]
+fn fixtures_come_from_the_followed_upstream_version() {
+    let version_file = Path::new(env!("CARGO_MANIFEST_DIR")).join("tests/fixtures/VERSION.txt");
+    let version = fs::read_to_string(&version_file).expect("fixtures record their jd version");
+    assert_eq!(
+        version.trim(),
+        "github.com/josephburnett/jd/v2 v2.2.2",
+        "fixtures were regenerated from another jd version; review the changed fixtures, then \
+         update this pin and the parity docs",
+    );
+}
@@ -0,0 +1,117 @@
+//! Checks the jd v1 reader and writer against fixtures `scripts/gen_fixtures.go`
+//! writes under `tests/fixtures/v1/` when built with `-tags jdv1`.
+
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use jd_core::{Diff, Node};
+use serde::Deserialize;
+
+#[derive(Debug, Deserialize)]
+struct RenderOutputs {
+    #[serde(default)]
+    native: Option<String>,
+}
+
+#[derive(Debug, Deserialize)]
+struct RenderFixture {
+    diff: Diff,
+    #[serde(default)]
+    render: Option<RenderOutputs>,
+}
+
+#[derive(Debug, Deserialize)]
+struct PatchFixture {
+    target: String,
+    diff: String,
+    #[serde(default)]
+    patched: Option<String>,
+    #[serde(default)]
+    error: Option<String>,
+}
+
+fn v1_root() -> PathBuf {
+    Path::new(env!("CARGO_MANIFEST_DIR")).join("tests/fixtures/v1")
+}
+
+/// Returns the fixtures of a v1 suite, failing when the suite is missing.
+fn fixture_paths(dir: &str) -> Vec<PathBuf> {
+    let root = v1_root().join(dir);
+    assert!(root.is_dir(), "no v1 {dir} fixtures; run `go run -tags jdv1 .` in scripts/");
+    let mut entries: Vec<_> = fs::read_dir(&root)
+        .expect("fixtures directory readable")
+        .filter_map(|entry| entry.ok())
+        .map(|entry| entry.path())
+        .filter(|path| path.extension().is_some_and(|ext| ext == "json"))
+        .collect();
+    entries.sort();
+    assert!(!entries.is_empty(), "expected at least one fixture under tests/fixtures/v1/{dir}");
+    entries
+}
+
+fn load<T: for<'de> Deserialize<'de>>(path: &Path) -> T {
+    let data = fs::read_to_string(path).expect("fixture should be readable");
+    serde_json::from_str(&data).expect("fixture should deserialize")
+}
+
+#[test]
+fn v1_diffs_read_and_write_as_go_jd_v1() {
+    for dir in ["render", "matrix", "unicode"] {
+        for path in fixture_paths(dir) {
+            let fixture: RenderFixture = load(&path);
+            let Some(native) = fixture.render.and_then(|render| render.native) else {
+                continue;
+            };
+            let parsed = Diff::from_native_v1_str(&native).expect("v1 native output parses");
+            assert_eq!(parsed, fixture.diff, "fixture {path:?} parsed v1 output");
+            let rendered = parsed.render_v1().expect("render_v1");
+            assert_eq!(rendered, native, "fixture {path:?} v1 output");
+        }
+    }
+}
+
+/// v1 patch fixtures whose outcome changed in v2, which jd-rs follows, with
+/// the reason, as `render_golden.rs` lists its known divergences.
+const KNOWN_DIVERGENCES: &[(&str, &str)] = &[(
+    "error_index_out_of_range",
+    "v2 reports a removal past the end of a list as out of bounds, where v1 reported the \
+     missing value",
+)];
+
+#[test]
+fn v1_patches_apply_as_in_go_jd_v1() {
+    for path in fixture_paths("patch") {
+        let name = path.file_stem().unwrap().to_string_lossy();
+        if let Some((_, reason)) = KNOWN_DIVERGENCES.iter().find(|(known, _)| *known == name) {
+            eprintln!("skipping patch/{name}: {reason}");
+            continue;
+        }
+        let fixture: PatchFixture = load(&path);
+        let target = Node::from_json_str(&fixture.target).expect("target parses");
+        let diff = Diff::from_native_v1_str(&fixture.diff).expect("v1 diff parses");
+        let result = target.apply_patch(&diff);
+        match (fixture.patched, fixture.error) {
+            (Some(expected), None) => {
+                let expected = Node::from_json_str(&expected).expect("patched output parses");
+                assert_eq!(result.expect("patch applies"), expected, "fixture {path:?}");
+            }
+            (None, Some(error)) => {
+                let err = result.expect_err(&format!("fixture {path:?}: Go jd v1 failed"));
+                assert_eq!(err.to_string(), error, "fixture {path:?}");
+            }
+            _ => panic!("fixture {path:?} must record either a patched document or an error"),
+        }
+    }
+}
+
+#[test]
+fn v1_fixtures_come_from_the_pinned_upstream_version() {
+    let version = fs::read_to_string(v1_root().join("VERSION.txt"))
+        .expect("v1 fixtures record their jd version");
+    assert_eq!(
+        version.trim(),
+        "github.com/josephburnett/jd v1.8.1",
+        "v1 fixtures were regenerated from another jd version; review the changed fixtures, \
+         then update this pin and scripts/go.mod",
+    );
+}
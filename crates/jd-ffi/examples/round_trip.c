@@ -0,0 +1,40 @@
+/* Diffs two documents, renders the diff as JSON Patch, and applies it.
+ *
+ *   cargo build -p jd-ffi --release
+ *   cc crates/jd-ffi/examples/round_trip.c -Icrates/jd-ffi/include \
+ *      -Ltarget/release -ljd_ffi -o round_trip
+ *   LD_LIBRARY_PATH=target/release ./round_trip
+ */
+#include <stdio.h>
+#include <string.h>
+
+#include "jd.h"
+
+static int check(int32_t status, char *out) {
+    if (status != JD_OK) {
+        fprintf(stderr, "jd failed (%d): %s\n", status, out ? out : "(no message)");
+        jd_free(out);
+        return 0;
+    }
+    return 1;
+}
+
+int main(void) {
+    const char *before = "{\"name\":\"jd\",\"tags\":[\"a\",\"b\"]}";
+    const char *after = "{\"name\":\"jd\",\"tags\":[\"a\",\"c\"]}";
+    char *diff = NULL, *patch = NULL, *patched = NULL;
+
+    if (!check(jd_diff(before, after, NULL, &diff), diff)) return 1;
+    printf("%s", diff);
+
+    if (!check(jd_render(diff, "patch", &patch), patch)) return 1;
+    printf("%s\n", patch);
+
+    if (!check(jd_patch(before, patch, "patch", NULL, &patched), patched)) return 1;
+    int same = strcmp(patched, after) == 0;
+
+    jd_free(diff);
+    jd_free(patch);
+    jd_free(patched);
+    return same ? 0 : 1;
+}
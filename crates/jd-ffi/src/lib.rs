@@ -0,0 +1,332 @@
+//! C ABI for the Rust port of the `jd` tool.
+//!
+//! Every function takes NUL-terminated UTF-8 strings and reports its result
+//! through an out-parameter: on success `*out` receives the output and the
+//! function returns [`JD_OK`]; on failure it receives the error message and
+//! the function returns [`JD_ERROR`] or [`JD_INVALID_ARGUMENT`]. Either way
+//! the string belongs to the caller, who releases it with [`jd_free`].
+//! Panics are caught and reported as [`JD_ERROR`]; they never unwind into
+//! the caller.
+//!
+//! `include/jd.h` declares the API for C, C++, and Swift and is generated by
+//! `cbindgen` from this file.
+#![deny(unsafe_op_in_unsafe_fn)]
+#![warn(missing_docs)]
+
+use std::ffi::{c_char, CStr, CString};
+use std::panic::{self, AssertUnwindSafe};
+use std::ptr;
+
+use anyhow::{bail, Context, Result};
+use jd_core::{Diff, DiffOptions, Node, RenderConfig};
+
+/// The call succeeded and `*out` holds its output.
+pub const JD_OK: i32 = 0;
+
+/// The inputs could not be diffed, rendered, or patched; `*out` holds the
+/// error message.
+pub const JD_ERROR: i32 = 1;
+
+/// A required argument was NULL or a string was not valid UTF-8. `*out`
+/// holds the error message unless `out` itself was NULL.
+pub const JD_INVALID_ARGUMENT: i32 = 2;
+
+/// Diffs two JSON documents and stores the native jd diff in `*out`. The
+/// diff is empty when the documents are equal. `options` may be NULL or
+/// hold jd's JSON diff options, such as `["SET"]`.
+///
+/// # Safety
+///
+/// `lhs`, `rhs`, and a non-NULL `options` must point to NUL-terminated
+/// strings, and `out` must be NULL or valid for writing a pointer.
+#[no_mangle]
+pub unsafe extern "C" fn jd_diff(
+    lhs: *const c_char,
+    rhs: *const c_char,
+    options: *const c_char,
+    out: *mut *mut c_char,
+) -> i32 {
+    // SAFETY: the caller upholds the pointer contract documented above.
+    unsafe {
+        call(out, || {
+            let options = parse_options(read_optional(options, "options")?)?;
+            let lhs = Node::from_json_str(read_required(lhs, "lhs")?)
+                .context("failed to parse the first document")?;
+            let rhs = Node::from_json_str(read_required(rhs, "rhs")?)
+                .context("failed to parse the second document")?;
+            Ok(lhs.diff(&rhs, &options).render(&RenderConfig::default()))
+        })
+    }
+}
+
+/// Renders a native jd diff as `"jd"`, `"patch"` (RFC 6902), or `"merge"`
+/// (RFC 7386) and stores it in `*out`. Only merge diffs, which start with
+/// `^ {"Merge":true}`, render as merge patches.
+///
+/// # Safety
+///
+/// `diff` and `format` must point to NUL-terminated strings, and `out` must
+/// be NULL or valid for writing a pointer.
+#[no_mangle]
+pub unsafe extern "C" fn jd_render(
+    diff: *const c_char,
+    format: *const c_char,
+    out: *mut *mut c_char,
+) -> i32 {
+    // SAFETY: the caller upholds the pointer contract documented above.
+    unsafe {
+        call(out, || {
+            let format = read_required(format, "format")?;
+            let diff = Diff::from_native_str(read_required(diff, "diff")?)?;
+            Ok(match format {
+                "jd" => diff.render(&RenderConfig::default()),
+                "patch" => diff.render_patch().context("failed to render JSON Patch")?,
+                "merge" => diff.render_merge().context("failed to render JSON Merge Patch")?,
+                _ => bail!(unsupported_format(format)),
+            })
+        })
+    }
+}
+
+/// Applies `patch`, written in `format` (`"jd"` when NULL), to a JSON
+/// document and stores the patched document in `*out` as compact JSON.
+/// `options` may be NULL or hold JSON diff options for jd diffs, as in
+/// [`jd_diff`].
+///
+/// # Safety
+///
+/// `document`, `patch`, and any non-NULL `format` and `options` must point
+/// to NUL-terminated strings, and `out` must be NULL or valid for writing a
+/// pointer.
+#[no_mangle]
+pub unsafe extern "C" fn jd_patch(
+    document: *const c_char,
+    patch: *const c_char,
+    format: *const c_char,
+    options: *const c_char,
+    out: *mut *mut c_char,
+) -> i32 {
+    // SAFETY: the caller upholds the pointer contract documented above.
+    unsafe {
+        call(out, || {
+            let format = read_optional(format, "format")?.unwrap_or("jd");
+            let patch = read_required(patch, "patch")?;
+            let document = Node::from_json_str(read_required(document, "document")?)
+                .context("failed to parse the document")?;
+            let patched = match format {
+                "jd" => {
+                    let diff = Diff::from_native_str(patch)?;
+                    let options = parse_options(read_optional(options, "options")?)?;
+                    document.apply_patch_with_options(&diff, &options)?
+                }
+                "patch" => document.apply_json_patch(patch)?,
+                "merge" => document.apply_merge_patch(patch)?,
+                _ => bail!(unsupported_format(format)),
+            };
+            match patched.to_json_value() {
+                Some(value) => Ok(serde_json::to_string(&value)?),
+                None => bail!("the patch removed the whole document"),
+            }
+        })
+    }
+}
+
+/// Releases a string returned through `out` by any `jd_*` function. NULL is
+/// ignored.
+///
+/// # Safety
+///
+/// `string` must be NULL or a pointer received from this library that has
+/// not been freed yet.
+#[no_mangle]
+pub unsafe extern "C" fn jd_free(string: *mut c_char) {
+    if !string.is_null() {
+        // SAFETY: the pointer came from `CString::into_raw` in `store`.
+        drop(unsafe { CString::from_raw(string) });
+    }
+}
+
+/// An argument the caller got wrong, reported as [`JD_INVALID_ARGUMENT`].
+#[derive(Debug)]
+struct InvalidArgument(String);
+
+impl std::fmt::Display for InvalidArgument {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(&self.0)
+    }
+}
+
+impl std::error::Error for InvalidArgument {}
+
+/// Runs `body`, stores its output or error message in `*out`, and returns
+/// the matching status.
+///
+/// # Safety
+///
+/// `out` must be NULL or valid for writing a pointer.
+unsafe fn call(out: *mut *mut c_char, body: impl FnOnce() -> Result<String>) -> i32 {
+    if out.is_null() {
+        return JD_INVALID_ARGUMENT;
+    }
+    let (status, text) = match panic::catch_unwind(AssertUnwindSafe(body)) {
+        Ok(Ok(output)) => (JD_OK, output),
+        Ok(Err(err)) if err.downcast_ref::<InvalidArgument>().is_some() => {
+            (JD_INVALID_ARGUMENT, format!("{err:#}"))
+        }
+        Ok(Err(err)) => (JD_ERROR, format!("{err:#}")),
+        Err(_) => (JD_ERROR, "internal error: jd panicked".to_string()),
+    };
+    // SAFETY: checked non-NULL above; validity is the caller's contract.
+    unsafe { store(out, &text) };
+    status
+}
+
+/// Hands `text` to the caller as a C string, escaping interior NULs.
+///
+/// # Safety
+///
+/// `out` must be valid for writing a pointer.
+unsafe fn store(out: *mut *mut c_char, text: &str) {
+    let string =
+        CString::new(text.replace('\0', "\\u0000")).map_or(ptr::null_mut(), CString::into_raw);
+    // SAFETY: forwarded from the caller.
+    unsafe { out.write(string) };
+}
+
+/// Reads a string argument that may not be NULL.
+///
+/// # Safety
+///
+/// `ptr` must be NULL or point to a NUL-terminated string that outlives the
+/// call.
+unsafe fn read_required<'a>(ptr: *const c_char, name: &str) -> Result<&'a str> {
+    // SAFETY: forwarded from the caller.
+    match unsafe { read_optional(ptr, name) }? {
+        Some(text) => Ok(text),
+        None => Err(InvalidArgument(format!("{name} must not be NULL")).into()),
+    }
+}
+
+/// Reads a string argument for which NULL means "not given".
+///
+/// # Safety
+///
+/// `ptr` must be NULL or point to a NUL-terminated string that outlives the
+/// call.
+unsafe fn read_optional<'a>(ptr: *const c_char, name: &str) -> Result<Option<&'a str>> {
+    if ptr.is_null() {
+        return Ok(None);
+    }
+    // SAFETY: forwarded from the caller.
+    let bytes = unsafe { CStr::from_ptr(ptr) };
+    match bytes.to_str() {
+        Ok(text) => Ok(Some(text)),
+        Err(_) => Err(InvalidArgument(format!("{name} is not valid UTF-8")).into()),
+    }
+}
+
+fn parse_options(options: Option<&str>) -> Result<DiffOptions> {
+    match options {
+        Some(options) if !options.trim().is_empty() => {
+            DiffOptions::from_json_str(options).context("invalid diff options")
+        }
+        _ => Ok(DiffOptions::default()),
+    }
+}
+
+fn unsupported_format(format: &str) -> String {
+    format!("unsupported format {format:?}: expected \"jd\", \"patch\", or \"merge\"")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn text(value: &str) -> CString {
+        CString::new(value).unwrap()
+    }
+
+    /// Takes ownership of a returned string, freeing it through `jd_free`.
+    fn take(string: *mut c_char) -> String {
+        assert!(!string.is_null());
+        let owned = unsafe { CStr::from_ptr(string) }.to_str().unwrap().to_string();
+        unsafe { jd_free(string) };
+        owned
+    }
+
+    fn diff(lhs: &str, rhs: &str, options: Option<&str>) -> (i32, String) {
+        let options = options.map(text);
+        let mut out = ptr::null_mut();
+        let status = unsafe {
+            jd_diff(
+                text(lhs).as_ptr(),
+                text(rhs).as_ptr(),
+                options.as_ref().map_or(ptr::null(), |options| options.as_ptr()),
+                &mut out,
+            )
+        };
+        (status, take(out))
+    }
+
+    fn render(diff: &str, format: &str) -> (i32, String) {
+        let mut out = ptr::null_mut();
+        let status = unsafe { jd_render(text(diff).as_ptr(), text(format).as_ptr(), &mut out) };
+        (status, take(out))
+    }
+
+    fn patch(document: &str, patch: &str, format: Option<&str>) -> (i32, String) {
+        let format = format.map(text);
+        let mut out = ptr::null_mut();
+        let status = unsafe {
+            jd_patch(
+                text(document).as_ptr(),
+                text(patch).as_ptr(),
+                format.as_ref().map_or(ptr::null(), |format| format.as_ptr()),
+                ptr::null(),
+                &mut out,
+            )
+        };
+        (status, take(out))
+    }
+
+    #[test]
+    fn diffs_render_and_apply_in_every_format() {
+        let (lhs, rhs) = (r#"{"a":[1,2],"b":true}"#, r#"{"a":[1,3]}"#);
+        let (status, jd) = diff(lhs, rhs, None);
+        assert_eq!(status, JD_OK);
+        assert_eq!(patch(lhs, &jd, None), (JD_OK, rhs.to_string()));
+        let (status, json_patch) = render(&jd, "patch");
+        assert_eq!(status, JD_OK);
+        assert_eq!(patch(lhs, &json_patch, Some("patch")), (JD_OK, rhs.to_string()));
+        assert_eq!(patch(lhs, r#"{"a":[1,3],"b":null}"#, Some("merge")), (JD_OK, rhs.to_string()));
+        assert_eq!(diff("[1,2]", "[2,1]", Some(r#"["SET"]"#)), (JD_OK, String::new()));
+    }
+
+    #[test]
+    fn failures_return_messages() {
+        let (status, message) = diff("{", "{}", None);
+        assert_eq!(status, JD_ERROR);
+        assert!(message.starts_with("failed to parse the first document"));
+        assert_eq!(
+            render("", "yaml"),
+            (JD_ERROR, r#"unsupported format "yaml": expected "jd", "patch", or "merge""#.into())
+        );
+        assert_eq!(
+            patch("1", "@ []\n- 1\n", None),
+            (JD_ERROR, "the patch removed the whole document".into())
+        );
+    }
+
+    #[test]
+    fn invalid_arguments_are_reported() {
+        let mut out = ptr::null_mut();
+        let status = unsafe { jd_render(ptr::null(), text("jd").as_ptr(), &mut out) };
+        assert_eq!((status, take(out)), (JD_INVALID_ARGUMENT, "diff must not be NULL".into()));
+        let invalid = CString::new(vec![0xff]).unwrap();
+        let status = unsafe { jd_render(invalid.as_ptr(), text("jd").as_ptr(), &mut out) };
+        assert_eq!((status, take(out)), (JD_INVALID_ARGUMENT, "diff is not valid UTF-8".into()));
+        let status = unsafe { jd_render(ptr::null(), ptr::null(), ptr::null_mut()) };
+        assert_eq!(status, JD_INVALID_ARGUMENT);
+        unsafe { jd_free(ptr::null_mut()) };
+    }
+}
@@ -0,0 +1,247 @@
+//! Differential fuzzing against the Go `jd` binary.
+//!
+//! [`fuzz_differential`] builds two documents and a set of Go `jd` flags from
+//! the fuzzer's bytes, diffs the documents with `jd-core` and with the Go
+//! binary named by `JD_GO_BIN`, and panics when the outputs or exit statuses
+//! differ. It then applies the Go diff with both implementations and compares
+//! the patched documents. The documents draw keys and values from small
+//! pools, so the two sides share structure and set keys match.
+
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::sync::OnceLock;
+
+use arbitrary::Unstructured;
+use jd_core::{Diff, DiffOption, DiffOptions, Node, RenderConfig};
+use serde_json::{Map as JsonMap, Number as JsonNumber, Value as JsonValue};
+
+/// Environment variable naming the Go `jd` binary to compare against.
+pub const GO_BINARY_VAR: &str = "JD_GO_BIN";
+
+const KEYS: [&str; 4] = ["a", "b", "id", "name"];
+const STRINGS: [&str; 4] = ["", "x", "y", "id"];
+
+/// Diffs generated documents with `jd-core` and Go `jd` and panics on any
+/// difference. Without `JD_GO_BIN` set, the harness does nothing, so fuzz
+/// runs and tests on machines without Go still pass.
+///
+/// ```
+/// jd_fuzz::fuzz_differential(b"differential");
+/// ```
+pub fn fuzz_differential(data: &[u8]) {
+    let Some(go) = go_binary() else {
+        return;
+    };
+    let mut unstructured = Unstructured::new(data);
+    let Ok(case) = Case::arbitrary(&mut unstructured) else {
+        return;
+    };
+    case.check(go);
+}
+
+fn go_binary() -> Option<&'static Path> {
+    static BINARY: OnceLock<Option<PathBuf>> = OnceLock::new();
+    BINARY.get_or_init(|| std::env::var_os(GO_BINARY_VAR).map(PathBuf::from)).as_deref()
+}
+
+/// Output formats both implementations render.
+#[derive(Clone, Copy, Debug)]
+enum Format {
+    Native,
+    Patch,
+}
+
+/// One generated comparison: two documents, the Go flags, and the matching
+/// `jd-core` options.
+#[derive(Debug)]
+struct Case {
+    lhs: String,
+    rhs: String,
+    flags: Vec<String>,
+    options: DiffOptions,
+    format: Format,
+}
+
+impl Case {
+    fn arbitrary(unstructured: &mut Unstructured<'_>) -> arbitrary::Result<Self> {
+        let lhs = value(unstructured, 0)?.to_string();
+        let rhs = value(unstructured, 0)?.to_string();
+        let (flag, option) = match unstructured.int_in_range::<u8>(0..=4)? {
+            0 => (None, None),
+            1 => (Some("-set".to_string()), Some(DiffOption::Set)),
+            2 => (Some("-mset".to_string()), Some(DiffOption::MultiSet)),
+            3 => {
+                let key = *unstructured.choose(&KEYS)?;
+                (Some(format!("-setkeys={key}")), Some(DiffOption::SetKeys(vec![key.to_string()])))
+            }
+            _ => {
+                let precision = f64::from(unstructured.int_in_range::<u8>(1..=4)?) / 4.0;
+                (Some(format!("-precision={precision}")), Some(DiffOption::Precision(precision)))
+            }
+        };
+        let options = match option {
+            Some(option) => DiffOptions::default()
+                .with_option(option)
+                .map_err(|_| arbitrary::Error::IncorrectFormat)?,
+            None => DiffOptions::default(),
+        };
+        let format = if unstructured.arbitrary()? { Format::Patch } else { Format::Native };
+        let mut flags: Vec<String> = flag.into_iter().collect();
+        if let Format::Patch = format {
+            flags.push("-f=patch".to_string());
+        }
+        Ok(Self { lhs, rhs, flags, options, format })
+    }
+
+    fn check(&self, go: &Path) {
+        let files = Scratch::new();
+        let lhs_file = files.write("lhs.json", &self.lhs);
+        let rhs_file = files.write("rhs.json", &self.rhs);
+        let (go_output, go_status) = run(go, &self.flags, &[&lhs_file, &rhs_file]);
+
+        let lhs = Node::from_json_str(&self.lhs).expect("generated JSON");
+        let rhs = Node::from_json_str(&self.rhs).expect("generated JSON");
+        let diff = lhs.diff(&rhs, &self.options);
+        let rendered = match self.format {
+            Format::Native => Ok(diff.render(&RenderConfig::default())),
+            Format::Patch => diff.render_patch().map_err(|err| err.to_string()),
+        };
+        match (&rendered, go_status) {
+            (Ok(output), 0 | 1) => {
+                assert_eq!(output, &go_output, "diff output differs from Go jd for {self:?}");
+                let expected = if self.has_diff(output) { 1 } else { 0 };
+                assert_eq!(go_status, expected, "exit status differs from Go jd for {self:?}");
+            }
+            (Err(_), 2) => return,
+            _ => panic!("jd-core rendered {rendered:?} but Go jd exited {go_status} for {self:?}"),
+        }
+
+        if let Format::Native = self.format {
+            self.check_patch(go, &files, &go_output, &lhs, &lhs_file);
+        }
+    }
+
+    /// Applies the Go diff to the left document with both implementations.
+    fn check_patch(
+        &self,
+        go: &Path,
+        files: &Scratch,
+        diff_text: &str,
+        lhs: &Node,
+        lhs_file: &Path,
+    ) {
+        let diff_file = files.write("diff.jd", diff_text);
+        let (go_output, go_status) = run(go, &["-p".to_string()], &[&diff_file, lhs_file]);
+        let patched = Diff::from_native_str(diff_text)
+            .map_err(|err| err.to_string())
+            .and_then(|diff| lhs.apply_patch(&diff).map_err(|err| err.to_string()));
+        match (patched, go_status) {
+            (Ok(patched), 0 | 1) => {
+                let go_patched = Node::from_json_str(&go_output).expect("Go jd writes JSON");
+                assert_eq!(patched, go_patched, "patched document differs from Go jd for {self:?}");
+            }
+            (Err(_), 2) => {}
+            (patched, status) => {
+                panic!("jd-core patched to {patched:?} but Go jd exited {status} for {self:?}")
+            }
+        }
+    }
+
+    fn has_diff(&self, output: &str) -> bool {
+        match self.format {
+            Format::Native => !output.is_empty(),
+            Format::Patch => output != "[]",
+        }
+    }
+}
+
+/// Runs the Go binary, returning its standard output and exit status.
+fn run(go: &Path, flags: &[String], files: &[&Path]) -> (String, i32) {
+    let output = Command::new(go).args(flags).args(files).output().expect("run Go jd");
+    let stdout = String::from_utf8(output.stdout).expect("Go jd writes UTF-8");
+    (stdout, output.status.code().unwrap_or(-1))
+}
+
+/// A directory of input files for one case, removed when dropped.
+struct Scratch(PathBuf);
+
+impl Scratch {
+    fn new() -> Self {
+        static NEXT: AtomicUsize = AtomicUsize::new(0);
+        let name =
+            format!("jd-fuzz-{}-{}", std::process::id(), NEXT.fetch_add(1, Ordering::Relaxed));
+        let dir = std::env::temp_dir().join(name);
+        fs::create_dir_all(&dir).expect("create scratch directory");
+        Self(dir)
+    }
+
+    fn write(&self, name: &str, contents: &str) -> PathBuf {
+        let path = self.0.join(name);
+        fs::write(&path, contents).expect("write scratch file");
+        path
+    }
+}
+
+impl Drop for Scratch {
+    fn drop(&mut self) {
+        let _ = fs::remove_dir_all(&self.0);
+    }
+}
+
+fn value(unstructured: &mut Unstructured<'_>, depth: usize) -> arbitrary::Result<JsonValue> {
+    let last = if depth >= 3 { 3 } else { 5 };
+    Ok(match unstructured.int_in_range::<u8>(0..=last)? {
+        0 => JsonValue::Null,
+        1 => JsonValue::Bool(unstructured.arbitrary()?),
+        2 => {
+            let quarters = unstructured.int_in_range::<i8>(-8..=8)?;
+            let number = if quarters % 4 == 0 {
+                JsonNumber::from(quarters / 4)
+            } else {
+                JsonNumber::from_f64(f64::from(quarters) / 4.0).expect("finite")
+            };
+            JsonValue::Number(number)
+        }
+        3 => JsonValue::String((*unstructured.choose(&STRINGS)?).to_string()),
+        4 => {
+            let len = unstructured.int_in_range::<u8>(0..=4)?;
+            (0..len).map(|_| value(unstructured, depth + 1)).collect::<Result<_, _>>()?
+        }
+        _ => {
+            let mut map = JsonMap::new();
+            for _ in 0..unstructured.int_in_range::<u8>(0..=3)? {
+                let key = *unstructured.choose(&KEYS)?;
+                map.insert(key.to_string(), value(unstructured, depth + 1)?);
+            }
+            JsonValue::Object(map)
+        }
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn cases_pair_flags_with_options() {
+        let data: Vec<u8> = (0..=255).cycle().take(4096).collect();
+        let mut unstructured = Unstructured::new(&data);
+        for _ in 0..32 {
+            let Ok(case) = Case::arbitrary(&mut unstructured) else {
+                break;
+            };
+            assert!(Node::from_json_str(&case.lhs).is_ok());
+            let set_flags = case.flags.iter().filter(|flag| !flag.starts_with("-f=")).count();
+            assert!(set_flags <= 1);
+        }
+    }
+
+    #[test]
+    fn harness_is_inert_without_go() {
+        if go_binary().is_none() {
+            fuzz_differential(b"no go binary");
+        }
+    }
+}
@@ -28,6 +28,10 @@
 #![forbid(unsafe_code)]
 #![warn(missing_docs)]
 
+mod differential;
+
+pub use differential::{fuzz_differential, GO_BINARY_VAR};
+
 use arbitrary::Unstructured;
 use jd_core::{Diff, DiffOptions, Node};
 use serde_json::{self, Map as JsonMap, Number as JsonNumber, Value as JsonValue};
@@ -0,0 +1,42 @@
+import assert from "node:assert/strict";
+import { mkdtempSync, writeFileSync } from "node:fs";
+import { tmpdir } from "node:os";
+import { join } from "node:path";
+import { test } from "node:test";
+import { createRequire } from "node:module";
+
+const jd = createRequire(import.meta.url)("../index.js");
+
+const before = '{"name":"jd","tags":["a","b"]}';
+const after = '{"name":"jd","tags":["a","c"]}';
+const expected = '@ ["tags",1]\n  "a"\n- "b"\n+ "c"\n]\n';
+
+test("diff, render, and patch round-trip", () => {
+  const diff = jd.diff(before, after);
+  assert.equal(diff, expected);
+  assert.equal(jd.patch(before, diff), after);
+  assert.equal(jd.patch(before, jd.render(diff, "patch"), "patch"), after);
+  assert.equal(jd.diff("[1,2]", "[2,1]", '["SET"]'), "");
+});
+
+test("errors carry the CLI message", () => {
+  assert.throws(() => jd.diff("{", "{}"), /failed to parse the first document/);
+  assert.throws(() => jd.render("", "yaml"), /unsupported format "yaml"/);
+});
+
+test("async variants resolve off the event loop", async () => {
+  assert.equal(await jd.diffAsync(before, after), expected);
+  assert.equal(await jd.patchAsync('{"a":1}', '{"a":null}', "merge"), "{}");
+  await assert.rejects(jd.patchAsync("1", '@ []\n- 2\n'), /expected 2/);
+});
+
+test("file variants read JSON and YAML", async () => {
+  const dir = mkdtempSync(join(tmpdir(), "jd-node-"));
+  writeFileSync(join(dir, "before.yaml"), "name: jd\ntags: [a, b]\n");
+  writeFileSync(join(dir, "after.json"), after);
+  writeFileSync(join(dir, "change.jd"), expected);
+  const diff = await jd.diffFiles(join(dir, "before.yaml"), join(dir, "after.json"));
+  assert.equal(diff, expected);
+  assert.equal(await jd.patchFiles(join(dir, "before.yaml"), join(dir, "change.jd")), after);
+  await assert.rejects(jd.diffFiles(join(dir, "missing.json"), join(dir, "after.json")), /failed to read/);
+});
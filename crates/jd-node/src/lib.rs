@@ -0,0 +1,193 @@
+//! Node.js bindings for the Rust port of the `jd` tool.
+//!
+//! The functions mirror the `jd-wasm` package but run natively: `diff`,
+//! `patch`, and `render` work on strings synchronously, while `diffAsync`,
+//! `patchAsync`, `diffFiles`, and `patchFiles` run on the libuv thread pool
+//! and return promises, so large documents never block the event loop. The
+//! file variants read JSON, or YAML for `.yaml` and `.yml` paths, straight
+//! from disk. Errors reject or throw with the CLI's messages.
+#![warn(missing_docs)]
+
+use std::path::Path;
+
+use anyhow::{bail, Context};
+use jd_core::{Diff, DiffOptions, Node, RenderConfig};
+use napi::bindgen_prelude::{AbortSignal, AsyncTask};
+use napi::{Env, Error, Result, Task};
+use napi_derive::napi;
+
+/// Diffs two JSON documents and returns the native jd diff, which is empty
+/// when they are equal. `options` holds jd's JSON diff options, such as
+/// `'["SET"]'`.
+#[napi]
+pub fn diff(lhs: String, rhs: String, options: Option<String>) -> Result<String> {
+    let (lhs, rhs) = (parse(&lhs, "first document")?, parse(&rhs, "second document")?);
+    diff_nodes(&lhs, &rhs, options.as_deref()).map_err(reason)
+}
+
+/// Applies `patch`, written in `format` (`"jd"`, `"patch"`, or `"merge"`;
+/// `"jd"` by default), to a JSON document and returns the patched document.
+#[napi]
+pub fn patch(
+    document: String,
+    patch: String,
+    format: Option<String>,
+    options: Option<String>,
+) -> Result<String> {
+    let document = parse(&document, "document")?;
+    patch_node(&document, &patch, format.as_deref(), options.as_deref()).map_err(reason)
+}
+
+/// Renders a native jd diff as `"jd"`, `"patch"` (RFC 6902), or `"merge"`
+/// (RFC 7386). Only merge diffs, which start with `^ {"Merge":true}`,
+/// render as merge patches.
+#[napi]
+pub fn render(diff: String, format: String) -> Result<String> {
+    let diff = Diff::from_native_str(&diff).map_err(|err| reason(err.into()))?;
+    match format.as_str() {
+        "jd" => Ok(diff.render(&RenderConfig::default())),
+        "patch" => diff.render_patch().context("failed to render JSON Patch").map_err(reason),
+        "merge" => diff.render_merge().context("failed to render JSON Merge Patch").map_err(reason),
+        _ => Err(reason(unsupported_format(&format))),
+    }
+}
+
+/// Like [`diff`], on the thread pool.
+#[napi(ts_return_type = "Promise<string>")]
+pub fn diff_async(
+    lhs: String,
+    rhs: String,
+    options: Option<String>,
+    signal: Option<AbortSignal>,
+) -> AsyncTask<Job> {
+    Job::spawn(signal, move || diff(lhs, rhs, options))
+}
+
+/// Like [`patch`], on the thread pool.
+#[napi(ts_return_type = "Promise<string>")]
+pub fn patch_async(
+    document: String,
+    patch_text: String,
+    format: Option<String>,
+    options: Option<String>,
+    signal: Option<AbortSignal>,
+) -> AsyncTask<Job> {
+    Job::spawn(signal, move || patch(document, patch_text, format, options))
+}
+
+/// Reads and diffs two files on the thread pool.
+#[napi(ts_return_type = "Promise<string>")]
+pub fn diff_files(
+    lhs_path: String,
+    rhs_path: String,
+    options: Option<String>,
+    signal: Option<AbortSignal>,
+) -> AsyncTask<Job> {
+    Job::spawn(signal, move || {
+        let (lhs, rhs) = (read(&lhs_path)?, read(&rhs_path)?);
+        diff_nodes(&lhs, &rhs, options.as_deref()).map_err(reason)
+    })
+}
+
+/// Reads a document and a patch from disk and applies the patch on the
+/// thread pool. The patched document is returned, not written back.
+#[napi(ts_return_type = "Promise<string>")]
+pub fn patch_files(
+    document_path: String,
+    patch_path: String,
+    format: Option<String>,
+    options: Option<String>,
+    signal: Option<AbortSignal>,
+) -> AsyncTask<Job> {
+    Job::spawn(signal, move || {
+        let document = read(&document_path)?;
+        let patch = std::fs::read_to_string(&patch_path)
+            .with_context(|| format!("failed to read {patch_path}"))
+            .map_err(reason)?;
+        patch_node(&document, &patch, format.as_deref(), options.as_deref()).map_err(reason)
+    })
+}
+
+/// A call queued on the thread pool by the asynchronous functions.
+pub struct Job(Option<Box<dyn FnOnce() -> Result<String> + Send>>);
+
+impl Job {
+    fn spawn(
+        signal: Option<AbortSignal>,
+        work: impl FnOnce() -> Result<String> + Send + 'static,
+    ) -> AsyncTask<Job> {
+        AsyncTask::with_optional_signal(Job(Some(Box::new(work))), signal)
+    }
+}
+
+#[napi]
+impl Task for Job {
+    type Output = String;
+    type JsValue = String;
+
+    fn compute(&mut self) -> Result<String> {
+        match self.0.take() {
+            Some(work) => work(),
+            None => Err(Error::from_reason("jd job already ran")),
+        }
+    }
+
+    fn resolve(&mut self, _env: Env, output: String) -> Result<String> {
+        Ok(output)
+    }
+}
+
+fn diff_nodes(lhs: &Node, rhs: &Node, options: Option<&str>) -> anyhow::Result<String> {
+    Ok(lhs.diff(rhs, &parse_options(options)?).render(&RenderConfig::default()))
+}
+
+fn patch_node(
+    document: &Node,
+    patch: &str,
+    format: Option<&str>,
+    options: Option<&str>,
+) -> anyhow::Result<String> {
+    let patched = match format.unwrap_or("jd") {
+        "jd" => {
+            let diff = Diff::from_native_str(patch)?;
+            document.apply_patch_with_options(&diff, &parse_options(options)?)?
+        }
+        "patch" => document.apply_json_patch(patch)?,
+        "merge" => document.apply_merge_patch(patch)?,
+        format => return Err(unsupported_format(format)),
+    };
+    match patched.to_json_value() {
+        Some(value) => Ok(value.to_string()),
+        None => bail!("the patch removed the whole document"),
+    }
+}
+
+fn parse(text: &str, what: &str) -> Result<Node> {
+    Node::from_json_str(text).with_context(|| format!("failed to parse the {what}")).map_err(reason)
+}
+
+/// Reads a JSON document, or a YAML one when the extension says so.
+fn read(path: &str) -> Result<Node> {
+    let yaml = Path::new(path)
+        .extension()
+        .is_some_and(|extension| extension == "yaml" || extension == "yml");
+    let node = if yaml { Node::from_yaml_file(path) } else { Node::from_json_file(path) };
+    node.map_err(|err| reason(err.into()))
+}
+
+fn parse_options(options: Option<&str>) -> anyhow::Result<DiffOptions> {
+    match options {
+        Some(options) if !options.trim().is_empty() => {
+            DiffOptions::from_json_str(options).context("invalid diff options")
+        }
+        _ => Ok(DiffOptions::default()),
+    }
+}
+
+fn unsupported_format(format: &str) -> anyhow::Error {
+    anyhow::anyhow!("unsupported format {format:?}: expected \"jd\", \"patch\", or \"merge\"")
+}
+
+fn reason(err: anyhow::Error) -> Error {
+    Error::from_reason(format!("{err:#}"))
+}
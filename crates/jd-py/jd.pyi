@@ -0,0 +1,27 @@
+"""JSON diff and patch, backed by the Rust port of jd."""
+
+from typing import Any, Literal, Optional, Sequence, Union
+
+JSON = Any
+Format = Literal["jd", "patch", "merge"]
+
+class JdError(ValueError):
+    """Raised when jd cannot diff, render, or patch its inputs."""
+
+def diff(
+    a: JSON,
+    b: JSON,
+    *,
+    set: bool = False,
+    multiset: bool = False,
+    setkeys: Optional[Sequence[str]] = None,
+    precision: Optional[float] = None,
+    options: Optional[list] = None,
+) -> str:
+    """Diffs two documents and returns the native jd diff, empty when they are equal."""
+
+def patch(document: JSON, diff: Union[str, list, dict], *, options: Optional[list] = None) -> JSON:
+    """Applies a jd diff (str), JSON Patch (list), or JSON Merge Patch (dict) to a document."""
+
+def render(diff: str, format: Format = "patch") -> Union[str, list, dict]:
+    """Renders a native jd diff as jd text, a JSON Patch list, or a JSON Merge Patch dict."""
@@ -0,0 +1,311 @@
+//! Python bindings for the Rust port of the `jd` tool.
+//!
+//! The `jd` extension module diffs and patches native Python values:
+//! documents are `dict`s, `list`s, and scalars as produced by `json.load`,
+//! diffs are native jd text, and rendered JSON Patch and JSON Merge Patch
+//! documents come back as `list`s and `dict`s. Failures raise `jd.JdError`,
+//! a `ValueError` carrying the same message as the CLI.
+//!
+//! ```python
+//! import jd
+//!
+//! diff = jd.diff({"tags": ["a", "b"]}, {"tags": ["b", "a"]}, set=True)
+//! assert diff == ""
+//! ```
+
+use anyhow::{bail, Context, Result};
+use jd_core::{ArrayMode, Diff, DiffOptions, Node, RenderConfig};
+use pyo3::create_exception;
+use pyo3::exceptions::{PyTypeError, PyValueError};
+use pyo3::prelude::*;
+use pyo3::types::{PyBool, PyDict, PyFloat, PyInt, PyList, PyString, PyTuple};
+use serde_json::{Map as JsonMap, Number as JsonNumber, Value as JsonValue};
+
+create_exception!(
+    jd,
+    JdError,
+    PyValueError,
+    "Raised when jd cannot diff, render, or patch its inputs."
+);
+
+/// The `jd` Python module.
+#[pymodule]
+fn jd(module: &Bound<'_, PyModule>) -> PyResult<()> {
+    module.add_function(wrap_pyfunction!(diff, module)?)?;
+    module.add_function(wrap_pyfunction!(patch, module)?)?;
+    module.add_function(wrap_pyfunction!(render, module)?)?;
+    module.add("JdError", module.py().get_type_bound::<JdError>())?;
+    Ok(())
+}
+
+/// Diffs two documents and returns the native jd diff, which is empty when
+/// they are equal. The keyword options mirror the CLI flags; `options`
+/// takes jd's JSON diff options, such as `["SET"]`.
+#[pyfunction]
+#[pyo3(signature = (a, b, *, set = false, multiset = false, setkeys = None, precision = None, options = None))]
+fn diff(
+    a: &Bound<'_, PyAny>,
+    b: &Bound<'_, PyAny>,
+    set: bool,
+    multiset: bool,
+    setkeys: Option<Vec<String>>,
+    precision: Option<f64>,
+    options: Option<&Bound<'_, PyAny>>,
+) -> PyResult<String> {
+    let options = options.map(to_json).transpose()?;
+    let options = diff_options(set, multiset, setkeys, precision, options).map_err(jd_error)?;
+    let (a, b) = (to_node(a)?, to_node(b)?);
+    Ok(a.diff(&b, &options).render(&RenderConfig::default()))
+}
+
+/// Applies `diff` to `document` and returns the patched document. A `str`
+/// is read as a native jd diff, a `list` as JSON Patch, and a `dict` as
+/// JSON Merge Patch; `options` apply to jd diffs as in `diff`.
+#[pyfunction]
+#[pyo3(signature = (document, diff, *, options = None))]
+fn patch(
+    py: Python<'_>,
+    document: &Bound<'_, PyAny>,
+    diff: &Bound<'_, PyAny>,
+    options: Option<&Bound<'_, PyAny>>,
+) -> PyResult<PyObject> {
+    let patch = if diff.is_instance_of::<PyString>() {
+        Patch::Native(diff.extract()?)
+    } else if diff.is_instance_of::<PyList>() {
+        Patch::Json(to_json(diff)?)
+    } else if diff.is_instance_of::<PyDict>() {
+        Patch::Merge(to_json(diff)?)
+    } else {
+        return Err(PyTypeError::new_err(
+            "diff must be a str (jd), list (JSON Patch), or dict (JSON Merge Patch)",
+        ));
+    };
+    let options = options.map(to_json).transpose()?;
+    let options = diff_options(false, false, None, None, options).map_err(jd_error)?;
+    let patched = apply(&to_node(document)?, &patch, &options).map_err(jd_error)?;
+    to_python(py, &patched)
+}
+
+/// Renders a native jd diff as `"jd"` text, a `"patch"` (RFC 6902) `list`,
+/// or a `"merge"` (RFC 7386) `dict`. Only merge diffs, which start with
+/// `^ {"Merge":true}`, render as merge patches.
+#[pyfunction]
+#[pyo3(signature = (diff, format = String::from("patch")))]
+fn render(py: Python<'_>, diff: String, format: String) -> PyResult<PyObject> {
+    match render_diff(&diff, &format).map_err(jd_error)? {
+        Rendered::Text(text) => Ok(text.to_object(py)),
+        Rendered::Json(value) => to_python(py, &value),
+    }
+}
+
+/// A patch handed to [`patch`], classified by its Python type.
+enum Patch {
+    Native(String),
+    Json(JsonValue),
+    Merge(JsonValue),
+}
+
+/// Output of [`render_diff`]: jd text, or a JSON document for Python.
+#[derive(Debug, PartialEq)]
+enum Rendered {
+    Text(String),
+    Json(JsonValue),
+}
+
+/// Builds diff options like the CLI's `-set`, `-mset`, `-setkeys`, and
+/// `-precision` flags, on top of Go-compatible JSON `options`.
+fn diff_options(
+    set: bool,
+    multiset: bool,
+    setkeys: Option<Vec<String>>,
+    precision: Option<f64>,
+    options: Option<JsonValue>,
+) -> Result<DiffOptions> {
+    let mut result = match options {
+        Some(options) => {
+            DiffOptions::from_json_str(&options.to_string()).context("invalid diff options")?
+        }
+        None => DiffOptions::default(),
+    };
+    if set {
+        result = result.with_array_mode(ArrayMode::Set)?;
+    }
+    if let Some(keys) = setkeys {
+        result = result.with_set_keys(keys)?;
+    }
+    if multiset {
+        result = result.with_array_mode(ArrayMode::MultiSet)?;
+    }
+    if let Some(precision) = precision {
+        result = result.with_precision(precision)?;
+    }
+    Ok(result)
+}
+
+fn render_diff(diff: &str, format: &str) -> Result<Rendered> {
+    let diff = Diff::from_native_str(diff)?;
+    let rendered = match format {
+        "jd" => return Ok(Rendered::Text(diff.render(&RenderConfig::default()))),
+        "patch" => diff.render_patch().context("failed to render JSON Patch")?,
+        "merge" => diff.render_merge().context("failed to render JSON Merge Patch")?,
+        _ => bail!("unsupported format {format:?}: expected \"jd\", \"patch\", or \"merge\""),
+    };
+    Ok(Rendered::Json(serde_json::from_str(&rendered)?))
+}
+
+fn apply(document: &Node, patch: &Patch, options: &DiffOptions) -> Result<JsonValue> {
+    let patched = match patch {
+        Patch::Native(text) => {
+            document.apply_patch_with_options(&Diff::from_native_str(text)?, options)?
+        }
+        Patch::Json(value) => document.apply_json_patch(&value.to_string())?,
+        Patch::Merge(value) => document.apply_merge_patch(&value.to_string())?,
+    };
+    match patched.to_json_value() {
+        Some(value) => Ok(value),
+        None => bail!("the patch removed the whole document"),
+    }
+}
+
+fn to_node(value: &Bound<'_, PyAny>) -> PyResult<Node> {
+    Node::from_json_value(to_json(value)?).map_err(|err| jd_error(err.into()))
+}
+
+/// Converts a Python value built from `dict`, `list`, `tuple`, `str`, `int`,
+/// `float`, `bool`, and `None` into JSON.
+fn to_json(value: &Bound<'_, PyAny>) -> PyResult<JsonValue> {
+    if value.is_none() {
+        Ok(JsonValue::Null)
+    } else if value.is_instance_of::<PyBool>() {
+        Ok(JsonValue::Bool(value.extract()?))
+    } else if value.is_instance_of::<PyInt>() {
+        let digits: String = value.str()?.extract()?;
+        let number =
+            digits.parse::<JsonNumber>().map_err(|err| JdError::new_err(err.to_string()))?;
+        Ok(JsonValue::Number(number))
+    } else if value.is_instance_of::<PyFloat>() {
+        let float: f64 = value.extract()?;
+        JsonNumber::from_f64(float)
+            .map(JsonValue::Number)
+            .ok_or_else(|| JdError::new_err(format!("{float} is not a JSON number")))
+    } else if value.is_instance_of::<PyString>() {
+        Ok(JsonValue::String(value.extract()?))
+    } else if let Ok(dict) = value.downcast::<PyDict>() {
+        let mut map = JsonMap::new();
+        for (key, item) in dict.iter() {
+            let key: String =
+                key.extract().map_err(|_| PyTypeError::new_err("object keys must be str"))?;
+            map.insert(key, to_json(&item)?);
+        }
+        Ok(JsonValue::Object(map))
+    } else if value.is_instance_of::<PyList>() || value.is_instance_of::<PyTuple>() {
+        let items = value.iter()?.map(|item| to_json(&item?)).collect::<PyResult<_>>()?;
+        Ok(JsonValue::Array(items))
+    } else {
+        Err(PyTypeError::new_err(format!("cannot convert {} to JSON", value.get_type().name()?)))
+    }
+}
+
+/// Converts JSON into `dict`, `list`, `str`, `int`, `float`, `bool`, and
+/// `None` values. Integers of any size stay `int`s.
+fn to_python(py: Python<'_>, value: &JsonValue) -> PyResult<PyObject> {
+    Ok(match value {
+        JsonValue::Null => py.None(),
+        JsonValue::Bool(flag) => flag.to_object(py),
+        JsonValue::Number(number) => {
+            if let Some(int) = number.as_i64() {
+                int.to_object(py)
+            } else if let Some(int) = number.as_u64() {
+                int.to_object(py)
+            } else if is_integer_literal(&number.to_string()) {
+                py.get_type_bound::<PyInt>().call1((number.to_string(),))?.unbind()
+            } else {
+                number.as_f64().unwrap_or(f64::NAN).to_object(py)
+            }
+        }
+        JsonValue::String(text) => text.to_object(py),
+        JsonValue::Array(items) => {
+            let list = PyList::empty_bound(py);
+            for item in items {
+                list.append(to_python(py, item)?)?;
+            }
+            list.into_any().unbind()
+        }
+        JsonValue::Object(map) => {
+            let dict = PyDict::new_bound(py);
+            for (key, item) in map {
+                dict.set_item(key, to_python(py, item)?)?;
+            }
+            dict.into_any().unbind()
+        }
+    })
+}
+
+fn is_integer_literal(literal: &str) -> bool {
+    !literal.contains(['.', 'e', 'E'])
+}
+
+fn jd_error(err: anyhow::Error) -> PyErr {
+    JdError::new_err(format!("{err:#}"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn json(text: &str) -> JsonValue {
+        serde_json::from_str(text).unwrap()
+    }
+
+    #[test]
+    fn keyword_options_combine_with_json_options() {
+        let setkeys = Some(vec!["id".to_string()]);
+        let options = diff_options(false, false, setkeys, None, Some(json(r#"["SET"]"#))).unwrap();
+        assert_eq!(options.array_mode(), ArrayMode::Set);
+        assert_eq!(options.set_keys(), Some(&["id".to_string()][..]));
+        let options = diff_options(false, true, None, None, None).unwrap();
+        assert_eq!(options.array_mode(), ArrayMode::MultiSet);
+        let options = diff_options(false, false, None, Some(0.1), None).unwrap();
+        let lhs = Node::from_json_str("[1.0]").unwrap();
+        assert!(lhs.diff(&Node::from_json_str("[1.05]").unwrap(), &options).is_empty());
+        let err = diff_options(false, false, None, None, Some(json(r#"["SETS"]"#))).unwrap_err();
+        assert!(format!("{err:#}").starts_with("invalid diff options: "));
+    }
+
+    #[test]
+    fn renders_return_json_documents() {
+        let rendered = render_diff("@ [\"a\"]\n+ 1\n", "patch").unwrap();
+        assert_eq!(rendered, Rendered::Json(json(r#"[{"op":"add","path":"/a","value":1}]"#)));
+        let rendered = render_diff("^ {\"Merge\":true}\n@ [\"a\"]\n+ 1\n", "merge").unwrap();
+        assert_eq!(rendered, Rendered::Json(json(r#"{"a":1}"#)));
+        let rendered = render_diff("@ [\"a\"]\n+ 1\n", "jd").unwrap();
+        assert_eq!(rendered, Rendered::Text("@ [\"a\"]\n+ 1\n".into()));
+        let err = render_diff("", "yaml").unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            r#"unsupported format "yaml": expected "jd", "patch", or "merge""#
+        );
+    }
+
+    #[test]
+    fn patches_apply_by_kind() {
+        let document = Node::from_json_str(r#"{"a":1,"b":2}"#).unwrap();
+        let options = DiffOptions::default();
+        for patch in [
+            Patch::Native("@ [\"b\"]\n- 2\n".into()),
+            Patch::Json(json(r#"[{"op":"remove","path":"/b"}]"#)),
+            Patch::Merge(json(r#"{"b":null}"#)),
+        ] {
+            assert_eq!(apply(&document, &patch, &options).unwrap(), json(r#"{"a":1}"#));
+        }
+        let err = apply(&document, &Patch::Native("@ []\n- {\"a\":1,\"b\":2}\n".into()), &options);
+        assert_eq!(err.unwrap_err().to_string(), "the patch removed the whole document");
+    }
+
+    #[test]
+    fn integer_literals_are_recognised() {
+        assert!(is_integer_literal("123456789012345678901234567890"));
+        assert!(!is_integer_literal("1.5"));
+        assert!(!is_integer_literal("1e400"));
+    }
+}
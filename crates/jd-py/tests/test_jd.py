@@ -0,0 +1,54 @@
+"""Exercises the `jd` extension module; run with pytest after `maturin develop`."""
+
+import pytest
+
+import jd
+
+
+BEFORE = {"name": "jd", "tags": ["a", "b"], "size": 10**30}
+AFTER = {"name": "jd", "tags": ["a", "c"], "size": 10**30}
+
+
+def test_diff_returns_native_jd_text():
+    assert jd.diff(BEFORE, AFTER) == '@ ["tags",1]\n  "a"\n- "b"\n+ "c"\n]\n'
+    assert jd.diff(BEFORE, BEFORE) == ""
+
+
+def test_keyword_options_match_cli_flags():
+    assert jd.diff([1, 2], [2, 1], set=True) == ""
+    assert jd.diff([1, 1], [1], multiset=True) != ""
+    assert jd.diff({"n": 1.0}, {"n": 1.05}, precision=0.1) == ""
+    assert jd.diff([{"id": 1, "v": 1}], [{"id": 1, "v": 2}], setkeys=["id"]) != ""
+    assert jd.diff([1, 2], [2, 1], options=["SET"]) == ""
+
+
+def test_patch_accepts_every_diff_kind():
+    diff = jd.diff(BEFORE, AFTER)
+    assert jd.patch(BEFORE, diff) == AFTER
+    assert jd.patch(BEFORE, jd.render(diff, "patch")) == AFTER
+    assert jd.patch({"a": 1, "b": 2}, {"b": None}) == {"a": 1}
+
+
+def test_render_returns_native_objects():
+    diff = '@ ["a"]\n+ 1\n'
+    assert jd.render(diff) == [{"op": "add", "path": "/a", "value": 1}]
+    assert jd.render(diff, "jd") == diff
+    assert jd.render('^ {"Merge":true}\n@ ["a"]\n+ 1\n', "merge") == {"a": 1}
+
+
+def test_large_integers_round_trip():
+    patched = jd.patch({}, '@ ["n"]\n+ 123456789012345678901234567890\n')
+    assert patched == {"n": 123456789012345678901234567890}
+
+
+def test_errors_raise_jd_error():
+    with pytest.raises(jd.JdError, match="unsupported format"):
+        jd.render("", "yaml")
+    with pytest.raises(jd.JdError, match="invalid diff options"):
+        jd.diff([], [], options=["SETS"])
+    with pytest.raises(ValueError):
+        jd.patch({"a": 1}, '@ ["a"]\n- 2\n')
+    with pytest.raises(TypeError, match="object keys must be str"):
+        jd.diff({1: "a"}, {})
+    with pytest.raises(TypeError):
+        jd.patch({}, 42)
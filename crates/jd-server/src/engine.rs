@@ -0,0 +1,151 @@
+//! Transport-independent request handling.
+//!
+//! Every RPC reduces to one of these functions over plain strings, which
+//! keeps the gRPC layer a thin mapping and lets other front ends share the
+//! same behavior and error messages.
+
+use std::str::FromStr;
+
+use anyhow::{bail, Context, Result};
+use jd_core::{Diff, DiffOptions, Node, RenderConfig, Translation};
+
+/// The format of a patch passed to [`patch`].
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+pub enum Format {
+    /// Native jd diff.
+    #[default]
+    Jd,
+    /// JSON Patch (RFC 6902).
+    Patch,
+    /// JSON Merge Patch (RFC 7386).
+    Merge,
+}
+
+impl FromStr for Format {
+    type Err = anyhow::Error;
+
+    fn from_str(name: &str) -> Result<Self> {
+        match name {
+            "jd" => Ok(Self::Jd),
+            "patch" => Ok(Self::Patch),
+            "merge" => Ok(Self::Merge),
+            _ => bail!("unsupported format {name:?}: expected \"jd\", \"patch\", or \"merge\""),
+        }
+    }
+}
+
+/// Diffs two documents and renders the result as native jd text.
+///
+/// ```
+/// let diff = jd_server::engine::diff(r#"{"a":1}"#, r#"{"a":2}"#, false, "").unwrap();
+/// assert_eq!(diff, "@ [\"a\"]\n- 1\n+ 2\n");
+/// ```
+pub fn diff(lhs: &str, rhs: &str, yaml: bool, options: &str) -> Result<String> {
+    let options = parse_options(options)?;
+    let lhs = parse(lhs, yaml).context("failed to parse the first document")?;
+    let rhs = parse(rhs, yaml).context("failed to parse the second document")?;
+    Ok(lhs.diff(&rhs, &options).render(&RenderConfig::default()))
+}
+
+/// Applies `patch`, written in `format`, to a document and returns the
+/// patched document as compact JSON, or as YAML when `yaml` is set.
+///
+/// ```
+/// use jd_server::engine::{patch, Format};
+///
+/// let patched = patch(r#"{"a":1}"#, r#"{"a":null,"b":2}"#, Format::Merge, false, "");
+/// assert_eq!(patched.unwrap(), r#"{"b":2}"#);
+/// ```
+pub fn patch(
+    document: &str,
+    patch: &str,
+    format: Format,
+    yaml: bool,
+    options: &str,
+) -> Result<String> {
+    let document = parse(document, yaml).context("failed to parse the document")?;
+    let patched = match format {
+        Format::Jd => {
+            let diff = Diff::from_native_str(patch)?;
+            document.apply_patch_with_options(&diff, &parse_options(options)?)?
+        }
+        Format::Patch => document.apply_json_patch(patch)?,
+        Format::Merge => document.apply_merge_patch(patch)?,
+    };
+    let rendered = if yaml {
+        patched.to_yaml_string()
+    } else {
+        patched.to_json_value().map(|value| value.to_string())
+    };
+    match rendered {
+        Some(rendered) => Ok(rendered),
+        None => bail!("the patch removed the whole document"),
+    }
+}
+
+/// Runs a `jd -t` translation, named like `jd2patch`.
+///
+/// ```
+/// let patch = jd_server::engine::translate("@ [\"a\"]\n+ 1\n", "jd2patch").unwrap();
+/// assert_eq!(patch, r#"[{"op":"add","path":"/a","value":1}]"#);
+/// ```
+pub fn translate(input: &str, translation: &str) -> Result<String> {
+    let translation: Translation = translation.parse()?;
+    translation.apply(input).with_context(|| format!("failed to translate with {translation}"))
+}
+
+fn parse(text: &str, yaml: bool) -> Result<Node> {
+    Ok(if yaml { Node::from_yaml_str(text)? } else { Node::from_json_str(text)? })
+}
+
+fn parse_options(options: &str) -> Result<DiffOptions> {
+    if options.trim().is_empty() {
+        return Ok(DiffOptions::default());
+    }
+    DiffOptions::from_json_str(options).context("invalid diff options")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn diffs_apply_in_every_format() {
+        let (lhs, rhs) = (r#"{"a":[1,2],"b":true}"#, r#"{"a":[1,3]}"#);
+        let native = diff(lhs, rhs, false, "").unwrap();
+        assert_eq!(patch(lhs, &native, Format::Jd, false, "").unwrap(), rhs);
+        let json_patch = translate(&native, "jd2patch").unwrap();
+        assert_eq!(patch(lhs, &json_patch, Format::Patch, false, "").unwrap(), rhs);
+        assert_eq!(patch(lhs, r#"{"a":[1,3],"b":null}"#, Format::Merge, false, "").unwrap(), rhs);
+    }
+
+    #[test]
+    fn yaml_documents_round_trip() {
+        let native = diff("a: 1\n", "a: 2\n", true, "").unwrap();
+        assert_eq!(native, "@ [\"a\"]\n- 1\n+ 2\n");
+        assert_eq!(patch("a: 1\n", &native, Format::Jd, true, "").unwrap(), "a: 2\n");
+    }
+
+    #[test]
+    fn options_apply_to_diffs() {
+        assert!(diff("[1,2]", "[2,1]", false, r#"["SET"]"#).unwrap().is_empty());
+        assert!(!diff("[1,2]", "[2,1]", false, " ").unwrap().is_empty());
+    }
+
+    #[test]
+    fn errors_name_the_failing_input() {
+        let err = diff("{", "{}", false, "").unwrap_err();
+        assert!(format!("{err:#}").starts_with("failed to parse the first document: "));
+        let err = diff("{}", "{}", false, r#"["SETS"]"#).unwrap_err();
+        assert!(format!("{err:#}").starts_with("invalid diff options: "));
+        let err = patch("1", "@ []\n- 1\n", Format::Jd, false, "").unwrap_err();
+        assert_eq!(err.to_string(), "the patch removed the whole document");
+        let err = translate("", "jd2xml").unwrap_err();
+        assert_eq!(err.to_string(), r#"unsupported translation: "jd2xml""#);
+        let err = "yaml".parse::<Format>().unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            r#"unsupported format "yaml": expected "jd", "patch", or "merge""#
+        );
+    }
+}
@@ -0,0 +1,279 @@
+//! HTTP JSON API, for callers and sidecar deployments without gRPC.
+//!
+//! [`router`] serves `POST /diff`, `POST /patch`, and `POST /translate`,
+//! whose JSON bodies carry the same fields as the gRPC messages and share
+//! [`engine`](crate::engine). `format` is `"jd"`, `"patch"`, or `"merge"`,
+//! and `options` may be jd's JSON diff options either inline or as a string.
+//! As over gRPC, the engine runs on Tokio's blocking pool. Every failure is answered with a structured body,
+//! `{"error":{"code":"...","message":"..."}}`, whose `code` is stable:
+//!
+//! - `invalid_argument` (400) for input the engine rejects;
+//! - `invalid_request` (400 or 422) for bodies that are not the expected JSON;
+//! - `unsupported_media_type` (415) without a JSON `Content-Type`;
+//! - `payload_too_large` (413) for bodies over the size limit;
+//! - `not_found` (404) and `method_not_allowed` (405) for other routes;
+//! - `internal` (500) if the engine panics.
+
+use axum::extract::rejection::JsonRejection;
+use axum::extract::DefaultBodyLimit;
+use axum::http::StatusCode;
+use axum::response::{IntoResponse, Response};
+use axum::routing::post;
+use axum::{Json, Router};
+use serde::Deserialize;
+use serde_json::{json, Value};
+
+use crate::engine::{self, Format};
+
+/// Default request body limit, the same as the gRPC service's.
+pub const DEFAULT_MAX_BODY_BYTES: usize = crate::DEFAULT_MAX_REQUEST_BYTES;
+
+/// Builds the HTTP API, rejecting request bodies over `max_body_bytes`.
+///
+/// The limit is a [`DefaultBodyLimit`] layer, which replaces axum's own
+/// 2 MB default for the [`Json`] extractor of every route. A body over it
+/// is refused with `payload_too_large` before it is parsed, including one
+/// sent without a `Content-Length` that only turns out too large as it
+/// streams in.
+///
+/// ```no_run
+/// # async fn run() -> std::io::Result<()> {
+/// let app = jd_server::http::router(jd_server::http::DEFAULT_MAX_BODY_BYTES);
+/// let listener = tokio::net::TcpListener::bind("127.0.0.1:8080").await?;
+/// axum::serve(listener, app).await
+/// # }
+/// ```
+pub fn router(max_body_bytes: usize) -> Router {
+    Router::new()
+        .route("/diff", post(diff).fallback(method_not_allowed))
+        .route("/patch", post(patch).fallback(method_not_allowed))
+        .route("/translate", post(translate).fallback(method_not_allowed))
+        .fallback(not_found)
+        .layer(DefaultBodyLimit::max(max_body_bytes))
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct DiffRequest {
+    lhs: String,
+    rhs: String,
+    #[serde(default)]
+    yaml: bool,
+    #[serde(default)]
+    options: Value,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct PatchRequest {
+    document: String,
+    patch: String,
+    format: Option<String>,
+    #[serde(default)]
+    yaml: bool,
+    #[serde(default)]
+    options: Value,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct TranslateRequest {
+    input: String,
+    translation: String,
+}
+
+async fn diff(request: Result<Json<DiffRequest>, JsonRejection>) -> Result<Json<Value>, Error> {
+    let Json(request) = request?;
+    let diff = blocking(move || {
+        engine::diff(&request.lhs, &request.rhs, request.yaml, &options(&request.options))
+    })
+    .await?;
+    Ok(Json(json!({ "diff": diff })))
+}
+
+async fn patch(request: Result<Json<PatchRequest>, JsonRejection>) -> Result<Json<Value>, Error> {
+    let Json(request) = request?;
+    let format = match request.format.as_deref() {
+        Some(format) => format.parse()?,
+        None => Format::default(),
+    };
+    let document = blocking(move || {
+        let options = options(&request.options);
+        engine::patch(&request.document, &request.patch, format, request.yaml, &options)
+    })
+    .await?;
+    Ok(Json(json!({ "document": document })))
+}
+
+async fn translate(
+    request: Result<Json<TranslateRequest>, JsonRejection>,
+) -> Result<Json<Value>, Error> {
+    let Json(request) = request?;
+    let output = blocking(move || engine::translate(&request.input, &request.translation)).await?;
+    Ok(Json(json!({ "output": output })))
+}
+
+async fn not_found() -> Error {
+    Error::new(StatusCode::NOT_FOUND, "not_found", "not found".to_string())
+}
+
+async fn method_not_allowed() -> Error {
+    Error::new(StatusCode::METHOD_NOT_ALLOWED, "method_not_allowed", "use POST".to_string())
+}
+
+/// Runs `work` on the blocking pool, so a large document does not hold up
+/// the other requests on its runtime thread.
+async fn blocking<T: Send + 'static>(
+    work: impl FnOnce() -> anyhow::Result<T> + Send + 'static,
+) -> Result<T, Error> {
+    let result = tokio::task::spawn_blocking(work).await.map_err(|err| {
+        Error::new(
+            StatusCode::INTERNAL_SERVER_ERROR,
+            "internal",
+            format!("engine task failed: {err}"),
+        )
+    })?;
+    Ok(result?)
+}
+
+/// Accepts options inline (`["SET"]`) or as the string the engine takes.
+fn options(options: &Value) -> String {
+    match options {
+        Value::Null => String::new(),
+        Value::String(options) => options.clone(),
+        options => options.to_string(),
+    }
+}
+
+/// A failed request, rendered as `{"error":{"code":...,"message":...}}`.
+#[derive(Debug)]
+struct Error {
+    status: StatusCode,
+    code: &'static str,
+    message: String,
+}
+
+impl Error {
+    fn new(status: StatusCode, code: &'static str, message: String) -> Self {
+        Self { status, code, message }
+    }
+}
+
+impl From<anyhow::Error> for Error {
+    fn from(err: anyhow::Error) -> Self {
+        Self::new(StatusCode::BAD_REQUEST, "invalid_argument", format!("{err:#}"))
+    }
+}
+
+impl From<JsonRejection> for Error {
+    fn from(rejection: JsonRejection) -> Self {
+        let status = rejection.status();
+        let code = match status {
+            StatusCode::PAYLOAD_TOO_LARGE => "payload_too_large",
+            StatusCode::UNSUPPORTED_MEDIA_TYPE => "unsupported_media_type",
+            _ => "invalid_request",
+        };
+        Self::new(status, code, rejection.body_text())
+    }
+}
+
+impl IntoResponse for Error {
+    fn into_response(self) -> Response {
+        let body = json!({ "error": { "code": self.code, "message": self.message } });
+        (self.status, Json(body)).into_response()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use axum::body::{to_bytes, Body};
+    use axum::http::Request;
+    use tower::ServiceExt;
+
+    use super::*;
+
+    async fn call(app: Router, method: &str, path: &str, body: &str) -> (StatusCode, Value) {
+        let request = Request::builder()
+            .method(method)
+            .uri(path)
+            .header("content-type", "application/json")
+            .body(Body::from(body.to_string()))
+            .unwrap();
+        let response = app.oneshot(request).await.unwrap();
+        let status = response.status();
+        let body = to_bytes(response.into_body(), usize::MAX).await.unwrap();
+        (status, serde_json::from_slice(&body).unwrap())
+    }
+
+    async fn post_json(path: &str, body: Value) -> (StatusCode, Value) {
+        call(router(DEFAULT_MAX_BODY_BYTES), "POST", path, &body.to_string()).await
+    }
+
+    #[tokio::test]
+    async fn endpoints_diff_patch_and_translate() {
+        let (lhs, rhs) = (r#"{"a":[1,2]}"#, r#"{"a":[2,1]}"#);
+        let (status, body) = post_json("/diff", json!({ "lhs": lhs, "rhs": rhs })).await;
+        assert_eq!(status, StatusCode::OK);
+        let diff = body["diff"].as_str().unwrap().to_string();
+        assert!(!diff.is_empty());
+
+        let (_, body) =
+            post_json("/diff", json!({ "lhs": lhs, "rhs": rhs, "options": ["SET"] })).await;
+        assert_eq!(body, json!({ "diff": "" }));
+        let (_, body) =
+            post_json("/diff", json!({ "lhs": lhs, "rhs": rhs, "options": "[\"SET\"]" })).await;
+        assert_eq!(body, json!({ "diff": "" }));
+
+        let (status, body) = post_json("/patch", json!({ "document": lhs, "patch": diff })).await;
+        assert_eq!(status, StatusCode::OK);
+        assert_eq!(body, json!({ "document": rhs }));
+        let request =
+            json!({ "document": "a: 1\n", "patch": "{\"a\":2}", "format": "merge", "yaml": true });
+        assert_eq!(post_json("/patch", request).await.1, json!({ "document": "a: 2\n" }));
+
+        let request = json!({ "input": "@ [\"a\"]\n+ 1\n", "translation": "jd2patch" });
+        let (status, body) = post_json("/translate", request).await;
+        assert_eq!(status, StatusCode::OK);
+        assert_eq!(body, json!({ "output": r#"[{"op":"add","path":"/a","value":1}]"# }));
+    }
+
+    #[tokio::test]
+    async fn engine_errors_are_invalid_arguments() {
+        let (status, body) = post_json("/diff", json!({ "lhs": "{", "rhs": "{}" })).await;
+        assert_eq!(status, StatusCode::BAD_REQUEST);
+        assert_eq!(body["error"]["code"], "invalid_argument");
+        let message = body["error"]["message"].as_str().unwrap();
+        assert!(message.starts_with("failed to parse the first document: "));
+
+        let request = json!({ "document": "{}", "patch": "{}", "format": "yaml" });
+        let (_, body) = post_json("/patch", request).await;
+        assert_eq!(
+            body["error"]["message"],
+            r#"unsupported format "yaml": expected "jd", "patch", or "merge""#
+        );
+    }
+
+    #[tokio::test]
+    async fn the_default_limit_lifts_axums() {
+        let lhs = format!("{:?}", "a".repeat(3 << 20));
+        let (status, body) = post_json("/diff", json!({ "lhs": lhs, "rhs": lhs })).await;
+        assert_eq!(status, StatusCode::OK);
+        assert_eq!(body, json!({ "diff": "" }));
+    }
+
+    #[tokio::test]
+    async fn malformed_requests_get_structured_errors() {
+        let (status, body) = post_json("/diff", json!({ "lhs": "1" })).await;
+        assert_eq!(status, StatusCode::UNPROCESSABLE_ENTITY);
+        assert_eq!(body["error"]["code"], "invalid_request");
+        let (status, body) = call(router(8), "POST", "/diff", r#"{"lhs":"1","rhs":"2"}"#).await;
+        assert_eq!(status, StatusCode::PAYLOAD_TOO_LARGE);
+        assert_eq!(body["error"]["code"], "payload_too_large");
+        let (status, body) = call(router(1024), "GET", "/diff", "").await;
+        assert_eq!(status, StatusCode::METHOD_NOT_ALLOWED);
+        assert_eq!(body["error"]["code"], "method_not_allowed");
+        let (status, body) = call(router(1024), "POST", "/missing", "{}").await;
+        assert_eq!(status, StatusCode::NOT_FOUND);
+        assert_eq!(body["error"]["code"], "not_found");
+    }
+}
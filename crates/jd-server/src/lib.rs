@@ -0,0 +1,186 @@
+//! gRPC service for the Rust port of the `jd` tool.
+//!
+//! [`JdService`] implements the `jd.v1.Jd` service from
+//! `proto/jd/v1/jd.proto`, so microservices in any language can diff, patch,
+//! and translate documents through one shared engine instead of embedding a
+//! port each. Messages carry documents and diffs as text in the formats the
+//! CLI uses, and invalid input fails with `INVALID_ARGUMENT` and the CLI's
+//! error message. The engine runs on Tokio's blocking pool, so a large diff
+//! does not stall the other requests on its runtime thread, and requests
+//! over the size limit fail with `OUT_OF_RANGE` before it runs. The [`http`]
+//! module serves the same operations as a JSON API for callers without gRPC.
+//!
+//! ```no_run
+//! use jd_server::JdService;
+//!
+//! # async fn run() -> Result<(), tonic::transport::Error> {
+//! tonic::transport::Server::builder()
+//!     .add_service(JdService::default().into_server())
+//!     .serve("127.0.0.1:50051".parse().unwrap())
+//!     .await
+//! # }
+//! ```
+#![warn(missing_docs)]
+
+pub mod engine;
+pub mod http;
+
+use prost::Message;
+use tonic::{Request, Response, Status};
+
+use proto::jd_server::JdServer;
+use proto::{
+    DiffRequest, DiffResponse, Format, PatchRequest, PatchResponse, TranslateRequest,
+    TranslateResponse,
+};
+
+/// Types and service traits generated from `jd.proto`.
+#[allow(missing_docs)]
+pub mod proto {
+    tonic::include_proto!("jd.v1");
+}
+
+/// Default limit on the size of a request, matching the CLI's web UI.
+pub const DEFAULT_MAX_REQUEST_BYTES: usize = 16 * 1024 * 1024;
+
+/// The `jd.v1.Jd` service, backed by [`engine`].
+#[derive(Clone, Copy, Debug)]
+pub struct JdService {
+    max_request_bytes: usize,
+}
+
+impl JdService {
+    /// Creates a service that rejects requests over `max_request_bytes`.
+    #[must_use]
+    pub fn new(max_request_bytes: usize) -> Self {
+        Self { max_request_bytes }
+    }
+
+    /// Wraps the service for a tonic server whose decoder enforces the same
+    /// size limit, so oversized messages are not read into memory at all.
+    #[must_use]
+    pub fn into_server(self) -> JdServer<Self> {
+        JdServer::new(self).max_decoding_message_size(self.max_request_bytes)
+    }
+
+    /// Unwraps `request` if it is within the size limit.
+    fn accept<T: Message>(&self, request: Request<T>) -> Result<T, Status> {
+        let request = request.into_inner();
+        let len = request.encoded_len();
+        if len > self.max_request_bytes {
+            return Err(Status::out_of_range(format!(
+                "request is {len} bytes, over the limit of {} bytes",
+                self.max_request_bytes
+            )));
+        }
+        Ok(request)
+    }
+}
+
+impl Default for JdService {
+    fn default() -> Self {
+        Self::new(DEFAULT_MAX_REQUEST_BYTES)
+    }
+}
+
+#[tonic::async_trait]
+impl proto::jd_server::Jd for JdService {
+    async fn diff(&self, request: Request<DiffRequest>) -> Result<Response<DiffResponse>, Status> {
+        let request = self.accept(request)?;
+        let diff = blocking(move || {
+            engine::diff(&request.lhs, &request.rhs, request.yaml, &request.options)
+        })
+        .await?;
+        Ok(Response::new(DiffResponse { diff }))
+    }
+
+    async fn patch(
+        &self,
+        request: Request<PatchRequest>,
+    ) -> Result<Response<PatchResponse>, Status> {
+        let request = self.accept(request)?;
+        let format = match request.format() {
+            Format::Unspecified | Format::Jd => engine::Format::Jd,
+            Format::Patch => engine::Format::Patch,
+            Format::Merge => engine::Format::Merge,
+        };
+        let document = blocking(move || {
+            engine::patch(&request.document, &request.patch, format, request.yaml, &request.options)
+        })
+        .await?;
+        Ok(Response::new(PatchResponse { document }))
+    }
+
+    async fn translate(
+        &self,
+        request: Request<TranslateRequest>,
+    ) -> Result<Response<TranslateResponse>, Status> {
+        let request = self.accept(request)?;
+        let output =
+            blocking(move || engine::translate(&request.input, &request.translation)).await?;
+        Ok(Response::new(TranslateResponse { output }))
+    }
+}
+
+/// Runs `work` on the blocking pool, mapping its error to `INVALID_ARGUMENT`.
+async fn blocking<T: Send + 'static>(
+    work: impl FnOnce() -> anyhow::Result<T> + Send + 'static,
+) -> Result<T, Status> {
+    tokio::task::spawn_blocking(work)
+        .await
+        .map_err(|err| Status::internal(format!("engine task failed: {err}")))?
+        .map_err(|err| Status::invalid_argument(format!("{err:#}")))
+}
+
+#[cfg(test)]
+mod tests {
+    use tonic::Code;
+
+    use super::proto::jd_server::Jd;
+    use super::*;
+
+    #[tokio::test]
+    async fn rpcs_diff_patch_and_translate() {
+        let service = JdService::default();
+        let (lhs, rhs) = (r#"{"a":1}"#.to_string(), r#"{"a":2}"#.to_string());
+        let request = DiffRequest { lhs: lhs.clone(), rhs: rhs.clone(), ..Default::default() };
+        let diff = service.diff(Request::new(request)).await.unwrap().into_inner().diff;
+        assert_eq!(diff, "@ [\"a\"]\n- 1\n+ 2\n");
+
+        let request = PatchRequest { document: lhs, patch: diff.clone(), ..Default::default() };
+        let patched = service.patch(Request::new(request)).await.unwrap().into_inner();
+        assert_eq!(patched.document, rhs);
+
+        let request = TranslateRequest { input: diff, translation: "jd2patch".to_string() };
+        let output = service.translate(Request::new(request)).await.unwrap().into_inner().output;
+        assert!(output.starts_with(r#"[{"op":"test","path":"/a","value":1}"#));
+    }
+
+    #[tokio::test]
+    async fn patch_honours_the_format() {
+        let request = PatchRequest {
+            document: r#"{"a":1}"#.to_string(),
+            patch: r#"{"a":null}"#.to_string(),
+            format: Format::Merge.into(),
+            ..Default::default()
+        };
+        let patched = JdService::default().patch(Request::new(request)).await.unwrap().into_inner();
+        assert_eq!(patched.document, "{}");
+    }
+
+    #[tokio::test]
+    async fn invalid_input_is_an_invalid_argument() {
+        let request = DiffRequest { lhs: "{".to_string(), ..Default::default() };
+        let status = JdService::default().diff(Request::new(request)).await.unwrap_err();
+        assert_eq!(status.code(), Code::InvalidArgument);
+        assert!(status.message().starts_with("failed to parse the first document: "));
+    }
+
+    #[tokio::test]
+    async fn oversized_requests_are_out_of_range() {
+        let request = DiffRequest { lhs: "[1,2,3]".to_string(), ..Default::default() };
+        let status = JdService::new(8).diff(Request::new(request)).await.unwrap_err();
+        assert_eq!(status.code(), Code::OutOfRange);
+        assert_eq!(status.message(), "request is 9 bytes, over the limit of 8 bytes");
+    }
+}
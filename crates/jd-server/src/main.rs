@@ -0,0 +1,54 @@
+use std::net::SocketAddr;
+
+use anyhow::{Context, Result};
+use clap::Parser;
+use jd_server::{http, JdService, DEFAULT_MAX_REQUEST_BYTES};
+use tonic::transport::Server;
+
+/// Serves the jd gRPC API, and optionally the HTTP JSON API, until
+/// interrupted.
+#[derive(Debug, Parser)]
+#[command(name = "jd-server", version)]
+struct Args {
+    /// Address to listen on for gRPC.
+    #[arg(long, default_value = "127.0.0.1:50051")]
+    listen: SocketAddr,
+    /// Address to also serve the HTTP JSON API on.
+    #[arg(long, value_name = "ADDR")]
+    http: Option<SocketAddr>,
+    /// Largest request accepted, in bytes, by either API.
+    #[arg(long, default_value_t = DEFAULT_MAX_REQUEST_BYTES)]
+    max_request_bytes: usize,
+}
+
+#[tokio::main]
+async fn main() -> Result<()> {
+    let args = Args::parse();
+    let grpc = async {
+        println!("Listening for gRPC on {}...", args.listen);
+        let service = JdService::new(args.max_request_bytes).into_server();
+        Server::builder()
+            .add_service(service)
+            .serve_with_shutdown(args.listen, shutdown())
+            .await
+            .with_context(|| format!("failed to serve gRPC on {}", args.listen))
+    };
+    let Some(address) = args.http else {
+        return grpc.await;
+    };
+    let rest = async {
+        let listener = tokio::net::TcpListener::bind(address)
+            .await
+            .with_context(|| format!("failed to listen on {address}"))?;
+        println!("Listening for HTTP on http://{address}...");
+        axum::serve(listener, http::router(args.max_request_bytes))
+            .with_graceful_shutdown(shutdown())
+            .await
+            .with_context(|| format!("failed to serve HTTP on {address}"))
+    };
+    tokio::try_join!(grpc, rest).map(|_| ())
+}
+
+async fn shutdown() {
+    let _ = tokio::signal::ctrl_c().await;
+}
@@ -0,0 +1,192 @@
+//! WebAssembly bindings for the Rust port of the `jd` tool.
+//!
+//! The exported functions take and return strings, so JavaScript callers
+//! pass documents and diffs exactly as `jd` reads and writes them. Errors
+//! surface as thrown `Error`s carrying the same messages as the CLI.
+//!
+//! Each binding wraps a plain Rust function of the same shape, which also
+//! runs on native targets:
+//!
+//! ```
+//! let diff = jd_wasm::diff_documents(r#"{"a":1}"#, r#"{"a":2}"#, None).unwrap();
+//! assert_eq!(diff, "@ [\"a\"]\n- 1\n+ 2\n");
+//! ```
+#![warn(missing_docs)]
+
+use anyhow::{bail, Context, Result};
+use jd_core::{Diff, DiffOptions, Node, RenderConfig};
+use wasm_bindgen::prelude::*;
+
+#[wasm_bindgen(typescript_custom_section)]
+const TYPESCRIPT: &str = r#"
+/** A diff format: native jd text, JSON Patch (RFC 6902), or JSON Merge Patch (RFC 7386). */
+export type Format = "jd" | "patch" | "merge";
+
+/**
+ * Diffs two JSON documents and returns the native jd diff, which is empty
+ * when they are equal. `options` holds jd's JSON diff options, such as
+ * `'["SET"]'` or `'[{"precision":0.01}]'`.
+ */
+export function diff(lhs: string, rhs: string, options?: string): string;
+
+/**
+ * Renders a native jd diff in `format`. Only merge diffs, which start with
+ * `^ {"Merge":true}`, render as JSON Merge Patch.
+ */
+export function render(diff: string, format: Format): string;
+
+/**
+ * Applies `patch`, written in `format` (default `"jd"`), to a JSON document
+ * and returns the patched document.
+ */
+export function patch(document: string, patch: string, format?: Format, options?: string): string;
+"#;
+
+/// Diffs two JSON documents; see [`diff_documents`].
+#[wasm_bindgen(skip_typescript)]
+pub fn diff(lhs: &str, rhs: &str, options: Option<String>) -> Result<String, JsError> {
+    diff_documents(lhs, rhs, options.as_deref()).map_err(js_error)
+}
+
+/// Renders a native jd diff in another format; see [`render_diff`].
+#[wasm_bindgen(skip_typescript)]
+pub fn render(diff: &str, format: &str) -> Result<String, JsError> {
+    render_diff(diff, format).map_err(js_error)
+}
+
+/// Applies a diff or patch to a JSON document; see [`patch_document`].
+#[wasm_bindgen(skip_typescript)]
+pub fn patch(
+    document: &str,
+    patch: &str,
+    format: Option<String>,
+    options: Option<String>,
+) -> Result<String, JsError> {
+    patch_document(document, patch, format.as_deref(), options.as_deref()).map_err(js_error)
+}
+
+/// Diffs two JSON documents and renders the result as native jd text.
+///
+/// `options` holds Go-compatible JSON diff options, as accepted by
+/// [`DiffOptions::from_json_str`].
+///
+/// ```
+/// let diff = jd_wasm::diff_documents("[1,2]", "[2,1]", Some(r#"["SET"]"#)).unwrap();
+/// assert!(diff.is_empty());
+/// ```
+pub fn diff_documents(lhs: &str, rhs: &str, options: Option<&str>) -> Result<String> {
+    let options = parse_options(options)?;
+    let lhs = Node::from_json_str(lhs).context("failed to parse the first document")?;
+    let rhs = Node::from_json_str(rhs).context("failed to parse the second document")?;
+    Ok(lhs.diff(&rhs, &options).render(&RenderConfig::default()))
+}
+
+/// Renders a native jd diff as `"jd"`, `"patch"` (RFC 6902), or `"merge"`
+/// (RFC 7386), like `jd -t jd2patch` and `jd -t jd2merge`.
+///
+/// ```
+/// let patch = jd_wasm::render_diff("@ [\"a\"]\n+ 1\n", "patch").unwrap();
+/// assert_eq!(patch, r#"[{"op":"add","path":"/a","value":1}]"#);
+/// ```
+pub fn render_diff(diff: &str, format: &str) -> Result<String> {
+    let diff = Diff::from_native_str(diff)?;
+    Ok(match format {
+        "jd" => diff.render(&RenderConfig::default()),
+        "patch" => diff.render_patch().context("failed to render JSON Patch")?,
+        "merge" => diff.render_merge().context("failed to render JSON Merge Patch")?,
+        _ => bail!("unsupported format {format:?}: expected \"jd\", \"patch\", or \"merge\""),
+    })
+}
+
+/// Applies `patch`, written in `format` (`"jd"` when `None`), to a JSON
+/// document and returns the patched document as compact JSON. `options`
+/// apply to jd diffs as in [`diff_documents`].
+///
+/// ```
+/// let patched = jd_wasm::patch_document(r#"{"a":1}"#, r#"{"a":null,"b":2}"#, Some("merge"), None);
+/// assert_eq!(patched.unwrap(), r#"{"b":2}"#);
+/// ```
+pub fn patch_document(
+    document: &str,
+    patch: &str,
+    format: Option<&str>,
+    options: Option<&str>,
+) -> Result<String> {
+    let document = Node::from_json_str(document).context("failed to parse the document")?;
+    let patched = match format.unwrap_or("jd") {
+        "jd" => {
+            let diff = Diff::from_native_str(patch)?;
+            document.apply_patch_with_options(&diff, &parse_options(options)?)?
+        }
+        "patch" => document.apply_json_patch(patch)?,
+        "merge" => document.apply_merge_patch(patch)?,
+        format => {
+            bail!("unsupported format {format:?}: expected \"jd\", \"patch\", or \"merge\"")
+        }
+    };
+    match patched.to_json_value() {
+        Some(value) => Ok(serde_json::to_string(&value)?),
+        None => bail!("the patch removed the whole document"),
+    }
+}
+
+fn parse_options(options: Option<&str>) -> Result<DiffOptions> {
+    match options {
+        Some(options) if !options.trim().is_empty() => {
+            DiffOptions::from_json_str(options).context("invalid diff options")
+        }
+        _ => Ok(DiffOptions::default()),
+    }
+}
+
+fn js_error(err: anyhow::Error) -> JsError {
+    JsError::new(&format!("{err:#}"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn diffs_render_and_apply_in_every_format() {
+        let (lhs, rhs) = (r#"{"a":[1,2],"b":true}"#, r#"{"a":[1,3]}"#);
+        let diff = diff_documents(lhs, rhs, None).unwrap();
+        assert_eq!(patch_document(lhs, &diff, None, None).unwrap(), rhs);
+        let json_patch = render_diff(&diff, "patch").unwrap();
+        assert_eq!(patch_document(lhs, &json_patch, Some("patch"), None).unwrap(), rhs);
+        assert_eq!(render_diff(&diff, "jd").unwrap(), diff);
+    }
+
+    #[test]
+    fn merge_diffs_render_as_merge_patches() {
+        let diff = Diff::from_merge_patch_str(r#"{"a":2,"b":null}"#).unwrap();
+        let diff = diff.render(&RenderConfig::default());
+        assert_eq!(render_diff(&diff, "jd").unwrap(), diff);
+        let merge = render_diff(&diff, "merge").unwrap();
+        assert_eq!(merge, r#"{"a":2,"b":null}"#);
+        let patched = patch_document(r#"{"a":1,"b":1}"#, &merge, Some("merge"), None);
+        assert_eq!(patched.unwrap(), r#"{"a":2}"#);
+    }
+
+    #[test]
+    fn options_apply_to_diffs() {
+        let options = Some(r#"[{"precision":0.1}]"#);
+        assert!(diff_documents("[1.0]", "[1.05]", options).unwrap().is_empty());
+        assert!(!diff_documents("[1.0]", "[1.05]", Some("")).unwrap().is_empty());
+    }
+
+    #[test]
+    fn errors_name_the_failing_input() {
+        let err = diff_documents("{", "{}", None).unwrap_err();
+        assert!(format!("{err:#}").starts_with("failed to parse the first document: "));
+        let err = diff_documents("{}", "{}", Some("[\"SETS\"]")).unwrap_err();
+        assert!(format!("{err:#}").starts_with("invalid diff options: "));
+        let err = render_diff("", "yaml").unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            r#"unsupported format "yaml": expected "jd", "patch", or "merge""#
+        );
+        let err = patch_document("1", "@ []\n- 1\n", None, None).unwrap_err();
+        assert_eq!(err.to_string(), "the patch removed the whole document");
+    }
+}
@@ -1,4 +1,10 @@
 #!/usr/bin/env bash
+# Times the Rust and Go jd binaries on each benchmark corpus, then writes a
+# comparison report per size class to target/bench/bench_vs_go.{json,md}
+# with scripts/bench_vs_go_report.py, failing when Rust falls behind the
+# thresholds in crates/jd-benches/baselines/bench-vs-go.json.
+#
+# Usage: JD_BENCH_RUNS=5 scripts/bench_vs_go.sh
 set -euo pipefail
 
 TIME_CMD=""
@@ -17,13 +23,16 @@ mkdir -p "$TARGET_DIR"
 RUST_BIN="$REPO_ROOT/target/release/jd"
 GO_BIN="$TARGET_DIR/jd-go"
 FIXTURES_DIR="$REPO_ROOT/crates/jd-benches/fixtures"
+MEASUREMENTS="$TARGET_DIR/measurements.jsonl"
+RUNS="${JD_BENCH_RUNS:-3}"
 
-cargo build --release -p jd-cli >/dev/null
+cargo build --release -p jd-cli ${JD_FEATURES:+--features "$JD_FEATURES"} >/dev/null
 
 go build -C "$REPO_ROOT/scripts" -o "$GO_BIN" github.com/josephburnett/jd/v2/jd >/dev/null
 
 mapfile -t CORPORA < <(find "$FIXTURES_DIR" -mindepth 1 -maxdepth 1 -type d -printf '%f\n' | sort)
 
+: >"$MEASUREMENTS"
 printf "%-12s %-24s %-10s %-12s %-5s\n" "Binary" "Corpus" "Seconds" "MaxRSS(KB)" "Exit"
 for corpus in "${CORPORA[@]}"; do
   before="$FIXTURES_DIR/$corpus/before.json"
@@ -32,32 +41,34 @@ for corpus in "${CORPORA[@]}"; do
     echo "warning: skipping $corpus (missing before/after)" >&2
     continue
   fi
+  input_bytes=$(($(wc -c <"$before") + $(wc -c <"$after")))
 
-  for impl in rust go; do
-    case "$impl" in
-      rust)
-        bin="$RUST_BIN"
-        ;;
-      go)
-        bin="$GO_BIN"
-        ;;
-    esac
+  for run in $(seq "$RUNS"); do
+    for impl in rust go; do
+      case "$impl" in
+        rust)
+          bin="$RUST_BIN"
+          ;;
+        go)
+          bin="$GO_BIN"
+          ;;
+      esac
 
-    metrics=$(mktemp)
-    exit_code=0
-    if [[ -n "$TIME_CMD" ]]; then
-        if ! "$TIME_CMD" -f "%e %M" -o "$metrics" "$bin" "$before" "$after" >/dev/null 2>&1; then
-          exit_code=$?
-          if [[ $exit_code -ne 0 && $exit_code -ne 1 ]]; then
-            cat "$metrics" >&2 || true
-            rm -f "$metrics"
-            echo "error: $bin failed on $corpus with exit $exit_code" >&2
-            exit $exit_code
-          fi
-      fi
-      read -r seconds maxrss <"$metrics"
-    else
-      if ! python3 - "$bin" "$before" "$after" >"$metrics" <<'PY'
+      metrics=$(mktemp)
+      exit_code=0
+      if [[ -n "$TIME_CMD" ]]; then
+          if ! "$TIME_CMD" -f "%e %M" -o "$metrics" "$bin" "$before" "$after" >/dev/null 2>&1; then
+            exit_code=$?
+            if [[ $exit_code -ne 0 && $exit_code -ne 1 ]]; then
+              cat "$metrics" >&2 || true
+              rm -f "$metrics"
+              echo "error: $bin failed on $corpus with exit $exit_code" >&2
+              exit $exit_code
+            fi
+        fi
+        read -r seconds maxrss <"$metrics"
+      else
+        if ! python3 - "$bin" "$before" "$after" >"$metrics" <<'PY'
 import resource
 import subprocess
 import sys
@@ -71,19 +82,27 @@ usage = resource.getrusage(resource.RUSAGE_CHILDREN)
 print(f"{elapsed:.6f} {usage.ru_maxrss}")
 sys.exit(proc.returncode)
 PY
-      then
-        exit_code=$?
-        if [[ $exit_code -ne 0 && $exit_code -ne 1 ]]; then
-          cat "$metrics" >&2 || true
-          rm -f "$metrics"
-          echo "error: $bin failed on $corpus with exit $exit_code" >&2
-          exit $exit_code
+        then
+          exit_code=$?
+          if [[ $exit_code -ne 0 && $exit_code -ne 1 ]]; then
+            cat "$metrics" >&2 || true
+            rm -f "$metrics"
+            echo "error: $bin failed on $corpus with exit $exit_code" >&2
+            exit $exit_code
+          fi
         fi
+        read -r seconds maxrss <"$metrics"
       fi
-      read -r seconds maxrss <"$metrics"
-    fi
-    rm -f "$metrics"
-    printf "%-12s %-24s %-10s %-12s %-5s\n" "$impl" "$corpus" "$seconds" "$maxrss" "$exit_code"
+      rm -f "$metrics"
+      printf "%-12s %-24s %-10s %-12s %-5s\n" "$impl" "$corpus" "$seconds" "$maxrss" "$exit_code"
+      printf '{"corpus":"%s","impl":"%s","run":%d,"input_bytes":%d,"seconds":%s,"max_rss_kb":%s}\n' \
+        "$corpus" "$impl" "$run" "$input_bytes" "$seconds" "$maxrss" >>"$MEASUREMENTS"
+    done
   done
   echo
 done
+
+python3 "$REPO_ROOT/scripts/bench_vs_go_report.py" \
+  --measurements "$MEASUREMENTS" \
+  --thresholds "$REPO_ROOT/crates/jd-benches/baselines/bench-vs-go.json" \
+  --output-dir "$TARGET_DIR"
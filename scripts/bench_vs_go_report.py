@@ -0,0 +1,197 @@
+#!/usr/bin/env python3
+"""Summarize Rust versus Go jd timings and peak memory per size class.
+
+scripts/bench_vs_go.sh records one measurement per run of each binary on
+each corpus. This takes the median of the runs, groups the corpora into the
+size classes of the thresholds file by input size, and writes the Rust/Go
+ratios as JSON and as a markdown table. A class whose geometric-mean ratio
+exceeds its threshold fails the report.
+"""
+from __future__ import annotations
+
+import argparse
+import json
+import math
+import statistics
+import sys
+from dataclasses import dataclass
+from pathlib import Path
+
+METRICS = ("seconds", "max_rss_kb")
+IMPLEMENTATIONS = ("rust", "go")
+
+
+@dataclass
+class Scenario:
+    corpus: str
+    size_class: str
+    input_bytes: int
+    medians: dict[str, dict[str, float]]
+    runs: int
+
+    def ratio(self, metric: str) -> float:
+        go = self.medians["go"][metric]
+        return self.medians["rust"][metric] / go if go else math.inf
+
+
+def load_measurements(path: Path) -> list[dict]:
+    measurements = []
+    for number, line in enumerate(path.read_text().splitlines(), start=1):
+        if not line.strip():
+            continue
+        try:
+            measurement = json.loads(line)
+            for key in ("corpus", "impl", "input_bytes", *METRICS):
+                measurement[key]
+        except (json.JSONDecodeError, KeyError) as exc:
+            raise SystemExit(f"invalid measurement at {path}:{number}: {exc}")
+        measurements.append(measurement)
+    return measurements
+
+
+def size_class(input_bytes: int, classes: list[dict]) -> str:
+    for candidate in classes:
+        if candidate["max_bytes"] is None or input_bytes <= candidate["max_bytes"]:
+            return candidate["name"]
+    raise SystemExit(f"no size class holds {input_bytes} bytes; end the list with a max_bytes of null")
+
+
+def summarize(measurements: list[dict], classes: list[dict]) -> list[Scenario]:
+    by_corpus: dict[str, list[dict]] = {}
+    for measurement in measurements:
+        by_corpus.setdefault(measurement["corpus"], []).append(measurement)
+    scenarios = []
+    for corpus, runs in sorted(by_corpus.items()):
+        medians = {}
+        for impl in IMPLEMENTATIONS:
+            own = [run for run in runs if run["impl"] == impl]
+            if not own:
+                raise SystemExit(f"no {impl} measurements for {corpus}")
+            medians[impl] = {metric: statistics.median(float(run[metric]) for run in own) for metric in METRICS}
+        input_bytes = int(runs[0]["input_bytes"])
+        scenarios.append(
+            Scenario(
+                corpus,
+                size_class(input_bytes, classes),
+                input_bytes,
+                medians,
+                min(sum(1 for run in runs if run["impl"] == impl) for impl in IMPLEMENTATIONS),
+            )
+        )
+    return scenarios
+
+
+def geometric_mean(values: list[float]) -> float:
+    if any(math.isinf(value) for value in values):
+        return math.inf
+    return math.exp(sum(math.log(value) for value in values) / len(values)) if values else math.nan
+
+
+def class_summaries(scenarios: list[Scenario], classes: list[dict], thresholds: dict) -> list[dict]:
+    summaries = []
+    for candidate in classes:
+        name = candidate["name"]
+        members = [scenario for scenario in scenarios if scenario.size_class == name]
+        if not members:
+            continue
+        summary = {"size_class": name, "corpora": [scenario.corpus for scenario in members], "failures": []}
+        for metric in METRICS:
+            ratio = geometric_mean([scenario.ratio(metric) for scenario in members])
+            limit = thresholds.get(name, {}).get(metric)
+            summary[f"{metric}_ratio"] = ratio
+            summary[f"{metric}_limit"] = limit
+            if limit is not None and ratio > limit:
+                summary["failures"].append(
+                    f"{name} corpora: Rust {metric} is {ratio:.2f}x Go's (limit {limit:.2f}x)"
+                )
+        summaries.append(summary)
+    return summaries
+
+
+def render_markdown(scenarios: list[Scenario], summaries: list[dict]) -> str:
+    lines = [
+        "| Corpus | Class | Input (bytes) | Rust s | Go s | Time ratio | Rust RSS (KB) | Go RSS (KB) | RSS ratio |",
+        "| --- | --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: |",
+    ]
+    for scenario in scenarios:
+        rust, go = scenario.medians["rust"], scenario.medians["go"]
+        lines.append(
+            f"| {scenario.corpus} | {scenario.size_class} | {scenario.input_bytes} "
+            f"| {rust['seconds']:.3f} | {go['seconds']:.3f} | {scenario.ratio('seconds'):.2f}x "
+            f"| {rust['max_rss_kb']:.0f} | {go['max_rss_kb']:.0f} | {scenario.ratio('max_rss_kb'):.2f}x |"
+        )
+    lines += [
+        "",
+        "| Class | Corpora | Time ratio | Limit | RSS ratio | Limit | Status |",
+        "| --- | ---: | ---: | ---: | ---: | ---: | --- |",
+    ]
+    for summary in summaries:
+        limits = [summary[f"{metric}_limit"] for metric in METRICS]
+        lines.append(
+            f"| {summary['size_class']} | {len(summary['corpora'])} "
+            f"| {summary['seconds_ratio']:.2f}x | {format_limit(limits[0])} "
+            f"| {summary['max_rss_kb_ratio']:.2f}x | {format_limit(limits[1])} "
+            f"| {'regressed' if summary['failures'] else 'ok'} |"
+        )
+    return "\n".join(lines) + "\n"
+
+
+def format_limit(limit: float | None) -> str:
+    return "-" if limit is None else f"{limit:.2f}x"
+
+
+def main(argv: list[str]) -> int:
+    parser = argparse.ArgumentParser(description=__doc__.splitlines()[0])
+    parser.add_argument(
+        "--measurements",
+        type=Path,
+        default=Path("target/bench/measurements.jsonl"),
+        help="JSON lines written by scripts/bench_vs_go.sh.",
+    )
+    parser.add_argument(
+        "--thresholds",
+        type=Path,
+        default=Path("crates/jd-benches/baselines/bench-vs-go.json"),
+        help="Size classes and the Rust/Go ratio allowed in each.",
+    )
+    parser.add_argument(
+        "--output-dir",
+        type=Path,
+        default=Path("target/bench"),
+        help="Where to write bench_vs_go.json and bench_vs_go.md.",
+    )
+    args = parser.parse_args(argv)
+
+    config = json.loads(args.thresholds.read_text())
+    classes = config["size_classes"]
+    scenarios = summarize(load_measurements(args.measurements), classes)
+    summaries = class_summaries(scenarios, classes, config.get("thresholds", {}))
+
+    report = {
+        "scenarios": [
+            {
+                "corpus": scenario.corpus,
+                "size_class": scenario.size_class,
+                "input_bytes": scenario.input_bytes,
+                "runs": scenario.runs,
+                **{impl: scenario.medians[impl] for impl in IMPLEMENTATIONS},
+                **{f"{metric}_ratio": scenario.ratio(metric) for metric in METRICS},
+            }
+            for scenario in scenarios
+        ],
+        "size_classes": summaries,
+    }
+    markdown = render_markdown(scenarios, summaries)
+    args.output_dir.mkdir(parents=True, exist_ok=True)
+    (args.output_dir / "bench_vs_go.json").write_text(json.dumps(report, indent=2) + "\n")
+    (args.output_dir / "bench_vs_go.md").write_text(markdown)
+    print(markdown, end="")
+
+    failures = [failure for summary in summaries for failure in summary["failures"]]
+    for failure in failures:
+        print(f"::error ::{failure}")
+    return 1 if failures else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
@@ -0,0 +1,58 @@
+#!/usr/bin/env bash
+# Captures the stderr text and exit status of the Go jd binary for error
+# scenarios into the parity dataset, where scripts/run_parity.sh compares
+# jd-rs against them.
+#
+# Usage: JD_GO_BIN=/path/to/go/jd scripts/capture_go_errors.sh
+set -euo pipefail
+
+REPO_ROOT=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+DATASET_DIR="$REPO_ROOT/docs/parity/upstream/jd-v2.2.2"
+GO_JD="${JD_GO_BIN:?set JD_GO_BIN to the Go jd binary}"
+
+if [[ ! -x "$GO_JD" ]]; then
+  echo "Go jd binary not found or not executable: $GO_JD" >&2
+  exit 1
+fi
+
+# Writes the shared inputs of every error scenario into the current directory.
+write_inputs() {
+  printf '{"a":1}\n' >a.json
+  printf '{"a":2}\n' >b.json
+  printf '{"a":\n' >malformed.json
+  printf '@ ["a"]\n- 5\n+ 6\n' >mismatch.jd
+  printf 'garbage\n' >malformed.jd
+}
+
+# Runs COMMAND (with /tmp/jd standing for the binary, as in the other
+# scenarios) in a fresh scenario directory and records its stderr and exit
+# status. The date and time Go's log package puts ahead of each message are
+# dropped, and the binary's path is written back as /tmp/jd, so the capture
+# does not depend on when or where it was taken.
+capture() {
+  local scenario="$1"
+  local command="$2"
+  local dir="$DATASET_DIR/$scenario"
+
+  rm -rf "$dir"
+  mkdir -p "$dir"
+  pushd "$dir" >/dev/null
+  write_inputs
+  printf '# Run from this directory\n%s\n' "$command" >command.txt
+  local status=0
+  bash -c "${command//\/tmp\/jd/$GO_JD}" >/dev/null 2>stderr.raw || status=$?
+  sed -E -e 's|^[0-9]{4}/[0-9]{2}/[0-9]{2} [0-9]{2}:[0-9]{2}:[0-9]{2} ||' \
+    -e "s|$GO_JD|/tmp/jd|g" stderr.raw >stderr.txt
+  rm stderr.raw
+  echo "$status" >exit_code.txt
+  popd >/dev/null
+  echo "captured $scenario (exit $status)" >&2
+}
+
+capture error-malformed-first '/tmp/jd malformed.json a.json'
+capture error-malformed-second '/tmp/jd a.json malformed.json'
+capture error-missing-file '/tmp/jd missing.json a.json'
+capture error-unknown-flag '/tmp/jd -nonsense a.json b.json'
+capture error-too-many-files '/tmp/jd a.json b.json a.json'
+capture error-patch-mismatch '/tmp/jd -p mismatch.jd a.json'
+capture error-malformed-diff '/tmp/jd -p malformed.jd a.json'
@@ -0,0 +1,102 @@
+#!/usr/bin/env python3
+"""Compare fixtures generated from other jd versions with the followed ones.
+
+scripts/gen_fixtures.go writes the fixtures of the jd version jd-rs follows
+(v2) under crates/jd-core/tests/fixtures, and those of other major versions
+under a subdirectory named after the version, such as fixtures/v1. For each
+version directory this lists the scenarios whose rendered outputs, patched
+documents, or patch errors differ from the followed fixtures, and the
+scenarios the other version skipped.
+"""
+from __future__ import annotations
+
+import argparse
+import json
+import re
+import sys
+from pathlib import Path
+
+REPO_ROOT = Path(__file__).resolve().parent.parent
+FIXTURES_DIR = REPO_ROOT / "crates/jd-core/tests/fixtures"
+VERSION_DIR = re.compile(r"v\d+")
+# Suites that are not generated from upstream jd.
+HAND_WRITTEN = {"msgpack"}
+# Fixture fields that capture upstream behavior. The structural "diff" is
+# left out: v1 records no context lines, so it always differs.
+COMPARED = ("render", "patched", "error")
+
+
+def version_label(root: Path) -> str:
+    version_file = root / "VERSION.txt"
+    return version_file.read_text().strip() if version_file.is_file() else "(no VERSION.txt)"
+
+
+def fixtures(root: Path, skip_versions: bool) -> dict[str, dict]:
+    found = {}
+    for path in sorted(root.glob("*/**/*.json")):
+        relative = path.relative_to(root)
+        if relative.parts[0] in HAND_WRITTEN:
+            continue
+        if skip_versions and VERSION_DIR.fullmatch(relative.parts[0]):
+            continue
+        found[relative.as_posix()] = json.loads(path.read_text())
+    return found
+
+
+def compare(version: str) -> tuple[list[str], list[str]]:
+    """Returns the fixtures of version that differ from the followed ones,
+    and the followed fixtures version has no counterpart for."""
+    followed = fixtures(FIXTURES_DIR, skip_versions=True)
+    other = fixtures(FIXTURES_DIR / version, skip_versions=False)
+    changed = []
+    for name, data in other.items():
+        expected = followed.get(name)
+        if expected is None:
+            continue
+        fields = [
+            field for field in COMPARED if data.get(field) != expected.get(field)
+        ]
+        # A version that cannot render an output omits it; only outputs both
+        # versions recorded count as changes.
+        if "render" in fields:
+            ours, theirs = expected.get("render", {}), data.get("render", {})
+            if all(ours[key] == theirs[key] for key in ours.keys() & theirs.keys()):
+                fields.remove("render")
+        if fields:
+            changed.append(f"{name} ({', '.join(fields)})")
+    missing = [name for name in followed if name not in other]
+    return changed, missing
+
+
+def main(argv: list[str]) -> int:
+    parser = argparse.ArgumentParser(description=__doc__.splitlines()[0])
+    parser.add_argument(
+        "versions",
+        nargs="*",
+        help="Version directories to compare, such as v1. Defaults to every one present.",
+    )
+    args = parser.parse_args(argv)
+
+    versions = args.versions or sorted(
+        path.name for path in FIXTURES_DIR.iterdir() if path.is_dir() and VERSION_DIR.fullmatch(path.name)
+    )
+    if not versions:
+        print(f"no version directories under {FIXTURES_DIR.relative_to(REPO_ROOT)}; run gen_fixtures.go with another jd version first")
+        return 0
+    print(f"followed: {version_label(FIXTURES_DIR)}")
+    for version in versions:
+        if not (FIXTURES_DIR / version).is_dir():
+            raise SystemExit(f"no fixtures for {version} under {FIXTURES_DIR.relative_to(REPO_ROOT)}")
+        changed, missing = compare(version)
+        print()
+        print(f"{version}: {version_label(FIXTURES_DIR / version)}")
+        print(f"  {len(changed)} fixture(s) behave differently, {len(missing)} not generated")
+        for name in changed:
+            print(f"  differs: {name}")
+        for name in missing:
+            print(f"  missing: {name}")
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// fixturesDir holds the fixtures of the jd major version jd-rs follows,
+// followedMajor. Other major versions write theirs to a subdirectory named
+// after the version, such as fixtures/v1/render.
+const (
+	fixturesDir   = "crates/jd-core/tests/fixtures"
+	followedMajor = "v2"
+)
+
+// errUnsupported marks scenarios the jd version built in cannot run, such
+// as options it predates. They are skipped rather than failing the run.
+var errUnsupported = errors.New("not supported by this jd version")
+
+type nodeRepr struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type diffMetadata struct {
+	Merge bool `json:"merge"`
+}
+
+type diffElement struct {
+	Metadata *diffMetadata `json:"metadata,omitempty"`
+	Path     []interface{} `json:"path"`
+	Before   []nodeRepr    `json:"before,omitempty"`
+	Remove   []nodeRepr    `json:"remove,omitempty"`
+	Add      []nodeRepr    `json:"add,omitempty"`
+	After    []nodeRepr    `json:"after,omitempty"`
+}
+
+type renderOutputs struct {
+	Native      string `json:"native,omitempty"`
+	NativeColor string `json:"native_color,omitempty"`
+	Patch       string `json:"patch,omitempty"`
+	Merge       string `json:"merge,omitempty"`
+	// NativeBytes holds the native rendering byte for byte, since
+	// encoding/json replaces invalid UTF-8 in strings such as Native.
+	NativeBytes []int `json:"native_bytes,omitempty"`
+}
+
+// fixture is the file written for one scenario. Scenarios that render
+// also record their name and rendered outputs; the others hold only the
+// inputs and the diff.
+type fixture struct {
+	Name    string         `json:"name,omitempty"`
+	LHS     string         `json:"lhs"`
+	RHS     string         `json:"rhs"`
+	Options []string       `json:"options,omitempty"`
+	Format  string         `json:"format,omitempty"`
+	Diff    []diffElement  `json:"diff"`
+	Render  *renderOutputs `json:"render,omitempty"`
+}
+
+// patchFixture is the file written for one scenario of a patch suite: the
+// document, the native diff applied to it, and either the patched document
+// or the error upstream jd reported.
+type patchFixture struct {
+	Name    string   `json:"name"`
+	Target  string   `json:"target"`
+	Diff    string   `json:"diff"`
+	Options []string `json:"options,omitempty"`
+	Patched *string  `json:"patched,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// manifest lists the fixture suites to generate. Each suite writes one
+// file per scenario, named after the scenario, into its directory.
+type manifest struct {
+	Suites []suite `json:"suites"`
+}
+
+// suite is a directory of fixtures of one kind: "diff" (the default)
+// diffs lhs against rhs, "patch" applies a diff to a target, and "matrix"
+// diffs every scenario under every combination of options drawn from axes.
+type suite struct {
+	Dir       string     `json:"dir"`
+	Kind      string     `json:"kind,omitempty"`
+	Scenarios []scenario `json:"scenarios"`
+	// Axes holds, for a matrix suite, the alternatives of each option
+	// dimension; "" stands for leaving the dimension unset.
+	Axes [][]string `json:"axes,omitempty"`
+	// Exclude drops the combinations holding every option of an entry.
+	Exclude [][]string `json:"exclude,omitempty"`
+	// Render lists the outputs every matrix fixture records. Combinations
+	// with "merge" also record the merge rendering.
+	Render []string `json:"render,omitempty"`
+}
+
+// scenario is one fixture. Patch scenarios apply diff, given as native jd
+// text, to target; without diff they apply the diff of lhs against rhs
+// under options, and without target they patch lhs.
+type scenario struct {
+	Name    string   `json:"name"`
+	LHS     string   `json:"lhs,omitempty"`
+	RHS     string   `json:"rhs,omitempty"`
+	Options []string `json:"options,omitempty"`
+	Format  string   `json:"format,omitempty"`
+	Render  []string `json:"render,omitempty"`
+	Target  string   `json:"target,omitempty"`
+	Diff    string   `json:"diff,omitempty"`
+}
+
+// Usage: go run . [manifest]
+//
+// The manifest defaults to scripts/fixtures.json; suite directories are
+// relative to the repository root. Builds with the jdv1 tag run the jd v1
+// module instead of v2: go run -tags jdv1 .
+func main() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	root, err := findRepoRoot(cwd)
+	if err != nil {
+		panic(err)
+	}
+	manifestPath := filepath.Join(root, "scripts", "fixtures.json")
+	if len(os.Args) > 1 {
+		manifestPath = os.Args[1]
+	}
+	manifest, err := readManifest(manifestPath)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, suite := range manifest.Suites {
+		outDir, err := suiteDir(root, suite.Dir)
+		if err != nil {
+			panic(err)
+		}
+		if err := os.MkdirAll(outDir, 0o755); err != nil {
+			panic(err)
+		}
+		scenarios := append([]scenario(nil), suite.Scenarios...)
+		if suite.Kind == "matrix" {
+			scenarios = expandMatrix(suite)
+		}
+		sort.Slice(scenarios, func(i, j int) bool { return scenarios[i].Name < scenarios[j].Name })
+		for _, scenario := range scenarios {
+			var data interface{}
+			var err error
+			if suite.Kind == "patch" {
+				data, err = generatePatch(scenario)
+			} else {
+				data, err = generate(scenario)
+			}
+			if errors.Is(err, errUnsupported) {
+				fmt.Printf("skipped %s/%s: %v\n", suite.Dir, scenario.Name, err)
+				continue
+			}
+			if err != nil {
+				panic(fmt.Errorf("%s/%s: %w", suite.Dir, scenario.Name, err))
+			}
+			encoded, err := json.MarshalIndent(data, "", "  ")
+			if err != nil {
+				panic(err)
+			}
+			encoded = append(encoded, '\n')
+			outPath := filepath.Join(outDir, scenario.Name+".json")
+			if err := os.WriteFile(outPath, encoded, 0o644); err != nil {
+				panic(err)
+			}
+			fmt.Printf("wrote %s\n", outPath)
+		}
+	}
+	if err := writeVersion(root); err != nil {
+		panic(err)
+	}
+}
+
+// suiteDir returns where the fixtures of a suite go for the jd version
+// built in.
+func suiteDir(root, dir string) (string, error) {
+	if jdMajor == followedMajor {
+		return filepath.Join(root, filepath.FromSlash(dir)), nil
+	}
+	rel, ok := strings.CutPrefix(dir, fixturesDir+"/")
+	if !ok {
+		return "", fmt.Errorf("suite %s lies outside %s, so it has no %s directory", dir, fixturesDir, jdMajor)
+	}
+	return filepath.Join(root, filepath.FromSlash(fixturesDir), jdMajor, filepath.FromSlash(rel)), nil
+}
+
+// writeVersion records the jd module and version the fixtures came from in
+// VERSION.txt beside them.
+func writeVersion(root string) error {
+	version := "(unknown version)"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == jdModule {
+				version = dep.Version
+			}
+		}
+	}
+	dir := filepath.Join(root, filepath.FromSlash(fixturesDir))
+	if jdMajor != followedMajor {
+		dir = filepath.Join(dir, jdMajor)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "VERSION.txt"), []byte(jdModule+" "+version+"\n"), 0o644)
+}
+
+func readManifest(path string) (manifest, error) {
+	var parsed manifest
+	file, err := os.Open(path)
+	if err != nil {
+		return parsed, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&parsed); err != nil {
+		return parsed, fmt.Errorf("read manifest %s: %w", path, err)
+	}
+	for _, suite := range parsed.Suites {
+		if suite.Dir == "" {
+			return parsed, fmt.Errorf("manifest %s: suite without a dir", path)
+		}
+		switch suite.Kind {
+		case "", "diff", "patch":
+			if len(suite.Axes) > 0 || len(suite.Exclude) > 0 || len(suite.Render) > 0 {
+				return parsed, fmt.Errorf("manifest %s: axes, exclude, and render belong to matrix suites, not %s", path, suite.Dir)
+			}
+		case "matrix":
+			if len(suite.Axes) == 0 {
+				return parsed, fmt.Errorf("manifest %s: matrix suite %s without axes", path, suite.Dir)
+			}
+		default:
+			return parsed, fmt.Errorf("manifest %s: unsupported suite kind %q in %s", path, suite.Kind, suite.Dir)
+		}
+		seen := make(map[string]bool, len(suite.Scenarios))
+		for _, scenario := range suite.Scenarios {
+			if scenario.Name == "" || seen[scenario.Name] {
+				return parsed, fmt.Errorf("manifest %s: missing or duplicate scenario name %q in %s", path, scenario.Name, suite.Dir)
+			}
+			seen[scenario.Name] = true
+			if suite.Kind != "patch" && (scenario.Target != "" || scenario.Diff != "") {
+				return parsed, fmt.Errorf("manifest %s: %s/%s: target and diff belong to patch suites", path, suite.Dir, scenario.Name)
+			}
+		}
+	}
+	return parsed, nil
+}
+
+func generate(scenario scenario) (fixture, error) {
+	data := fixture{
+		LHS:     scenario.LHS,
+		RHS:     scenario.RHS,
+		Options: scenario.Options,
+		Format:  scenario.Format,
+	}
+	diff, err := diffScenario(scenario)
+	if err != nil {
+		return data, err
+	}
+	// Snapshot the diff first: RenderPatch reverses list additions in place.
+	data.Diff = diff.elements()
+	if len(scenario.Render) == 0 {
+		return data, nil
+	}
+
+	outputs := renderOutputs{}
+	for _, format := range scenario.Render {
+		var rendered string
+		switch format {
+		case "native", "native_bytes":
+			rendered, err = diff.render("native")
+		default:
+			rendered, err = diff.render(format)
+		}
+		if errors.Is(err, errUnsupported) {
+			// Record the outputs this jd version has; skip the rest.
+			continue
+		}
+		if err != nil {
+			return data, fmt.Errorf("render %s: %w", format, err)
+		}
+		switch format {
+		case "native":
+			outputs.Native = rendered
+		case "native_color":
+			outputs.NativeColor = rendered
+		case "native_bytes":
+			outputs.NativeBytes = make([]int, len(rendered))
+			for i := 0; i < len(rendered); i++ {
+				outputs.NativeBytes[i] = int(rendered[i])
+			}
+		case "patch":
+			outputs.Patch = rendered
+		case "merge":
+			outputs.Merge = rendered
+		}
+	}
+	data.Name = scenario.Name
+	data.Render = &outputs
+	return data, nil
+}
+
+// expandMatrix returns one scenario per scenario of the suite and
+// combination of options, named after both, such as "users__set__merge".
+func expandMatrix(suite suite) []scenario {
+	combinations := [][]string{nil}
+	for _, axis := range suite.Axes {
+		var next [][]string
+		for _, combination := range combinations {
+			for _, option := range axis {
+				extended := append([]string(nil), combination...)
+				if option != "" {
+					extended = append(extended, option)
+				}
+				next = append(next, extended)
+			}
+		}
+		combinations = next
+	}
+
+	var expanded []scenario
+	for _, combination := range combinations {
+		if excluded(combination, suite.Exclude) {
+			continue
+		}
+		suffix := "default"
+		if len(combination) > 0 {
+			suffix = strings.Join(combination, "__")
+		}
+		render := append([]string(nil), suite.Render...)
+		if contains(combination, "merge") {
+			render = append(render, "merge")
+		}
+		for _, base := range suite.Scenarios {
+			scenario := base
+			scenario.Name = fileName(base.Name + "__" + suffix)
+			scenario.Options = combination
+			scenario.Render = render
+			expanded = append(expanded, scenario)
+		}
+	}
+	return expanded
+}
+
+func excluded(combination []string, exclude [][]string) bool {
+	for _, options := range exclude {
+		all := true
+		for _, option := range options {
+			all = all && contains(combination, option)
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(options []string, option string) bool {
+	for _, candidate := range options {
+		if candidate == option {
+			return true
+		}
+	}
+	return false
+}
+
+// fileName replaces the characters of option values, such as "=" and ".",
+// that do not belong in fixture file names.
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// diffScenario diffs the lhs and rhs of a scenario under its options.
+func diffScenario(scenario scenario) (upstreamDiff, error) {
+	lhs, err := readNode(scenario.LHS, scenario.Format)
+	if err != nil {
+		return upstreamDiff{}, fmt.Errorf("parse lhs: %w", err)
+	}
+	rhs, err := readNode(scenario.RHS, scenario.Format)
+	if err != nil {
+		return upstreamDiff{}, fmt.Errorf("parse rhs: %w", err)
+	}
+	return diffNodes(lhs, rhs, scenario.Options)
+}
+
+func generatePatch(scenario scenario) (patchFixture, error) {
+	data := patchFixture{
+		Name:    scenario.Name,
+		Target:  scenario.Target,
+		Diff:    scenario.Diff,
+		Options: scenario.Options,
+	}
+	if data.Target == "" {
+		data.Target = scenario.LHS
+	}
+	var diff upstreamDiff
+	if data.Diff != "" {
+		parsed, err := readDiff(data.Diff)
+		if err != nil {
+			return data, fmt.Errorf("parse diff: %w", err)
+		}
+		diff = parsed
+	} else {
+		computed, err := diffScenario(scenario)
+		if err != nil {
+			return data, err
+		}
+		diff = computed
+		if data.Diff, err = diff.render("native"); err != nil {
+			return data, fmt.Errorf("render native: %w", err)
+		}
+	}
+	target, err := readNode(data.Target, scenario.Format)
+	if err != nil {
+		return data, fmt.Errorf("parse target: %w", err)
+	}
+	rendered, err := target.patch(diff)
+	if err != nil {
+		data.Error = err.Error()
+		return data, nil
+	}
+	data.Patched = &rendered
+	return data, nil
+}
+
+func findRepoRoot(start string) (string, error) {
+	dir := start
+	for {
+		marker := filepath.Join(dir, "crates", "jd-core")
+		if _, err := os.Stat(marker); err == nil {
+			return dir, nil
+		}
+		next := filepath.Dir(dir)
+		if next == dir {
+			return "", fmt.Errorf("could not locate repo root from %s", start)
+		}
+		dir = next
+	}
+}
+
+func convertInterface(value interface{}) nodeRepr {
+	switch v := value.(type) {
+	case nil:
+		return nodeRepr{Type: "Null"}
+	case bool:
+		return nodeRepr{Type: "Bool", Value: v}
+	case float64:
+		return nodeRepr{Type: "Number", Value: v}
+	case string:
+		return nodeRepr{Type: "String", Value: v}
+	case []interface{}:
+		children := make([]nodeRepr, len(v))
+		for i, child := range v {
+			children[i] = convertInterface(child)
+		}
+		return nodeRepr{Type: "Array", Value: children}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		children := make(map[string]nodeRepr, len(v))
+		for _, key := range keys {
+			children[key] = convertInterface(v[key])
+		}
+		return nodeRepr{Type: "Object", Value: children}
+	default:
+		panic(fmt.Sprintf("unsupported value type %T", v))
+	}
+}
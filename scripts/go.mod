@@ -4,7 +4,10 @@ go 1.24.0
 
 toolchain go1.24.3
 
-require github.com/josephburnett/jd/v2 v2.2.2
+require (
+	github.com/josephburnett/jd v1.8.1
+	github.com/josephburnett/jd/v2 v2.2.2
+)
 
 require (
 	github.com/go-openapi/jsonpointer v0.21.0 // indirect
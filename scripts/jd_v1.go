@@ -0,0 +1,173 @@
+//go:build jdv1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	jd "github.com/josephburnett/jd/lib"
+)
+
+// The jd v1 module. Its fixtures record what changed between major
+// versions; jd-rs follows v2. go.mod pins v1.8.1, the last v1 release
+// without a copy of the v2 package, which would make the jd/v2 import of
+// jd_v2.go ambiguous.
+const (
+	jdModule = "github.com/josephburnett/jd"
+	jdMajor  = "v1"
+)
+
+type document struct{ node jd.JsonNode }
+
+type upstreamDiff struct{ diff jd.Diff }
+
+func readNode(input, format string) (document, error) {
+	read := jd.ReadJsonString
+	if format == "yaml" {
+		read = jd.ReadYamlString
+	}
+	node, err := read(input)
+	return document{node}, err
+}
+
+// readDiff reads a native diff. Diffs written for v2, with context or
+// option lines, are unsupported rather than malformed.
+func readDiff(text string) (upstreamDiff, error) {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "^") {
+			return upstreamDiff{}, fmt.Errorf("context and option lines: %w", errUnsupported)
+		}
+	}
+	diff, err := jd.ReadDiffString(text)
+	return upstreamDiff{diff}, err
+}
+
+func diffNodes(lhs, rhs document, opts []string) (upstreamDiff, error) {
+	metadata := make([]jd.Metadata, 0, len(opts))
+	for _, opt := range opts {
+		switch opt {
+		case "merge":
+			metadata = append(metadata, jd.MERGE)
+		case "set":
+			metadata = append(metadata, jd.SET)
+		case "mset":
+			metadata = append(metadata, jd.MULTISET)
+		default:
+			if keys, ok := strings.CutPrefix(opt, "setkeys="); ok {
+				metadata = append(metadata, jd.Setkeys(strings.Split(keys, ",")...))
+				continue
+			}
+			if strings.HasPrefix(opt, "precision=") {
+				return upstreamDiff{}, fmt.Errorf("option %q: %w", opt, errUnsupported)
+			}
+			return upstreamDiff{}, fmt.Errorf("unsupported option %q", opt)
+		}
+	}
+	return upstreamDiff{lhs.node.Diff(rhs.node, metadata...)}, nil
+}
+
+// elements converts the diff into the fixture form. v1 records no context
+// lines, so before and after stay empty. v1 paths carry metadata as arrays of
+// strings ahead of the segment they apply to; MERGE becomes the element's
+// metadata and a multiset's ["multiset"],{} becomes v2's [] segment.
+func (d upstreamDiff) elements() []diffElement {
+	elements := make([]diffElement, len(d.diff))
+	for i, element := range d.diff {
+		var metadata *diffMetadata
+		path := make([]interface{}, 0, len(element.Path))
+		multiset := false
+		for _, segment := range element.Path {
+			var value interface{}
+			if err := json.Unmarshal([]byte(segment.Json()), &value); err != nil {
+				panic(err)
+			}
+			switch value := value.(type) {
+			case []interface{}:
+				for _, m := range value {
+					switch m {
+					case "MERGE":
+						metadata = &diffMetadata{Merge: true}
+					case "multiset":
+						multiset = true
+					}
+				}
+				continue
+			case float64:
+				path = append(path, int(value))
+			case map[string]interface{}:
+				if multiset && len(value) == 0 {
+					path = append(path, []interface{}{})
+				} else {
+					path = append(path, value)
+				}
+			default:
+				path = append(path, value)
+			}
+			multiset = false
+		}
+		elements[i] = diffElement{
+			Metadata: metadata,
+			Path:     path,
+			Before:   []nodeRepr{},
+			Remove:   convertNodes(element.OldValues),
+			Add:      convertNodes(element.NewValues),
+			After:    []nodeRepr{},
+		}
+	}
+	return elements
+}
+
+func (d upstreamDiff) render(format string) (string, error) {
+	switch format {
+	case "native":
+		return d.diff.Render(), nil
+	case "native_color":
+		return "", errUnsupported
+	case "patch":
+		return d.diff.RenderPatch()
+	case "merge":
+		return d.diff.RenderMerge()
+	default:
+		return "", fmt.Errorf("unsupported render format %q", format)
+	}
+}
+
+// patch applies d to the document, returning the patched document as JSON.
+func (n document) patch(d upstreamDiff) (string, error) {
+	patched, err := n.node.Patch(d.diff)
+	if err != nil {
+		return "", err
+	}
+	return patched.Json(), nil
+}
+
+func convertNodes(nodes []jd.JsonNode) []nodeRepr {
+	if len(nodes) == 0 {
+		return []nodeRepr{}
+	}
+	converted := make([]nodeRepr, len(nodes))
+	for i, node := range nodes {
+		converted[i] = convertNode(node)
+	}
+	return converted
+}
+
+// convertNode encodes node as the native renderer does, with
+// json.Marshal, which keeps sets in their original order where Json sorts
+// them by hash.
+func convertNode(node jd.JsonNode) nodeRepr {
+	if node.Json() == "" {
+		return nodeRepr{Type: "Void"}
+	}
+	rendered, err := json.Marshal(node)
+	if err != nil {
+		panic(err)
+	}
+	var raw interface{}
+	if err := json.Unmarshal(rendered, &raw); err != nil {
+		panic(err)
+	}
+	return convertInterface(raw)
+}
@@ -0,0 +1,178 @@
+//go:build !jdv1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	jd "github.com/josephburnett/jd/v2"
+)
+
+// The jd v2 module, whose behavior jd-rs follows.
+const (
+	jdModule = "github.com/josephburnett/jd/v2"
+	jdMajor  = "v2"
+)
+
+type document struct{ node jd.JsonNode }
+
+type upstreamDiff struct{ diff jd.Diff }
+
+func readNode(input, format string) (document, error) {
+	read := jd.ReadJsonString
+	if format == "yaml" {
+		read = jd.ReadYamlString
+	}
+	node, err := read(input)
+	return document{node}, err
+}
+
+func readDiff(text string) (upstreamDiff, error) {
+	diff, err := jd.ReadDiffString(text)
+	return upstreamDiff{diff}, err
+}
+
+func diffNodes(lhs, rhs document, opts []string) (upstreamDiff, error) {
+	options, err := convertOptions(opts)
+	if err != nil {
+		return upstreamDiff{}, err
+	}
+	return upstreamDiff{lhs.node.Diff(rhs.node, options...)}, nil
+}
+
+func (d upstreamDiff) elements() []diffElement {
+	return convertDiff(d.diff)
+}
+
+func (d upstreamDiff) render(format string) (string, error) {
+	switch format {
+	case "native":
+		return d.diff.Render(), nil
+	case "native_color":
+		return d.diff.Render(jd.COLOR), nil
+	case "patch":
+		return d.diff.RenderPatch()
+	case "merge":
+		return d.diff.RenderMerge()
+	default:
+		return "", fmt.Errorf("unsupported render format %q", format)
+	}
+}
+
+// patch applies d to the document, returning the patched document as JSON.
+func (n document) patch(d upstreamDiff) (string, error) {
+	patched, err := n.node.Patch(d.diff)
+	if err != nil {
+		return "", err
+	}
+	return patched.Json(), nil
+}
+
+func convertOptions(opts []string) ([]jd.Option, error) {
+	converted := make([]jd.Option, 0, len(opts))
+	for _, opt := range opts {
+		switch opt {
+		case "merge":
+			converted = append(converted, jd.MERGE)
+		case "set":
+			converted = append(converted, jd.SET)
+		case "mset":
+			converted = append(converted, jd.MULTISET)
+		default:
+			if keys, ok := strings.CutPrefix(opt, "setkeys="); ok {
+				converted = append(converted, jd.SetKeys(strings.Split(keys, ",")...))
+				continue
+			}
+			if value, ok := strings.CutPrefix(opt, "precision="); ok {
+				precision, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("option %q: %w", opt, err)
+				}
+				converted = append(converted, jd.Precision(precision))
+				continue
+			}
+			return nil, fmt.Errorf("unsupported option %q", opt)
+		}
+	}
+	return converted, nil
+}
+
+func convertDiff(diff jd.Diff) []diffElement {
+	elements := make([]diffElement, len(diff))
+	for i, element := range diff {
+		var metadata *diffMetadata
+		if element.Metadata.Merge {
+			metadata = &diffMetadata{Merge: true}
+		}
+		elements[i] = diffElement{
+			Metadata: metadata,
+			Path:     convertPath(element.Path),
+			Before:   convertNodes(element.Before),
+			Remove:   convertNodes(element.Remove),
+			Add:      convertNodes(element.Add),
+			After:    convertNodes(element.After),
+		}
+	}
+	return elements
+}
+
+func convertPath(path jd.Path) []interface{} {
+	segments := make([]interface{}, len(path))
+	for i, segment := range path {
+		switch v := segment.(type) {
+		case jd.PathKey:
+			segments[i] = string(v)
+		case jd.PathIndex:
+			segments[i] = int(v)
+		case jd.PathSet:
+			segments[i] = map[string]interface{}{}
+		case jd.PathMultiset:
+			segments[i] = []interface{}{}
+		case jd.PathSetKeys:
+			keys := make(map[string]interface{}, len(v))
+			for key, value := range v {
+				var decoded interface{}
+				if err := json.Unmarshal([]byte(value.Json()), &decoded); err != nil {
+					panic(err)
+				}
+				keys[key] = decoded
+			}
+			segments[i] = keys
+		default:
+			panic(fmt.Sprintf("unsupported path element %T", v))
+		}
+	}
+	return segments
+}
+
+func convertNodes(nodes []jd.JsonNode) []nodeRepr {
+	if len(nodes) == 0 {
+		return []nodeRepr{}
+	}
+	converted := make([]nodeRepr, len(nodes))
+	for i, node := range nodes {
+		converted[i] = convertNode(node)
+	}
+	return converted
+}
+
+// convertNode encodes node as the native renderer does, with
+// json.Marshal, which keeps sets in their original order where Json sorts
+// them by hash.
+func convertNode(node jd.JsonNode) nodeRepr {
+	if node.Json() == "" {
+		return nodeRepr{Type: "Void"}
+	}
+	rendered, err := json.Marshal(node)
+	if err != nil {
+		panic(err)
+	}
+	var raw interface{}
+	if err := json.Unmarshal(rendered, &raw); err != nil {
+		panic(err)
+	}
+	return convertInterface(raw)
+}
@@ -0,0 +1,375 @@
+#!/usr/bin/env python3
+"""Report which upstream jd behaviors have parity fixtures and Rust tests.
+
+The upstream flag and feature matrix below lists what Go jd v2.2.2 does.
+For each behavior the report counts the upstream captures under
+docs/parity/upstream, the Go-generated fixtures under
+crates/jd-core/tests/fixtures, and the Rust test files that exercise it,
+and marks the behavior covered, untested, unpinned (tests without upstream
+evidence), or uncovered. Scenarios in scripts/fixtures.json whose fixture
+files have not been generated yet are listed separately.
+"""
+from __future__ import annotations
+
+import argparse
+import json
+import re
+import shlex
+import sys
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import Callable
+
+REPO_ROOT = Path(__file__).resolve().parent.parent
+DATASET_DIR = REPO_ROOT / "docs/parity/upstream/jd-v2.2.2"
+FIXTURES_DIR = REPO_ROOT / "crates/jd-core/tests/fixtures"
+MANIFEST = REPO_ROOT / "scripts/fixtures.json"
+TEST_GLOBS = ("crates/*/tests/*.rs", "tests/*.rs")
+
+# Go jd flags that take a value, as "-flag value" or "-flag=value".
+VALUE_FLAGS = {"-f", "-t", "-o", "-setkeys", "-precision", "-port"}
+# Flags that select something other than the default native diff.
+MODE_FLAGS = {"-p", "-t", "-f", "-color", "-set", "-mset", "-setkeys", "-precision", "-yaml"}
+
+
+@dataclass
+class Scenario:
+    """An upstream capture: its directory and the flags of its command."""
+
+    name: str
+    flags: set[str]
+    error: bool
+
+
+@dataclass
+class Fixture:
+    """A Go-generated fixture and the suite directory holding it."""
+
+    suite: str
+    data: dict
+
+
+@dataclass(frozen=True)
+class Behavior:
+    name: str
+    description: str
+    captured: Callable[[Scenario], bool] = lambda scenario: False
+    fixture: Callable[[Fixture], bool] = lambda fixture: False
+    tests: tuple[str, ...] = ()
+
+
+def flags(*wanted: str) -> Callable[[Scenario], bool]:
+    return lambda scenario: not scenario.error and all(flag in scenario.flags for flag in wanted)
+
+
+def options(predicate: Callable[[str], bool]) -> Callable[[Fixture], bool]:
+    return lambda fixture: any(predicate(option) for option in fixture.data.get("options", []))
+
+
+def rendered(output: str) -> Callable[[Fixture], bool]:
+    return lambda fixture: output in fixture.data.get("render", {})
+
+
+def default_diff(fixture: Fixture) -> bool:
+    return fixture.suite != "patch" and not fixture.data.get("options") and not fixture.data.get("format")
+
+
+BEHAVIORS = [
+    Behavior(
+        "diff",
+        "Native diff of two JSON files",
+        captured=lambda scenario: not scenario.error and scenario.flags.isdisjoint(MODE_FLAGS),
+        fixture=default_diff,
+        tests=(r"\.diff\(&", r"fn \w*diff\w*\("),
+    ),
+    Behavior(
+        "color",
+        "-color renders the native diff with ANSI colors",
+        captured=flags("-color"),
+        fixture=rendered("native_color"),
+        tests=(r'"-color', r"with_color\(true\)"),
+    ),
+    Behavior(
+        "set",
+        "-set treats arrays as sets",
+        captured=flags("-set"),
+        fixture=options(lambda option: option == "set"),
+        tests=(r'"-set"', r"ArrayMode::Set\b"),
+    ),
+    Behavior(
+        "multiset",
+        "-mset treats arrays as multisets",
+        captured=flags("-mset"),
+        fixture=options(lambda option: option == "mset"),
+        tests=(r'"-mset"', r"ArrayMode::MultiSet\b"),
+    ),
+    Behavior(
+        "setkeys",
+        "-setkeys identifies set objects by keys",
+        captured=flags("-setkeys"),
+        fixture=options(lambda option: option.startswith("setkeys=")),
+        tests=(r'"-setkeys', r"with_set_keys\("),
+    ),
+    Behavior(
+        "precision",
+        "-precision compares numbers within a tolerance",
+        captured=flags("-precision"),
+        fixture=options(lambda option: option.startswith("precision=")),
+        tests=(r'"-precision', r"with_precision\("),
+    ),
+    Behavior(
+        "merge-diff",
+        "Diffs under the MERGE option",
+        fixture=options(lambda option: option == "merge"),
+        tests=(r"from_merge_patch_str\(",),
+    ),
+    Behavior(
+        "yaml",
+        "-yaml reads and writes YAML",
+        captured=flags("-yaml"),
+        fixture=lambda fixture: fixture.data.get("format") == "yaml",
+        tests=(r'"-yaml"', r"from_yaml_str\("),
+    ),
+    Behavior(
+        "format-patch",
+        "-f patch renders RFC 6902 JSON Patch",
+        captured=flags("-f=patch"),
+        fixture=rendered("patch"),
+        tests=(r'"-f=patch"', r"render_patch\("),
+    ),
+    Behavior(
+        "format-merge",
+        "-f merge renders RFC 7386 JSON Merge Patch",
+        captured=flags("-f=merge"),
+        fixture=rendered("merge"),
+        tests=(r'"-f=merge"', r"render_merge\("),
+    ),
+    Behavior(
+        "patch",
+        "-p applies a native diff",
+        captured=lambda scenario: flags("-p")(scenario) and "-f" not in scenario.flags,
+        fixture=lambda fixture: fixture.suite == "patch",
+        tests=(r'"-p"', r"\.apply_patch\("),
+    ),
+    Behavior(
+        "patch-json-patch",
+        "-p -f patch applies a JSON Patch",
+        captured=flags("-p", "-f=patch"),
+        tests=(r"from_json_patch_str\(",),
+    ),
+    Behavior(
+        "patch-merge",
+        "-p -f merge applies a JSON Merge Patch",
+        captured=flags("-p", "-f=merge"),
+        tests=(r"apply_merge_patch\(",),
+    ),
+    *(
+        Behavior(
+            f"translate-{formats}",
+            f"-t {formats} translates between formats",
+            captured=flags(f"-t={formats}"),
+            tests=(rf'"-t={formats}"', rf'"{formats}"'),
+        )
+        for formats in ("jd2patch", "patch2jd", "jd2merge", "merge2jd", "json2yaml", "yaml2json")
+    ),
+    Behavior(
+        "output-file",
+        "-o writes to a file instead of STDOUT",
+        captured=flags("-o"),
+        tests=(r'"-o"', r'"-o='),
+    ),
+    Behavior(
+        "version",
+        "-version prints the version banner",
+        captured=flags("-version"),
+        tests=(r'"-version"', r'"--version"'),
+    ),
+    Behavior(
+        "git-diff-driver",
+        "-git-diff-driver diffs git's external diff arguments",
+        captured=flags("-git-diff-driver"),
+        tests=(r'"-git-diff-driver"',),
+    ),
+    Behavior(
+        "web-ui",
+        "-port serves the web UI",
+        captured=flags("-port"),
+        tests=(r'"-port', r"web::serve"),
+    ),
+    Behavior(
+        "errors",
+        "Error messages and exit status 2",
+        captured=lambda scenario: scenario.error,
+        fixture=lambda fixture: fixture.suite == "patch" and "error" in fixture.data,
+        tests=(r"\.code\(2\)",),
+    ),
+]
+
+
+def command_flags(command: str) -> set[str]:
+    """Returns the flags of a captured command, with "-flag=value" for each
+    flag that takes a value as well as the bare "-flag"."""
+    found: set[str] = set()
+    tokens = shlex.split(command)
+    for index, token in enumerate(tokens):
+        if not token.startswith("-") or token == "-":
+            continue
+        name, _, value = token.partition("=")
+        if name in VALUE_FLAGS and not value and index + 1 < len(tokens):
+            value = tokens[index + 1]
+        found.add(name)
+        if value:
+            found.add(f"{name}={value}")
+    return found
+
+
+def load_scenarios() -> list[Scenario]:
+    scenarios = []
+    for command_file in sorted(DATASET_DIR.glob("*/command.txt")):
+        lines = [line for line in command_file.read_text().splitlines() if line and not line.startswith("#")]
+        command = " ".join(lines).split(">")[0]
+        directory = command_file.parent
+        scenarios.append(
+            Scenario(directory.name, command_flags(command), (directory / "stderr.txt").is_file())
+        )
+    return scenarios
+
+
+def load_fixtures() -> list[Fixture]:
+    fixtures = []
+    for path in sorted(FIXTURES_DIR.glob("*/**/*.json")):
+        suite = path.parent.relative_to(FIXTURES_DIR).as_posix()
+        # msgpack fixtures are hand-written; v1/... hold other jd versions.
+        if suite == "msgpack" or re.fullmatch(r"v\d+(/.*)?", suite):
+            continue
+        fixtures.append(Fixture(suite, json.loads(path.read_text())))
+    return fixtures
+
+
+def load_tests() -> dict[str, str]:
+    return {
+        path.relative_to(REPO_ROOT).as_posix(): path.read_text()
+        for pattern in TEST_GLOBS
+        for path in sorted(REPO_ROOT.glob(pattern))
+    }
+
+
+def pending_fixtures() -> list[str]:
+    """Lists manifest scenarios whose fixture files do not exist yet. Matrix
+    suites count as pending while their directory is missing."""
+    manifest = json.loads(MANIFEST.read_text())
+    pending = []
+    for suite in manifest["suites"]:
+        directory = REPO_ROOT / suite["dir"]
+        if suite.get("kind") == "matrix":
+            if not directory.is_dir():
+                pending.append(f"{suite['dir']}/ (matrix)")
+            continue
+        for scenario in suite["scenarios"]:
+            if not (directory / f"{scenario['name']}.json").is_file():
+                pending.append(f"{suite['dir']}/{scenario['name']}.json")
+    return pending
+
+
+@dataclass
+class Coverage:
+    behavior: Behavior
+    captures: list[str] = field(default_factory=list)
+    fixtures: int = 0
+    tests: list[str] = field(default_factory=list)
+
+    @property
+    def status(self) -> str:
+        evidence = bool(self.captures or self.fixtures)
+        if evidence and self.tests:
+            return "covered"
+        if evidence:
+            return "untested"
+        if self.tests:
+            return "unpinned"
+        return "uncovered"
+
+    def to_json(self) -> dict:
+        return {
+            "behavior": self.behavior.name,
+            "description": self.behavior.description,
+            "captures": self.captures,
+            "fixtures": self.fixtures,
+            "tests": self.tests,
+            "status": self.status,
+        }
+
+
+def measure() -> list[Coverage]:
+    scenarios = load_scenarios()
+    fixtures = load_fixtures()
+    tests = load_tests()
+    report = []
+    for behavior in BEHAVIORS:
+        patterns = [re.compile(pattern) for pattern in behavior.tests]
+        report.append(
+            Coverage(
+                behavior,
+                captures=[scenario.name for scenario in scenarios if behavior.captured(scenario)],
+                fixtures=sum(1 for fixture in fixtures if behavior.fixture(fixture)),
+                tests=[
+                    path
+                    for path, source in tests.items()
+                    if any(pattern.search(source) for pattern in patterns)
+                ],
+            )
+        )
+    return report
+
+
+def print_table(report: list[Coverage], pending: list[str]) -> None:
+    rows = [("behavior", "captures", "fixtures", "test files", "status")]
+    rows += [
+        (
+            coverage.behavior.name,
+            str(len(coverage.captures)),
+            str(coverage.fixtures),
+            str(len(coverage.tests)),
+            coverage.status,
+        )
+        for coverage in report
+    ]
+    widths = [max(len(row[column]) for row in rows) for column in range(len(rows[0]))]
+    for row in rows:
+        print("  ".join(cell.ljust(width) for cell, width in zip(row, widths)).rstrip())
+
+    counts: dict[str, int] = {}
+    for coverage in report:
+        counts[coverage.status] = counts.get(coverage.status, 0) + 1
+    print()
+    print(", ".join(f"{count} {status}" for status, count in sorted(counts.items())))
+    if pending:
+        print()
+        print(f"{len(pending)} fixture(s) in {MANIFEST.relative_to(REPO_ROOT)} not generated yet:")
+        for path in pending:
+            print(f"  {path}")
+
+
+def main(argv: list[str]) -> int:
+    parser = argparse.ArgumentParser(description=__doc__.splitlines()[0])
+    parser.add_argument("--json", action="store_true", help="Print the report as JSON.")
+    parser.add_argument(
+        "--fail-on",
+        choices=("uncovered", "untested"),
+        help="Exit 1 when a behavior is uncovered, or also when it is untested.",
+    )
+    args = parser.parse_args(argv)
+
+    report = measure()
+    pending = pending_fixtures()
+    if args.json:
+        print(json.dumps({"behaviors": [c.to_json() for c in report], "pending": pending}, indent=2))
+    else:
+        print_table(report, pending)
+
+    failing = {"uncovered": {"uncovered"}, "untested": {"uncovered", "untested"}}.get(args.fail_on, set())
+    return 1 if any(coverage.status in failing for coverage in report) else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
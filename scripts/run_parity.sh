@@ -25,16 +25,22 @@ fi
 tmp_root=$(mktemp -d -t jd-parity.XXXXXX)
 trap 'rm -rf "$tmp_root"' EXIT
 
+# Keep a developer's ~/.config/jd/config.toml from changing the captured output.
+export XDG_CONFIG_HOME="$tmp_root/config"
+
 declare -a failures=()
 
 declare -A stdout_expectations=(
+  [arrays-multiset]=diff.jd
+  [arrays-multiset-nested]=diff.jd
+  [arrays-set]=diff.jd
+  [arrays-setkeys]=diff.jd
+  [arrays-setkeys-nested]=diff.jd
   [color-output]=diff.color
   [default-nested-structures]=diff.jd
   [default-object]=diff.jd
   [format-merge]=diff.merge.json
   [format-patch]=diff.patch
-  [precision]=diff.jd
-  [precision-array]=diff.jd
   [yaml]=diff.jd
 )
 
@@ -43,23 +49,81 @@ declare -A file_expectations=(
   [output-flag-dash-filename]=-
   [output-flag-format-merge]=diff.merge
   [output-flag-format-patch]=diff.patch
+  [output-flag-patch-mode]=patched.json
+  [patch-mode]=patched.json
   [output-flag-yaml]=diff.jd
+  [output-flag-translate-jd2patch]=output.patch
+  [output-flag-translate-patch2jd]=output.jd
+  [translate-jd2patch]=output.patch
+  [translate-patch2jd]=output.jd
+)
+
+# Scenarios where jd-rs deliberately differs from the upstream capture.
+declare -A known_divergences=(
+  [precision]="upstream v2.2.2 ignores -precision; see ADRs/0004-honor-precision-in-diffs.md"
+  [precision-array]="upstream v2.2.2 ignores -precision; see ADRs/0004-honor-precision-in-diffs.md"
 )
 
-declare -A expected_failures=(
-  [arrays-multiset]="-mset is not implemented yet"
-  [arrays-multiset-nested]="-mset is not implemented yet"
-  [arrays-set]="-set is not implemented yet"
-  [arrays-setkeys]="-setkeys is not implemented yet"
-  [arrays-setkeys-nested]="-setkeys is not implemented yet"
-  [output-flag-patch-mode]="Patch mode is not implemented yet"
-  [patch-mode]="Patch mode is not implemented yet"
-  [output-flag-translate-jd2patch]="Translate mode is not implemented yet"
-  [output-flag-translate-patch2jd]="Translate mode is not implemented yet"
-  [translate-jd2patch]="Translate mode is not implemented yet"
-  [translate-patch2jd]="Translate mode is not implemented yet"
+declare -A expected_failures=()
+
+# Error scenarios (those holding a stderr.txt from scripts/capture_go_errors.sh)
+# must match Go jd's stderr byte for byte, except where jd-rs words the error
+# differently on purpose. docs/parity/error-mappings.txt maps each such
+# scenario to the text jd-rs's stderr must contain instead.
+declare -A error_mappings=()
+while read -r scenario text; do
+  [[ -z "$scenario" || "$scenario" == \#* ]] && continue
+  error_mappings[$scenario]="$text"
+done <"$REPO_ROOT/docs/parity/error-mappings.txt"
+
+# Exit status contract shared with Go jd: 0 = no diff (or patch/translate
+# succeeded), 1 = differences found, 2 = error.
+declare -A expected_exit_codes=(
+  [arrays-multiset]=1
+  [arrays-multiset-nested]=1
+  [arrays-set]=1
+  [arrays-setkeys]=1
+  [arrays-setkeys-nested]=1
+  [color-output]=1
+  [default-nested-structures]=1
+  [default-object]=1
+  [format-merge]=1
+  [format-patch]=1
+  [output-flag]=1
+  [output-flag-dash-filename]=1
+  [output-flag-format-merge]=1
+  [output-flag-format-patch]=1
+  [output-flag-patch-mode]=0
+  [output-flag-translate-jd2patch]=0
+  [output-flag-translate-patch2jd]=0
+  [output-flag-yaml]=1
+  [patch-mode]=0
+  [precision]=1
+  [precision-array]=1
+  [translate-jd2patch]=0
+  [translate-patch2jd]=0
+  [yaml]=1
 )
 
+# Records a failure unless the command exited with the scenario's expected
+# status. Returns non-zero when the status did not match.
+check_exit_code() {
+  local scenario="$1"
+  local status="$2"
+  local expected="${expected_exit_codes[$scenario]:-}"
+
+  if [[ -z "$expected" ]]; then
+    failures+=("$scenario: no expected exit code recorded")
+    echo "[FAIL] $scenario: no expected exit code recorded" >&2
+    return 1
+  fi
+  if [[ $status -ne $expected ]]; then
+    failures+=("$scenario: expected exit $expected, got $status")
+    echo "[FAIL] $scenario: expected exit $expected, got $status" >&2
+    return 1
+  fi
+}
+
 run_stdout() {
   local scenario="$1"
   local cmd="$2"
@@ -73,23 +137,12 @@ run_stdout() {
   else
     status=$?
   fi
-  if [[ $status -ne 0 && $status -ne 1 ]]; then
-    failures+=("$scenario: command failed (exit $status)")
-    echo "[FAIL] $scenario: command exited with status $status" >&2
+  if ! check_exit_code "$scenario" "$status"; then
     rm -f "$actual_file"
     return
   fi
 
   local expected_path="$DATASET_DIR/$scenario/$expected_rel"
-  local expect_diff=0
-  if [[ -s "$expected_path" ]]; then
-    expect_diff=1
-  fi
-  if [[ $expect_diff -ne 0 && $status -ne 1 ]]; then
-    failures+=("$scenario: expected exit 1 for diff, got $status")
-    echo "[FAIL] $scenario: expected exit 1 for diff output" >&2
-  fi
-
   if ! diff -u "$expected_path" "$actual_file" >"$actual_file.diff"; then
     failures+=("$scenario: stdout mismatch")
     echo "[FAIL] $scenario: output differed from upstream" >&2
@@ -116,9 +169,7 @@ run_file_output() {
   else
     status=$?
   fi
-  if [[ $status -ne 0 && $status -ne 1 ]]; then
-    failures+=("$scenario: command failed (exit $status)")
-    echo "[FAIL] $scenario: command exited with status $status" >&2
+  if ! check_exit_code "$scenario" "$status"; then
     return
   fi
 
@@ -149,9 +200,9 @@ run_expected_failure() {
   else
     status=$?
   fi
-  if [[ $status -eq 0 ]]; then
-    failures+=("$scenario: expected failure but command succeeded")
-    echo "[FAIL] $scenario: expected failure but command succeeded" >&2
+  if [[ $status -ne 2 ]]; then
+    failures+=("$scenario: expected exit 2 for an error, got $status")
+    echo "[FAIL] $scenario: expected exit 2 for an error, got $status" >&2
     rm -f "$stderr_file"
     return
   fi
@@ -169,6 +220,50 @@ run_expected_failure() {
   rm -f "$stderr_file"
 }
 
+# Runs an error scenario, checking the exit status captured from Go jd and
+# its stderr, exactly or through error_mappings.
+run_error() {
+  local scenario="$1"
+  local cmd="$2"
+  local expected_dir="$DATASET_DIR/$scenario"
+  local stderr_file
+  stderr_file=$(mktemp)
+
+  local status=0
+  if bash -c "$cmd" >/dev/null 2>"$stderr_file"; then
+    status=0
+  else
+    status=$?
+  fi
+  local expected_status
+  expected_status=$(<"$expected_dir/exit_code.txt")
+  if [[ $status -ne $expected_status ]]; then
+    failures+=("$scenario: expected exit $expected_status, got $status")
+    echo "[FAIL] $scenario: expected exit $expected_status, got $status" >&2
+    rm -f "$stderr_file"
+    return
+  fi
+
+  local mapped="${error_mappings[$scenario]:-}"
+  if [[ -n "$mapped" ]]; then
+    if grep -Fq -- "$mapped" "$stderr_file"; then
+      echo "[OK]   $scenario (mapped error)" >&2
+    else
+      failures+=("$scenario: stderr lacks mapped text")
+      echo "[FAIL] $scenario: stderr lacks \"$mapped\"" >&2
+      cat "$stderr_file" >&2
+    fi
+  elif ! diff -u "$expected_dir/stderr.txt" "$stderr_file" >"$stderr_file.diff"; then
+    failures+=("$scenario: stderr mismatch")
+    echo "[FAIL] $scenario: stderr differed from upstream" >&2
+    cat "$stderr_file.diff" >&2
+  else
+    echo "[OK]   $scenario" >&2
+  fi
+
+  rm -f "$stderr_file" "$stderr_file.diff"
+}
+
 for scenario_path in "$DATASET_DIR"/*; do
   [[ -d "$scenario_path" ]] || continue
   scenario=$(basename "$scenario_path")
@@ -192,7 +287,11 @@ for scenario_path in "$DATASET_DIR"/*; do
   cmd=${cmd//\/tmp\/jd/$JD_BIN}
 
   pushd "$workdir" >/dev/null
-  if [[ -n "${stdout_expectations[$scenario]:-}" ]]; then
+  if [[ -n "${known_divergences[$scenario]:-}" ]]; then
+    echo "[SKIP] $scenario: ${known_divergences[$scenario]}" >&2
+  elif [[ -f "$scenario_path/stderr.txt" ]]; then
+    run_error "$scenario" "$cmd"
+  elif [[ -n "${stdout_expectations[$scenario]:-}" ]]; then
     run_stdout "$scenario" "$cmd" "${stdout_expectations[$scenario]}"
   elif [[ -n "${file_expectations[$scenario]:-}" ]]; then
     run_file_output "$scenario" "$workdir" "$cmd" "${file_expectations[$scenario]}"